@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// StoreFirestore stores content and quizzes in Cloud Firestore
+	StoreFirestore = "firestore"
+	// StoreMemory keeps content and quizzes in process memory
+	StoreMemory = "memory"
+	// StoreSQLite stores content and quizzes in a local SQLite database
+	StoreSQLite = "sqlite"
+
+	// LLMVertex uses Gemini on Vertex AI
+	LLMVertex = "vertex"
+	// LLMOpenAI uses any OpenAI-compatible chat completions API, such as Ollama or vLLM
+	LLMOpenAI = "openai"
+	// LLMFake uses a deterministic provider that never calls a model
+	LLMFake = "fake"
+
+	// CacheStore caches extractions in the configured store
+	CacheStore = "store"
+	// CacheMemory caches extractions in a bounded in-memory LRU, for local runs
+	CacheMemory = "memory"
+	// CacheNone disables the extraction cache
+	CacheNone = "none"
+
+	// BlobLocal stores uploaded files in a local directory
+	BlobLocal = "local"
+	// BlobGCS stores uploaded files in a Cloud Storage bucket
+	BlobGCS = "gcs"
+	// BlobNone disables file uploads
+	BlobNone = "none"
+
+	// AuthFirebase verifies Firebase Authentication ID tokens
+	AuthFirebase = "firebase"
+	// AuthStatic verifies tokens signed by a fixed set of keys read from a file
+	AuthStatic = "static"
+	// AuthInsecure trusts the bearer token as the user ID, for local development only
+	AuthInsecure = "insecure"
+)
+
+// Config holds the runtime configuration of the backend, read from environment variables
+type Config struct {
+	Port           string
+	DebugAddr      string
+	ProjectID      string
+	StoreBackend   string
+	SQLitePath     string
+	JobWorkers     int
+	JobLease       time.Duration
+	JobMaxAttempts int
+
+	LLMProvider    string
+	GeminiLocation string
+	GeminiModel    string
+	OpenAIBaseURL  string
+	OpenAIAPIKey   string
+	OpenAIModel    string
+
+	LLMMaxAttempts      int
+	LLMRetryDeadline    time.Duration
+	LLMBreakerThreshold int
+	LLMBreakerCooldown  time.Duration
+
+	ExtractionCache      string
+	ExtractionCacheSize  int
+	ExtractionCacheTTL   time.Duration
+	ExtractionCacheFresh time.Duration
+	HTMLCleanup          bool
+
+	ChunkTokens          int
+	MaxChunks            int
+	ChunkedQuizQuestions int
+	ChunkConcurrency     int
+
+	FetchTimeout       time.Duration
+	FetchMaxBytes      int
+	FetchMaxRedirects  int
+	FetchUserAgent     string
+	FetchRespectRobots bool
+	FetchAllowPrivate  bool
+
+	BlobStore           string
+	BlobDir             string
+	BlobBucket          string
+	UploadMaxBytes      int
+	InlineMediaMaxBytes int
+	UploadExpiry        time.Duration
+
+	AuthProvider      string
+	FirebaseProjectID string
+	AuthKeysFile      string
+	AuthIssuer        string
+	AuthAudience      string
+}
+
+// Load reads the configuration from the environment, applying defaults for unset values
+func Load() Config {
+	return Config{
+		Port:           getEnv("PORT", "8080"),
+		DebugAddr:      getEnv("DEBUG_ADDR", "localhost:6060"),
+		ProjectID:      os.Getenv("GCP_PROJECT"),
+		StoreBackend:   getEnv("STORE_BACKEND", StoreFirestore),
+		SQLitePath:     getEnv("SQLITE_PATH", "quizbo.db"),
+		JobWorkers:     getEnvInt("JOB_WORKERS", 4),
+		JobLease:       getEnvDuration("JOB_LEASE", time.Minute),
+		JobMaxAttempts: getEnvInt("JOB_MAX_ATTEMPTS", 3),
+
+		LLMProvider:    getEnv("LLM_PROVIDER", LLMVertex),
+		GeminiLocation: getEnv("GEMINI_LOCATION", "northamerica-northeast1"),
+		GeminiModel:    getEnv("GEMINI_MODEL", "gemini-1.5-pro"),
+		OpenAIBaseURL:  getEnv("OPENAI_BASE_URL", "http://localhost:11434/v1"),
+		OpenAIAPIKey:   os.Getenv("OPENAI_API_KEY"),
+		OpenAIModel:    getEnv("OPENAI_MODEL", "llama3.1"),
+
+		LLMMaxAttempts:      getEnvInt("LLM_MAX_ATTEMPTS", 4),
+		LLMRetryDeadline:    getEnvDuration("LLM_RETRY_DEADLINE", 2*time.Minute),
+		LLMBreakerThreshold: getEnvInt("LLM_BREAKER_THRESHOLD", 5),
+		LLMBreakerCooldown:  getEnvDuration("LLM_BREAKER_COOLDOWN", 30*time.Second),
+
+		ExtractionCache:      getEnv("EXTRACTION_CACHE", CacheStore),
+		ExtractionCacheSize:  getEnvInt("EXTRACTION_CACHE_SIZE", 500),
+		ExtractionCacheTTL:   getEnvDuration("EXTRACTION_CACHE_TTL", 7*24*time.Hour),
+		ExtractionCacheFresh: getEnvDuration("EXTRACTION_CACHE_FRESH", 10*time.Minute),
+		HTMLCleanup:          getEnvBool("HTML_LLM_CLEANUP", false),
+
+		ChunkTokens:          getEnvInt("CHUNK_TOKENS", 4000),
+		MaxChunks:            getEnvInt("MAX_CHUNKS", 8),
+		ChunkedQuizQuestions: getEnvInt("CHUNKED_QUIZ_QUESTIONS", 10),
+		ChunkConcurrency:     getEnvInt("CHUNK_CONCURRENCY", 4),
+
+		FetchTimeout:       getEnvDuration("FETCH_TIMEOUT", 30*time.Second),
+		FetchMaxBytes:      getEnvInt("FETCH_MAX_BYTES", 10<<20),
+		FetchMaxRedirects:  getEnvInt("FETCH_MAX_REDIRECTS", 5),
+		FetchUserAgent:     getEnv("FETCH_USER_AGENT", "Quizbo/1.0"),
+		FetchRespectRobots: getEnvBool("FETCH_RESPECT_ROBOTS", false),
+		FetchAllowPrivate:  getEnvBool("FETCH_ALLOW_PRIVATE", false),
+
+		BlobStore:           getEnv("BLOB_STORE", BlobLocal),
+		BlobDir:             getEnv("BLOB_DIR", "uploads"),
+		BlobBucket:          os.Getenv("BLOB_BUCKET"),
+		UploadMaxBytes:      getEnvInt("UPLOAD_MAX_BYTES", 512<<20),
+		InlineMediaMaxBytes: getEnvInt("INLINE_MEDIA_MAX_BYTES", 16<<20),
+		UploadExpiry:        getEnvDuration("UPLOAD_EXPIRY", 24*time.Hour),
+
+		AuthProvider:      getEnv("AUTH_PROVIDER", AuthFirebase),
+		FirebaseProjectID: getEnv("FIREBASE_PROJECT_ID", os.Getenv("GCP_PROJECT")),
+		AuthKeysFile:      os.Getenv("AUTH_KEYS_FILE"),
+		AuthIssuer:        os.Getenv("AUTH_ISSUER"),
+		AuthAudience:      os.Getenv("AUTH_AUDIENCE"),
+	}
+}
+
+// getEnv returns the value of the environment variable or the fallback if it is unset
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getEnvInt returns the integer value of the environment variable or the fallback if it is unset or invalid
+func getEnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvBool returns the boolean value of the environment variable, e.g. "true" or "1", or the fallback if it is unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getEnvDuration returns the duration value of the environment variable, e.g. "30s", or the fallback if it is unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// errAttemptFinished is returned when a finished attempt would be changed
+var errAttemptFinished = errors.New("attempt is already finished")
+
+// StartAttemptRequest is a struct to hold the quiz a user starts an attempt at
+type StartAttemptRequest struct {
+	ContentID string `json:"content_id"`
+	QuizID    string `json:"quiz_id"`
+}
+
+// ListAttemptsResponse is a struct to hold a user's attempts, newest first
+type ListAttemptsResponse struct {
+	Attempts []models.Attempt `json:"attempts"`
+}
+
+// findQuiz returns the quiz with quizID in content, or nil if there is none
+func findQuiz(content *models.Content, quizID string) *models.Quiz {
+	for i := range content.Quizzes {
+		if content.Quizzes[i].QuizID == quizID {
+			return &content.Quizzes[i]
+		}
+	}
+	return nil
+}
+
+// findQuestion returns the question of quiz with questionID, also accepting the legacy ID a migrated
+// question had, or nil if there is none
+func findQuestion(quiz *models.Quiz, questionID string) *models.Question {
+	for i := range quiz.Questions {
+		if quiz.Questions[i].QuestionID == questionID {
+			return &quiz.Questions[i]
+		}
+	}
+	for i := range quiz.Questions {
+		if questionID != "" && quiz.Questions[i].LegacyID == questionID {
+			return &quiz.Questions[i]
+		}
+	}
+	return nil
+}
+
+// recordResponse adds a reviewed response to attempt, replacing any earlier response to the same question
+func recordResponse(attempt *models.Attempt, response models.AttemptResponse) error {
+	if attempt.Status == models.AttemptStatusFinished {
+		return errAttemptFinished
+	}
+	for i := range attempt.Responses {
+		if attempt.Responses[i].QuestionID == response.QuestionID {
+			attempt.Responses[i] = response
+			return nil
+		}
+	}
+	attempt.Responses = append(attempt.Responses, response)
+	return nil
+}
+
+// finishAttempt scores attempt as the percentage of all of the quiz's questions answered correctly,
+// so unanswered questions count as incorrect
+func finishAttempt(attempt *models.Attempt, now time.Time) error {
+	if attempt.Status == models.AttemptStatusFinished {
+		return errAttemptFinished
+	}
+	correct := 0
+	for _, response := range attempt.Responses {
+		if strings.TrimSpace(response.Status) == utils.ReviewPass {
+			correct++
+		}
+	}
+	attempt.CorrectCount = correct
+	if attempt.TotalQuestions > 0 {
+		attempt.Score = (correct*100 + attempt.TotalQuestions/2) / attempt.TotalQuestions
+	}
+	attempt.Status = models.AttemptStatusFinished
+	attempt.FinishedAt = &now
+	return nil
+}
+
+// loadAttempt fetches attemptID and checks it belongs to userID. It responds with 404, 403 or 500
+// and returns false if the attempt cannot be used.
+func (s *Server) loadAttempt(w http.ResponseWriter, r *http.Request, handler, attemptID, userID string) (*models.Attempt, bool) {
+	attempt, err := s.Store.GetAttempt(r.Context(), attemptID)
+	if errors.Is(err, services.ErrNotFound) {
+		s.Logger.Printf("%s: Attempt not found: %v", handler, err)
+		http.Error(w, "Attempt not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		s.Logger.Printf("%s: Error retrieving attempt: %v", handler, err)
+		http.Error(w, "Error retrieving attempt", http.StatusInternalServerError)
+		return nil, false
+	}
+	if attempt.UserID != userID {
+		s.Logger.Printf("%s: User %s may not access attempt %s", handler, userID, attemptID)
+		http.Error(w, "Access to attempt denied", http.StatusForbidden)
+		return nil, false
+	}
+	return attempt, true
+}
+
+// writeAttempt encodes attempt as the JSON response with the given status code
+func (s *Server) writeAttempt(w http.ResponseWriter, handler string, status int, attempt *models.Attempt) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(attempt); err != nil {
+		s.Logger.Printf("%s: Error encoding response: %v", handler, err)
+	}
+}
+
+// StartAttemptHandler starts a new attempt at a quiz the user may read
+func (s *Server) StartAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "StartAttemptHandler")
+	if !ok {
+		return
+	}
+
+	var request StartAttemptRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.Logger.Printf("StartAttemptHandler: Unable to parse request: %v", err)
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+
+	content, ok := s.authorizeContent(w, r, "StartAttemptHandler", request.ContentID, userID, false)
+	if !ok {
+		return
+	}
+	quiz := findQuiz(content, request.QuizID)
+	if quiz == nil {
+		s.Logger.Printf("StartAttemptHandler: Quiz not found: %s", request.QuizID)
+		http.Error(w, "Quiz not found", http.StatusNotFound)
+		return
+	}
+
+	attempt := models.Attempt{
+		AttemptID:      utils.GenerateAttemptID(),
+		UserID:         userID,
+		ContentID:      content.ContentID,
+		QuizID:         quiz.QuizID,
+		Title:          content.Title,
+		Status:         models.AttemptStatusInProgress,
+		Responses:      []models.AttemptResponse{},
+		TotalQuestions: len(quiz.Questions),
+		StartedAt:      time.Now(),
+	}
+	if err := s.Store.SaveAttempt(r.Context(), attempt); err != nil {
+		s.Logger.Printf("StartAttemptHandler: Error saving attempt: %v", err)
+		http.Error(w, "Error saving attempt", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/attempts/"+attempt.AttemptID)
+	s.writeAttempt(w, "StartAttemptHandler", http.StatusCreated, &attempt)
+}
+
+// ListAttemptsHandler lists the user's attempts, newest first, optionally only those at the content_id query parameter
+func (s *Server) ListAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "ListAttemptsHandler")
+	if !ok {
+		return
+	}
+
+	attempts, err := s.Store.ListAttempts(r.Context(), userID, r.URL.Query().Get("content_id"))
+	if err != nil {
+		s.Logger.Printf("ListAttemptsHandler: Error listing attempts: %v", err)
+		http.Error(w, "Error listing attempts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ListAttemptsResponse{Attempts: attempts}); err != nil {
+		s.Logger.Printf("ListAttemptsHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// GetAttemptHandler retrieves one of the user's attempts with its responses and score
+func (s *Server) GetAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "GetAttemptHandler")
+	if !ok {
+		return
+	}
+
+	attempt, ok := s.loadAttempt(w, r, "GetAttemptHandler", mux.Vars(r)["attemptID"], userID)
+	if !ok {
+		return
+	}
+	s.writeAttempt(w, "GetAttemptHandler", http.StatusOK, attempt)
+}
+
+// FinishAttemptHandler finishes one of the user's attempts and computes its score
+func (s *Server) FinishAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "FinishAttemptHandler")
+	if !ok {
+		return
+	}
+
+	attemptID := mux.Vars(r)["attemptID"]
+	if _, ok := s.loadAttempt(w, r, "FinishAttemptHandler", attemptID, userID); !ok {
+		return
+	}
+
+	now := time.Now()
+	attempt, err := s.Store.UpdateAttempt(r.Context(), attemptID, func(attempt *models.Attempt) error {
+		return finishAttempt(attempt, now)
+	})
+	if errors.Is(err, errAttemptFinished) {
+		http.Error(w, "Attempt is already finished", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		s.Logger.Printf("FinishAttemptHandler: Error finishing attempt: %v", err)
+		http.Error(w, "Error finishing attempt", http.StatusInternalServerError)
+		return
+	}
+
+	s.Logger.Printf("FinishAttemptHandler: Attempt %s scored %d%%", attemptID, attempt.Score)
+	s.writeAttempt(w, "FinishAttemptHandler", http.StatusOK, attempt)
+}
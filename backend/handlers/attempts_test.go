@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// decodeAttempt parses an attempt from a recorded response, failing the test on any other status code
+func decodeAttempt(t *testing.T, responseRecorder *httptest.ResponseRecorder, expectedStatusCode int) models.Attempt {
+	t.Helper()
+	resp := responseRecorder.Result()
+	if resp.StatusCode != expectedStatusCode {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, expectedStatusCode)
+	}
+	var attempt models.Attempt
+	if err := json.NewDecoder(resp.Body).Decode(&attempt); err != nil {
+		t.Fatalf("failed to parse attempt: %v", err)
+	}
+	return attempt
+}
+
+func TestAttemptLifecycle(t *testing.T) {
+	server := newTestServer(t)
+	contentURL := "https://example.com/attempts"
+	quiz := seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+
+	started := decodeAttempt(t, serveAs(t, server, testUserID, "POST", "/attempts",
+		[]byte(fmt.Sprintf(`{"content_id":%q,"quiz_id":"0001"}`, contentID))), http.StatusCreated)
+	if started.Status != models.AttemptStatusInProgress || started.TotalQuestions != 1 || started.Title != "Example Domain" {
+		t.Fatalf("unexpected started attempt %+v", started)
+	}
+
+	submit := func(userResponse string) int {
+		payload, _ := json.Marshal(ResponseSubmission{
+			ContentID:    contentID,
+			QuizID:       quiz.QuizID,
+			QuestionID:   quiz.Questions[0].QuestionID,
+			UserResponse: userResponse,
+			AttemptID:    started.AttemptID,
+		})
+		return serveAs(t, server, testUserID, "POST", "/submit-response", payload).Code
+	}
+	if status := submit("It is a domain for testing purposes."); status != http.StatusOK {
+		t.Fatalf("failing response: got %v want %v", status, http.StatusOK)
+	}
+	// Answering the question again replaces the earlier response
+	if status := submit("It is used for illustrative examples in documents."); status != http.StatusOK {
+		t.Fatalf("passing response: got %v want %v", status, http.StatusOK)
+	}
+
+	retrieved := decodeAttempt(t, serveAs(t, server, testUserID, "GET", "/attempts/"+started.AttemptID, nil), http.StatusOK)
+	if len(retrieved.Responses) != 1 || retrieved.Responses[0].Status != "PASS" {
+		t.Errorf("expected a single passing response, got %+v", retrieved.Responses)
+	}
+	if status := serveAs(t, server, "other-user", "GET", "/attempts/"+started.AttemptID, nil).Code; status != http.StatusForbidden {
+		t.Errorf("read by other user: got %v want %v", status, http.StatusForbidden)
+	}
+	if status := serveAs(t, server, "other-user", "POST", "/attempts/"+started.AttemptID+"/finish", nil).Code; status != http.StatusForbidden {
+		t.Errorf("finish by other user: got %v want %v", status, http.StatusForbidden)
+	}
+
+	finished := decodeAttempt(t, serveAs(t, server, testUserID, "POST", "/attempts/"+started.AttemptID+"/finish", nil), http.StatusOK)
+	if finished.Status != models.AttemptStatusFinished || finished.Score != 100 || finished.CorrectCount != 1 || finished.FinishedAt == nil {
+		t.Errorf("unexpected finished attempt %+v", finished)
+	}
+	if status := serveAs(t, server, testUserID, "POST", "/attempts/"+started.AttemptID+"/finish", nil).Code; status != http.StatusConflict {
+		t.Errorf("finishing twice: got %v want %v", status, http.StatusConflict)
+	}
+	if status := submit("Another answer"); status != http.StatusConflict {
+		t.Errorf("response after finish: got %v want %v", status, http.StatusConflict)
+	}
+
+	var listed ListAttemptsResponse
+	if err := json.NewDecoder(serveAs(t, server, testUserID, "GET", "/attempts?content_id="+contentID, nil).Body).Decode(&listed); err != nil {
+		t.Fatalf("failed to parse attempts: %v", err)
+	}
+	if len(listed.Attempts) != 1 || listed.Attempts[0].Score != 100 {
+		t.Errorf("unexpected attempts %+v", listed.Attempts)
+	}
+	listed = ListAttemptsResponse{}
+	if err := json.NewDecoder(serveAs(t, server, "other-user", "GET", "/attempts", nil).Body).Decode(&listed); err != nil {
+		t.Fatalf("failed to parse attempts: %v", err)
+	}
+	if len(listed.Attempts) != 0 {
+		t.Errorf("expected no attempts for another user, got %+v", listed.Attempts)
+	}
+}
+
+func TestStartAttemptHandler_Errors(t *testing.T) {
+	server := newTestServer(t)
+	contentURL := "https://example.com/attempts"
+	seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+
+	testCases := []struct {
+		name               string
+		userID             string
+		quizID             string
+		expectedStatusCode int
+	}{
+		{"UnknownQuiz", testUserID, "9999", http.StatusNotFound},
+		{"OtherUser", "other-user", "0001", http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := []byte(fmt.Sprintf(`{"content_id":%q,"quiz_id":%q}`, contentID, tc.quizID))
+			if status := serveAs(t, server, tc.userID, "POST", "/attempts", body).Code; status != tc.expectedStatusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestFinishAttempt_CountsUnansweredQuestionsAsIncorrect(t *testing.T) {
+	attempt := models.Attempt{
+		Status:         models.AttemptStatusInProgress,
+		TotalQuestions: 3,
+		Responses:      []models.AttemptResponse{{QuestionID: "0001", Status: "PASS"}, {QuestionID: "0002", Status: "FAIL"}},
+	}
+	if err := finishAttempt(&attempt, time.Now()); err != nil {
+		t.Fatalf("finishAttempt returned error: %v", err)
+	}
+	if attempt.CorrectCount != 1 || attempt.Score != 33 {
+		t.Errorf("expected 1 correct and a score of 33, got %d and %d", attempt.CorrectCount, attempt.Score)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"read-robin/middleware"
+	"read-robin/models"
+	"read-robin/services"
+)
+
+// requireUser returns the ID of the user authenticated by middleware.AuthMiddleware,
+// responding 401 if there is none
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request, handler string) (string, bool) {
+	userID, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		s.Logger.Printf("%s: Request is not authenticated", handler)
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, true
+}
+
+// canAccess reports whether userID owns content or it has been shared with them
+func canAccess(content *models.Content, userID string) bool {
+	return content.OwnerID == userID || slices.Contains(content.SharedWith, userID)
+}
+
+// getContent fetches contentID, following the alias left by the ID migration if contentID is a legacy ID
+func (s *Server) getContent(ctx context.Context, contentID string) (*models.Content, error) {
+	content, err := s.Store.GetContent(ctx, contentID)
+	if !errors.Is(err, services.ErrNotFound) {
+		return content, err
+	}
+	currentID, aliasErr := s.Store.ResolveContentID(ctx, contentID)
+	if errors.Is(aliasErr, services.ErrNotFound) {
+		return nil, err
+	}
+	if aliasErr != nil {
+		return nil, aliasErr
+	}
+	return s.Store.GetContent(ctx, currentID)
+}
+
+// authorizeContent fetches contentID, which may be a legacy ID, and checks that userID may access it, or
+// only its owner if ownerOnly is set. It responds with 404, 403 or 500 and returns false if the content
+// cannot be used. Callers use the returned content's ContentID, which is always the current ID.
+func (s *Server) authorizeContent(w http.ResponseWriter, r *http.Request, handler, contentID, userID string, ownerOnly bool) (*models.Content, bool) {
+	content, err := s.getContent(r.Context(), contentID)
+	if errors.Is(err, services.ErrNotFound) {
+		s.Logger.Printf("%s: Content not found: %v", handler, err)
+		http.Error(w, "Content not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		s.Logger.Printf("%s: Error fetching content: %v", handler, err)
+		http.Error(w, "Error fetching content", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	allowed := content.OwnerID == userID
+	if !ownerOnly {
+		allowed = canAccess(content, userID)
+	}
+	if !allowed {
+		s.Logger.Printf("%s: User %s may not access content %s", handler, userID, contentID)
+		http.Error(w, "Access to content denied", http.StatusForbidden)
+		return nil, false
+	}
+	return content, true
+}
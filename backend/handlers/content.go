@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// ShareContentRequest is a struct to hold the users a content owner shares their content with
+type ShareContentRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// ShareContentHandler replaces the users the content is shared with. Only the owner may share content.
+func (s *Server) ShareContentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "ShareContentHandler")
+	if !ok {
+		return
+	}
+
+	var request ShareContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.Logger.Printf("ShareContentHandler: Unable to parse request: %v", err)
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+
+	content, ok := s.authorizeContent(w, r, "ShareContentHandler", mux.Vars(r)["contentID"], userID, true)
+	if !ok {
+		return
+	}
+	contentID := content.ContentID
+
+	if err := s.Store.SetSharedWith(r.Context(), contentID, request.UserIDs); err != nil {
+		s.Logger.Printf("ShareContentHandler: Error updating sharing: %v", err)
+		http.Error(w, "Error updating sharing", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteContentHandler permanently deletes content with all of its quizzes and every user's attempts and
+// review cards at it, recording the deletion in the audit log. Only the owner may delete content.
+func (s *Server) DeleteContentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "DeleteContentHandler")
+	if !ok {
+		return
+	}
+
+	content, ok := s.authorizeContent(w, r, "DeleteContentHandler", mux.Vars(r)["contentID"], userID, true)
+	if !ok {
+		return
+	}
+	contentID := content.ContentID
+
+	report, err := s.Store.DeleteContent(r.Context(), contentID)
+	if err != nil {
+		s.Logger.Printf("DeleteContentHandler: Error deleting content: %v", err)
+		http.Error(w, "Error deleting content", http.StatusInternalServerError)
+		return
+	}
+	s.Logger.Printf("DeleteContentHandler: Deleted content %s", contentID)
+	s.deleteContentUpload(r.Context(), "DeleteContentHandler", content)
+	s.recordDeletion(r.Context(), "DeleteContentHandler", models.AuditActionDeleteContent, userID, contentID, "", report)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteQuizHandler permanently deletes one quiz of content with every user's attempts and review cards at
+// it, recording the deletion in the audit log. Only the owner may delete quizzes.
+func (s *Server) DeleteQuizHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "DeleteQuizHandler")
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	content, ok := s.authorizeContent(w, r, "DeleteQuizHandler", vars["contentID"], userID, true)
+	if !ok {
+		return
+	}
+	contentID := content.ContentID
+	quizID := vars["quizID"]
+
+	report, err := s.Store.DeleteQuiz(r.Context(), contentID, quizID)
+	if errors.Is(err, services.ErrNotFound) {
+		s.Logger.Printf("DeleteQuizHandler: Quiz not found: %v", err)
+		http.Error(w, "Quiz not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.Logger.Printf("DeleteQuizHandler: Error deleting quiz: %v", err)
+		http.Error(w, "Error deleting quiz", http.StatusInternalServerError)
+		return
+	}
+	s.Logger.Printf("DeleteQuizHandler: Deleted quiz %s of content %s", quizID, contentID)
+	s.recordDeletion(r.Context(), "DeleteQuizHandler", models.AuditActionDeleteQuiz, userID, contentID, quizID, report)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordDeletion saves the audit record of a deletion. The data is already gone when it is recorded, so a
+// failure is logged, with the record, rather than failing the request.
+func (s *Server) recordDeletion(ctx context.Context, handler, action, userID, contentID, quizID string, report services.DeletionReport) {
+	record := models.AuditRecord{
+		AuditID:     utils.GenerateAuditID(),
+		Action:      action,
+		UserID:      userID,
+		ContentID:   contentID,
+		QuizID:      quizID,
+		Quizzes:     report.Quizzes,
+		Attempts:    report.Attempts,
+		ReviewCards: report.ReviewCards,
+		Jobs:        report.Jobs,
+		Extractions: report.Extractions,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.Store.SaveAuditRecord(ctx, record); err != nil {
+		s.Logger.Printf("%s: Error saving audit record %+v: %v", handler, record, err)
+	}
+}
+
+// maxTitleLength is the longest title, in characters, content may be renamed to
+const maxTitleLength = 200
+
+// UpdateContentRequest is a struct to hold the new title of content
+type UpdateContentRequest struct {
+	Title string `json:"title"`
+}
+
+// UpdateContentHandler renames content. Only the owner may rename content.
+func (s *Server) UpdateContentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "UpdateContentHandler")
+	if !ok {
+		return
+	}
+
+	var request UpdateContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.Logger.Printf("UpdateContentHandler: Unable to parse request: %v", err)
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(request.Title)
+	if title == "" || utf8.RuneCountInString(title) > maxTitleLength {
+		http.Error(w, "title must be from 1 to "+strconv.Itoa(maxTitleLength)+" characters", http.StatusBadRequest)
+		return
+	}
+
+	content, ok := s.authorizeContent(w, r, "UpdateContentHandler", mux.Vars(r)["contentID"], userID, true)
+	if !ok {
+		return
+	}
+
+	if err := s.Store.SetTitle(r.Context(), content.ContentID, title); err != nil {
+		s.Logger.Printf("UpdateContentHandler: Error updating title: %v", err)
+		http.Error(w, "Error updating title", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// QuizSummary describes one quiz of content without its questions
+type QuizSummary struct {
+	QuizID        string    `json:"quiz_id"`
+	Timestamp     time.Time `json:"timestamp"`
+	OwnerID       string    `json:"owner_id"` // User who generated the quiz
+	QuestionCount int       `json:"question_count"`
+}
+
+// ContentResponse is a struct to hold content and summaries of its quizzes
+type ContentResponse struct {
+	ContentID   string           `json:"content_id"`
+	URL         string           `json:"url"`
+	Title       string           `json:"title"`
+	ContentText string           `json:"content_text"`
+	Timestamp   time.Time        `json:"timestamp"`
+	OwnerID     string           `json:"owner_id"`
+	SharedWith  []string         `json:"shared_with,omitempty"` // Only shown to the owner
+	Segments    []models.Segment `json:"segments,omitempty"`    // Timed transcript of audio and video
+	Published   string           `json:"published,omitempty"`   // When the source was published, if it says
+	Duration    float64          `json:"duration,omitempty"`    // Seconds of audio and video
+	Quizzes     []QuizSummary    `json:"quizzes"`
+}
+
+// GetContentHandler returns content the user may read with summaries of its quizzes
+func (s *Server) GetContentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "GetContentHandler")
+	if !ok {
+		return
+	}
+
+	content, ok := s.authorizeContent(w, r, "GetContentHandler", mux.Vars(r)["contentID"], userID, false)
+	if !ok {
+		return
+	}
+
+	response := ContentResponse{
+		ContentID:   content.ContentID,
+		URL:         content.URL,
+		Title:       content.Title,
+		ContentText: content.ContentText,
+		Timestamp:   content.Timestamp,
+		OwnerID:     content.OwnerID,
+		Segments:    content.Segments,
+		Published:   content.Published,
+		Duration:    content.Duration,
+		Quizzes:     make([]QuizSummary, 0, len(content.Quizzes)),
+	}
+	if content.OwnerID == userID {
+		response.SharedWith = content.SharedWith
+	}
+	for _, quiz := range content.Quizzes {
+		response.Quizzes = append(response.Quizzes, QuizSummary{
+			QuizID:        quiz.QuizID,
+			Timestamp:     quiz.Timestamp,
+			OwnerID:       quiz.OwnerID,
+			QuestionCount: len(quiz.Questions),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("GetContentHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// Sizes of the pages returned by ListContentHandler
+const (
+	defaultContentLimit = 20
+	maxContentLimit     = 100
+)
+
+// ContentSummary describes content in a list, with the requesting user's attempts at it
+type ContentSummary struct {
+	ContentID string    `json:"content_id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Timestamp time.Time `json:"timestamp"`
+	OwnerID   string    `json:"owner_id"`
+	Published string    `json:"published,omitempty"`  // When the source was published, if it says
+	Duration  float64   `json:"duration,omitempty"`   // Seconds of audio and video
+	Shared    bool      `json:"shared"`               // Whether another user shared the content with the requesting user
+	Attempts  int       `json:"attempts"`             // The requesting user's attempts at the content
+	LastScore *int      `json:"last_score,omitempty"` // Score of their most recent finished attempt
+}
+
+// ContentListResponse is a struct to hold a page of content
+type ContentListResponse struct {
+	Items      []ContentSummary `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Cursor of the next page, if there is one
+}
+
+// intParam parses the query parameter name as an integer from low to high, returning def if it is absent.
+// It responds 400 and returns false if the value is invalid.
+func intParam(w http.ResponseWriter, r *http.Request, name string, def, low, high int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < low || parsed > high {
+		http.Error(w, name+" must be from "+strconv.Itoa(low)+" to "+strconv.Itoa(high), http.StatusBadRequest)
+		return 0, false
+	}
+	return parsed, true
+}
+
+// ListContentHandler returns a page of the content the user owns or that is shared with them. The q query
+// parameter keeps only content whose title or URL contains it, ignoring case. Content is sorted by sort,
+// created (the default) or title, in order asc or desc, which defaults to newest first and A to Z. Pages
+// are of limit items, following the page whose next_cursor is passed as cursor.
+func (s *Server) ListContentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "ListContentHandler")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = services.ContentSortCreated
+	}
+	if sortBy != services.ContentSortCreated && sortBy != services.ContentSortTitle {
+		http.Error(w, "sort must be created or title", http.StatusBadRequest)
+		return
+	}
+	order := query.Get("order")
+	if order == "" {
+		order = "desc"
+		if sortBy == services.ContentSortTitle {
+			order = "asc"
+		}
+	}
+	if order != "asc" && order != "desc" {
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	limit, ok := intParam(w, r, "limit", defaultContentLimit, 1, maxContentLimit)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	page, err := s.Store.ListContents(ctx, services.ContentQuery{
+		UserID:     userID,
+		Search:     strings.TrimSpace(query.Get("q")),
+		SortBy:     sortBy,
+		Descending: order == "desc",
+		Limit:      limit,
+		Cursor:     query.Get("cursor"),
+	})
+	if errors.Is(err, services.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.Logger.Printf("ListContentHandler: Error listing content: %v", err)
+		http.Error(w, "Error listing content", http.StatusInternalServerError)
+		return
+	}
+	attempts, err := s.Store.ListAttempts(ctx, userID, "")
+	if err != nil {
+		s.Logger.Printf("ListContentHandler: Error listing attempts: %v", err)
+		http.Error(w, "Error listing attempts", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]ContentSummary, 0, len(page.Contents))
+	for _, content := range page.Contents {
+		items = append(items, ContentSummary{
+			ContentID: content.ContentID,
+			URL:       content.URL,
+			Title:     content.Title,
+			Timestamp: content.Timestamp,
+			OwnerID:   content.OwnerID,
+			Published: content.Published,
+			Duration:  content.Duration,
+			Shared:    content.OwnerID != userID,
+		})
+	}
+
+	// Attempts are listed newest first, so the first finished attempt at content has its last score
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		index[item.ContentID] = i
+	}
+	for _, attempt := range attempts {
+		i, ok := index[attempt.ContentID]
+		if !ok {
+			continue
+		}
+		items[i].Attempts++
+		if items[i].LastScore == nil && attempt.Status == models.AttemptStatusFinished {
+			score := attempt.Score
+			items[i].LastScore = &score
+		}
+	}
+
+	response := ContentListResponse{Items: items, NextCursor: page.NextCursor}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("ListContentHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/utils"
+)
+
+func TestContentAccess(t *testing.T) {
+	server := newTestServer(t)
+	url := "https://example.com"
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	quizPath := "/quiz/" + contentID + "/0001"
+
+	if status := serveAs(t, server, "", "GET", quizPath, nil).Code; status != http.StatusUnauthorized {
+		t.Errorf("unauthenticated read: got %v want %v", status, http.StatusUnauthorized)
+	}
+	if status := serveAs(t, server, "other-user", "GET", quizPath, nil).Code; status != http.StatusForbidden {
+		t.Errorf("read by other user: got %v want %v", status, http.StatusForbidden)
+	}
+	if status := serveAs(t, server, "other-user", "PUT", "/content/"+contentID+"/shared-with", []byte(`{"user_ids":["other-user"]}`)).Code; status != http.StatusForbidden {
+		t.Errorf("share by other user: got %v want %v", status, http.StatusForbidden)
+	}
+
+	if status := serveAs(t, server, testUserID, "PUT", "/content/"+contentID+"/shared-with", []byte(`{"user_ids":["other-user"]}`)).Code; status != http.StatusNoContent {
+		t.Fatalf("share by owner: got %v want %v", status, http.StatusNoContent)
+	}
+	if status := serveAs(t, server, "other-user", "GET", quizPath, nil).Code; status != http.StatusOK {
+		t.Errorf("read by shared user: got %v want %v", status, http.StatusOK)
+	}
+	if status := serveAs(t, server, "other-user", "DELETE", "/content/"+contentID, nil).Code; status != http.StatusForbidden {
+		t.Errorf("delete by shared user: got %v want %v", status, http.StatusForbidden)
+	}
+
+	if status := serveAs(t, server, testUserID, "DELETE", "/content/"+contentID, nil).Code; status != http.StatusNoContent {
+		t.Fatalf("delete by owner: got %v want %v", status, http.StatusNoContent)
+	}
+	if _, err := server.Store.GetContent(context.Background(), contentID); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("content still exists after delete: %v", err)
+	}
+	if status := serveAs(t, server, testUserID, "GET", quizPath, nil).Code; status != http.StatusNotFound {
+		t.Errorf("read after delete: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestGetJobHandler_OtherUser(t *testing.T) {
+	server := newTestServer(t)
+
+	job, err := server.Jobs.Submit(context.Background(), SubmitRequest{URL: "Some text", ContentType: "Text", ContentText: "Some text", OwnerID: testUserID})
+	if err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	if status := serveAs(t, server, "other-user", "GET", "/jobs/"+job.JobID, nil).Code; status != http.StatusForbidden {
+		t.Errorf("job read by other user: got %v want %v", status, http.StatusForbidden)
+	}
+}
+
+func TestListContentHandler(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	seedQuiz(t, server, "https://example.com/banana", "Banana bread", "Text", "0001")
+	seedQuiz(t, server, "https://example.com/apple", "Apple pie", "Text", "0001")
+	seedQuiz(t, server, "https://example.com/cherry", "cherry tart", "Text", "0001")
+	if _, err := server.Store.SaveQuiz(ctx, models.Content{OwnerID: "other-user", URL: "https://example.org/shared", Title: "Shared scones", ContentText: "Text"}, models.Quiz{OwnerID: "other-user"}); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+	if _, err := server.Store.SaveQuiz(ctx, models.Content{OwnerID: "other-user", URL: "https://example.org/private", Title: "Private", ContentText: "Text"}, models.Quiz{OwnerID: "other-user"}); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+	sharedID := utils.GenerateContentID("other-user", "https://example.org/shared")
+	if err := server.Store.SetSharedWith(ctx, sharedID, []string{testUserID}); err != nil {
+		t.Fatalf("Failed to share content: %v", err)
+	}
+
+	// Two attempts at the apple pie, the newer one finished
+	appleID := utils.GenerateContentID(testUserID, "https://example.com/apple")
+	finishedAt := time.Now()
+	for _, attempt := range []models.Attempt{
+		{AttemptID: "older", UserID: testUserID, ContentID: appleID, QuizID: "0001", Status: models.AttemptStatusFinished, Score: 40, StartedAt: time.Now().Add(-time.Hour), FinishedAt: &finishedAt},
+		{AttemptID: "newer", UserID: testUserID, ContentID: appleID, QuizID: "0001", Status: models.AttemptStatusFinished, Score: 80, StartedAt: time.Now(), FinishedAt: &finishedAt},
+	} {
+		if err := server.Store.SaveAttempt(ctx, attempt); err != nil {
+			t.Fatalf("Failed to save attempt: %v", err)
+		}
+	}
+
+	list := func(query string) ContentListResponse {
+		t.Helper()
+		recorder := serveAs(t, server, testUserID, "GET", "/content"+query, nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET /content%s: got status %v want %v", query, recorder.Code, http.StatusOK)
+		}
+		var response ContentListResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse response body: %v", err)
+		}
+		return response
+	}
+	titles := func(response ContentListResponse) []string {
+		var titles []string
+		for _, item := range response.Items {
+			titles = append(titles, item.Title)
+		}
+		return titles
+	}
+
+	// Titles sort capitals first
+	response := list("?sort=title")
+	if want := []string{"Apple pie", "Banana bread", "Shared scones", "cherry tart"}; !reflect.DeepEqual(titles(response), want) {
+		t.Errorf("sorted by title: got %v want %v", titles(response), want)
+	}
+	if response.NextCursor != "" {
+		t.Errorf("sorted by title: got next cursor %q on the only page", response.NextCursor)
+	}
+	apple := response.Items[0]
+	if apple.Attempts != 2 || apple.LastScore == nil || *apple.LastScore != 80 || apple.Shared {
+		t.Errorf("apple pie: got %+v", apple)
+	}
+	if shared := response.Items[2]; !shared.Shared || shared.OwnerID != "other-user" || shared.LastScore != nil {
+		t.Errorf("shared scones: got %+v", shared)
+	}
+
+	response = list("?sort=title&order=desc&limit=3")
+	if want := []string{"cherry tart", "Shared scones", "Banana bread"}; !reflect.DeepEqual(titles(response), want) || response.NextCursor == "" {
+		t.Errorf("first page in reverse: got %v next cursor %q, want %v", titles(response), response.NextCursor, want)
+	}
+	response = list("?sort=title&order=desc&limit=3&cursor=" + response.NextCursor)
+	if want := []string{"Apple pie"}; !reflect.DeepEqual(titles(response), want) || response.NextCursor != "" {
+		t.Errorf("second page in reverse: got %v next cursor %q, want %v", titles(response), response.NextCursor, want)
+	}
+	if response = list("?q=EXAMPLE.ORG"); !reflect.DeepEqual(titles(response), []string{"Shared scones"}) {
+		t.Errorf("search by URL: got %v", titles(response))
+	}
+	if response = list("?q=bread"); !reflect.DeepEqual(titles(response), []string{"Banana bread"}) {
+		t.Errorf("search by title: got %v", titles(response))
+	}
+
+	for _, query := range []string{"?sort=size", "?order=up", "?limit=0", "?limit=101", "?cursor=x"} {
+		if status := serveAs(t, server, testUserID, "GET", "/content"+query, nil).Code; status != http.StatusBadRequest {
+			t.Errorf("GET /content%s: got status %v want %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetContentHandler(t *testing.T) {
+	server := newTestServer(t)
+	url := "https://example.com"
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0001")
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0002")
+	contentID := utils.GenerateContentID(testUserID, url)
+	if err := server.Store.SetSharedWith(context.Background(), contentID, []string{"other-user"}); err != nil {
+		t.Fatalf("Failed to share content: %v", err)
+	}
+
+	get := func(userID string) ContentResponse {
+		t.Helper()
+		recorder := serveAs(t, server, userID, "GET", "/content/"+contentID, nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET /content/%s as %s: got status %v want %v", contentID, userID, recorder.Code, http.StatusOK)
+		}
+		var response ContentResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse response body: %v", err)
+		}
+		return response
+	}
+
+	response := get(testUserID)
+	if response.ContentID != contentID || response.Title != "Example Domain" || response.ContentText != "Example content" {
+		t.Errorf("owner: unexpected content %+v", response)
+	}
+	if len(response.Quizzes) != 2 || response.Quizzes[1].QuizID != "0002" || response.Quizzes[1].QuestionCount != 1 {
+		t.Errorf("owner: unexpected quiz summaries %+v", response.Quizzes)
+	}
+	if !reflect.DeepEqual(response.SharedWith, []string{"other-user"}) {
+		t.Errorf("owner: got shared with %v", response.SharedWith)
+	}
+	if response = get("other-user"); response.SharedWith != nil || len(response.Quizzes) != 2 {
+		t.Errorf("shared user: expected the quizzes without the sharing list, got %+v", response)
+	}
+	if status := serveAs(t, server, "third-user", "GET", "/content/"+contentID, nil).Code; status != http.StatusForbidden {
+		t.Errorf("read by other user: got %v want %v", status, http.StatusForbidden)
+	}
+	if status := serveAs(t, server, testUserID, "GET", "/content/missing", nil).Code; status != http.StatusNotFound {
+		t.Errorf("missing content: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestUpdateContentHandler(t *testing.T) {
+	server := newTestServer(t)
+	url := "https://example.com"
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	path := "/content/" + contentID
+
+	if status := serveAs(t, server, "other-user", "PATCH", path, []byte(`{"title":"Mine now"}`)).Code; status != http.StatusForbidden {
+		t.Errorf("rename by other user: got %v want %v", status, http.StatusForbidden)
+	}
+	for _, body := range []string{`{"title":"  "}`, `{"title":"` + strings.Repeat("x", maxTitleLength+1) + `"}`, `not json`} {
+		if status := serveAs(t, server, testUserID, "PATCH", path, []byte(body)).Code; status != http.StatusBadRequest {
+			t.Errorf("rename with %.20s: got %v want %v", body, status, http.StatusBadRequest)
+		}
+	}
+
+	if status := serveAs(t, server, testUserID, "PATCH", path, []byte(`{"title":"  Renamed  "}`)).Code; status != http.StatusNoContent {
+		t.Fatalf("rename by owner: got %v want %v", status, http.StatusNoContent)
+	}
+	content, err := server.Store.GetContent(context.Background(), contentID)
+	if err != nil || content.Title != "Renamed" || len(content.Quizzes) != 1 {
+		t.Errorf("renamed content: got %+v (err %v)", content, err)
+	}
+}
+
+func TestDeleteQuizHandler(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	url := "https://example.com"
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0001")
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0002")
+	contentID := utils.GenerateContentID(testUserID, url)
+	if err := server.Store.SaveAttempt(ctx, models.Attempt{AttemptID: "attempt", UserID: testUserID, ContentID: contentID, QuizID: "0002", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("Failed to save attempt: %v", err)
+	}
+
+	if status := serveAs(t, server, "other-user", "DELETE", "/content/"+contentID+"/quizzes/0002", nil).Code; status != http.StatusForbidden {
+		t.Errorf("delete by other user: got %v want %v", status, http.StatusForbidden)
+	}
+	if status := serveAs(t, server, testUserID, "DELETE", "/content/"+contentID+"/quizzes/0002", nil).Code; status != http.StatusNoContent {
+		t.Fatalf("delete by owner: got %v want %v", status, http.StatusNoContent)
+	}
+	if status := serveAs(t, server, testUserID, "DELETE", "/content/"+contentID+"/quizzes/0002", nil).Code; status != http.StatusNotFound {
+		t.Errorf("delete again: got %v want %v", status, http.StatusNotFound)
+	}
+	if status := serveAs(t, server, testUserID, "GET", "/quiz/"+contentID+"/0001", nil).Code; status != http.StatusOK {
+		t.Errorf("read other quiz: got %v want %v", status, http.StatusOK)
+	}
+	if _, err := server.Store.GetAttempt(ctx, "attempt"); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("attempt at the deleted quiz still exists: %v", err)
+	}
+
+	records, err := server.Store.ListAuditRecords(ctx, testUserID)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one audit record, got %+v (err %v)", records, err)
+	}
+	if record := records[0]; record.Action != models.AuditActionDeleteQuiz || record.ContentID != contentID || record.QuizID != "0002" ||
+		record.Quizzes != 1 || record.Attempts != 1 {
+		t.Errorf("unexpected audit record %+v", record)
+	}
+}
+
+func TestDeleteContentHandler_DeletesAttemptsAndAudits(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	url := "https://example.com"
+	seedQuiz(t, server, url, "Example Domain", "Example content", "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	for _, userID := range []string{testUserID, "other-user"} {
+		if err := server.Store.SaveAttempt(ctx, models.Attempt{AttemptID: userID, UserID: userID, ContentID: contentID, QuizID: "0001", StartedAt: time.Now()}); err != nil {
+			t.Fatalf("Failed to save attempt: %v", err)
+		}
+	}
+
+	if status := serveAs(t, server, testUserID, "DELETE", "/content/"+contentID, nil).Code; status != http.StatusNoContent {
+		t.Fatalf("delete by owner: got %v want %v", status, http.StatusNoContent)
+	}
+	for _, attemptID := range []string{testUserID, "other-user"} {
+		if _, err := server.Store.GetAttempt(ctx, attemptID); !errors.Is(err, services.ErrNotFound) {
+			t.Errorf("attempt %s still exists after delete: %v", attemptID, err)
+		}
+	}
+
+	records, err := server.Store.ListAuditRecords(ctx, testUserID)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one audit record, got %+v (err %v)", records, err)
+	}
+	if record := records[0]; record.Action != models.AuditActionDeleteContent || record.ContentID != contentID ||
+		record.Quizzes != 1 || record.Attempts != 2 || record.AuditID == "" {
+		t.Errorf("unexpected audit record %+v", record)
+	}
+}
@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/services/jobs"
+	"read-robin/services/llm"
+	"read-robin/utils"
+)
+
+// extractFunc extracts the content of the file at source
+type extractFunc func(ctx context.Context, source string) (*models.Extraction, error)
+
+// extractWith adapts an llm.Provider extraction method, which returns the content and title in a map, to an extractFunc
+func extractWith(extract func(ctx context.Context, source string) (map[string]string, string, error)) extractFunc {
+	return func(ctx context.Context, source string) (*models.Extraction, error) {
+		contentMap, _, err := extract(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return &models.Extraction{Title: contentMap["title"], ContentText: contentMap["content"]}, nil
+	}
+}
+
+// extractPage fetches the page at url and extracts its content, reusing the cached extraction of source
+// when the page is unchanged. Extractions younger than Config.ExtractionCacheFresh are reused without fetching.
+// PDFs and documents are read locally, and other files served at url are passed to the model.
+func (s *Server) extractPage(ctx context.Context, url, source string, report jobs.ReportFunc) (*models.Extraction, error) {
+	cached := s.cachedExtraction(ctx, source)
+	if cached != nil && time.Since(cached.ExtractedAt) < s.Config.ExtractionCacheFresh {
+		s.Logger.Printf("Pipeline: Reusing fresh extraction of %s", source)
+		return cached, nil
+	}
+
+	var etag, lastModified string
+	if cached != nil {
+		etag, lastModified = cached.ETag, cached.LastModified
+	}
+	page, err := s.Fetcher.FetchPage(ctx, url, etag, lastModified)
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	contentType := fileContentType(page.ContentType)
+	if contentType != "" && !isLocalType(contentType) {
+		s.Logger.Printf("Pipeline: Extracting %s as %s, served as %s", url, contentType, page.ContentType)
+		report(models.JobStageExtracting)
+		return s.extractFileOfType(ctx, url, contentType)
+	}
+	if !page.NotModified && contentType == "" && !isWebPage(page.ContentType) {
+		return nil, &pipelineError{"Unsupported content type at URL", fmt.Errorf("%s is served as %s", url, page.ContentType)}
+	}
+	if page.NotModified {
+		s.Logger.Printf("Pipeline: Reusing extraction of %s, not modified", source)
+		cached.ExtractedAt = time.Now()
+		s.saveExtraction(ctx, *cached)
+		return cached, nil
+	}
+
+	version := utils.ContentHash(page.Body)
+	if cached != nil && cached.Version == version {
+		s.Logger.Printf("Pipeline: Reusing extraction of %s, content unchanged", source)
+		cached.ETag, cached.LastModified, cached.ExtractedAt = page.ETag, page.LastModified, time.Now()
+		s.saveExtraction(ctx, *cached)
+		return cached, nil
+	}
+
+	report(models.JobStageExtracting)
+	var extraction *models.Extraction
+	if isLocalType(contentType) {
+		s.Logger.Printf("Pipeline: Extracting %s as %s, served as %s", url, contentType, page.ContentType)
+		extraction, err = s.extractLocal(ctx, []byte(page.Body), contentType, path.Base(url))
+	} else {
+		extraction, err = s.extractHTML(ctx, url, page.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	extraction.Source = source
+	extraction.Version = version
+	extraction.ETag, extraction.LastModified = page.ETag, page.LastModified
+	extraction.ExtractedAt = time.Now()
+	s.saveExtraction(ctx, *extraction)
+	return extraction, nil
+}
+
+// extractHTML extracts the main article of the page at url locally, so scripts, navigation and ads never
+// reach the model. When Config.HTMLCleanup is set, the article is then passed to the model to tidy its text.
+func (s *Server) extractHTML(ctx context.Context, url, htmlText string) (*models.Extraction, error) {
+	article, err := utils.ExtractArticle(htmlText, url)
+	if err != nil {
+		return nil, &pipelineError{"No readable content found", err}
+	}
+	extraction := &models.Extraction{
+		Title:        article.Title,
+		ContentText:  article.Text,
+		Author:       article.Byline,
+		Published:    article.Published,
+		CanonicalURL: article.CanonicalURL,
+	}
+	if !s.Config.HTMLCleanup {
+		return extraction, nil
+	}
+
+	cleaned, _, err := s.LLM.ExtractContentFromHtml(ctx, article.CleanHTML())
+	if err != nil {
+		return nil, extractionError("Error extracting content", err)
+	}
+	extraction.Title, extraction.ContentText = cleaned["title"], cleaned["content"]
+	return extraction, nil
+}
+
+// extractPDF reads the text of a PDF locally, citing its pages. Only the pages without a usable text layer,
+// such as scans, are passed to the model; if that fails, the PDF is still quizzed on the text of its other
+// pages. name titles the PDF when it has no title of its own.
+func (s *Server) extractPDF(ctx context.Context, data []byte, name string) (*models.Extraction, error) {
+	doc, err := utils.ExtractPDF(data)
+	if err != nil {
+		return nil, &pipelineError{"Unable to read PDF", err}
+	}
+
+	if scanned := doc.ScannedPages(); len(scanned) > 0 {
+		s.Logger.Printf("Pipeline: Transcribing %d scanned pages of %s", len(scanned), name)
+		transcripts, _, err := s.LLM.TranscribePdfPages(ctx, data, scanned)
+		if err != nil {
+			if text, _ := doc.Content(); text == "" {
+				return nil, extractionError("Error extracting content from PDF", err)
+			}
+			s.Logger.Printf("Pipeline: Error transcribing scanned pages of %s, continuing without them: %v", name, err)
+		}
+		for i, page := range doc.Pages {
+			if text, ok := transcripts[page.Number]; ok && page.Scanned {
+				doc.Pages[i].Text = text
+			}
+		}
+	}
+
+	contentText, anchors := doc.Content()
+	if contentText == "" {
+		return nil, &pipelineError{"No readable content found", fmt.Errorf("%s has no text", name)}
+	}
+	title := doc.Title
+	if title == "" {
+		title, _, _ = strings.Cut(contentText, "\n")
+	}
+	if title == "" {
+		title = name
+	}
+	return &models.Extraction{Title: title, ContentText: contentText, Anchors: anchors}, nil
+}
+
+// extractLocal reads a PDF or document of contentType locally, titling it after name if it has no title of its own
+func (s *Server) extractLocal(ctx context.Context, data []byte, contentType, name string) (*models.Extraction, error) {
+	if contentType == "PDF" {
+		return s.extractPDF(ctx, data, name)
+	}
+	return s.extractDocument(data, contentType, name)
+}
+
+// extractDocument reads the text of an EPUB, DOCX, Markdown or PPTX file locally, citing the chapter, heading
+// or slide each part of it is in
+func (s *Server) extractDocument(data []byte, contentType, name string) (*models.Extraction, error) {
+	doc, err := utils.ExtractDocument(data, documentTypes[contentType])
+	if err != nil {
+		return nil, &pipelineError{"Unable to read " + contentType + " file", err}
+	}
+	contentText, anchors := doc.Content()
+	if contentText == "" {
+		return nil, &pipelineError{"No readable content found", fmt.Errorf("%s has no text", name)}
+	}
+	title := doc.Title
+	if title == "" {
+		title = mediaTitle(name)
+	}
+	return &models.Extraction{Title: title, ContentText: contentText, Anchors: anchors}, nil
+}
+
+// extractUpload extracts the file of a complete upload, reading PDFs and documents locally and passing audio
+// and video to the model at their blob's URI, or inline when the model cannot read the blob store
+func (s *Server) extractUpload(ctx context.Context, uploadID string) (*models.Extraction, error) {
+	if s.Blobs == nil {
+		return nil, &pipelineError{"File uploads are disabled", fmt.Errorf("upload %s without a blob store", uploadID)}
+	}
+	upload, err := s.Store.GetUpload(ctx, uploadID)
+	if err != nil {
+		return nil, &pipelineError{"Error retrieving upload", err}
+	}
+	contentType := fileContentType(upload.MediaType)
+	if isLocalType(contentType) {
+		data, err := s.readUpload(ctx, upload, s.maxPDFBytes(), "Uploaded file is too large")
+		if err != nil {
+			return nil, err
+		}
+		return s.extractLocal(ctx, data, contentType, upload.Filename)
+	}
+	if uri := s.Blobs.URI(upload.BlobKey); uri != "" {
+		return s.extractFileOfType(ctx, uri, contentType)
+	}
+
+	data, err := s.readUpload(ctx, upload, s.maxInlineMediaBytes(), "File too large for local storage; configure GCS blob storage")
+	if err != nil {
+		return nil, err
+	}
+	extraction, err := s.transcribeMedia(ctx, llm.Media{Name: upload.Filename, MIMEType: upload.MediaType, Data: data})
+	if err != nil {
+		return nil, extractionError("Error extracting content from "+contentType, err)
+	}
+	return extraction, nil
+}
+
+// readUpload reads the blob of upload, failing with tooLarge if it is larger than maxBytes
+func (s *Server) readUpload(ctx context.Context, upload *models.Upload, maxBytes int64, tooLarge string) ([]byte, error) {
+	if upload.Size > maxBytes {
+		return nil, &pipelineError{tooLarge, fmt.Errorf("upload %s of %d bytes exceeds %d bytes", upload.UploadID, upload.Size, maxBytes)}
+	}
+	blob, err := s.Blobs.Open(ctx, upload.BlobKey)
+	if err != nil {
+		return nil, &pipelineError{"Error reading upload", err}
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(io.LimitReader(blob, maxBytes+1))
+	if err != nil {
+		return nil, &pipelineError{"Error reading upload", err}
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, &pipelineError{tooLarge, fmt.Errorf("upload %s exceeds %d bytes", upload.UploadID, maxBytes)}
+	}
+	return data, nil
+}
+
+// extractFileOfType extracts the file at source with the extractor for contentType, one of PDF, Audio or Video.
+// Audio and video are transcribed with the time of each segment.
+func (s *Server) extractFileOfType(ctx context.Context, source, contentType string) (*models.Extraction, error) {
+	var extract extractFunc
+	switch contentType {
+	case "PDF":
+		extract = extractWith(s.LLM.ExtractContentFromPdf)
+	case "Audio", "Video":
+		extract = s.transcribe
+	default:
+		return nil, &pipelineError{"Unsupported content type", fmt.Errorf("content type %q", contentType)}
+	}
+	extraction, err := s.extractFile(ctx, source, extract)
+	if err != nil {
+		return nil, extractionError("Error extracting content from "+contentType, err)
+	}
+	return extraction, nil
+}
+
+// transcribe transcribes the audio or video at source
+func (s *Server) transcribe(ctx context.Context, source string) (*models.Extraction, error) {
+	return s.transcribeMedia(ctx, llm.Media{URI: source})
+}
+
+// transcribeMedia transcribes audio or video, writing its timed segments as the content text
+func (s *Server) transcribeMedia(ctx context.Context, media llm.Media) (*models.Extraction, error) {
+	transcript, _, err := s.LLM.TranscribeMedia(ctx, media)
+	if err != nil {
+		return nil, err
+	}
+	contentText, segments := utils.TranscriptContent(transcript.Segments)
+	if contentText == "" {
+		return nil, fmt.Errorf("transcript of %s is empty", cmp.Or(media.URI, media.Name))
+	}
+	return &models.Extraction{Title: transcript.Title, ContentText: contentText, Segments: segments, Duration: transcriptDuration(segments)}, nil
+}
+
+// transcriptDuration estimates the length of media from the end of its last transcript segment
+func transcriptDuration(segments []models.Segment) float64 {
+	duration := 0.0
+	for _, segment := range segments {
+		duration = max(duration, segment.End)
+	}
+	return duration
+}
+
+// extractYouTube extracts the YouTube video videoID from its captions, transcribing the video with the model
+// only when it has none. A video cannot be changed once published, so its cached extraction is always reused.
+func (s *Server) extractYouTube(ctx context.Context, videoID string, report jobs.ReportFunc) (*models.Extraction, error) {
+	source := utils.YouTubeWatchURL(videoID)
+	if cached := s.cachedExtraction(ctx, source); cached != nil {
+		s.Logger.Printf("Pipeline: Reusing extraction of %s", source)
+		return cached, nil
+	}
+
+	video, err := s.YouTube.FetchVideo(ctx, videoID)
+	if errors.Is(err, utils.ErrVideoUnavailable) {
+		return nil, &pipelineError{"YouTube video is unavailable", err}
+	}
+	if err != nil {
+		return nil, fetchError(err)
+	}
+
+	report(models.JobStageExtracting)
+	var extraction *models.Extraction
+	if len(video.Captions) > 0 {
+		contentText, segments := utils.TranscriptContent(video.Captions)
+		extraction = &models.Extraction{ContentText: contentText, Segments: segments, Duration: transcriptDuration(segments)}
+	} else {
+		s.Logger.Printf("Pipeline: Transcribing %s, which has no captions", source)
+		extraction, err = s.transcribe(ctx, source)
+		if err != nil {
+			return nil, extractionError("Error extracting content from YouTube", err)
+		}
+	}
+	if video.Title != "" {
+		extraction.Title = video.Title
+	}
+	if video.Duration > 0 {
+		extraction.Duration = video.Duration
+	}
+	extraction.Author = video.Channel
+	extraction.Published = video.Published
+	extraction.Source = source
+	extraction.Version = utils.ContentHash(extraction.ContentText)
+	extraction.ExtractedAt = time.Now()
+	s.saveExtraction(ctx, *extraction)
+	return extraction, nil
+}
+
+// extractCaptions reads the transcript of the audio or video requested from its captions instead of
+// transcribing it, titling it after the file
+func (s *Server) extractCaptions(ctx context.Context, request models.QuizRequest) (*models.Extraction, error) {
+	segments, err := utils.ParseCaptions(request.Captions)
+	if err != nil {
+		return nil, &pipelineError{"Invalid captions", err}
+	}
+	name := request.URL
+	if request.UploadID != "" {
+		upload, err := s.Store.GetUpload(ctx, request.UploadID)
+		if err != nil {
+			return nil, &pipelineError{"Error retrieving upload", err}
+		}
+		name = upload.Filename
+	}
+	contentText, segments := utils.TranscriptContent(segments)
+	return &models.Extraction{Title: mediaTitle(name), ContentText: contentText, Segments: segments, Duration: transcriptDuration(segments)}, nil
+}
+
+// mediaTitle titles media after the base name of its file or URL, without the extension
+func mediaTitle(name string) string {
+	if isHTTPURL(name) {
+		name, _, _ = strings.Cut(name, "?")
+	}
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// documentTypes maps the content types of documents, which are read locally like PDFs, to their media types
+var documentTypes = map[string]string{
+	"EPUB":     utils.MediaTypeEPUB,
+	"DOCX":     utils.MediaTypeDOCX,
+	"PPTX":     utils.MediaTypePPTX,
+	"Markdown": utils.MediaTypeMarkdown,
+}
+
+// isLocalType reports whether files of contentType are read locally rather than by the model
+func isLocalType(contentType string) bool {
+	return localMediaType(contentType) != ""
+}
+
+// localMediaType returns the media type of files of contentType read locally, or "" for other content types
+func localMediaType(contentType string) string {
+	if contentType == "PDF" {
+		return "application/pdf"
+	}
+	return documentTypes[contentType]
+}
+
+// fileContentType returns the submission content type that extracts files of mediaType, or "" for web pages
+// and unsupported types
+func fileContentType(mediaType string) string {
+	switch {
+	case mediaType == "application/pdf":
+		return "PDF"
+	case mediaType == utils.MediaTypeEPUB:
+		return "EPUB"
+	case mediaType == utils.MediaTypeDOCX:
+		return "DOCX"
+	case mediaType == utils.MediaTypePPTX:
+		return "PPTX"
+	case mediaType == utils.MediaTypeMarkdown:
+		return "Markdown"
+	case strings.HasPrefix(mediaType, "audio/"):
+		return "Audio"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "Video"
+	}
+	return ""
+}
+
+// isHTTPURL reports whether url is fetched over HTTP, rather than read from storage by the model
+func isHTTPURL(url string) bool {
+	lower := strings.ToLower(url)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// isWebPage reports whether mediaType is extracted as a web page
+func isWebPage(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml"
+}
+
+// fetchError describes a failure to fetch a URL, telling the client when the URL was refused rather than unreachable
+func fetchError(err error) *pipelineError {
+	switch {
+	case errors.Is(err, utils.ErrBlockedAddress):
+		return &pipelineError{"URL points to a private or internal address", err}
+	case errors.Is(err, utils.ErrTooLarge):
+		return &pipelineError{"Content at URL is too large", err}
+	case errors.Is(err, utils.ErrTooManyRedirects):
+		return &pipelineError{"URL redirects too many times", err}
+	case errors.Is(err, utils.ErrDisallowedByRobots):
+		return &pipelineError{"URL is disallowed by the site's robots.txt", err}
+	}
+	return &pipelineError{"Error fetching HTML content", err}
+}
+
+// extractFile extracts the content of the file at source with extract, reusing the cached extraction
+// while the file's version is unchanged. Files are cached by their exact URI, since object names are
+// case sensitive, and files whose version cannot be determined are not cached.
+func (s *Server) extractFile(ctx context.Context, source string, extract extractFunc) (*models.Extraction, error) {
+	version := ""
+	if s.Extractions != nil {
+		var err error
+		version, err = s.Sources.SourceVersion(ctx, source)
+		if err != nil {
+			s.Logger.Printf("Pipeline: Error checking version of %s: %v", source, err)
+		}
+	}
+
+	if version != "" {
+		if cached := s.cachedExtraction(ctx, source); cached != nil && cached.Version == version {
+			s.Logger.Printf("Pipeline: Reusing extraction of %s, version unchanged", source)
+			return cached, nil
+		}
+	}
+
+	extraction, err := extract(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	extraction.Source = source
+	extraction.Version = version
+	extraction.ExtractedAt = time.Now()
+	if version != "" {
+		s.saveExtraction(ctx, *extraction)
+	}
+	return extraction, nil
+}
+
+// cachedExtraction returns the cached extraction of source, or nil if there is none or caching is disabled.
+// Cache errors are logged rather than failing the pipeline.
+func (s *Server) cachedExtraction(ctx context.Context, source string) *models.Extraction {
+	if s.Extractions == nil {
+		return nil
+	}
+	extraction, err := s.Extractions.GetExtraction(ctx, source)
+	if err != nil {
+		if !errors.Is(err, services.ErrNotFound) {
+			s.Logger.Printf("Pipeline: Error reading cached extraction of %s: %v", source, err)
+		}
+		return nil
+	}
+	return extraction
+}
+
+// saveExtraction caches extraction if caching is enabled, logging failures
+func (s *Server) saveExtraction(ctx context.Context, extraction models.Extraction) {
+	if s.Extractions == nil {
+		return
+	}
+	if err := s.Extractions.SaveExtraction(ctx, extraction); err != nil {
+		s.Logger.Printf("Pipeline: Error caching extraction of %s: %v", extraction.Source, err)
+	}
+}
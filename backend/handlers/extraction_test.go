@@ -0,0 +1,774 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/services/llm"
+	"read-robin/utils"
+)
+
+// countingProvider counts the extraction calls that reach the model, keeping the last HTML sent and
+// the last PDF pages transcribed
+type countingProvider struct {
+	*llm.FakeProvider
+	extractions    atomic.Int32
+	lastHTML       atomic.Value
+	transcriptions atomic.Int32
+	lastPages      atomic.Value
+	media          atomic.Int32
+}
+
+func (p *countingProvider) ExtractContentFromHtml(ctx context.Context, htmlText string) (map[string]string, string, error) {
+	p.extractions.Add(1)
+	p.lastHTML.Store(htmlText)
+	return p.FakeProvider.ExtractContentFromHtml(ctx, htmlText)
+}
+
+func (p *countingProvider) ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error) {
+	p.extractions.Add(1)
+	return p.FakeProvider.ExtractContentFromPdf(ctx, pdfPath)
+}
+
+func (p *countingProvider) TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error) {
+	p.transcriptions.Add(1)
+	p.lastPages.Store(pages)
+	return p.FakeProvider.TranscribePdfPages(ctx, pdf, pages)
+}
+
+func (p *countingProvider) TranscribeMedia(ctx context.Context, media llm.Media) (*llm.Transcript, string, error) {
+	p.media.Add(1)
+	return p.FakeProvider.TranscribeMedia(ctx, media)
+}
+
+// staticVersioner reports the version set for each source
+type staticVersioner struct {
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+func (sv *staticVersioner) SourceVersion(ctx context.Context, source string) (string, error) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	return sv.versions[source], nil
+}
+
+func (sv *staticVersioner) set(source, version string) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.versions[source] = version
+}
+
+// newCachingTestServer creates a test server with an in-memory extraction cache and a countingProvider
+func newCachingTestServer(t *testing.T) (*Server, *countingProvider) {
+	t.Helper()
+	server := newTestServer(t)
+	provider := &countingProvider{FakeProvider: llm.NewFakeProvider()}
+	server.LLM = provider
+	server.Extractions = services.NewLRUExtractionCache(10)
+	return server, provider
+}
+
+// postSubmit posts payload as a JSON submit request as testUserID and returns the recorded response
+func postSubmit(t *testing.T, server *Server, payload SubmitRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+	return responseRecorder
+}
+
+// submitJob submits payload as testUserID and returns the ID of its job
+func submitJob(t *testing.T, server *Server, payload SubmitRequest) string {
+	t.Helper()
+	responseRecorder := postSubmit(t, server, payload)
+	if statusCode := responseRecorder.Code; statusCode != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", statusCode, http.StatusAccepted)
+	}
+
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	return submitResponse.JobID
+}
+
+// submitAndWait submits payload as testUserID and waits for its job to succeed
+func submitAndWait(t *testing.T, server *Server, payload SubmitRequest) models.Job {
+	t.Helper()
+	job := waitForJob(t, server, submitJob(t, server, payload))
+	if job.Status != models.JobStatusSucceeded {
+		t.Fatalf("job did not succeed: %+v", job)
+	}
+	return job
+}
+
+// savedContent retrieves the content job saved its quiz to, with the text, anchors and segments that job
+// results leave out
+func savedContent(t *testing.T, server *Server, job models.Job) *models.Content {
+	t.Helper()
+	content, err := server.Store.GetContent(context.Background(), job.Result.ContentID)
+	if err != nil {
+		t.Fatalf("GetContent: expected no error, got %v", err)
+	}
+	return content
+}
+
+func TestExtractionCache_URL(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	server.Config.HTMLCleanup = true
+
+	// Serve a page with an ETag that changes with its content
+	var mu sync.Mutex
+	etag, page := `"v1"`, "<html><head><title>Lobster Facts</title></head><body><p>Lobsters have ten legs. They live on the ocean floor. Some lobsters live for over a century.</p></body></html>"
+	var notModified atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	submitAndWait(t, server, SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if extractions := provider.extractions.Load(); extractions != 1 {
+		t.Fatalf("expected the first submission to be extracted, got %d extractions", extractions)
+	}
+
+	// An unchanged page is revalidated and its extraction reused
+	submitAndWait(t, server, SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if extractions := provider.extractions.Load(); extractions != 1 || notModified.Load() != 1 {
+		t.Errorf("expected the resubmission to reuse the extraction, got %d extractions and %d not modified responses", extractions, notModified.Load())
+	}
+
+	// A changed page is extracted again
+	mu.Lock()
+	etag, page = `"v2"`, "<html><head><title>Lobster Facts</title></head><body><p>Lobsters taste with their legs. They can regrow lost claws. Their blood is blue.</p></body></html>"
+	mu.Unlock()
+	submitAndWait(t, server, SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if extractions := provider.extractions.Load(); extractions != 2 {
+		t.Errorf("expected the changed page to be extracted, got %d extractions", extractions)
+	}
+	source, err := utils.NormalizeURL(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := server.Extractions.GetExtraction(context.Background(), source)
+	if err != nil {
+		t.Fatalf("expected the extraction to be cached, got %v", err)
+	}
+	if cached.ETag != `"v2"` {
+		t.Errorf("expected the cached ETag to be updated, got %q", cached.ETag)
+	}
+}
+
+func TestExtractionCache_File(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	server.Config.BlobBucket = "bucket"
+	const source = "gs://bucket/lobsters.pdf"
+	versioner := &staticVersioner{versions: map[string]string{source: "generation:1"}}
+	server.Sources = versioner
+
+	for i := 0; i < 2; i++ {
+		submitAndWait(t, server, SubmitRequest{URL: source, ContentType: "PDF"})
+	}
+	if extractions := provider.extractions.Load(); extractions != 1 {
+		t.Errorf("expected an unchanged file to be extracted once, got %d extractions", extractions)
+	}
+
+	versioner.set(source, "generation:2")
+	submitAndWait(t, server, SubmitRequest{URL: source, ContentType: "PDF"})
+	if extractions := provider.extractions.Load(); extractions != 2 {
+		t.Errorf("expected an overwritten file to be extracted again, got %d extractions", extractions)
+	}
+
+	// Files without a version are never cached
+	versioner.set(source, "")
+	submitAndWait(t, server, SubmitRequest{URL: source, ContentType: "PDF"})
+	if extractions := provider.extractions.Load(); extractions != 3 {
+		t.Errorf("expected an unversioned file to be extracted, got %d extractions", extractions)
+	}
+}
+
+// articlePage is a news page whose article is surrounded by scripts, navigation and ads
+const articlePage = `<html><head><title>Lobster prices fall | Maritime Daily</title>
+<meta name="author" content="Jane Doucet"><meta property="article:published_time" content="2024-05-14T09:30:00-03:00">
+<link rel="canonical" href="/business/lobster-prices-fall"><script>trackPageView("lobster")</script></head>
+<body><nav><a href="/">Home</a> <a href="/sports">Sports</a></nav><div class="ad-banner">Buy a boat today</div>
+<article><p>Shore prices for lobster dropped sharply this week as fishers reported their best spring landings in years.</p>
+<p>Buyers were paying about seven dollars a pound on Monday, down from more than nine at the opening of the season.</p></article>
+<footer>All rights reserved.</footer></body></html>`
+
+func TestSubmitHandler_ExtractsArticleLocally(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(articlePage))
+	}))
+	defer ts.Close()
+
+	job := submitAndWait(t, server, SubmitRequest{URL: ts.URL + "/business/lobster-prices-fall?ref=home", ContentType: "URL"})
+	if extractions := provider.extractions.Load(); extractions != 0 {
+		t.Errorf("expected the article to be extracted without the model, got %d model calls", extractions)
+	}
+	result := job.Result
+	if result.Title != "Lobster prices fall | Maritime Daily" || result.Author != "Jane Doucet" || result.Published != "2024-05-14T09:30:00-03:00" {
+		t.Errorf("job returned unexpected metadata: got %+v", result)
+	}
+	if result.CanonicalURL != ts.URL+"/business/lobster-prices-fall" {
+		t.Errorf("job returned unexpected canonical URL: got %q", result.CanonicalURL)
+	}
+	if result.ContentText != "" {
+		t.Errorf("expected the job result to leave out the content text, got %q", result.ContentText)
+	}
+	content := savedContent(t, server, job)
+	for _, boilerplate := range []string{"trackPageView", "Sports", "Buy a boat", "All rights reserved"} {
+		if strings.Contains(content.ContentText, boilerplate) {
+			t.Errorf("expected %q to be stripped from the content, got %q", boilerplate, content.ContentText)
+		}
+	}
+	if !strings.HasPrefix(content.ContentText, "Shore prices for lobster") {
+		t.Errorf("job saved unexpected content: got %q", content.ContentText)
+	}
+}
+
+func TestSubmitHandler_HTMLCleanup(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	server.Config.HTMLCleanup = true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(articlePage))
+	}))
+	defer ts.Close()
+
+	job := submitAndWait(t, server, SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if extractions := provider.extractions.Load(); extractions != 1 {
+		t.Fatalf("expected the article to be cleaned up by the model, got %d model calls", extractions)
+	}
+	sent := provider.lastHTML.Load().(string)
+	if strings.Contains(sent, "trackPageView") || strings.Contains(sent, "Buy a boat") || !strings.Contains(sent, "Shore prices for lobster") {
+		t.Errorf("expected only the article to be sent to the model, got %q", sent)
+	}
+	if job.Result.Author != "Jane Doucet" {
+		t.Errorf("expected the page metadata to be kept, got %+v", job.Result)
+	}
+}
+
+func TestSubmitHandler_RoutesURLByContentType(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	guide := readPDFFixture(t, "pages.pdf")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(guide)
+	}))
+	defer ts.Close()
+
+	job := submitAndWait(t, server, SubmitRequest{URL: ts.URL + "/lobster-guide", ContentType: "URL"})
+	if extractions, transcriptions := provider.extractions.Load(), provider.transcriptions.Load(); extractions != 0 || transcriptions != 0 {
+		t.Errorf("expected the PDF to be extracted without the model, got %d extractions and %d transcriptions", extractions, transcriptions)
+	}
+	content := savedContent(t, server, job)
+	if job.Result.Title != "A Field Guide to Lobsters" || !strings.HasPrefix(content.ContentText, "Lobster Biology") {
+		t.Errorf("expected the URL to be extracted as a PDF, got %+v", job.Result)
+	}
+	if len(content.Anchors) != 3 || content.Anchors[2].Label != "p. 3" {
+		t.Errorf("expected an anchor for each page, got %v", content.Anchors)
+	}
+	assertCitedPages(t, server, job.Result.ContentID, job.Result.QuizID)
+}
+
+func TestSubmitHandler_UploadPDF(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	useLocalBlobs(t, server)
+	options := `{"num_questions": 3}`
+	responseRecorder := uploadFile(t, server, "field-notes.pdf", readPDFFixture(t, "scanned.pdf"), map[string]string{"options": options})
+	if responseRecorder.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", responseRecorder.Code, http.StatusAccepted, responseRecorder.Body)
+	}
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	job := waitForJob(t, server, submitResponse.JobID)
+	if job.Status != models.JobStatusSucceeded {
+		t.Fatalf("job did not succeed: %+v", job)
+	}
+
+	// Only the image-only page is sent to the model
+	if pages := provider.lastPages.Load(); !reflect.DeepEqual(pages, []int{2}) {
+		t.Errorf("expected only the scanned page to be transcribed, got %v", pages)
+	}
+	// The file is queued as an upload, and extracted by the job
+	upload, err := server.Store.GetUpload(context.Background(), job.Request.UploadID)
+	if err != nil || upload.MediaType != "application/pdf" || upload.Filename != "field-notes.pdf" {
+		t.Fatalf("expected the PDF to be stored as an upload, got %+v (err %v)", upload, err)
+	}
+	if job.Request.URL != uploadScheme+upload.UploadID || job.Request.ContentText != "" || job.Request.Options.NumQuestions != 3 {
+		t.Errorf("expected the upload to be queued with its options, got %+v", job.Request)
+	}
+	result := job.Result
+	if result.Title != "Lobsters have ten legs and two claws." {
+		t.Errorf("expected the first line to title a PDF without a title, got %q", result.Title)
+	}
+	if result.ContentText != "" || result.Anchors != nil {
+		t.Errorf("expected the job result to leave out the text and anchors, got %+v", result)
+	}
+	content := savedContent(t, server, job)
+	if !strings.Contains(content.ContentText, "fake transcript of scanned page 2") || !strings.HasSuffix(content.ContentText, "eggs for a year.") {
+		t.Errorf("expected the transcript between the text pages, got %q", content.ContentText)
+	}
+	labels := make([]string, 0, len(content.Anchors))
+	for _, anchor := range content.Anchors {
+		labels = append(labels, anchor.Label)
+	}
+	if !reflect.DeepEqual(labels, []string{"p. 1", "p. 2", "p. 3"}) {
+		t.Errorf("expected an anchor for each page, got %v", content.Anchors)
+	}
+	assertCitedPages(t, server, result.ContentID, result.QuizID)
+}
+
+func TestSubmitHandler_UploadErrors(t *testing.T) {
+	server := newTestServer(t)
+	blobDir := useLocalBlobs(t, server)
+	guide := readPDFFixture(t, "pages.pdf")
+
+	// The file is read by the job, which fails on a file that is not a PDF
+	responseRecorder := uploadFile(t, server, "notes.pdf", []byte("<html><body>Not a PDF</body></html>"), nil)
+	if responseRecorder.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", responseRecorder.Code, http.StatusAccepted, responseRecorder.Body)
+	}
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if job := waitForJob(t, server, submitResponse.JobID); job.Status != models.JobStatusFailed || job.Error != "Unable to read PDF" {
+		t.Errorf("expected an unreadable PDF to fail its job, got %+v", job)
+	}
+
+	// Uploads of a request that is rejected are not kept
+	responseRecorder = uploadFile(t, server, "notes.pdf", guide, map[string]string{"options": `{"num_questions": 500}`})
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Errorf("expected invalid options to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	if entries, err := os.ReadDir(filepath.Join(blobDir, "uploads")); err != nil || len(entries) != 1 {
+		t.Errorf("expected only the unreadable PDF to be kept, got %v (err %v)", entries, err)
+	}
+
+	responseRecorder = uploadFile(t, server, "notes.pdf", guide, map[string]string{"content_type": "Audio"})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Only PDF files") {
+		t.Errorf("expected an upload of another type to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	server.Config.FetchMaxBytes = len(guide) - 1
+	responseRecorder = uploadFile(t, server, "notes.pdf", guide, nil)
+	if responseRecorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a PDF over the size limit to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	server.Blobs = nil
+	responseRecorder = uploadFile(t, server, "notes.pdf", guide, nil)
+	if responseRecorder.Code != http.StatusNotImplemented {
+		t.Errorf("expected a file to be rejected without a blob store, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+}
+
+func TestSubmitHandler_UploadDocument(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	useLocalBlobs(t, server)
+	responseRecorder := uploadFile(t, server, "lobsters.docx", zipDocumentFixture(t, "lobsters.docx"), map[string]string{"options": `{"num_questions": 10}`})
+	if responseRecorder.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", responseRecorder.Code, http.StatusAccepted, responseRecorder.Body)
+	}
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	job := waitForJob(t, server, submitResponse.JobID)
+	if job.Status != models.JobStatusSucceeded {
+		t.Fatalf("job did not succeed: %+v", job)
+	}
+
+	if job.Request.ContentType != "DOCX" || provider.extractions.Load() != 0 {
+		t.Errorf("expected the upload to be read locally as a DOCX by its extension, got %+v", job.Request)
+	}
+	if job.Result.Title != "A Field Guide to Lobsters" {
+		t.Errorf("expected the document's title, got %q", job.Result.Title)
+	}
+	assertCitedSections(t, server, job.Result, map[string]string{
+		"hard exoskeleton":   "Molting",
+		"right or left hand": "Claws",
+	})
+}
+
+func TestSubmitHandler_RoutesDocumentURL(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	deck := zipDocumentFixture(t, "lobsters.pptx")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(deck)
+	}))
+	defer ts.Close()
+
+	job := submitAndWait(t, server, SubmitRequest{URL: ts.URL + "/talks/lobsters.pptx", ContentType: "URL", Options: models.QuizOptions{NumQuestions: 10}})
+	if extractions, transcriptions := provider.extractions.Load(), provider.transcriptions.Load(); extractions != 0 || transcriptions != 0 {
+		t.Errorf("expected the slides to be extracted without the model, got %d extractions and %d transcriptions", extractions, transcriptions)
+	}
+	if job.Result.Title != "Lobster Biology Lecture" || strings.Contains(savedContent(t, server, job).ContentText, "Draft slide") {
+		t.Errorf("expected the visible slides of the deck, got %+v", job.Result)
+	}
+	assertCitedSections(t, server, job.Result, map[string]string{
+		"Welcome everyone":  "Slide 1",
+		"shed their shells": "Slide 3",
+		"molt every year":   "Slide 3",
+	})
+
+	failed := waitForJob(t, server, submitJob(t, server, SubmitRequest{URL: "gs://bucket/lobsters.epub", ContentType: "EPUB"}))
+	if failed.Status != models.JobStatusFailed || failed.Error != "Documents must be uploaded or linked by an http URL" {
+		t.Errorf("expected a document in storage to be refused, got %+v", failed)
+	}
+}
+
+func TestSubmitHandler_TranscribesMedia(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	server.Config.BlobBucket = "bucket"
+	job := submitAndWait(t, server, SubmitRequest{URL: "gs://bucket/talks/lobsters.mp3", ContentType: "Audio"})
+	if provider.media.Load() != 1 {
+		t.Errorf("expected the audio to be transcribed by the model, got %d transcriptions", provider.media.Load())
+	}
+
+	result := job.Result
+	if result.Title != "lobsters" {
+		t.Fatalf("expected the audio to be titled after its file, got %+v", result)
+	}
+	responseRecorder := serveAs(t, server, testUserID, "GET", "/content/"+result.ContentID, nil)
+	var content ContentResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&content); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(content.Segments) == 0 {
+		t.Fatalf("expected a timed transcript of the audio saved with the content, got %+v", content)
+	}
+	if !strings.HasPrefix(content.ContentText, "Speaker 1: ") {
+		t.Errorf("expected the transcript to name its speakers, got %q", content.ContentText)
+	}
+	assertTimedQuestions(t, server, result.ContentID, result.QuizID)
+}
+
+func TestSubmitHandler_ImportsCaptions(t *testing.T) {
+	server, provider := newCachingTestServer(t)
+	captions := "WEBVTT\n\n" +
+		"00:00:01.000 --> 00:00:06.000\n<v Ada>Lobsters grow by molting their hard exoskeleton.\n\n" +
+		"00:01:05.000 --> 00:01:09.500\n<v Ben>Shediac hosts a giant lobster statue.\n\n" +
+		"01:02:00.000 --> 01:02:04.000\n<v Ben>Some lobsters live for over a century.\n"
+
+	job := submitAndWait(t, server, SubmitRequest{URL: "https://example.com/episodes/lobster-talk.mp3?token=abc", ContentType: "Audio", Captions: captions})
+	if provider.media.Load() != 0 || provider.extractions.Load() != 0 {
+		t.Errorf("expected the captions to be used without calling the model, got %d transcriptions", provider.media.Load())
+	}
+	result := job.Result
+	if result.Title != "lobster-talk" {
+		t.Errorf("expected the transcript to be titled after the file, got %q", result.Title)
+	}
+	if segments := savedContent(t, server, job).Segments; len(segments) != 3 || segments[1].Speaker != "Ben" || segments[2].Start != 3720 {
+		t.Errorf("expected a segment per cue, got %+v", segments)
+	}
+	quiz := assertTimedQuestions(t, server, result.ContentID, result.QuizID)
+	if timeRange := quiz.Questions[1].TimeRange; timeRange.Start != 65 || timeRange.End != 69.5 || quiz.Questions[1].Citation != "1:05" {
+		t.Errorf("expected the second question to be timed by its cue, got %+v, %q", timeRange, quiz.Questions[1].Citation)
+	}
+	if quiz.Questions[2].Citation != "1:02:00" {
+		t.Errorf("expected questions an hour in to cite hours, got %q", quiz.Questions[2].Citation)
+	}
+}
+
+func TestSubmitHandler_CaptionErrors(t *testing.T) {
+	server := newTestServer(t)
+	captions := "1\n00:00:01,000 --> 00:00:04,000\nLobsters grow by molting.\n"
+
+	responseRecorder := postSubmit(t, server, SubmitRequest{URL: "https://example.com/lobsters.pdf", ContentType: "PDF", Captions: captions})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "only be submitted with audio or video") {
+		t.Errorf("expected captions for a PDF to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+	responseRecorder = postSubmit(t, server, SubmitRequest{URL: "https://example.com/lobsters.mp4", ContentType: "Video", Captions: "Lobsters grow by molting."})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Invalid captions") {
+		t.Errorf("expected unparseable captions to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+}
+
+// assertTimedQuestions checks that every question of the saved quiz has the time range its reference was
+// spoken in, cited by its start, and returns the quiz
+func assertTimedQuestions(t *testing.T, server *Server, contentID, quizID string) *models.Quiz {
+	t.Helper()
+	quiz, err := server.Store.GetQuiz(context.Background(), contentID, quizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	if len(quiz.Questions) == 0 {
+		t.Fatal("expected the quiz to have questions")
+	}
+	for _, question := range quiz.Questions {
+		if question.TimeRange == nil || question.TimeRange.End < question.TimeRange.Start {
+			t.Fatalf("expected question %q quoting %q to have a time range, got %+v", question.Question, question.Reference, question.TimeRange)
+		}
+		if question.Citation != utils.FormatTimestamp(question.TimeRange.Start) {
+			t.Errorf("expected question %q to cite its start time, got %q", question.Question, question.Citation)
+		}
+	}
+	return quiz
+}
+
+// readPDFFixture reads a PDF from the fixtures of the utils package
+func readPDFFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "utils", "testdata", "pdf", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// zipDocumentFixture zips the parts of a document kept unzipped in the fixtures of the utils package
+func zipDocumentFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	dir := filepath.Join("..", "utils", "testdata", "document", name)
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		t.Fatalf("zipping fixture %s: %v", name, err)
+	}
+	return buf.Bytes()
+}
+
+// uploadFile posts data as the file of a multipart submit request with the other fields set, as testUserID
+func uploadFile(t *testing.T, server *Server, filename string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for field, value := range fields {
+		if err := writer.WriteField(field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	postRequest, err := http.NewRequest("POST", "/submit", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", writer.FormDataContentType())
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+	return responseRecorder
+}
+
+// assertCitedPages checks that every question of the saved quiz cites the page its reference was quoted from
+func assertCitedPages(t *testing.T, server *Server, contentID, quizID string) {
+	t.Helper()
+	quiz, err := server.Store.GetQuiz(context.Background(), contentID, quizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	if len(quiz.Questions) == 0 {
+		t.Fatal("expected the quiz to have questions")
+	}
+	for _, question := range quiz.Questions {
+		if !strings.HasPrefix(question.Citation, "p. ") {
+			t.Errorf("expected question %q quoting %q to cite a page, got %q", question.Question, question.Reference, question.Citation)
+		}
+	}
+}
+
+// assertCitedSections checks that the saved quiz of result cites the section of the document each expected
+// reference is quoted from, by a part of the reference
+func assertCitedSections(t *testing.T, server *Server, result *models.QuizResult, expected map[string]string) {
+	t.Helper()
+	quiz, err := server.Store.GetQuiz(context.Background(), result.ContentID, result.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	for quoted, label := range expected {
+		found := false
+		for _, question := range quiz.Questions {
+			if !strings.Contains(question.Reference, quoted) {
+				continue
+			}
+			found = true
+			if question.Citation != label {
+				t.Errorf("expected question %q quoting %q to cite %s, got %q", question.Question, question.Reference, label, question.Citation)
+			}
+		}
+		if !found {
+			t.Errorf("expected a question quoting %q, got %+v", quoted, quiz.Questions)
+		}
+	}
+}
+
+func TestSubmitHandler_BlocksInternalURLs(t *testing.T) {
+	server := newTestServer(t)
+	server.Fetcher = utils.NewFetcher(utils.FetchPolicy{}, nil)
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("<html><body><p>Internal dashboard with secrets that must not leak.</p></body></html>"))
+	}))
+	defer ts.Close()
+
+	job := waitForJob(t, server, submitJob(t, server, SubmitRequest{URL: ts.URL, ContentType: "URL"}))
+	if job.Status != models.JobStatusFailed || job.Error != "URL points to a private or internal address" {
+		t.Errorf("job returned unexpected state: got %+v", job)
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected no request to reach the internal server, got %d", requests.Load())
+	}
+}
+
+// fixtureYouTube is a utils.YouTubeFetcher serving the videos in its map, counting the fetches
+type fixtureYouTube struct {
+	videos  map[string]utils.YouTubeVideo
+	fetches atomic.Int32
+}
+
+func (fy *fixtureYouTube) FetchVideo(ctx context.Context, videoID string) (*utils.YouTubeVideo, error) {
+	fy.fetches.Add(1)
+	video, ok := fy.videos[videoID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is private", utils.ErrVideoUnavailable, videoID)
+	}
+	return &video, nil
+}
+
+// newYouTubeTestServer creates a caching test server whose YouTube videos are served from fixtures: one
+// with captions, one without
+func newYouTubeTestServer(t *testing.T) (*Server, *countingProvider, *fixtureYouTube) {
+	t.Helper()
+	server, provider := newCachingTestServer(t)
+	youTube := &fixtureYouTube{videos: map[string]utils.YouTubeVideo{
+		"dQw4w9WgXcQ": {ID: "dQw4w9WgXcQ", Title: "Why Lobsters Molt", Channel: "Shediac Science", Published: "2024-05-14", Duration: 212,
+			Captions: []models.Segment{
+				{Start: 0, End: 4.5, Text: "Lobsters grow by molting their hard exoskeleton."},
+				{Start: 65, End: 69.5, Text: "Shediac hosts a giant lobster statue."},
+				{Start: 200, End: 204, Text: "Some lobsters live for over a century."},
+			}},
+		"uncaptioned": {ID: "uncaptioned", Title: "Lobster Boat Tour", Channel: "Shediac Science", Duration: 95},
+	}}
+	server.YouTube = youTube
+	return server, provider, youTube
+}
+
+func TestSubmitHandler_YouTubeCaptions(t *testing.T) {
+	server, provider, youTube := newYouTubeTestServer(t)
+	job := submitAndWait(t, server, SubmitRequest{URL: "https://youtu.be/dQw4w9WgXcQ?si=share", ContentType: "YouTube"})
+	if provider.media.Load() != 0 {
+		t.Errorf("expected the captions to be used without transcribing the video, got %d transcriptions", provider.media.Load())
+	}
+
+	result := job.Result
+	if result.URL != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("expected the content to be saved at the video's watch URL, got %q", result.URL)
+	}
+	if result.Title != "Why Lobsters Molt" || result.Author != "Shediac Science" || result.Published != "2024-05-14" || result.Duration != 212 {
+		t.Errorf("expected the video's metadata, got %+v", result)
+	}
+	if segments := savedContent(t, server, job).Segments; len(segments) != 3 {
+		t.Errorf("expected a segment per caption, got %+v", segments)
+	}
+	quiz := assertTimedQuestions(t, server, result.ContentID, result.QuizID)
+	if quiz.Questions[1].Citation != "1:05" {
+		t.Errorf("expected the second question to cite its caption, got %q", quiz.Questions[1].Citation)
+	}
+	content, err := server.Store.GetContent(context.Background(), result.ContentID)
+	if err != nil || content.Published != "2024-05-14" || content.Duration != 212 {
+		t.Errorf("expected the video's date and length saved with the content, got %+v, %v", content, err)
+	}
+
+	// Another link to the same video is the same content, and its extraction is reused
+	job = submitAndWait(t, server, SubmitRequest{URL: "https://www.youtube.com/shorts/dQw4w9WgXcQ", ContentType: "YouTube"})
+	if job.Result.ContentID != result.ContentID || job.Result.IsFirstQuiz {
+		t.Errorf("expected another link to the video to add to its content, got %+v", job.Result)
+	}
+	if youTube.fetches.Load() != 1 {
+		t.Errorf("expected the cached extraction to be reused, got %d fetches", youTube.fetches.Load())
+	}
+}
+
+func TestSubmitHandler_YouTubeWithoutCaptions(t *testing.T) {
+	server, provider, _ := newYouTubeTestServer(t)
+	job := submitAndWait(t, server, SubmitRequest{URL: "https://www.youtube.com/watch?v=uncaptioned", ContentType: "YouTube"})
+	if provider.media.Load() != 1 {
+		t.Errorf("expected a video without captions to be transcribed by the model, got %d transcriptions", provider.media.Load())
+	}
+	if result := job.Result; result.Title != "Lobster Boat Tour" || result.Duration != 95 || len(savedContent(t, server, job).Segments) == 0 {
+		t.Errorf("expected the transcript titled and timed as the video, got %+v", result)
+	}
+}
+
+func TestSubmitHandler_YouTubeErrors(t *testing.T) {
+	server, _, _ := newYouTubeTestServer(t)
+	responseRecorder := postSubmit(t, server, SubmitRequest{URL: "https://www.youtube.com/channel/UC123", ContentType: "YouTube"})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Not a YouTube video URL") {
+		t.Errorf("expected a URL that is not a video to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	job := waitForJob(t, server, submitJob(t, server, SubmitRequest{URL: "https://youtu.be/privateVid0", ContentType: "YouTube"}))
+	if job.Status != models.JobStatusFailed || job.Error != "YouTube video is unavailable" {
+		t.Errorf("expected an unavailable video to fail the job, got %+v", job)
+	}
+}
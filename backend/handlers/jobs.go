@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"read-robin/models"
+	"read-robin/services"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// JobResponse is the status of a quiz generation job returned by GetJobHandler, without the request it was
+// submitted with
+type JobResponse struct {
+	JobID     string             `json:"job_id"`
+	Status    string             `json:"status"`
+	Stage     string             `json:"stage"`
+	Progress  int                `json:"progress"`
+	Error     string             `json:"error,omitempty"`
+	Result    *models.QuizResult `json:"result,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// GetJobHandler reports the status, stage, progress and result of a quiz generation job
+func (s *Server) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "GetJobHandler")
+	if !ok {
+		return
+	}
+
+	jobID := mux.Vars(r)["jobID"]
+	if jobID == "" {
+		http.Error(w, "jobID is required", http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.Store.GetJob(r.Context(), jobID)
+	if errors.Is(err, services.ErrNotFound) {
+		s.Logger.Printf("GetJobHandler: Job not found: %v", err)
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.Logger.Printf("GetJobHandler: Error retrieving job: %v", err)
+		http.Error(w, "Error retrieving job", http.StatusInternalServerError)
+		return
+	}
+	if job.Request.OwnerID != userID {
+		s.Logger.Printf("GetJobHandler: User %s may not access job %s", userID, jobID)
+		http.Error(w, "Access to job denied", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := JobResponse{
+		JobID:     job.JobID,
+		Status:    job.Status,
+		Stage:     job.Stage,
+		Progress:  job.Progress,
+		Error:     job.Error,
+		Result:    job.Result,
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("GetJobHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"read-robin/models"
+)
+
+func TestGetJobHandler_NotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	getRequest, err := http.NewRequest("GET", "/jobs/does-not-exist", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(responseRecorder, asUser(getRequest, testUserID))
+
+	if statusCode := responseRecorder.Code; statusCode != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", statusCode, http.StatusNotFound)
+	}
+}
+
+func TestGetJobHandler_LeavesOutRequest(t *testing.T) {
+	server := newTestServer(t)
+	job := models.Job{JobID: "job-1", Status: models.JobStatusSucceeded, Stage: models.JobStageDone, Progress: 100,
+		Request:   models.QuizRequest{ContentType: "Text", ContentText: "Lobsters have ten legs.", OwnerID: testUserID},
+		Result:    &models.QuizResult{ContentID: "content", QuizID: "0001"},
+		ClaimedBy: "worker", CreatedAt: time.Now()}
+	if err := server.Store.SaveJob(context.Background(), job); err != nil {
+		t.Fatalf("SaveJob: expected no error, got %v", err)
+	}
+
+	getRequest, err := http.NewRequest("GET", "/jobs/job-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(responseRecorder, asUser(getRequest, testUserID))
+	if statusCode := responseRecorder.Code; statusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", statusCode, http.StatusOK)
+	}
+
+	var response map[string]json.RawMessage
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	for _, field := range []string{"request", "claimed_by", "attempts"} {
+		if _, ok := response[field]; ok {
+			t.Errorf("expected the response to leave out %s, got %s", field, response[field])
+		}
+	}
+	if string(response["status"]) != `"succeeded"` || response["result"] == nil {
+		t.Errorf("expected the status and result of the job, got %v", response)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"read-robin/config"
+	"read-robin/middleware"
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/services/llm"
+)
+
+// testUserID is the user the test helpers authenticate as
+const testUserID = "test-user"
+
+// asUser authenticates r as userID, both for requests routed through the auth middleware,
+// which trusts the bearer token in tests, and for handlers called directly
+func asUser(r *http.Request, userID string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+userID)
+	return r.WithContext(middleware.WithUserID(r.Context(), userID))
+}
+
+// serveAs routes a request authenticated as userID through the server's router and returns the recorded response
+func serveAs(t *testing.T, server *Server, userID, method, path string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	request, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != "" {
+		request.Header.Set("Authorization", "Bearer "+userID)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// newTestServer creates a Server backed by the in-memory store and the fake LLM provider
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := config.Config{StoreBackend: config.StoreMemory, LLMProvider: config.LLMFake, FetchAllowPrivate: true}
+	server := NewServer(cfg, services.NewMemoryStore(), llm.NewFakeProvider(), middleware.InsecureVerifier{}, nil)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+// waitForJob polls GET /jobs/{jobID} until the job succeeds or fails, returning the stored job
+func waitForJob(t *testing.T, server *Server, jobID string) models.Job {
+	t.Helper()
+	router := server.Routes()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		getRequest, err := http.NewRequest("GET", "/jobs/"+jobID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, asUser(getRequest, testUserID))
+		if statusCode := responseRecorder.Code; statusCode != http.StatusOK {
+			t.Fatalf("job handler returned wrong status code: got %v want %v", statusCode, http.StatusOK)
+		}
+
+		var response JobResponse
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse job response body: %v", err)
+		}
+		if response.Status == models.JobStatusSucceeded || response.Status == models.JobStatusFailed {
+			// The response leaves out the request, which tests check in the stored job
+			job, err := server.Store.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("GetJob: expected no error, got %v", err)
+			}
+			return *job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", jobID)
+	return models.Job{}
+}
+
+// seedQuiz saves a quiz with a single question to testUserID's content in the server's quiz store
+func seedQuiz(t *testing.T, server *Server, url, title, contentText, quizID string) models.Quiz {
+	t.Helper()
+	quiz := models.Quiz{
+		QuizID: quizID,
+		Questions: []models.Question{
+			{
+				QuestionID: "0001",
+				Question:   "What is the purpose of the 'Example Domain'?",
+				Answer:     "It is for use in illustrative examples in documents.",
+				Reference:  "This domain is for use in illustrative examples in documents.",
+			},
+		},
+		Timestamp: time.Now(),
+		OwnerID:   testUserID,
+	}
+	if _, err := server.Store.SaveQuiz(context.Background(), models.Content{OwnerID: testUserID, URL: url, Title: title, ContentText: contentText}, quiz); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+	return quiz
+}
+
+// invalidJSONProvider replies to quiz and review requests with text that is not JSON
+type invalidJSONProvider struct {
+	*llm.FakeProvider
+}
+
+func (p invalidJSONProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	return "I could not write a quiz for this content.", "", nil
+}
+
+func (p invalidJSONProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	return p.GenerateQuiz(ctx, content, persona, options)
+}
+
+func (p invalidJSONProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	return llm.DecodeReview(ctx, "Looks good to me!", "", nil)
+}
+
+// unavailableProvider fails every quiz and review request as an overloaded model would
+type unavailableProvider struct {
+	*llm.FakeProvider
+}
+
+func (p unavailableProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	return "", "", &llm.StatusError{StatusCode: http.StatusServiceUnavailable, Body: "overloaded"}
+}
+
+func (p unavailableProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	return p.GenerateQuiz(ctx, content, persona, options)
+}
+
+func (p unavailableProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	return "", "", fmt.Errorf("ReviewResponse: %w", llm.ErrCircuitOpen)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/services/jobs"
+	"read-robin/services/llm"
+	"read-robin/utils"
+)
+
+// supportedContentTypes lists the content types accepted by SubmitHandler
+var supportedContentTypes = map[string]bool{
+	"URL":   true,
+	"PDF":   true,
+	"Audio": true,
+	"Video": true,
+	"Text":  true,
+	// Videos read from their captions, and podcast episodes transcribed like audio
+	"YouTube": true,
+	"Podcast": true,
+	// Documents read locally, cited by chapter, heading or slide
+	"EPUB":     true,
+	"DOCX":     true,
+	"PPTX":     true,
+	"Markdown": true,
+}
+
+// pipelineError is a quiz pipeline failure with a message that is safe to show to the client
+type pipelineError struct {
+	message string
+	err     error
+}
+
+func (e *pipelineError) Error() string {
+	return fmt.Sprintf("%s: %v", e.message, e.err)
+}
+
+func (e *pipelineError) Unwrap() error {
+	return e.err
+}
+
+// UserMessage returns the client-facing description of the failure
+func (e *pipelineError) UserMessage() string {
+	return e.message
+}
+
+// invalidModelResponseMessage is the client-facing message for a model response that could not be parsed, even after repair
+const invalidModelResponseMessage = "Model returned an invalid response"
+
+// noMatchingQuestionsMessage is the client-facing message when the quiz options rejected every generated question
+const noMatchingQuestionsMessage = "No generated questions matched the quiz options"
+
+// isInvalidModelResponse reports whether err was caused by a model response that did not match its schema
+func isInvalidModelResponse(err error) bool {
+	var parseErr *llm.ParseError
+	return errors.As(err, &parseErr)
+}
+
+// modelUnavailableMessage is the client-facing message for transient model errors that outlasted the retries
+const modelUnavailableMessage = "Model is temporarily unavailable, try again later"
+
+// isModelUnavailable reports whether err is a transient model error or a rejection by the open circuit breaker
+func isModelUnavailable(err error) bool {
+	return errors.Is(err, llm.ErrCircuitOpen) || llm.IsRetryable(err)
+}
+
+// runQuizPipeline fetches and extracts the requested content, generates a quiz and saves it,
+// reporting each stage as it starts. The result is kept in the job's document, so it leaves out the
+// content text, anchors and segments, which are read from the saved content instead.
+func (s *Server) runQuizPipeline(ctx context.Context, request models.QuizRequest, report jobs.ReportFunc) (*models.QuizResult, error) {
+	result, err := s.streamQuizPipeline(ctx, request, report, nil)
+	if err != nil {
+		return nil, err
+	}
+	result.ContentText, result.Anchors, result.Segments = "", nil, nil
+	return result, nil
+}
+
+// streamQuizPipeline runs the quiz pipeline like runQuizPipeline, also calling onQuestion, if not nil,
+// with each question as soon as it is generated
+func (s *Server) streamQuizPipeline(ctx context.Context, request models.QuizRequest, report jobs.ReportFunc, onQuestion func(models.Question) error) (*models.QuizResult, error) {
+	var normalizedURL string
+	var contentID string
+
+	// A podcast episode is quizzed as the audio or video file the feed links it to
+	var podcast *utils.Podcast
+	var episode *utils.Episode
+	if request.ContentType == "Podcast" {
+		report(models.JobStageFetching)
+		var err error
+		podcast, episode, err = s.findEpisode(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		request.URL, request.ContentType = episode.MediaURL, episodeContentType(episode)
+	}
+
+	videoID, isVideo := utils.YouTubeVideoID(request.URL)
+	switch {
+	case request.ContentType == "Text" || isUpload(request.URL):
+		contentID = utils.GenerateContentID(request.OwnerID, request.URL)
+		normalizedURL = request.URL
+	case request.ContentType == "YouTube" && !isVideo:
+		return nil, &pipelineError{"Not a YouTube video URL", fmt.Errorf("url %q", request.URL)}
+	case request.ContentType == "YouTube":
+		// Normalizing would drop the video ID from the query
+		normalizedURL = utils.YouTubeWatchURL(videoID)
+		contentID = utils.GenerateContentID(request.OwnerID, normalizedURL)
+	default:
+		var err error
+		normalizedURL, contentID, err = normalizeAndGenerateID(request.OwnerID, request.URL)
+		if err != nil {
+			return nil, &pipelineError{"Error normalizing URL", err}
+		}
+	}
+
+	_, err := s.Store.GetExistingQuizzes(ctx, contentID)
+	isFirstQuiz := false
+	if err != nil {
+		if !errors.Is(err, services.ErrNotFound) {
+			return nil, &pipelineError{"Error fetching existing quizzes", err}
+		}
+		isFirstQuiz = true
+	}
+
+	var extraction *models.Extraction
+
+	switch {
+	case request.Captions != "":
+		report(models.JobStageExtracting)
+		extraction, err = s.extractCaptions(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+	case request.UploadID != "":
+		report(models.JobStageExtracting)
+		extraction, err = s.extractUpload(ctx, request.UploadID)
+		if err != nil {
+			return nil, err
+		}
+	case request.ContentType == "YouTube":
+		report(models.JobStageFetching)
+		extraction, err = s.extractYouTube(ctx, videoID, report)
+		if err != nil {
+			return nil, err
+		}
+	case request.ContentType == "URL", isLocalType(request.ContentType) && isHTTPURL(request.URL):
+		report(models.JobStageFetching)
+		extraction, err = s.extractPage(ctx, request.URL, normalizedURL, report)
+		if err != nil {
+			return nil, err
+		}
+	case request.ContentType == "PDF", request.ContentType == "Audio", request.ContentType == "Video":
+		if err := s.checkFileSource(request.ContentType, request.URL); err != nil {
+			return nil, err
+		}
+		report(models.JobStageExtracting)
+		extraction, err = s.extractFileOfType(ctx, request.URL, request.ContentType)
+		if err != nil {
+			return nil, err
+		}
+	case request.ContentType == "Text":
+		extraction = &models.Extraction{Title: request.URL, ContentText: request.ContentText}
+	case isLocalType(request.ContentType):
+		return nil, &pipelineError{"Documents must be uploaded or linked by an http URL", fmt.Errorf("%s at %q", request.ContentType, request.URL)}
+	default:
+		return nil, &pipelineError{"Unsupported content type", fmt.Errorf("content type %q", request.ContentType)}
+	}
+
+	if episode != nil {
+		extraction = withEpisode(extraction, podcast, episode)
+	}
+
+	title := extraction.Title
+	contentText := extraction.ContentText
+	quiz := models.Quiz{OwnerID: request.OwnerID}
+
+	report(models.JobStageGenerating)
+	generated := 0
+	_, err = llm.GenerateChunkedQuiz(ctx, s.LLM, contentText, request.Persona, request.Options, s.chunkPolicy(), func(qa map[string]interface{}) error {
+		question, err := utils.ParseQuestion(qa)
+		if err != nil {
+			return &pipelineError{"Error parsing quiz response", err}
+		}
+		generated++
+		if !utils.AcceptQuestion(&question, request.Options, len(quiz.Questions)) {
+			return nil
+		}
+		citeQuestion(&question, contentText, extraction.Anchors, extraction.Segments)
+		quiz.Questions = append(quiz.Questions, question)
+		if onQuestion != nil {
+			return onQuestion(question)
+		}
+		return nil
+	})
+	var parseErr *pipelineError
+	if errors.As(err, &parseErr) {
+		return nil, parseErr
+	}
+	if isInvalidModelResponse(err) {
+		return nil, &pipelineError{invalidModelResponseMessage, err}
+	}
+	if isModelUnavailable(err) {
+		return nil, &pipelineError{modelUnavailableMessage, err}
+	}
+	if err != nil {
+		return nil, &pipelineError{"Error generating quiz content", err}
+	}
+	if generated > 0 && len(quiz.Questions) == 0 {
+		return nil, &pipelineError{noMatchingQuestionsMessage, utils.ErrNoMatchingQuestions}
+	}
+
+	report(models.JobStageSaving)
+	// A job's worker cancels ctx when another worker has claimed the job, which then saves the quiz instead
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	source := models.Content{
+		OwnerID:     request.OwnerID,
+		URL:         normalizedURL,
+		Title:       title,
+		ContentText: contentText,
+		Anchors:     extraction.Anchors,
+		Segments:    extraction.Segments,
+		Published:   extraction.Published,
+		Duration:    extraction.Duration,
+	}
+	quiz.QuizID, err = s.Store.SaveQuiz(ctx, source, quiz)
+	if err != nil {
+		return nil, &pipelineError{"Error saving quiz", err}
+	}
+
+	return &models.QuizResult{
+		URL:          normalizedURL,
+		ContentID:    contentID,
+		QuizID:       quiz.QuizID,
+		Title:        title,
+		ContentText:  contentText,
+		IsFirstQuiz:  isFirstQuiz,
+		Author:       extraction.Author,
+		Published:    extraction.Published,
+		CanonicalURL: extraction.CanonicalURL,
+		Anchors:      extraction.Anchors,
+		Segments:     extraction.Segments,
+		Duration:     extraction.Duration,
+	}, nil
+}
+
+// citeQuestion sets where question's reference is in the source: the page it is on, or for transcripts the
+// time range it was spoken in, cited by its start time
+func citeQuestion(question *models.Question, contentText string, anchors []models.Anchor, segments []models.Segment) {
+	question.Citation = utils.Cite(contentText, anchors, question.Reference)
+	question.TimeRange = utils.LocateTimeRange(contentText, segments, question.Reference)
+	if question.TimeRange != nil {
+		question.Citation = utils.FormatTimestamp(question.TimeRange.Start)
+	}
+}
+
+// chunkPolicy returns the configured policy for splitting long content into chunks
+func (s *Server) chunkPolicy() llm.ChunkPolicy {
+	return llm.ChunkPolicy{
+		TokenBudget:  s.Config.ChunkTokens,
+		MaxChunks:    s.Config.MaxChunks,
+		MaxQuestions: s.Config.ChunkedQuizQuestions,
+		Concurrency:  s.Config.ChunkConcurrency,
+	}
+}
+
+// extractionError wraps an extraction failure, describing invalid responses and unavailable models as such
+func extractionError(message string, err error) *pipelineError {
+	if isInvalidModelResponse(err) {
+		return &pipelineError{invalidModelResponseMessage, err}
+	}
+	if isModelUnavailable(err) {
+		return &pipelineError{modelUnavailableMessage, err}
+	}
+	return &pipelineError{message, err}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// EpisodeSummary describes an episode of a podcast that can be quizzed
+type EpisodeSummary struct {
+	ID        string  `json:"id"` // Submitted as the episode of a Podcast request to quiz the episode
+	Title     string  `json:"title"`
+	Published string  `json:"published,omitempty"`
+	Duration  float64 `json:"duration,omitempty"` // Seconds
+	MediaURL  string  `json:"media_url"`
+	MediaType string  `json:"media_type,omitempty"`
+}
+
+// EpisodesResponse is a struct to hold a podcast feed and its episodes, newest first
+type EpisodesResponse struct {
+	URL      string           `json:"url"`
+	Title    string           `json:"title"`
+	Author   string           `json:"author,omitempty"`
+	Episodes []EpisodeSummary `json:"episodes"`
+}
+
+// ListEpisodesHandler returns the episodes of the podcast feed at the url query parameter, so the user can
+// choose one to submit
+func (s *Server) ListEpisodesHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.requireUser(w, r, "ListEpisodesHandler"); !ok {
+		return
+	}
+
+	feedURL := r.URL.Query().Get("url")
+	if feedURL == "" {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+	podcast, err := s.fetchPodcast(r.Context(), feedURL)
+	if err != nil {
+		s.Logger.Printf("ListEpisodesHandler: Error fetching feed: %v", err)
+		message, status := "Error fetching feed", http.StatusBadGateway
+		var feedErr *pipelineError
+		if errors.As(err, &feedErr) {
+			message = feedErr.UserMessage()
+		}
+		if errors.Is(err, utils.ErrInvalidFeed) || errors.Is(err, utils.ErrBlockedAddress) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, message, status)
+		return
+	}
+
+	response := EpisodesResponse{URL: feedURL, Title: podcast.Title, Author: podcast.Author, Episodes: []EpisodeSummary{}}
+	for _, episode := range podcast.Episodes {
+		response.Episodes = append(response.Episodes, EpisodeSummary{
+			ID:        episode.ID,
+			Title:     episode.Title,
+			Published: episode.Published,
+			Duration:  episode.Duration,
+			MediaURL:  episode.MediaURL,
+			MediaType: episode.MediaType,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("ListEpisodesHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// fetchPodcast fetches and parses the podcast feed at feedURL, returning a *pipelineError on failure
+func (s *Server) fetchPodcast(ctx context.Context, feedURL string) (*utils.Podcast, error) {
+	page, err := s.Fetcher.FetchPage(ctx, feedURL, "", "")
+	if err != nil {
+		return nil, fetchError(err)
+	}
+	podcast, err := utils.ParsePodcast([]byte(page.Body))
+	if err != nil {
+		return nil, &pipelineError{"URL is not a podcast feed", err}
+	}
+	return podcast, nil
+}
+
+// findEpisode fetches the podcast feed at request.URL and finds the episode request.Episode, or the newest
+// episode if none is requested
+func (s *Server) findEpisode(ctx context.Context, request models.QuizRequest) (*utils.Podcast, *utils.Episode, error) {
+	podcast, err := s.fetchPodcast(ctx, request.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	episode, ok := podcast.FindEpisode(request.Episode)
+	if !ok {
+		return nil, nil, &pipelineError{"Podcast episode not found", fmt.Errorf("episode %q of %s", request.Episode, request.URL)}
+	}
+	if !isHTTPURL(episode.MediaURL) {
+		return nil, nil, &pipelineError{"Podcast episode has no media URL", fmt.Errorf("episode %q is at %q", episode.ID, episode.MediaURL)}
+	}
+	return podcast, episode, nil
+}
+
+// episodeContentType returns the content type that extracts episode, which is audio unless the feed says it is video
+func episodeContentType(episode *utils.Episode) string {
+	if fileContentType(episode.MediaType) == "Video" {
+		return "Video"
+	}
+	return "Audio"
+}
+
+// withEpisode returns a copy of the extraction of episode's media with the title, date and length the feed
+// gives the episode, and the podcast as its author
+func withEpisode(extraction *models.Extraction, podcast *utils.Podcast, episode *utils.Episode) *models.Extraction {
+	titled := *extraction
+	if episode.Title != "" {
+		titled.Title = episode.Title
+	}
+	if episode.Duration > 0 {
+		titled.Duration = episode.Duration
+	}
+	titled.Author = podcast.Author
+	if titled.Author == "" {
+		titled.Author = podcast.Title
+	}
+	titled.Published = episode.Published
+	return &titled
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+// podcastFeed is an RSS feed whose enclosures are served by the test server at {{server}}
+const podcastFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+  <channel>
+    <title>Shediac Science</title>
+    <itunes:author>Ada Lovelace</itunes:author>
+    <item>
+      <title>Lobster Festival Recap</title>
+      <guid>episode-1</guid>
+      <pubDate>Mon, 01 Jul 2024 09:00:00 -0300</pubDate>
+      <enclosure url="{{server}}/media/episode-1.mp3?source=rss" type="audio/mpeg"/>
+      <itunes:duration>45:30</itunes:duration>
+    </item>
+    <item>
+      <title>Why Lobsters Molt</title>
+      <guid>episode-2</guid>
+      <pubDate>Mon, 08 Jul 2024 09:00:00 GMT</pubDate>
+      <enclosure url="{{server}}/media/episode-2.mp4" type="video/mp4"/>
+    </item>
+  </channel>
+</rss>`
+
+// newPodcastFeedServer serves podcastFeed at /feed.xml and a page that is not a feed at /page
+func newPodcastFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(strings.ReplaceAll(podcastFeed, "{{server}}", ts.URL)))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>Lobsters</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestListEpisodesHandler(t *testing.T) {
+	server := newTestServer(t)
+	ts := newPodcastFeedServer(t)
+
+	responseRecorder := serveAs(t, server, testUserID, "GET", "/podcasts/episodes?url="+url.QueryEscape(ts.URL+"/feed.xml"), nil)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", responseRecorder.Code, http.StatusOK, responseRecorder.Body)
+	}
+	var response EpisodesResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response.Title != "Shediac Science" || response.Author != "Ada Lovelace" || len(response.Episodes) != 2 {
+		t.Fatalf("expected the podcast with its two episodes, got %+v", response)
+	}
+	newest := response.Episodes[0]
+	if newest.ID != "episode-2" || newest.Title != "Why Lobsters Molt" || newest.Published != "2024-07-08T09:00:00Z" || newest.MediaType != "video/mp4" {
+		t.Errorf("expected the newest episode first, got %+v", newest)
+	}
+	if response.Episodes[1].Duration != 2730 {
+		t.Errorf("expected the episode's duration in seconds, got %v", response.Episodes[1].Duration)
+	}
+
+	testCases := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/podcasts/episodes", http.StatusBadRequest},
+		{"/podcasts/episodes?url=" + url.QueryEscape(ts.URL+"/page"), http.StatusBadRequest},
+		{"/podcasts/episodes?url=" + url.QueryEscape(ts.URL+"/missing.xml"), http.StatusBadGateway},
+	}
+	for _, tc := range testCases {
+		if responseRecorder := serveAs(t, server, testUserID, "GET", tc.path, nil); responseRecorder.Code != tc.expectedStatus {
+			t.Errorf("GET %s: expected status %v, got %v: %s", tc.path, tc.expectedStatus, responseRecorder.Code, responseRecorder.Body)
+		}
+	}
+}
+
+func TestSubmitHandler_PodcastEpisode(t *testing.T) {
+	server := newTestServer(t)
+	ts := newPodcastFeedServer(t)
+
+	job := submitAndWait(t, server, SubmitRequest{URL: ts.URL + "/feed.xml", ContentType: "Podcast", Episode: "episode-1"})
+	result := job.Result
+	if result.Title != "Lobster Festival Recap" || result.Author != "Ada Lovelace" || result.Published != "2024-07-01T12:00:00Z" || result.Duration != 2730 {
+		t.Errorf("expected the episode's metadata from the feed, got %+v", result)
+	}
+	if !strings.HasSuffix(result.URL, "/media/episode-1.mp3") {
+		t.Errorf("expected the content to be saved at the episode's media URL, got %q", result.URL)
+	}
+	if len(savedContent(t, server, job).Segments) == 0 {
+		t.Errorf("expected the episode to be transcribed like audio, got %+v", result)
+	}
+	assertTimedQuestions(t, server, result.ContentID, result.QuizID)
+
+	// Without an episode, the newest is quizzed
+	job = submitAndWait(t, server, SubmitRequest{URL: ts.URL + "/feed.xml", ContentType: "Podcast"})
+	if job.Result.Title != "Why Lobsters Molt" || job.Result.ContentID == result.ContentID {
+		t.Errorf("expected the newest episode to be quizzed as its own content, got %+v", job.Result)
+	}
+}
+
+func TestSubmitHandler_PodcastErrors(t *testing.T) {
+	server := newTestServer(t)
+	ts := newPodcastFeedServer(t)
+
+	responseRecorder := postSubmit(t, server, SubmitRequest{ContentType: "Podcast"})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Podcast feed URL is required") {
+		t.Errorf("expected a podcast without a feed URL to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	testCases := []struct {
+		request       SubmitRequest
+		expectedError string
+	}{
+		{SubmitRequest{URL: ts.URL + "/feed.xml", ContentType: "Podcast", Episode: "episode-9"}, "Podcast episode not found"},
+		{SubmitRequest{URL: ts.URL + "/page", ContentType: "Podcast"}, "URL is not a podcast feed"},
+	}
+	for _, tc := range testCases {
+		job := waitForJob(t, server, submitJob(t, server, tc.request))
+		if job.Status != models.JobStatusFailed || job.Error != tc.expectedError {
+			t.Errorf("%+v: expected the job to fail with %q, got %+v", tc.request, tc.expectedError, job)
+		}
+	}
+}
@@ -2,13 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"read-robin/models"
-	"read-robin/services"
 
 	"github.com/gorilla/mux"
-	"golang.org/x/net/context"
 )
 
 type QuizResponse struct {
@@ -16,8 +13,13 @@ type QuizResponse struct {
 	Questions []models.Question `json:"questions"`
 }
 
-// GetQuizHandler retrieves a quiz from Firestore by contentID and quizID
-func GetQuizHandler(w http.ResponseWriter, r *http.Request) {
+// GetQuizHandler retrieves a quiz from the quiz store by contentID and quizID
+func (s *Server) GetQuizHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "GetQuizHandler")
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	contentID := vars["contentID"]
 	quizID := vars["quizID"]
@@ -27,20 +29,22 @@ func GetQuizHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	firestoreClient, err := services.NewFirestoreClient(ctx)
-	if err != nil {
-		log.Printf("GetQuizHandler: Error creating Firestore client: %v", err)
-		http.Error(w, "Error creating Firestore client", http.StatusInternalServerError)
+	// Retrieve the content from the store, checking the user may read it
+	content, ok := s.authorizeContent(w, r, "GetQuizHandler", contentID, userID, false)
+	if !ok {
 		return
 	}
-	defer firestoreClient.Client.Close()
 
-	// Retrieve the quiz from Firestore
-	quiz, err := firestoreClient.GetQuiz(ctx, contentID, quizID)
-	if err != nil {
-		log.Printf("GetQuizHandler: Error retrieving quiz from Firestore: %v", err)
-		http.Error(w, "Error retrieving quiz from Firestore", http.StatusInternalServerError)
+	var quiz *models.Quiz
+	for _, q := range content.Quizzes {
+		if q.QuizID == quizID {
+			quiz = &q
+			break
+		}
+	}
+	if quiz == nil {
+		s.Logger.Printf("GetQuizHandler: Quiz not found: %s", quizID)
+		http.Error(w, "Quiz not found", http.StatusNotFound)
 		return
 	}
 
@@ -51,7 +55,7 @@ func GetQuizHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("GetQuizHandler: Error encoding response: %v", err)
+		s.Logger.Printf("GetQuizHandler: Error encoding response: %v", err)
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
 }
@@ -3,43 +3,25 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
+	"time"
 
+	"read-robin/models"
 	"read-robin/services"
-
-	"github.com/gorilla/mux"
+	"read-robin/utils"
 )
 
-func setupFirestoreClient(t *testing.T) *services.FirestoreClient {
-	ctx := context.Background()
-	projectID := os.Getenv("GCP_PROJECT")
-	if projectID == "" {
-		t.Fatal("GCP_PROJECT environment variable not set")
-	}
-	firestoreClient, err := services.NewFirestoreClient(ctx)
-	if err != nil {
-		t.Fatalf("Failed to create Firestore client: %v", err)
-	}
-	return firestoreClient
-}
-
 func TestGetQuizHandler(t *testing.T) {
-	// Known document and quiz IDs
-	contentID := "131addf8c20b6fd"
-	quizID := "0001"
+	server := newTestServer(t)
 
-	// Ensure the working directory is the project root
-	err := os.Chdir("..")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Set up the Firestore client
-	firestoreClient := setupFirestoreClient(t)
-	defer firestoreClient.Client.Close()
+	// Seed a known document and quiz
+	contentURL := "https://example.com/get-quiz-handler"
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+	quizID := "0001"
+	seedQuiz(t, server, contentURL, "Example Domain", "Example text", quizID)
 
 	// Create a new GET request to the /quiz/{contentID}/{quizID} endpoint with the known contentID and quizID
 	getRequest, err := http.NewRequest("GET", "/quiz/"+contentID+"/"+quizID, nil)
@@ -49,10 +31,9 @@ func TestGetQuizHandler(t *testing.T) {
 
 	// Create a new ResponseRecorder to record the response
 	responseRecorder := httptest.NewRecorder()
-	// Wrap the GetQuizHandler function with http.HandlerFunc and set up the router
-	router := mux.NewRouter()
-	router.HandleFunc("/quiz/{contentID}/{quizID}", GetQuizHandler)
-	router.ServeHTTP(responseRecorder, getRequest)
+	// Route the request through the server router so route variables are set
+	router := server.Routes()
+	router.ServeHTTP(responseRecorder, asUser(getRequest, testUserID))
 
 	// Check if the status code returned by the handler is 200 OK
 	if statusCode := responseRecorder.Code; statusCode != http.StatusOK {
@@ -73,4 +54,68 @@ func TestGetQuizHandler(t *testing.T) {
 	if quizResponse.QuizID != quizID {
 		t.Errorf("handler returned unexpected quiz_id: got %v want %v", quizResponse.QuizID, quizID)
 	}
+	if len(quizResponse.Questions) != 1 {
+		t.Errorf("handler returned unexpected questions: got %v", quizResponse.Questions)
+	}
+}
+
+func TestGetQuizHandler_NotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	getRequest, err := http.NewRequest("GET", "/quiz/missing-content/0001", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	router := server.Routes()
+	router.ServeHTTP(responseRecorder, asUser(getRequest, testUserID))
+
+	if statusCode := responseRecorder.Code; statusCode != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", statusCode, http.StatusNotFound)
+	}
+}
+
+// aliasStore is a Store with content aliases left by an ID migration
+type aliasStore struct {
+	services.Store
+	aliases map[string]string
+}
+
+func (s aliasStore) ResolveContentID(ctx context.Context, alias string) (string, error) {
+	if contentID, ok := s.aliases[alias]; ok {
+		return contentID, nil
+	}
+	return "", fmt.Errorf("content alias %s: %w", alias, services.ErrNotFound)
+}
+
+func TestLegacyIDs(t *testing.T) {
+	server := newTestServer(t)
+	contentURL := "https://example.com/legacy-ids"
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+	legacyID := utils.LegacyContentID(testUserID, contentURL)
+	server.Store = aliasStore{Store: server.Store, aliases: map[string]string{legacyID: contentID}}
+
+	quiz := models.Quiz{
+		QuizID:    "0001",
+		Questions: []models.Question{{QuestionID: utils.GenerateQuestionID(), LegacyID: "0042", Question: "What is the purpose of the 'Example Domain'?", Answer: "It is for use in illustrative examples in documents."}},
+		Timestamp: time.Now(),
+		OwnerID:   testUserID,
+	}
+	if _, err := server.Store.SaveQuiz(context.Background(), models.Content{OwnerID: testUserID, URL: contentURL, Title: "Example Domain", ContentText: "Example text"}, quiz); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+
+	if status := serveAs(t, server, testUserID, "GET", "/quiz/"+legacyID+"/0001", nil).Code; status != http.StatusOK {
+		t.Errorf("quiz at legacy content ID: got %v want %v", status, http.StatusOK)
+	}
+
+	payload, _ := json.Marshal(ResponseSubmission{ContentID: legacyID, QuizID: "0001", QuestionID: "0042", UserResponse: "It is used for illustrative examples in documents."})
+	if status := serveAs(t, server, testUserID, "POST", "/submit-response", payload).Code; status != http.StatusOK {
+		t.Fatalf("response to legacy question ID: got %v want %v", status, http.StatusOK)
+	}
+	cards, err := server.Store.ListDueReviewCards(context.Background(), testUserID, time.Now().AddDate(0, 0, 2))
+	if err != nil || len(cards) != 1 || cards[0].ContentID != contentID || cards[0].QuestionID != quiz.Questions[0].QuestionID {
+		t.Errorf("expected the review recorded under the current IDs, got %+v (err %v)", cards, err)
+	}
 }
@@ -1,104 +1,217 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"read-robin/models"
-	"read-robin/services"
+	"read-robin/services/llm"
 	"read-robin/utils"
-
-	"golang.org/x/net/context"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
-// RegenerateQuizRequest is a struct to hold the content text and persona details submitted by the user
+// RegenerateQuizRequest is a struct to hold the content, persona details and quiz options submitted by the user.
+// ContentText replaces the stored text of the content, which only its owner may do; without it the stored text is used.
 type RegenerateQuizRequest struct {
-	ContentID   string         `json:"content_id"`
-	ContentText string         `json:"content_text"`
-	Title       string         `json:"title"`
-	URL         string         `json:"url"`
-	Persona     models.Persona `json:"persona"`
+	ContentID   string             `json:"content_id"`
+	ContentText string             `json:"content_text,omitempty"`
+	URL         string             `json:"url"`
+	Persona     models.Persona     `json:"persona"`
+	Options     models.QuizOptions `json:"options"`
+}
+
+// RegenerateQuizResponse is a struct to hold the regenerated quiz details sent back to the user
+type RegenerateQuizResponse struct {
+	Status             string `json:"status"`
+	DuplicatesFiltered int    `json:"duplicates_filtered"` // Generated questions dropped for repeating earlier ones
+	models.QuizResult
 }
 
 // RegenerateQuizHandler handles the regeneration of quizzes from text content
-func RegenerateQuizHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RegenerateQuizHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "RegenerateQuizHandler")
+	if !ok {
+		return
+	}
+
 	var request RegenerateQuizRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("RegenerateQuizHandler: Unable to parse request: %v", err)
+		s.Logger.Printf("RegenerateQuizHandler: Unable to parse request: %v", err)
 		http.Error(w, "Unable to parse request", http.StatusBadRequest)
 		return
 	}
+	if err := utils.ValidateQuizOptions(request.Options); err != nil {
+		s.Logger.Printf("RegenerateQuizHandler: Invalid quiz options: %v", err)
+		http.Error(w, "Invalid quiz options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 
-	geminiClient, err := createGeminiClient(ctx)
-	if err != nil {
-		log.Printf("RegenerateQuizHandler: Error creating Gemini client: %v", err)
-		http.Error(w, "Error creating Gemini client", http.StatusInternalServerError)
+	// Only the owner and the users the content is shared with may regenerate it
+	content, ok := s.authorizeContent(w, r, "RegenerateQuizHandler", request.ContentID, userID, false)
+	if !ok {
 		return
 	}
+	contentID := content.ContentID
+	existingQuizzes := content.Quizzes
+
+	// The title is kept as the owner last named it, and only the owner may edit the text
+	title := content.Title
+	contentText := content.ContentText
+	if request.ContentText != "" && request.ContentText != contentText {
+		if content.OwnerID != userID {
+			s.Logger.Printf("RegenerateQuizHandler: User %s may not edit content %s", userID, contentID)
+			http.Error(w, "Only the owner may edit the content text", http.StatusForbidden)
+			return
+		}
+		contentText = request.ContentText
+	}
+	request.ContentText = contentText
+	url := content.URL
 
-	firestoreClient, err := createFirestoreClient(ctx)
-	if err != nil {
-		log.Printf("RegenerateQuizHandler: Error creating Firestore client: %v", err)
-		http.Error(w, "Error creating Firestore client", http.StatusInternalServerError)
+	quiz, duplicates, err := s.generateDistinctQuiz(ctx, request, existingQuizzes)
+	if errors.Is(err, utils.ErrNoMatchingQuestions) {
+		s.Logger.Printf("RegenerateQuizHandler: Error parsing quiz response: %v", err)
+		http.Error(w, noMatchingQuestionsMessage, http.StatusBadGateway)
 		return
 	}
-
-	contentID := request.ContentID
-	existingQuizzes, err := firestoreClient.GetExistingQuizzes(ctx, contentID)
-	if err != nil && status.Code(err) != codes.NotFound {
-		log.Printf("RegenerateQuizHandler: Error fetching existing quizzes: %v", err)
-		http.Error(w, "Error fetching existing quizzes", http.StatusInternalServerError)
+	if errors.Is(err, errNoNewQuestions) {
+		s.Logger.Printf("RegenerateQuizHandler: Error generating quiz content: %v", err)
+		http.Error(w, "No new questions could be generated for this content", http.StatusBadGateway)
+		return
+	}
+	if isInvalidModelResponse(err) {
+		s.Logger.Printf("RegenerateQuizHandler: Error decoding quiz content: %v", err)
+		http.Error(w, invalidModelResponseMessage, http.StatusBadGateway)
+		return
+	}
+	if isModelUnavailable(err) {
+		s.Logger.Printf("RegenerateQuizHandler: Error generating quiz content: %v", err)
+		http.Error(w, modelUnavailableMessage, http.StatusServiceUnavailable)
 		return
 	}
-
-	var quizContentMap map[string]interface{}
-	var contentMap map[string]string
-
-	quizContentMap, contentMap, err = geminiClient.RegenerateQuizFromText(ctx, contentID, request.ContentText, request.Persona)
 	if err != nil {
-		log.Printf("RegenerateQuizHandler: Error generating quiz content from text: %v", err)
+		s.Logger.Printf("RegenerateQuizHandler: Error generating quiz content from text: %v", err)
 		http.Error(w, "Error generating quiz content from text", http.StatusInternalServerError)
 		return
 	}
+	quiz.OwnerID = userID
 
-	title := request.Title
-	contentText := contentMap["content"]
-	url := request.URL
-	latestQuizID := services.GetLatestQuizID(existingQuizzes)
-
-	quiz, err := utils.ParseQuizResponse(quizContentMap, latestQuizID)
-	if err != nil {
-		log.Printf("RegenerateQuizHandler: Error parsing quiz response: %v", err)
-		http.Error(w, "Error parsing quiz response", http.StatusInternalServerError)
-		return
+	// Page anchors and transcript segments still locate the text only if it was not edited before regenerating
+	var anchors []models.Anchor
+	var segments []models.Segment
+	if contentText == content.ContentText {
+		anchors, segments = content.Anchors, content.Segments
+	}
+	for i := range quiz.Questions {
+		citeQuestion(&quiz.Questions[i], contentText, anchors, segments)
 	}
 
-	err = firestoreClient.SaveQuiz(ctx, url, title, contentText, quiz)
+	// The quiz is added to the owner's content even when a shared user regenerates it
+	source := models.Content{OwnerID: content.OwnerID, URL: url, Title: title, ContentText: contentText, Anchors: anchors, Segments: segments,
+		Published: content.Published, Duration: content.Duration}
+	quiz.QuizID, err = s.Store.SaveQuiz(ctx, source, quiz)
 	if err != nil {
-		log.Printf("RegenerateQuizHandler: Error saving quiz to Firestore: %v", err)
-		http.Error(w, "Error saving quiz to Firestore", http.StatusInternalServerError)
+		s.Logger.Printf("RegenerateQuizHandler: Error saving quiz: %v", err)
+		http.Error(w, "Error saving quiz", http.StatusInternalServerError)
 		return
 	}
 
-	response := SubmitResponse{
-		Status:      "success",
-		ContentID:   contentID,
-		QuizID:      latestQuizID,
-		Title:       title,
-		ContentText: contentText,
-		IsFirstQuiz: len(existingQuizzes) == 0,
+	response := RegenerateQuizResponse{
+		Status:             "success",
+		DuplicatesFiltered: duplicates,
+		QuizResult: models.QuizResult{
+			URL:         url,
+			ContentID:   contentID,
+			QuizID:      quiz.QuizID,
+			Title:       title,
+			ContentText: contentText,
+			IsFirstQuiz: len(existingQuizzes) == 0,
+			Published:   content.Published,
+			Duration:    content.Duration,
+			Anchors:     anchors,
+			Segments:    segments,
+		},
 	}
 
-	log.Printf("RegenerateQuizHandler: Response - %v\n", response)
+	s.Logger.Printf("RegenerateQuizHandler: Response - %v\n", response)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("RegenerateQuizHandler: Error encoding response: %v", err)
+		s.Logger.Printf("RegenerateQuizHandler: Error encoding response: %v", err)
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
-	log.Println("RegenerateQuizHandler: Response sent successfully")
+	s.Logger.Println("RegenerateQuizHandler: Response sent successfully")
+}
+
+// maxExcludedQuestions caps the earlier questions listed in a regeneration prompt, keeping the most recent
+const maxExcludedQuestions = 100
+
+// maxReplacementRounds is how many times regeneration asks for replacements of questions dropped as duplicates
+const maxReplacementRounds = 2
+
+// errNoNewQuestions is returned when every question generated for a regeneration repeats an earlier one
+var errNoNewQuestions = errors.New("every generated question repeats an earlier quiz")
+
+// generateDistinctQuiz generates a quiz for request without repeating the questions of existing: the
+// model is given the earlier questions to avoid, near-duplicates it still produces are dropped, and dropped
+// questions are replaced by asking again. It also returns the number of duplicates dropped.
+func (s *Server) generateDistinctQuiz(ctx context.Context, request RegenerateQuizRequest, existing []models.Quiz) (models.Quiz, int, error) {
+	var earlier []string
+	for _, quiz := range existing {
+		for _, question := range quiz.Questions {
+			earlier = append(earlier, utils.QuestionText(question))
+		}
+	}
+	duplicates := utils.NewDuplicateFilter(earlier...)
+	options := request.Options
+	options.ExcludeQuestions = earlier[max(0, len(earlier)-maxExcludedQuestions):]
+
+	var quiz models.Quiz
+	target := request.Options.NumQuestions
+	filtered := 0
+	for round := 0; round <= maxReplacementRounds; round++ {
+		quizContentMap, err := llm.GenerateChunkedQuiz(ctx, s.LLM, request.ContentText, request.Persona, options, s.chunkPolicy(), nil)
+		if err == nil {
+			// Parse every question, since the duplicates among them do not count towards the target
+			parseOptions := options
+			parseOptions.NumQuestions = 0
+			var generated models.Quiz
+			generated, err = utils.ParseQuizResponse(quizContentMap, "", parseOptions)
+			if err != nil && !errors.Is(err, utils.ErrNoMatchingQuestions) {
+				err = &llm.ParseError{Kind: "quiz", Err: err}
+			}
+			if err == nil && target == 0 {
+				target = len(generated.Questions)
+			}
+			for _, question := range generated.Questions {
+				if len(quiz.Questions) == target {
+					break
+				}
+				if !duplicates.Add(utils.QuestionText(question)) {
+					filtered++
+					continue
+				}
+				quiz.Questions = append(quiz.Questions, question)
+				options.ExcludeQuestions = append(options.ExcludeQuestions, utils.QuestionText(question))
+			}
+		}
+		if err != nil {
+			// A failed replacement round keeps the questions already generated
+			if round == 0 {
+				return models.Quiz{}, 0, err
+			}
+			s.Logger.Printf("RegenerateQuizHandler: Error generating replacement questions: %v", err)
+			break
+		}
+		if len(quiz.Questions) >= target {
+			break
+		}
+		options.NumQuestions = target - len(quiz.Questions)
+	}
+	if len(quiz.Questions) == 0 {
+		return models.Quiz{}, filtered, errNoNewQuestions
+	}
+	return quiz, filtered, nil
 }
@@ -2,23 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"read-robin/models"
-
-	"github.com/gorilla/mux"
+	"read-robin/services/llm"
+	"read-robin/utils"
 )
 
 func TestRegenerateQuizHandler(t *testing.T) {
-	// Ensure the working directory is the project root
-	err := os.Chdir("..")
-	if err != nil {
-		t.Fatal(err)
-	}
+	server := newTestServer(t)
 
 	// Create test cases for Text content type
 	testCases := []struct {
@@ -31,7 +30,7 @@ func TestRegenerateQuizHandler(t *testing.T) {
 	}{
 		{
 			name:        "Text content type",
-			contentID:   "-53fd7eb86d4e84fd",
+			contentID:   utils.GenerateContentID(testUserID, "en.wikipedia.org/wiki/the_world's_largest_lobster"),
 			contentText: "The World's Largest Lobster (French: Le plus grand homard du monde) is a concrete and reinforced steel sculpture in Shediac, New Brunswick, Canada sculpted by Canadian artist Winston Bronnum. Despite being known by its name The World's Largest Lobster, it is not actually the largest lobster sculpture. Description The sculpture is 11 metres long and 5 metres tall, weighing 90 tonnes.[1] The sculpture was commissioned by the Shediac Rotary Club as a tribute to the town's lobster fishing industry.[2] The sculpture took three years to complete,[2] at a cost of $170,000.[3] It attracts 500,000 visitors per year.[2] Contrary to popular belief, this is not actually the \"World's Largest Lobster\" as that title went to the Big Lobster sculpture in Kingston, South Australia, until 2015 when Qianjiang, Hubei, China built a 100-tonne lobster/crayfish.[4] See also * List of world's largest roadside attractions * Betsy the Lobster, another large lobster sculpture",
 			title:       "Wikipedia - The World's Largest Lobster",
 			url:         "en.wikipedia.org/wiki/the_world's_largest_lobster",
@@ -40,11 +39,13 @@ func TestRegenerateQuizHandler(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
+			// Regeneration expects the content to exist already
+			seedQuiz(t, server, tc.url, tc.title, tc.contentText, "0001")
+
 			// Create a RegenerateQuizRequest payload with persona details to be sent in the POST request
 			regenerateQuizRequestPayload := RegenerateQuizRequest{
 				ContentID:   tc.contentID,
 				ContentText: tc.contentText,
-				Title:       tc.title,
 				URL:         tc.url,
 				Persona: models.Persona{
 					ID:         "test_persona_id",
@@ -71,10 +72,10 @@ func TestRegenerateQuizHandler(t *testing.T) {
 			// Create a ResponseRecorder to record the response
 			responseRecorder := httptest.NewRecorder()
 			// Wrap the RegenerateQuizHandler function with http.HandlerFunc
-			regenerateQuizHandler := http.HandlerFunc(RegenerateQuizHandler)
+			regenerateQuizHandler := http.HandlerFunc(server.RegenerateQuizHandler)
 
 			// Serve the HTTP request using the handler
-			regenerateQuizHandler.ServeHTTP(responseRecorder, postRequest)
+			regenerateQuizHandler.ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
 
 			// Check if the status code returned by the handler is 200 OK
 			if statusCode := responseRecorder.Code; statusCode != http.StatusOK {
@@ -82,8 +83,8 @@ func TestRegenerateQuizHandler(t *testing.T) {
 				return
 			}
 
-			// Parse the response body into SubmitResponse struct
-			var regenerateQuizResponse SubmitResponse
+			// Parse the response body into RegenerateQuizResponse struct
+			var regenerateQuizResponse RegenerateQuizResponse
 			if err := json.NewDecoder(responseRecorder.Body).Decode(&regenerateQuizResponse); err != nil {
 				t.Fatalf("failed to parse response body: %v", err)
 			}
@@ -105,12 +106,11 @@ func TestRegenerateQuizHandler(t *testing.T) {
 			// Create a new ResponseRecorder to record the response
 			getResponseRecorder := httptest.NewRecorder()
 
-			// Use mux to set up the router and route variables
-			router := mux.NewRouter()
-			router.HandleFunc("/quiz/{contentID}/{quizID}", GetQuizHandler)
+			// Use the server router to set up route variables
+			router := server.Routes()
 
 			// Serve the HTTP request using the router
-			router.ServeHTTP(getResponseRecorder, getRequest)
+			router.ServeHTTP(getResponseRecorder, asUser(getRequest, testUserID))
 
 			// Check if the status code returned by the handler is 200 OK
 			if statusCode := getResponseRecorder.Code; statusCode != http.StatusOK {
@@ -134,3 +134,338 @@ func TestRegenerateQuizHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRegenerateQuizHandler_InvalidQuiz(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = invalidJSONProvider{llm.NewFakeProvider()}
+
+	url := "https://example.com/invalid-quiz"
+	seedQuiz(t, server, url, "Example Domain", "Example text", "0001")
+	payload, err := json.Marshal(RegenerateQuizRequest{
+		ContentID:   utils.GenerateContentID(testUserID, url),
+		ContentText: "Example text",
+		URL:         url,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRegenerateQuizHandler_ModelUnavailable(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = unavailableProvider{llm.NewFakeProvider()}
+
+	url := "https://example.com/model-unavailable"
+	seedQuiz(t, server, url, "Example Domain", "Example text", "0001")
+	payload, err := json.Marshal(RegenerateQuizRequest{
+		ContentID:   utils.GenerateContentID(testUserID, url),
+		ContentText: "Example text",
+		URL:         url,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRegenerateQuizHandler_Options(t *testing.T) {
+	server := newTestServer(t)
+
+	url := "https://example.com/lobsters"
+	contentText := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue. It weighs ninety tonnes. Lobsters molt to grow."
+	seedQuiz(t, server, url, "Lobsters", contentText, "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	noReferences := false
+
+	payload, err := json.Marshal(RegenerateQuizRequest{
+		ContentID:   contentID,
+		ContentText: contentText,
+		URL:         url,
+		Options:     models.QuizOptions{NumQuestions: 2, QuestionTypes: []string{models.QuestionTypeMultipleChoice}, IncludeReferences: &noReferences},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+	}
+	var response RegenerateQuizResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	quiz, err := server.Store.GetQuiz(context.Background(), contentID, response.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: %v", err)
+	}
+	if len(quiz.Questions) != 2 {
+		t.Fatalf("expected 2 questions, got %d", len(quiz.Questions))
+	}
+	for _, question := range quiz.Questions {
+		if question.Type != models.QuestionTypeMultipleChoice || question.Reference != "" {
+			t.Errorf("expected multiple-choice questions without references, got %+v", question)
+		}
+	}
+
+	payload, err = json.Marshal(RegenerateQuizRequest{ContentID: contentID, ContentText: contentText, Options: models.QuizOptions{QuestionTypes: []string{"essay"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload); responseRecorder.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid options: got %v want %v", responseRecorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRegenerateQuizHandler_Citations(t *testing.T) {
+	server := newTestServer(t)
+
+	url := "upload:lobster-guide"
+	contentText := "Lobsters live in the ocean. They have ten legs.\n\nShediac hosts a giant lobster statue. It weighs ninety tonnes."
+	anchors := []models.Anchor{{Offset: 0, Label: "p. 1"}, {Offset: 49, Label: "p. 2"}}
+	source := models.Content{OwnerID: testUserID, URL: url, Title: "Lobster Guide", ContentText: contentText, Anchors: anchors}
+	if _, err := server.Store.SaveQuiz(context.Background(), source, models.Quiz{OwnerID: testUserID}); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+	contentID := utils.GenerateContentID(testUserID, url)
+
+	regenerate := func(text string) (RegenerateQuizResponse, *models.Quiz) {
+		t.Helper()
+		payload, err := json.Marshal(RegenerateQuizRequest{ContentID: contentID, ContentText: text, URL: url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+		}
+		var response RegenerateQuizResponse
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse response body: %v", err)
+		}
+		quiz, err := server.Store.GetQuiz(context.Background(), contentID, response.QuizID)
+		if err != nil {
+			t.Fatalf("GetQuiz: %v", err)
+		}
+		return response, quiz
+	}
+
+	response, quiz := regenerate(contentText)
+	if len(response.Anchors) != 2 {
+		t.Errorf("expected the page anchors to be kept, got %v", response.Anchors)
+	}
+	for _, question := range quiz.Questions {
+		if expected := utils.Cite(contentText, anchors, question.Reference); question.Citation != expected || expected == "" {
+			t.Errorf("expected question quoting %q to cite %q, got %q", question.Reference, expected, question.Citation)
+		}
+	}
+
+	// Edited text no longer matches the page offsets
+	response, quiz = regenerate("Lobsters live in the ocean. They have eight legs.")
+	if response.Anchors != nil {
+		t.Errorf("expected the anchors to be dropped for edited text, got %v", response.Anchors)
+	}
+	for _, question := range quiz.Questions {
+		if question.Citation != "" {
+			t.Errorf("expected no citations for edited text, got %q", question.Citation)
+		}
+	}
+}
+
+func TestRegenerateQuizHandler_TimeRanges(t *testing.T) {
+	server := newTestServer(t)
+
+	url := "https://example.com/episodes/lobster-talk.mp3"
+	contentText, segments := utils.TranscriptContent([]models.Segment{
+		{Start: 0, End: 5, Text: "Lobsters live in the ocean."},
+		{Start: 5, End: 9, Text: "They have ten legs."},
+		{Start: 70, End: 75, Text: "Shediac hosts a giant lobster statue."},
+	})
+	source := models.Content{OwnerID: testUserID, URL: url, Title: "Lobster Talk", ContentText: contentText, Segments: segments}
+	if _, err := server.Store.SaveQuiz(context.Background(), source, models.Quiz{OwnerID: testUserID}); err != nil {
+		t.Fatalf("Failed to seed quiz: %v", err)
+	}
+	contentID := utils.GenerateContentID(testUserID, url)
+
+	payload, err := json.Marshal(RegenerateQuizRequest{ContentID: contentID, ContentText: contentText, URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+	}
+	var response RegenerateQuizResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if len(response.Segments) != 3 {
+		t.Errorf("expected the transcript segments to be kept, got %v", response.Segments)
+	}
+	quiz, err := server.Store.GetQuiz(context.Background(), contentID, response.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: %v", err)
+	}
+	for _, question := range quiz.Questions {
+		expected := utils.LocateTimeRange(contentText, segments, question.Reference)
+		if expected == nil || !reflect.DeepEqual(question.TimeRange, expected) || question.Citation != utils.FormatTimestamp(expected.Start) {
+			t.Errorf("expected question quoting %q to have time range %+v, got %+v cited %q", question.Reference, expected, question.TimeRange, question.Citation)
+		}
+	}
+}
+
+// repeatingProvider ignores the questions it is told to avoid, answering each quiz request with the next
+// of its scripted quizzes and recording the options it was given
+type repeatingProvider struct {
+	*llm.FakeProvider
+	mu      sync.Mutex
+	quizzes []string
+	options []models.QuizOptions
+}
+
+func (p *repeatingProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.options = append(p.options, options)
+	quiz := p.quizzes[min(len(p.options), len(p.quizzes))-1]
+	return quiz, quiz, nil
+}
+
+func (p *repeatingProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	return p.GenerateQuiz(ctx, content, persona, options)
+}
+
+func TestRegenerateQuizHandler_FiltersDuplicates(t *testing.T) {
+	server := newTestServer(t)
+	provider := &repeatingProvider{FakeProvider: llm.NewFakeProvider(), quizzes: []string{
+		`{"quiz": [
+			{"question": "What is the purpose of the Example Domain?", "answer": "Examples.", "reference": "Examples."},
+			{"question": "Who may use the domain?", "answer": "Anyone.", "reference": "Anyone."},
+			{"question": "Is permission needed to use the domain?", "answer": "No.", "reference": "No."}
+		]}`,
+		`{"quiz": [
+			{"question": "Who can use this domain?", "answer": "Anyone.", "reference": "Anyone."},
+			{"question": "Where is the domain documented?", "answer": "By IANA.", "reference": "By IANA."}
+		]}`,
+	}}
+	server.LLM = provider
+
+	url := "https://example.com/duplicates"
+	seedQuiz(t, server, url, "Example Domain", "Example text", "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	payload, err := json.Marshal(RegenerateQuizRequest{ContentID: contentID, ContentText: "Example text", URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+	}
+	var response RegenerateQuizResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response.DuplicatesFiltered != 2 {
+		t.Errorf("expected 2 duplicates to be filtered, got %d", response.DuplicatesFiltered)
+	}
+
+	// The first request avoids the seeded question; the replacement request also avoids the new questions
+	if len(provider.options) != 2 {
+		t.Fatalf("expected a replacement request, got %d requests", len(provider.options))
+	}
+	if excluded := provider.options[0].ExcludeQuestions; len(excluded) != 1 || excluded[0] != "What is the purpose of the 'Example Domain'?" {
+		t.Errorf("expected the earlier question to be excluded, got %q", excluded)
+	}
+	if replacement := provider.options[1]; replacement.NumQuestions != 1 || len(replacement.ExcludeQuestions) != 3 {
+		t.Errorf("expected a request for 1 replacement avoiding 3 questions, got %+v", replacement)
+	}
+
+	quiz, err := server.Store.GetQuiz(context.Background(), contentID, response.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: %v", err)
+	}
+	var questions []string
+	for _, question := range quiz.Questions {
+		questions = append(questions, question.Question)
+	}
+	expected := []string{"Who may use the domain?", "Is permission needed to use the domain?", "Where is the domain documented?"}
+	if strings.Join(questions, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected questions %q, got %q", expected, questions)
+	}
+}
+
+func TestRegenerateQuizHandler_NoNewQuestions(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = &repeatingProvider{FakeProvider: llm.NewFakeProvider(), quizzes: []string{
+		`{"quiz": [{"question": "What is the purpose of the Example Domain?", "answer": "Examples.", "reference": "Examples."}]}`,
+	}}
+
+	url := "https://example.com/no-new-questions"
+	seedQuiz(t, server, url, "Example Domain", "Example text", "0001")
+	payload, err := json.Marshal(RegenerateQuizRequest{ContentID: utils.GenerateContentID(testUserID, url), ContentText: "Example text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responseRecorder := serveAs(t, server, testUserID, "POST", "/regenerate-quiz", payload); responseRecorder.Code != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusBadGateway)
+	}
+}
+
+func TestRegenerateQuizHandler_KeepsStoredContent(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	url := "https://example.com/lobster-notes"
+	contentText := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue."
+	seedQuiz(t, server, url, "Lobster Notes", contentText, "0001")
+	contentID := utils.GenerateContentID(testUserID, url)
+	if err := server.Store.SetTitle(ctx, contentID, "Renamed Notes"); err != nil {
+		t.Fatalf("SetTitle: %v", err)
+	}
+	if err := server.Store.SetSharedWith(ctx, contentID, []string{"collaborator"}); err != nil {
+		t.Fatalf("SetSharedWith: %v", err)
+	}
+
+	// A user the content is shared with may not replace its text
+	payload, err := json.Marshal(RegenerateQuizRequest{ContentID: contentID, ContentText: "Lobsters are fish."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if responseRecorder := serveAs(t, server, "collaborator", "POST", "/regenerate-quiz", payload); responseRecorder.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusForbidden)
+	}
+
+	// Without text the stored text is quizzed, and the renamed title is kept
+	payload, err = json.Marshal(RegenerateQuizRequest{ContentID: contentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := serveAs(t, server, "collaborator", "POST", "/regenerate-quiz", payload)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+	}
+	var response RegenerateQuizResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if response.Title != "Renamed Notes" || response.ContentText != contentText {
+		t.Errorf("expected the stored title and text, got %q, %q", response.Title, response.ContentText)
+	}
+	content, err := server.Store.GetContent(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetContent: %v", err)
+	}
+	if content.Title != "Renamed Notes" || content.ContentText != contentText {
+		t.Errorf("expected the stored content to be unchanged, got %q, %q", content.Title, content.ContentText)
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+)
+
+// Sizes of the deck returned by ReviewDueHandler
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+)
+
+// ReviewItem is a question due for review, with the content it comes from and its schedule
+type ReviewItem struct {
+	ContentID    string          `json:"content_id"`
+	QuizID       string          `json:"quiz_id"`
+	Title        string          `json:"title"`
+	Question     models.Question `json:"question"`
+	DueAt        time.Time       `json:"due_at"`
+	IntervalDays int             `json:"interval_days"`
+	Repetitions  int             `json:"repetitions"`
+	Lapses       int             `json:"lapses"`
+}
+
+// ReviewDueResponse is a struct to hold a deck of questions due for review and how many are due in all
+type ReviewDueResponse struct {
+	Items    []ReviewItem `json:"items"`
+	TotalDue int          `json:"total_due"`
+}
+
+// interleaveReviews deals items from each content in turn, starting with the content due earliest, so
+// the deck mixes content instead of reviewing one source at a time. Items of each content keep their order.
+func interleaveReviews(items []ReviewItem) []ReviewItem {
+	var order []string
+	byContent := make(map[string][]ReviewItem)
+	for _, item := range items {
+		if _, ok := byContent[item.ContentID]; !ok {
+			order = append(order, item.ContentID)
+		}
+		byContent[item.ContentID] = append(byContent[item.ContentID], item)
+	}
+
+	deck := make([]ReviewItem, 0, len(items))
+	for round := 0; len(deck) < len(items); round++ {
+		for _, contentID := range order {
+			if round < len(byContent[contentID]) {
+				deck = append(deck, byContent[contentID][round])
+			}
+		}
+	}
+	return deck
+}
+
+// ReviewDueHandler returns a mixed deck of the user's questions due for review across all the content they
+// may still read, of at most the limit query parameter questions
+func (s *Server) ReviewDueHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "ReviewDueHandler")
+	if !ok {
+		return
+	}
+
+	limit := defaultReviewLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxReviewLimit {
+			http.Error(w, "limit must be from 1 to "+strconv.Itoa(maxReviewLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	ctx := r.Context()
+	cards, err := s.Store.ListDueReviewCards(ctx, userID, time.Now())
+	if err != nil {
+		s.Logger.Printf("ReviewDueHandler: Error listing review cards: %v", err)
+		http.Error(w, "Error listing review cards", http.StatusInternalServerError)
+		return
+	}
+
+	// Skip cards whose content, quiz or question is gone or no longer shared with the user
+	contents := make(map[string]*models.Content)
+	items := []ReviewItem{}
+	for _, card := range cards {
+		content, seen := contents[card.ContentID]
+		if !seen {
+			content, err = s.Store.GetContent(ctx, card.ContentID)
+			if err != nil && !errors.Is(err, services.ErrNotFound) {
+				s.Logger.Printf("ReviewDueHandler: Error fetching content: %v", err)
+				http.Error(w, "Error fetching content", http.StatusInternalServerError)
+				return
+			}
+			if err != nil || !canAccess(content, userID) {
+				content = nil
+			}
+			contents[card.ContentID] = content
+		}
+		if content == nil {
+			continue
+		}
+		quiz := findQuiz(content, card.QuizID)
+		if quiz == nil {
+			continue
+		}
+		question := findQuestion(quiz, card.QuestionID)
+		if question == nil {
+			continue
+		}
+		items = append(items, ReviewItem{
+			ContentID:    card.ContentID,
+			QuizID:       card.QuizID,
+			Title:        content.Title,
+			Question:     *question,
+			DueAt:        card.DueAt,
+			IntervalDays: card.IntervalDays,
+			Repetitions:  card.Repetitions,
+			Lapses:       card.Lapses,
+		})
+	}
+
+	response := ReviewDueResponse{Items: interleaveReviews(items), TotalDue: len(items)}
+	if len(response.Items) > limit {
+		response.Items = response.Items[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("ReviewDueHandler: Error encoding response: %v", err)
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
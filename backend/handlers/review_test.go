@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// dueAt returns a review card update making the card due at dueAt
+func dueAt(dueAt time.Time) func(*models.ReviewCard) error {
+	return func(card *models.ReviewCard) error {
+		card.DueAt = dueAt
+		return nil
+	}
+}
+
+func TestReviewDueHandler(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	seedQuiz(t, server, "https://example.com/review-a", "Review A", "Example text", "0001")
+	seedQuiz(t, server, "https://example.com/review-a", "Review A", "Example text", "0002")
+	seedQuiz(t, server, "https://example.com/review-b", "Review B", "Example text", "0001")
+	contentA := utils.GenerateContentID(testUserID, "https://example.com/review-a")
+	contentB := utils.GenerateContentID(testUserID, "https://example.com/review-b")
+
+	for _, card := range []struct {
+		userID, contentID, quizID string
+		dueAt                     time.Time
+	}{
+		{testUserID, contentA, "0001", now.Add(-3 * time.Hour)},
+		{testUserID, contentA, "0002", now.Add(-2 * time.Hour)},
+		{testUserID, contentB, "0001", now.Add(-time.Hour)},
+		{testUserID, contentA, "0009", now.Add(-4 * time.Hour)}, // The quiz no longer exists
+		{"other-user", contentA, "0001", now.Add(-time.Hour)},   // The content is not shared with them
+	} {
+		if _, err := server.Store.UpdateReviewCard(ctx, card.userID, card.contentID, card.quizID, "0001", dueAt(card.dueAt)); err != nil {
+			t.Fatalf("UpdateReviewCard: %v", err)
+		}
+	}
+
+	getDeck := func(userID, query string) ReviewDueResponse {
+		t.Helper()
+		responseRecorder := serveAs(t, server, userID, "GET", "/review/due"+query, nil)
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusOK)
+		}
+		var response ReviewDueResponse
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return response
+	}
+
+	// The deck alternates between content, earliest due first
+	deck := getDeck(testUserID, "")
+	var order []string
+	for _, item := range deck.Items {
+		order = append(order, fmt.Sprintf("%s/%s", item.Title, item.QuizID))
+	}
+	if fmt.Sprint(order) != "[Review A/0001 Review B/0001 Review A/0002]" || deck.TotalDue != 3 {
+		t.Errorf("unexpected deck %v of %d due", order, deck.TotalDue)
+	}
+	if deck.Items[0].Question.Question != "What is the purpose of the 'Example Domain'?" {
+		t.Errorf("unexpected question %+v", deck.Items[0].Question)
+	}
+
+	limited := getDeck(testUserID, "?limit=2")
+	if len(limited.Items) != 2 || limited.TotalDue != 3 {
+		t.Errorf("expected 2 of 3 due questions, got %d of %d", len(limited.Items), limited.TotalDue)
+	}
+	if other := getDeck("other-user", ""); len(other.Items) != 0 || other.TotalDue != 0 {
+		t.Errorf("expected no questions of unshared content, got %+v", other)
+	}
+	for _, limit := range []string{"0", "101", "many"} {
+		if status := serveAs(t, server, testUserID, "GET", "/review/due?limit="+limit, nil).Code; status != http.StatusBadRequest {
+			t.Errorf("limit %s: got %v want %v", limit, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSubmitResponseHandler_SchedulesReview(t *testing.T) {
+	server := newTestServer(t)
+	contentURL := "https://example.com/schedules-review"
+	quiz := seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+
+	submit := func(userResponse, rating string) *ReviewResponse {
+		t.Helper()
+		payload, _ := json.Marshal(ResponseSubmission{
+			ContentID:    contentID,
+			QuizID:       quiz.QuizID,
+			QuestionID:   quiz.Questions[0].QuestionID,
+			UserResponse: userResponse,
+			Rating:       rating,
+		})
+		responseRecorder := serveAs(t, server, testUserID, "POST", "/submit-response", payload)
+		if responseRecorder.Code != http.StatusOK {
+			return nil
+		}
+		var response ReviewResponse
+		if err := json.NewDecoder(responseRecorder.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return &response
+	}
+
+	if response := submit("It is used for illustrative examples in documents.", "trivial"); response != nil {
+		t.Fatalf("expected an invalid rating to be rejected, got %+v", response)
+	}
+
+	before := time.Now()
+	passed := submit("It is used for illustrative examples in documents.", "easy")
+	if passed == nil || passed.NextReviewAt == nil || passed.NextReviewAt.Before(before.AddDate(0, 0, 1)) {
+		t.Fatalf("expected the question due again in a day, got %+v", passed)
+	}
+	passed = submit("It is used for illustrative examples in documents.", "")
+	if passed == nil || passed.NextReviewAt == nil || passed.NextReviewAt.Before(before.AddDate(0, 0, 6)) {
+		t.Fatalf("expected the question due again in six days, got %+v", passed)
+	}
+
+	failed := submit("It is a domain for testing purposes.", "")
+	if failed == nil || failed.Status != "FAIL" || failed.NextReviewAt == nil || failed.NextReviewAt.After(time.Now().AddDate(0, 0, 1)) {
+		t.Fatalf("expected the failed question due again within a day, got %+v", failed)
+	}
+	cards, err := server.Store.ListDueReviewCards(context.Background(), testUserID, time.Now().AddDate(0, 0, 2))
+	if err != nil || len(cards) != 1 || cards[0].Repetitions != 0 || cards[0].Lapses != 1 {
+		t.Errorf("expected the card to start over, got %+v, %v", cards, err)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"expvar"
+	"log"
+
+	"read-robin/config"
+	"read-robin/middleware"
+	"read-robin/services"
+	"read-robin/services/jobs"
+	"read-robin/services/llm"
+	"read-robin/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// Server owns the clients, configuration and logger shared by every HTTP handler.
+// It is built once at startup and its handlers are safe for concurrent use.
+type Server struct {
+	Config   config.Config
+	Store    services.Store
+	LLM      llm.Provider
+	Verifier middleware.TokenVerifier
+	Jobs     *jobs.Queue
+	Logger   *log.Logger
+
+	// Extractions caches extracted content by source; nil disables the cache
+	Extractions services.ExtractionCache
+	// Sources identifies versions of file sources for the extraction cache
+	Sources services.SourceVersioner
+	// Fetcher fetches user-supplied URLs, refusing internal addresses
+	Fetcher *utils.Fetcher
+	// YouTube fetches the metadata and captions of YouTube videos
+	YouTube utils.YouTubeFetcher
+	// Blobs stores uploaded files; nil disables uploads
+	Blobs services.BlobStore
+}
+
+// NewServer creates a Server from already constructed dependencies, without an extraction cache or blob store.
+// A nil logger defaults to the standard logger.
+func NewServer(cfg config.Config, store services.Store, provider llm.Provider, verifier middleware.TokenVerifier, logger *log.Logger) *Server {
+	if logger == nil {
+		logger = log.Default()
+	}
+	fetcher := utils.NewFetcher(utils.FetchPolicy{
+		Timeout:       cfg.FetchTimeout,
+		MaxBodySize:   int64(cfg.FetchMaxBytes),
+		MaxRedirects:  cfg.FetchMaxRedirects,
+		UserAgent:     cfg.FetchUserAgent,
+		RespectRobots: cfg.FetchRespectRobots,
+		AllowPrivate:  cfg.FetchAllowPrivate,
+	}, nil)
+	s := &Server{
+		Config:   cfg,
+		Store:    store,
+		LLM:      provider,
+		Verifier: verifier,
+		Logger:   logger,
+		Sources:  services.NewRemoteSourceVersioner(fetcher.Client()),
+		Fetcher:  fetcher,
+		YouTube:  utils.NewYouTubeClient(fetcher),
+	}
+	s.Jobs = jobs.NewQueue(store, s.runQuizPipeline, cfg.JobWorkers, logger)
+	if cfg.JobLease > 0 {
+		s.Jobs.Lease = cfg.JobLease
+	}
+	if cfg.JobMaxAttempts > 0 {
+		s.Jobs.MaxAttempts = cfg.JobMaxAttempts
+	}
+	s.Jobs.Sweep = s.expireUploads
+	return s
+}
+
+// Start resumes unfinished jobs and starts the job workers
+func (s *Server) Start(ctx context.Context) error {
+	return s.Jobs.Start(ctx)
+}
+
+// Routes returns a router with every API route and the logging middleware registered.
+// All routes except the home page require authentication.
+func (s *Server) Routes() *mux.Router {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/", HomeHandler).Methods("GET")
+
+	api := r.NewRoute().Subrouter()
+	api.HandleFunc("/submit", s.SubmitHandler).Methods("POST")
+	api.HandleFunc("/submit/stream", s.SubmitStreamHandler).Methods("POST")
+	api.HandleFunc("/uploads", s.CreateUploadHandler).Methods("POST")
+	api.HandleFunc("/uploads/{uploadID}", s.UploadChunkHandler).Methods("PUT")
+	api.HandleFunc("/uploads/{uploadID}", s.GetUploadHandler).Methods("GET")
+	api.HandleFunc("/uploads/{uploadID}", s.DeleteUploadHandler).Methods("DELETE")
+	api.HandleFunc("/podcasts/episodes", s.ListEpisodesHandler).Methods("GET")
+	api.HandleFunc("/jobs/{jobID}", s.GetJobHandler).Methods("GET")
+	api.HandleFunc("/quiz/{contentID}/{quizID}", s.GetQuizHandler).Methods("GET")
+	api.HandleFunc("/submit-response", s.SubmitResponseHandler).Methods("POST")
+	api.HandleFunc("/attempts", s.StartAttemptHandler).Methods("POST")
+	api.HandleFunc("/attempts", s.ListAttemptsHandler).Methods("GET")
+	api.HandleFunc("/attempts/{attemptID}", s.GetAttemptHandler).Methods("GET")
+	api.HandleFunc("/attempts/{attemptID}/finish", s.FinishAttemptHandler).Methods("POST")
+	api.HandleFunc("/regenerate-quiz", s.RegenerateQuizHandler).Methods("POST")
+	api.HandleFunc("/review/due", s.ReviewDueHandler).Methods("GET")
+	api.HandleFunc("/content/{contentID}/shared-with", s.ShareContentHandler).Methods("PUT")
+	api.HandleFunc("/content", s.ListContentHandler).Methods("GET")
+	api.HandleFunc("/content/{contentID}", s.GetContentHandler).Methods("GET")
+	api.HandleFunc("/content/{contentID}", s.UpdateContentHandler).Methods("PATCH")
+	api.HandleFunc("/content/{contentID}", s.DeleteContentHandler).Methods("DELETE")
+	api.HandleFunc("/content/{contentID}/quizzes/{quizID}", s.DeleteQuizHandler).Methods("DELETE")
+	api.Use(middleware.AuthMiddleware(s.Verifier))
+
+	r.Use(middleware.LoggingMiddleware)
+
+	return r
+}
+
+// DebugRoutes returns the router of the debug listener, which publishes process internals such as the
+// command line, memory statistics and LLM retry counters, and so is served apart from the API
+func DebugRoutes() *mux.Router {
+	r := mux.NewRouter()
+	r.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+	return r
+}
+
+// Close stops the job workers and releases the store and LLM provider
+func (s *Server) Close() error {
+	s.Jobs.Stop()
+	storeErr := s.Store.Close()
+	llmErr := s.LLM.Close()
+	if storeErr != nil {
+		return storeErr
+	}
+	return llmErr
+}
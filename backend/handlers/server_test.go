@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServerRoutes(t *testing.T) {
+	server := newTestServer(t)
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	testCases := []struct {
+		method             string
+		path               string
+		userID             string
+		expectedStatusCode int
+	}{
+		{"GET", "/", "", http.StatusOK},
+		{"GET", "/quiz/missing/0001", "", http.StatusUnauthorized},
+		{"GET", "/quiz/missing/0001", testUserID, http.StatusNotFound},
+		{"GET", "/submit", testUserID, http.StatusMethodNotAllowed},
+		{"GET", "/unknown", testUserID, http.StatusNotFound},
+		{"GET", "/uploads/missing", "", http.StatusUnauthorized},
+		{"GET", "/uploads/missing", testUserID, http.StatusNotFound},
+		{"GET", "/podcasts/episodes", "", http.StatusUnauthorized},
+		{"GET", "/debug/vars", testUserID, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, ts.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.userID != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.userID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: request failed: %v", tc.method, tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.expectedStatusCode {
+			t.Errorf("%s %s: got status %v want %v", tc.method, tc.path, resp.StatusCode, tc.expectedStatusCode)
+		}
+	}
+}
+
+func TestDebugRoutes(t *testing.T) {
+	responseRecorder := httptest.NewRecorder()
+	DebugRoutes().ServeHTTP(responseRecorder, httptest.NewRequest("GET", "/debug/vars", nil))
+	if responseRecorder.Code != http.StatusOK || !strings.Contains(responseRecorder.Body.String(), "memstats") {
+		t.Errorf("expected the debug listener to serve the published variables, got %v", responseRecorder.Code)
+	}
+}
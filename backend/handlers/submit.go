@@ -1,36 +1,45 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"read-robin/models"
 	"read-robin/services"
-	"read-robin/services/gemini"
+	"read-robin/services/jobs"
 	"read-robin/utils"
-
-	"golang.org/x/net/context"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"strings"
 )
 
 // SubmitRequest is a struct to hold the URL and persona details submitted by the user
-type SubmitRequest struct {
-	URL         string         `json:"url"`
-	ContentText string         `json:"content_text,omitempty"` // Add ContentText field
-	Persona     models.Persona `json:"persona"`
-	ContentType string         `json:"content_type"`
-}
+type SubmitRequest = models.QuizRequest
+
+const (
+	// multipartMemory is the size of the uploaded parts kept in memory; larger files are spooled to disk
+	multipartMemory = 10 << 20
+	// multipartOverhead allows for the form fields and boundaries around an uploaded file
+	multipartOverhead = 64 << 10
+	// maxRequestText is the most text and captions a submit request may send. The request is kept in its
+	// job's document, which Firestore limits to 1 MiB.
+	maxRequestText = 512 << 10
+)
 
 // SubmitResponse is a struct to hold the response to be sent back to the user
 type SubmitResponse struct {
-	Status      string `json:"status"`
-	URL         string `json:"url"`
-	ContentID   string `json:"content_id"`
-	QuizID      string `json:"quiz_id"`
-	Title       string `json:"title"`
-	ContentText string `json:"content_text"`
-	IsFirstQuiz bool   `json:"is_first_quiz"`
+	Status string `json:"status"`
+	JobID  string `json:"job_id"`
+}
+
+// uploadScheme prefixes the URL recorded for uploaded files, which have no URL of their own
+const uploadScheme = "upload:"
+
+// isUpload reports whether url identifies an uploaded file rather than a URL to fetch
+func isUpload(url string) bool {
+	return strings.HasPrefix(url, uploadScheme)
 }
 
 // decodeSubmitRequest decodes the URL request from the HTTP request
@@ -45,166 +54,262 @@ func decodeSubmitRequest(r *http.Request) (SubmitRequest, error) {
 	}
 }
 
-// normalizeAndGenerateID normalizes the URL and generates a content ID
-func normalizeAndGenerateID(url string) (string, string, error) {
-	normalizedURL, err := utils.NormalizeURL(url)
-	if err != nil {
-		return "", "", err
+// readSubmitRequest decodes userID's submit request, storing a PDF or document sent as the "file" part of a
+// multipart/form-data request as an upload, which the job extracts. The other parts may set the content_type,
+// which is otherwise told from the file, and the persona and options as JSON. A JSON request may instead quiz
+// a file uploaded earlier by its upload_id, and may send the captions of audio or video. YouTube requests must
+// link to a video and podcast requests to a feed, and PDFs, audio and video to an http(s) URL or an object in
+// the service's own bucket.
+func (s *Server) readSubmitRequest(w http.ResponseWriter, r *http.Request, userID string) (SubmitRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		submitRequest, err := decodeSubmitRequest(r)
+		if err == nil && submitRequest.UploadID != "" {
+			err = s.useUpload(r.Context(), &submitRequest, userID)
+		}
+		if err == nil && len(submitRequest.ContentText)+len(submitRequest.Captions) > maxRequestText {
+			err = &pipelineError{"Text is too long", fmt.Errorf("%d bytes of text and captions", len(submitRequest.ContentText)+len(submitRequest.Captions))}
+		}
+		if err == nil && submitRequest.Captions != "" {
+			err = checkCaptions(submitRequest)
+		}
+		if err == nil {
+			err = checkFeedSource(submitRequest)
+		}
+		if err == nil && submitRequest.UploadID == "" {
+			err = s.checkFileSource(submitRequest.ContentType, submitRequest.URL)
+		}
+		return submitRequest, err
 	}
-	contentID := utils.GenerateID(normalizedURL)
-	return normalizedURL, contentID, nil
-}
 
-// createFirestoreClient creates a new Firestore client
-func createFirestoreClient(ctx context.Context) (*services.FirestoreClient, error) {
-	return services.NewFirestoreClient(ctx)
-}
+	var submitRequest SubmitRequest
+	if s.Blobs == nil {
+		return submitRequest, errUploadsDisabled
+	}
+	maxBytes := s.maxPDFBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		return submitRequest, err
+	}
+	defer r.MultipartForm.RemoveAll()
 
-// createGeminiClient creates a new Gemini client
-func createGeminiClient(ctx context.Context) (*gemini.GeminiClient, error) {
-	return gemini.NewGeminiClient(ctx)
-}
+	submitRequest.ContentType = r.FormValue("content_type")
+	for field, dst := range map[string]any{"persona": &submitRequest.Persona, "options": &submitRequest.Options} {
+		if value := r.FormValue(field); value != "" {
+			if err := json.Unmarshal([]byte(value), dst); err != nil {
+				return submitRequest, fmt.Errorf("decoding %s: %v", field, err)
+			}
+		}
+	}
+	if submitRequest.ContentType != "" && !isLocalType(submitRequest.ContentType) {
+		return submitRequest, &pipelineError{"Only PDF files and documents can be uploaded", fmt.Errorf("upload of %s", submitRequest.ContentType)}
+	}
 
-func SubmitHandler(w http.ResponseWriter, r *http.Request) {
-	submitRequest, err := decodeSubmitRequest(r)
+	file, header, err := r.FormFile("file")
 	if err != nil {
-		log.Printf("SubmitHandler: Unable to parse request: %v", err)
-		http.Error(w, "Unable to parse request", http.StatusBadRequest)
-		return
+		return submitRequest, err
 	}
+	defer file.Close()
 
-	log.Printf("SubmitHandler: Received Request: %s", submitRequest)
-
-	ctx := context.Background()
+	body := bufio.NewReaderSize(file, utils.UploadSniffLen)
+	fileType := localMediaType(submitRequest.ContentType)
+	if fileType == "" {
+		// Files of any other type are read as PDFs, and fail as unreadable PDFs
+		head, _ := body.Peek(utils.UploadSniffLen)
+		fileType = utils.DetectUploadType(header.Header.Get("Content-Type"), head, header.Filename)
+		if !isLocalType(fileContentType(fileType)) {
+			fileType = localMediaType("PDF")
+		}
+		submitRequest.ContentType = fileContentType(fileType)
+	}
 
-	geminiClient, err := createGeminiClient(ctx)
+	upload, err := s.storeUpload(r.Context(), "SubmitHandler", userID, header.Filename, fileType, body, maxBytes)
 	if err != nil {
-		log.Printf("SubmitHandler: Error creating Gemini client: %v", err)
-		http.Error(w, "Error creating Gemini client", http.StatusInternalServerError)
-		return
+		return submitRequest, err
 	}
+	submitRequest.UploadID = upload.UploadID
+	submitRequest.URL = uploadScheme + upload.UploadID
+	return submitRequest, nil
+}
 
-	firestoreClient, err := createFirestoreClient(ctx)
+// useUpload points submitRequest at userID's complete upload submitRequest.UploadID, taking the content
+// type from the uploaded file
+func (s *Server) useUpload(ctx context.Context, submitRequest *SubmitRequest, userID string) error {
+	upload, err := s.Store.GetUpload(ctx, submitRequest.UploadID)
+	if errors.Is(err, services.ErrNotFound) || err == nil && upload.OwnerID != userID {
+		return &pipelineError{"Upload not found", fmt.Errorf("upload %s of user %s", submitRequest.UploadID, userID)}
+	}
 	if err != nil {
-		log.Printf("SubmitHandler: Error creating Firestore client: %v", err)
-		http.Error(w, "Error creating Firestore client", http.StatusInternalServerError)
+		return &pipelineError{"Error retrieving upload", err}
+	}
+	if upload.Status != models.UploadStatusComplete {
+		return &pipelineError{"Upload is not complete", fmt.Errorf("upload %s is %s", upload.UploadID, upload.Status)}
+	}
+	submitRequest.ContentType = fileContentType(upload.MediaType)
+	if isLocalType(submitRequest.ContentType) && upload.Size > s.maxPDFBytes() {
+		return &http.MaxBytesError{Limit: s.maxPDFBytes()}
+	}
+	submitRequest.URL = uploadScheme + upload.UploadID
+	submitRequest.ContentText = ""
+	return nil
+}
+
+// discardSubmittedUpload deletes the upload a multipart request stored the file of submitRequest as, for a
+// request that failed before the file was used, logging failures. Uploads chosen by upload_id are kept.
+func (s *Server) discardSubmittedUpload(r *http.Request, handler string, submitRequest SubmitRequest) {
+	if r.MultipartForm == nil || submitRequest.UploadID == "" {
 		return
 	}
+	ctx := context.WithoutCancel(r.Context())
+	upload, err := s.Store.GetUpload(ctx, submitRequest.UploadID)
+	if err == nil {
+		err = s.deleteUpload(ctx, upload)
+	}
+	if err != nil {
+		s.Logger.Printf("%s: Error deleting upload %s: %v", handler, submitRequest.UploadID, err)
+	}
+}
 
-	var normalizedURL string
-	var contentID string
+// checkCaptions rejects captions submitted with anything but audio or video, and captions that cannot be parsed
+func checkCaptions(submitRequest SubmitRequest) error {
+	if submitRequest.ContentType != "Audio" && submitRequest.ContentType != "Video" {
+		return &pipelineError{"Captions can only be submitted with audio or video", fmt.Errorf("captions for %s", submitRequest.ContentType)}
+	}
+	if _, err := utils.ParseCaptions(submitRequest.Captions); err != nil {
+		return &pipelineError{"Invalid captions", err}
+	}
+	return nil
+}
 
-	if submitRequest.ContentType == "Text" {
-		contentID = utils.GenerateID(submitRequest.URL)
-		normalizedURL = submitRequest.URL
-	} else {
-		normalizedURL, contentID, err = normalizeAndGenerateID(submitRequest.URL)
-		if err != nil {
-			log.Printf("SubmitHandler: Error normalizing URL: %v", err)
-			http.Error(w, "Error normalizing URL", http.StatusInternalServerError)
-			return
+// checkFeedSource rejects YouTube requests whose URL is not a video and podcast requests without a feed URL
+func checkFeedSource(submitRequest SubmitRequest) error {
+	switch submitRequest.ContentType {
+	case "YouTube":
+		if _, ok := utils.YouTubeVideoID(submitRequest.URL); !ok {
+			return &pipelineError{"Not a YouTube video URL", fmt.Errorf("url %q", submitRequest.URL)}
+		}
+	case "Podcast":
+		if !isHTTPURL(submitRequest.URL) {
+			return &pipelineError{"Podcast feed URL is required", fmt.Errorf("url %q", submitRequest.URL)}
 		}
 	}
+	return nil
+}
 
-	existingQuizzes, err := firestoreClient.GetExistingQuizzes(ctx, contentID)
-	isFirstQuiz := false
+// checkFileSource rejects PDF, audio and video URLs the model should not be pointed at: anything but http(s)
+// URLs and gs:// objects in the bucket of the blob store, so a request cannot read server files or other buckets
+func (s *Server) checkFileSource(contentType, url string) error {
+	switch contentType {
+	case "PDF", "Audio", "Video":
+	default:
+		return nil
+	}
+	if isHTTPURL(url) || s.Config.BlobBucket != "" && strings.HasPrefix(url, "gs://"+s.Config.BlobBucket+"/") {
+		return nil
+	}
+	return &pipelineError{"File URL must be http(s) or in the service's bucket", fmt.Errorf("%s at %q", contentType, url)}
+}
+
+// maxPDFBytes returns the size limit of PDFs and documents extracted locally, which are read into memory,
+// the same as of fetched pages
+func (s *Server) maxPDFBytes() int64 {
+	if s.Config.FetchMaxBytes <= 0 {
+		return utils.DefaultFetchPolicy.MaxBodySize
+	}
+	return int64(s.Config.FetchMaxBytes)
+}
+
+// submitRequestError returns the client-facing message and status for a submit request that could not be read
+func submitRequestError(err error) (string, int) {
+	var tooLarge *http.MaxBytesError
+	var parseErr *pipelineError
+	switch {
+	case isModelUnavailable(err):
+		return modelUnavailableMessage, http.StatusServiceUnavailable
+	case isInvalidModelResponse(err):
+		return invalidModelResponseMessage, http.StatusBadGateway
+	case errors.As(err, &tooLarge):
+		return "Uploaded file is too large", http.StatusRequestEntityTooLarge
+	case errors.Is(err, errUploadsDisabled):
+		return "File uploads are disabled", http.StatusNotImplemented
+	case errors.Is(err, errUploadNotStored):
+		return "Error storing file", http.StatusInternalServerError
+	case errors.As(err, &parseErr):
+		return parseErr.UserMessage(), http.StatusBadRequest
+	}
+	return "Unable to parse request", http.StatusBadRequest
+}
+
+// normalizeAndGenerateID normalizes the URL and generates the ID of ownerID's content for it
+func normalizeAndGenerateID(ownerID, url string) (string, string, error) {
+	normalizedURL, err := utils.NormalizeURL(url)
 	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			existingQuizzes = []models.Quiz{}
-			isFirstQuiz = true
-		} else {
-			log.Printf("SubmitHandler: Error fetching existing quizzes: %v", err)
-			http.Error(w, "Error fetching existing quizzes", http.StatusInternalServerError)
-			return
-		}
+		return "", "", err
 	}
+	contentID := utils.GenerateContentID(ownerID, normalizedURL)
+	return normalizedURL, contentID, nil
+}
 
-	var quizContentMap map[string]interface{}
-	var contentMap map[string]string
+// SubmitHandler queues a job that extracts content from the submitted source, generates a quiz and saves it
+func (s *Server) SubmitHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "SubmitHandler")
+	if !ok {
+		return
+	}
 
-	switch submitRequest.ContentType {
-	case "URL":
-		htmlContent, err := utils.FetchHTML(submitRequest.URL)
-		if err != nil {
-			log.Printf("SubmitHandler: Error fetching HTML content: %v", err)
-			http.Error(w, "Error fetching HTML content", http.StatusInternalServerError)
-			return
+	submitRequest, err := s.readSubmitRequest(w, r, userID)
+	if err != nil {
+		s.Logger.Printf("SubmitHandler: Unable to parse request: %v", err)
+		message, status := submitRequestError(err)
+		http.Error(w, message, status)
+		return
+	}
+	submitRequest.OwnerID = userID
+	queued := false
+	defer func() {
+		if !queued {
+			s.discardSubmittedUpload(r, "SubmitHandler", submitRequest)
 		}
+	}()
 
-		quizContentMap, contentMap, err = geminiClient.ExtractAndGenerateQuizFromHtml(ctx, htmlContent, submitRequest.Persona)
-		if err != nil {
-			log.Printf("SubmitHandler: Error generating quiz content: %v", err)
-			http.Error(w, "Error generating quiz content", http.StatusInternalServerError)
-			return
-		}
-	case "PDF":
-		quizContentMap, contentMap, err = geminiClient.ExtractAndGenerateQuizFromPdf(ctx, submitRequest.URL, submitRequest.Persona)
-		if err != nil {
-			log.Printf("SubmitHandler: Error generating quiz content from PDF: %v", err)
-			http.Error(w, "Error generating quiz content from PDF", http.StatusInternalServerError)
-			return
-		}
-	case "Audio":
-		quizContentMap, contentMap, err = geminiClient.ExtractAndGenerateQuizFromAudio(ctx, submitRequest.URL, submitRequest.Persona)
-		if err != nil {
-			log.Printf("SubmitHandler: Error generating quiz content from Audio: %v", err)
-			http.Error(w, "Error generating quiz content from Audio", http.StatusInternalServerError)
-			return
-		}
-	case "Video":
-		quizContentMap, contentMap, err = geminiClient.ExtractAndGenerateQuizFromVideo(ctx, submitRequest.URL, submitRequest.Persona)
-		if err != nil {
-			log.Printf("SubmitHandler: Error generating quiz content from Video: %v", err)
-			http.Error(w, "Error generating quiz content from Video", http.StatusInternalServerError)
-			return
-		}
-	case "Text":
-		quizContentMap, contentMap, err = geminiClient.GenerateQuizFromText(ctx, submitRequest.URL, submitRequest.ContentText, submitRequest.Persona)
-		if err != nil {
-			log.Printf("SubmitHandler: Error generating quiz content from text: %v", err)
-			http.Error(w, "Error generating quiz content from text", http.StatusInternalServerError)
-			return
-		}
-	default:
-		log.Printf("SubmitHandler: Unsupported content type: %v", submitRequest.ContentType)
+	s.Logger.Printf("SubmitHandler: Received %s request for %s", submitRequest.ContentType, submitRequest.URL)
+
+	if !supportedContentTypes[submitRequest.ContentType] {
+		s.Logger.Printf("SubmitHandler: Unsupported content type: %v", submitRequest.ContentType)
 		http.Error(w, "Unsupported content type", http.StatusBadRequest)
 		return
 	}
 
-	title := contentMap["title"]
-	contentText := contentMap["content"]
-	latestQuizID := services.GetLatestQuizID(existingQuizzes)
-
-	quiz, err := utils.ParseQuizResponse(quizContentMap, latestQuizID)
-	if err != nil {
-		log.Printf("SubmitHandler: Error parsing quiz response: %v", err)
-		http.Error(w, "Error parsing quiz response", http.StatusInternalServerError)
+	if err := utils.ValidateQuizOptions(submitRequest.Options); err != nil {
+		s.Logger.Printf("SubmitHandler: Invalid quiz options: %v", err)
+		http.Error(w, "Invalid quiz options: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = firestoreClient.SaveQuiz(ctx, normalizedURL, title, contentText, quiz)
+	job, err := s.Jobs.Submit(r.Context(), submitRequest)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		s.Logger.Printf("SubmitHandler: Error queuing job: %v", err)
+		http.Error(w, "Too many pending quiz requests, try again later", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
-		log.Printf("SubmitHandler: Error saving quiz to Firestore: %v", err)
-		http.Error(w, "Error saving quiz to Firestore", http.StatusInternalServerError)
+		s.Logger.Printf("SubmitHandler: Error queuing job: %v", err)
+		http.Error(w, "Error queuing job", http.StatusInternalServerError)
 		return
 	}
+	queued = true
 
 	response := SubmitResponse{
-		Status:      "success",
-		URL:         normalizedURL,
-		ContentID:   contentID,
-		QuizID:      latestQuizID,
-		Title:       title,
-		ContentText: contentText,
-		IsFirstQuiz: isFirstQuiz,
+		Status: job.Status,
+		JobID:  job.JobID,
 	}
 
-	log.Printf("SubmitHandler: Response - %v\n", response)
+	s.Logger.Printf("SubmitHandler: Response - %v\n", response)
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+job.JobID)
+	w.WriteHeader(http.StatusAccepted)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("SubmitHandler: Error encoding response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		s.Logger.Printf("SubmitHandler: Error encoding response: %v", err)
 	}
-	log.Println("SubmitHandler: Response sent successfully")
 }
@@ -1,123 +1,211 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 	"read-robin/models"
-	"read-robin/services"
-	"read-robin/services/gemini"
-
-	"golang.org/x/net/context"
+	"read-robin/utils"
+	"strings"
+	"time"
 )
 
 type ResponseSubmission struct {
-	ContentID    string `json:"content_id"`
-	QuizID       string `json:"quiz_id"`
-	QuestionID   string `json:"question_id"`
-	UserResponse string `json:"user_response"`
+	ContentID    string   `json:"content_id"`
+	QuizID       string   `json:"quiz_id"`
+	QuestionID   string   `json:"question_id"`
+	UserResponse string   `json:"user_response"`
+	AttemptID    string   `json:"attempt_id,omitempty"` // Attempt the reviewed response is recorded in, if any
+	Blanks       []string `json:"blanks,omitempty"`     // Responses to each blank of a fill-in-the-blank question
+	Rating       string   `json:"rating,omitempty"`     // How hard a correct answer felt: hard, good (the default) or easy
+	// ChoiceIndex is the zero-based index of the chosen answer to a multiple-choice question, sent instead of its text
+	ChoiceIndex *int `json:"choice_index,omitempty"`
+}
+
+// answers returns the submitted responses, one per blank for fill-in-the-blank questions
+func (rs ResponseSubmission) answers() []string {
+	if len(rs.Blanks) > 0 {
+		return rs.Blanks
+	}
+	return []string{rs.UserResponse}
+}
+
+// recordedAnswer returns the response to question recorded in an attempt, the text of the choice chosen by its index
+// for multiple-choice questions
+func (rs ResponseSubmission) recordedAnswer(question *models.Question) string {
+	if rs.ChoiceIndex != nil && question.MultipleChoice != nil && *rs.ChoiceIndex >= 0 && *rs.ChoiceIndex < len(question.MultipleChoice.Choices) {
+		return question.MultipleChoice.Choices[*rs.ChoiceIndex]
+	}
+	return strings.Join(rs.answers(), ", ")
 }
 
 type ReviewResponse struct {
-	Status      string `json:"status"`
-	Explanation string `json:"explanation"`
+	Status       string     `json:"status"`
+	Explanation  string     `json:"explanation"`
+	NextReviewAt *time.Time `json:"next_review_at,omitempty"` // When the question is next due for review
 }
 
-func SubmitResponseHandler(w http.ResponseWriter, r *http.Request) {
+// SubmitResponseHandler reviews a user's response to a single quiz question, recording it in the user's
+// attempt if one is given and scheduling the question's next review
+func (s *Server) SubmitResponseHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "SubmitResponseHandler")
+	if !ok {
+		return
+	}
+
 	var responseSubmission ResponseSubmission
 	if err := json.NewDecoder(r.Body).Decode(&responseSubmission); err != nil {
-		log.Printf("SubmitResponseHandler: Unable to parse request: %v", err)
+		s.Logger.Printf("SubmitResponseHandler: Unable to parse request: %v", err)
 		http.Error(w, "Unable to parse request", http.StatusBadRequest)
 		return
 	}
-
-	ctx := context.Background()
-
-	// Create Firestore client
-	firestoreClient, err := services.NewFirestoreClient(ctx)
-	if err != nil {
-		log.Printf("SubmitResponseHandler: Error creating Firestore client: %v", err)
-		http.Error(w, "Error creating Firestore client", http.StatusInternalServerError)
+	if err := utils.ValidateRating(responseSubmission.Rating); err != nil {
+		s.Logger.Printf("SubmitResponseHandler: Invalid rating: %v", err)
+		http.Error(w, "Invalid rating: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Fetch the content from Firestore
-	content, err := firestoreClient.GetContent(ctx, responseSubmission.ContentID)
-	if err != nil {
-		log.Printf("SubmitResponseHandler: Error fetching content: %v", err)
-		http.Error(w, "Error fetching content", http.StatusInternalServerError)
+	ctx := r.Context()
+
+	// Fetch the content from the store, checking the user may read it
+	content, ok := s.authorizeContent(w, r, "SubmitResponseHandler", responseSubmission.ContentID, userID, false)
+	if !ok {
 		return
 	}
 
-	// Find the specific quiz
-	var quiz *models.Quiz
-	for _, q := range content.Quizzes {
-		if q.QuizID == responseSubmission.QuizID {
-			quiz = &q
-			break
+	// Check the attempt before spending a review on it
+	if responseSubmission.AttemptID != "" {
+		attempt, ok := s.loadAttempt(w, r, "SubmitResponseHandler", responseSubmission.AttemptID, userID)
+		if !ok {
+			return
+		}
+		if attempt.ContentID != content.ContentID || attempt.QuizID != responseSubmission.QuizID {
+			s.Logger.Printf("SubmitResponseHandler: Attempt %s is not for quiz %s/%s", attempt.AttemptID, responseSubmission.ContentID, responseSubmission.QuizID)
+			http.Error(w, "Attempt is for a different quiz", http.StatusBadRequest)
+			return
+		}
+		if attempt.Status == models.AttemptStatusFinished {
+			http.Error(w, "Attempt is already finished", http.StatusConflict)
+			return
 		}
 	}
+
+	// Find the specific quiz
+	quiz := findQuiz(content, responseSubmission.QuizID)
 	if quiz == nil {
-		log.Printf("SubmitResponseHandler: Quiz not found")
+		s.Logger.Printf("SubmitResponseHandler: Quiz not found")
 		http.Error(w, "Quiz not found", http.StatusNotFound)
 		return
 	}
 
 	// Find the specific question
-	var question *models.Question
-	for _, q := range quiz.Questions {
-		if q.QuestionID == responseSubmission.QuestionID {
-			question = &q
-			break
-		}
-	}
+	question := findQuestion(quiz, responseSubmission.QuestionID)
 	if question == nil {
-		log.Printf("SubmitResponseHandler: Question not found")
+		s.Logger.Printf("SubmitResponseHandler: Question not found")
 		http.Error(w, "Question not found", http.StatusNotFound)
 		return
 	}
 
-	// Create Gemini client
-	geminiClient, err := gemini.NewGeminiClient(ctx)
-	if err != nil {
-		log.Printf("SubmitResponseHandler: Error creating Gemini client: %v", err)
-		http.Error(w, "Error creating Gemini client", http.StatusInternalServerError)
-		return
+	// Objective questions are graded locally; free text needs the LLM
+	var status, explanation string
+	var err error
+	if utils.IsObjective(*question) {
+		status, explanation, err = utils.GradeResponse(*question, responseSubmission.answers(), responseSubmission.ChoiceIndex)
+		if errors.Is(err, utils.ErrInvalidResponse) {
+			s.Logger.Printf("SubmitResponseHandler: Invalid response: %v", err)
+			http.Error(w, "Invalid response for question type", http.StatusBadRequest)
+			return
+		}
+	} else {
+		status, explanation, err = s.reviewResponse(ctx, question, responseSubmission.UserResponse, content.ContentText)
 	}
-
-	// Prepare data for Gemini
-	reviewData := map[string]string{
-		"question":        question.Question,
-		"user_response":   responseSubmission.UserResponse,
-		"expected_answer": question.Answer,
-		"reference":       question.Reference,
-		"content_text":    content.ContentText,
+	if isInvalidModelResponse(err) {
+		s.Logger.Printf("SubmitResponseHandler: Error decoding review: %v", err)
+		http.Error(w, invalidModelResponseMessage, http.StatusBadGateway)
+		return
 	}
-
-	reviewDataJSON, err := json.Marshal(reviewData)
-	if err != nil {
-		log.Printf("SubmitResponseHandler: Error marshaling review data: %v", err)
-		http.Error(w, "Error preparing review data", http.StatusInternalServerError)
+	if isModelUnavailable(err) {
+		s.Logger.Printf("SubmitResponseHandler: Error reviewing response: %v", err)
+		http.Error(w, modelUnavailableMessage, http.StatusServiceUnavailable)
 		return
 	}
-
-	// Call Gemini LLM for review
-	status, explanation, err := geminiClient.ReviewResponse(ctx, string(reviewDataJSON))
 	if err != nil {
-		log.Printf("SubmitResponseHandler: Error reviewing response: %v", err)
+		s.Logger.Printf("SubmitResponseHandler: Error reviewing response: %v", err)
 		http.Error(w, "Error reviewing response", http.StatusInternalServerError)
 		return
 	}
 
+	if responseSubmission.AttemptID != "" {
+		response := models.AttemptResponse{
+			QuestionID:   question.QuestionID,
+			UserResponse: responseSubmission.recordedAnswer(question),
+			Status:       status,
+			Explanation:  explanation,
+			SubmittedAt:  time.Now(),
+		}
+		_, err := s.Store.UpdateAttempt(ctx, responseSubmission.AttemptID, func(attempt *models.Attempt) error {
+			return recordResponse(attempt, response)
+		})
+		if errors.Is(err, errAttemptFinished) {
+			http.Error(w, "Attempt is already finished", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			s.Logger.Printf("SubmitResponseHandler: Error recording response: %v", err)
+			http.Error(w, "Error recording response", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Return the review result to the frontend
 	reviewResponse := ReviewResponse{
 		Status:      status,
 		Explanation: explanation,
 	}
 
+	// A failure to schedule the review should not cost the user their answer's result
+	card, err := s.scheduleReview(ctx, userID, content.ContentID, quiz.QuizID, question.QuestionID, responseSubmission.Rating, status, time.Now())
+	if err != nil {
+		s.Logger.Printf("SubmitResponseHandler: Error scheduling review: %v", err)
+	} else {
+		reviewResponse.NextReviewAt = &card.DueAt
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(reviewResponse); err != nil {
-		log.Printf("SubmitResponseHandler: Error encoding response: %v", err)
+		s.Logger.Printf("SubmitResponseHandler: Error encoding response: %v", err)
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
 }
+
+// scheduleReview records the reviewed response in the user's review card for the question and schedules
+// its next review
+func (s *Server) scheduleReview(ctx context.Context, userID, contentID, quizID, questionID, rating, status string, now time.Time) (*models.ReviewCard, error) {
+	quality, err := utils.ReviewQuality(status, rating)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.UpdateReviewCard(ctx, userID, contentID, quizID, questionID, func(card *models.ReviewCard) error {
+		utils.ScheduleReview(card, quality, now)
+		return nil
+	})
+}
+
+// reviewResponse asks the LLM to review a response to a free text question
+func (s *Server) reviewResponse(ctx context.Context, question *models.Question, userResponse, contentText string) (string, string, error) {
+	reviewData := map[string]string{
+		"question":        question.Question,
+		"user_response":   userResponse,
+		"expected_answer": question.Answer,
+		"reference":       question.Reference,
+		"content_text":    contentText,
+	}
+
+	reviewDataJSON, err := json.Marshal(reviewData)
+	if err != nil {
+		return "", "", fmt.Errorf("error marshaling review data: %w", err)
+	}
+	return s.LLM.ReviewResponse(ctx, string(reviewDataJSON))
+}
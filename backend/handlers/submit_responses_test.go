@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"read-robin/models"
+	"read-robin/services/llm"
+	"read-robin/utils"
+)
+
+func TestSubmitResponseHandler(t *testing.T) {
+	server := newTestServer(t)
+
+	contentURL := "https://example.com/submit-response-handler"
+	quiz := seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	question := quiz.Questions[0]
+
+	testCases := []struct {
+		name               string
+		questionID         string
+		userResponse       string
+		expectedStatusCode int
+		expectedStatus     string
+	}{
+		{
+			name:               "Passing response",
+			questionID:         question.QuestionID,
+			userResponse:       "It is used for illustrative examples in documents.",
+			expectedStatusCode: http.StatusOK,
+			expectedStatus:     "PASS",
+		},
+		{
+			name:               "Failing response",
+			questionID:         question.QuestionID,
+			userResponse:       "It is a domain for testing purposes.",
+			expectedStatusCode: http.StatusOK,
+			expectedStatus:     "FAIL",
+		},
+		{
+			name:               "Unknown question",
+			questionID:         "9999",
+			userResponse:       "Anything",
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := json.Marshal(ResponseSubmission{
+				ContentID:    utils.GenerateContentID(testUserID, contentURL),
+				QuizID:       quiz.QuizID,
+				QuestionID:   tc.questionID,
+				UserResponse: tc.userResponse,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			postRequest, err := http.NewRequest("POST", "/submit-response", bytes.NewBuffer(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			http.HandlerFunc(server.SubmitResponseHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+
+			if statusCode := responseRecorder.Code; statusCode != tc.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", statusCode, tc.expectedStatusCode)
+			}
+			if tc.expectedStatusCode != http.StatusOK {
+				return
+			}
+
+			var reviewResponse ReviewResponse
+			if err := json.NewDecoder(responseRecorder.Body).Decode(&reviewResponse); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if reviewResponse.Status != tc.expectedStatus {
+				t.Errorf("handler returned unexpected status: got %v want %v", reviewResponse.Status, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+// noReviewProvider fails the test if a response is sent to the LLM for review
+type noReviewProvider struct {
+	*llm.FakeProvider
+	t *testing.T
+}
+
+func (p noReviewProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	p.t.Errorf("ReviewResponse called for an objective question: %s", reviewData)
+	return "", "", errors.New("unexpected review")
+}
+
+func TestSubmitResponseHandler_GradesObjectiveQuestionsLocally(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = noReviewProvider{llm.NewFakeProvider(), t}
+
+	contentURL := "https://example.com/objective"
+	quiz := models.Quiz{
+		QuizID: "0001",
+		Questions: []models.Question{
+			{QuestionID: "0001", Type: models.QuestionTypeMultipleChoice, Question: "What is it for?", Answer: "Examples", Reference: "R",
+				MultipleChoice: &models.MultipleChoice{Choices: []string{"Shopping", "Examples"}, CorrectIndex: 1}},
+			{QuestionID: "0002", Type: models.QuestionTypeTrueFalse, Question: "It is for shopping.", Answer: "false", Reference: "R",
+				TrueFalse: &models.TrueFalse{Answer: false}},
+			{QuestionID: "0003", Type: models.QuestionTypeFillInBlank, Question: "Fill in the blanks.", Answer: "illustrative, documents", Reference: "R",
+				FillInBlank: &models.FillInBlank{Text: "It is for ___ examples in ___.", Blanks: []string{"illustrative", "documents"}}},
+		},
+	}
+	if _, err := server.Store.SaveQuiz(context.Background(), models.Content{OwnerID: testUserID, URL: contentURL, Title: "Example", ContentText: "Example text"}, quiz); err != nil {
+		t.Fatalf("Failed to save quiz: %v", err)
+	}
+	contentID := utils.GenerateContentID(testUserID, contentURL)
+	correctChoice, missingChoice := 1, 2
+
+	testCases := []struct {
+		name               string
+		submission         ResponseSubmission
+		expectedStatusCode int
+		expectedStatus     string
+	}{
+		{"Correct choice", ResponseSubmission{QuestionID: "0001", ChoiceIndex: &correctChoice}, http.StatusOK, "PASS"},
+		{"Wrong choice", ResponseSubmission{QuestionID: "0001", UserResponse: "Shopping"}, http.StatusOK, "FAIL"},
+		{"Choice out of range", ResponseSubmission{QuestionID: "0001", ChoiceIndex: &missingChoice}, http.StatusBadRequest, ""},
+		{"True/false", ResponseSubmission{QuestionID: "0002", UserResponse: "false"}, http.StatusOK, "PASS"},
+		{"Blanks", ResponseSubmission{QuestionID: "0003", Blanks: []string{"Illustrative", "documents"}}, http.StatusOK, "PASS"},
+		{"Invalid boolean", ResponseSubmission{QuestionID: "0002", UserResponse: "perhaps"}, http.StatusBadRequest, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.submission.ContentID = contentID
+			tc.submission.QuizID = "0001"
+			payload, err := json.Marshal(tc.submission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			responseRecorder := serveAs(t, server, testUserID, "POST", "/submit-response", payload)
+			if statusCode := responseRecorder.Code; statusCode != tc.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", statusCode, tc.expectedStatusCode)
+			}
+			if tc.expectedStatusCode != http.StatusOK {
+				return
+			}
+
+			var reviewResponse ReviewResponse
+			if err := json.NewDecoder(responseRecorder.Body).Decode(&reviewResponse); err != nil {
+				t.Fatalf("failed to parse response body: %v", err)
+			}
+			if reviewResponse.Status != tc.expectedStatus {
+				t.Errorf("handler returned unexpected status: got %v want %v", reviewResponse.Status, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestSubmitResponseHandler_InvalidReview(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = invalidJSONProvider{llm.NewFakeProvider()}
+
+	contentURL := "https://example.com/invalid-review"
+	quiz := seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	payload, err := json.Marshal(ResponseSubmission{
+		ContentID:    utils.GenerateContentID(testUserID, contentURL),
+		QuizID:       quiz.QuizID,
+		QuestionID:   quiz.Questions[0].QuestionID,
+		UserResponse: "It is used for examples.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/submit-response", payload)
+	if responseRecorder.Code != http.StatusBadGateway {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusBadGateway)
+	}
+}
+
+func TestSubmitResponseHandler_ModelUnavailable(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = unavailableProvider{llm.NewFakeProvider()}
+
+	contentURL := "https://example.com/model-unavailable"
+	quiz := seedQuiz(t, server, contentURL, "Example Domain", "Example text", "0001")
+	payload, err := json.Marshal(ResponseSubmission{
+		ContentID:    utils.GenerateContentID(testUserID, contentURL),
+		QuizID:       quiz.QuizID,
+		QuestionID:   quiz.Questions[0].QuestionID,
+		UserResponse: "It is used for examples.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := serveAs(t, server, testUserID, "POST", "/submit-response", payload)
+	if responseRecorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", responseRecorder.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"read-robin/models"
+	"read-robin/services/jobs"
+	"read-robin/utils"
+)
+
+// StageEvent is the data of a "stage" event sent by SubmitStreamHandler
+type StageEvent struct {
+	Stage    string `json:"stage"`
+	Progress int    `json:"progress"`
+}
+
+// ErrorEvent is the data of an "error" event sent by SubmitStreamHandler
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+// sseWriter writes Server-Sent Events to a response, flushing after each event
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEWriter starts an event stream on w, returning false if w cannot stream
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}, true
+}
+
+// send writes an event with data encoded as JSON
+func (sw *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(sw.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	sw.flusher.Flush()
+	return nil
+}
+
+// SubmitStreamHandler runs the quiz pipeline within the request, streaming a "stage" event as each stage
+// starts, a "question" event as each question is generated, and finally a "done" event with the saved
+// quiz or an "error" event
+func (s *Server) SubmitStreamHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "SubmitStreamHandler")
+	if !ok {
+		return
+	}
+
+	submitRequest, err := s.readSubmitRequest(w, r, userID)
+	if err != nil {
+		s.Logger.Printf("SubmitStreamHandler: Unable to parse request: %v", err)
+		message, status := submitRequestError(err)
+		http.Error(w, message, status)
+		return
+	}
+	submitRequest.OwnerID = userID
+	saved := false
+	defer func() {
+		if !saved {
+			s.discardSubmittedUpload(r, "SubmitStreamHandler", submitRequest)
+		}
+	}()
+
+	s.Logger.Printf("SubmitStreamHandler: Received %s request for %s", submitRequest.ContentType, submitRequest.URL)
+
+	if !supportedContentTypes[submitRequest.ContentType] {
+		s.Logger.Printf("SubmitStreamHandler: Unsupported content type: %v", submitRequest.ContentType)
+		http.Error(w, "Unsupported content type", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.ValidateQuizOptions(submitRequest.Options); err != nil {
+		s.Logger.Printf("SubmitStreamHandler: Invalid quiz options: %v", err)
+		http.Error(w, "Invalid quiz options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream, ok := newSSEWriter(w)
+	if !ok {
+		s.Logger.Printf("SubmitStreamHandler: Response writer does not support streaming")
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	report := func(stage string) {
+		if err := stream.send("stage", StageEvent{Stage: stage, Progress: jobs.StageProgress(stage)}); err != nil {
+			s.Logger.Printf("SubmitStreamHandler: Error sending stage event: %v", err)
+		}
+	}
+	onQuestion := func(question models.Question) error {
+		return stream.send("question", question)
+	}
+
+	result, err := s.streamQuizPipeline(r.Context(), submitRequest, report, onQuestion)
+	if err != nil {
+		s.Logger.Printf("SubmitStreamHandler: Error generating quiz: %v", err)
+		if err := stream.send("error", ErrorEvent{Error: jobs.ErrorMessage(err)}); err != nil {
+			s.Logger.Printf("SubmitStreamHandler: Error sending error event: %v", err)
+		}
+		return
+	}
+	saved = true
+
+	report(models.JobStageDone)
+	if err := stream.send("done", result); err != nil {
+		s.Logger.Printf("SubmitStreamHandler: Error sending done event: %v", err)
+		return
+	}
+	s.Logger.Println("SubmitStreamHandler: Stream completed successfully")
+}
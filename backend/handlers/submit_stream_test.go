@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+// sseEvent is a single parsed Server-Sent Event
+type sseEvent struct {
+	name string
+	data string
+}
+
+// postStream posts payload to /submit/stream through the full router and returns the events it sends
+func postStream(t *testing.T, server *Server, payload SubmitRequest) []sseEvent {
+	t.Helper()
+	ts := httptest.NewServer(server.Routes())
+	defer ts.Close()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", ts.URL+"/submit/stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(asUser(req, testUserID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("handler returned wrong content type: got %v", contentType)
+	}
+
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestSubmitStreamHandler(t *testing.T) {
+	server := newTestServer(t)
+
+	events := postStream(t, server, SubmitRequest{
+		URL:         "Lobster Notes",
+		ContentText: "Lobsters have ten legs. They live on the ocean floor. Some lobsters live for over a century.",
+		ContentType: "Text",
+	})
+
+	var stages []string
+	var questions []models.Question
+	var result models.QuizResult
+	for _, event := range events {
+		switch event.name {
+		case "stage":
+			var stage StageEvent
+			if err := json.Unmarshal([]byte(event.data), &stage); err != nil {
+				t.Fatalf("failed to parse stage event: %v", err)
+			}
+			stages = append(stages, stage.Stage)
+		case "question":
+			var question models.Question
+			if err := json.Unmarshal([]byte(event.data), &question); err != nil {
+				t.Fatalf("failed to parse question event: %v", err)
+			}
+			questions = append(questions, question)
+		case "done":
+			if err := json.Unmarshal([]byte(event.data), &result); err != nil {
+				t.Fatalf("failed to parse done event: %v", err)
+			}
+		default:
+			t.Fatalf("unexpected event %q: %s", event.name, event.data)
+		}
+	}
+
+	expectedStages := []string{models.JobStageGenerating, models.JobStageSaving, models.JobStageDone}
+	if strings.Join(stages, ",") != strings.Join(expectedStages, ",") {
+		t.Errorf("expected stages %v, got %v", expectedStages, stages)
+	}
+	if len(questions) != 3 {
+		t.Fatalf("expected 3 question events, got %d", len(questions))
+	}
+	if events[len(events)-1].name != "done" || result.QuizID != "0001" || !result.IsFirstQuiz {
+		t.Fatalf("expected a final done event for quiz 0001, got %+v", result)
+	}
+
+	// The streamed questions are the ones that were saved
+	quiz, err := server.Store.GetQuiz(context.Background(), result.ContentID, result.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	for i, question := range quiz.Questions {
+		if !reflect.DeepEqual(question, questions[i]) {
+			t.Errorf("expected saved question %+v, got %+v", questions[i], question)
+		}
+	}
+}
+
+func TestSubmitStreamHandler_Error(t *testing.T) {
+	server := newTestServer(t)
+
+	events := postStream(t, server, SubmitRequest{URL: "Empty Notes", ContentText: "", ContentType: "Text"})
+
+	last := events[len(events)-1]
+	if last.name != "error" {
+		t.Fatalf("expected a final error event, got %+v", last)
+	}
+	var errorEvent ErrorEvent
+	if err := json.Unmarshal([]byte(last.data), &errorEvent); err != nil {
+		t.Fatalf("failed to parse error event: %v", err)
+	}
+	if errorEvent.Error != "Error generating quiz content" {
+		t.Errorf("unexpected error message %q", errorEvent.Error)
+	}
+}
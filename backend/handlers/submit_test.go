@@ -2,23 +2,21 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 
 	"read-robin/models"
-
-	"github.com/gorilla/mux"
+	"read-robin/services/llm"
 )
 
 func TestSubmitHandler(t *testing.T) {
-	// Ensure the working directory is the project root
-	err := os.Chdir("..")
-	if err != nil {
-		t.Fatal(err)
-	}
+	server := newTestServer(t)
+	server.Config.BlobBucket = "read-robin-examples"
 
 	// Create test cases for URL and PDF content types
 	testCases := []struct {
@@ -32,21 +30,21 @@ func TestSubmitHandler(t *testing.T) {
 		// 	contentType: "URL",
 		// 	url:         "http://www.example.com",
 		// },
-		// {
-		// 	name:        "PDF content type",
-		// 	contentType: "PDF",
-		// 	url:         "gs://read-robin-examples/pdfs/chemistry_chapter_page.pdf",
-		// },
-		// {
-		// 	name:        "Audio content type",
-		// 	contentType: "Audio",
-		// 	url:         "gs://read-robin-examples/audio/porsche_macan_ad.mp3",
-		// },
-		// {
-		// 	name:        "Video content type",
-		// 	contentType: "Video",
-		// 	url:         "gs://read-robin-examples/video/happiness_a_very_short_story.mp4",
-		// },
+		{
+			name:        "PDF content type",
+			contentType: "PDF",
+			url:         "gs://read-robin-examples/pdfs/chemistry_chapter_page.pdf",
+		},
+		{
+			name:        "Audio content type",
+			contentType: "Audio",
+			url:         "gs://read-robin-examples/audio/porsche_macan_ad.mp3",
+		},
+		{
+			name:        "Video content type",
+			contentType: "Video",
+			url:         "gs://read-robin-examples/video/happiness_a_very_short_story.mp4",
+		},
 		{
 			name:        "Text content type",
 			contentType: "Text",
@@ -89,27 +87,32 @@ func TestSubmitHandler(t *testing.T) {
 			// Create a ResponseRecorder to record the response
 			responseRecorder := httptest.NewRecorder()
 			// Wrap the SubmitHandler function with http.HandlerFunc
-			submitHandler := http.HandlerFunc(SubmitHandler)
+			submitHandler := http.HandlerFunc(server.SubmitHandler)
 
 			// Serve the HTTP request using the handler
-			submitHandler.ServeHTTP(responseRecorder, postRequest)
+			submitHandler.ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
 
-			// Check if the status code returned by the handler is 200 OK
-			if statusCode := responseRecorder.Code; statusCode != http.StatusOK {
-				t.Errorf("handler returned wrong status code: got %v want %v", statusCode, http.StatusOK)
+			// Check if the status code returned by the handler is 202 Accepted
+			if statusCode := responseRecorder.Code; statusCode != http.StatusAccepted {
+				t.Errorf("handler returned wrong status code: got %v want %v", statusCode, http.StatusAccepted)
 				return
 			}
 
 			// Log the full response for debugging
 			t.Logf("Submit response body: %v", responseRecorder.Body.String())
 
-			// Now make a GET request to the /quiz/{contentID}/{quizID} endpoint using the content_id and quiz_id from the response
 			var submitResponse SubmitResponse
 			if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
 				t.Fatalf("failed to parse response body: %v", err)
 			}
 
-			getRequest, err := http.NewRequest("GET", "/quiz/"+submitResponse.ContentID+"/"+submitResponse.QuizID, nil)
+			// Wait for the job to finish, then fetch the quiz it generated
+			job := waitForJob(t, server, submitResponse.JobID)
+			if job.Status != models.JobStatusSucceeded || job.Result == nil {
+				t.Fatalf("job did not succeed: %+v", job)
+			}
+
+			getRequest, err := http.NewRequest("GET", "/quiz/"+job.Result.ContentID+"/"+job.Result.QuizID, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -117,12 +120,11 @@ func TestSubmitHandler(t *testing.T) {
 			// Create a new ResponseRecorder to record the response
 			getResponseRecorder := httptest.NewRecorder()
 
-			// Use mux to set up the router and route variables
-			router := mux.NewRouter()
-			router.HandleFunc("/quiz/{contentID}/{quizID}", GetQuizHandler)
+			// Use the server router to set up route variables
+			router := server.Routes()
 
 			// Serve the HTTP request using the router
-			router.ServeHTTP(getResponseRecorder, getRequest)
+			router.ServeHTTP(getResponseRecorder, asUser(getRequest, testUserID))
 
 			// Check if the status code returned by the handler is 200 OK
 			if statusCode := getResponseRecorder.Code; statusCode != http.StatusOK {
@@ -135,3 +137,224 @@ func TestSubmitHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSubmitHandler_URL(t *testing.T) {
+	server := newTestServer(t)
+
+	// Serve a page locally so the URL flow runs without network access
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>Lobster Facts</title></head><body><p>Lobsters have ten legs. They live on the ocean floor. Some lobsters live for over a century.</p></body></html>"))
+	}))
+	defer ts.Close()
+
+	submitRequestPayloadBytes, err := json.Marshal(SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(submitRequestPayloadBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+
+	if statusCode := responseRecorder.Code; statusCode != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", statusCode, http.StatusAccepted)
+	}
+
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+	if submitResponse.Status != models.JobStatusQueued || submitResponse.JobID == "" {
+		t.Fatalf("handler returned unexpected body: got %+v", submitResponse)
+	}
+
+	job := waitForJob(t, server, submitResponse.JobID)
+	if job.Status != models.JobStatusSucceeded || job.Stage != models.JobStageDone || job.Progress != 100 {
+		t.Fatalf("job did not succeed: %+v", job)
+	}
+	if job.Result.Title != "Lobster Facts" || !job.Result.IsFirstQuiz || job.Result.QuizID != "0001" {
+		t.Errorf("job returned unexpected result: got %+v", job.Result)
+	}
+}
+
+func TestSubmitHandler_FetchError(t *testing.T) {
+	server := newTestServer(t)
+
+	// Close the server straight away so fetching its URL fails
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	submitRequestPayloadBytes, err := json.Marshal(SubmitRequest{URL: ts.URL, ContentType: "URL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(submitRequestPayloadBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	job := waitForJob(t, server, submitResponse.JobID)
+	if job.Status != models.JobStatusFailed || job.Stage != models.JobStageFetching || job.Error != "Error fetching HTML content" {
+		t.Errorf("job returned unexpected state: got %+v", job)
+	}
+}
+
+func TestSubmitHandler_UnsupportedContentType(t *testing.T) {
+	server := newTestServer(t)
+
+	submitRequestPayloadBytes, err := json.Marshal(SubmitRequest{URL: "http://www.example.com", ContentType: "Hologram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(submitRequestPayloadBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+
+	if statusCode := responseRecorder.Code; statusCode != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestSubmitHandler_InvalidQuiz(t *testing.T) {
+	server := newTestServer(t)
+	server.LLM = invalidJSONProvider{llm.NewFakeProvider()}
+
+	payload, err := json.Marshal(SubmitRequest{URL: "Invalid Quiz", ContentType: "Text", ContentText: "Some text to quiz on."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+
+	var submitResponse SubmitResponse
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&submitResponse); err != nil {
+		t.Fatalf("failed to parse response body: %v", err)
+	}
+
+	job := waitForJob(t, server, submitResponse.JobID)
+	if job.Status != models.JobStatusFailed || job.Stage != models.JobStageGenerating || job.Error != invalidModelResponseMessage {
+		t.Errorf("job returned unexpected state: got %+v", job)
+	}
+}
+
+func TestSubmitHandler_LongContent(t *testing.T) {
+	server := newTestServer(t)
+	server.Config.ChunkTokens = 60
+	server.Config.ChunkedQuizQuestions = 6
+
+	var sections []string
+	for _, name := range []string{"Anatomy", "Habitat", "Fishing"} {
+		sections = append(sections, fmt.Sprintf("%s\n\nThe %s of lobsters is described first. More on %s follows here. The %s section ends with this sentence.", name, name, name, name))
+	}
+	job := submitAndWait(t, server, SubmitRequest{URL: "Lobster Guide", ContentType: "Text", ContentText: strings.Join(sections, "\n\n")})
+
+	quiz, err := server.Store.GetQuiz(context.Background(), job.Result.ContentID, job.Result.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: %v", err)
+	}
+	chunks := make(map[int]bool)
+	for _, question := range quiz.Questions {
+		chunks[question.Chunk] = true
+	}
+	if len(quiz.Questions) == 0 || len(quiz.Questions) > 6 || len(chunks) != 3 {
+		t.Errorf("expected up to 6 questions covering 3 chunks, got %d questions from chunks %v", len(quiz.Questions), chunks)
+	}
+}
+
+func TestSubmitHandler_Options(t *testing.T) {
+	server := newTestServer(t)
+	contentText := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue. It weighs ninety tonnes. Lobsters molt to grow."
+
+	options := models.QuizOptions{NumQuestions: 4, QuestionTypes: []string{models.QuestionTypeTrueFalse, models.QuestionTypeFillInBlank}, AvoidTopics: []string{"Shediac"}}
+	job := submitAndWait(t, server, SubmitRequest{URL: "Lobster Options", ContentType: "Text", ContentText: contentText, Options: options})
+	quiz, err := server.Store.GetQuiz(context.Background(), job.Result.ContentID, job.Result.QuizID)
+	if err != nil {
+		t.Fatalf("GetQuiz: %v", err)
+	}
+	if len(quiz.Questions) != 3 {
+		t.Fatalf("expected the question about the avoided topic to be dropped from 4, got %d questions", len(quiz.Questions))
+	}
+	for _, question := range quiz.Questions {
+		if question.Type != models.QuestionTypeTrueFalse && question.Type != models.QuestionTypeFillInBlank {
+			t.Errorf("expected only the requested question types, got %q", question.Type)
+		}
+		if strings.Contains(question.Question, "Shediac") || question.Reference == "" {
+			t.Errorf("expected questions with references that avoid Shediac, got %+v", question)
+		}
+	}
+
+	// A quiz whose every question is rejected fails rather than saving an empty quiz
+	job = waitForJob(t, server, submitJob(t, server, SubmitRequest{URL: "Lobster Avoided", ContentType: "Text", ContentText: "Lobsters live in the ocean.", Options: models.QuizOptions{AvoidTopics: []string{"lobsters"}}}))
+	if job.Status != models.JobStatusFailed || job.Error != noMatchingQuestionsMessage {
+		t.Errorf("job returned unexpected state: got %+v", job)
+	}
+
+	payload, err := json.Marshal(SubmitRequest{URL: "Too Many", ContentType: "Text", ContentText: contentText, Options: models.QuizOptions{NumQuestions: 500}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest, err := http.NewRequest("POST", "/submit", bytes.NewBuffer(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	postRequest.Header.Set("Content-Type", "application/json")
+	responseRecorder := httptest.NewRecorder()
+	http.HandlerFunc(server.SubmitHandler).ServeHTTP(responseRecorder, asUser(postRequest, testUserID))
+	if responseRecorder.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid options: got %v want %v", responseRecorder.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSubmitHandler_TextTooLong(t *testing.T) {
+	server := newTestServer(t)
+	contentText := strings.Repeat("Lobsters have ten legs. ", maxRequestText/24+1)
+	responseRecorder := postSubmit(t, server, SubmitRequest{URL: "Long Notes", ContentType: "Text", ContentText: contentText})
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Text is too long") {
+		t.Errorf("expected text too long to keep in a job to be rejected, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+}
+
+func TestSubmitHandler_RejectsFileSources(t *testing.T) {
+	server := newTestServer(t)
+	server.Config.BlobBucket = "bucket"
+	for _, request := range []SubmitRequest{
+		{URL: "file:///proc/self/environ", ContentType: "PDF"},
+		{URL: "/etc/passwd", ContentType: "PDF"},
+		{URL: "gs://other-bucket/talk.mp3", ContentType: "Audio"},
+		{URL: "gs://bucket-two/talk.mp3", ContentType: "Audio"},
+		{URL: "upload:0123456789abcdef", ContentType: "Video"},
+	} {
+		responseRecorder := postSubmit(t, server, request)
+		if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "File URL must be") {
+			t.Errorf("expected %s at %q to be rejected, got %v: %s", request.ContentType, request.URL, responseRecorder.Code, responseRecorder.Body)
+		}
+	}
+
+	// Objects in the service's own bucket are read by the model
+	submitAndWait(t, server, SubmitRequest{URL: "gs://bucket/talk.mp3", ContentType: "Audio"})
+}
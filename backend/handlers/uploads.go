@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/utils"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultUploadMaxBytes is the size limit of uploads when Config.UploadMaxBytes is not set
+	defaultUploadMaxBytes = 512 << 20
+	// defaultInlineMediaMaxBytes is the size limit of media sent to the model inline when
+	// Config.InlineMediaMaxBytes is not set, below the model's limit on the size of a request
+	defaultInlineMediaMaxBytes = 16 << 20
+	// defaultUploadExpiry is how long a resumable upload may stay pending when Config.UploadExpiry is not set
+	defaultUploadExpiry = 24 * time.Hour
+	// minUploadChunk is the smallest chunk of a resumable upload other than the last
+	minUploadChunk = 256 << 10
+	// uploadBlobPrefix is the blob key prefix of uploaded files and their chunks
+	uploadBlobPrefix = "uploads/"
+)
+
+// errUploadConflict is returned when a chunk does not start where the upload left off
+var errUploadConflict = errors.New("chunk does not continue the upload")
+
+// errUploadsDisabled is returned for a file submitted without a blob store to keep it in
+var errUploadsDisabled = errors.New("file uploads are disabled")
+
+// errUploadNotStored is returned by storeUpload when the file could not be stored
+var errUploadNotStored = errors.New("upload not stored")
+
+// contentRangePattern matches the Content-Range header of a resumable upload chunk
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// StartUploadRequest declares a file to be uploaded in chunks
+type StartUploadRequest struct {
+	Filename  string `json:"filename"`
+	MediaType string `json:"media_type"`
+	Size      int64  `json:"size"`
+}
+
+// CreateUploadHandler uploads a file in the "file" part of a multipart/form-data request, or starts a
+// resumable upload of the file declared by a JSON StartUploadRequest, whose chunks are sent to
+// UploadChunkHandler. PDF, audio and video files are accepted.
+func (s *Server) CreateUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "CreateUploadHandler")
+	if !ok || !s.requireBlobs(w, "CreateUploadHandler") {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		s.uploadFile(w, r, userID)
+	case "application/json":
+		s.startUpload(w, r, userID)
+	default:
+		s.Logger.Printf("CreateUploadHandler: Unsupported request type: %q", mediaType)
+		http.Error(w, "Request must be multipart/form-data or application/json", http.StatusUnsupportedMediaType)
+	}
+}
+
+// uploadFile stores the file part of a multipart request as a complete upload
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, userID string) {
+	maxBytes := s.maxUploadBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.Logger.Printf("CreateUploadHandler: Unable to parse request: %v", err)
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+	var part io.ReadCloser
+	var filename, declared string
+	for {
+		p, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			s.Logger.Printf("CreateUploadHandler: Request has no file part")
+			http.Error(w, "Request has no file part", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.Logger.Printf("CreateUploadHandler: Unable to parse request: %v", err)
+			message, status := submitRequestError(err)
+			http.Error(w, message, status)
+			return
+		}
+		if p.FormName() == "file" {
+			part, filename, declared = p, p.FileName(), p.Header.Get("Content-Type")
+			break
+		}
+	}
+	defer part.Close()
+
+	body := bufio.NewReaderSize(part, utils.UploadSniffLen)
+	head, _ := body.Peek(utils.UploadSniffLen)
+	fileType := utils.DetectUploadType(declared, head, filename)
+	if fileContentType(fileType) == "" {
+		s.Logger.Printf("CreateUploadHandler: Unsupported file type %s of %q", fileType, filename)
+		http.Error(w, "Only PDF, document, audio and video files can be uploaded", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	upload, err := s.storeUpload(r.Context(), "CreateUploadHandler", userID, filename, fileType, body, maxBytes)
+	if err != nil {
+		s.Logger.Printf("CreateUploadHandler: Error storing file: %v", err)
+		s.writeUploadError(w, err)
+		return
+	}
+	s.Logger.Printf("CreateUploadHandler: Stored %d bytes of %s as upload %s", upload.Size, fileType, upload.UploadID)
+	w.Header().Set("Location", "/uploads/"+upload.UploadID)
+	s.writeUpload(w, "CreateUploadHandler", http.StatusCreated, upload)
+}
+
+// storeUpload stores body as userID's complete upload of the file filename of mediaType, returning
+// *http.MaxBytesError if it is larger than maxBytes and errUploadNotStored if it could not be stored
+func (s *Server) storeUpload(ctx context.Context, handler, userID, filename, mediaType string, body io.Reader, maxBytes int64) (*models.Upload, error) {
+	now := time.Now()
+	upload := models.Upload{
+		UploadID:  utils.GenerateUploadID(),
+		OwnerID:   userID,
+		Filename:  filename,
+		MediaType: mediaType,
+		Status:    models.UploadStatusComplete,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	upload.BlobKey = uploadBlobKey(upload)
+	n, err := s.Blobs.Put(ctx, upload.BlobKey, io.LimitReader(body, maxBytes+1))
+	if err == nil && n > maxBytes {
+		s.deleteBlobs(ctx, handler, upload.BlobKey)
+		return nil, &http.MaxBytesError{Limit: maxBytes}
+	}
+	if err != nil {
+		s.deleteBlobs(ctx, handler, upload.BlobKey)
+		return nil, fmt.Errorf("%w: %v", errUploadNotStored, err)
+	}
+	upload.Size, upload.Received = n, n
+
+	if err := s.Store.SaveUpload(ctx, upload); err != nil {
+		s.deleteBlobs(ctx, handler, upload.BlobKey)
+		return nil, fmt.Errorf("%w: saving upload: %v", errUploadNotStored, err)
+	}
+	return &upload, nil
+}
+
+// startUpload creates a pending resumable upload of the declared file
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request, userID string) {
+	var request StartUploadRequest
+	if err := utils.DecodeJSONBody(r, &request); err != nil {
+		s.Logger.Printf("CreateUploadHandler: Unable to parse request: %v", err)
+		http.Error(w, "Unable to parse request", http.StatusBadRequest)
+		return
+	}
+	if request.Size <= 0 {
+		s.Logger.Printf("CreateUploadHandler: Invalid size %d", request.Size)
+		http.Error(w, "size must be positive", http.StatusBadRequest)
+		return
+	}
+	if request.Size > s.maxUploadBytes() {
+		s.Logger.Printf("CreateUploadHandler: Declared size %d is too large", request.Size)
+		http.Error(w, "Uploaded file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	declared := utils.DetectUploadType(request.MediaType, nil, request.Filename)
+	if fileContentType(declared) == "" {
+		s.Logger.Printf("CreateUploadHandler: Unsupported file type %s of %q", declared, request.Filename)
+		http.Error(w, "Only PDF, document, audio and video files can be uploaded", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	now := time.Now()
+	upload := models.Upload{
+		UploadID:  utils.GenerateUploadID(),
+		OwnerID:   userID,
+		Filename:  request.Filename,
+		MediaType: declared,
+		Size:      request.Size,
+		Status:    models.UploadStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.Store.SaveUpload(r.Context(), upload); err != nil {
+		s.Logger.Printf("CreateUploadHandler: Error saving upload: %v", err)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+	s.Logger.Printf("CreateUploadHandler: Started upload %s of %d bytes", upload.UploadID, upload.Size)
+	w.Header().Set("Location", "/uploads/"+upload.UploadID)
+	s.writeUpload(w, "CreateUploadHandler", http.StatusCreated, &upload)
+}
+
+// UploadChunkHandler stores the chunk of a resumable upload in the request body, at the range given by
+// its Content-Range header. A chunk that does not start where the upload left off is rejected with the
+// upload's state, from which the client resumes. The upload is complete once its last byte is received.
+func (s *Server) UploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "UploadChunkHandler")
+	if !ok || !s.requireBlobs(w, "UploadChunkHandler") {
+		return
+	}
+	upload, ok := s.loadUpload(w, r, "UploadChunkHandler", mux.Vars(r)["uploadID"], userID)
+	if !ok {
+		return
+	}
+	if upload.Status == models.UploadStatusComplete {
+		s.writeUpload(w, "UploadChunkHandler", http.StatusOK, upload)
+		return
+	}
+	if upload.Received == upload.Size {
+		// Every chunk arrived but completing the upload failed
+		s.finishUpload(w, r, upload)
+		return
+	}
+
+	start, end, total, err := parseContentRange(r.Header.Get("Content-Range"))
+	if err != nil || total != upload.Size {
+		s.Logger.Printf("UploadChunkHandler: Invalid Content-Range %q: %v", r.Header.Get("Content-Range"), err)
+		http.Error(w, "Content-Range must be bytes start-end/size of the upload", http.StatusBadRequest)
+		return
+	}
+	if start != upload.Received {
+		s.Logger.Printf("UploadChunkHandler: Chunk starts at %d, upload %s is at %d", start, upload.UploadID, upload.Received)
+		s.writeUpload(w, "UploadChunkHandler", http.StatusConflict, upload)
+		return
+	}
+	length := end - start + 1
+	if end+1 < total && length < minUploadChunk {
+		s.Logger.Printf("UploadChunkHandler: Chunk of %d bytes is too small", length)
+		http.Error(w, fmt.Sprintf("Chunks other than the last must be at least %d bytes", minUploadChunk), http.StatusBadRequest)
+		return
+	}
+
+	body := bufio.NewReaderSize(http.MaxBytesReader(w, r.Body, length), utils.UploadSniffLen)
+	fileType := upload.MediaType
+	if start == 0 {
+		head, _ := body.Peek(utils.UploadSniffLen)
+		fileType = utils.DetectUploadType(upload.MediaType, head, upload.Filename)
+		if fileContentType(fileType) == "" {
+			s.Logger.Printf("UploadChunkHandler: Upload %s is of unsupported type %s", upload.UploadID, fileType)
+			if err := s.Store.DeleteUpload(r.Context(), upload.UploadID); err != nil {
+				s.Logger.Printf("UploadChunkHandler: Error deleting upload: %v", err)
+			}
+			http.Error(w, "Only PDF, document, audio and video files can be uploaded", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	partKey := fmt.Sprintf("%s%s.part-%d-%s", uploadBlobPrefix, upload.UploadID, start, utils.GenerateUploadID())
+	n, err := s.Blobs.Put(r.Context(), partKey, body)
+	if err == nil && n != length {
+		err = fmt.Errorf("chunk has %d bytes, Content-Range declares %d", n, length)
+	}
+	if err != nil {
+		s.Logger.Printf("UploadChunkHandler: Error storing chunk: %v", err)
+		s.deleteBlobs(r.Context(), "UploadChunkHandler", partKey)
+		s.writeUploadError(w, err)
+		return
+	}
+
+	upload, err = s.Store.UpdateUpload(r.Context(), upload.UploadID, func(upload *models.Upload) error {
+		if upload.Status != models.UploadStatusPending || upload.Received != start {
+			return errUploadConflict
+		}
+		upload.MediaType = fileType
+		upload.Parts = append(upload.Parts, partKey)
+		upload.Received = end + 1
+		upload.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		s.deleteBlobs(r.Context(), "UploadChunkHandler", partKey)
+		if !errors.Is(err, errUploadConflict) {
+			s.Logger.Printf("UploadChunkHandler: Error saving upload: %v", err)
+			http.Error(w, "Error saving upload", http.StatusInternalServerError)
+			return
+		}
+		// Another request stored the same chunk first
+		upload, ok = s.loadUpload(w, r, "UploadChunkHandler", mux.Vars(r)["uploadID"], userID)
+		if ok {
+			s.writeUpload(w, "UploadChunkHandler", http.StatusConflict, upload)
+		}
+		return
+	}
+
+	if upload.Received == upload.Size {
+		s.finishUpload(w, r, upload)
+		return
+	}
+	s.writeUpload(w, "UploadChunkHandler", http.StatusOK, upload)
+}
+
+// finishUpload completes a fully received upload and writes it as the response
+func (s *Server) finishUpload(w http.ResponseWriter, r *http.Request, upload *models.Upload) {
+	upload, err := s.completeUpload(r.Context(), upload)
+	if err != nil {
+		s.Logger.Printf("UploadChunkHandler: Error completing upload: %v", err)
+		http.Error(w, "Error completing upload", http.StatusInternalServerError)
+		return
+	}
+	s.Logger.Printf("UploadChunkHandler: Completed upload %s of %s", upload.UploadID, upload.MediaType)
+	s.writeUpload(w, "UploadChunkHandler", http.StatusOK, upload)
+}
+
+// completeUpload combines the chunks of a fully received upload into its blob and marks it complete. The
+// chunks are deleted only once the upload is saved, so a failed attempt is retried by any later chunk
+// request for the upload.
+func (s *Server) completeUpload(ctx context.Context, upload *models.Upload) (*models.Upload, error) {
+	blobKey := uploadBlobKey(*upload)
+	if err := s.Blobs.Compose(ctx, blobKey, upload.Parts); err != nil {
+		return nil, err
+	}
+	parts := upload.Parts
+	upload, err := s.Store.UpdateUpload(ctx, upload.UploadID, func(upload *models.Upload) error {
+		upload.Status = models.UploadStatusComplete
+		upload.BlobKey = blobKey
+		upload.Parts = nil
+		upload.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.deleteBlobs(ctx, "UploadChunkHandler", parts...)
+	return upload, nil
+}
+
+// GetUploadHandler returns the state of one of the user's uploads
+func (s *Server) GetUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "GetUploadHandler")
+	if !ok {
+		return
+	}
+	upload, ok := s.loadUpload(w, r, "GetUploadHandler", mux.Vars(r)["uploadID"], userID)
+	if !ok {
+		return
+	}
+	s.writeUpload(w, "GetUploadHandler", http.StatusOK, upload)
+}
+
+// DeleteUploadHandler deletes one of the user's uploads and its stored file. Quizzes already generated
+// from it are kept.
+func (s *Server) DeleteUploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.requireUser(w, r, "DeleteUploadHandler")
+	if !ok {
+		return
+	}
+	upload, ok := s.loadUpload(w, r, "DeleteUploadHandler", mux.Vars(r)["uploadID"], userID)
+	if !ok {
+		return
+	}
+	if err := s.deleteUpload(r.Context(), upload); err != nil {
+		s.Logger.Printf("DeleteUploadHandler: Error deleting upload: %v", err)
+		http.Error(w, "Error deleting upload", http.StatusInternalServerError)
+		return
+	}
+	s.Logger.Printf("DeleteUploadHandler: Deleted upload %s", upload.UploadID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteUpload deletes the blobs of upload, then its record
+func (s *Server) deleteUpload(ctx context.Context, upload *models.Upload) error {
+	if s.Blobs != nil {
+		keys := slices.Clone(upload.Parts)
+		if upload.BlobKey != "" {
+			keys = append(keys, upload.BlobKey)
+		}
+		for _, key := range keys {
+			if err := s.Blobs.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return s.Store.DeleteUpload(ctx, upload.UploadID)
+}
+
+// expireUploads deletes the resumable uploads, and the chunks received, that are still pending longer than
+// the upload expiry after they started, logging failures. It is run by the job queue along with reclaiming
+// abandoned jobs.
+func (s *Server) expireUploads(ctx context.Context, now time.Time) {
+	if s.Blobs == nil {
+		return
+	}
+	uploads, err := s.Store.ListPendingUploads(ctx, now.Add(-s.uploadExpiry()))
+	if err != nil {
+		s.Logger.Printf("expireUploads: Error listing pending uploads: %v", err)
+		return
+	}
+	for _, upload := range uploads {
+		if err := s.deleteUpload(ctx, &upload); err != nil {
+			s.Logger.Printf("expireUploads: Error deleting upload %s: %v", upload.UploadID, err)
+			continue
+		}
+		s.Logger.Printf("expireUploads: Deleted expired upload %s", upload.UploadID)
+	}
+}
+
+// deleteContentUpload deletes the upload content was generated from, if any, logging failures. Files
+// submitted before they were kept as uploads have none.
+func (s *Server) deleteContentUpload(ctx context.Context, handler string, content *models.Content) {
+	if !isUpload(content.URL) {
+		return
+	}
+	upload, err := s.Store.GetUpload(ctx, strings.TrimPrefix(content.URL, uploadScheme))
+	if errors.Is(err, services.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		s.Logger.Printf("%s: Error retrieving upload: %v", handler, err)
+		return
+	}
+	if upload.OwnerID != content.OwnerID {
+		return
+	}
+	if err := s.deleteUpload(ctx, upload); err != nil {
+		s.Logger.Printf("%s: Error deleting upload: %v", handler, err)
+		return
+	}
+	s.Logger.Printf("%s: Deleted upload %s", handler, upload.UploadID)
+}
+
+// loadUpload retrieves uploadID for userID, writing the error response and returning false if it does
+// not exist or belongs to another user
+func (s *Server) loadUpload(w http.ResponseWriter, r *http.Request, handler, uploadID, userID string) (*models.Upload, bool) {
+	upload, err := s.Store.GetUpload(r.Context(), uploadID)
+	if errors.Is(err, services.ErrNotFound) {
+		s.Logger.Printf("%s: Upload not found: %v", handler, err)
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		s.Logger.Printf("%s: Error retrieving upload: %v", handler, err)
+		http.Error(w, "Error retrieving upload", http.StatusInternalServerError)
+		return nil, false
+	}
+	if upload.OwnerID != userID {
+		s.Logger.Printf("%s: User %s may not access upload %s", handler, userID, uploadID)
+		http.Error(w, "Access to upload denied", http.StatusForbidden)
+		return nil, false
+	}
+	return upload, true
+}
+
+// writeUpload encodes upload as the JSON response with the given status code, without its chunks
+func (s *Server) writeUpload(w http.ResponseWriter, handler string, status int, upload *models.Upload) {
+	response := *upload
+	response.Parts = nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.Logger.Printf("%s: Error encoding response: %v", handler, err)
+	}
+}
+
+// writeUploadError writes the response to a file or chunk that could not be stored
+func (s *Server) writeUploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Uploaded file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Error storing file", http.StatusInternalServerError)
+}
+
+// requireBlobs writes a 501 response and returns false if file uploads are disabled
+func (s *Server) requireBlobs(w http.ResponseWriter, handler string) bool {
+	if s.Blobs == nil {
+		s.Logger.Printf("%s: File uploads are disabled", handler)
+		http.Error(w, "File uploads are disabled", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+// deleteBlobs deletes blobs that are no longer needed, logging failures
+func (s *Server) deleteBlobs(ctx context.Context, handler string, keys ...string) {
+	for _, key := range keys {
+		if err := s.Blobs.Delete(ctx, key); err != nil {
+			s.Logger.Printf("%s: Error deleting blob %s: %v", handler, key, err)
+		}
+	}
+}
+
+// maxUploadBytes returns the size limit of uploaded files
+func (s *Server) maxUploadBytes() int64 {
+	if s.Config.UploadMaxBytes <= 0 {
+		return defaultUploadMaxBytes
+	}
+	return int64(s.Config.UploadMaxBytes)
+}
+
+// maxInlineMediaBytes returns the size limit of uploaded audio and video the model cannot read from the blob
+// store, which are read into memory and sent to it inline
+func (s *Server) maxInlineMediaBytes() int64 {
+	if s.Config.InlineMediaMaxBytes <= 0 {
+		return defaultInlineMediaMaxBytes
+	}
+	return int64(s.Config.InlineMediaMaxBytes)
+}
+
+// uploadExpiry returns how long a resumable upload may stay pending before it is deleted
+func (s *Server) uploadExpiry() time.Duration {
+	if s.Config.UploadExpiry <= 0 {
+		return defaultUploadExpiry
+	}
+	return s.Config.UploadExpiry
+}
+
+// uploadBlobKey returns the blob key of the file of upload, with an extension matching its media type
+// for the model to tell its type by
+func uploadBlobKey(upload models.Upload) string {
+	return uploadBlobPrefix + upload.UploadID + utils.UploadExt(upload.MediaType, upload.Filename)
+}
+
+// parseContentRange parses a Content-Range header of the form "bytes start-end/total"
+func parseContentRange(header string) (start, end, total int64, err error) {
+	match := contentRangePattern.FindStringSubmatch(header)
+	if match == nil {
+		return 0, 0, 0, fmt.Errorf("malformed Content-Range %q", header)
+	}
+	values := make([]int64, 3)
+	for i := range values {
+		if values[i], err = strconv.ParseInt(match[i+1], 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	start, end, total = values[0], values[1], values[2]
+	if start > end || end >= total {
+		return 0, 0, 0, fmt.Errorf("invalid range %d-%d of %d bytes", start, end, total)
+	}
+	return start, end, total, nil
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+)
+
+// newUploadTestServer creates a test server that stores uploads in a temporary directory
+func newUploadTestServer(t *testing.T) *Server {
+	t.Helper()
+	server, _ := newCachingTestServer(t)
+	useLocalBlobs(t, server)
+	return server
+}
+
+// useLocalBlobs stores the uploads of server in a temporary directory, which it returns
+func useLocalBlobs(t *testing.T, server *Server) string {
+	t.Helper()
+	dir := t.TempDir()
+	blobs, err := services.NewLocalBlobStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore: expected no error, got %v", err)
+	}
+	server.Blobs = blobs
+	return dir
+}
+
+// postUpload uploads data as the file of a multipart request to /uploads, declaring mediaType, as userID
+func postUpload(t *testing.T, server *Server, userID, filename, mediaType string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	header.Set("Content-Type", mediaType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return serveUpload(t, server, userID, "POST", "/uploads", writer.FormDataContentType(), "", body.Bytes())
+}
+
+// serveUpload routes an upload request with the given headers as userID
+func serveUpload(t *testing.T, server *Server, userID, method, path, contentType, contentRange string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	request, err := http.NewRequest(method, path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+userID)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if contentRange != "" {
+		request.Header.Set("Content-Range", contentRange)
+	}
+	responseRecorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(responseRecorder, request)
+	return responseRecorder
+}
+
+// decodeUpload checks the status of an upload response and decodes its body
+func decodeUpload(t *testing.T, responseRecorder *httptest.ResponseRecorder, expectedStatusCode int) models.Upload {
+	t.Helper()
+	if responseRecorder.Code != expectedStatusCode {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", responseRecorder.Code, expectedStatusCode, responseRecorder.Body)
+	}
+	var upload models.Upload
+	if err := json.NewDecoder(responseRecorder.Body).Decode(&upload); err != nil {
+		t.Fatalf("failed to parse upload: %v", err)
+	}
+	return upload
+}
+
+// startUploadOf starts a resumable upload as testUserID
+func startUploadOf(t *testing.T, server *Server, filename, mediaType string, size int) models.Upload {
+	t.Helper()
+	payload, err := json.Marshal(StartUploadRequest{Filename: filename, MediaType: mediaType, Size: int64(size)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder := serveUpload(t, server, testUserID, "POST", "/uploads", "application/json", "", payload)
+	upload := decodeUpload(t, responseRecorder, http.StatusCreated)
+	if upload.Status != models.UploadStatusPending || responseRecorder.Header().Get("Location") != "/uploads/"+upload.UploadID {
+		t.Fatalf("expected a pending upload at its location, got %+v", upload)
+	}
+	return upload
+}
+
+// putChunk sends data[start:end] as a chunk of uploadID
+func putChunk(t *testing.T, server *Server, uploadID string, data []byte, start, end int) *httptest.ResponseRecorder {
+	t.Helper()
+	contentRange := fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data))
+	return serveUpload(t, server, testUserID, "PUT", "/uploads/"+uploadID, "application/octet-stream", contentRange, data[start:end])
+}
+
+func TestUploadHandler_MultipartPDF(t *testing.T) {
+	server := newUploadTestServer(t)
+	guide := readPDFFixture(t, "pages.pdf")
+
+	responseRecorder := postUpload(t, server, testUserID, "guide.pdf", "application/octet-stream", guide)
+	upload := decodeUpload(t, responseRecorder, http.StatusCreated)
+	if upload.Status != models.UploadStatusComplete || upload.MediaType != "application/pdf" || upload.Size != int64(len(guide)) {
+		t.Errorf("expected a complete PDF upload, got %+v", upload)
+	}
+	if !strings.HasSuffix(upload.BlobKey, ".pdf") || upload.OwnerID != testUserID {
+		t.Errorf("expected the upload stored as a PDF owned by the uploader, got %+v", upload)
+	}
+
+	job := submitAndWait(t, server, SubmitRequest{ContentType: "URL", UploadID: upload.UploadID})
+	if job.Request.ContentType != "PDF" || job.Request.URL != uploadScheme+upload.UploadID {
+		t.Errorf("expected the upload to be quizzed as a PDF, got %+v", job.Request)
+	}
+	if content := savedContent(t, server, job); len(content.Anchors) == 0 {
+		t.Errorf("expected the PDF's pages to be anchored, got %+v", content.Anchors)
+	}
+	assertCitedPages(t, server, job.Result.ContentID, job.Result.QuizID)
+}
+
+func TestUploadHandler_Markdown(t *testing.T) {
+	server := newUploadTestServer(t)
+	notes, err := os.ReadFile(filepath.Join("..", "utils", "testdata", "document", "lobsters.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sniffed as plain text, and told apart by its extension
+	upload := decodeUpload(t, postUpload(t, server, testUserID, "lobsters.md", "application/octet-stream", notes), http.StatusCreated)
+	if upload.MediaType != "text/markdown" || !strings.HasSuffix(upload.BlobKey, ".md") {
+		t.Errorf("expected a Markdown upload, got %+v", upload)
+	}
+
+	job := submitAndWait(t, server, SubmitRequest{UploadID: upload.UploadID, Options: models.QuizOptions{NumQuestions: 10}})
+	if job.Request.ContentType != "Markdown" || job.Result.Title != "Lobster Notes" {
+		t.Errorf("expected the upload to be quizzed as Markdown, got %+v", job.Request)
+	}
+	if contentText := savedContent(t, server, job).ContentText; strings.Contains(contentText, "**") || strings.Contains(contentText, "](") {
+		t.Errorf("expected the Markdown syntax to be removed, got %q", contentText)
+	}
+	assertCitedSections(t, server, job.Result, map[string]string{"hard exoskeleton": "Molting"})
+}
+
+func TestUploadHandler_Resumable(t *testing.T) {
+	server := newUploadTestServer(t)
+	audio := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, (minUploadChunk+1000)/4)...)
+	upload := startUploadOf(t, server, "talk.mp3", "audio/mpeg", len(audio))
+
+	// The last chunk cannot be sent first
+	conflict := decodeUpload(t, putChunk(t, server, upload.UploadID, audio, minUploadChunk, len(audio)), http.StatusConflict)
+	if conflict.Received != 0 {
+		t.Errorf("expected the conflict to report where the upload is at, got %+v", conflict)
+	}
+	if responseRecorder := putChunk(t, server, upload.UploadID, audio, 0, 1000); responseRecorder.Code != http.StatusBadRequest {
+		t.Errorf("expected a small chunk other than the last to be rejected, got %v", responseRecorder.Code)
+	}
+
+	partial := decodeUpload(t, putChunk(t, server, upload.UploadID, audio, 0, minUploadChunk), http.StatusOK)
+	if partial.Status != models.UploadStatusPending || partial.Received != minUploadChunk || len(partial.Parts) != 0 {
+		t.Errorf("expected the first chunk to be received, got %+v", partial)
+	}
+	// Resending a chunk already received reports the upload's progress
+	if responseRecorder := putChunk(t, server, upload.UploadID, audio, 0, minUploadChunk); responseRecorder.Code != http.StatusConflict {
+		t.Errorf("expected a repeated chunk to conflict, got %v", responseRecorder.Code)
+	}
+
+	complete := decodeUpload(t, putChunk(t, server, upload.UploadID, audio, minUploadChunk, len(audio)), http.StatusOK)
+	if complete.Status != models.UploadStatusComplete || complete.Received != int64(len(audio)) || complete.MediaType != "audio/mpeg" {
+		t.Fatalf("expected the upload to be complete, got %+v", complete)
+	}
+	blob, err := server.Blobs.Open(context.Background(), complete.BlobKey)
+	if err != nil {
+		t.Fatalf("Open: expected the uploaded file, got %v", err)
+	}
+	stored, _ := io.ReadAll(blob)
+	blob.Close()
+	if !bytes.Equal(stored, audio) {
+		t.Errorf("expected the chunks to be combined in order, got %d bytes", len(stored))
+	}
+
+	job := submitAndWait(t, server, SubmitRequest{UploadID: upload.UploadID})
+	if job.Request.ContentType != "Audio" || job.Result.Title != "talk" {
+		t.Errorf("expected the model to transcribe the uploaded audio inline under its file name, got %+v, %+v", job.Request, job.Result)
+	}
+
+	// Deleting the content deletes the upload and its file
+	if responseRecorder := serveAs(t, server, testUserID, "DELETE", "/content/"+job.Result.ContentID, nil); responseRecorder.Code != http.StatusNoContent {
+		t.Fatalf("DeleteContentHandler returned wrong status code: got %v", responseRecorder.Code)
+	}
+	if responseRecorder := serveAs(t, server, testUserID, "GET", "/uploads/"+upload.UploadID, nil); responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("expected the upload to be deleted with its content, got %v", responseRecorder.Code)
+	}
+	if _, err := server.Blobs.Open(context.Background(), complete.BlobKey); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected the uploaded file to be deleted with its content, got %v", err)
+	}
+}
+
+func TestUploadHandler_InlineMediaTooLarge(t *testing.T) {
+	server := newUploadTestServer(t)
+	audio := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 1000)...)
+	upload := decodeUpload(t, postUpload(t, server, testUserID, "talk.mp3", "audio/mpeg", audio), http.StatusCreated)
+
+	// Local media is sent to the model inline, so it is held to a much smaller limit than uploads
+	server.Config.InlineMediaMaxBytes = len(audio) - 1
+	failed := waitForJob(t, server, submitJob(t, server, SubmitRequest{UploadID: upload.UploadID}))
+	if failed.Status != models.JobStatusFailed || failed.Error != "File too large for local storage; configure GCS blob storage" {
+		t.Errorf("expected local media over the inline limit to be refused, got %+v", failed)
+	}
+
+	server.Config.InlineMediaMaxBytes = len(audio)
+	submitAndWait(t, server, SubmitRequest{UploadID: upload.UploadID})
+}
+
+func TestUploadHandler_Expiry(t *testing.T) {
+	server := newUploadTestServer(t)
+	ctx := context.Background()
+	audio := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, (minUploadChunk+1000)/4)...)
+	pending := startUploadOf(t, server, "talk.mp3", "audio/mpeg", len(audio))
+	decodeUpload(t, putChunk(t, server, pending.UploadID, audio, 0, minUploadChunk), http.StatusOK)
+	complete := decodeUpload(t, postUpload(t, server, testUserID, "talk.mp3", "audio/mpeg", audio), http.StatusCreated)
+
+	stored, err := server.Store.GetUpload(ctx, pending.UploadID)
+	if err != nil || len(stored.Parts) != 1 {
+		t.Fatalf("expected the first chunk to be stored, got %+v, %v", stored, err)
+	}
+
+	server.expireUploads(ctx, time.Now())
+	if _, err := server.Store.GetUpload(ctx, pending.UploadID); err != nil {
+		t.Fatalf("expected a recent pending upload to be kept, got %v", err)
+	}
+
+	server.expireUploads(ctx, time.Now().Add(defaultUploadExpiry+time.Minute))
+	if _, err := server.Store.GetUpload(ctx, pending.UploadID); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected the expired upload to be deleted, got %v", err)
+	}
+	if _, err := server.Blobs.Open(ctx, stored.Parts[0]); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected the chunks of the expired upload to be deleted, got %v", err)
+	}
+	if _, err := server.Store.GetUpload(ctx, complete.UploadID); err != nil {
+		t.Errorf("expected complete uploads to be kept, got %v", err)
+	}
+	if responseRecorder := putChunk(t, server, pending.UploadID, audio, minUploadChunk, len(audio)); responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("expected chunks of an expired upload to be refused, got %v", responseRecorder.Code)
+	}
+}
+
+func TestUploadHandler_Errors(t *testing.T) {
+	server := newUploadTestServer(t)
+	guide := readPDFFixture(t, "pages.pdf")
+
+	if responseRecorder := postUpload(t, server, testUserID, "notes.mp3", "audio/mpeg", []byte("plain text notes")); responseRecorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a text file to be rejected, got %v", responseRecorder.Code)
+	}
+	upload := startUploadOf(t, server, "talk.mp3", "audio/mpeg", minUploadChunk)
+	text := bytes.Repeat([]byte("plain text "), minUploadChunk/11+1)[:minUploadChunk]
+	if responseRecorder := putChunk(t, server, upload.UploadID, text, 0, len(text)); responseRecorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected a resumable upload of text to be rejected, got %v", responseRecorder.Code)
+	}
+	if responseRecorder := serveAs(t, server, testUserID, "GET", "/uploads/"+upload.UploadID, nil); responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("expected the rejected upload to be deleted, got %v", responseRecorder.Code)
+	}
+
+	// Uploads belong to the uploader
+	owned := decodeUpload(t, postUpload(t, server, testUserID, "guide.pdf", "application/pdf", guide), http.StatusCreated)
+	if responseRecorder := serveAs(t, server, "someone-else", "GET", "/uploads/"+owned.UploadID, nil); responseRecorder.Code != http.StatusForbidden {
+		t.Errorf("expected another user to be denied the upload, got %v", responseRecorder.Code)
+	}
+	if responseRecorder := serveAs(t, server, "someone-else", "DELETE", "/uploads/"+owned.UploadID, nil); responseRecorder.Code != http.StatusForbidden {
+		t.Errorf("expected another user to be denied deleting the upload, got %v", responseRecorder.Code)
+	}
+	payload, _ := json.Marshal(SubmitRequest{UploadID: owned.UploadID})
+	responseRecorder := serveUpload(t, server, "someone-else", "POST", "/submit", "application/json", "", payload)
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "Upload not found") {
+		t.Errorf("expected another user's upload to be refused, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	pending := startUploadOf(t, server, "talk.mp3", "audio/mpeg", 1000)
+	payload, _ = json.Marshal(SubmitRequest{UploadID: pending.UploadID})
+	responseRecorder = serveUpload(t, server, testUserID, "POST", "/submit", "application/json", "", payload)
+	if responseRecorder.Code != http.StatusBadRequest || !strings.Contains(responseRecorder.Body.String(), "not complete") {
+		t.Errorf("expected a pending upload to be refused, got %v: %s", responseRecorder.Code, responseRecorder.Body)
+	}
+
+	// Size limits
+	server.Config.UploadMaxBytes = len(guide) - 1
+	if responseRecorder := postUpload(t, server, testUserID, "guide.pdf", "application/pdf", guide); responseRecorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a file over the size limit to be rejected, got %v", responseRecorder.Code)
+	}
+	payload, _ = json.Marshal(StartUploadRequest{Filename: "guide.pdf", Size: int64(len(guide))})
+	if responseRecorder := serveUpload(t, server, testUserID, "POST", "/uploads", "application/json", "", payload); responseRecorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a declared size over the limit to be rejected, got %v", responseRecorder.Code)
+	}
+
+	if responseRecorder := serveAs(t, server, testUserID, "DELETE", "/uploads/"+owned.UploadID, nil); responseRecorder.Code != http.StatusNoContent {
+		t.Errorf("expected the owner to delete the upload, got %v", responseRecorder.Code)
+	}
+	if _, err := server.Blobs.Open(context.Background(), owned.BlobKey); !errors.Is(err, services.ErrNotFound) {
+		t.Errorf("expected the uploaded file to be deleted, got %v", err)
+	}
+
+	server.Blobs = nil
+	if responseRecorder := postUpload(t, server, testUserID, "guide.pdf", "application/pdf", guide); responseRecorder.Code != http.StatusNotImplemented {
+		t.Errorf("expected uploads to be disabled without a blob store, got %v", responseRecorder.Code)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	t.Parallel()
+	start, end, total, err := parseContentRange("bytes 0-1023/2048")
+	if err != nil || start != 0 || end != 1023 || total != 2048 {
+		t.Errorf("parseContentRange: got %d-%d/%d, %v", start, end, total, err)
+	}
+	for _, header := range []string{"", "bytes */2048", "bytes 10-5/2048", "bytes 0-2048/2048", "items 0-1/2"} {
+		if _, _, _, err := parseContentRange(header); err == nil {
+			t.Errorf("parseContentRange(%q): expected an error", header)
+		}
+	}
+}
@@ -1,30 +1,101 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"read-robin/config"
 	"read-robin/handlers"
-	"read-robin/middleware" // Import the middleware package
+	"read-robin/middleware"
+	"read-robin/services"
+	"read-robin/services/llm"
 
 	gorillahandlers "github.com/gorilla/handlers" // Alias the gorilla/handlers package
-	"github.com/gorilla/mux"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	r := mux.NewRouter()
+	cfg := config.Load()
+	logger := log.Default()
+	ctx := context.Background()
+
+	// Create the long-lived clients shared by every request
+	store, err := services.NewStore(ctx, cfg)
+	if err != nil {
+		log.Fatalf("Error creating store: %v", err)
+	}
+
+	// "migrate-ids" rewrites documents saved under the legacy ID scheme and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate-ids" {
+		defer store.Close()
+		report, err := store.MigrateIDs(ctx)
+		if err != nil {
+			log.Fatalf("Error migrating IDs: %v", err)
+		}
+		log.Printf("Migrated IDs: %+v", report)
+		return
+	}
+	// "migrate-quizzes" moves quizzes embedded in content documents into their own documents and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate-quizzes" {
+		defer store.Close()
+		migrator, ok := store.(services.QuizMigrator)
+		if !ok {
+			log.Printf("The %s store keeps quizzes in their own records; nothing to migrate", cfg.StoreBackend)
+			return
+		}
+		moved, err := migrator.MigrateQuizzes(ctx)
+		if err != nil {
+			log.Fatalf("Error migrating quizzes: %v", err)
+		}
+		log.Printf("Migrated %d quizzes", moved)
+		return
+	}
+	provider, err := services.NewLLMProvider(ctx, cfg)
+	if err != nil {
+		store.Close()
+		log.Fatalf("Error creating LLM provider: %v", err)
+	}
+	// Publish the LLM retry counters at /debug/vars on the debug listener
+	if resilient, ok := provider.(*llm.ResilientProvider); ok {
+		expvar.Publish("llm", expvar.Func(func() any { return resilient.Metrics().Snapshot() }))
+	}
+	verifier, err := middleware.NewTokenVerifier(cfg)
+	if err != nil {
+		store.Close()
+		provider.Close()
+		log.Fatalf("Error creating token verifier: %v", err)
+	}
+	extractions, err := services.NewExtractionCache(cfg, store)
+	if err != nil {
+		store.Close()
+		provider.Close()
+		log.Fatalf("Error creating extraction cache: %v", err)
+	}
+	blobs, err := services.NewBlobStore(ctx, cfg)
+	if err != nil {
+		store.Close()
+		provider.Close()
+		log.Fatalf("Error creating blob store: %v", err)
+	}
 
-	// Define your routes
-	r.HandleFunc("/", handlers.HomeHandler).Methods("GET")
-	r.HandleFunc("/submit", handlers.SubmitHandler).Methods("POST")
-	r.HandleFunc("/quiz/{contentID}/{quizID}", handlers.GetQuizHandler).Methods("GET")
-	r.HandleFunc("/submit-response", handlers.SubmitResponseHandler).Methods("POST") // New route for question submission
-	r.HandleFunc("/regenerate-quiz", handlers.RegenerateQuizHandler).Methods("POST") // New route for regenerating quizzes
+	server := handlers.NewServer(cfg, store, provider, verifier, logger)
+	server.Extractions = extractions
+	server.Blobs = blobs
+	defer server.Close()
 
-	// Apply logging middleware
-	r.Use(middleware.LoggingMiddleware)
+	// Resume jobs interrupted by the previous shutdown and start the workers
+	if err := server.Start(ctx); err != nil {
+		log.Fatalf("Error starting job queue: %v", err)
+	}
 
 	// Set up CORS
 	corsAllowedOrigins := gorillahandlers.AllowedOrigins([]string{
@@ -35,19 +106,47 @@ func main() {
 		"https://read-robin-6yudia4zva-nn.a.run.app",
 		"https://quizbo.app",
 	})
-	corsAllowedMethods := gorillahandlers.AllowedMethods([]string{"GET", "POST", "OPTIONS"})
-	corsAllowedHeaders := gorillahandlers.AllowedHeaders([]string{"Content-Type", "Authorization"})
+	corsAllowedMethods := gorillahandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	corsAllowedHeaders := gorillahandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Content-Range"})
 
 	// Apply CORS middleware to the router
-	corsHandler := gorillahandlers.CORS(corsAllowedOrigins, corsAllowedMethods, corsAllowedHeaders)(r)
+	corsHandler := gorillahandlers.CORS(corsAllowedOrigins, corsAllowedMethods, corsAllowedHeaders)(server.Routes())
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", cfg.Port),
+		Handler: corsHandler,
 	}
 
-	log.Printf("Starting server on port %s\n", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", port), corsHandler); err != nil {
+	// Serve process internals apart from the API, on a listener that is local unless DEBUG_ADDR says otherwise
+	var debugServer *http.Server
+	if cfg.DebugAddr != "" {
+		debugServer = &http.Server{Addr: cfg.DebugAddr, Handler: handlers.DebugRoutes()}
+		go func() {
+			if err := debugServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Error starting debug server: %v", err)
+			}
+		}()
+	}
+
+	// Stop accepting requests on SIGINT/SIGTERM and let in-flight requests finish
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if debugServer != nil {
+			debugServer.Close()
+		}
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	log.Printf("Starting server on port %s\n", cfg.Port)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Error starting server: %v", err)
 	}
+	log.Println("Server stopped")
 }
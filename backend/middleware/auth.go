@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"read-robin/config"
+)
+
+// ErrInvalidToken is returned by a TokenVerifier when a token is malformed, expired or not trusted
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenVerifier verifies a bearer token and returns the ID of the user it was issued to
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+type userIDKey struct{}
+
+// WithUserID returns a copy of ctx carrying the authenticated user's ID
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserIDFromContext returns the authenticated user's ID stored by AuthMiddleware
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(string)
+	return userID, ok && userID != ""
+}
+
+// AuthMiddleware rejects requests without a valid "Authorization: Bearer <token>" header
+// and stores the verified user ID in the request context.
+func AuthMiddleware(verifier TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				log.Printf("AuthMiddleware: Error verifying token: %v", err)
+				http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), userID)))
+		})
+	}
+}
+
+// bearerToken extracts the token from the request's Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// InsecureVerifier trusts the bearer token itself as the user ID. It is only meant for local development.
+type InsecureVerifier struct{}
+
+// Verify returns token as the user ID
+func (InsecureVerifier) Verify(ctx context.Context, token string) (string, error) {
+	return token, nil
+}
+
+// NewTokenVerifier creates the TokenVerifier selected by cfg.AuthProvider
+func NewTokenVerifier(cfg config.Config) (TokenVerifier, error) {
+	switch cfg.AuthProvider {
+	case config.AuthFirebase:
+		if cfg.FirebaseProjectID == "" {
+			return nil, fmt.Errorf("FIREBASE_PROJECT_ID or GCP_PROJECT must be set for firebase auth")
+		}
+		return NewFirebaseVerifier(cfg.FirebaseProjectID), nil
+	case config.AuthStatic:
+		data, err := os.ReadFile(cfg.AuthKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading AUTH_KEYS_FILE: %w", err)
+		}
+		keys, err := ParseKeySet(data)
+		if err != nil {
+			return nil, err
+		}
+		return &JWTVerifier{Issuer: cfg.AuthIssuer, Audience: cfg.AuthAudience, Keys: keys}, nil
+	case config.AuthInsecure:
+		log.Printf("WARNING: AUTH_PROVIDER=%s trusts any bearer token as the user ID", config.AuthInsecure)
+		return InsecureVerifier{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported auth provider: %q", cfg.AuthProvider)
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fixedTokenVerifier accepts only the token "good" for user "user-1"
+type fixedTokenVerifier struct{}
+
+func (fixedTokenVerifier) Verify(ctx context.Context, token string) (string, error) {
+	if token != "good" {
+		return "", ErrInvalidToken
+	}
+	return "user-1", nil
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := AuthMiddleware(fixedTokenVerifier{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := UserIDFromContext(r.Context())
+		if !ok {
+			t.Errorf("user ID missing from context")
+		}
+		w.Write([]byte(userID))
+	}))
+
+	testCases := []struct {
+		name               string
+		authorization      string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"MissingHeader", "", http.StatusUnauthorized, "Missing bearer token\n"},
+		{"WrongScheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "Missing bearer token\n"},
+		{"InvalidToken", "Bearer bad", http.StatusUnauthorized, "Invalid bearer token\n"},
+		{"ValidToken", "Bearer good", http.StatusOK, "user-1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatusCode {
+				t.Errorf("wrong status code: got %v want %v", rr.Code, tc.expectedStatusCode)
+			}
+			if rr.Body.String() != tc.expectedBody {
+				t.Errorf("wrong body: got %q want %q", rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
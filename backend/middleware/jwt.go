@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// firebaseKeysURL serves the certificates that sign Firebase ID tokens, keyed by key ID
+	firebaseKeysURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+	// clockSkew is the leeway allowed when checking token timestamps
+	clockSkew = time.Minute
+	// defaultKeyCacheTTL is used when the key server does not send a max-age
+	defaultKeyCacheTTL = time.Hour
+)
+
+// KeySource provides the RSA public keys trusted to sign tokens, keyed by key ID
+type KeySource interface {
+	Keys(ctx context.Context) (map[string]*rsa.PublicKey, error)
+}
+
+// StaticKeySet is a KeySource with a fixed set of keys
+type StaticKeySet map[string]*rsa.PublicKey
+
+// Keys returns the static keys
+func (ks StaticKeySet) Keys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	return ks, nil
+}
+
+// ParseKeySet parses a JSON object mapping key IDs to PEM encoded certificates or public keys,
+// the format served for Firebase ID tokens
+func ParseKeySet(data []byte) (StaticKeySet, error) {
+	var pems map[string]string
+	if err := json.Unmarshal(data, &pems); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+
+	keys := StaticKeySet{}
+	for kid, encoded := range pems {
+		block, _ := pem.Decode([]byte(encoded))
+		if block == nil {
+			return nil, fmt.Errorf("key %s: no PEM data", kid)
+		}
+
+		var publicKey interface{}
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", kid, err)
+			}
+			publicKey = cert.PublicKey
+		case "PUBLIC KEY":
+			var err error
+			publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", kid, err)
+			}
+		default:
+			return nil, fmt.Errorf("key %s: unsupported PEM type %q", kid, block.Type)
+		}
+
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s: not an RSA key", kid)
+		}
+		keys[kid] = rsaKey
+	}
+	return keys, nil
+}
+
+// remoteKeySet is a KeySource that downloads a key set and caches it for the server's max-age
+type remoteKeySet struct {
+	url        string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	keys    StaticKeySet
+	expires time.Time
+}
+
+var maxAgePattern = regexp.MustCompile(`max-age=(\d+)`)
+
+// Keys returns the cached keys, downloading them again once they expire
+func (rk *remoteKeySet) Keys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	rk.mu.Lock()
+	defer rk.mu.Unlock()
+
+	if rk.keys != nil && time.Now().Before(rk.expires) {
+		return rk.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rk.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := rk.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching keys: status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys: %w", err)
+	}
+	keys, err := ParseKeySet(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := defaultKeyCacheTTL
+	if match := maxAgePattern.FindStringSubmatch(resp.Header.Get("Cache-Control")); match != nil {
+		if seconds, err := strconv.Atoi(match[1]); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	rk.keys = keys
+	rk.expires = time.Now().Add(ttl)
+	return keys, nil
+}
+
+// JWTVerifier verifies RS256 signed JSON Web Tokens issued by Issuer for Audience,
+// returning the token's subject as the user ID
+type JWTVerifier struct {
+	Issuer   string
+	Audience string
+	Keys     KeySource
+	// Now returns the current time; it defaults to time.Now
+	Now func() time.Time
+}
+
+// NewFirebaseVerifier creates a JWTVerifier for Firebase Authentication ID tokens of projectID
+func NewFirebaseVerifier(projectID string) *JWTVerifier {
+	return &JWTVerifier{
+		Issuer:   "https://securetoken.google.com/" + projectID,
+		Audience: projectID,
+		Keys:     &remoteKeySet{url: firebaseKeysURL, httpClient: &http.Client{Timeout: 10 * time.Second}},
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer   string          `json:"iss"`
+	Audience json.RawMessage `json:"aud"`
+	Subject  string          `json:"sub"`
+	Expires  int64           `json:"exp"`
+	IssuedAt int64           `json:"iat"`
+}
+
+// Verify checks the token's signature, issuer, audience and lifetime and returns its subject
+func (jv *JWTVerifier) Verify(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%w: expected 3 segments", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	if header.Alg != "RS256" {
+		return "", fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	keys, err := jv.Keys.Keys(ctx)
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key ID %q", ErrInvalidToken, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+	if jv.Now != nil {
+		now = jv.Now()
+	}
+	switch {
+	case claims.Issuer != jv.Issuer:
+		return "", fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	case !audienceContains(claims.Audience, jv.Audience):
+		return "", fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	case claims.Subject == "":
+		return "", fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	case now.After(time.Unix(claims.Expires, 0).Add(clockSkew)):
+		return "", fmt.Errorf("%w: expired", ErrInvalidToken)
+	case now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return "", fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+	return claims.Subject, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON token segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains reports whether the "aud" claim, a string or an array of strings, includes audience
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+	var multiple []string
+	if err := json.Unmarshal(raw, &multiple); err == nil {
+		for _, aud := range multiple {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
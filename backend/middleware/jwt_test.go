@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+// signToken creates an RS256 JWT with the given key ID and claims
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	verifier := &JWTVerifier{
+		Issuer:   "https://securetoken.google.com/project",
+		Audience: "project",
+		Keys:     StaticKeySet{"key-1": &key.PublicKey},
+		Now:      func() time.Time { return now },
+	}
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": verifier.Issuer,
+			"aud": verifier.Audience,
+			"sub": "user-1",
+			"iat": now.Add(-time.Minute).Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	userID, err := verifier.Verify(context.Background(), signToken(t, key, "key-1", claims(nil)))
+	if err != nil {
+		t.Fatalf("Verify returned error for valid token: %v", err)
+	}
+	if userID != "user-1" {
+		t.Errorf("Verify returned wrong user ID: got %q want %q", userID, "user-1")
+	}
+
+	userID, err = verifier.Verify(context.Background(), signToken(t, key, "key-1", claims(map[string]interface{}{"aud": []string{"other", "project"}})))
+	if err != nil || userID != "user-1" {
+		t.Errorf("Verify rejected token with audience array: %q, %v", userID, err)
+	}
+
+	testCases := []struct {
+		name  string
+		token string
+	}{
+		{"Malformed", "not-a-jwt"},
+		{"Expired", signToken(t, key, "key-1", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}))},
+		{"IssuedInFuture", signToken(t, key, "key-1", claims(map[string]interface{}{"iat": now.Add(time.Hour).Unix()}))},
+		{"WrongAudience", signToken(t, key, "key-1", claims(map[string]interface{}{"aud": "other"}))},
+		{"WrongIssuer", signToken(t, key, "key-1", claims(map[string]interface{}{"iss": "https://evil.example.com"}))},
+		{"MissingSubject", signToken(t, key, "key-1", claims(map[string]interface{}{"sub": ""}))},
+		{"UnknownKey", signToken(t, key, "key-2", claims(nil))},
+		{"BadSignature", signToken(t, otherKey, "key-1", claims(nil))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), tc.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify returned %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"key-1": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+
+	keys, err := ParseKeySet(data)
+	if err != nil {
+		t.Fatalf("ParseKeySet returned error: %v", err)
+	}
+	if !keys["key-1"].Equal(&key.PublicKey) {
+		t.Errorf("ParseKeySet returned wrong key")
+	}
+
+	if _, err := ParseKeySet([]byte(`{"key-1": "not pem"}`)); err == nil {
+		t.Errorf("ParseKeySet accepted invalid PEM")
+	}
+}
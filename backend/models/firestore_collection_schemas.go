@@ -2,12 +2,46 @@ package models
 
 import "time"
 
-// Question represents a single question and answer pair with a reference
+// Question types
+const (
+	QuestionTypeFreeText       = "free_text"
+	QuestionTypeMultipleChoice = "multiple_choice"
+	QuestionTypeTrueFalse      = "true_false"
+	QuestionTypeFillInBlank    = "fill_in_blank"
+)
+
+// Question represents a single question and answer pair with a reference. Objective question types
+// carry their payload in the field named after the type; Answer always holds the correct answer as text.
 type Question struct {
-	QuestionID string `json:"question_id" firestore:"question_id"`
-	Question   string `json:"question" firestore:"question"`
-	Answer     string `json:"answer" firestore:"answer"`
-	Reference  string `json:"reference" firestore:"reference"`
+	QuestionID     string          `json:"question_id" firestore:"question_id"`
+	LegacyID       string          `json:"legacy_id,omitempty" firestore:"legacy_id,omitempty"` // The ID the question had before the ID migration, if any
+	Type           string          `json:"type" firestore:"type"`                               // One of the QuestionType constants; empty means free text
+	Question       string          `json:"question" firestore:"question"`
+	Answer         string          `json:"answer" firestore:"answer"`
+	Reference      string          `json:"reference" firestore:"reference"`
+	Chunk          int             `json:"chunk" firestore:"chunk"`                               // Index of the part of the content the question was generated from
+	Citation       string          `json:"citation,omitempty" firestore:"citation,omitempty"`     // Where the reference is in the source, e.g. "p. 12" or "4:05"
+	TimeRange      *TimeRange      `json:"time_range,omitempty" firestore:"time_range,omitempty"` // Where the reference is in audio or video
+	MultipleChoice *MultipleChoice `json:"multiple_choice,omitempty" firestore:"multiple_choice,omitempty"`
+	TrueFalse      *TrueFalse      `json:"true_false,omitempty" firestore:"true_false,omitempty"`
+	FillInBlank    *FillInBlank    `json:"fill_in_blank,omitempty" firestore:"fill_in_blank,omitempty"`
+}
+
+// MultipleChoice is the payload of a multiple-choice question
+type MultipleChoice struct {
+	Choices      []string `json:"choices" firestore:"choices"`
+	CorrectIndex int      `json:"correct_index" firestore:"correct_index"`
+}
+
+// TrueFalse is the payload of a true/false question
+type TrueFalse struct {
+	Answer bool `json:"answer" firestore:"answer"`
+}
+
+// FillInBlank is the payload of a fill-in-the-blank question
+type FillInBlank struct {
+	Text   string   `json:"text" firestore:"text"`     // The cloze text with each blank written as ___
+	Blanks []string `json:"blanks" firestore:"blanks"` // The words or phrases that fill the blanks, in order
 }
 
 // Quiz represents the structure of a quiz with a list of questions and a timestamp
@@ -15,6 +49,28 @@ type Quiz struct {
 	QuizID    string     `json:"quiz_id" firestore:"quiz_id"`
 	Questions []Question `json:"questions" firestore:"questions"`
 	Timestamp time.Time  `json:"timestamp" firestore:"timestamp"`
+	OwnerID   string     `json:"owner_id" firestore:"owner_id"` // User who generated the quiz
+}
+
+// Anchor marks where a citable part of the content text, such as a page, starts
+type Anchor struct {
+	Offset int    `json:"offset" firestore:"offset"` // Byte offset of the part in the content text
+	Label  string `json:"label" firestore:"label"`   // How questions cite the part, e.g. "p. 12"
+}
+
+// Segment is a timed passage of the transcript of audio or video
+type Segment struct {
+	Start   float64 `json:"start" firestore:"start"` // Seconds from the start of the media
+	End     float64 `json:"end" firestore:"end"`
+	Speaker string  `json:"speaker,omitempty" firestore:"speaker,omitempty"`
+	Text    string  `json:"text" firestore:"text"`
+	Offset  int     `json:"offset" firestore:"offset"` // Byte offset of the segment in the content text
+}
+
+// TimeRange is a span of audio or video in seconds, which the frontend can seek to
+type TimeRange struct {
+	Start float64 `json:"start" firestore:"start"`
+	End   float64 `json:"end" firestore:"end"`
 }
 
 // Content represents the structure of content with multiple quizzes
@@ -23,8 +79,14 @@ type Content struct {
 	ContentID   string    `json:"content_id" firestore:"content_id"`
 	URL         string    `json:"url" firestore:"url"`
 	Title       string    `json:"title" firestore:"title"`
-	ContentText string    `json:"content_text" firestore:"content_text"` // This is the newly added field
-	Quizzes     []Quiz    `json:"quizzes" firestore:"quizzes"`
+	ContentText string    `json:"content_text" firestore:"content_text"`               // This is the newly added field
+	Quizzes     []Quiz    `json:"quizzes" firestore:"quizzes,omitempty"`               // Kept in a subcollection in Firestore, though older documents embed them
+	OwnerID     string    `json:"owner_id" firestore:"owner_id"`                       // User who submitted the content
+	SharedWith  []string  `json:"shared_with" firestore:"shared_with"`                 // Other users allowed to read and regenerate it
+	Anchors     []Anchor  `json:"anchors,omitempty" firestore:"anchors,omitempty"`     // Pages of the content text, for sources that have them
+	Segments    []Segment `json:"segments,omitempty" firestore:"segments,omitempty"`   // Timed transcript of audio and video
+	Published   string    `json:"published,omitempty" firestore:"published,omitempty"` // When the source was published, if it says
+	Duration    float64   `json:"duration,omitempty" firestore:"duration,omitempty"`   // Length of audio and video in seconds, when known
 }
 
 type Persona struct {
@@ -34,3 +96,192 @@ type Persona struct {
 	Language   string `json:"language"`
 	Difficulty string `json:"difficulty"`
 }
+
+// Job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Job stages reported while a quiz is generated
+const (
+	JobStageQueued     = "queued"
+	JobStageFetching   = "fetching"
+	JobStageExtracting = "extracting"
+	JobStageGenerating = "generating"
+	JobStageSaving     = "saving"
+	JobStageDone       = "done"
+)
+
+// QuizOptions lets users shape the generated quiz; zero values leave each choice to the model
+type QuizOptions struct {
+	NumQuestions      int      `json:"num_questions,omitempty" firestore:"num_questions"`
+	QuestionTypes     []string `json:"question_types,omitempty" firestore:"question_types"` // QuestionType constants allowed in the quiz
+	FocusTopics       []string `json:"focus_topics,omitempty" firestore:"focus_topics"`     // Topics or sections to concentrate on
+	AvoidTopics       []string `json:"avoid_topics,omitempty" firestore:"avoid_topics"`     // Topics no question may be about
+	IncludeReferences *bool    `json:"include_references,omitempty" firestore:"include_references"`
+	// ExcludeQuestions are questions already asked about the content, set by the server when regenerating
+	ExcludeQuestions []string `json:"-" firestore:"-"`
+}
+
+// ReferencesIncluded reports whether questions keep their reference text, which they do unless disabled
+func (qo QuizOptions) ReferencesIncluded() bool {
+	return qo.IncludeReferences == nil || *qo.IncludeReferences
+}
+
+// QuizRequest describes the source and persona a quiz should be generated for
+type QuizRequest struct {
+	URL         string      `json:"url" firestore:"url"`
+	ContentText string      `json:"content_text,omitempty" firestore:"content_text"`
+	Persona     Persona     `json:"persona" firestore:"persona"`
+	Options     QuizOptions `json:"options" firestore:"options"`
+	ContentType string      `json:"content_type" firestore:"content_type"`
+	OwnerID     string      `json:"owner_id" firestore:"owner_id"`
+	UploadID    string      `json:"upload_id,omitempty" firestore:"upload_id"` // A complete upload to quiz instead of URL
+	Captions    string      `json:"captions,omitempty" firestore:"captions"`   // WebVTT or SRT captions of audio or video, used instead of transcribing it
+	Episode     string      `json:"episode,omitempty" firestore:"episode"`     // The ID of the podcast episode to quiz, or empty for the latest
+}
+
+// QuizResult describes the content and quiz produced by a successful quiz generation
+type QuizResult struct {
+	URL         string `json:"url" firestore:"url"`
+	ContentID   string `json:"content_id" firestore:"content_id"`
+	QuizID      string `json:"quiz_id" firestore:"quiz_id"`
+	Title       string `json:"title" firestore:"title"`
+	ContentText string `json:"content_text,omitempty" firestore:"content_text,omitempty"` // Left out of job results
+	IsFirstQuiz bool   `json:"is_first_quiz" firestore:"is_first_quiz"`
+	// Metadata read from web pages, videos and podcast feeds, when they publish it
+	Author       string  `json:"author,omitempty" firestore:"author"`
+	Published    string  `json:"published,omitempty" firestore:"published"`
+	CanonicalURL string  `json:"canonical_url,omitempty" firestore:"canonical_url"`
+	Duration     float64 `json:"duration,omitempty" firestore:"duration"` // Seconds of audio or video
+	// Anchors locate the pages of paginated sources in ContentText
+	Anchors []Anchor `json:"anchors,omitempty" firestore:"anchors"`
+	// Segments time the transcript of audio and video in ContentText
+	Segments []Segment `json:"segments,omitempty" firestore:"segments"`
+}
+
+// Job represents an asynchronous quiz generation request and its progress through the pipeline stages
+type Job struct {
+	JobID     string      `json:"job_id" firestore:"job_id"`
+	Status    string      `json:"status" firestore:"status"`
+	Stage     string      `json:"stage" firestore:"stage"`
+	Progress  int         `json:"progress" firestore:"progress"` // Percentage from 0 to 100
+	Error     string      `json:"error,omitempty" firestore:"error"`
+	Request   QuizRequest `json:"request" firestore:"request"`
+	Result    *QuizResult `json:"result,omitempty" firestore:"result"`
+	CreatedAt time.Time   `json:"created_at" firestore:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at" firestore:"updated_at"`
+	// The worker running the job and when its lease expires, after which another worker may claim the job
+	ClaimedBy    string    `json:"claimed_by,omitempty" firestore:"claimed_by"`
+	LeaseExpires time.Time `json:"lease_expires" firestore:"lease_expires"`
+	Attempts     int       `json:"attempts" firestore:"attempts"` // The number of times the job was claimed
+}
+
+// Attempt statuses
+const (
+	AttemptStatusInProgress = "in_progress"
+	AttemptStatusFinished   = "finished"
+)
+
+// AttemptResponse is a user's reviewed answer to one question of an attempt
+type AttemptResponse struct {
+	QuestionID   string    `json:"question_id" firestore:"question_id"`
+	UserResponse string    `json:"user_response" firestore:"user_response"`
+	Status       string    `json:"status" firestore:"status"` // PASS or FAIL, as reviewed by the LLM
+	Explanation  string    `json:"explanation" firestore:"explanation"`
+	SubmittedAt  time.Time `json:"submitted_at" firestore:"submitted_at"`
+}
+
+// Attempt is one user's run through a quiz, with their reviewed responses and the score computed when it is finished
+type Attempt struct {
+	AttemptID      string            `json:"attempt_id" firestore:"attempt_id"`
+	UserID         string            `json:"user_id" firestore:"user_id"`
+	ContentID      string            `json:"content_id" firestore:"content_id"`
+	QuizID         string            `json:"quiz_id" firestore:"quiz_id"`
+	Title          string            `json:"title" firestore:"title"`
+	Status         string            `json:"status" firestore:"status"`
+	Responses      []AttemptResponse `json:"responses" firestore:"responses"`
+	TotalQuestions int               `json:"total_questions" firestore:"total_questions"`
+	CorrectCount   int               `json:"correct_count" firestore:"correct_count"`
+	Score          int               `json:"score" firestore:"score"` // Percentage of all questions answered correctly
+	StartedAt      time.Time         `json:"started_at" firestore:"started_at"`
+	FinishedAt     *time.Time        `json:"finished_at,omitempty" firestore:"finished_at"`
+}
+
+// ReviewCard is one user's spaced-repetition schedule for one question, updated each time they answer it
+type ReviewCard struct {
+	UserID         string    `json:"user_id" firestore:"user_id"`
+	ContentID      string    `json:"content_id" firestore:"content_id"`
+	QuizID         string    `json:"quiz_id" firestore:"quiz_id"`
+	QuestionID     string    `json:"question_id" firestore:"question_id"`
+	Ease           float64   `json:"ease" firestore:"ease"`                   // Factor the interval grows by after each successful review
+	IntervalDays   int       `json:"interval_days" firestore:"interval_days"` // Days from the last review until the question is due again
+	Repetitions    int       `json:"repetitions" firestore:"repetitions"`     // Successful reviews in a row
+	Lapses         int       `json:"lapses" firestore:"lapses"`               // Times the question was answered wrongly
+	LastStatus     string    `json:"last_status" firestore:"last_status"`     // PASS or FAIL, as last reviewed
+	LastReviewedAt time.Time `json:"last_reviewed_at" firestore:"last_reviewed_at"`
+	DueAt          time.Time `json:"due_at" firestore:"due_at"`
+}
+
+// Extraction is the cached content extracted from a source, reused while the source is unchanged
+type Extraction struct {
+	Source       string    `json:"source" firestore:"source"`   // The normalized URL or file URI
+	Version      string    `json:"version" firestore:"version"` // A hash of the fetched page, or the file's object generation or ETag
+	ETag         string    `json:"etag,omitempty" firestore:"etag"`
+	LastModified string    `json:"last_modified,omitempty" firestore:"last_modified"`
+	Title        string    `json:"title" firestore:"title"`
+	ContentText  string    `json:"content_text" firestore:"content_text"`
+	Author       string    `json:"author,omitempty" firestore:"author"`
+	Published    string    `json:"published,omitempty" firestore:"published"`
+	CanonicalURL string    `json:"canonical_url,omitempty" firestore:"canonical_url"`
+	Duration     float64   `json:"duration,omitempty" firestore:"duration"` // Seconds of audio or video, when known
+	Anchors      []Anchor  `json:"anchors,omitempty" firestore:"anchors"`   // The pages of PDFs extracted locally
+	Segments     []Segment `json:"segments,omitempty" firestore:"segments"` // The timed transcript of audio and video
+	ExtractedAt  time.Time `json:"extracted_at" firestore:"extracted_at"`
+}
+
+// Upload statuses
+const (
+	UploadStatusPending  = "pending"
+	UploadStatusComplete = "complete"
+)
+
+// Upload is a file a user uploaded to quiz. The file is kept in blob storage; a resumable upload is received
+// in chunks, stored as separate blobs until the last one arrives.
+type Upload struct {
+	UploadID  string    `json:"upload_id" firestore:"upload_id"`
+	OwnerID   string    `json:"owner_id" firestore:"owner_id"`
+	Filename  string    `json:"filename" firestore:"filename"`
+	MediaType string    `json:"media_type" firestore:"media_type"` // Detected from the first bytes received
+	Size      int64     `json:"size" firestore:"size"`             // Total size, declared when a resumable upload starts
+	Received  int64     `json:"received" firestore:"received"`     // Bytes received so far, where the next chunk starts
+	Status    string    `json:"status" firestore:"status"`
+	BlobKey   string    `json:"blob_key,omitempty" firestore:"blob_key"` // Where the file is stored once complete
+	Parts     []string  `json:"parts,omitempty" firestore:"parts"`       // Blob keys of the chunks received, in order
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" firestore:"updated_at"`
+}
+
+// Audit actions
+const (
+	AuditActionDeleteContent = "delete_content"
+	AuditActionDeleteQuiz    = "delete_quiz"
+)
+
+// AuditRecord records a permanent deletion. It keeps the IDs and counts of what was deleted, never its data.
+type AuditRecord struct {
+	AuditID     string    `json:"audit_id" firestore:"audit_id"`
+	Action      string    `json:"action" firestore:"action"`   // One of the AuditAction constants
+	UserID      string    `json:"user_id" firestore:"user_id"` // User who made the deletion
+	ContentID   string    `json:"content_id" firestore:"content_id"`
+	QuizID      string    `json:"quiz_id,omitempty" firestore:"quiz_id"` // Set when a single quiz was deleted
+	Quizzes     int       `json:"quizzes" firestore:"quizzes"`
+	Attempts    int       `json:"attempts" firestore:"attempts"`
+	ReviewCards int       `json:"review_cards" firestore:"review_cards"`
+	Jobs        int       `json:"jobs" firestore:"jobs"`
+	Extractions int       `json:"extractions" firestore:"extractions"`
+	CreatedAt   time.Time `json:"created_at" firestore:"created_at"`
+}
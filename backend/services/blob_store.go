@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"read-robin/config"
+
+	"google.golang.org/api/googleapi"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// maxComposeSources is the number of objects Cloud Storage combines in one compose request
+const maxComposeSources = 32
+
+// BlobStore stores uploaded files by key. Keys are slash-separated relative paths.
+type BlobStore interface {
+	// Put stores the contents of r at key, replacing any blob there, and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open returns a reader of the blob at key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Compose stores the concatenation of the blobs at parts at key, leaving the parts in place
+	Compose(ctx context.Context, key string, parts []string) error
+	// Delete deletes the blob at key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// URI returns the URI the model reads the blob at key from, or "" if the model cannot read the store
+	URI(key string) string
+}
+
+// NewBlobStore creates the BlobStore selected by cfg.BlobStore, or nil if uploads are disabled
+func NewBlobStore(ctx context.Context, cfg config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case config.BlobLocal:
+		return NewLocalBlobStore(cfg.BlobDir)
+	case config.BlobGCS:
+		return NewGCSBlobStore(ctx, cfg.BlobBucket)
+	case config.BlobNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported blob store: %q", cfg.BlobStore)
+	}
+}
+
+// checkBlobKey rejects keys that are not clean relative paths, which could reach outside the store
+func checkBlobKey(key string) error {
+	if key == "" || path.IsAbs(key) || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// LocalBlobStore stores blobs as files under a directory. The model cannot read local files, so they are
+// sent to it inline.
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore creates a LocalBlobStore in dir, creating the directory if needed
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving blob directory: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating blob directory: %v", err)
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// path returns the file of the blob at key
+func (ls *LocalBlobStore) path(key string) (string, error) {
+	if err := checkBlobKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(ls.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes r to a temporary file and renames it to the blob's file, so readers never see a partial blob
+func (ls *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	name, err := ls.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return 0, fmt.Errorf("error creating blob directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return 0, fmt.Errorf("error creating blob: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("error writing blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return n, fmt.Errorf("error saving blob: %v", err)
+	}
+	return n, nil
+}
+
+// Open opens the blob's file
+func (ls *LocalBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blob %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening blob: %v", err)
+	}
+	return f, nil
+}
+
+// Compose concatenates the parts' files into the blob's file
+func (ls *LocalBlobStore) Compose(ctx context.Context, key string, parts []string) error {
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		r, err := ls.Open(ctx, part)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		readers = append(readers, r)
+	}
+	_, err := ls.Put(ctx, key, io.MultiReader(readers...))
+	return err
+}
+
+// Delete removes the blob's file
+func (ls *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting blob: %v", err)
+	}
+	return nil
+}
+
+// URI returns "", since the model cannot read local files
+func (ls *LocalBlobStore) URI(key string) string {
+	return ""
+}
+
+// GCSBlobStore stores blobs as objects in a Cloud Storage bucket, which the model reads directly
+type GCSBlobStore struct {
+	bucket  string
+	service *storage.Service
+}
+
+// NewGCSBlobStore creates a GCSBlobStore in bucket using the default credentials
+func NewGCSBlobStore(ctx context.Context, bucket string) (*GCSBlobStore, error) {
+	if bucket == "" {
+		return nil, errors.New("BLOB_BUCKET must be set to store uploads in Cloud Storage")
+	}
+	// The context only authenticates the client, so it must outlive ctx
+	service, err := storage.NewService(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error creating storage client: %v", err)
+	}
+	return &GCSBlobStore{bucket: bucket, service: service}, nil
+}
+
+// Put uploads r as the object at key
+func (gs *GCSBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	if err := checkBlobKey(key); err != nil {
+		return 0, err
+	}
+	obj, err := gs.service.Objects.Insert(gs.bucket, &storage.Object{Name: key}).Media(r).Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("error uploading blob: %w", err)
+	}
+	return int64(obj.Size), nil
+}
+
+// Open downloads the object at key
+func (gs *GCSBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkBlobKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := gs.service.Objects.Get(gs.bucket, key).Context(ctx).Download()
+	if isGCSNotFound(err) {
+		return nil, fmt.Errorf("blob %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error downloading blob: %v", err)
+	}
+	return resp.Body, nil
+}
+
+// Compose combines the parts into the object at key, maxComposeSources at a time
+func (gs *GCSBlobStore) Compose(ctx context.Context, key string, parts []string) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		_, err := gs.Put(ctx, key, strings.NewReader(""))
+		return err
+	}
+	// Each request after the first appends to the object composed so far
+	composed := false
+	for start := 0; start < len(parts); {
+		request := &storage.ComposeRequest{Destination: &storage.Object{Name: key}}
+		if composed {
+			request.SourceObjects = append(request.SourceObjects, &storage.ComposeRequestSourceObjects{Name: key})
+		}
+		end := min(len(parts), start+maxComposeSources-len(request.SourceObjects))
+		for _, name := range parts[start:end] {
+			request.SourceObjects = append(request.SourceObjects, &storage.ComposeRequestSourceObjects{Name: name})
+		}
+		if _, err := gs.service.Objects.Compose(gs.bucket, key, request).Context(ctx).Do(); err != nil {
+			return fmt.Errorf("error composing blob: %v", err)
+		}
+		composed = true
+		start = end
+	}
+	return nil
+}
+
+// Delete deletes the object at key
+func (gs *GCSBlobStore) Delete(ctx context.Context, key string) error {
+	if err := checkBlobKey(key); err != nil {
+		return err
+	}
+	if err := gs.service.Objects.Delete(gs.bucket, key).Context(ctx).Do(); err != nil && !isGCSNotFound(err) {
+		return fmt.Errorf("error deleting blob: %v", err)
+	}
+	return nil
+}
+
+// URI returns the gs:// URI of the object at key
+func (gs *GCSBlobStore) URI(key string) string {
+	return "gs://" + gs.bucket + "/" + key
+}
+
+// isGCSNotFound reports whether err is a Cloud Storage 404 response
+func isGCSNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore: expected no error, got %v", err)
+	}
+	testBlobStore(t, store, "test")
+
+	if uri := store.URI("uploads/file.pdf"); uri != "" {
+		t.Errorf("URI: expected no URI for a local blob, got %q", uri)
+	}
+	for _, key := range []string{"", "../escape", "/etc/passwd", "uploads/../../escape"} {
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q): expected an invalid key error", key)
+		}
+	}
+}
+
+// TestGCSBlobStore runs the contract against a real bucket, named by BLOB_TEST_BUCKET
+func TestGCSBlobStore(t *testing.T) {
+	bucket := os.Getenv("BLOB_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("BLOB_TEST_BUCKET environment variable not set, skipping Cloud Storage integration test")
+	}
+	store, err := NewGCSBlobStore(context.Background(), bucket)
+	if err != nil {
+		t.Fatalf("NewGCSBlobStore: expected no error, got %v", err)
+	}
+	testBlobStore(t, store, fmt.Sprintf("test-%d", time.Now().UnixNano()))
+}
+
+// testBlobStore exercises the BlobStore contract against any implementation, under prefix
+func testBlobStore(t *testing.T, store BlobStore, prefix string) {
+	ctx := context.Background()
+	read := func(key string) string {
+		t.Helper()
+		r, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatalf("Open(%s): expected no error, got %v", key, err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Open(%s): error reading blob: %v", key, err)
+		}
+		return string(data)
+	}
+
+	if _, err := store.Open(ctx, prefix+"/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Open: expected ErrNotFound for a missing blob, got %v", err)
+	}
+	if err := store.Delete(ctx, prefix+"/missing"); err != nil {
+		t.Errorf("Delete: expected no error for a missing blob, got %v", err)
+	}
+
+	n, err := store.Put(ctx, prefix+"/file.txt", strings.NewReader("first"))
+	if err != nil || n != 5 {
+		t.Fatalf("Put: expected 5 bytes written, got %d, %v", n, err)
+	}
+	if _, err := store.Put(ctx, prefix+"/file.txt", strings.NewReader("replaced")); err != nil {
+		t.Fatalf("Put: expected no error replacing a blob, got %v", err)
+	}
+	if got := read(prefix + "/file.txt"); got != "replaced" {
+		t.Errorf("Open: expected the replaced blob, got %q", got)
+	}
+
+	// Compose more parts than Cloud Storage combines in one request
+	var parts []string
+	var expected strings.Builder
+	for i := range maxComposeSources + 3 {
+		part := fmt.Sprintf("%s/parts/%03d", prefix, i)
+		if _, err := store.Put(ctx, part, strings.NewReader(fmt.Sprintf("[%d]", i))); err != nil {
+			t.Fatalf("Put: expected no error, got %v", err)
+		}
+		parts = append(parts, part)
+		fmt.Fprintf(&expected, "[%d]", i)
+	}
+	if err := store.Compose(ctx, prefix+"/composed", parts); err != nil {
+		t.Fatalf("Compose: expected no error, got %v", err)
+	}
+	if got := read(prefix + "/composed"); got != expected.String() {
+		t.Errorf("Compose: expected the parts in order, got %q", got)
+	}
+	if got := read(parts[0]); got != "[0]" {
+		t.Errorf("Compose: expected the parts to be left in place, got %q", got)
+	}
+
+	for _, key := range append(parts, prefix+"/file.txt", prefix+"/composed") {
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete: expected no error, got %v", err)
+		}
+		if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete: expected ErrNotFound after deleting %s, got %v", key, err)
+		}
+	}
+}
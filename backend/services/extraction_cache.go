@@ -0,0 +1,120 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"read-robin/config"
+	"read-robin/models"
+)
+
+// ExtractionCache stores the content extracted from each source so that resubmitting an unchanged
+// source skips the LLM
+type ExtractionCache interface {
+	// GetExtraction retrieves the cached extraction of source, returning ErrNotFound if there is none
+	GetExtraction(ctx context.Context, source string) (*models.Extraction, error)
+	// SaveExtraction creates or replaces the cached extraction of extraction.Source
+	SaveExtraction(ctx context.Context, extraction models.Extraction) error
+}
+
+// NewExtractionCache creates the ExtractionCache selected by cfg.ExtractionCache, expiring entries after
+// cfg.ExtractionCacheTTL. It returns nil when caching is disabled.
+func NewExtractionCache(cfg config.Config, store Store) (ExtractionCache, error) {
+	var cache ExtractionCache
+	switch cfg.ExtractionCache {
+	case config.CacheStore:
+		cache = store
+	case config.CacheMemory:
+		cache = NewLRUExtractionCache(cfg.ExtractionCacheSize)
+	case config.CacheNone, "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported extraction cache: %q", cfg.ExtractionCache)
+	}
+	return WithTTL(cache, cfg.ExtractionCacheTTL), nil
+}
+
+// LRUExtractionCache is an in-memory ExtractionCache holding a bounded number of sources,
+// evicting the least recently used first
+type LRUExtractionCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List // Of models.Extraction, most recently used first
+	entries map[string]*list.Element
+}
+
+// NewLRUExtractionCache creates an LRUExtractionCache holding up to capacity sources
+func NewLRUExtractionCache(capacity int) *LRUExtractionCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUExtractionCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// GetExtraction retrieves the cached extraction of source, marking it as recently used
+func (lc *LRUExtractionCache) GetExtraction(ctx context.Context, source string) (*models.Extraction, error) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	element, ok := lc.entries[source]
+	if !ok {
+		return nil, fmt.Errorf("extraction of %s: %w", source, ErrNotFound)
+	}
+	lc.order.MoveToFront(element)
+	extraction := element.Value.(models.Extraction)
+	return &extraction, nil
+}
+
+// SaveExtraction caches extraction, evicting the least recently used source if the cache is full
+func (lc *LRUExtractionCache) SaveExtraction(ctx context.Context, extraction models.Extraction) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if element, ok := lc.entries[extraction.Source]; ok {
+		element.Value = extraction
+		lc.order.MoveToFront(element)
+		return nil
+	}
+	lc.entries[extraction.Source] = lc.order.PushFront(extraction)
+	if lc.order.Len() > lc.capacity {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.entries, oldest.Value.(models.Extraction).Source)
+	}
+	return nil
+}
+
+// expiringExtractionCache hides extractions older than ttl
+type expiringExtractionCache struct {
+	ExtractionCache
+	ttl time.Duration
+	now func() time.Time
+}
+
+// WithTTL wraps cache so that extractions older than ttl are treated as missing. A ttl of zero never expires.
+func WithTTL(cache ExtractionCache, ttl time.Duration) ExtractionCache {
+	if ttl <= 0 {
+		return cache
+	}
+	return &expiringExtractionCache{ExtractionCache: cache, ttl: ttl, now: time.Now}
+}
+
+// GetExtraction retrieves the cached extraction of source unless it has expired
+func (ec *expiringExtractionCache) GetExtraction(ctx context.Context, source string) (*models.Extraction, error) {
+	extraction, err := ec.ExtractionCache.GetExtraction(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	if ec.now().Sub(extraction.ExtractedAt) > ec.ttl {
+		return nil, fmt.Errorf("extraction of %s expired: %w", source, ErrNotFound)
+	}
+	return extraction, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"read-robin/config"
+	"read-robin/models"
+)
+
+func TestLRUExtractionCache(t *testing.T) {
+	t.Parallel()
+	testExtractionCache(t, NewLRUExtractionCache(10))
+}
+
+func TestLRUExtractionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	cache := NewLRUExtractionCache(2)
+
+	for _, source := range []string{"a", "b"} {
+		if err := cache.SaveExtraction(ctx, models.Extraction{Source: source}); err != nil {
+			t.Fatalf("SaveExtraction: expected no error, got %v", err)
+		}
+	}
+	// Reading "a" makes "b" the least recently used
+	if _, err := cache.GetExtraction(ctx, "a"); err != nil {
+		t.Fatalf("GetExtraction: expected no error, got %v", err)
+	}
+	if err := cache.SaveExtraction(ctx, models.Extraction{Source: "c"}); err != nil {
+		t.Fatalf("SaveExtraction: expected no error, got %v", err)
+	}
+
+	if _, err := cache.GetExtraction(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExtraction: expected b to be evicted, got %v", err)
+	}
+	for _, source := range []string{"a", "c"} {
+		if _, err := cache.GetExtraction(ctx, source); err != nil {
+			t.Errorf("GetExtraction: expected %s to be cached, got %v", source, err)
+		}
+	}
+}
+
+func TestWithTTL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now()
+	cache := WithTTL(NewLRUExtractionCache(10), time.Hour).(*expiringExtractionCache)
+	cache.now = func() time.Time { return now }
+
+	cache.SaveExtraction(ctx, models.Extraction{Source: "fresh", ExtractedAt: now.Add(-59 * time.Minute)})
+	cache.SaveExtraction(ctx, models.Extraction{Source: "stale", ExtractedAt: now.Add(-61 * time.Minute)})
+
+	if _, err := cache.GetExtraction(ctx, "fresh"); err != nil {
+		t.Errorf("GetExtraction: expected the fresh extraction, got %v", err)
+	}
+	if _, err := cache.GetExtraction(ctx, "stale"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExtraction: expected the stale extraction to expire, got %v", err)
+	}
+}
+
+func TestNewExtractionCache(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	testCases := []struct {
+		backend  string
+		disabled bool
+		wantErr  bool
+	}{
+		{config.CacheStore, false, false},
+		{config.CacheMemory, false, false},
+		{config.CacheNone, true, false},
+		{"redis", true, true},
+	}
+	for _, tc := range testCases {
+		cache, err := NewExtractionCache(config.Config{ExtractionCache: tc.backend, ExtractionCacheSize: 10, ExtractionCacheTTL: time.Hour}, store)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("NewExtractionCache(%q): unexpected error %v", tc.backend, err)
+		}
+		if (cache == nil) != tc.disabled {
+			t.Errorf("NewExtractionCache(%q): expected disabled %v, got %v", tc.backend, tc.disabled, cache)
+		}
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strconv"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"read-robin/models"
 	"read-robin/utils"
 
 	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // FirestoreClient is a wrapper around the Firestore client
@@ -33,80 +38,161 @@ func NewFirestoreClient(ctx context.Context) (*FirestoreClient, error) {
 	return &FirestoreClient{Client: client}, nil
 }
 
-// SaveQuiz saves a quiz, its title, and content text to Firestore, updating existing content if present
-func (fc *FirestoreClient) SaveQuiz(ctx context.Context, url, title, contentText string, quiz models.Quiz) error {
-	collection := "quizzes"
+// Close closes the underlying Firestore client
+func (fc *FirestoreClient) Close() error {
+	return fc.Client.Close()
+}
 
-	contentID := utils.GenerateID(url)
-	docRef := fc.Client.Collection(collection).Doc(contentID)
+// quizzesOf returns the subcollection holding the quizzes of contentID
+func (fc *FirestoreClient) quizzesOf(contentID string) *firestore.CollectionRef {
+	return fc.Client.Collection("quizzes").Doc(contentID).Collection("quizzes")
+}
 
-	// Get the existing document or create a new one
-	doc, err := docRef.Get(ctx)
-	var content models.Content
-	if err == nil {
-		if err := doc.DataTo(&content); err != nil {
-			return fmt.Errorf("failed to parse existing content: %v", err)
+// mergeQuizzes combines the quiz documents of a content's subcollection with the quizzes embedded in it
+// before they moved there, preferring the subcollection, ordered by quiz ID
+func mergeQuizzes(docs []*firestore.DocumentSnapshot, embedded []models.Quiz) ([]models.Quiz, error) {
+	quizzes := []models.Quiz{}
+	saved := make(map[string]bool)
+	for _, doc := range docs {
+		var quiz models.Quiz
+		if err := doc.DataTo(&quiz); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
 		}
-	} else {
-		content = models.Content{
-			URL:         url,
-			Timestamp:   time.Now(),
-			ContentID:   contentID,
-			Title:       title,
-			ContentText: contentText,
-			Quizzes:     []models.Quiz{},
+		saved[quiz.QuizID] = true
+		quizzes = append(quizzes, quiz)
+	}
+	for _, quiz := range embedded {
+		if !saved[quiz.QuizID] {
+			quizzes = append(quizzes, quiz)
 		}
 	}
+	sort.SliceStable(quizzes, func(i, j int) bool { return quizzes[i].QuizID < quizzes[j].QuizID })
+	return quizzes, nil
+}
 
-	// Update content text and title if they are different or new
-	if content.ContentText != contentText {
-		content.ContentText = contentText
-	}
-	if content.Title != title {
-		content.Title = title
-	}
+// SaveQuiz saves a quiz with the title, content text, anchors, segments and media metadata of source to Firestore, updating existing
+// content if present, and returns the quiz's ID. The quiz is written to the content's quizzes subcollection in a transaction
+// that allocates the next quiz ID if the quiz has none, and moves any quizzes still embedded in the
+// content into the subcollection.
+func (fc *FirestoreClient) SaveQuiz(ctx context.Context, source models.Content, quiz models.Quiz) (string, error) {
+	contentID := utils.GenerateContentID(source.OwnerID, source.URL)
+	contentRef := fc.Client.Collection("quizzes").Doc(contentID)
+	seqRef := fc.Client.Collection("quiz_sequences").Doc(contentID)
 
-	// Add the new quiz to the list of quizzes
-	content.Quizzes = append(content.Quizzes, quiz)
+	var quizID string
+	err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		quizID = quiz.QuizID
+		content := models.Content{
+			URL:       source.URL,
+			Timestamp: time.Now(),
+			ContentID: contentID,
+			OwnerID:   source.OwnerID,
+		}
+		doc, err := tx.Get(contentRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed retrieving content: %v", err)
+		}
+		if err == nil {
+			if err := doc.DataTo(&content); err != nil {
+				return fmt.Errorf("failed to parse existing content: %v", err)
+			}
+		}
 
-	// Set the updated content back to Firestore
-	_, err = docRef.Set(ctx, content)
+		seq := 0
+		seqDoc, err := tx.Get(seqRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed retrieving quiz sequence: %v", err)
+		}
+		if err == nil {
+			if last, ok := seqDoc.Data()["last_seq"].(int64); ok {
+				seq = int(last)
+			}
+		} else {
+			// Count from the content's existing quizzes the first time
+			quizDocs, err := tx.Documents(fc.quizzesOf(contentID)).GetAll()
+			if err != nil {
+				return fmt.Errorf("failed listing quizzes: %v", err)
+			}
+			for _, quizDoc := range quizDocs {
+				seq = max(seq, lastQuizSeq([]models.Quiz{{QuizID: quizDoc.Ref.ID}}))
+			}
+		}
+		seq = max(seq, lastQuizSeq(content.Quizzes))
+		if quizID == "" {
+			seq++
+			quizID = formatQuizID(seq)
+		} else {
+			seq = max(seq, lastQuizSeq([]models.Quiz{{QuizID: quizID}}))
+		}
+
+		for _, embedded := range content.Quizzes {
+			if embedded.QuizID == quizID {
+				continue
+			}
+			if err := tx.Set(fc.quizzesOf(contentID).Doc(embedded.QuizID), embedded); err != nil {
+				return err
+			}
+		}
+		content.Title = source.Title
+		content.ContentText = source.ContentText
+		content.Anchors = source.Anchors
+		content.Segments = source.Segments
+		content.Published = source.Published
+		content.Duration = source.Duration
+		content.Quizzes = nil
+		if err := tx.Set(contentRef, content); err != nil {
+			return err
+		}
+		if err := tx.Set(seqRef, map[string]interface{}{"last_seq": seq}); err != nil {
+			return err
+		}
+		saved := quiz
+		saved.QuizID = quizID
+		return tx.Set(fc.quizzesOf(contentID).Doc(quizID), saved)
+	})
 	if err != nil {
-		return fmt.Errorf("failed adding quiz: %v", err)
+		return "", fmt.Errorf("failed adding quiz: %w", err)
 	}
-	return nil
+	return quizID, nil
 }
 
 // GetQuiz retrieves a quiz from Firestore by contentID and quizID
 func (fc *FirestoreClient) GetQuiz(ctx context.Context, contentID, quizID string) (*models.Quiz, error) {
-	collection := "quizzes"
-
-	doc, err := fc.Client.Collection(collection).Doc(contentID).Get(ctx)
-	if err != nil {
+	doc, err := fc.quizzesOf(contentID).Doc(quizID).Get(ctx)
+	if err == nil {
+		var quiz models.Quiz
+		if err := doc.DataTo(&quiz); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		return &quiz, nil
+	}
+	if status.Code(err) != codes.NotFound {
 		return nil, fmt.Errorf("failed retrieving quiz: %v", err)
 	}
 
+	// Quizzes saved before they moved to the subcollection are embedded in their content
+	doc, err = fc.Client.Collection("quizzes").Doc(contentID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving quiz: %w", wrapNotFound(err))
+	}
 	var content models.Content
 	if err := doc.DataTo(&content); err != nil {
 		return nil, fmt.Errorf("dataTo: %v", err)
 	}
-
 	for _, quiz := range content.Quizzes {
 		if quiz.QuizID == quizID {
 			return &quiz, nil
 		}
 	}
 
-	return nil, fmt.Errorf("no quiz found for quizID: %s", quizID)
+	return nil, fmt.Errorf("no quiz found for quizID %s: %w", quizID, ErrNotFound)
 }
 
-// GetContent retrieves the entire content document from Firestore by contentID
+// GetContent retrieves the content document from Firestore by contentID, with its quizzes
 func (fc *FirestoreClient) GetContent(ctx context.Context, contentID string) (*models.Content, error) {
-	collection := "quizzes"
-
-	doc, err := fc.Client.Collection(collection).Doc(contentID).Get(ctx)
+	doc, err := fc.Client.Collection("quizzes").Doc(contentID).Get(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed retrieving content: %v", err)
+		return nil, fmt.Errorf("failed retrieving content: %w", wrapNotFound(err))
 	}
 
 	var content models.Content
@@ -114,34 +200,807 @@ func (fc *FirestoreClient) GetContent(ctx context.Context, contentID string) (*m
 		return nil, fmt.Errorf("dataTo: %v", err)
 	}
 
+	quizDocs, err := fc.quizzesOf(contentID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing quizzes: %v", err)
+	}
+	content.Quizzes, err = mergeQuizzes(quizDocs, content.Quizzes)
+	if err != nil {
+		return nil, err
+	}
 	return &content, nil
 }
 
 // GetExistingQuizzes fetches existing quizzes from Firestore
 func (fc *FirestoreClient) GetExistingQuizzes(ctx context.Context, contentID string) ([]models.Quiz, error) {
-	doc, err := fc.Client.Collection("quizzes").Doc(contentID).Get(ctx)
+	content, err := fc.GetContent(ctx, contentID)
 	if err != nil {
 		return nil, err
 	}
-	var existingContent models.Content
-	if err := doc.DataTo(&existingContent); err != nil {
-		return nil, err
+	return content.Quizzes, nil
+}
+
+// MigrateQuizzes moves the quizzes embedded in content documents into their quizzes subcollection, one
+// content per Firestore transaction, and returns the number of quizzes moved
+func (fc *FirestoreClient) MigrateQuizzes(ctx context.Context) (int, error) {
+	refs, err := fc.Client.Collection("quizzes").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed listing contents: %v", err)
+	}
+
+	moved := 0
+	for _, ref := range refs {
+		var quizzes int
+		err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			quizzes = 0
+			doc, err := tx.Get(ref)
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed retrieving content: %v", err)
+			}
+			var content models.Content
+			if err := doc.DataTo(&content); err != nil {
+				return fmt.Errorf("dataTo: %v", err)
+			}
+			if len(content.Quizzes) == 0 {
+				return nil
+			}
+			quizDocs, err := tx.Documents(fc.quizzesOf(ref.ID)).GetAll()
+			if err != nil {
+				return fmt.Errorf("failed listing quizzes: %v", err)
+			}
+
+			saved := make(map[string]bool)
+			for _, quizDoc := range quizDocs {
+				saved[quizDoc.Ref.ID] = true
+			}
+			for _, quiz := range content.Quizzes {
+				if saved[quiz.QuizID] {
+					continue
+				}
+				if err := tx.Set(fc.quizzesOf(ref.ID).Doc(quiz.QuizID), quiz); err != nil {
+					return err
+				}
+				quizzes++
+			}
+			return tx.Update(ref, []firestore.Update{{Path: "quizzes", Value: firestore.Delete}})
+		})
+		if err != nil {
+			return moved, fmt.Errorf("migrating quizzes of content %s: %w", ref.ID, err)
+		}
+		moved += quizzes
+	}
+	return moved, nil
+}
+
+// ResolveContentID returns the current ID of the content alias was migrated from, from Firestore
+func (fc *FirestoreClient) ResolveContentID(ctx context.Context, alias string) (string, error) {
+	doc, err := fc.Client.Collection("content_aliases").Doc(alias).Get(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed retrieving content alias: %w", wrapNotFound(err))
+	}
+	contentID, err := doc.DataAt("content_id")
+	if err != nil {
+		return "", fmt.Errorf("dataAt: %v", err)
+	}
+	id, _ := contentID.(string)
+	return id, nil
+}
+
+// SetSharedWith replaces the users, other than the owner, allowed to access contentID
+func (fc *FirestoreClient) SetSharedWith(ctx context.Context, contentID string, userIDs []string) error {
+	_, err := fc.Client.Collection("quizzes").Doc(contentID).Update(ctx, []firestore.Update{
+		{Path: "shared_with", Value: userIDs},
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating sharing: %w", wrapNotFound(err))
+	}
+	return nil
+}
+
+// contentSummaryFields are the fields of content documents that ListContents reads
+var contentSummaryFields = []string{"timestamp", "content_id", "url", "title", "owner_id", "published", "duration"}
+
+// ListContents returns a page of summaries of the content query.UserID owns or that is shared with them
+// from Firestore. The owned and the shared content are queried in the order of the page from its cursor,
+// each until one more than the page holds has matched, which is enough to fill the page and tell whether
+// another follows.
+func (fc *FirestoreClient) ListContents(ctx context.Context, query ContentQuery) (ContentPage, error) {
+	after, err := decodeContentCursor(query.Cursor)
+	if err != nil {
+		return ContentPage{}, err
+	}
+
+	field, direction := "timestamp", firestore.Asc
+	if query.SortBy == ContentSortTitle {
+		field = "title"
+	}
+	if query.Descending {
+		direction = firestore.Desc
+	}
+
+	collection := fc.Client.Collection("quizzes")
+	contents := []models.Content{}
+	seen := make(map[string]bool)
+	for _, listed := range []firestore.Query{
+		collection.Where("owner_id", "==", query.UserID),
+		collection.Where("shared_with", "array-contains", query.UserID),
+	} {
+		listed = listed.Select(contentSummaryFields...).OrderBy(field, direction).OrderBy("content_id", direction)
+		if after != nil {
+			var value any = after.Timestamp
+			if query.SortBy == ContentSortTitle {
+				value = after.Title
+			}
+			listed = listed.StartAfter(value, after.ContentID)
+		}
+		if query.Search == "" {
+			listed = listed.Limit(query.Limit + 1)
+		}
+
+		docs := listed.Documents(ctx)
+		for matched := 0; matched <= query.Limit; {
+			doc, err := docs.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				docs.Stop()
+				return ContentPage{}, fmt.Errorf("failed listing contents: %v", err)
+			}
+			var content models.Content
+			if err := doc.DataTo(&content); err != nil {
+				docs.Stop()
+				return ContentPage{}, fmt.Errorf("dataTo: %v", err)
+			}
+			if !query.matches(content) {
+				continue
+			}
+			matched++
+			if !seen[content.ContentID] {
+				seen[content.ContentID] = true
+				contents = append(contents, content)
+			}
+		}
+		docs.Stop()
+	}
+	return pageContents(contents, query, nil), nil
+}
+
+// SetTitle replaces the title of contentID
+func (fc *FirestoreClient) SetTitle(ctx context.Context, contentID, title string) error {
+	_, err := fc.Client.Collection("quizzes").Doc(contentID).Update(ctx, []firestore.Update{
+		{Path: "title", Value: title},
+	})
+	if err != nil {
+		return fmt.Errorf("failed updating title: %w", wrapNotFound(err))
 	}
-	return existingContent.Quizzes, nil
+	return nil
 }
 
-// GetLatestQuizID generates the next sequential quiz ID for the given quizzes
-func GetLatestQuizID(quizzes []models.Quiz) string {
-	if len(quizzes) == 0 {
-		return "0001"
+// DeleteQuiz deletes quizID of contentID with every user's attempts and review cards at it. The attempts
+// and review cards go first, so a deletion that fails part way can be run again.
+func (fc *FirestoreClient) DeleteQuiz(ctx context.Context, contentID, quizID string) (DeletionReport, error) {
+	if _, err := fc.GetQuiz(ctx, contentID, quizID); err != nil {
+		return DeletionReport{}, err
+	}
+	report, err := fc.deleteActivity(ctx, contentID, quizID)
+	if err != nil {
+		return report, err
+	}
+
+	contentRef := fc.Client.Collection("quizzes").Doc(contentID)
+	err = fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(contentRef)
+		if err != nil {
+			return fmt.Errorf("failed retrieving content: %w", wrapNotFound(err))
+		}
+		var content models.Content
+		if err := doc.DataTo(&content); err != nil {
+			return fmt.Errorf("dataTo: %v", err)
+		}
+		// Quizzes saved before they moved to the subcollection are embedded in their content
+		if i := slices.IndexFunc(content.Quizzes, func(quiz models.Quiz) bool { return quiz.QuizID == quizID }); i >= 0 {
+			err := tx.Update(contentRef, []firestore.Update{{Path: "quizzes", Value: slices.Delete(content.Quizzes, i, i+1)}})
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Delete(fc.quizzesOf(contentID).Doc(quizID))
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed deleting quiz: %w", err)
+	}
+	report.Quizzes = 1
+	return report, nil
+}
+
+// DeleteContent deletes contentID and all of its quizzes with every user's attempts and review cards at it,
+// the jobs that saved quizzes to it, its quiz sequence and the extraction cached for its URL. The attempts,
+// review cards and jobs go first, so a deletion that fails part way can be run again; the content, its
+// quizzes, sequence and extraction are then deleted in a Firestore transaction.
+func (fc *FirestoreClient) DeleteContent(ctx context.Context, contentID string) (DeletionReport, error) {
+	docRef := fc.Client.Collection("quizzes").Doc(contentID)
+	if _, err := docRef.Get(ctx); err != nil {
+		return DeletionReport{}, fmt.Errorf("failed retrieving content: %w", wrapNotFound(err))
+	}
+	report, err := fc.deleteActivity(ctx, contentID, "")
+	if err != nil {
+		return report, err
+	}
+	if report.Jobs, err = fc.deleteMatching(ctx, fc.Client.Collection("jobs").Where("result.content_id", "==", contentID)); err != nil {
+		return report, fmt.Errorf("failed deleting jobs: %v", err)
+	}
+
+	err = fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return fmt.Errorf("failed retrieving content: %w", wrapNotFound(err))
+		}
+		var content models.Content
+		if err := doc.DataTo(&content); err != nil {
+			return fmt.Errorf("dataTo: %v", err)
+		}
+		quizRefs, err := tx.DocumentRefs(fc.quizzesOf(contentID)).GetAll()
+		if err != nil {
+			return fmt.Errorf("failed listing quizzes: %v", err)
+		}
+		extractionRef := fc.Client.Collection("extractions").Doc(extractionDocID(content.URL))
+		_, err = tx.Get(extractionRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed retrieving extraction: %v", err)
+		}
+		report.Extractions = 0
+		if err == nil {
+			report.Extractions = 1
+			if err := tx.Delete(extractionRef); err != nil {
+				return fmt.Errorf("failed deleting extraction: %v", err)
+			}
+		}
+		if err := tx.Delete(fc.Client.Collection("quiz_sequences").Doc(contentID)); err != nil {
+			return fmt.Errorf("failed deleting quiz sequence: %v", err)
+		}
+		for _, quizRef := range quizRefs {
+			if err := tx.Delete(quizRef); err != nil {
+				return fmt.Errorf("failed deleting quiz: %v", err)
+			}
+		}
+		if err := tx.Delete(docRef); err != nil {
+			return fmt.Errorf("failed deleting content: %v", err)
+		}
+		report.Quizzes = len(quizRefs) + len(content.Quizzes)
+		return nil
+	})
+	return report, err
+}
+
+// deleteActivity deletes the attempts and review cards at contentID, only those at quizID if it is not empty
+func (fc *FirestoreClient) deleteActivity(ctx context.Context, contentID, quizID string) (DeletionReport, error) {
+	var report DeletionReport
+	attempts := fc.Client.Collection("attempts").Where("content_id", "==", contentID)
+	cards := fc.Client.Collection("review_cards").Where("content_id", "==", contentID)
+	if quizID != "" {
+		attempts = attempts.Where("quiz_id", "==", quizID)
+		cards = cards.Where("quiz_id", "==", quizID)
+	}
+
+	var err error
+	if report.Attempts, err = fc.deleteMatching(ctx, attempts); err != nil {
+		return report, fmt.Errorf("failed deleting attempts: %v", err)
+	}
+	if report.ReviewCards, err = fc.deleteMatching(ctx, cards); err != nil {
+		return report, fmt.Errorf("failed deleting review cards: %v", err)
+	}
+	return report, nil
+}
+
+// deleteMatching deletes the documents matched by query with a BulkWriter and returns how many there were
+func (fc *FirestoreClient) deleteMatching(ctx context.Context, query firestore.Query) (int, error) {
+	docs, err := query.Select().Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	writer := fc.Client.BulkWriter(ctx)
+	jobs := make([]*firestore.BulkWriterJob, 0, len(docs))
+	for _, doc := range docs {
+		job, err := writer.Delete(doc.Ref)
+		if err != nil {
+			writer.End()
+			return 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return 0, err
+		}
+	}
+	return len(docs), nil
+}
+
+// wrapNotFound translates a Firestore NotFound status into ErrNotFound
+func wrapNotFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+// MigrateIDs moves content saved under legacy IDs to its current ID and gives legacy questions ULIDs,
+// rewriting the attempts and review cards referring to them, one content per Firestore transaction
+func (fc *FirestoreClient) MigrateIDs(ctx context.Context) (IDMigrationReport, error) {
+	refs, err := fc.Client.Collection("quizzes").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return IDMigrationReport{}, fmt.Errorf("failed listing contents: %v", err)
+	}
+
+	var report IDMigrationReport
+	for _, ref := range refs {
+		var migrated IDMigrationReport
+		err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			var err error
+			migrated, err = fc.migrateContentIDs(tx, ref)
+			return err
+		})
+		if err != nil {
+			return report, fmt.Errorf("migrating content %s: %w", ref.ID, err)
+		}
+		report.Contents += migrated.Contents
+		report.Questions += migrated.Questions
+		report.Attempts += migrated.Attempts
+		report.ReviewCards += migrated.ReviewCards
+		report.Skipped += migrated.Skipped
+	}
+	return report, nil
+}
+
+// migrateContentIDs migrates the content at ref to its current ID, and its questions to ULIDs, within tx
+func (fc *FirestoreClient) migrateContentIDs(tx *firestore.Transaction, ref *firestore.DocumentRef) (IDMigrationReport, error) {
+	var report IDMigrationReport
+	doc, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return report, nil
+	}
+	if err != nil {
+		return report, fmt.Errorf("failed retrieving content: %v", err)
+	}
+	var content models.Content
+	if err := doc.DataTo(&content); err != nil {
+		return report, fmt.Errorf("dataTo: %v", err)
+	}
+
+	contentID := ref.ID
+	newID := utils.GenerateContentID(content.OwnerID, content.URL)
+	newRef := fc.Client.Collection("quizzes").Doc(newID)
+	if newID != contentID {
+		if _, err := tx.Get(newRef); err == nil {
+			report.Skipped++
+			newID, newRef = contentID, ref
+		} else if status.Code(err) != codes.NotFound {
+			return report, fmt.Errorf("failed checking content: %v", err)
+		}
+	}
+	quizDocs, err := tx.Documents(fc.quizzesOf(contentID)).GetAll()
+	if err != nil {
+		return report, fmt.Errorf("failed listing quizzes: %v", err)
+	}
+	quizzes, err := mergeQuizzes(quizDocs, content.Quizzes)
+	if err != nil {
+		return report, err
+	}
+	ids, questions := migrateQuestionIDs(quizzes)
+	if newID == contentID && questions == 0 {
+		return report, nil
+	}
+	report.Questions = questions
+
+	// Firestore transactions read everything before writing anything
+	attemptDocs, err := tx.Documents(fc.Client.Collection("attempts").Where("content_id", "==", contentID)).GetAll()
+	if err != nil {
+		return report, fmt.Errorf("failed listing attempts: %v", err)
+	}
+	cardDocs, err := tx.Documents(fc.Client.Collection("review_cards").Where("content_id", "==", contentID)).GetAll()
+	if err != nil {
+		return report, fmt.Errorf("failed listing review cards: %v", err)
+	}
+	seqRef := fc.Client.Collection("quiz_sequences").Doc(contentID)
+	seqDoc, err := tx.Get(seqRef)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return report, fmt.Errorf("failed retrieving quiz sequence: %v", err)
+	}
+
+	for _, attemptDoc := range attemptDocs {
+		var attempt models.Attempt
+		if err := attemptDoc.DataTo(&attempt); err != nil {
+			return report, fmt.Errorf("dataTo: %v", err)
+		}
+		if migrateAttempt(&attempt, newID, ids) {
+			if err := tx.Set(attemptDoc.Ref, attempt); err != nil {
+				return report, err
+			}
+			report.Attempts++
+		}
+	}
+	for _, cardDoc := range cardDocs {
+		var card models.ReviewCard
+		if err := cardDoc.DataTo(&card); err != nil {
+			return report, fmt.Errorf("dataTo: %v", err)
+		}
+		if !migrateReviewCard(&card, newID, ids) {
+			continue
+		}
+		if err := tx.Delete(cardDoc.Ref); err != nil {
+			return report, err
+		}
+		cardRef := fc.Client.Collection("review_cards").Doc(reviewCardDocID(card.UserID, card.ContentID, card.QuizID, card.QuestionID))
+		if err := tx.Set(cardRef, card); err != nil {
+			return report, err
+		}
+		report.ReviewCards++
+	}
+
+	content.ContentID = newID
+	content.Quizzes = nil
+	if err := tx.Set(newRef, content); err != nil {
+		return report, err
 	}
-	maxID := 0
 	for _, quiz := range quizzes {
-		id, err := strconv.Atoi(quiz.QuizID)
-		if err == nil && id > maxID {
-			maxID = id
+		if err := tx.Set(fc.quizzesOf(newID).Doc(quiz.QuizID), quiz); err != nil {
+			return report, err
+		}
+	}
+	if newID != contentID {
+		for _, quizDoc := range quizDocs {
+			if err := tx.Delete(quizDoc.Ref); err != nil {
+				return report, err
+			}
+		}
+		if err := tx.Delete(ref); err != nil {
+			return report, err
+		}
+		if err := tx.Set(fc.Client.Collection("content_aliases").Doc(contentID), map[string]interface{}{"content_id": newID}); err != nil {
+			return report, err
+		}
+		if seqDoc != nil && seqDoc.Exists() {
+			if err := tx.Set(fc.Client.Collection("quiz_sequences").Doc(newID), seqDoc.Data()); err != nil {
+				return report, err
+			}
+			if err := tx.Delete(seqRef); err != nil {
+				return report, err
+			}
+		}
+		report.Contents++
+	}
+	return report, nil
+}
+
+// SaveJob creates or replaces a job in Firestore
+func (fc *FirestoreClient) SaveJob(ctx context.Context, job models.Job) error {
+	_, err := fc.Client.Collection("jobs").Doc(job.JobID).Set(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed saving job: %v", err)
+	}
+	return nil
+}
+
+// GetJob retrieves a job from Firestore by jobID
+func (fc *FirestoreClient) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	doc, err := fc.Client.Collection("jobs").Doc(jobID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving job: %w", wrapNotFound(err))
+	}
+
+	var job models.Job
+	if err := doc.DataTo(&job); err != nil {
+		return nil, fmt.Errorf("dataTo: %v", err)
+	}
+	return &job, nil
+}
+
+// UpdateJob applies update to jobID inside a Firestore transaction
+func (fc *FirestoreClient) UpdateJob(ctx context.Context, jobID string, update func(*models.Job) error) (*models.Job, error) {
+	docRef := fc.Client.Collection("jobs").Doc(jobID)
+	var job models.Job
+	err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return fmt.Errorf("failed retrieving job: %w", wrapNotFound(err))
+		}
+		job = models.Job{}
+		if err := doc.DataTo(&job); err != nil {
+			return fmt.Errorf("dataTo: %v", err)
+		}
+		if err := update(&job); err != nil {
+			return err
+		}
+		return tx.Set(docRef, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListUnfinishedJobs returns queued and running jobs from Firestore, oldest first
+func (fc *FirestoreClient) ListUnfinishedJobs(ctx context.Context) ([]models.Job, error) {
+	docs, err := fc.Client.Collection("jobs").
+		Where("status", "in", []string{models.JobStatusQueued, models.JobStatusRunning}).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing jobs: %v", err)
+	}
+
+	jobs := make([]models.Job, 0, len(docs))
+	for _, doc := range docs {
+		var job models.Job
+		if err := doc.DataTo(&job); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// SaveAttempt creates or replaces an attempt in Firestore
+func (fc *FirestoreClient) SaveAttempt(ctx context.Context, attempt models.Attempt) error {
+	_, err := fc.Client.Collection("attempts").Doc(attempt.AttemptID).Set(ctx, attempt)
+	if err != nil {
+		return fmt.Errorf("failed saving attempt: %v", err)
+	}
+	return nil
+}
+
+// GetAttempt retrieves an attempt from Firestore by attemptID
+func (fc *FirestoreClient) GetAttempt(ctx context.Context, attemptID string) (*models.Attempt, error) {
+	doc, err := fc.Client.Collection("attempts").Doc(attemptID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving attempt: %w", wrapNotFound(err))
+	}
+
+	var attempt models.Attempt
+	if err := doc.DataTo(&attempt); err != nil {
+		return nil, fmt.Errorf("dataTo: %v", err)
+	}
+	return &attempt, nil
+}
+
+// UpdateAttempt applies update to attemptID inside a Firestore transaction
+func (fc *FirestoreClient) UpdateAttempt(ctx context.Context, attemptID string, update func(*models.Attempt) error) (*models.Attempt, error) {
+	docRef := fc.Client.Collection("attempts").Doc(attemptID)
+	var attempt models.Attempt
+	err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return fmt.Errorf("failed retrieving attempt: %w", wrapNotFound(err))
+		}
+		attempt = models.Attempt{}
+		if err := doc.DataTo(&attempt); err != nil {
+			return fmt.Errorf("dataTo: %v", err)
+		}
+		if err := update(&attempt); err != nil {
+			return err
+		}
+		return tx.Set(docRef, attempt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// ListAttempts returns userID's attempts from Firestore, newest first, only those at contentID if it is not empty
+func (fc *FirestoreClient) ListAttempts(ctx context.Context, userID, contentID string) ([]models.Attempt, error) {
+	query := fc.Client.Collection("attempts").Where("user_id", "==", userID)
+	if contentID != "" {
+		query = query.Where("content_id", "==", contentID)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing attempts: %v", err)
+	}
+
+	attempts := make([]models.Attempt, 0, len(docs))
+	for _, doc := range docs {
+		var attempt models.Attempt
+		if err := doc.DataTo(&attempt); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	sortAttempts(attempts)
+	return attempts, nil
+}
+
+// reviewCardDocID returns the Firestore document ID of userID's card for a question
+func reviewCardDocID(userID, contentID, quizID, questionID string) string {
+	return utils.ContentHash(strings.Join([]string{userID, contentID, quizID, questionID}, "/"))
+}
+
+// UpdateReviewCard applies update to userID's card for the question inside a Firestore transaction
+func (fc *FirestoreClient) UpdateReviewCard(ctx context.Context, userID, contentID, quizID, questionID string, update func(*models.ReviewCard) error) (*models.ReviewCard, error) {
+	docRef := fc.Client.Collection("review_cards").Doc(reviewCardDocID(userID, contentID, quizID, questionID))
+	var card models.ReviewCard
+	err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		card = models.ReviewCard{UserID: userID, ContentID: contentID, QuizID: quizID, QuestionID: questionID}
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed retrieving review card: %v", err)
+		}
+		if err == nil {
+			if err := doc.DataTo(&card); err != nil {
+				return fmt.Errorf("dataTo: %v", err)
+			}
 		}
+		if err := update(&card); err != nil {
+			return err
+		}
+		return tx.Set(docRef, card)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// ListDueReviewCards returns userID's cards due at or before now from Firestore, earliest due first
+func (fc *FirestoreClient) ListDueReviewCards(ctx context.Context, userID string, now time.Time) ([]models.ReviewCard, error) {
+	docs, err := fc.Client.Collection("review_cards").
+		Where("user_id", "==", userID).
+		Where("due_at", "<=", now).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing review cards: %v", err)
+	}
+
+	cards := make([]models.ReviewCard, 0, len(docs))
+	for _, doc := range docs {
+		var card models.ReviewCard
+		if err := doc.DataTo(&card); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		cards = append(cards, card)
+	}
+	sortReviewCards(cards)
+	return cards, nil
+}
+
+// SaveAuditRecord creates an audit record in Firestore
+func (fc *FirestoreClient) SaveAuditRecord(ctx context.Context, record models.AuditRecord) error {
+	_, err := fc.Client.Collection("audit_records").Doc(record.AuditID).Set(ctx, record)
+	if err != nil {
+		return fmt.Errorf("failed saving audit record: %v", err)
 	}
-	nextID := fmt.Sprintf("%04d", maxID+1)
-	return nextID
+	return nil
+}
+
+// ListAuditRecords returns the records of the deletions userID made from Firestore, newest first
+func (fc *FirestoreClient) ListAuditRecords(ctx context.Context, userID string) ([]models.AuditRecord, error) {
+	docs, err := fc.Client.Collection("audit_records").Where("user_id", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing audit records: %v", err)
+	}
+
+	records := make([]models.AuditRecord, 0, len(docs))
+	for _, doc := range docs {
+		var record models.AuditRecord
+		if err := doc.DataTo(&record); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		records = append(records, record)
+	}
+	sortAuditRecords(records)
+	return records, nil
+}
+
+// SaveUpload creates or replaces an upload in Firestore
+func (fc *FirestoreClient) SaveUpload(ctx context.Context, upload models.Upload) error {
+	_, err := fc.Client.Collection("uploads").Doc(upload.UploadID).Set(ctx, upload)
+	if err != nil {
+		return fmt.Errorf("failed saving upload: %v", err)
+	}
+	return nil
+}
+
+// GetUpload retrieves an upload from Firestore by uploadID
+func (fc *FirestoreClient) GetUpload(ctx context.Context, uploadID string) (*models.Upload, error) {
+	doc, err := fc.Client.Collection("uploads").Doc(uploadID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving upload: %w", wrapNotFound(err))
+	}
+
+	var upload models.Upload
+	if err := doc.DataTo(&upload); err != nil {
+		return nil, fmt.Errorf("dataTo: %v", err)
+	}
+	return &upload, nil
+}
+
+// UpdateUpload applies update to uploadID inside a Firestore transaction
+func (fc *FirestoreClient) UpdateUpload(ctx context.Context, uploadID string, update func(*models.Upload) error) (*models.Upload, error) {
+	docRef := fc.Client.Collection("uploads").Doc(uploadID)
+	var upload models.Upload
+	err := fc.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil {
+			return fmt.Errorf("failed retrieving upload: %w", wrapNotFound(err))
+		}
+		upload = models.Upload{}
+		if err := doc.DataTo(&upload); err != nil {
+			return fmt.Errorf("dataTo: %v", err)
+		}
+		if err := update(&upload); err != nil {
+			return err
+		}
+		return tx.Set(docRef, upload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// ListPendingUploads returns the uploads still pending in Firestore that were created before createdBefore,
+// oldest first. Pending uploads are few, so they are filtered by creation time here rather than in a query
+// needing a composite index.
+func (fc *FirestoreClient) ListPendingUploads(ctx context.Context, createdBefore time.Time) ([]models.Upload, error) {
+	docs, err := fc.Client.Collection("uploads").
+		Where("status", "==", models.UploadStatusPending).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing uploads: %v", err)
+	}
+
+	uploads := []models.Upload{}
+	for _, doc := range docs {
+		var upload models.Upload
+		if err := doc.DataTo(&upload); err != nil {
+			return nil, fmt.Errorf("dataTo: %v", err)
+		}
+		if upload.CreatedAt.Before(createdBefore) {
+			uploads = append(uploads, upload)
+		}
+	}
+	sortUploads(uploads)
+	return uploads, nil
+}
+
+// DeleteUpload deletes uploadID from Firestore
+func (fc *FirestoreClient) DeleteUpload(ctx context.Context, uploadID string) error {
+	if _, err := fc.Client.Collection("uploads").Doc(uploadID).Delete(ctx); err != nil {
+		return fmt.Errorf("failed deleting upload: %v", err)
+	}
+	return nil
+}
+
+// extractionDocID returns the Firestore document ID for source, which may contain slashes
+func extractionDocID(source string) string {
+	return utils.ContentHash(source)
+}
+
+// GetExtraction retrieves the cached extraction of source from Firestore
+func (fc *FirestoreClient) GetExtraction(ctx context.Context, source string) (*models.Extraction, error) {
+	doc, err := fc.Client.Collection("extractions").Doc(extractionDocID(source)).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving extraction: %w", wrapNotFound(err))
+	}
+
+	var extraction models.Extraction
+	if err := doc.DataTo(&extraction); err != nil {
+		return nil, fmt.Errorf("dataTo: %v", err)
+	}
+	return &extraction, nil
+}
+
+// SaveExtraction creates or replaces the cached extraction of extraction.Source in Firestore
+func (fc *FirestoreClient) SaveExtraction(ctx context.Context, extraction models.Extraction) error {
+	_, err := fc.Client.Collection("extractions").Doc(extractionDocID(extraction.Source)).Set(ctx, extraction)
+	if err != nil {
+		return fmt.Errorf("failed saving extraction: %v", err)
+	}
+	return nil
 }
@@ -21,7 +21,7 @@ func TestSaveQuiz(t *testing.T) {
 
 	projectID := os.Getenv("GCP_PROJECT")
 	if projectID == "" {
-		t.Fatal("GCP_PROJECT environment variable not set")
+		t.Skip("GCP_PROJECT environment variable not set, skipping Firestore integration test")
 	}
 
 	firestoreClient, err := NewFirestoreClient(ctx)
@@ -50,7 +50,7 @@ func TestSaveQuiz(t *testing.T) {
 	contentText := "The 'Example Domain' is for use in illustrative examples in documents."
 	contentID := utils.GenerateID(contentURL)
 
-	err = firestoreClient.SaveQuiz(ctx, contentURL, contentTitle, contentText, quiz)
+	_, err = firestoreClient.SaveQuiz(ctx, models.Content{URL: contentURL, Title: contentTitle, ContentText: contentText}, quiz)
 	if err != nil {
 		t.Fatalf("SaveQuiz: expected no error, got %v", err)
 	}
@@ -74,12 +74,23 @@ func TestSaveQuiz(t *testing.T) {
 		t.Errorf("SaveQuiz: expected content text %v, got %v", contentText, content.ContentText)
 	}
 
-	if len(content.Quizzes) == 0 {
-		t.Fatalf("SaveQuiz: expected quizzes to be saved, got none")
+	if len(content.Quizzes) != 0 {
+		t.Errorf("SaveQuiz: expected no quizzes embedded in the content, got %d", len(content.Quizzes))
 	}
 
-	if content.Quizzes[0].QuizID != quiz.QuizID {
-		t.Errorf("SaveQuiz: expected quizID %v, got %v", quiz.QuizID, content.Quizzes[0].QuizID)
+	// Quizzes are saved to the content's quizzes subcollection
+	quizDoc, err := firestoreClient.Client.Collection("quizzes").Doc(contentID).Collection("quizzes").Doc(quiz.QuizID).Get(ctx)
+	if err != nil {
+		t.Fatalf("Failed to retrieve quiz document: %v", err)
+	}
+
+	var savedQuiz models.Quiz
+	if err := quizDoc.DataTo(&savedQuiz); err != nil {
+		t.Fatalf("Failed to parse quiz: %v", err)
+	}
+
+	if savedQuiz.QuizID != quiz.QuizID {
+		t.Errorf("SaveQuiz: expected quizID %v, got %v", quiz.QuizID, savedQuiz.QuizID)
 	}
 }
 
@@ -91,7 +102,7 @@ func TestGetQuiz(t *testing.T) {
 
 	projectID := os.Getenv("GCP_PROJECT")
 	if projectID == "" {
-		t.Fatal("GCP_PROJECT environment variable not set")
+		t.Skip("GCP_PROJECT environment variable not set, skipping Firestore integration test")
 	}
 
 	firestoreClient, err := NewFirestoreClient(ctx)
@@ -121,7 +132,7 @@ func TestGetQuiz(t *testing.T) {
 	contentID := utils.GenerateID(contentURL)
 
 	// Save the quiz to Firestore first
-	err = firestoreClient.SaveQuiz(ctx, contentURL, contentTitle, contentText, quiz)
+	_, err = firestoreClient.SaveQuiz(ctx, models.Content{URL: contentURL, Title: contentTitle, ContentText: contentText}, quiz)
 	if err != nil {
 		t.Fatalf("SaveQuiz: expected no error, got %v", err)
 	}
@@ -157,8 +168,9 @@ func TestMain(m *testing.M) {
 	ctx := context.Background()
 	projectID := os.Getenv("GCP_PROJECT")
 	if projectID == "" {
-		fmt.Println("GCP_PROJECT environment variable not set")
-		os.Exit(1)
+		// Only the Firestore integration tests need a project; they skip themselves
+		fmt.Println("GCP_PROJECT environment variable not set, Firestore tests will be skipped")
+		os.Exit(m.Run())
 	}
 
 	firestoreClient, err := firestore.NewClient(ctx, projectID)
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 
+	"read-robin/services/llm"
+
 	"cloud.google.com/go/vertexai/genai"
 )
 
@@ -15,11 +17,19 @@ const (
 // GeminiClient is a wrapper around the Vertex AI GenAI client
 type GeminiClient struct {
 	client *genai.Client
+	model  string
 }
 
-// NewGeminiClient creates a new GeminiClient
+// GeminiClient is the Vertex AI implementation of llm.Provider
+var _ llm.Provider = (*GeminiClient)(nil)
+
+// NewGeminiClient creates a new GeminiClient using the default location and model
 func NewGeminiClient(ctx context.Context) (*GeminiClient, error) {
-	projectID := os.Getenv("GCP_PROJECT")
+	return NewGeminiClientWithModel(ctx, os.Getenv("GCP_PROJECT"), location, modelName)
+}
+
+// NewGeminiClientWithModel creates a new GeminiClient for the given Vertex AI location and model
+func NewGeminiClientWithModel(ctx context.Context, projectID, location, model string) (*GeminiClient, error) {
 	if projectID == "" {
 		return nil, fmt.Errorf("GCP_PROJECT environment variable not set")
 	}
@@ -28,5 +38,11 @@ func NewGeminiClient(ctx context.Context) (*GeminiClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error creating client: %w", err)
 	}
-	return &GeminiClient{client: client}, nil
+
+	return &GeminiClient{client: client, model: model}, nil
+}
+
+// Close closes the underlying Vertex AI client
+func (gc *GeminiClient) Close() error {
+	return gc.client.Close()
 }
@@ -0,0 +1,14 @@
+package gemini
+
+import (
+	"os"
+	"testing"
+)
+
+// requireProject skips tests that call Vertex AI when no GCP project is configured
+func requireProject(t *testing.T) {
+	t.Helper()
+	if os.Getenv("GCP_PROJECT") == "" {
+		t.Skip("GCP_PROJECT environment variable not set, skipping Gemini integration test")
+	}
+}
@@ -2,10 +2,8 @@ package gemini
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"read-robin/models"
+	"read-robin/services/llm"
 
 	"cloud.google.com/go/vertexai/genai"
 )
@@ -18,65 +16,21 @@ const (
     }`
 )
 
-type pdfPrompt struct {
-	pdfPath string
-}
-
 // extractContentFromPDF extracts readable text and title from PDF content using the Gemini model
 func (gc *GeminiClient) ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error) {
-	model := gc.client.GenerativeModel(modelName)
+	return gc.extractContentFromFile(ctx, pdfModelSystemInstructions, "application/pdf", pdfPath)
+}
 
-	part := genai.FileData{
+// TranscribePdfPages reads the text of the given pages of a PDF sent inline, for pages without a text layer
+func (gc *GeminiClient) TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error) {
+	part := genai.Blob{
 		MIMEType: "application/pdf",
-		FileURI:  pdfPath,
+		Data:     pdf,
 	}
 
-	fmt.Printf("Extracting content from PDF: %s\n", pdfPath)
-	res, err := model.GenerateContent(ctx, genai.Text(pdfModelSystemInstructions), part)
+	text, fullResponse, err := gc.generateParts(ctx, gc.structuredModel(llm.PageTranscriptionSystemInstructions, llm.PagesSchema), part, genai.Text(llm.PageTranscriptionPrompt(pages)))
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to generate contents: %w", err)
 	}
-
-	if len(res.Candidates) == 0 || len(res.Candidates[0].Content.Parts) == 0 {
-		return nil, "", errors.New("empty response from model")
-	}
-
-	content := res.Candidates[0].Content.Parts[0]
-
-	contentText := fmt.Sprintf("%s", content)
-
-	// Parse the JSON response to extract content and title
-	var contentMap map[string]string
-	if err := json.Unmarshal([]byte(contentText), &contentMap); err != nil {
-		return nil, "", fmt.Errorf("json.Unmarshal: %w", err)
-	}
-
-	// Convert the response to a readable format
-	fullResponse, err := json.MarshalIndent(res, "", "  ")
-	if err != nil {
-		return nil, "", fmt.Errorf("json.MarshalIndent: %w", err)
-	}
-
-	return contentMap, string(fullResponse), nil
-}
-
-func (gc *GeminiClient) GenerateQuizFromPDF(ctx context.Context, pdfPath string, persona models.Persona) (string, error) {
-	prompt := pdfPrompt{
-		pdfPath: pdfPath,
-	}
-
-	contentMap, fullHTML, err := gc.ExtractContentFromPdf(ctx, prompt.pdfPath)
-	if err != nil {
-		return "", fmt.Errorf("error generating content from PDF: %w", err)
-	}
-
-	fmt.Printf("Generating quiz from PDF content: %s\n", contentMap)
-	fmt.Print(fullHTML)
-	promptText := fmt.Sprintf("Generate a quiz for a %s (%s) at %s difficulty level based on the following content: %s", persona.Role, persona.Language, persona.Difficulty, contentMap)
-	quizContent, _, err := gc.generateContent(ctx, quizModelSystemInstructions, promptText)
-	if err != nil {
-		return "", fmt.Errorf("error generating quiz: %w", err)
-	}
-
-	return quizContent, nil
+	return llm.DecodePages(ctx, text, fullResponse, pages, gc.repair(llm.PagesSchema))
 }
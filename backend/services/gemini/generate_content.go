@@ -3,26 +3,42 @@ package gemini
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
+	"read-robin/services/llm"
+
 	"cloud.google.com/go/vertexai/genai"
+	"google.golang.org/api/iterator"
 )
 
 const (
+	// modelName is the default Gemini model used by NewGeminiClient
 	modelName = "gemini-1.5-pro"
 )
 
 // Helper function to generate content using Gemini model
-func (gc *GeminiClient) generateContent(ctx context.Context, systemInstructions, promptText string) (string, string, error) {
-	geminiModel := gc.client.GenerativeModel(modelName)
-	geminiModel.SystemInstruction = &genai.Content{
-		Parts: []genai.Part{genai.Text(systemInstructions)},
-	}
+func (gc *GeminiClient) generateContent(ctx context.Context, systemInstructions, promptText string, schema *llm.Schema) (string, string, error) {
+	return gc.generateParts(ctx, gc.structuredModel(systemInstructions, schema), genai.Text(promptText))
+}
 
-	prompt := genai.Text(promptText)
+// structuredModel returns the configured model with systemInstructions, if any, constrained to JSON responses matching schema
+func (gc *GeminiClient) structuredModel(systemInstructions string, schema *llm.Schema) *genai.GenerativeModel {
+	geminiModel := gc.client.GenerativeModel(gc.model)
+	if systemInstructions != "" {
+		geminiModel.SystemInstruction = &genai.Content{
+			Parts: []genai.Part{genai.Text(systemInstructions)},
+		}
+	}
+	geminiModel.ResponseMIMEType = "application/json"
+	geminiModel.ResponseSchema = toGenaiSchema(schema)
+	return geminiModel
+}
 
-	resp, err := geminiModel.GenerateContent(ctx, prompt)
+// generateParts sends parts to geminiModel and returns the response text and the full response as JSON
+func (gc *GeminiClient) generateParts(ctx context.Context, geminiModel *genai.GenerativeModel, parts ...genai.Part) (string, string, error) {
+	resp, err := geminiModel.GenerateContent(ctx, parts...)
 	if err != nil {
 		return "", "", fmt.Errorf("error generating content: %w", err)
 	}
@@ -33,9 +49,6 @@ func (gc *GeminiClient) generateContent(ctx context.Context, systemInstructions,
 		return "", "", fmt.Errorf("json.MarshalIndent: %w", err)
 	}
 
-	// Debug: Print the full response structure
-	fmt.Printf("Full response: %s\n", fullResponse)
-
 	// Extract the text from the parts
 	var partContent strings.Builder
 	for _, cand := range resp.Candidates {
@@ -45,6 +58,109 @@ func (gc *GeminiClient) generateContent(ctx context.Context, systemInstructions,
 			}
 		}
 	}
+	if partContent.Len() == 0 {
+		return "", "", errors.New("empty response from model")
+	}
+
+	return partContent.String(), string(fullResponse), nil
+}
+
+// extractContentFromFile extracts the content and title of a media file with instructions, repairing an invalid response
+func (gc *GeminiClient) extractContentFromFile(ctx context.Context, instructions, mimeType, uri string) (map[string]string, string, error) {
+	part, err := filePart(mimeType, uri)
+	if err != nil {
+		return nil, "", err
+	}
+	contentText, fullResponse, err := gc.generateParts(ctx, gc.structuredModel("", llm.ExtractionSchema), genai.Text(instructions), part)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to generate contents: %w", err)
+	}
+	return llm.DecodeExtraction(ctx, contentText, fullResponse, gc.repair(llm.ExtractionSchema))
+}
+
+// filePart returns the part pointing the model at the file at uri, which it reads itself. Only http, https
+// and gs:// URIs are sent; local files are never read here, and reach the model inline from their caller.
+func filePart(mimeType, uri string) (genai.Part, error) {
+	scheme, _, _ := strings.Cut(strings.ToLower(uri), "://")
+	if scheme != "http" && scheme != "https" && scheme != "gs" {
+		return nil, fmt.Errorf("file URI %q: %w", uri, llm.ErrUnsupported)
+	}
+	return genai.FileData{MIMEType: mimeType, FileURI: uri}, nil
+}
+
+// repair returns an llm.RepairFunc that asks the model to correct a response that does not match schema
+func (gc *GeminiClient) repair(schema *llm.Schema) llm.RepairFunc {
+	return func(ctx context.Context, prompt string) (string, string, error) {
+		return gc.generateContent(ctx, llm.RepairSystemInstructions, prompt, schema)
+	}
+}
+
+// toGenaiSchema converts an llm.Schema to the Vertex AI schema type
+func toGenaiSchema(schema *llm.Schema) *genai.Schema {
+	if schema == nil {
+		return nil
+	}
+
+	converted := &genai.Schema{
+		Type:     genaiTypes[schema.Type],
+		Required: schema.Required,
+		Enum:     schema.Enum,
+		Items:    toGenaiSchema(schema.Items),
+	}
+	if len(schema.Properties) > 0 {
+		converted.Properties = make(map[string]*genai.Schema, len(schema.Properties))
+		for name, property := range schema.Properties {
+			converted.Properties[name] = toGenaiSchema(property)
+		}
+	}
+	return converted
+}
+
+var genaiTypes = map[string]genai.Type{
+	llm.TypeObject:  genai.TypeObject,
+	llm.TypeArray:   genai.TypeArray,
+	llm.TypeString:  genai.TypeString,
+	llm.TypeInteger: genai.TypeInteger,
+	llm.TypeBoolean: genai.TypeBoolean,
+}
+
+// generateContentStream generates content like generateContent, calling onText with the text of each
+// streamed response as it arrives
+func (gc *GeminiClient) generateContentStream(ctx context.Context, systemInstructions, promptText string, schema *llm.Schema, onText func(string) error) (string, string, error) {
+	geminiModel := gc.structuredModel(systemInstructions, schema)
+
+	iter := geminiModel.GenerateContentStream(ctx, genai.Text(promptText))
+
+	var partContent strings.Builder
+	var responses []*genai.GenerateContentResponse
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("error generating content: %w", err)
+		}
+		responses = append(responses, resp)
+
+		var chunk strings.Builder
+		for _, cand := range resp.Candidates {
+			if cand.Content != nil {
+				for _, part := range cand.Content.Parts {
+					chunk.WriteString(fmt.Sprintf("%s", part))
+				}
+			}
+		}
+		partContent.WriteString(chunk.String())
+		if err := onText(chunk.String()); err != nil {
+			return "", "", err
+		}
+	}
+
+	fullResponse, err := json.MarshalIndent(responses, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("json.MarshalIndent: %w", err)
+	}
 
 	return partContent.String(), string(fullResponse), nil
 }
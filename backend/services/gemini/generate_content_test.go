@@ -0,0 +1,49 @@
+package gemini
+
+import (
+	"errors"
+	"testing"
+
+	"read-robin/services/llm"
+
+	"cloud.google.com/go/vertexai/genai"
+)
+
+func TestToGenaiSchema(t *testing.T) {
+	t.Parallel()
+	schema := toGenaiSchema(llm.QuizSchema)
+	if schema.Type != genai.TypeObject || len(schema.Required) != 1 || schema.Required[0] != "quiz" {
+		t.Fatalf("toGenaiSchema: unexpected root schema %+v", schema)
+	}
+
+	question := schema.Properties["quiz"].Items
+	if question == nil || question.Type != genai.TypeObject {
+		t.Fatalf("toGenaiSchema: expected an array of objects, got %+v", schema.Properties["quiz"])
+	}
+	if got := question.Properties["type"]; got.Type != genai.TypeString || len(got.Enum) != 4 {
+		t.Errorf("toGenaiSchema: expected a string enum for the question type, got %+v", got)
+	}
+	choice := question.Properties["multiple_choice"].Properties["correct_index"]
+	if choice.Type != genai.TypeInteger {
+		t.Errorf("toGenaiSchema: expected an integer correct_index, got %+v", choice)
+	}
+	if toGenaiSchema(nil) != nil {
+		t.Errorf("toGenaiSchema: expected nil for a nil schema")
+	}
+}
+
+func TestFilePart(t *testing.T) {
+	t.Parallel()
+	for _, uri := range []string{"gs://bucket/talk.mp3", "https://example.com/talk.mp3", "HTTP://example.com/talk.mp3"} {
+		part, err := filePart("audio/mpeg", uri)
+		if expected := (genai.FileData{MIMEType: "audio/mpeg", FileURI: uri}); err != nil || part != expected {
+			t.Errorf("filePart(%q) = %v, %v; want the file data", uri, part, err)
+		}
+	}
+
+	for _, uri := range []string{"file:///proc/self/environ", "/etc/passwd", "ftp://example.com/talk.mp3", ""} {
+		if part, err := filePart("audio/mpeg", uri); !errors.Is(err, llm.ErrUnsupported) {
+			t.Errorf("filePart(%q) = %v, %v; want ErrUnsupported", uri, part, err)
+		}
+	}
+}
@@ -14,7 +14,7 @@ func TestGenerateQuiz(t *testing.T) {
 	// Ensure the environment variable is set for the test
 	projectID := os.Getenv("GCP_PROJECT")
 	if projectID == "" {
-		t.Fatal("GCP_PROJECT environment variable not set")
+		t.Skip("GCP_PROJECT environment variable not set, skipping Gemini integration test")
 	}
 
 	geminiClient, err := NewGeminiClient(ctx)
@@ -37,7 +37,7 @@ func TestGenerateQuiz(t *testing.T) {
 		Difficulty: "Intermediate",
 	}
 
-	quiz, fullQuiz, err := geminiClient.GenerateQuiz(ctx, contentMap["content"], testPersona)
+	quiz, fullQuiz, err := geminiClient.GenerateQuiz(ctx, contentMap["content"], testPersona, models.QuizOptions{})
 	if err != nil {
 		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
 	}
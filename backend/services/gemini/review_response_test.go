@@ -14,7 +14,7 @@ func TestReviewResponse(t *testing.T) {
 	// Ensure the environment variable is set for the test
 	projectID := os.Getenv("GCP_PROJECT")
 	if projectID == "" {
-		t.Fatal("GCP_PROJECT environment variable not set")
+		t.Skip("GCP_PROJECT environment variable not set, skipping Gemini integration test")
 	}
 
 	geminiClient, err := NewGeminiClient(ctx)
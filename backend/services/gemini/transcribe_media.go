@@ -0,0 +1,44 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"read-robin/services/llm"
+	"read-robin/utils"
+
+	"cloud.google.com/go/vertexai/genai"
+)
+
+// TranscribeMedia transcribes audio or video into timed segments and generates a title, sending inline
+// media as a blob and pointing the model at the URI of the rest
+func (gc *GeminiClient) TranscribeMedia(ctx context.Context, media llm.Media) (*llm.Transcript, string, error) {
+	var part genai.Part = genai.Blob{MIMEType: media.MIMEType, Data: media.Data}
+	if media.Data == nil {
+		var err error
+		if part, err = filePart(mediaMIMEType(media.URI), media.URI); err != nil {
+			return nil, "", err
+		}
+	}
+
+	text, fullResponse, err := gc.generateParts(ctx, gc.structuredModel(llm.MediaTranscriptionSystemInstructions, llm.TranscriptSchema), part)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to generate contents: %w", err)
+	}
+	return llm.DecodeTranscript(ctx, text, fullResponse, gc.repair(llm.TranscriptSchema))
+}
+
+// mediaMIMEType returns the MIME type of the media at mediaPath from its extension, ignoring the query of
+// URLs such as podcast episodes. The model reads YouTube videos from their watch URL, sent as video.
+func mediaMIMEType(mediaPath string) string {
+	if _, ok := utils.YouTubeVideoID(mediaPath); ok {
+		return "video/mp4"
+	}
+	if lower := strings.ToLower(mediaPath); strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		mediaPath, _, _ = strings.Cut(mediaPath, "?")
+	}
+	return mime.TypeByExtension(filepath.Ext(mediaPath))
+}
@@ -0,0 +1,43 @@
+package gemini
+
+import (
+	"context"
+	"testing"
+
+	"read-robin/services/llm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	audioPath = "gs://read-robin-examples/audio/porsche_macan_ad.mp3"
+)
+
+func TestTranscribeMedia(t *testing.T) {
+	requireProject(t)
+	ctx := context.Background()
+	client, err := NewGeminiClient(ctx)
+	assert.NoError(t, err)
+
+	transcript, _, err := client.TranscribeMedia(ctx, llm.Media{URI: audioPath})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, transcript.Title)
+	assert.NotEmpty(t, transcript.Segments)
+	for _, segment := range transcript.Segments {
+		assert.LessOrEqual(t, segment.Start, segment.End)
+	}
+}
+
+func TestMediaMIMEType(t *testing.T) {
+	t.Parallel()
+	for mediaPath, expected := range map[string]string{
+		"gs://bucket/talk.mp3":                             "audio/mpeg",
+		"https://podcasts.example.com/episode.mp3?ref=rss": "audio/mpeg",
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":      "video/mp4",
+		"https://example.com/stream":                       "",
+	} {
+		assert.Equal(t, expected, mediaMIMEType(mediaPath), mediaPath)
+	}
+}
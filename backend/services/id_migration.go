@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// IDMigrationReport counts the documents rewritten by MigrateIDs
+type IDMigrationReport struct {
+	Contents    int // Content moved from its legacy ID, which is kept as an alias
+	Questions   int // Questions given a ULID, keeping their old ID as LegacyID
+	Attempts    int // Attempts pointed at migrated content or questions
+	ReviewCards int // Review cards pointed at migrated content or questions
+	Skipped     int // Legacy content left at its legacy ID because other content already has its new ID
+}
+
+// IDMigrator rewrites documents saved under the legacy ID scheme
+type IDMigrator interface {
+	// MigrateIDs moves content saved under a legacy ID to its SHA-256 ID, recording the legacy ID as an alias,
+	// gives questions without a ULID one, and rewrites the attempts and review cards referring to them. Each
+	// content is migrated atomically with its attempts and review cards, so an interrupted migration can be
+	// run again.
+	MigrateIDs(ctx context.Context) (IDMigrationReport, error)
+}
+
+// questionIDMap holds the new IDs of migrated questions by quiz ID and legacy question ID
+type questionIDMap map[string]map[string]string
+
+// migrateQuestionIDs gives every question of quizzes without a ULID a new one, keeping the old ID as its
+// LegacyID, and returns the new IDs and the number of questions migrated. Where legacy IDs collided within
+// a quiz, responses to the legacy ID are kept by the first question with it.
+func migrateQuestionIDs(quizzes []models.Quiz) (questionIDMap, int) {
+	ids := make(questionIDMap)
+	migrated := 0
+	for i := range quizzes {
+		for j := range quizzes[i].Questions {
+			question := &quizzes[i].Questions[j]
+			if utils.IsULID(question.QuestionID) {
+				continue
+			}
+			if ids[quizzes[i].QuizID] == nil {
+				ids[quizzes[i].QuizID] = make(map[string]string)
+			}
+			newID := utils.GenerateQuestionID()
+			if _, ok := ids[quizzes[i].QuizID][question.QuestionID]; !ok {
+				ids[quizzes[i].QuizID][question.QuestionID] = newID
+			}
+			question.LegacyID = question.QuestionID
+			question.QuestionID = newID
+			migrated++
+		}
+	}
+	return ids, migrated
+}
+
+// migrateAttempt points attempt at contentID and the new IDs of its questions, reporting whether it changed
+func migrateAttempt(attempt *models.Attempt, contentID string, ids questionIDMap) bool {
+	changed := attempt.ContentID != contentID
+	attempt.ContentID = contentID
+	for i := range attempt.Responses {
+		if newID, ok := ids[attempt.QuizID][attempt.Responses[i].QuestionID]; ok {
+			attempt.Responses[i].QuestionID = newID
+			changed = true
+		}
+	}
+	return changed
+}
+
+// migrateReviewCard points card at contentID and the new ID of its question, reporting whether it changed
+func migrateReviewCard(card *models.ReviewCard, contentID string, ids questionIDMap) bool {
+	changed := card.ContentID != contentID
+	card.ContentID = contentID
+	if newID, ok := ids[card.QuizID][card.QuestionID]; ok {
+		card.QuestionID = newID
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,392 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+	"read-robin/utils"
+)
+
+const (
+	defaultQueueCapacity = 100
+	defaultLease         = time.Minute
+	defaultMaxAttempts   = 3
+)
+
+// ErrQueueFull is returned by Submit when no more jobs can be accepted
+var ErrQueueFull = errors.New("job queue is full")
+
+// errNotClaimable is returned by claim for jobs that are finished or leased by another worker
+var errNotClaimable = errors.New("job is finished or claimed by another worker")
+
+// errLeaseLost is returned by update for jobs another worker claimed after this queue's lease lapsed
+var errLeaseLost = errors.New("job was claimed by another worker")
+
+// stageProgress is the progress percentage reported when a job enters each stage
+var stageProgress = map[string]int{
+	models.JobStageQueued:     0,
+	models.JobStageFetching:   10,
+	models.JobStageExtracting: 30,
+	models.JobStageGenerating: 60,
+	models.JobStageSaving:     90,
+	models.JobStageDone:       100,
+}
+
+// StageProgress returns the progress percentage of a job that has just entered stage
+func StageProgress(stage string) int {
+	return stageProgress[stage]
+}
+
+// ReportFunc is called by a RunFunc each time the job enters a new stage
+type ReportFunc func(stage string)
+
+// RunFunc executes the quiz generation pipeline for a job's request
+type RunFunc func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error)
+
+// Queue runs quiz generation jobs on a pool of workers, persisting every state change in a JobStore.
+// Queues sharing a store, such as those of several server instances, each claim a job before running it,
+// holding a lease on it that they renew while it runs.
+type Queue struct {
+	// Lease is how long a job stays claimed without being renewed, after which a crashed worker's job may be
+	// claimed again. It defaults to a minute.
+	Lease time.Duration
+	// MaxAttempts is the number of times a job may be claimed before it fails, so a job that crashes its
+	// worker is not retried forever. It defaults to 3.
+	MaxAttempts int
+	// Sweep, if set, is called every Lease along with the reclaiming of abandoned jobs, to clean up other
+	// state left behind by clients and instances that went away
+	Sweep func(ctx context.Context, now time.Time)
+
+	store   services.JobStore
+	run     RunFunc
+	workers int
+	logger  *log.Logger
+	owner   string // Identifies this queue in the jobs it claims
+
+	pending chan string
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewQueue creates a Queue with the given number of workers. Call Start before submitting jobs.
+func NewQueue(store services.JobStore, run RunFunc, workers int, logger *log.Logger) *Queue {
+	if workers <= 0 {
+		workers = 1
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Queue{
+		Lease:       defaultLease,
+		MaxAttempts: defaultMaxAttempts,
+		store:       store,
+		run:         run,
+		workers:     workers,
+		logger:      logger,
+		owner:       utils.GenerateJobID(),
+		pending:     make(chan string, defaultQueueCapacity),
+	}
+}
+
+// Start resumes the unfinished jobs found in the store and starts the workers. Jobs whose lease expires later,
+// because the worker running them stopped, are resumed as well.
+func (q *Queue) Start(ctx context.Context) error {
+	unfinished, err := q.store.ListUnfinishedJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing unfinished jobs: %w", err)
+	}
+
+	if q.Lease <= 0 {
+		q.Lease = defaultLease
+	}
+	workerCtx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(workerCtx)
+	}
+	q.wg.Add(1)
+	go q.resume(workerCtx, unfinished)
+	return nil
+}
+
+// resume enqueues the unclaimed jobs in unfinished, then every Lease enqueues the jobs that were abandoned,
+// untouched for a whole Lease, and runs Sweep, until ctx is cancelled
+func (q *Queue) resume(ctx context.Context, unfinished []models.Job) {
+	defer q.wg.Done()
+	var resumed []string
+	for _, job := range unfinished {
+		if claimable(job, time.Now()) {
+			resumed = append(resumed, job.JobID)
+		}
+	}
+	// Resumed jobs may exceed the queue capacity, so they are enqueued here rather than by Start
+	if len(resumed) > 0 {
+		q.logger.Printf("JobQueue: Resuming %d unfinished jobs", len(resumed))
+	}
+	for _, jobID := range resumed {
+		select {
+		case q.pending <- jobID:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	ticker := time.NewTicker(q.Lease)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if q.Sweep != nil {
+				q.Sweep(ctx, now)
+			}
+			unfinished, err := q.store.ListUnfinishedJobs(ctx)
+			if err != nil {
+				q.logger.Printf("JobQueue: Error listing unfinished jobs: %v", err)
+				continue
+			}
+			for _, job := range unfinished {
+				if !claimable(job, now) || now.Sub(job.UpdatedAt) < q.Lease {
+					continue
+				}
+				// Jobs that do not fit are picked up by a later tick
+				select {
+				case q.pending <- job.JobID:
+					q.logger.Printf("JobQueue: Resuming abandoned job %s", job.JobID)
+				default:
+				}
+			}
+		}
+	}
+}
+
+// claimable reports whether job is unfinished and not leased by a worker at now
+func claimable(job models.Job, now time.Time) bool {
+	if job.Status != models.JobStatusQueued && job.Status != models.JobStatusRunning {
+		return false
+	}
+	return job.ClaimedBy == "" || !now.Before(job.LeaseExpires)
+}
+
+// Stop stops the workers and waits for them to exit. Jobs interrupted by Stop stay unfinished and unclaimed
+// in the store and are resumed by the next Start.
+func (q *Queue) Stop() {
+	if q.cancel != nil {
+		q.cancel()
+	}
+	q.wg.Wait()
+}
+
+// Submit persists a new queued job for request and schedules it on the workers
+func (q *Queue) Submit(ctx context.Context, request models.QuizRequest) (*models.Job, error) {
+	now := time.Now()
+	job := models.Job{
+		JobID:     utils.GenerateJobID(),
+		Status:    models.JobStatusQueued,
+		Stage:     models.JobStageQueued,
+		Request:   request,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := q.store.SaveJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case q.pending <- job.JobID:
+		return &job, nil
+	default:
+		job.Status = models.JobStatusFailed
+		job.Error = ErrQueueFull.Error()
+		job.UpdatedAt = time.Now()
+		if err := q.store.SaveJob(ctx, job); err != nil {
+			q.logger.Printf("JobQueue: Error saving rejected job %s: %v", job.JobID, err)
+		}
+		return nil, ErrQueueFull
+	}
+}
+
+// worker processes pending jobs until ctx is cancelled
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case jobID := <-q.pending:
+			q.process(ctx, jobID)
+		}
+	}
+}
+
+// process claims and runs a single job, recording its stages and outcome and renewing its lease until it ends
+// or another worker claims it
+func (q *Queue) process(ctx context.Context, jobID string) {
+	job, err := q.claim(ctx, jobID)
+	if errors.Is(err, errNotClaimable) {
+		return
+	}
+	if err != nil {
+		q.logger.Printf("JobQueue: Error claiming job %s: %v", jobID, err)
+		return
+	}
+	if job.Status == models.JobStatusFailed {
+		q.logger.Printf("JobQueue: Job %s failed after %d attempts", jobID, q.MaxAttempts)
+		return
+	}
+
+	// The heartbeat renewing the lease and the stages of the run update the job concurrently. Once another
+	// worker has claimed the job, after the lease lapsed, the run is cancelled and nothing more is saved.
+	request := job.Request
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	var mu sync.Mutex
+	lost := false
+	update := func(ctx context.Context, change func(*models.Job)) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if lost {
+			return errLeaseLost
+		}
+		updated, err := q.update(ctx, jobID, change)
+		if errors.Is(err, errLeaseLost) {
+			q.logger.Printf("JobQueue: Job %s was claimed by another worker; abandoning it", jobID)
+			lost = true
+			cancelRun()
+		}
+		if err == nil {
+			job = updated
+		}
+		return err
+	}
+
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		heartbeat := time.NewTicker(q.Lease / 3)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-heartbeat.C:
+				update(ctx, func(*models.Job) {})
+			}
+		}
+	}()
+	report := func(stage string) {
+		update(ctx, func(job *models.Job) {
+			job.Stage = stage
+			job.Progress = StageProgress(stage)
+		})
+	}
+
+	result, err := q.run(runCtx, request, report)
+	close(done)
+	<-stopped
+	mu.Lock()
+	abandoned := lost
+	mu.Unlock()
+	if abandoned {
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down: release the job, without counting the attempt, so the next Start resumes it
+		q.logger.Printf("JobQueue: Job %s interrupted by shutdown", jobID)
+		update(context.Background(), func(job *models.Job) {
+			job.ClaimedBy = ""
+			job.Attempts--
+		})
+		return
+	}
+	if err != nil {
+		q.logger.Printf("JobQueue: Job %s failed in stage %s: %v", jobID, job.Stage, err)
+		update(ctx, func(job *models.Job) {
+			job.Status = models.JobStatusFailed
+			job.Error = ErrorMessage(err)
+		})
+		return
+	}
+
+	err = update(ctx, func(job *models.Job) {
+		job.Status = models.JobStatusSucceeded
+		job.Stage = models.JobStageDone
+		job.Progress = StageProgress(models.JobStageDone)
+		job.Result = result
+	})
+	if err != nil && !errors.Is(err, errLeaseLost) {
+		// Fail a job whose result the store rejects rather than leave it running
+		update(ctx, func(job *models.Job) {
+			job.Status = models.JobStatusFailed
+			job.Error = "Error saving quiz result"
+			job.Result = nil
+		})
+	}
+}
+
+// claim leases jobID to this queue and marks it running, returning errNotClaimable if it is finished or leased by
+// another worker. A job claimed more than MaxAttempts times is failed instead.
+func (q *Queue) claim(ctx context.Context, jobID string) (*models.Job, error) {
+	return q.store.UpdateJob(ctx, jobID, func(job *models.Job) error {
+		now := time.Now()
+		if !claimable(*job, now) {
+			return errNotClaimable
+		}
+		job.Attempts++
+		job.UpdatedAt = now
+		if job.Attempts > q.MaxAttempts {
+			job.Status = models.JobStatusFailed
+			job.Error = "Quiz generation was interrupted too many times"
+			job.ClaimedBy = ""
+			return nil
+		}
+		job.Status = models.JobStatusRunning
+		job.ClaimedBy = q.owner
+		job.LeaseExpires = now.Add(q.Lease)
+		return nil
+	})
+}
+
+// update applies change to the stored jobID with an updated timestamp, renewing the lease unless change
+// releases the job, and logs failures, which it also returns. It returns errLeaseLost without changing the job
+// if it is no longer claimed by this queue.
+func (q *Queue) update(ctx context.Context, jobID string, change func(*models.Job)) (*models.Job, error) {
+	job, err := q.store.UpdateJob(ctx, jobID, func(job *models.Job) error {
+		if job.ClaimedBy != q.owner {
+			return errLeaseLost
+		}
+		change(job)
+		job.UpdatedAt = time.Now()
+		if job.ClaimedBy == q.owner {
+			job.LeaseExpires = job.UpdatedAt.Add(q.Lease)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLeaseLost) {
+		q.logger.Printf("JobQueue: Error saving job %s: %v", jobID, err)
+	}
+	return job, err
+}
+
+// UserError is implemented by errors that carry a message safe to show to the client
+type UserError interface {
+	error
+	UserMessage() string
+}
+
+// ErrorMessage returns the client-facing message for err
+func ErrorMessage(err error) string {
+	var userErr UserError
+	if errors.As(err, &userErr) {
+		return userErr.UserMessage()
+	}
+	return "Error generating quiz"
+}
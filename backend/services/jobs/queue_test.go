@@ -0,0 +1,349 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/services"
+)
+
+// waitForStatus polls the store until the job reaches a finished status
+func waitForStatus(t *testing.T, store services.JobStore, jobID string) *models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := store.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("GetJob: expected no error, got %v", err)
+		}
+		if job.Status == models.JobStatusSucceeded || job.Status == models.JobStatusFailed {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish in time", jobID)
+	return nil
+}
+
+type userError struct{ message string }
+
+func (e userError) Error() string       { return "internal detail: " + e.message }
+func (e userError) UserMessage() string { return e.message }
+
+func TestQueue_RunsJobThroughStages(t *testing.T) {
+	store := services.NewMemoryStore()
+	stages := make(chan string, 10)
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		for _, stage := range []string{models.JobStageFetching, models.JobStageGenerating} {
+			report(stage)
+			unfinished, _ := store.ListUnfinishedJobs(ctx)
+			if len(unfinished) == 1 {
+				stages <- unfinished[0].Stage
+			}
+		}
+		return &models.QuizResult{URL: request.URL, ContentID: "content", QuizID: "0001"}, nil
+	}
+
+	queue := NewQueue(store, run, 2, nil)
+	if err := queue.Start(context.Background()); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	job, err := queue.Submit(context.Background(), models.QuizRequest{URL: "https://example.com", ContentType: "URL"})
+	if err != nil {
+		t.Fatalf("Submit: expected no error, got %v", err)
+	}
+	if job.Status != models.JobStatusQueued || job.JobID == "" {
+		t.Fatalf("Submit: unexpected job %+v", job)
+	}
+
+	finished := waitForStatus(t, store, job.JobID)
+	if finished.Status != models.JobStatusSucceeded || finished.Stage != models.JobStageDone || finished.Progress != 100 {
+		t.Errorf("expected succeeded job at stage done, got %+v", finished)
+	}
+	if finished.Result == nil || finished.Result.QuizID != "0001" {
+		t.Errorf("expected job result with quiz 0001, got %+v", finished.Result)
+	}
+	if first := <-stages; first != models.JobStageFetching {
+		t.Errorf("expected stage %s to be persisted, got %s", models.JobStageFetching, first)
+	}
+}
+
+func TestQueue_RecordsFailure(t *testing.T) {
+	store := services.NewMemoryStore()
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		report(models.JobStageExtracting)
+		if request.ContentType == "PDF" {
+			return nil, userError{"Error extracting content from PDF"}
+		}
+		return nil, errors.New("connection reset")
+	}
+
+	queue := NewQueue(store, run, 1, nil)
+	if err := queue.Start(context.Background()); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	testCases := []struct {
+		contentType string
+		message     string
+	}{
+		{"PDF", "Error extracting content from PDF"},
+		{"Audio", "Error generating quiz"},
+	}
+	for _, tc := range testCases {
+		job, err := queue.Submit(context.Background(), models.QuizRequest{ContentType: tc.contentType})
+		if err != nil {
+			t.Fatalf("Submit: expected no error, got %v", err)
+		}
+		finished := waitForStatus(t, store, job.JobID)
+		if finished.Status != models.JobStatusFailed || finished.Stage != models.JobStageExtracting || finished.Error != tc.message {
+			t.Errorf("%s: expected failed job with %q at stage extracting, got %+v", tc.contentType, tc.message, finished)
+		}
+	}
+}
+
+// resultRejectingStore fails to save jobs with a result, like Firestore saving a document over its size limit
+type resultRejectingStore struct {
+	*services.MemoryStore
+}
+
+func (rs resultRejectingStore) SaveJob(ctx context.Context, job models.Job) error {
+	if job.Result != nil {
+		return errors.New("document too large")
+	}
+	return rs.MemoryStore.SaveJob(ctx, job)
+}
+
+func (rs resultRejectingStore) UpdateJob(ctx context.Context, jobID string, update func(*models.Job) error) (*models.Job, error) {
+	return rs.MemoryStore.UpdateJob(ctx, jobID, func(job *models.Job) error {
+		if err := update(job); err != nil {
+			return err
+		}
+		if job.Result != nil {
+			return errors.New("document too large")
+		}
+		return nil
+	})
+}
+
+func TestQueue_FailsJobWhoseResultIsNotSaved(t *testing.T) {
+	store := resultRejectingStore{services.NewMemoryStore()}
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		return &models.QuizResult{ContentID: "content", QuizID: "0001"}, nil
+	}
+
+	queue := NewQueue(store, run, 1, nil)
+	if err := queue.Start(context.Background()); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	job, err := queue.Submit(context.Background(), models.QuizRequest{ContentType: "Text"})
+	if err != nil {
+		t.Fatalf("Submit: expected no error, got %v", err)
+	}
+	finished := waitForStatus(t, store, job.JobID)
+	if finished.Status != models.JobStatusFailed || finished.Error != "Error saving quiz result" || finished.Result != nil {
+		t.Errorf("expected a failed job without a result, got %+v", finished)
+	}
+}
+
+func TestQueue_ResumesUnfinishedJobsAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "quizbo.db")
+
+	store, err := services.NewSQLiteStore(ctx, path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+
+	// The first run blocks until the queue is stopped, simulating a shutdown mid-job
+	started := make(chan struct{})
+	blocking := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		report(models.JobStageGenerating)
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	queue := NewQueue(store, blocking, 1, nil)
+	if err := queue.Start(ctx); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	job, err := queue.Submit(ctx, models.QuizRequest{URL: "https://example.com", ContentType: "URL"})
+	if err != nil {
+		t.Fatalf("Submit: expected no error, got %v", err)
+	}
+	<-started
+	queue.Stop()
+	store.Close()
+
+	store, err = services.NewSQLiteStore(ctx, path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	interrupted, err := store.GetJob(ctx, job.JobID)
+	if err != nil {
+		t.Fatalf("GetJob: expected no error, got %v", err)
+	}
+	if interrupted.Status != models.JobStatusRunning || interrupted.ClaimedBy != "" || interrupted.Attempts != 0 {
+		t.Fatalf("expected interrupted job to stay running, released without counting the attempt, got %+v", interrupted)
+	}
+
+	succeeding := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		return &models.QuizResult{URL: request.URL, ContentID: "content", QuizID: "0001"}, nil
+	}
+	queue = NewQueue(store, succeeding, 1, nil)
+	if err := queue.Start(ctx); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	finished := waitForStatus(t, store, job.JobID)
+	if finished.Status != models.JobStatusSucceeded || finished.Result.URL != "https://example.com" {
+		t.Errorf("expected resumed job to succeed, got %+v", finished)
+	}
+}
+
+func TestQueue_ResumesJobWhoseLeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore()
+	now := time.Now()
+	leased := models.Job{JobID: "leased", Status: models.JobStatusRunning, Stage: models.JobStageGenerating,
+		Request: models.QuizRequest{URL: "https://example.com"}, ClaimedBy: "other-worker",
+		LeaseExpires: now.Add(150 * time.Millisecond), Attempts: 1, CreatedAt: now, UpdatedAt: now}
+	if err := store.SaveJob(ctx, leased); err != nil {
+		t.Fatalf("SaveJob: expected no error, got %v", err)
+	}
+
+	var runs atomic.Int32
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		runs.Add(1)
+		return &models.QuizResult{URL: request.URL, ContentID: "content", QuizID: "0001"}, nil
+	}
+	queue := NewQueue(store, run, 2, nil)
+	queue.Lease = 50 * time.Millisecond
+	if err := queue.Start(ctx); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	// The job is left to the worker holding its lease until the lease expires
+	time.Sleep(100 * time.Millisecond)
+	if job, _ := store.GetJob(ctx, "leased"); job.Status != models.JobStatusRunning || runs.Load() != 0 {
+		t.Fatalf("expected the leased job to be left alone, got %+v after %d runs", job, runs.Load())
+	}
+
+	finished := waitForStatus(t, store, "leased")
+	if finished.Status != models.JobStatusSucceeded || finished.Attempts != 2 || runs.Load() != 1 {
+		t.Errorf("expected the abandoned job to be run once more, got %+v after %d runs", finished, runs.Load())
+	}
+}
+
+func TestQueue_SweepsEveryLease(t *testing.T) {
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		return &models.QuizResult{ContentID: "content", QuizID: "0001"}, nil
+	}
+	queue := NewQueue(services.NewMemoryStore(), run, 1, nil)
+	queue.Lease = 10 * time.Millisecond
+	swept := make(chan time.Time, 10)
+	queue.Sweep = func(ctx context.Context, now time.Time) {
+		select {
+		case swept <- now:
+		default:
+		}
+	}
+	if err := queue.Start(context.Background()); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-swept:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected Sweep to be called every Lease, got %d calls", i)
+		}
+	}
+}
+
+func TestQueue_AbandonsJobClaimedByAnotherWorker(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore()
+	started, reclaimed, cancelled := make(chan struct{}), make(chan struct{}), make(chan bool, 1)
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		close(started)
+		<-reclaimed
+		report(models.JobStageGenerating)
+		cancelled <- ctx.Err() != nil
+		return &models.QuizResult{ContentID: "content", QuizID: "0001"}, nil
+	}
+	queue := NewQueue(store, run, 1, nil)
+	if err := queue.Start(ctx); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	job, err := queue.Submit(ctx, models.QuizRequest{ContentType: "Text"})
+	if err != nil {
+		t.Fatalf("Submit: expected no error, got %v", err)
+	}
+	<-started
+	// The worker stalled past its lease, and another worker claimed the job
+	_, err = store.UpdateJob(ctx, job.JobID, func(job *models.Job) error {
+		job.ClaimedBy = "other-worker"
+		job.Stage = models.JobStageFetching
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateJob: expected no error, got %v", err)
+	}
+	close(reclaimed)
+
+	if !<-cancelled {
+		t.Errorf("expected the run to be cancelled once another worker claimed its job")
+	}
+	queue.Stop()
+	stored, err := store.GetJob(ctx, job.JobID)
+	if err != nil {
+		t.Fatalf("GetJob: expected no error, got %v", err)
+	}
+	if stored.ClaimedBy != "other-worker" || stored.Status != models.JobStatusRunning || stored.Stage != models.JobStageFetching || stored.Result != nil {
+		t.Errorf("expected the job to be left to the worker that claimed it, got %+v", stored)
+	}
+}
+
+func TestQueue_FailsJobAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := services.NewMemoryStore()
+	// The job crashed its worker on each of its attempts, leaving it running without a lease
+	crashing := models.Job{JobID: "crashing", Status: models.JobStatusRunning, Stage: models.JobStageExtracting,
+		Attempts: 3, CreatedAt: time.Now()}
+	if err := store.SaveJob(ctx, crashing); err != nil {
+		t.Fatalf("SaveJob: expected no error, got %v", err)
+	}
+
+	run := func(ctx context.Context, request models.QuizRequest, report ReportFunc) (*models.QuizResult, error) {
+		t.Error("expected the job not to run again")
+		return nil, errors.New("crashed")
+	}
+	queue := NewQueue(store, run, 1, nil)
+	if err := queue.Start(ctx); err != nil {
+		t.Fatalf("Start: expected no error, got %v", err)
+	}
+	defer queue.Stop()
+
+	finished := waitForStatus(t, store, "crashing")
+	if finished.Status != models.JobStatusFailed || finished.Error == "" || finished.ClaimedBy != "" {
+		t.Errorf("expected the job to fail after its last attempt, got %+v", finished)
+	}
+}
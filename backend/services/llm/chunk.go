@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk is a contiguous part of a document small enough to generate questions from in one model call
+type Chunk struct {
+	Index   int    // Position of the chunk in the document, from 0
+	Heading string // The heading of the section the chunk starts in, if any
+	Text    string
+}
+
+// charsPerToken approximates the length of a token in characters, which is close enough for budgeting
+const charsPerToken = 4
+
+var (
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+\S`)
+	// timestampLine matches transcript cues such as "[00:01:23]", "01:23 Speaker:" and "00:00:01.000 --> 00:00:04.000"
+	timestampLine = regexp.MustCompile(`^\[?\(?\d{1,2}:\d{2}(:\d{2})?([.,]\d{1,3})?\]?\)?(\s|$)`)
+	sentenceEnd   = regexp.MustCompile(`[.!?]["'”’)\]]?\s+`)
+)
+
+// EstimateTokens estimates the number of model tokens in text
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// SplitContent splits text into chunks of at most budget tokens, breaking at structure where it can:
+// sections start new chunks once a chunk is half full, paragraphs and transcript cues are kept whole,
+// and only blocks larger than the budget are split by sentence. A budget of zero or less returns text whole.
+func SplitContent(text string, budget int) []Chunk {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if budget <= 0 || EstimateTokens(text) <= budget {
+		return []Chunk{{Index: 0, Text: text}}
+	}
+
+	var chunks []Chunk
+	var current []string
+	currentTokens := 0
+	heading, chunkHeading := "", ""
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunks = append(chunks, Chunk{Index: len(chunks), Heading: chunkHeading, Text: strings.Join(current, "\n\n")})
+		current, currentTokens = nil, 0
+	}
+	lastIsHeading := false
+	add := func(block string, blockIsHeading bool) {
+		tokens := EstimateTokens(block)
+		if currentTokens > 0 && currentTokens+tokens > budget {
+			// Carry a trailing heading over to the chunk holding its section
+			var carried string
+			if lastIsHeading && len(current) > 1 {
+				carried = current[len(current)-1]
+				current = current[:len(current)-1]
+			}
+			flush()
+			if carried != "" {
+				chunkHeading = heading
+				current, currentTokens = []string{carried}, EstimateTokens(carried)
+			}
+		}
+		if len(current) == 0 {
+			chunkHeading = heading
+		}
+		current = append(current, block)
+		currentTokens += tokens
+		lastIsHeading = blockIsHeading
+	}
+
+	for _, block := range splitBlocks(text) {
+		if isHeading(block) {
+			// Start sections in a new chunk once the current one is half full
+			if currentTokens >= budget/2 {
+				flush()
+			}
+			heading = strings.TrimSpace(strings.TrimLeft(block, "#"))
+			add(block, true)
+			continue
+		}
+		if EstimateTokens(block) <= budget {
+			add(block, false)
+			continue
+		}
+		for _, piece := range splitOversized(block, budget) {
+			add(piece, false)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitBlocks splits text into paragraphs at blank lines, also starting a new block at every
+// transcript timestamp so cues are never merged with their neighbours' paragraphs
+func splitBlocks(text string) []string {
+	var blocks []string
+	var lines []string
+	flush := func() {
+		if len(lines) > 0 {
+			blocks = append(blocks, strings.Join(lines, "\n"))
+			lines = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+			continue
+		case timestampLine.MatchString(strings.TrimSpace(line)), markdownHeading.MatchString(line):
+			flush()
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return blocks
+}
+
+// isHeading reports whether block looks like a section heading: a markdown heading, or a single short
+// line without closing punctuation, as ExtractArticle writes headings
+func isHeading(block string) bool {
+	if markdownHeading.MatchString(block) {
+		return true
+	}
+	if strings.Contains(block, "\n") || utf8.RuneCountInString(block) > 80 || timestampLine.MatchString(block) {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(block)
+	return !strings.ContainsRune(".!?:;,\"'”’)-", last) && !strings.HasPrefix(block, "- ")
+}
+
+// splitOversized splits a block larger than budget into pieces at sentence ends, cutting sentences that
+// are themselves larger than the budget at word boundaries
+func splitOversized(block string, budget int) []string {
+	maxChars := budget * charsPerToken
+
+	var sentences []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(block, -1) {
+		sentences = append(sentences, block[start:loc[1]])
+		start = loc[1]
+	}
+	sentences = append(sentences, block[start:])
+
+	var pieces []string
+	var piece strings.Builder
+	for _, sentence := range sentences {
+		for utf8.RuneCountInString(sentence) > maxChars {
+			if piece.Len() > 0 {
+				pieces = append(pieces, strings.TrimSpace(piece.String()))
+				piece.Reset()
+			}
+			cut := cutAtWord(sentence, maxChars)
+			pieces = append(pieces, strings.TrimSpace(sentence[:cut]))
+			sentence = sentence[cut:]
+		}
+		if piece.Len() > 0 && utf8.RuneCountInString(piece.String())+utf8.RuneCountInString(sentence) > maxChars {
+			pieces = append(pieces, strings.TrimSpace(piece.String()))
+			piece.Reset()
+		}
+		piece.WriteString(sentence)
+	}
+	if strings.TrimSpace(piece.String()) != "" {
+		pieces = append(pieces, strings.TrimSpace(piece.String()))
+	}
+	return pieces
+}
+
+// cutAtWord returns the byte offset at which to cut s so the first part holds at most maxChars runes,
+// preferring the last space before the limit
+func cutAtWord(s string, maxChars int) int {
+	limit := len(s)
+	for i := range s {
+		if maxChars == 0 {
+			limit = i
+			break
+		}
+		maxChars--
+	}
+	if space := strings.LastIndexFunc(s[:limit], unicode.IsSpace); space > 0 {
+		return space + 1
+	}
+	return limit
+}
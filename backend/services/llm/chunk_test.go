@@ -0,0 +1,102 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// section returns a heading and paragraphs of about tokens estimated tokens
+func section(heading string, tokens int) string {
+	var b strings.Builder
+	b.WriteString(heading)
+	for i := 0; EstimateTokens(b.String()) < tokens; i++ {
+		fmt.Fprintf(&b, "\n\nParagraph %d of %s describes lobsters in some detail.", i, heading)
+	}
+	return b.String()
+}
+
+func TestSplitContent_FitsBudget(t *testing.T) {
+	t.Parallel()
+	chunks := SplitContent("  Lobsters have ten legs.\n\nThey live on the ocean floor.  ", 100)
+	if len(chunks) != 1 || chunks[0].Text != "Lobsters have ten legs.\n\nThey live on the ocean floor." {
+		t.Errorf("SplitContent: expected the content whole, got %+v", chunks)
+	}
+	if chunks := SplitContent("", 100); len(chunks) != 0 {
+		t.Errorf("SplitContent: expected no chunks for empty content, got %+v", chunks)
+	}
+}
+
+func TestSplitContent_Sections(t *testing.T) {
+	t.Parallel()
+	content := strings.Join([]string{section("Anatomy", 120), section("## Habitat", 120), section("Diet", 120)}, "\n\n")
+
+	chunks := SplitContent(content, 200)
+	if len(chunks) != 3 {
+		t.Fatalf("SplitContent: expected a chunk per section, got %d", len(chunks))
+	}
+	for i, heading := range []string{"Anatomy", "Habitat", "Diet"} {
+		if chunks[i].Index != i || chunks[i].Heading != heading || !strings.HasPrefix(strings.TrimLeft(chunks[i].Text, "# "), heading) {
+			t.Errorf("SplitContent: expected chunk %d to be section %s, got %+v", i, heading, chunks[i])
+		}
+	}
+}
+
+func TestSplitContent_LongSection(t *testing.T) {
+	t.Parallel()
+	chunks := SplitContent(section("Anatomy", 500), 200)
+	if len(chunks) < 3 {
+		t.Fatalf("SplitContent: expected the section to be split, got %d chunks", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if tokens := EstimateTokens(chunk.Text); tokens > 200 {
+			t.Errorf("SplitContent: chunk %d has %d tokens, over the budget", chunk.Index, tokens)
+		}
+		if chunk.Heading != "Anatomy" {
+			t.Errorf("SplitContent: expected chunk %d to continue the section, got heading %q", chunk.Index, chunk.Heading)
+		}
+		if !strings.HasPrefix(chunk.Text, "Anatomy") && !strings.HasPrefix(chunk.Text, "Paragraph") {
+			t.Errorf("SplitContent: expected chunk %d to start at a paragraph, got %q", chunk.Index, chunk.Text[:20])
+		}
+	}
+}
+
+func TestSplitContent_Transcript(t *testing.T) {
+	t.Parallel()
+	var lines []string
+	for i := 0; i < 60; i++ {
+		lines = append(lines, fmt.Sprintf("[00:%02d:%02d] Host: Lobsters can live for a very long time, point %d.", i/6, i%6*10, i))
+	}
+	transcript := strings.Join(lines, "\n")
+
+	chunks := SplitContent(transcript, 150)
+	if len(chunks) < 2 {
+		t.Fatalf("SplitContent: expected the transcript to be split, got %d chunks", len(chunks))
+	}
+	var cues int
+	for _, chunk := range chunks {
+		if !strings.HasPrefix(chunk.Text, "[00:") {
+			t.Errorf("SplitContent: expected chunk %d to start at a cue, got %q", chunk.Index, chunk.Text[:20])
+		}
+		cues += strings.Count(chunk.Text, "[00:")
+	}
+	if cues != len(lines) {
+		t.Errorf("SplitContent: expected every cue once, got %d of %d", cues, len(lines))
+	}
+}
+
+func TestSplitContent_OversizedParagraph(t *testing.T) {
+	t.Parallel()
+	words := strings.Repeat("lobster ", 2000)
+	chunks := SplitContent(words, 100)
+	var rejoined []string
+	for _, chunk := range chunks {
+		if tokens := EstimateTokens(chunk.Text); tokens > 100 {
+			t.Errorf("SplitContent: chunk %d has %d tokens, over the budget", chunk.Index, tokens)
+		}
+		rejoined = append(rejoined, chunk.Text)
+	}
+	if strings.Join(rejoined, " ") != strings.TrimSpace(words) {
+		t.Errorf("SplitContent: expected the pieces to rejoin into the paragraph")
+	}
+}
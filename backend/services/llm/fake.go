@@ -0,0 +1,294 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"read-robin/models"
+)
+
+const defaultFakeQuestionCount = 3
+
+var (
+	fakeTitlePattern  = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	fakeIgnorePattern = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	fakeTagPattern    = regexp.MustCompile(`(?s)<[^>]*>`)
+	fakeSentenceEnd   = regexp.MustCompile(`[.!?]+\s+`)
+	fakeWordPattern   = regexp.MustCompile(`[\p{L}\p{N}']+`)
+)
+
+// FakeProvider is a deterministic Provider for tests and offline development. It never calls a model:
+// extraction strips markup, quiz generation turns sentences into questions of every type, and review passes a response
+// that shares at least half of the significant words of the expected answer.
+type FakeProvider struct {
+	// QuestionCount is the maximum number of questions per quiz, defaulting to 3
+	QuestionCount int
+}
+
+// NewFakeProvider creates a FakeProvider with the default question count
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{QuestionCount: defaultFakeQuestionCount}
+}
+
+// Close is a no-op for FakeProvider
+func (fp *FakeProvider) Close() error {
+	return nil
+}
+
+// ExtractContentFromHtml strips tags from htmlText and uses the <title> element as the title
+func (fp *FakeProvider) ExtractContentFromHtml(ctx context.Context, htmlText string) (map[string]string, string, error) {
+	title := "Untitled Page"
+	if match := fakeTitlePattern.FindStringSubmatch(htmlText); match != nil {
+		title = strings.TrimSpace(html.UnescapeString(match[1]))
+	}
+
+	text := fakeIgnorePattern.ReplaceAllString(htmlText, " ")
+	text = html.UnescapeString(fakeTagPattern.ReplaceAllString(text, " "))
+	text = strings.Join(strings.Fields(text), " ")
+
+	return fp.contentMap(text, title)
+}
+
+// ExtractContentFromPdf returns placeholder content named after the PDF file
+func (fp *FakeProvider) ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error) {
+	return fp.extractMedia("PDF document", pdfPath)
+}
+
+// TranscribePdfPages returns a placeholder transcript of each page
+func (fp *FakeProvider) TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error) {
+	texts := make(map[int]string, len(pages))
+	for _, page := range pages {
+		texts[page] = fmt.Sprintf("This is the fake transcript of scanned page %d. It was read without calling a model.", page)
+	}
+	raw, err := json.Marshal(texts)
+	if err != nil {
+		return nil, "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return texts, string(raw), nil
+}
+
+// fakeSegmentSeconds is the length of each segment of a fake transcript
+const fakeSegmentSeconds = 5
+
+// TranscribeMedia returns a placeholder transcript named after the media file, timing each of its sentences
+// at fakeSegmentSeconds and alternating between two speakers
+func (fp *FakeProvider) TranscribeMedia(ctx context.Context, media Media) (*Transcript, string, error) {
+	file := media.Name
+	if media.URI != "" {
+		file = path.Base(media.URI)
+	}
+	name := strings.TrimSuffix(file, path.Ext(file))
+	content := fmt.Sprintf("This is the fake transcript of the recording %s. It was produced without calling a model. It exists so quizzes can be generated offline. Each sentence is timed as its own segment.", name)
+	transcript := &Transcript{Title: name}
+	for i, sentence := range splitSentences(content) {
+		transcript.Segments = append(transcript.Segments, models.Segment{
+			Start:   float64(i * fakeSegmentSeconds),
+			End:     float64((i + 1) * fakeSegmentSeconds),
+			Speaker: fmt.Sprintf("Speaker %d", i%2+1),
+			Text:    sentence,
+		})
+	}
+	raw, err := json.Marshal(transcript)
+	if err != nil {
+		return nil, "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return transcript, string(raw), nil
+}
+
+// fakeQuestionTypes is the order in which the FakeProvider cycles through the question types
+var fakeQuestionTypes = []string{
+	models.QuestionTypeFreeText, models.QuestionTypeTrueFalse, models.QuestionTypeFillInBlank, models.QuestionTypeMultipleChoice,
+}
+
+// GenerateQuiz turns the leading sentences of content into questions, cycling through the question types.
+// Like an obedient model it follows the question count and types of options and skips excluded questions,
+// ignoring topics.
+func (fp *FakeProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	count := fp.QuestionCount
+	if options.NumQuestions > 0 {
+		count = options.NumQuestions
+	}
+	if count <= 0 {
+		count = defaultFakeQuestionCount
+	}
+	types := fakeQuestionTypes
+	if len(options.QuestionTypes) > 0 {
+		types = options.QuestionTypes
+	}
+
+	excluded := make(map[string]bool)
+	for _, question := range options.ExcludeQuestions {
+		excluded[question] = true
+	}
+
+	quiz := []map[string]interface{}{}
+	for _, sentence := range splitSentences(content) {
+		if len(quiz) == count {
+			break
+		}
+		words := fakeWordPattern.FindAllString(sentence, -1)
+		if len(words) < 3 {
+			continue
+		}
+		question := fakeQuestion(types[len(quiz)%len(types)], sentence, words)
+		if excluded[questionText(question)] {
+			continue
+		}
+		if !options.ReferencesIncluded() {
+			question["reference"] = ""
+		}
+		quiz = append(quiz, question)
+	}
+	if len(quiz) == 0 {
+		return "", "", fmt.Errorf("no content to generate a quiz from")
+	}
+
+	quizJSON, err := json.Marshal(map[string]interface{}{"quiz": quiz})
+	if err != nil {
+		return "", "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return string(quizJSON), string(quizJSON), nil
+}
+
+// fakeQuestion builds a question of questionType from a sentence and its words
+func fakeQuestion(questionType, sentence string, words []string) map[string]interface{} {
+	subject := strings.Join(words[:min(len(words), 4)], " ")
+	question := map[string]interface{}{
+		"type":      models.QuestionTypeFreeText,
+		"question":  fmt.Sprintf("What does the content say about \"%s\"?", subject),
+		"answer":    sentence,
+		"reference": sentence,
+	}
+
+	// The longest word is the one blanked out or asked about by the objective types
+	keyword := words[0]
+	for _, word := range words {
+		if len(word) > len(keyword) {
+			keyword = word
+		}
+	}
+	cloze := strings.Replace(sentence, keyword, "___", 1)
+
+	switch questionType {
+	case models.QuestionTypeTrueFalse:
+		question["type"] = models.QuestionTypeTrueFalse
+		question["question"] = sentence
+		question["answer"] = "true"
+		question["true_false"] = map[string]interface{}{"answer": true}
+	case models.QuestionTypeFillInBlank:
+		question["type"] = models.QuestionTypeFillInBlank
+		question["question"] = "Fill in the blank."
+		question["answer"] = keyword
+		question["fill_in_blank"] = map[string]interface{}{"text": cloze, "blanks": []string{keyword}}
+	case models.QuestionTypeMultipleChoice:
+		choices := []string{keyword}
+		for _, word := range words {
+			if len(choices) == 4 {
+				break
+			}
+			if !slices.Contains(choices, word) {
+				choices = append(choices, word)
+			}
+		}
+		slices.Sort(choices)
+		question["type"] = models.QuestionTypeMultipleChoice
+		question["question"] = fmt.Sprintf("Which word completes \"%s\"?", cloze)
+		question["answer"] = keyword
+		question["multiple_choice"] = map[string]interface{}{"choices": choices, "correct_index": slices.Index(choices, keyword)}
+	}
+	return question
+}
+
+// ReviewResponse passes the user's response if it contains at least half of the expected answer's significant words
+func (fp *FakeProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	var data map[string]string
+	if err := json.Unmarshal([]byte(reviewData), &data); err != nil {
+		return "", "", fmt.Errorf("error unmarshaling review data: %w", err)
+	}
+
+	expected := significantWords(data["expected_answer"])
+	given := significantWords(data["user_response"])
+	matched := 0
+	for word := range expected {
+		if given[word] {
+			matched++
+		}
+	}
+
+	if len(expected) > 0 && matched*2 >= len(expected) {
+		return "PASS", fmt.Sprintf("Great job! Your answer covers %d of %d key words of the expected answer.", matched, len(expected)), nil
+	}
+	return "FAIL", fmt.Sprintf("Not quite. The expected answer was: %s", data["expected_answer"]), nil
+}
+
+// extractMedia returns placeholder content for a media file
+func (fp *FakeProvider) extractMedia(kind, mediaPath string) (map[string]string, string, error) {
+	name := strings.TrimSuffix(path.Base(mediaPath), path.Ext(mediaPath))
+	content := fmt.Sprintf("This is the fake transcript of the %s %s. It was produced without calling a model. It exists so quizzes can be generated offline.", kind, name)
+	return fp.contentMap(content, name)
+}
+
+// contentMap builds the extraction result and its raw JSON encoding
+func (fp *FakeProvider) contentMap(content, title string) (map[string]string, string, error) {
+	contentMap := map[string]string{"content": content, "title": title}
+	raw, err := json.Marshal(contentMap)
+	if err != nil {
+		return nil, "", fmt.Errorf("json.Marshal: %w", err)
+	}
+	return contentMap, string(raw), nil
+}
+
+// splitSentences splits text on sentence terminators, keeping the terminator with each sentence
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for _, loc := range fakeSentenceEnd.FindAllStringIndex(text, -1) {
+		sentences = append(sentences, strings.TrimSpace(text[start:loc[1]]))
+		start = loc[1]
+	}
+	if rest := strings.TrimSpace(text[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// significantWords returns the lowercased words of text longer than three characters
+func significantWords(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, word := range fakeWordPattern.FindAllString(strings.ToLower(text), -1) {
+		if len(word) > 3 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// fakeStreamChunkSize is the number of bytes of quiz JSON the FakeProvider streams at a time
+const fakeStreamChunkSize = 32
+
+// FakeProvider streams its quiz so streaming code paths can be tested offline
+var _ StreamingProvider = (*FakeProvider)(nil)
+
+// GenerateQuizStream generates the same quiz as GenerateQuiz and reports it in small chunks
+func (fp *FakeProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	quizContent, fullResponse, err := fp.GenerateQuiz(ctx, content, persona, options)
+	if err != nil {
+		return "", "", err
+	}
+
+	for start := 0; start < len(quizContent); start += fakeStreamChunkSize {
+		if err := ctx.Err(); err != nil {
+			return "", "", err
+		}
+		if err := onText(quizContent[start:min(start+fakeStreamChunkSize, len(quizContent))]); err != nil {
+			return "", "", err
+		}
+	}
+	return quizContent, fullResponse, nil
+}
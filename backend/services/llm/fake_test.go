@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"read-robin/models"
+)
+
+var testPersona = models.Persona{
+	ID:         "test_persona_id",
+	Name:       "Test User",
+	Role:       "Student",
+	Language:   "English",
+	Difficulty: "Intermediate",
+}
+
+const testHTML = `<html><head><title>Example Domain</title><style>body { color: red; }</style></head>
+<body><h1>Example Domain</h1><p>This domain is for use in illustrative examples in documents. You may use this
+domain in literature without prior coordination or asking for permission.</p></body></html>`
+
+func TestFakeProvider_ExtractContentFromHtml(t *testing.T) {
+	t.Parallel()
+	contentMap, _, err := NewFakeProvider().ExtractContentFromHtml(context.Background(), testHTML)
+	if err != nil {
+		t.Fatalf("ExtractContentFromHtml: expected no error, got %v", err)
+	}
+	if contentMap["title"] != "Example Domain" {
+		t.Errorf("ExtractContentFromHtml: expected title %q, got %q", "Example Domain", contentMap["title"])
+	}
+	expected := "Example Domain This domain is for use in illustrative examples in documents. You may use this domain in literature without prior coordination or asking for permission."
+	if contentMap["content"] != expected {
+		t.Errorf("ExtractContentFromHtml: expected content %q, got %q", expected, contentMap["content"])
+	}
+}
+
+func TestFakeProvider_TranscribeMedia(t *testing.T) {
+	t.Parallel()
+	transcript, _, err := NewFakeProvider().TranscribeMedia(context.Background(), Media{URI: "gs://bucket/talks/lobsters.mp3"})
+	if err != nil {
+		t.Fatalf("TranscribeMedia: expected no error, got %v", err)
+	}
+	if transcript.Title != "lobsters" {
+		t.Errorf("TranscribeMedia: expected the title of the file, got %q", transcript.Title)
+	}
+	if len(transcript.Segments) < 2 {
+		t.Fatalf("TranscribeMedia: expected a segment per sentence, got %+v", transcript.Segments)
+	}
+	for i, segment := range transcript.Segments {
+		if segment.Start != float64(i*fakeSegmentSeconds) || segment.End != segment.Start+fakeSegmentSeconds || segment.Speaker == "" {
+			t.Errorf("TranscribeMedia: expected segment %d timed consecutively with a speaker, got %+v", i, segment)
+		}
+	}
+}
+
+func TestFakeProvider_GenerateQuizIsDeterministic(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	provider := NewFakeProvider()
+	content := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue. It weighs ninety tonnes."
+
+	first, _, err := provider.GenerateQuiz(ctx, content, testPersona, models.QuizOptions{})
+	if err != nil {
+		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
+	}
+	second, _, _ := provider.GenerateQuiz(ctx, content, testPersona, models.QuizOptions{})
+	if first != second {
+		t.Errorf("GenerateQuiz: expected identical output for identical input")
+	}
+
+	var quiz struct {
+		Quiz []map[string]interface{} `json:"quiz"`
+	}
+	if err := json.Unmarshal([]byte(first), &quiz); err != nil {
+		t.Fatalf("GenerateQuiz: expected JSON output, got %v", err)
+	}
+	if len(quiz.Quiz) != defaultFakeQuestionCount {
+		t.Fatalf("GenerateQuiz: expected %d questions, got %d", defaultFakeQuestionCount, len(quiz.Quiz))
+	}
+	if quiz.Quiz[0]["answer"] != "Lobsters live in the ocean." {
+		t.Errorf("GenerateQuiz: unexpected first answer %q", quiz.Quiz[0]["answer"])
+	}
+}
+
+func TestFakeProvider_ReviewResponse(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		userResponse   string
+		expectedStatus string
+	}{
+		{"Passing case", "It is used in illustrative examples within documents.", "PASS"},
+		{"Failing case", "It is a domain for testing purposes.", "FAIL"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reviewData, _ := json.Marshal(map[string]string{
+				"expected_answer": "The 'Example Domain' is for use in illustrative examples in documents.",
+				"user_response":   tc.userResponse,
+			})
+			status, explanation, err := NewFakeProvider().ReviewResponse(context.Background(), string(reviewData))
+			if err != nil {
+				t.Fatalf("ReviewResponse: expected no error, got %v", err)
+			}
+			if status != tc.expectedStatus {
+				t.Errorf("ReviewResponse: expected status %s, got %s", tc.expectedStatus, status)
+			}
+			if explanation == "" {
+				t.Errorf("ReviewResponse: expected non-empty explanation")
+			}
+		})
+	}
+}
+
+func TestFakeProvider_GenerateQuizOptions(t *testing.T) {
+	t.Parallel()
+	content := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue. It weighs ninety tonnes."
+	noReferences := false
+	options := models.QuizOptions{NumQuestions: 4, QuestionTypes: []string{models.QuestionTypeTrueFalse}, IncludeReferences: &noReferences}
+
+	quizContent, _, err := NewFakeProvider().GenerateQuiz(context.Background(), content, testPersona, options)
+	if err != nil {
+		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
+	}
+	var quiz struct {
+		Quiz []map[string]interface{} `json:"quiz"`
+	}
+	if err := json.Unmarshal([]byte(quizContent), &quiz); err != nil {
+		t.Fatalf("GenerateQuiz: expected JSON output, got %v", err)
+	}
+	if len(quiz.Quiz) != 4 {
+		t.Fatalf("GenerateQuiz: expected 4 questions, got %d", len(quiz.Quiz))
+	}
+	for _, question := range quiz.Quiz {
+		if question["type"] != models.QuestionTypeTrueFalse || question["reference"] != "" {
+			t.Errorf("GenerateQuiz: expected true/false questions without references, got %v", question)
+		}
+	}
+}
+
+func TestFakeProvider_GenerateQuizExcludesQuestions(t *testing.T) {
+	t.Parallel()
+	content := "Lobsters live in the ocean. They have ten legs. Shediac hosts a giant lobster statue. It weighs ninety tonnes."
+	options := models.QuizOptions{
+		NumQuestions:     2,
+		QuestionTypes:    []string{models.QuestionTypeTrueFalse},
+		ExcludeQuestions: []string{"Lobsters live in the ocean."},
+	}
+
+	quizContent, _, err := NewFakeProvider().GenerateQuiz(context.Background(), content, testPersona, options)
+	if err != nil {
+		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
+	}
+	var quiz struct {
+		Quiz []map[string]interface{} `json:"quiz"`
+	}
+	if err := json.Unmarshal([]byte(quizContent), &quiz); err != nil {
+		t.Fatalf("GenerateQuiz: expected JSON output, got %v", err)
+	}
+	if len(quiz.Quiz) != 2 || quiz.Quiz[0]["question"] != "They have ten legs." || quiz.Quiz[1]["question"] != "Shediac hosts a giant lobster statue." {
+		t.Errorf("GenerateQuiz: expected the excluded question to be replaced by the next sentence, got %v", quiz.Quiz)
+	}
+}
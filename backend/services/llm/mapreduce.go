@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// ChunkPolicy controls how long content is split and how the questions generated from its chunks are combined
+type ChunkPolicy struct {
+	TokenBudget  int // Largest chunk sent to the model, in estimated tokens; zero never splits content
+	MaxChunks    int // Chunks beyond this are sampled evenly across the document; zero means no limit
+	MaxQuestions int // Size of the final quiz of chunked content; zero keeps every distinct question
+	Concurrency  int // Chunks generated at once; defaults to 1
+}
+
+// DefaultChunkPolicy keeps chunks well inside the context window of every supported model
+var DefaultChunkPolicy = ChunkPolicy{
+	TokenBudget:  4000,
+	MaxChunks:    8,
+	MaxQuestions: 10,
+	Concurrency:  4,
+}
+
+// GenerateChunkedQuiz generates a quiz from content that may be too long for one model call. Content within
+// the policy's token budget is generated in one call, streaming as GenerateQuizStreaming does. Longer content
+// is split with SplitContent, questions are generated for each chunk in parallel, and a deduplicated set
+// balanced across the chunks is selected, of options.NumQuestions questions if set and of the policy's
+// MaxQuestions otherwise. Every question records the index of its chunk under "chunk".
+func GenerateChunkedQuiz(ctx context.Context, p Provider, content string, persona models.Persona, options models.QuizOptions, policy ChunkPolicy, onQuestion func(map[string]interface{}) error) (map[string]interface{}, error) {
+	if onQuestion == nil {
+		onQuestion = func(map[string]interface{}) error { return nil }
+	}
+
+	chunks := SplitContent(content, policy.TokenBudget)
+	if len(chunks) <= 1 {
+		return GenerateQuizStreaming(ctx, p, content, persona, options, func(question map[string]interface{}) error {
+			question["chunk"] = 0
+			return onQuestion(question)
+		})
+	}
+	chunks = sampleChunks(chunks, policy.MaxChunks)
+
+	maxQuestions := policy.MaxQuestions
+	chunkOptions := options
+	if options.NumQuestions > 0 {
+		// Ask each chunk for one question more than its share, leaving room for duplicates
+		maxQuestions = options.NumQuestions
+		chunkOptions.NumQuestions = (options.NumQuestions+len(chunks)-1)/len(chunks) + 1
+	}
+
+	candidates, err := generateChunkQuestions(ctx, p, chunks, persona, chunkOptions, policy.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := selectQuestions(candidates, maxQuestions)
+	quiz := make([]interface{}, 0, len(selected))
+	for _, question := range selected {
+		if err := onQuestion(question); err != nil {
+			return nil, err
+		}
+		quiz = append(quiz, question)
+	}
+	return map[string]interface{}{"quiz": quiz}, nil
+}
+
+// sampleChunks returns at most max chunks spread evenly across the document, keeping their indexes
+func sampleChunks(chunks []Chunk, max int) []Chunk {
+	if max <= 0 || len(chunks) <= max {
+		return chunks
+	}
+	sampled := make([]Chunk, max)
+	for i := range sampled {
+		sampled[i] = chunks[i*len(chunks)/max]
+	}
+	return sampled
+}
+
+// generateChunkQuestions generates the candidate questions of each chunk, running up to concurrency
+// chunks at a time. Chunks that fail are skipped as long as at least one succeeds.
+func generateChunkQuestions(ctx context.Context, p Provider, chunks []Chunk, persona models.Persona, options models.QuizOptions, concurrency int) ([][]map[string]interface{}, error) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	candidates := make([][]map[string]interface{}, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk Chunk) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			candidates[i], errs[i] = generateChunk(ctx, p, chunk, persona, options)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded == 0 {
+		return nil, fmt.Errorf("generating questions for %d chunks: %w", len(chunks), errors.Join(errs...))
+	}
+	return candidates, nil
+}
+
+// generateChunk generates the questions of one chunk, tagging each with the chunk's index
+func generateChunk(ctx context.Context, p Provider, chunk Chunk, persona models.Persona, options models.QuizOptions) ([]map[string]interface{}, error) {
+	text := chunk.Text
+	if chunk.Heading != "" && !strings.HasPrefix(strings.TrimLeft(text, "# "), chunk.Heading) {
+		// Keep the section a chunk continues, so the model knows what its text is about
+		text = chunk.Heading + "\n\n" + text
+	}
+
+	quizContentMap, err := generateQuizMap(ctx, p, text, persona, options)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %d: %w", chunk.Index, err)
+	}
+	items, ok := quizContentMap["quiz"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("chunk %d: quiz field missing or not an array", chunk.Index)
+	}
+
+	questions := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		question, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("chunk %d: error parsing question and answer pair", chunk.Index)
+		}
+		question["chunk"] = chunk.Index
+		questions = append(questions, question)
+	}
+	return questions, nil
+}
+
+// selectQuestions drops near-duplicate questions and picks up to max of the rest, sharing them as evenly
+// as possible between the chunks. The selection keeps the document order.
+func selectQuestions(candidates [][]map[string]interface{}, max int) []map[string]interface{} {
+	duplicates := utils.NewDuplicateFilter()
+	distinct := make([][]map[string]interface{}, len(candidates))
+	total := 0
+	for i, questions := range candidates {
+		for _, question := range questions {
+			if !duplicates.Add(questionText(question)) {
+				continue
+			}
+			distinct[i] = append(distinct[i], question)
+			total++
+		}
+	}
+	if max <= 0 || max > total {
+		max = total
+	}
+
+	// Deal questions to the chunks round-robin, so each gets a share before any gets a second. When a round
+	// cannot reach every chunk, its questions go to chunks spread evenly across the document.
+	taken := make([]int, len(distinct))
+	for selected := 0; selected < max; {
+		var eligible []int
+		for i := range distinct {
+			if taken[i] < len(distinct[i]) {
+				eligible = append(eligible, i)
+			}
+		}
+		remaining := max - selected
+		if remaining < len(eligible) {
+			spread := make([]int, remaining)
+			for k := range spread {
+				spread[k] = eligible[k*len(eligible)/remaining]
+			}
+			eligible = spread
+		}
+		for _, i := range eligible {
+			taken[i]++
+			selected++
+		}
+	}
+
+	var quiz []map[string]interface{}
+	for i, questions := range distinct {
+		quiz = append(quiz, questions[:taken[i]]...)
+	}
+	return quiz
+}
+
+// questionText returns the text identifying a question of the model's quiz array, as utils.QuestionText does
+func questionText(question map[string]interface{}) string {
+	if fillInBlank, ok := question["fill_in_blank"].(map[string]interface{}); ok {
+		if text, ok := fillInBlank["text"].(string); ok && text != "" {
+			return text
+		}
+	}
+	text, _ := question["question"].(string)
+	return text
+}
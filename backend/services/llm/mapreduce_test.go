@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"read-robin/models"
+)
+
+// chunkQuizProvider generates questions about the first word of each paragraph it is given, always adding
+// the same generic question so deduplication can be observed. Content containing "broken" fails.
+type chunkQuizProvider struct {
+	*FakeProvider
+	mu       sync.Mutex
+	contents []string
+}
+
+func (cp *chunkQuizProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	cp.mu.Lock()
+	cp.contents = append(cp.contents, content)
+	cp.mu.Unlock()
+	if strings.Contains(content, "broken") {
+		return "", "", &ParseError{Kind: "quiz", Err: errors.New("not JSON")}
+	}
+
+	quiz := []map[string]string{{"question": "What is this text about?", "answer": "Lobsters", "reference": content[:10]}}
+	for _, paragraph := range strings.Split(content, "\n\n") {
+		if word, _, _ := strings.Cut(paragraph, " "); word != "" {
+			quiz = append(quiz, map[string]string{"question": fmt.Sprintf("What does the text say about %s?", word), "answer": word, "reference": paragraph})
+		}
+	}
+	text, err := json.Marshal(map[string]interface{}{"quiz": quiz})
+	return string(text), string(text), err
+}
+
+func (cp *chunkQuizProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	return cp.GenerateQuiz(ctx, content, persona, options)
+}
+
+// paragraphs returns count paragraphs of about 25 tokens, each starting with a distinct word
+func paragraphs(prefix string, count int) string {
+	var ps []string
+	for i := 0; i < count; i++ {
+		ps = append(ps, fmt.Sprintf("%s%d lobsters are found along the rocky Atlantic coastline.", prefix, i))
+	}
+	return strings.Join(ps, "\n\n")
+}
+
+func TestGenerateChunkedQuiz_SingleChunk(t *testing.T) {
+	t.Parallel()
+	provider := &chunkQuizProvider{FakeProvider: NewFakeProvider()}
+	var streamed []map[string]interface{}
+	quiz, err := GenerateChunkedQuiz(context.Background(), provider, paragraphs("Claw", 2), testPersona, models.QuizOptions{}, DefaultChunkPolicy, func(question map[string]interface{}) error {
+		streamed = append(streamed, question)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateChunkedQuiz: expected no error, got %v", err)
+	}
+	if len(provider.contents) != 1 || len(streamed) != 3 || len(quiz["quiz"].([]interface{})) != 3 {
+		t.Fatalf("GenerateChunkedQuiz: expected one call with 3 questions, got %d calls and %d questions", len(provider.contents), len(streamed))
+	}
+	for _, question := range streamed {
+		if question["chunk"] != 0 {
+			t.Errorf("GenerateChunkedQuiz: expected chunk 0, got %v", question["chunk"])
+		}
+	}
+}
+
+func TestGenerateChunkedQuiz_BalancesChunks(t *testing.T) {
+	t.Parallel()
+	provider := &chunkQuizProvider{FakeProvider: NewFakeProvider()}
+	// Four sections of four paragraphs, each section filling a chunk
+	var sections []string
+	for _, name := range []string{"Anatomy", "Habitat", "Diet", "Fishing"} {
+		sections = append(sections, name+"\n\n"+paragraphs(name, 4))
+	}
+	policy := ChunkPolicy{TokenBudget: 120, MaxQuestions: 9, Concurrency: 2}
+
+	var streamed []map[string]interface{}
+	quiz, err := GenerateChunkedQuiz(context.Background(), provider, strings.Join(sections, "\n\n"), testPersona, models.QuizOptions{}, policy, func(question map[string]interface{}) error {
+		streamed = append(streamed, question)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateChunkedQuiz: expected no error, got %v", err)
+	}
+	if len(provider.contents) != 4 {
+		t.Fatalf("GenerateChunkedQuiz: expected a call per section, got %d", len(provider.contents))
+	}
+	if len(streamed) != 9 || len(quiz["quiz"].([]interface{})) != 9 {
+		t.Fatalf("GenerateChunkedQuiz: expected 9 questions, got %d", len(streamed))
+	}
+
+	perChunk := make(map[int]int)
+	generic := 0
+	previous := 0
+	for _, question := range streamed {
+		chunk := question["chunk"].(int)
+		if chunk < previous {
+			t.Errorf("GenerateChunkedQuiz: expected questions in document order, got chunk %d after %d", chunk, previous)
+		}
+		previous = chunk
+		perChunk[chunk]++
+		if question["question"] == "What is this text about?" {
+			generic++
+		}
+	}
+	if generic != 1 {
+		t.Errorf("GenerateChunkedQuiz: expected the repeated question once, got %d times", generic)
+	}
+	for chunk := 0; chunk < 4; chunk++ {
+		if perChunk[chunk] < 2 || perChunk[chunk] > 3 {
+			t.Errorf("GenerateChunkedQuiz: expected 2 or 3 questions from chunk %d, got %d", chunk, perChunk[chunk])
+		}
+	}
+}
+
+func TestGenerateChunkedQuiz_SamplesChunks(t *testing.T) {
+	t.Parallel()
+	provider := &chunkQuizProvider{FakeProvider: NewFakeProvider()}
+	policy := ChunkPolicy{TokenBudget: 30, MaxChunks: 3}
+
+	quiz, err := GenerateChunkedQuiz(context.Background(), provider, paragraphs("Shell", 9), testPersona, models.QuizOptions{}, policy, nil)
+	if err != nil {
+		t.Fatalf("GenerateChunkedQuiz: expected no error, got %v", err)
+	}
+	if len(provider.contents) != 3 {
+		t.Fatalf("GenerateChunkedQuiz: expected 3 sampled chunks, got %d calls", len(provider.contents))
+	}
+	chunks := make(map[int]bool)
+	for _, question := range quiz["quiz"].([]interface{}) {
+		chunks[question.(map[string]interface{})["chunk"].(int)] = true
+	}
+	if !chunks[0] || !chunks[3] || !chunks[6] {
+		t.Errorf("GenerateChunkedQuiz: expected chunks spread across the document, got %v", chunks)
+	}
+}
+
+func TestGenerateChunkedQuiz_Failures(t *testing.T) {
+	t.Parallel()
+	provider := &chunkQuizProvider{FakeProvider: NewFakeProvider()}
+	policy := ChunkPolicy{TokenBudget: 30}
+
+	content := paragraphs("Tail", 1) + "\n\n" + "This broken paragraph makes the model return something unusable."
+	quiz, err := GenerateChunkedQuiz(context.Background(), provider, content, testPersona, models.QuizOptions{}, policy, nil)
+	if err != nil {
+		t.Fatalf("GenerateChunkedQuiz: expected the failed chunk to be skipped, got %v", err)
+	}
+	for _, question := range quiz["quiz"].([]interface{}) {
+		if chunk := question.(map[string]interface{})["chunk"]; chunk != 0 {
+			t.Errorf("GenerateChunkedQuiz: expected questions from chunk 0 only, got chunk %v", chunk)
+		}
+	}
+
+	content = "This broken paragraph makes the model fail.\n\nSo does this broken one, which follows it."
+	_, err = GenerateChunkedQuiz(context.Background(), provider, content, testPersona, models.QuizOptions{}, ChunkPolicy{TokenBudget: 15}, nil)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("GenerateChunkedQuiz: expected the chunks' ParseError when every chunk fails, got %v", err)
+	}
+}
+
+func TestGenerateChunkedQuiz_NumQuestions(t *testing.T) {
+	t.Parallel()
+	provider := &chunkQuizProvider{FakeProvider: NewFakeProvider()}
+	options := models.QuizOptions{NumQuestions: 4}
+
+	quiz, err := GenerateChunkedQuiz(context.Background(), provider, paragraphs("Antenna", 6), testPersona, options, ChunkPolicy{TokenBudget: 30, MaxQuestions: 10}, nil)
+	if err != nil {
+		t.Fatalf("GenerateChunkedQuiz: expected no error, got %v", err)
+	}
+	if questions := quiz["quiz"].([]interface{}); len(questions) != 4 {
+		t.Errorf("GenerateChunkedQuiz: expected the requested 4 questions, got %d", len(questions))
+	}
+}
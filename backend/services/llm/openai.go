@@ -0,0 +1,260 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"read-robin/models"
+)
+
+const openAIRequestTimeout = 5 * time.Minute
+
+// StatusError is returned when an HTTP model API responds with a non-2xx status
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("model API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// OpenAIProvider is a Provider for any server implementing the OpenAI chat completions API,
+// including OpenAI itself and self-hosted servers such as Ollama and vLLM.
+// It only handles text, so media extraction returns ErrUnsupported.
+type OpenAIProvider struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewOpenAIProvider creates an OpenAIProvider for the API at baseURL (e.g. http://localhost:11434/v1).
+// apiKey may be empty for servers that do not require authentication.
+func NewOpenAIProvider(baseURL, apiKey, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		httpClient: &http.Client{Timeout: openAIRequestTimeout},
+	}
+}
+
+// Close is a no-op for OpenAIProvider
+func (op *OpenAIProvider) Close() error {
+	return nil
+}
+
+// ExtractContentFromHtml extracts readable text and a title from an HTML page
+func (op *OpenAIProvider) ExtractContentFromHtml(ctx context.Context, htmlText string) (map[string]string, string, error) {
+	extractedContent, fullResponse, err := op.chatCompletion(ctx, WebscrapeSystemInstructions, htmlText, ExtractionSchema)
+	if err != nil {
+		return nil, "", fmt.Errorf("error extracting content: %w", err)
+	}
+	return DecodeExtraction(ctx, extractedContent, fullResponse, op.repair(ExtractionSchema))
+}
+
+// ExtractContentFromPdf is not supported by text-only chat completion APIs
+func (op *OpenAIProvider) ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error) {
+	return nil, "", fmt.Errorf("PDF extraction: %w", ErrUnsupported)
+}
+
+// TranscribePdfPages is not supported by text-only chat completion APIs
+func (op *OpenAIProvider) TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error) {
+	return nil, "", fmt.Errorf("PDF page transcription: %w", ErrUnsupported)
+}
+
+// TranscribeMedia is not supported by text-only chat completion APIs
+func (op *OpenAIProvider) TranscribeMedia(ctx context.Context, media Media) (*Transcript, string, error) {
+	return nil, "", fmt.Errorf("media transcription: %w", ErrUnsupported)
+}
+
+// GenerateQuiz generates quiz questions and answers from the summarized content
+func (op *OpenAIProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	quizContent, fullResponse, err := op.chatCompletion(ctx, QuizSystemInstructions, QuizPrompt(content, persona, options), QuizSchema)
+	if err != nil {
+		return "", "", err
+	}
+	return DecodeQuiz(ctx, quizContent, fullResponse, op.repair(QuizSchema))
+}
+
+// OpenAIProvider streams quizzes through the streaming mode of the chat completions API
+var _ StreamingProvider = (*OpenAIProvider)(nil)
+
+// GenerateQuizStream generates quiz questions like GenerateQuiz, reporting the text as the server streams it
+func (op *OpenAIProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	quizContent, fullResponse, err := op.chatCompletionStream(ctx, QuizSystemInstructions, QuizPrompt(content, persona, options), QuizSchema, onText)
+	if err != nil {
+		return "", "", err
+	}
+	return DecodeQuiz(ctx, quizContent, fullResponse, op.repair(QuizSchema))
+}
+
+// ReviewResponse reviews the user's response using the model
+func (op *OpenAIProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	reviewResult, fullResponse, err := op.chatCompletion(ctx, ReviewSystemInstructions, reviewData, ReviewSchema)
+	if err != nil {
+		return "", "", fmt.Errorf("error reviewing response: %w", err)
+	}
+	return DecodeReview(ctx, reviewResult, fullResponse, op.repair(ReviewSchema))
+}
+
+// repair returns a RepairFunc that asks the model to correct a response that does not match schema
+func (op *OpenAIProvider) repair(schema *Schema) RepairFunc {
+	return func(ctx context.Context, prompt string) (string, string, error) {
+		return op.chatCompletion(ctx, RepairSystemInstructions, prompt, schema)
+	}
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    float64         `json:"temperature"`
+	Stream         bool            `json:"stream,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// responseFormat requests structured output matching a JSON schema
+type responseFormat struct {
+	Type       string             `json:"type"`
+	JSONSchema responseJSONSchema `json:"json_schema"`
+}
+
+type responseJSONSchema struct {
+	Name   string  `json:"name"`
+	Schema *Schema `json:"schema"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// chatCompletion sends a system and user message requesting a reply matching schema,
+// and returns the reply text and the raw response body
+func (op *OpenAIProvider) chatCompletion(ctx context.Context, systemInstructions, promptText string, schema *Schema) (string, string, error) {
+	resp, err := op.postChatCompletion(ctx, systemInstructions, promptText, schema, false)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading response: %w", err)
+	}
+
+	var completion chatCompletionResponse
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", "", fmt.Errorf("empty response from model")
+	}
+	return completion.Choices[0].Message.Content, string(body), nil
+}
+
+// chatCompletionStream sends a system and user message with streaming enabled, calling onText with each
+// chunk of the reply. It returns the reply text and the raw server-sent event data.
+func (op *OpenAIProvider) chatCompletionStream(ctx context.Context, systemInstructions, promptText string, schema *Schema, onText func(string) error) (string, string, error) {
+	resp, err := op.postChatCompletion(ctx, systemInstructions, promptText, schema, true)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	var reply, raw strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		raw.WriteString(data)
+		raw.WriteString("\n")
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", "", fmt.Errorf("json.Unmarshal: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		text := chunk.Choices[0].Delta.Content
+		reply.WriteString(text)
+		if err := onText(text); err != nil {
+			return "", "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("error reading stream: %w", err)
+	}
+	if reply.Len() == 0 {
+		return "", "", fmt.Errorf("empty response from model")
+	}
+	return reply.String(), raw.String(), nil
+}
+
+// postChatCompletion sends a chat completion request, returning the response if the server accepted it
+func (op *OpenAIProvider) postChatCompletion(ctx context.Context, systemInstructions, promptText string, schema *Schema, stream bool) (*http.Response, error) {
+	requestBody, err := json.Marshal(chatCompletionRequest{
+		Model: op.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemInstructions},
+			{Role: "user", Content: promptText},
+		},
+		Temperature: 0.2,
+		Stream:      stream,
+		ResponseFormat: &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: responseJSONSchema{Name: "response", Schema: schema},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, op.baseURL+"/chat/completions", bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if op.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+op.apiKey)
+	}
+
+	resp, err := op.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error generating content: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return resp, nil
+}
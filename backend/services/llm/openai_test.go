@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+// newChatServer starts a fake chat completions server that replies with reply and records the last request
+func newChatServer(t *testing.T, status int, reply string, lastRequest *chatCompletionRequest) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		if err := json.NewDecoder(r.Body).Decode(lastRequest); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": reply}},
+			},
+		})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestOpenAIProvider_GenerateQuiz(t *testing.T) {
+	t.Parallel()
+	var request chatCompletionRequest
+	reply := `{"quiz": [{"question": "Q", "answer": "A", "reference": "R"}]}`
+	ts := newChatServer(t, http.StatusOK, reply, &request)
+
+	provider := NewOpenAIProvider(ts.URL+"/v1/", "test-key", "llama3.1")
+	quiz, _, err := provider.GenerateQuiz(context.Background(), "Some content", testPersona, models.QuizOptions{})
+	if err != nil {
+		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
+	}
+	if quiz != reply {
+		t.Errorf("GenerateQuiz: expected %q, got %q", reply, quiz)
+	}
+	if request.Model != "llama3.1" || len(request.Messages) != 2 {
+		t.Fatalf("GenerateQuiz: unexpected request %+v", request)
+	}
+	if request.Messages[0].Role != "system" || request.Messages[0].Content != QuizSystemInstructions {
+		t.Errorf("GenerateQuiz: expected quiz system instructions in first message")
+	}
+	if request.Messages[1].Content != QuizPrompt("Some content", testPersona, models.QuizOptions{}) {
+		t.Errorf("GenerateQuiz: unexpected prompt %q", request.Messages[1].Content)
+	}
+	if request.ResponseFormat == nil || request.ResponseFormat.Type != "json_schema" || request.ResponseFormat.JSONSchema.Schema == nil {
+		t.Errorf("GenerateQuiz: expected a JSON schema response format, got %+v", request.ResponseFormat)
+	}
+}
+
+func TestOpenAIProvider_RepairsInvalidResponse(t *testing.T) {
+	t.Parallel()
+	replies := []string{"Sure! ```json\n{\"status\": \"PASS\"}\n```", `{"status": "PASS", "explanation": "Nice"}`}
+	var requests []chatCompletionRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		reply := replies[min(len(requests), len(replies)-1)]
+		requests = append(requests, request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": reply}},
+			},
+		})
+	}))
+	t.Cleanup(ts.Close)
+
+	status, explanation, err := NewOpenAIProvider(ts.URL, "", "llama3.1").ReviewResponse(context.Background(), "{}")
+	if err != nil {
+		t.Fatalf("ReviewResponse: expected no error, got %v", err)
+	}
+	if status != "PASS" || explanation != "Nice" {
+		t.Errorf("ReviewResponse: got %q, %q", status, explanation)
+	}
+	if len(requests) != 2 || requests[1].Messages[0].Content != RepairSystemInstructions {
+		t.Fatalf("ReviewResponse: expected a single repair request, got %+v", requests)
+	}
+	if !strings.Contains(requests[1].Messages[1].Content, replies[0]) {
+		t.Errorf("ReviewResponse: expected the repair prompt to include the invalid response, got %q", requests[1].Messages[1].Content)
+	}
+}
+
+func TestOpenAIProvider_ReviewResponse(t *testing.T) {
+	t.Parallel()
+	var request chatCompletionRequest
+	ts := newChatServer(t, http.StatusOK, `{"status": "PASS", "explanation": "Nice"}`, &request)
+
+	status, explanation, err := NewOpenAIProvider(ts.URL+"/v1", "test-key", "llama3.1").ReviewResponse(context.Background(), "{}")
+	if err != nil {
+		t.Fatalf("ReviewResponse: expected no error, got %v", err)
+	}
+	if status != "PASS" || explanation != "Nice" {
+		t.Errorf("ReviewResponse: got %q, %q", status, explanation)
+	}
+}
+
+func TestOpenAIProvider_StatusError(t *testing.T) {
+	t.Parallel()
+	var request chatCompletionRequest
+	ts := newChatServer(t, http.StatusTooManyRequests, "", &request)
+
+	_, _, err := NewOpenAIProvider(ts.URL+"/v1", "test-key", "llama3.1").GenerateQuiz(context.Background(), "content", testPersona, models.QuizOptions{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("GenerateQuiz: expected StatusError 429, got %v", err)
+	}
+}
+
+func TestOpenAIProvider_MediaUnsupported(t *testing.T) {
+	t.Parallel()
+	_, _, err := NewOpenAIProvider("http://localhost", "", "llama3.1").ExtractContentFromPdf(context.Background(), "gs://bucket/file.pdf")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ExtractContentFromPdf: expected ErrUnsupported, got %v", err)
+	}
+	_, _, err = NewOpenAIProvider("http://localhost", "", "llama3.1").TranscribeMedia(context.Background(), Media{URI: "gs://bucket/talk.mp3"})
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("TranscribeMedia: expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestOpenAIProvider_GenerateQuizStream(t *testing.T) {
+	t.Parallel()
+	chunks := []string{`{"quiz": [{"question": "Q",`, ` "answer": "A", "reference": "R"}`, `]}`}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if !request.Stream {
+			t.Errorf("expected a streaming request")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(map[string]interface{}{
+				"choices": []map[string]interface{}{{"delta": map[string]string{"content": chunk}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(ts.Close)
+
+	provider := NewOpenAIProvider(ts.URL, "", "llama3.1")
+	var received []string
+	quiz, _, err := provider.GenerateQuizStream(context.Background(), "Some content", testPersona, models.QuizOptions{}, func(text string) error {
+		received = append(received, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateQuizStream: expected no error, got %v", err)
+	}
+	if quiz != strings.Join(chunks, "") {
+		t.Errorf("GenerateQuizStream: expected the concatenated chunks, got %q", quiz)
+	}
+	if len(received) != len(chunks) {
+		t.Errorf("GenerateQuizStream: expected %d chunks, got %v", len(chunks), received)
+	}
+}
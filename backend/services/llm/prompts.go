@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"read-robin/models"
+)
+
+// System instructions shared by every Provider that talks to a text model
+
+const (
+	// WebscrapeSystemInstructions instructs the model to extract readable text and a title from HTML
+	WebscrapeSystemInstructions = `You are a highly skilled model that extracts the full readable text from HTML content and generates a title for the content. Your task is to extract the given HTML content and output it into a clear and concise article, ignoring any unnecessary HTML tags or irrelevant content. Additionally, generate a title from the URL to objectively define the site's host and page names (e.g., www.example.com would be Example, and https://en.wikipedia.org/wiki/The_World%27s_Largest_Lobster would be Wikipedia - The World's Largest Lobster). Return everything in a JSON dictionary with 'content' and 'title' keys. Exclude any markdown code fences in your response. The structure should look like this:
+{
+	"content": "extracted content",
+	"title": "generated title"
+}`
+
+	// QuizSystemInstructions instructs the model to generate quiz questions of mixed types from extracted content
+	QuizSystemInstructions = `You are a highly skilled model that generates quiz questions and answers from summarized content tailored for a specific user persona. The persona details include Name, Role (profession, age, etc.), Language, and Difficulty (beginner, intermediate, expert). Your task is to generate questions and answers based on the summarized content provided, considering the persona details. You should also generate a small piece of reference text that was used to create your question/answer pair. Omit any backticks or format reference.
+
+Use a mix of these question types, choosing for each fact the type that tests it best:
+- "free_text": an open question answered in the learner's own words.
+- "multiple_choice": a question with 3 to 5 plausible choices, exactly one of them correct. Give the choices in "multiple_choice.choices" and the zero-based position of the correct one in "multiple_choice.correct_index".
+- "true_false": a statement the learner judges true or false. Put the statement in "question" and whether it is true in the boolean "true_false.answer".
+- "fill_in_blank": a sentence from the content with key words replaced by ___ (three underscores). Put the sentence in "fill_in_blank.text" and the missing words, in order, in "fill_in_blank.blanks". There must be exactly one blank entry for each ___.
+
+Return everything in a JSON dictionary with 'quiz' being an array of objects. Every object has 'type', 'question', 'answer' and 'reference' strings, where 'answer' states the correct answer in words, plus the object named after its type for the objective types. The structure should look like this:
+{
+	"quiz": [
+		{
+			"type": "free_text",
+			"question": "question",
+			"answer": "answer",
+			"reference": "reference"
+		},
+		{
+			"type": "multiple_choice",
+			"question": "question",
+			"answer": "second choice",
+			"reference": "reference",
+			"multiple_choice": {"choices": ["first choice", "second choice", "third choice"], "correct_index": 1}
+		},
+		{
+			"type": "true_false",
+			"question": "statement",
+			"answer": "false",
+			"reference": "reference",
+			"true_false": {"answer": false}
+		},
+		{
+			"type": "fill_in_blank",
+			"question": "Fill in the blanks.",
+			"answer": "word, phrase",
+			"reference": "reference",
+			"fill_in_blank": {"text": "A sentence with a ___ and another ___.", "blanks": ["word", "phrase"]}
+		}
+	]
+}`
+
+	// PageTranscriptionSystemInstructions instructs the model to read the text of scanned pages of a PDF
+	PageTranscriptionSystemInstructions = `You are a highly skilled model that reads the text of scanned document pages. You are given a PDF and the numbers of the pages whose text could not be extracted, counting the first page as 1. For each of those pages, transcribe its full readable text in reading order, keeping paragraphs apart with blank lines and leaving out page headers, footers and page numbers. Do not summarize or correct the text. Return a JSON object with a "pages" array holding a "page" number and its "text" for each requested page, without any backticks or markdown formatting.`
+
+	// MediaTranscriptionSystemInstructions instructs the model to transcribe audio or video into timed segments
+	MediaTranscriptionSystemInstructions = `You are a highly skilled model that transcribes audio and video. Transcribe everything said in the attached recording, in order, as segments of one or a few sentences each. Give each segment the "start" and "end" time at which it is spoken, written as hours:minutes:seconds such as "0:01:23.5", the "speaker" when speakers can be told apart, using their name if it is said and otherwise labels such as "Speaker 1", and the spoken "text" without summarizing or correcting it. Leave out music and silence. Additionally, generate a "title" that objectively defines the main topic of the recording. Return a JSON object with "title" and "segments" keys, without any backticks or markdown formatting.`
+
+	// RepairSystemInstructions instructs the model to correct a previous response that did not match its JSON schema
+	RepairSystemInstructions = `You are a careful assistant that fixes JSON documents. You are given a validation error, the JSON schema a previous response had to match, and the previous response. Return only the corrected JSON object that matches the schema, keeping the original content wherever possible. Exclude any markdown code fences or other text in your response.`
+
+	// ReviewSystemInstructions instructs the model to grade a user's response to a quiz question
+	ReviewSystemInstructions = `You are a friendly tutor reviewing quiz responses. Determine if the user's response captures the main idea of the expected answer and provide a conversational explanation on why it was right or wrong, including where it was found in the text. Offer additional advice or resources for further learning. Use a lenient approach, focusing on main concepts rather than exact wording. Return the response as a JSON object with "status" and "explanation" keys, without any backticks or markdown formatting.
+
+Examples:
+1. Expected Answer: "The 'Example Domain' is for use in illustrative examples in documents."
+   User Response: "Example Domain is used for examples in documents."
+   Response: {"status": "PASS", "explanation": "Great job! Your answer captures the main idea that Example Domain is used for examples in documents. For more, see example domains in technical writing."}
+   
+2. Expected Answer: "The 'Example Domain' is for use in illustrative examples in documents."
+   User Response: "It is used for examples."
+   Response: {"status": "PASS", "explanation": "Good effort! You captured the essence that it is used for examples, but remember it is specifically for use in documents. Check MDN Web Docs for more info."}
+   
+3. Expected Answer: "The 'Example Domain' is for use in illustrative examples in documents."
+   User Response: "This domain is used in documents."
+   Response: {"status": "FAIL", "explanation": "Almost there! You mentioned documents but missed that it's for illustrative examples. For details, explore RFC 2606."}
+   
+4. Expected Answer: "The 'Example Domain' is for use in illustrative examples in documents."
+   User Response: "It is a domain used in documents."
+   Response: {"status": "FAIL", "explanation": "Not quite. Your answer is too vague. It is used for illustrative examples in documents. Review example domains in technical documentation."}`
+)
+
+// QuizPrompt builds the user prompt asking for a quiz tailored to persona and options from content
+func QuizPrompt(content string, persona models.Persona, options models.QuizOptions) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Generate a quiz for a %s (%s) at %s difficulty level.", persona.Role, persona.Language, persona.Difficulty)
+	if options.NumQuestions > 0 {
+		fmt.Fprintf(&prompt, " Generate exactly %d questions.", options.NumQuestions)
+	}
+	if len(options.QuestionTypes) > 0 {
+		fmt.Fprintf(&prompt, " Only use these question types: %s.", strings.Join(options.QuestionTypes, ", "))
+	}
+	if len(options.FocusTopics) > 0 {
+		fmt.Fprintf(&prompt, " Focus the questions on these topics or sections: %s.", strings.Join(options.FocusTopics, "; "))
+	}
+	if len(options.AvoidTopics) > 0 {
+		fmt.Fprintf(&prompt, " Do not ask about these topics: %s.", strings.Join(options.AvoidTopics, "; "))
+	}
+	if !options.ReferencesIncluded() {
+		prompt.WriteString(" Leave every reference empty.")
+	}
+	if len(options.ExcludeQuestions) > 0 {
+		prompt.WriteString(" Do not repeat or reword any of these questions, which were already asked:")
+		for _, question := range options.ExcludeQuestions {
+			prompt.WriteString("\n- " + question)
+		}
+		prompt.WriteString("\n")
+	}
+	fmt.Fprintf(&prompt, " Base the quiz on the following content: %s", content)
+	return prompt.String()
+}
+
+// PageTranscriptionPrompt lists the 1-based pages of a PDF whose text the model should transcribe
+func PageTranscriptionPrompt(pages []int) string {
+	numbers := make([]string, len(pages))
+	for i, page := range pages {
+		numbers[i] = fmt.Sprint(page)
+	}
+	return "Transcribe pages " + strings.Join(numbers, ", ") + " of the attached PDF."
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestQuizPrompt(t *testing.T) {
+	t.Parallel()
+	plain := QuizPrompt("Lobsters have ten legs.", testPersona, models.QuizOptions{})
+	if !strings.HasSuffix(plain, "Lobsters have ten legs.") || strings.Contains(plain, "exactly") {
+		t.Errorf("QuizPrompt: unexpected prompt without options: %q", plain)
+	}
+
+	noReferences := false
+	prompt := QuizPrompt("Lobsters have ten legs.", testPersona, models.QuizOptions{
+		NumQuestions:      15,
+		QuestionTypes:     []string{models.QuestionTypeTrueFalse, models.QuestionTypeMultipleChoice},
+		FocusTopics:       []string{"Chapter 3", "anatomy"},
+		AvoidTopics:       []string{"prices"},
+		IncludeReferences: &noReferences,
+		ExcludeQuestions:  []string{"How many legs do lobsters have?"},
+	})
+	for _, expected := range []string{
+		"exactly 15 questions",
+		"question types: true_false, multiple_choice.",
+		"topics or sections: Chapter 3; anatomy.",
+		"Do not ask about these topics: prices.",
+		"Leave every reference empty.",
+		"already asked:\n- How many legs do lobsters have?\n",
+	} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("QuizPrompt: expected the prompt to contain %q, got %q", expected, prompt)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package llm
+
+import (
+	"context"
+	"errors"
+
+	"read-robin/models"
+)
+
+// ErrUnsupported is returned by a Provider for content it cannot process, e.g. media on a text-only model
+var ErrUnsupported = errors.New("not supported by this provider")
+
+// Provider is a large language model backend able to extract content, generate quizzes and review answers.
+// Extraction methods return the extracted "content" and "title" along with the raw model response.
+type Provider interface {
+	// ExtractContentFromHtml extracts readable text and a title from an HTML page
+	ExtractContentFromHtml(ctx context.Context, htmlText string) (map[string]string, string, error)
+	// ExtractContentFromPdf extracts readable text and a title from the PDF at pdfPath
+	ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error)
+	// TranscribePdfPages reads the text of the given 1-based pages of a PDF, such as scanned pages without a
+	// text layer, returning the text by page number along with the raw model response
+	TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error)
+	// TranscribeMedia transcribes audio or video into timed segments and generates a title
+	TranscribeMedia(ctx context.Context, media Media) (*Transcript, string, error)
+	// GenerateQuiz generates quiz JSON for persona and options from content, returning the quiz text and the raw response
+	GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error)
+	// ReviewResponse grades a JSON encoded review request, returning the status and an explanation
+	ReviewResponse(ctx context.Context, reviewData string) (string, string, error)
+	// Close releases any resources held by the provider
+	Close() error
+}
+
+// Media is audio or video to transcribe: either a URI the model reads itself (http, https or gs://) or
+// the file's data sent inline
+type Media struct {
+	URI      string
+	Name     string // file name of inline media
+	MIMEType string // MIME type of inline media
+	Data     []byte
+}
+
+// Transcript is the timed transcript of audio or video. Segment offsets are not set.
+type Transcript struct {
+	Title    string
+	Segments []models.Segment
+}
+
+// extractFunc is the shape shared by the Provider extraction methods
+type extractFunc func(ctx context.Context, source string) (map[string]string, string, error)
+
+// generateQuizMap generates a quiz and decodes it into a map for utils.ParseQuizResponse
+func generateQuizMap(ctx context.Context, p Provider, content string, persona models.Persona, options models.QuizOptions) (map[string]interface{}, error) {
+	quizContent, _, err := p.GenerateQuiz(ctx, content, persona, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var quizContentMap map[string]interface{}
+	if _, _, err := DecodeResponse(ctx, "quiz", QuizSchema, quizContent, "", nil, &quizContentMap); err != nil {
+		return nil, err
+	}
+	return quizContentMap, nil
+}
@@ -0,0 +1,386 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"read-robin/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen is returned without calling the model while a provider's circuit breaker is open
+var ErrCircuitOpen = errors.New("model temporarily unavailable: circuit breaker open")
+
+// RetryPolicy configures how a ResilientProvider retries transient model errors
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of calls per request, including the first
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the first jittered backoff, doubling for every retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Deadline bounds the total time spent on a request; no retry is started that would end after it
+	Deadline time.Duration
+	// FailureThreshold is the number of consecutive transient failures that opens the circuit breaker
+	FailureThreshold int
+	// Cooldown is how long the circuit breaker stays open before letting a trial call through
+	Cooldown time.Duration
+}
+
+// DefaultRetryPolicy is suited to Vertex AI quota errors, which usually clear within seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      4,
+	InitialBackoff:   500 * time.Millisecond,
+	MaxBackoff:       10 * time.Second,
+	Deadline:         2 * time.Minute,
+	FailureThreshold: 5,
+	Cooldown:         30 * time.Second,
+}
+
+// IsRetryable reports whether err is a transient model error worth retrying, such as a quota error,
+// an unavailable service or a dropped connection
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrCircuitOpen) || errors.Is(err, errStreamStarted) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	// Vertex AI reports errors as gRPC statuses
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryMetrics counts the calls made through a ResilientProvider
+type RetryMetrics struct {
+	Requests atomic.Int64 // Provider method calls
+	Attempts atomic.Int64 // Model calls, including retries
+	Retries  atomic.Int64 // Model calls retried after a transient error
+	Failures atomic.Int64 // Requests that failed, after any retries
+	Rejected atomic.Int64 // Requests rejected by the open circuit breaker
+}
+
+// Snapshot returns the current counts keyed by name, e.g. for expvar
+func (m *RetryMetrics) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"requests": m.Requests.Load(),
+		"attempts": m.Attempts.Load(),
+		"retries":  m.Retries.Load(),
+		"failures": m.Failures.Load(),
+		"rejected": m.Rejected.Load(),
+	}
+}
+
+// circuitBreaker stops calls to a provider after repeated transient failures, letting a single trial call
+// through once the cooldown has passed
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow reports whether a call may be made now, and whether it is the trial call of an open breaker, which
+// must end with record or release
+func (cb *circuitBreaker) allow(now time.Time) (allowed, trial bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < cb.threshold {
+		return true, false
+	}
+	if now.Before(cb.openUntil) || cb.trial {
+		return false, false
+	}
+	cb.trial = true
+	return true, true
+}
+
+// release ends a trial call without an outcome, such as one cancelled by its caller, so another trial may be made
+func (cb *circuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trial = false
+}
+
+// record updates the breaker with the outcome of a call
+func (cb *circuitBreaker) record(now time.Time, transientFailure bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.trial = false
+	if !transientFailure {
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.failures >= cb.threshold {
+		cb.openUntil = now.Add(cb.cooldown)
+	}
+}
+
+// ResilientProvider wraps a Provider, retrying transient errors with exponential backoff and jitter
+// and failing fast with ErrCircuitOpen while the provider keeps failing
+type ResilientProvider struct {
+	provider Provider
+	policy   RetryPolicy
+	breaker  *circuitBreaker
+	metrics  RetryMetrics
+	logger   *log.Logger
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// ResilientProvider streams through the wrapped provider when it supports streaming
+var _ StreamingProvider = (*ResilientProvider)(nil)
+
+// NewResilientProvider wraps provider with policy. Zero policy fields fall back to DefaultRetryPolicy.
+func NewResilientProvider(provider Provider, policy RetryPolicy, logger *log.Logger) *ResilientProvider {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	if policy.Deadline <= 0 {
+		policy.Deadline = DefaultRetryPolicy.Deadline
+	}
+	if policy.FailureThreshold <= 0 {
+		policy.FailureThreshold = DefaultRetryPolicy.FailureThreshold
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = DefaultRetryPolicy.Cooldown
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &ResilientProvider{
+		provider: provider,
+		policy:   policy,
+		breaker:  &circuitBreaker{threshold: policy.FailureThreshold, cooldown: policy.Cooldown},
+		logger:   logger,
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+// Metrics returns the provider's retry counters
+func (rp *ResilientProvider) Metrics() *RetryMetrics {
+	return &rp.metrics
+}
+
+// do calls op until it succeeds, fails with an error that is not retryable, or the attempts or deadline run out
+func (rp *ResilientProvider) do(ctx context.Context, name string, op func() error) error {
+	rp.metrics.Requests.Add(1)
+	start := rp.now()
+	for attempt := 1; ; attempt++ {
+		allowed, trial := rp.breaker.allow(rp.now())
+		if !allowed {
+			rp.metrics.Rejected.Add(1)
+			return fmt.Errorf("%s: %w", name, ErrCircuitOpen)
+		}
+
+		rp.metrics.Attempts.Add(1)
+		err := rp.call(ctx, trial, op)
+		retryable := IsRetryable(err)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= rp.policy.MaxAttempts || ctx.Err() != nil {
+			rp.metrics.Failures.Add(1)
+			return err
+		}
+
+		backoff := rp.backoff(attempt)
+		if rp.now().Add(backoff).Sub(start) > rp.policy.Deadline {
+			rp.metrics.Failures.Add(1)
+			return fmt.Errorf("%s: retry deadline exceeded: %w", name, err)
+		}
+		rp.logger.Printf("LLM: Retrying %s in %v after attempt %d/%d failed: %v", name, backoff, attempt, rp.policy.MaxAttempts, err)
+		if err := rp.sleep(ctx, backoff); err != nil {
+			rp.metrics.Failures.Add(1)
+			return err
+		}
+		rp.metrics.Retries.Add(1)
+	}
+}
+
+// call makes a single call of op allowed by the breaker and records its outcome. Calls cancelled by ctx say nothing
+// about the provider and are not recorded, but a cancelled trial call still ends the trial.
+func (rp *ResilientProvider) call(ctx context.Context, trial bool, op func() error) error {
+	recorded := false
+	if trial {
+		defer func() {
+			if !recorded {
+				rp.breaker.release()
+			}
+		}()
+	}
+	err := op()
+	if ctx.Err() == nil {
+		rp.breaker.record(rp.now(), IsRetryable(err))
+		recorded = true
+	}
+	return err
+}
+
+// backoff returns the jittered delay before the retry following attempt
+func (rp *ResilientProvider) backoff(attempt int) time.Duration {
+	ceiling := rp.policy.InitialBackoff << (attempt - 1)
+	if ceiling <= 0 || ceiling > rp.policy.MaxBackoff {
+		ceiling = rp.policy.MaxBackoff
+	}
+	// Jitter spreads out the retries of requests that failed together
+	return ceiling/2 + rand.N(ceiling/2+1)
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Close closes the wrapped provider
+func (rp *ResilientProvider) Close() error {
+	return rp.provider.Close()
+}
+
+// ExtractContentFromHtml calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) ExtractContentFromHtml(ctx context.Context, htmlText string) (map[string]string, string, error) {
+	return rp.extract(ctx, "ExtractContentFromHtml", rp.provider.ExtractContentFromHtml, htmlText)
+}
+
+// ExtractContentFromPdf calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) ExtractContentFromPdf(ctx context.Context, pdfPath string) (map[string]string, string, error) {
+	return rp.extract(ctx, "ExtractContentFromPdf", rp.provider.ExtractContentFromPdf, pdfPath)
+}
+
+// TranscribePdfPages calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) TranscribePdfPages(ctx context.Context, pdf []byte, pages []int) (map[int]string, string, error) {
+	var texts map[int]string
+	var fullResponse string
+	err := rp.do(ctx, "TranscribePdfPages", func() error {
+		var err error
+		texts, fullResponse, err = rp.provider.TranscribePdfPages(ctx, pdf, pages)
+		return err
+	})
+	return texts, fullResponse, err
+}
+
+// TranscribeMedia calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) TranscribeMedia(ctx context.Context, media Media) (*Transcript, string, error) {
+	var transcript *Transcript
+	var fullResponse string
+	err := rp.do(ctx, "TranscribeMedia", func() error {
+		var err error
+		transcript, fullResponse, err = rp.provider.TranscribeMedia(ctx, media)
+		return err
+	})
+	return transcript, fullResponse, err
+}
+
+func (rp *ResilientProvider) extract(ctx context.Context, name string, extract extractFunc, source string) (map[string]string, string, error) {
+	var contentMap map[string]string
+	var fullResponse string
+	err := rp.do(ctx, name, func() error {
+		var err error
+		contentMap, fullResponse, err = extract(ctx, source)
+		return err
+	})
+	return contentMap, fullResponse, err
+}
+
+// GenerateQuiz calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	var quizContent, fullResponse string
+	err := rp.do(ctx, "GenerateQuiz", func() error {
+		var err error
+		quizContent, fullResponse, err = rp.provider.GenerateQuiz(ctx, content, persona, options)
+		return err
+	})
+	return quizContent, fullResponse, err
+}
+
+// GenerateQuizStream streams through the wrapped provider if it supports streaming, and otherwise reports
+// the whole quiz at once. A failed stream is only retried if it had not produced any text yet.
+func (rp *ResilientProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	sp, ok := rp.provider.(StreamingProvider)
+	if !ok {
+		quizContent, fullResponse, err := rp.GenerateQuiz(ctx, content, persona, options)
+		if err != nil {
+			return "", "", err
+		}
+		return quizContent, fullResponse, onText(quizContent)
+	}
+
+	var quizContent, fullResponse string
+	streamed := false
+	err := rp.do(ctx, "GenerateQuizStream", func() error {
+		var err error
+		quizContent, fullResponse, err = sp.GenerateQuizStream(ctx, content, persona, options, func(text string) error {
+			streamed = true
+			return onText(text)
+		})
+		if err != nil && streamed {
+			// The caller has seen part of this response, so it cannot be replaced by a retry
+			return fmt.Errorf("stream interrupted: %w", errors.Join(errStreamStarted, err))
+		}
+		return err
+	})
+	return quizContent, fullResponse, err
+}
+
+// errStreamStarted marks stream failures after text was reported, which are never retried
+var errStreamStarted = errors.New("stream already started")
+
+// ReviewResponse calls the wrapped provider, retrying transient errors
+func (rp *ResilientProvider) ReviewResponse(ctx context.Context, reviewData string) (string, string, error) {
+	var reviewStatus, explanation string
+	err := rp.do(ctx, "ReviewResponse", func() error {
+		var err error
+		reviewStatus, explanation, err = rp.provider.ReviewResponse(ctx, reviewData)
+		return err
+	})
+	return reviewStatus, explanation, err
+}
@@ -0,0 +1,282 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"read-robin/models"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// scriptedProvider is a fake model that fails with the scripted errors, in order, before succeeding
+type scriptedProvider struct {
+	*FakeProvider
+	errs   []error
+	calls  int
+	onCall func() // Called on every call, if set
+}
+
+func (sp *scriptedProvider) next() error {
+	sp.calls++
+	if sp.onCall != nil {
+		sp.onCall()
+	}
+	if len(sp.errs) == 0 {
+		return nil
+	}
+	err := sp.errs[0]
+	sp.errs = sp.errs[1:]
+	return err
+}
+
+func (sp *scriptedProvider) GenerateQuiz(ctx context.Context, content string, persona models.Persona, options models.QuizOptions) (string, string, error) {
+	if err := sp.next(); err != nil {
+		return "", "", err
+	}
+	return sp.FakeProvider.GenerateQuiz(ctx, content, persona, options)
+}
+
+func (sp *scriptedProvider) GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error) {
+	if err := onText(`{"quiz": [`); err != nil {
+		return "", "", err
+	}
+	if err := sp.next(); err != nil {
+		return "", "", err
+	}
+	return sp.FakeProvider.GenerateQuiz(ctx, content, persona, options)
+}
+
+// fakeClock is a clock advanced only by the sleeps of a ResilientProvider under test
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+// newTestResilientProvider wraps provider with policy, using a fake clock and a discarded log
+func newTestResilientProvider(provider Provider, policy RetryPolicy) (*ResilientProvider, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)}
+	rp := NewResilientProvider(provider, policy, log.New(testWriter{}, "", 0))
+	rp.now = clock.Now
+	rp.sleep = clock.Sleep
+	return rp, clock
+}
+
+type testWriter struct{}
+
+func (testWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+const scriptedContent = "The lobster sculpture in Shediac is eleven metres long. It was built by the local Rotary Club."
+
+var errQuota = status.Error(codes.ResourceExhausted, "quota exceeded")
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"No error", nil, false},
+		{"Vertex AI quota", fmt.Errorf("error generating content: %w", errQuota), true},
+		{"Vertex AI unavailable", status.Error(codes.Unavailable, "try again"), true},
+		{"Vertex AI invalid argument", status.Error(codes.InvalidArgument, "bad request"), false},
+		{"HTTP 429", &StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"HTTP 503", &StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"HTTP 400", &StatusError{StatusCode: http.StatusBadRequest}, false},
+		{"Invalid response", &ParseError{Kind: "quiz", Err: errors.New("bad JSON")}, false},
+		{"Unsupported", ErrUnsupported, false},
+		{"Circuit open", ErrCircuitOpen, false},
+		{"Cancelled", context.Canceled, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRetryable(tc.err); got != tc.expected {
+				t.Errorf("IsRetryable(%v): expected %v, got %v", tc.err, tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestResilientProvider_RetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+	inner := &scriptedProvider{FakeProvider: NewFakeProvider(), errs: []error{errQuota, &StatusError{StatusCode: http.StatusServiceUnavailable}}}
+	rp, clock := newTestResilientProvider(inner, RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second})
+
+	quiz, _, err := rp.GenerateQuiz(context.Background(), scriptedContent, testPersona, models.QuizOptions{})
+	if err != nil {
+		t.Fatalf("GenerateQuiz: expected no error, got %v", err)
+	}
+	if quiz == "" || inner.calls != 3 {
+		t.Errorf("GenerateQuiz: expected a quiz after 3 calls, got %d calls", inner.calls)
+	}
+	if len(clock.sleeps) != 2 {
+		t.Fatalf("GenerateQuiz: expected 2 backoffs, got %v", clock.sleeps)
+	}
+	for i, sleep := range clock.sleeps {
+		ceiling := time.Second << i
+		if sleep < ceiling/2 || sleep > ceiling {
+			t.Errorf("GenerateQuiz: backoff %d out of range: %v", i, sleep)
+		}
+	}
+
+	metrics := rp.Metrics().Snapshot()
+	if metrics["requests"] != 1 || metrics["attempts"] != 3 || metrics["retries"] != 2 || metrics["failures"] != 0 {
+		t.Errorf("GenerateQuiz: unexpected metrics %v", metrics)
+	}
+}
+
+func TestResilientProvider_GivesUp(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name          string
+		errs          []error
+		policy        RetryPolicy
+		expectedCalls int
+	}{
+		{"Error not retryable", []error{&StatusError{StatusCode: http.StatusBadRequest}}, RetryPolicy{}, 1},
+		{"Attempts exhausted", []error{errQuota, errQuota, errQuota}, RetryPolicy{MaxAttempts: 2}, 2},
+		// Backoffs fall between 20s and 40s, so the first retry always fits the deadline and the second never does
+		{"Deadline exceeded", []error{errQuota, errQuota, errQuota}, RetryPolicy{InitialBackoff: 40 * time.Second, MaxBackoff: 40 * time.Second, Deadline: 40 * time.Second}, 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := &scriptedProvider{FakeProvider: NewFakeProvider(), errs: tc.errs}
+			rp, _ := newTestResilientProvider(inner, tc.policy)
+
+			_, _, err := rp.GenerateQuiz(context.Background(), scriptedContent, testPersona, models.QuizOptions{})
+			if !errors.Is(err, tc.errs[0]) {
+				t.Errorf("GenerateQuiz: expected the model error, got %v", err)
+			}
+			if inner.calls != tc.expectedCalls {
+				t.Errorf("GenerateQuiz: expected %d calls, got %d", tc.expectedCalls, inner.calls)
+			}
+			if failures := rp.Metrics().Failures.Load(); failures != 1 {
+				t.Errorf("GenerateQuiz: expected 1 failure, got %d", failures)
+			}
+		})
+	}
+}
+
+func TestResilientProvider_CircuitBreaker(t *testing.T) {
+	t.Parallel()
+	inner := &scriptedProvider{FakeProvider: NewFakeProvider(), errs: []error{errQuota, errQuota, errQuota, errQuota}}
+	rp, clock := newTestResilientProvider(inner, RetryPolicy{MaxAttempts: 1, FailureThreshold: 3, Cooldown: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); err == nil {
+			t.Fatalf("GenerateQuiz %d: expected an error", i)
+		}
+	}
+	if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GenerateQuiz: expected the circuit to be open, got %v", err)
+	}
+	if inner.calls != 3 || rp.Metrics().Rejected.Load() != 1 {
+		t.Errorf("GenerateQuiz: expected the open circuit to skip the model, got %d calls", inner.calls)
+	}
+
+	// After the cooldown a failed trial call reopens the circuit
+	clock.now = clock.now.Add(time.Minute)
+	if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GenerateQuiz: expected a trial call, got %v", err)
+	}
+	if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("GenerateQuiz: expected the circuit to reopen, got %v", err)
+	}
+
+	// A successful trial call closes it
+	clock.now = clock.now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); err != nil {
+			t.Fatalf("GenerateQuiz %d: expected the circuit to close, got %v", i, err)
+		}
+	}
+}
+
+func TestResilientProvider_CancelledTrialCall(t *testing.T) {
+	t.Parallel()
+	inner := &scriptedProvider{FakeProvider: NewFakeProvider(), errs: []error{errQuota, errQuota, context.Canceled}}
+	rp, clock := newTestResilientProvider(inner, RetryPolicy{MaxAttempts: 1, FailureThreshold: 2, Cooldown: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := rp.GenerateQuiz(context.Background(), scriptedContent, testPersona, models.QuizOptions{}); err == nil {
+			t.Fatalf("GenerateQuiz %d: expected an error", i)
+		}
+	}
+
+	// The caller gives up during the trial call, which leaves the outcome unknown
+	clock.now = clock.now.Add(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	inner.onCall = cancel
+	if _, _, err := rp.GenerateQuiz(ctx, scriptedContent, testPersona, models.QuizOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GenerateQuiz: expected the trial call to be cancelled, got %v", err)
+	}
+
+	// The next call is let through as a new trial, and closes the circuit
+	inner.onCall = nil
+	if _, _, err := rp.GenerateQuiz(context.Background(), scriptedContent, testPersona, models.QuizOptions{}); err != nil {
+		t.Fatalf("GenerateQuiz: expected another trial call after the cancelled one, got %v", err)
+	}
+	if inner.calls != 4 {
+		t.Errorf("GenerateQuiz: expected 4 calls, got %d", inner.calls)
+	}
+}
+
+func TestResilientProvider_DoesNotRetryStartedStream(t *testing.T) {
+	t.Parallel()
+	inner := &scriptedProvider{FakeProvider: NewFakeProvider(), errs: []error{errQuota}}
+	rp, _ := newTestResilientProvider(inner, RetryPolicy{})
+
+	_, _, err := rp.GenerateQuizStream(context.Background(), scriptedContent, testPersona, models.QuizOptions{}, func(string) error { return nil })
+	if !errors.Is(err, errQuota) {
+		t.Fatalf("GenerateQuizStream: expected the model error, got %v", err)
+	}
+	if inner.calls != 1 || IsRetryable(err) {
+		t.Errorf("GenerateQuizStream: expected a single call and a final error, got %d calls: %v", inner.calls, err)
+	}
+}
+
+func TestResilientProvider_OpenAIServiceUnavailable(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "{\"status\": \"PASS\", \"explanation\": \"Nice\"}"}}]}`))
+	}))
+	t.Cleanup(ts.Close)
+
+	rp, _ := newTestResilientProvider(NewOpenAIProvider(ts.URL, "", "llama3.1"), RetryPolicy{})
+	reviewStatus, _, err := rp.ReviewResponse(context.Background(), "{}")
+	if err != nil || reviewStatus != "PASS" {
+		t.Fatalf("ReviewResponse: expected PASS after a retry, got %q, %v", reviewStatus, err)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("ReviewResponse: expected 2 requests, got %d", requests.Load())
+	}
+}
@@ -0,0 +1,393 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// JSON types a Schema can require
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+)
+
+// maxRepairAttempts bounds the round trips asking a model to fix a response that does not match its schema
+const maxRepairAttempts = 1
+
+// Schema is the subset of JSON Schema used to request and validate structured model responses.
+// It marshals to standard JSON Schema for APIs that accept one.
+type Schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+}
+
+// ExtractionSchema describes the response of every content extraction call
+var ExtractionSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"content": {Type: TypeString},
+		"title":   {Type: TypeString},
+	},
+	Required: []string{"content", "title"},
+}
+
+// PagesSchema describes the response of TranscribePdfPages
+var PagesSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"pages": {
+			Type: TypeArray,
+			Items: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"page": {Type: TypeInteger},
+					"text": {Type: TypeString},
+				},
+				Required: []string{"page", "text"},
+			},
+		},
+	},
+	Required: []string{"pages"},
+}
+
+// TranscriptSchema describes the response of TranscribeMedia. Timestamps are strings such as "1:02:03.5",
+// read by utils.ParseTimestamp.
+var TranscriptSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"title": {Type: TypeString},
+		"segments": {
+			Type: TypeArray,
+			Items: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"start":   {Type: TypeString},
+					"end":     {Type: TypeString},
+					"speaker": {Type: TypeString},
+					"text":    {Type: TypeString},
+				},
+				Required: []string{"start", "end", "text"},
+			},
+		},
+	},
+	Required: []string{"title", "segments"},
+}
+
+// QuizSchema describes the response of GenerateQuiz. The payload of each question type is checked
+// further by utils.ParseQuestion.
+var QuizSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"quiz": {
+			Type: TypeArray,
+			Items: &Schema{
+				Type: TypeObject,
+				Properties: map[string]*Schema{
+					"type": {Type: TypeString, Enum: []string{
+						models.QuestionTypeFreeText, models.QuestionTypeMultipleChoice, models.QuestionTypeTrueFalse, models.QuestionTypeFillInBlank,
+					}},
+					"question":  {Type: TypeString},
+					"answer":    {Type: TypeString},
+					"reference": {Type: TypeString},
+					"multiple_choice": {
+						Type: TypeObject,
+						Properties: map[string]*Schema{
+							"choices":       {Type: TypeArray, Items: &Schema{Type: TypeString}},
+							"correct_index": {Type: TypeInteger},
+						},
+						Required: []string{"choices", "correct_index"},
+					},
+					"true_false": {
+						Type:       TypeObject,
+						Properties: map[string]*Schema{"answer": {Type: TypeBoolean}},
+						Required:   []string{"answer"},
+					},
+					"fill_in_blank": {
+						Type: TypeObject,
+						Properties: map[string]*Schema{
+							"text":   {Type: TypeString},
+							"blanks": {Type: TypeArray, Items: &Schema{Type: TypeString}},
+						},
+						Required: []string{"text", "blanks"},
+					},
+				},
+				// Objective questions may leave out the answer text, which ParseQuestion derives from their payload
+				Required: []string{"question", "reference"},
+			},
+		},
+	},
+	Required: []string{"quiz"},
+}
+
+// ReviewSchema describes the response of ReviewResponse
+var ReviewSchema = &Schema{
+	Type: TypeObject,
+	Properties: map[string]*Schema{
+		"status":      {Type: TypeString, Enum: []string{"PASS", "FAIL"}},
+		"explanation": {Type: TypeString},
+	},
+	Required: []string{"status", "explanation"},
+}
+
+// Validate checks a value decoded by encoding/json against the schema
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate(value, "$")
+}
+
+func (s *Schema) validate(value interface{}, path string) error {
+	switch s.Type {
+	case TypeObject:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s: missing required field %q", path, name)
+			}
+		}
+		for name, property := range s.Properties {
+			if field, ok := object[name]; ok {
+				if err := property.validate(field, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case TypeArray:
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case TypeString:
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, strings.TrimSpace(str)) {
+			return fmt.Errorf("%s: %q is not one of %v", path, str, s.Enum)
+		}
+	case TypeInteger:
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+	}
+	return nil
+}
+
+// ParseError is returned when a model response does not match the requested schema, even after repair
+type ParseError struct {
+	Kind     string // What the response was for, e.g. "quiz"
+	Response string // The last response received from the model
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid %s response from model: %v", e.Kind, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractJSON returns the JSON object in a model response, removing markdown code fences and any
+// prose before or after it
+func ExtractJSON(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		// Drop the info string of the fence, e.g. "json"
+		if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+			text = text[newline+1:]
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+
+	start := strings.IndexByte(text, '{')
+	if start < 0 {
+		return "", fmt.Errorf("no JSON object found")
+	}
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return text[start : i+1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unterminated JSON object")
+}
+
+// DecodeStructured extracts the JSON object from a model response, validates it against schema and decodes
+// it into dst, returning the extracted JSON
+func DecodeStructured(text string, schema *Schema, dst interface{}) (string, error) {
+	object, err := ExtractJSON(text)
+	if err != nil {
+		return "", err
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(object), &value); err != nil {
+		return "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	if err := schema.Validate(value); err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal([]byte(object), dst); err != nil {
+		return "", fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	return object, nil
+}
+
+// RepairFunc sends a repair prompt to the model and returns its reply text and raw response
+type RepairFunc func(ctx context.Context, prompt string) (string, string, error)
+
+// DecodeResponse decodes a model response like DecodeStructured. If the response is invalid and repair is not nil,
+// the model is shown its response and the error and asked for a corrected one, a bounded number of times.
+// It returns the extracted JSON and the raw response it came from, or a *ParseError.
+func DecodeResponse(ctx context.Context, kind string, schema *Schema, text, fullResponse string, repair RepairFunc, dst interface{}) (string, string, error) {
+	object, err := DecodeStructured(text, schema, dst)
+	for attempt := 0; err != nil && repair != nil && attempt < maxRepairAttempts; attempt++ {
+		var repairErr error
+		text, fullResponse, repairErr = repair(ctx, RepairPrompt(schema, text, err))
+		if repairErr != nil {
+			return "", "", fmt.Errorf("error repairing %s response: %w", kind, repairErr)
+		}
+		object, err = DecodeStructured(text, schema, dst)
+	}
+	if err != nil {
+		return "", "", &ParseError{Kind: kind, Response: text, Err: err}
+	}
+	return object, fullResponse, nil
+}
+
+// RepairPrompt asks the model to correct a response that failed validation. It is sent with RepairSystemInstructions.
+func RepairPrompt(schema *Schema, response string, err error) string {
+	schemaJSON, _ := json.Marshal(schema)
+	return fmt.Sprintf("Error: %v\n\nJSON schema:\n%s\n\nPrevious response:\n%s", err, schemaJSON, response)
+}
+
+type reviewResult struct {
+	Status      string `json:"status"`
+	Explanation string `json:"explanation"`
+}
+
+// DecodeReview decodes the status and explanation from a model's review response, repairing it with repair if not nil
+func DecodeReview(ctx context.Context, text, fullResponse string, repair RepairFunc) (string, string, error) {
+	var result reviewResult
+	if _, _, err := DecodeResponse(ctx, "review", ReviewSchema, text, fullResponse, repair, &result); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(result.Status), result.Explanation, nil
+}
+
+// DecodeExtraction decodes the content and title from a model's extraction response, repairing it with repair if not nil
+func DecodeExtraction(ctx context.Context, text, fullResponse string, repair RepairFunc) (map[string]string, string, error) {
+	var contentMap map[string]string
+	_, fullResponse, err := DecodeResponse(ctx, "extraction", ExtractionSchema, text, fullResponse, repair, &contentMap)
+	if err != nil {
+		return nil, "", err
+	}
+	return contentMap, fullResponse, nil
+}
+
+// DecodePages decodes the text of each page from a model's page transcription response, repairing it with
+// repair if not nil. Pages other than those requested are dropped.
+func DecodePages(ctx context.Context, text, fullResponse string, requested []int, repair RepairFunc) (map[int]string, string, error) {
+	var result struct {
+		Pages []struct {
+			Page int    `json:"page"`
+			Text string `json:"text"`
+		} `json:"pages"`
+	}
+	_, fullResponse, err := DecodeResponse(ctx, "pages", PagesSchema, text, fullResponse, repair, &result)
+	if err != nil {
+		return nil, "", err
+	}
+	pages := make(map[int]string, len(result.Pages))
+	for _, page := range result.Pages {
+		if slices.Contains(requested, page.Page) {
+			pages[page.Page] = page.Text
+		}
+	}
+	return pages, fullResponse, nil
+}
+
+// DecodeTranscript decodes the title and timed segments from a model's media transcription response, repairing
+// it with repair if not nil. Segments with unreadable timestamps are dropped.
+func DecodeTranscript(ctx context.Context, text, fullResponse string, repair RepairFunc) (*Transcript, string, error) {
+	var result struct {
+		Title    string `json:"title"`
+		Segments []struct {
+			Start   string `json:"start"`
+			End     string `json:"end"`
+			Speaker string `json:"speaker"`
+			Text    string `json:"text"`
+		} `json:"segments"`
+	}
+	_, fullResponse, err := DecodeResponse(ctx, "transcript", TranscriptSchema, text, fullResponse, repair, &result)
+	if err != nil {
+		return nil, "", err
+	}
+	transcript := &Transcript{Title: result.Title}
+	for _, segment := range result.Segments {
+		start, err := utils.ParseTimestamp(segment.Start)
+		if err != nil {
+			continue
+		}
+		end, err := utils.ParseTimestamp(segment.End)
+		if err != nil || end < start {
+			end = start
+		}
+		transcript.Segments = append(transcript.Segments, models.Segment{Start: start, End: end, Speaker: segment.Speaker, Text: segment.Text})
+	}
+	return transcript, fullResponse, nil
+}
+
+// DecodeQuiz validates a model's quiz response, repairing it with repair if not nil, and returns the quiz JSON
+// without any surrounding text along with the raw response
+func DecodeQuiz(ctx context.Context, text, fullResponse string, repair RepairFunc) (string, string, error) {
+	var quiz map[string]interface{}
+	return DecodeResponse(ctx, "quiz", QuizSchema, text, fullResponse, repair, &quiz)
+}
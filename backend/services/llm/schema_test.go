@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestExtractJSON(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"Plain object", `{"status": "PASS"}`, `{"status": "PASS"}`},
+		{"Code fence", "```json\n{\"status\": \"PASS\"}\n```", `{"status": "PASS"}`},
+		{"Surrounding prose", "Here is the review:\n{\"status\": \"PASS\"}\nLet me know if you need more.", `{"status": "PASS"}`},
+		{"Braces in strings", `{"text": "a } and a \" {"} trailing }`, `{"text": "a } and a \" {"}`},
+		{"Nested objects", `{"a": {"b": {}}}`, `{"a": {"b": {}}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ExtractJSON(tc.text)
+			if err != nil {
+				t.Fatalf("ExtractJSON: expected no error, got %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("ExtractJSON: expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	for _, text := range []string{"", "no JSON here", `{"unterminated": "object"`} {
+		if _, err := ExtractJSON(text); err == nil {
+			t.Errorf("ExtractJSON(%q): expected an error", text)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		schema  *Schema
+		json    string
+		wantErr string
+	}{
+		{"Valid review", ReviewSchema, `{"status": "PASS", "explanation": "Nice"}`, ""},
+		{"Missing field", ReviewSchema, `{"status": "PASS"}`, `$: missing required field "explanation"`},
+		{"Value outside enum", ReviewSchema, `{"status": "MAYBE", "explanation": "Hmm"}`, "$.status"},
+		{"Valid extraction", ExtractionSchema, `{"content": "Text", "title": "Title"}`, ""},
+		{"Wrong type", ExtractionSchema, `{"content": 3, "title": "Title"}`, "$.content: expected a string"},
+		{"Valid quiz", QuizSchema, `{"quiz": [{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a", "b"], "correct_index": 1}}]}`, ""},
+		{"Quiz not an array", QuizSchema, `{"quiz": {}}`, "$.quiz: expected an array"},
+		{"Fractional index", QuizSchema, `{"quiz": [{"question": "Q", "reference": "R", "multiple_choice": {"choices": ["a"], "correct_index": 0.5}}]}`, "$.quiz[0].multiple_choice.correct_index"},
+		{"Unknown question type", QuizSchema, `{"quiz": [{"type": "essay", "question": "Q", "reference": "R"}]}`, "$.quiz[0].type"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tc.json), &value); err != nil {
+				t.Fatal(err)
+			}
+			err := tc.schema.Validate(value)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Validate: expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDecodeResponse_Repairs(t *testing.T) {
+	t.Parallel()
+	var prompts []string
+	repair := func(ctx context.Context, prompt string) (string, string, error) {
+		prompts = append(prompts, prompt)
+		return "```json\n{\"status\": \"FAIL\", \"explanation\": \"Fixed\"}\n```", "raw repair", nil
+	}
+
+	status, explanation, err := DecodeReview(context.Background(), `{"status": "FAIL"}`, "raw", repair)
+	if err != nil {
+		t.Fatalf("DecodeReview: expected no error, got %v", err)
+	}
+	if status != "FAIL" || explanation != "Fixed" {
+		t.Errorf("DecodeReview: got %q, %q", status, explanation)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], `missing required field "explanation"`) {
+		t.Errorf("DecodeReview: expected one repair prompt with the validation error, got %q", prompts)
+	}
+}
+
+func TestDecodeResponse_ParseError(t *testing.T) {
+	t.Parallel()
+	repairs := 0
+	repair := func(ctx context.Context, prompt string) (string, string, error) {
+		repairs++
+		return "Sorry, I cannot do that.", "raw repair", nil
+	}
+
+	_, _, err := DecodeExtraction(context.Background(), "not JSON", "raw", repair)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("DecodeExtraction: expected a *ParseError, got %v", err)
+	}
+	if parseErr.Kind != "extraction" || parseErr.Response != "Sorry, I cannot do that." {
+		t.Errorf("DecodeExtraction: unexpected error %+v", parseErr)
+	}
+	if repairs != maxRepairAttempts {
+		t.Errorf("DecodeExtraction: expected %d repair attempts, got %d", maxRepairAttempts, repairs)
+	}
+
+	repairErr := errors.New("model unavailable")
+	_, _, err = DecodeExtraction(context.Background(), "not JSON", "raw", func(ctx context.Context, prompt string) (string, string, error) {
+		return "", "", repairErr
+	})
+	if !errors.Is(err, repairErr) || errors.As(err, &parseErr) {
+		t.Errorf("DecodeExtraction: expected the repair error, got %v", err)
+	}
+}
+
+func TestDecodePages(t *testing.T) {
+	t.Parallel()
+	response := "```json\n" + `{"pages": [{"page": 2, "text": "Lobsters molt."}, {"page": 4, "text": "Not requested."}]}` + "\n```"
+	pages, _, err := DecodePages(context.Background(), response, "raw", []int{2, 3}, nil)
+	if err != nil {
+		t.Fatalf("DecodePages: expected no error, got %v", err)
+	}
+	if len(pages) != 1 || pages[2] != "Lobsters molt." {
+		t.Errorf("DecodePages: expected only the requested page, got %v", pages)
+	}
+
+	var parseErr *ParseError
+	if _, _, err := DecodePages(context.Background(), `{"pages": [{"page": "two"}]}`, "raw", []int{2}, nil); !errors.As(err, &parseErr) {
+		t.Errorf("DecodePages: expected a *ParseError for pages without text, got %v", err)
+	}
+}
+
+func TestDecodeTranscript(t *testing.T) {
+	t.Parallel()
+	response := `{"title": "Lobsters", "segments": [
+		{"start": "0:00", "end": "0:04.5", "speaker": "Ada", "text": "Lobsters grow by molting."},
+		{"start": "soon", "end": "later", "text": "Unreadable timing."},
+		{"start": "1:00:02", "end": "1:00:01", "text": "Ends before it starts."}
+	]}`
+	transcript, _, err := DecodeTranscript(context.Background(), response, "raw", nil)
+	if err != nil {
+		t.Fatalf("DecodeTranscript: expected no error, got %v", err)
+	}
+	expected := &Transcript{Title: "Lobsters", Segments: []models.Segment{
+		{Start: 0, End: 4.5, Speaker: "Ada", Text: "Lobsters grow by molting."},
+		{Start: 3602, End: 3602, Text: "Ends before it starts."},
+	}}
+	if !reflect.DeepEqual(transcript, expected) {
+		t.Errorf("DecodeTranscript: expected %+v, got %+v", expected, transcript)
+	}
+
+	var parseErr *ParseError
+	if _, _, err := DecodeTranscript(context.Background(), `{"title": "Lobsters", "segments": [{"start": "0:00"}]}`, "raw", nil); !errors.As(err, &parseErr) {
+		t.Errorf("DecodeTranscript: expected a *ParseError for segments without text, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"read-robin/models"
+)
+
+// StreamingProvider is implemented by providers that can stream quiz text as the model produces it
+type StreamingProvider interface {
+	Provider
+	// GenerateQuizStream generates quiz JSON like GenerateQuiz, calling onText with each chunk of text as it arrives.
+	// Generation stops with onText's error if it returns one.
+	GenerateQuizStream(ctx context.Context, content string, persona models.Persona, options models.QuizOptions, onText func(string) error) (string, string, error)
+}
+
+// QuizStreamParser incrementally extracts the question objects of a {"quiz": [...]} document
+// from text that arrives in arbitrary chunks
+type QuizStreamParser struct {
+	buf      []byte
+	pos      int
+	inArray  bool
+	done     bool
+	depth    int
+	inString bool
+	escaped  bool
+	start    int
+}
+
+// Write appends chunk to the parsed text and returns the questions completed by it.
+// After an error the parser stops reporting questions.
+func (p *QuizStreamParser) Write(chunk string) ([]map[string]interface{}, error) {
+	p.buf = append(p.buf, chunk...)
+	if p.done {
+		return nil, nil
+	}
+
+	if !p.inArray {
+		key := bytes.Index(p.buf, []byte(`"quiz"`))
+		if key < 0 {
+			return nil, nil
+		}
+		open := bytes.IndexByte(p.buf[key:], '[')
+		if open < 0 {
+			return nil, nil
+		}
+		p.inArray = true
+		p.pos = key + open + 1
+	}
+
+	var questions []map[string]interface{}
+	for ; p.pos < len(p.buf); p.pos++ {
+		c := p.buf[p.pos]
+		if p.inString {
+			switch {
+			case p.escaped:
+				p.escaped = false
+			case c == '\\':
+				p.escaped = true
+			case c == '"':
+				p.inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			p.inString = true
+		case '{':
+			if p.depth == 0 {
+				p.start = p.pos
+			}
+			p.depth++
+		case '}':
+			p.depth--
+			if p.depth == 0 {
+				var question map[string]interface{}
+				if err := json.Unmarshal(p.buf[p.start:p.pos+1], &question); err != nil {
+					p.done = true
+					return questions, fmt.Errorf("error decoding streamed question: %w", err)
+				}
+				questions = append(questions, question)
+			}
+		case ']':
+			if p.depth == 0 {
+				p.done = true
+				return questions, nil
+			}
+		}
+	}
+	return questions, nil
+}
+
+// GenerateQuizStreaming generates a quiz like GenerateQuizFromText, calling onQuestion once for every element
+// of the quiz array, in order. Streaming providers report each question as soon as the model finishes writing
+// it; other providers report all questions once generation completes.
+func GenerateQuizStreaming(ctx context.Context, p Provider, textContent string, persona models.Persona, options models.QuizOptions, onQuestion func(map[string]interface{}) error) (map[string]interface{}, error) {
+	reported := 0
+
+	var quizContent string
+	if sp, ok := p.(StreamingProvider); ok {
+		var parser QuizStreamParser
+		onText := func(chunk string) error {
+			questions, err := parser.Write(chunk)
+			if err != nil {
+				// The final document is decoded as a whole below, so a malformed fragment is not fatal
+				return nil
+			}
+			for _, question := range questions {
+				if err := onQuestion(question); err != nil {
+					return err
+				}
+				reported++
+			}
+			return nil
+		}
+
+		var err error
+		quizContent, _, err = sp.GenerateQuizStream(ctx, textContent, persona, options, onText)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		quizContent, _, err = p.GenerateQuiz(ctx, textContent, persona, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var quizContentMap map[string]interface{}
+	if _, _, err := DecodeResponse(ctx, "quiz", QuizSchema, quizContent, "", nil, &quizContentMap); err != nil {
+		return nil, err
+	}
+
+	// Report whatever the stream parser missed, e.g. everything for non-streaming providers
+	questions, ok := quizContentMap["quiz"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("quiz field missing or not an array")
+	}
+	for _, question := range questions[min(reported, len(questions)):] {
+		questionMap, ok := question.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing question and answer pair")
+		}
+		if err := onQuestion(questionMap); err != nil {
+			return nil, err
+		}
+	}
+	return quizContentMap, nil
+}
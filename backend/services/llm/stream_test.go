@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestQuizStreamParser(t *testing.T) {
+	t.Parallel()
+	text := "```json\n" + `{"quiz": [
+		{"question": "What is \"{quoted}\"?", "answer": "A \\ backslash", "reference": "R1"},
+		{"question": "Second [item]?", "answer": "B", "reference": "R2"}
+	]}` + "\n```"
+
+	// Feed the text one byte at a time so every object boundary falls inside a chunk
+	var parser QuizStreamParser
+	var questions []map[string]interface{}
+	for i := 0; i < len(text); i++ {
+		parsed, err := parser.Write(text[i : i+1])
+		if err != nil {
+			t.Fatalf("Write: expected no error, got %v", err)
+		}
+		questions = append(questions, parsed...)
+	}
+
+	expected := []map[string]interface{}{
+		{"question": `What is "{quoted}"?`, "answer": `A \ backslash`, "reference": "R1"},
+		{"question": "Second [item]?", "answer": "B", "reference": "R2"},
+	}
+	if !reflect.DeepEqual(questions, expected) {
+		t.Errorf("Write: expected %v, got %v", expected, questions)
+	}
+}
+
+// nonStreamingProvider hides the streaming support of the FakeProvider
+type nonStreamingProvider struct {
+	Provider
+}
+
+func TestGenerateQuizStreaming(t *testing.T) {
+	t.Parallel()
+	content := "Lobsters have ten legs. They live on the ocean floor. Some lobsters live for over a century."
+
+	for name, provider := range map[string]Provider{
+		"streaming":     NewFakeProvider(),
+		"non-streaming": nonStreamingProvider{NewFakeProvider()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var reported []interface{}
+			quizContentMap, err := GenerateQuizStreaming(context.Background(), provider, content, testPersona, models.QuizOptions{}, func(question map[string]interface{}) error {
+				reported = append(reported, question)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("GenerateQuizStreaming: expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(reported, quizContentMap["quiz"]) {
+				t.Errorf("GenerateQuizStreaming: expected each question reported once in order, got %v", reported)
+			}
+		})
+	}
+}
+
+func TestGenerateQuizStreaming_StopsOnCallbackError(t *testing.T) {
+	t.Parallel()
+	stop := errors.New("client went away")
+	_, err := GenerateQuizStreaming(context.Background(), NewFakeProvider(), "One two three four. Five six seven eight.", models.Persona{}, models.QuizOptions{}, func(map[string]interface{}) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("GenerateQuizStreaming: expected callback error, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"read-robin/config"
+	"read-robin/services/gemini"
+	"read-robin/services/llm"
+)
+
+// NewLLMProvider creates the llm.Provider selected by cfg.LLMProvider. Providers that call a model
+// are wrapped in an llm.ResilientProvider configured by cfg.
+func NewLLMProvider(ctx context.Context, cfg config.Config) (llm.Provider, error) {
+	var provider llm.Provider
+	switch cfg.LLMProvider {
+	case config.LLMVertex:
+		client, err := gemini.NewGeminiClientWithModel(ctx, cfg.ProjectID, cfg.GeminiLocation, cfg.GeminiModel)
+		if err != nil {
+			return nil, err
+		}
+		provider = client
+	case config.LLMOpenAI:
+		provider = llm.NewOpenAIProvider(cfg.OpenAIBaseURL, cfg.OpenAIAPIKey, cfg.OpenAIModel)
+	case config.LLMFake:
+		return llm.NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider: %q", cfg.LLMProvider)
+	}
+
+	return llm.NewResilientProvider(provider, llm.RetryPolicy{
+		MaxAttempts:      cfg.LLMMaxAttempts,
+		Deadline:         cfg.LLMRetryDeadline,
+		FailureThreshold: cfg.LLMBreakerThreshold,
+		Cooldown:         cfg.LLMBreakerCooldown,
+	}, nil), nil
+}
@@ -0,0 +1,639 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// MemoryStore is a Store that keeps everything in process memory, for local runs and tests
+type MemoryStore struct {
+	mu       sync.RWMutex
+	contents map[string]models.Content
+	jobs     map[string]models.Job
+	attempts map[string]models.Attempt
+	reviews  map[reviewCardKey]models.ReviewCard
+	seqs     map[string]int    // Last quiz sequence number allocated for each content
+	aliases  map[string]string // Current content IDs by the legacy IDs they were migrated from
+	extracts map[string]models.Extraction
+	audits   []models.AuditRecord
+	uploads  map[string]models.Upload
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		contents: make(map[string]models.Content),
+		jobs:     make(map[string]models.Job),
+		attempts: make(map[string]models.Attempt),
+		reviews:  make(map[reviewCardKey]models.ReviewCard),
+		seqs:     make(map[string]int),
+		aliases:  make(map[string]string),
+		extracts: make(map[string]models.Extraction),
+		uploads:  make(map[string]models.Upload),
+	}
+}
+
+// Close is a no-op for MemoryStore
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// SaveQuiz saves a quiz with the title, content text, anchors, segments and media metadata of source, updating existing content if
+// present, and returns the quiz's ID, allocating the next one if the quiz has none
+func (ms *MemoryStore) SaveQuiz(ctx context.Context, source models.Content, quiz models.Quiz) (string, error) {
+	contentID := utils.GenerateContentID(source.OwnerID, source.URL)
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		content = models.Content{
+			URL:       source.URL,
+			Timestamp: time.Now(),
+			ContentID: contentID,
+			OwnerID:   source.OwnerID,
+		}
+	}
+	content.Title = source.Title
+	content.ContentText = source.ContentText
+	content.Anchors = slices.Clone(source.Anchors)
+	content.Segments = slices.Clone(source.Segments)
+	content.Published = source.Published
+	content.Duration = source.Duration
+
+	quizzes := copyQuizzes(content.Quizzes)
+	if quiz.QuizID == "" {
+		seq := max(ms.seqs[contentID], lastQuizSeq(quizzes)) + 1
+		ms.seqs[contentID] = seq
+		quiz.QuizID = formatQuizID(seq)
+	}
+	if i := slices.IndexFunc(quizzes, func(existing models.Quiz) bool { return existing.QuizID == quiz.QuizID }); i >= 0 {
+		quizzes[i] = copyQuiz(quiz)
+	} else {
+		quizzes = append(quizzes, copyQuiz(quiz))
+	}
+	content.Quizzes = quizzes
+
+	ms.contents[contentID] = content
+	return quiz.QuizID, nil
+}
+
+// GetQuiz retrieves a quiz by contentID and quizID
+func (ms *MemoryStore) GetQuiz(ctx context.Context, contentID, quizID string) (*models.Quiz, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return nil, fmt.Errorf("failed retrieving quiz: content %s: %w", contentID, ErrNotFound)
+	}
+	for _, quiz := range content.Quizzes {
+		if quiz.QuizID == quizID {
+			quiz = copyQuiz(quiz)
+			return &quiz, nil
+		}
+	}
+	return nil, fmt.Errorf("no quiz found for quizID %s: %w", quizID, ErrNotFound)
+}
+
+// GetContent retrieves the entire content document by contentID
+func (ms *MemoryStore) GetContent(ctx context.Context, contentID string) (*models.Content, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return nil, fmt.Errorf("failed retrieving content %s: %w", contentID, ErrNotFound)
+	}
+	content.Quizzes = copyQuizzes(content.Quizzes)
+	content.SharedWith = append([]string(nil), content.SharedWith...)
+	content.Anchors = slices.Clone(content.Anchors)
+	content.Segments = slices.Clone(content.Segments)
+	return &content, nil
+}
+
+// GetExistingQuizzes fetches the quizzes already generated for contentID
+func (ms *MemoryStore) GetExistingQuizzes(ctx context.Context, contentID string) ([]models.Quiz, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return nil, fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	return copyQuizzes(content.Quizzes), nil
+}
+
+// ResolveContentID returns the current ID of the content alias was migrated from
+func (ms *MemoryStore) ResolveContentID(ctx context.Context, alias string) (string, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	contentID, ok := ms.aliases[alias]
+	if !ok {
+		return "", fmt.Errorf("content alias %s: %w", alias, ErrNotFound)
+	}
+	return contentID, nil
+}
+
+// SetSharedWith replaces the users, other than the owner, allowed to access contentID
+func (ms *MemoryStore) SetSharedWith(ctx context.Context, contentID string, userIDs []string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	content.SharedWith = append([]string(nil), userIDs...)
+	ms.contents[contentID] = content
+	return nil
+}
+
+// ListContents returns a page of summaries of the content query.UserID owns or that is shared with them
+func (ms *MemoryStore) ListContents(ctx context.Context, query ContentQuery) (ContentPage, error) {
+	after, err := decodeContentCursor(query.Cursor)
+	if err != nil {
+		return ContentPage{}, err
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	contents := []models.Content{}
+	for _, content := range ms.contents {
+		if (content.OwnerID == query.UserID || slices.Contains(content.SharedWith, query.UserID)) && query.matches(content) {
+			contents = append(contents, summarizeContent(content))
+		}
+	}
+	return pageContents(contents, query, after), nil
+}
+
+// SetTitle replaces the title of contentID
+func (ms *MemoryStore) SetTitle(ctx context.Context, contentID, title string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	content.Title = title
+	ms.contents[contentID] = content
+	return nil
+}
+
+// DeleteQuiz deletes quizID of contentID with every user's attempts and review cards at it
+func (ms *MemoryStore) DeleteQuiz(ctx context.Context, contentID, quizID string) (DeletionReport, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return DeletionReport{}, fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	i := slices.IndexFunc(content.Quizzes, func(quiz models.Quiz) bool { return quiz.QuizID == quizID })
+	if i < 0 {
+		return DeletionReport{}, fmt.Errorf("no quiz found for quizID %s: %w", quizID, ErrNotFound)
+	}
+	content.Quizzes = slices.Delete(copyQuizzes(content.Quizzes), i, i+1)
+	ms.contents[contentID] = content
+
+	report := ms.deleteActivity(contentID, quizID)
+	report.Quizzes = 1
+	return report, nil
+}
+
+// DeleteContent deletes contentID and all of its quizzes with every user's attempts and review cards at it
+func (ms *MemoryStore) DeleteContent(ctx context.Context, contentID string) (DeletionReport, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	content, ok := ms.contents[contentID]
+	if !ok {
+		return DeletionReport{}, fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	delete(ms.contents, contentID)
+	delete(ms.seqs, contentID)
+
+	report := ms.deleteActivity(contentID, "")
+	report.Quizzes = len(content.Quizzes)
+	for jobID, job := range ms.jobs {
+		if job.Result != nil && job.Result.ContentID == contentID {
+			delete(ms.jobs, jobID)
+			report.Jobs++
+		}
+	}
+	if _, ok := ms.extracts[content.URL]; ok {
+		delete(ms.extracts, content.URL)
+		report.Extractions++
+	}
+	return report, nil
+}
+
+// deleteActivity deletes the attempts and review cards at contentID, only those at quizID if it is not
+// empty. The caller must hold the write lock.
+func (ms *MemoryStore) deleteActivity(contentID, quizID string) DeletionReport {
+	var report DeletionReport
+	for attemptID, attempt := range ms.attempts {
+		if attempt.ContentID == contentID && (quizID == "" || attempt.QuizID == quizID) {
+			delete(ms.attempts, attemptID)
+			report.Attempts++
+		}
+	}
+	for key := range ms.reviews {
+		if key.contentID == contentID && (quizID == "" || key.quizID == quizID) {
+			delete(ms.reviews, key)
+			report.ReviewCards++
+		}
+	}
+	return report
+}
+
+// MigrateIDs moves content saved under legacy IDs to its current ID and gives legacy questions ULIDs,
+// rewriting the attempts and review cards referring to them
+func (ms *MemoryStore) MigrateIDs(ctx context.Context) (IDMigrationReport, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var report IDMigrationReport
+	contentIDs := make([]string, 0, len(ms.contents))
+	for contentID := range ms.contents {
+		contentIDs = append(contentIDs, contentID)
+	}
+	for _, contentID := range contentIDs {
+		content := ms.contents[contentID]
+		newID := utils.GenerateContentID(content.OwnerID, content.URL)
+		if _, taken := ms.contents[newID]; taken && newID != contentID {
+			report.Skipped++
+			newID = contentID
+		}
+		content.Quizzes = copyQuizzes(content.Quizzes)
+		ids, questions := migrateQuestionIDs(content.Quizzes)
+		if newID == contentID && questions == 0 {
+			continue
+		}
+		report.Questions += questions
+
+		for attemptID, attempt := range ms.attempts {
+			attempt = copyAttempt(attempt)
+			if attempt.ContentID == contentID && migrateAttempt(&attempt, newID, ids) {
+				ms.attempts[attemptID] = attempt
+				report.Attempts++
+			}
+		}
+		for key, card := range ms.reviews {
+			if key.contentID == contentID && migrateReviewCard(&card, newID, ids) {
+				delete(ms.reviews, key)
+				ms.reviews[reviewCardKey{card.UserID, card.ContentID, card.QuizID, card.QuestionID}] = card
+				report.ReviewCards++
+			}
+		}
+		if newID != contentID {
+			delete(ms.contents, contentID)
+			content.ContentID = newID
+			ms.aliases[contentID] = newID
+			ms.seqs[newID] = ms.seqs[contentID]
+			delete(ms.seqs, contentID)
+			report.Contents++
+		}
+		ms.contents[newID] = content
+	}
+	return report, nil
+}
+
+// copyQuiz returns a copy of quiz that shares no slices or pointers with the original
+func copyQuiz(quiz models.Quiz) models.Quiz {
+	questions := make([]models.Question, len(quiz.Questions))
+	for i, question := range quiz.Questions {
+		questions[i] = copyQuestion(question)
+	}
+	if quiz.Questions == nil {
+		questions = nil
+	}
+	quiz.Questions = questions
+	return quiz
+}
+
+// copyQuestion returns a copy of question that shares no slices or pointers with the original
+func copyQuestion(question models.Question) models.Question {
+	if question.MultipleChoice != nil {
+		multipleChoice := *question.MultipleChoice
+		multipleChoice.Choices = append([]string(nil), multipleChoice.Choices...)
+		question.MultipleChoice = &multipleChoice
+	}
+	if question.TrueFalse != nil {
+		trueFalse := *question.TrueFalse
+		question.TrueFalse = &trueFalse
+	}
+	if question.FillInBlank != nil {
+		fillInBlank := *question.FillInBlank
+		fillInBlank.Blanks = append([]string(nil), fillInBlank.Blanks...)
+		question.FillInBlank = &fillInBlank
+	}
+	if question.TimeRange != nil {
+		timeRange := *question.TimeRange
+		question.TimeRange = &timeRange
+	}
+	return question
+}
+
+// copyQuizzes returns a deep copy of quizzes
+func copyQuizzes(quizzes []models.Quiz) []models.Quiz {
+	copied := make([]models.Quiz, len(quizzes))
+	for i, quiz := range quizzes {
+		copied[i] = copyQuiz(quiz)
+	}
+	return copied
+}
+
+// SaveJob creates or replaces a job
+func (ms *MemoryStore) SaveJob(ctx context.Context, job models.Job) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.jobs[job.JobID] = copyJob(job)
+	return nil
+}
+
+// GetJob retrieves a job by jobID
+func (ms *MemoryStore) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	job, ok := ms.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job %s: %w", jobID, ErrNotFound)
+	}
+	job = copyJob(job)
+	return &job, nil
+}
+
+// UpdateJob atomically applies update to jobID and saves the result
+func (ms *MemoryStore) UpdateJob(ctx context.Context, jobID string, update func(*models.Job) error) (*models.Job, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	job, ok := ms.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job %s: %w", jobID, ErrNotFound)
+	}
+	job = copyJob(job)
+	if err := update(&job); err != nil {
+		return nil, err
+	}
+	ms.jobs[jobID] = copyJob(job)
+	return &job, nil
+}
+
+// ListUnfinishedJobs returns queued and running jobs, oldest first
+func (ms *MemoryStore) ListUnfinishedJobs(ctx context.Context) ([]models.Job, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	jobs := []models.Job{}
+	for _, job := range ms.jobs {
+		if job.Status == models.JobStatusQueued || job.Status == models.JobStatusRunning {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// copyJob returns a copy of job that shares no pointers with the original
+func copyJob(job models.Job) models.Job {
+	if job.Result != nil {
+		result := *job.Result
+		job.Result = &result
+	}
+	return job
+}
+
+// SaveAttempt creates or replaces an attempt
+func (ms *MemoryStore) SaveAttempt(ctx context.Context, attempt models.Attempt) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.attempts[attempt.AttemptID] = copyAttempt(attempt)
+	return nil
+}
+
+// GetAttempt retrieves an attempt by attemptID
+func (ms *MemoryStore) GetAttempt(ctx context.Context, attemptID string) (*models.Attempt, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	attempt, ok := ms.attempts[attemptID]
+	if !ok {
+		return nil, fmt.Errorf("attempt %s: %w", attemptID, ErrNotFound)
+	}
+	attempt = copyAttempt(attempt)
+	return &attempt, nil
+}
+
+// UpdateAttempt atomically applies update to attemptID and saves the result
+func (ms *MemoryStore) UpdateAttempt(ctx context.Context, attemptID string, update func(*models.Attempt) error) (*models.Attempt, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	attempt, ok := ms.attempts[attemptID]
+	if !ok {
+		return nil, fmt.Errorf("attempt %s: %w", attemptID, ErrNotFound)
+	}
+	attempt = copyAttempt(attempt)
+	if err := update(&attempt); err != nil {
+		return nil, err
+	}
+	ms.attempts[attemptID] = copyAttempt(attempt)
+	return &attempt, nil
+}
+
+// ListAttempts returns userID's attempts, newest first, only those at contentID if it is not empty
+func (ms *MemoryStore) ListAttempts(ctx context.Context, userID, contentID string) ([]models.Attempt, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	attempts := []models.Attempt{}
+	for _, attempt := range ms.attempts {
+		if attempt.UserID == userID && (contentID == "" || attempt.ContentID == contentID) {
+			attempts = append(attempts, copyAttempt(attempt))
+		}
+	}
+	sortAttempts(attempts)
+	return attempts, nil
+}
+
+// copyAttempt returns a copy of attempt that shares no slices or pointers with the original
+func copyAttempt(attempt models.Attempt) models.Attempt {
+	attempt.Responses = append([]models.AttemptResponse(nil), attempt.Responses...)
+	if attempt.FinishedAt != nil {
+		finishedAt := *attempt.FinishedAt
+		attempt.FinishedAt = &finishedAt
+	}
+	return attempt
+}
+
+// reviewCardKey identifies a user's review card for a question
+type reviewCardKey struct {
+	userID, contentID, quizID, questionID string
+}
+
+// UpdateReviewCard atomically applies update to userID's card for the question and saves the result
+func (ms *MemoryStore) UpdateReviewCard(ctx context.Context, userID, contentID, quizID, questionID string, update func(*models.ReviewCard) error) (*models.ReviewCard, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := reviewCardKey{userID, contentID, quizID, questionID}
+	card, ok := ms.reviews[key]
+	if !ok {
+		card = models.ReviewCard{UserID: userID, ContentID: contentID, QuizID: quizID, QuestionID: questionID}
+	}
+	if err := update(&card); err != nil {
+		return nil, err
+	}
+	ms.reviews[key] = card
+	return &card, nil
+}
+
+// ListDueReviewCards returns userID's cards due at or before now, earliest due first
+func (ms *MemoryStore) ListDueReviewCards(ctx context.Context, userID string, now time.Time) ([]models.ReviewCard, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	cards := []models.ReviewCard{}
+	for key, card := range ms.reviews {
+		if key.userID == userID && !card.DueAt.After(now) {
+			cards = append(cards, card)
+		}
+	}
+	sortReviewCards(cards)
+	return cards, nil
+}
+
+// SaveAuditRecord creates an audit record
+func (ms *MemoryStore) SaveAuditRecord(ctx context.Context, record models.AuditRecord) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.audits = append(ms.audits, record)
+	return nil
+}
+
+// ListAuditRecords returns the records of the deletions userID made, newest first
+func (ms *MemoryStore) ListAuditRecords(ctx context.Context, userID string) ([]models.AuditRecord, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	records := []models.AuditRecord{}
+	for _, record := range ms.audits {
+		if record.UserID == userID {
+			records = append(records, record)
+		}
+	}
+	sortAuditRecords(records)
+	return records, nil
+}
+
+// SaveUpload creates or replaces an upload
+func (ms *MemoryStore) SaveUpload(ctx context.Context, upload models.Upload) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.uploads[upload.UploadID] = copyUpload(upload)
+	return nil
+}
+
+// GetUpload retrieves an upload by uploadID
+func (ms *MemoryStore) GetUpload(ctx context.Context, uploadID string) (*models.Upload, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	upload, ok := ms.uploads[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("upload %s: %w", uploadID, ErrNotFound)
+	}
+	upload = copyUpload(upload)
+	return &upload, nil
+}
+
+// UpdateUpload atomically applies update to uploadID and saves the result
+func (ms *MemoryStore) UpdateUpload(ctx context.Context, uploadID string, update func(*models.Upload) error) (*models.Upload, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	upload, ok := ms.uploads[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("upload %s: %w", uploadID, ErrNotFound)
+	}
+	upload = copyUpload(upload)
+	if err := update(&upload); err != nil {
+		return nil, err
+	}
+	ms.uploads[uploadID] = copyUpload(upload)
+	return &upload, nil
+}
+
+// ListPendingUploads returns the uploads still pending that were created before createdBefore, oldest first
+func (ms *MemoryStore) ListPendingUploads(ctx context.Context, createdBefore time.Time) ([]models.Upload, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	uploads := []models.Upload{}
+	for _, upload := range ms.uploads {
+		if upload.Status == models.UploadStatusPending && upload.CreatedAt.Before(createdBefore) {
+			uploads = append(uploads, copyUpload(upload))
+		}
+	}
+	sortUploads(uploads)
+	return uploads, nil
+}
+
+// DeleteUpload deletes uploadID
+func (ms *MemoryStore) DeleteUpload(ctx context.Context, uploadID string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	delete(ms.uploads, uploadID)
+	return nil
+}
+
+// sortUploads sorts uploads oldest first
+func sortUploads(uploads []models.Upload) {
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].CreatedAt.Before(uploads[j].CreatedAt) })
+}
+
+// copyUpload returns a copy of upload that shares no slices with the original
+func copyUpload(upload models.Upload) models.Upload {
+	upload.Parts = append([]string(nil), upload.Parts...)
+	return upload
+}
+
+// GetExtraction retrieves the cached extraction of source
+func (ms *MemoryStore) GetExtraction(ctx context.Context, source string) (*models.Extraction, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	extraction, ok := ms.extracts[source]
+	if !ok {
+		return nil, fmt.Errorf("extraction of %s: %w", source, ErrNotFound)
+	}
+	return &extraction, nil
+}
+
+// SaveExtraction creates or replaces the cached extraction of extraction.Source
+func (ms *MemoryStore) SaveExtraction(ctx context.Context, extraction models.Extraction) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.extracts[extraction.Source] = extraction
+	return nil
+}
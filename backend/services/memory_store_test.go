@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	testQuizStore(t, NewMemoryStore())
+	testQuizIDAllocation(t, NewMemoryStore())
+	testContentManagement(t, NewMemoryStore())
+	testJobStore(t, NewMemoryStore())
+	testAttemptStore(t, NewMemoryStore())
+	testReviewStore(t, NewMemoryStore())
+	testUploadStore(t, NewMemoryStore())
+	testExtractionCache(t, NewMemoryStore())
+}
+
+func TestMemoryStore_MigrateIDs(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+	testIDMigration(t, store, func(content models.Content) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.contents[content.ContentID] = content
+	})
+}
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	quiz := models.Quiz{QuizID: "0001", Questions: []models.Question{{QuestionID: "0001", Question: "Original"}}}
+	if _, err := store.SaveQuiz(ctx, models.Content{URL: "example.com", Title: "Example", ContentText: "Text"}, quiz); err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+	contentID := utils.GenerateID("example.com")
+
+	retrieved, err := store.GetQuiz(ctx, contentID, "0001")
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	retrieved.Questions[0].Question = "Mutated"
+
+	again, err := store.GetQuiz(ctx, contentID, "0001")
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	if again.Questions[0].Question != "Original" {
+		t.Errorf("GetQuiz: mutation of a returned quiz leaked into the store")
+	}
+}
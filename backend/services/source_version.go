@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// SourceVersioner identifies the current version of a file source without downloading it
+type SourceVersioner interface {
+	// SourceVersion returns an identifier that changes whenever source changes, or "" if it cannot tell
+	SourceVersion(ctx context.Context, source string) (string, error)
+}
+
+// RemoteSourceVersioner reads the object generation of gs:// URIs from Cloud Storage and
+// the ETag or Last-Modified header of http(s) URLs
+type RemoteSourceVersioner struct {
+	httpClient *http.Client
+
+	gcsOnce sync.Once
+	gcs     *storage.Service
+	gcsErr  error
+}
+
+// NewRemoteSourceVersioner creates a RemoteSourceVersioner that checks http(s) URLs with httpClient, which
+// should refuse internal addresses. The Cloud Storage client is created on first use.
+func NewRemoteSourceVersioner(httpClient *http.Client) *RemoteSourceVersioner {
+	return &RemoteSourceVersioner{httpClient: httpClient}
+}
+
+// SourceVersion returns the object generation or HTTP validator of source
+func (rv *RemoteSourceVersioner) SourceVersion(ctx context.Context, source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "gs://"):
+		return rv.objectGeneration(ctx, source)
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return rv.httpValidator(ctx, source)
+	default:
+		return "", nil
+	}
+}
+
+// objectGeneration returns the generation of the Cloud Storage object at uri, which changes whenever it is overwritten
+func (rv *RemoteSourceVersioner) objectGeneration(ctx context.Context, uri string) (string, error) {
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if !ok || object == "" {
+		return "", fmt.Errorf("invalid Cloud Storage URI %q", uri)
+	}
+
+	rv.gcsOnce.Do(func() {
+		// The context only authenticates the client, so it must outlive this request
+		rv.gcs, rv.gcsErr = storage.NewService(context.Background())
+	})
+	if rv.gcsErr != nil {
+		return "", fmt.Errorf("error creating storage client: %w", rv.gcsErr)
+	}
+
+	obj, err := rv.gcs.Objects.Get(bucket, object).Fields("generation").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("error reading object metadata: %w", err)
+	}
+	return "generation:" + strconv.FormatInt(obj.Generation, 10), nil
+}
+
+// httpValidator returns the ETag or Last-Modified header of url from a HEAD request
+func (rv *RemoteSourceVersioner) httpValidator(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := rv.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error checking %s: %w", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return "etag:" + etag, nil
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		return "last-modified:" + lastModified, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,1208 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+
+	_ "modernc.org/sqlite" // Register the pure Go "sqlite" database/sql driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS contents (
+	content_id   TEXT PRIMARY KEY,
+	url          TEXT NOT NULL,
+	title        TEXT NOT NULL,
+	content_text TEXT NOT NULL,
+	timestamp    TEXT NOT NULL,
+	owner_id     TEXT NOT NULL DEFAULT '',
+	shared_with  TEXT NOT NULL DEFAULT '[]',
+	anchors      TEXT NOT NULL DEFAULT '[]',
+	segments     TEXT NOT NULL DEFAULT '[]',
+	published    TEXT NOT NULL DEFAULT '',
+	duration     REAL NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS quizzes (
+	content_id TEXT NOT NULL REFERENCES contents(content_id) ON DELETE CASCADE,
+	quiz_id    TEXT NOT NULL,
+	questions  TEXT NOT NULL,
+	timestamp  TEXT NOT NULL,
+	seq        INTEGER NOT NULL,
+	owner_id   TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (content_id, quiz_id)
+);
+CREATE TABLE IF NOT EXISTS quiz_sequences (
+	content_id TEXT PRIMARY KEY,
+	last_seq   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS content_aliases (
+	alias      TEXT PRIMARY KEY,
+	content_id TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS jobs (
+	job_id     TEXT PRIMARY KEY,
+	status     TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS attempts (
+	attempt_id TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	content_id TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS attempts_by_user ON attempts (user_id, started_at);
+CREATE TABLE IF NOT EXISTS review_cards (
+	user_id     TEXT NOT NULL,
+	content_id  TEXT NOT NULL,
+	quiz_id     TEXT NOT NULL,
+	question_id TEXT NOT NULL,
+	due_at      TEXT NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (user_id, content_id, quiz_id, question_id)
+);
+CREATE INDEX IF NOT EXISTS review_cards_by_due ON review_cards (user_id, due_at);
+CREATE TABLE IF NOT EXISTS audit_records (
+	audit_id   TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_records_by_user ON audit_records (user_id, created_at);
+CREATE TABLE IF NOT EXISTS uploads (
+	upload_id  TEXT PRIMARY KEY,
+	owner_id   TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS extractions (
+	source TEXT PRIMARY KEY,
+	data   TEXT NOT NULL
+);`
+
+// SQLiteStore is a Store backed by a local SQLite database file
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if needed) the SQLite database at path and applies the schema
+func NewSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	// Foreign keys are enabled per connection, so every connection the pool opens enables them from the DSN
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", path+separator+"_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("sql.Open: %v", err)
+	}
+	// SQLite allows a single writer; serializing connections avoids SQLITE_BUSY errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("applying schema: %v", err)
+	}
+	// Databases created before ownership, anchors, segments and media metadata were recorded lack their columns
+	for _, column := range []struct{ table, name, definition string }{
+		{"contents", "owner_id", "TEXT NOT NULL DEFAULT ''"},
+		{"contents", "shared_with", "TEXT NOT NULL DEFAULT '[]'"},
+		{"contents", "anchors", "TEXT NOT NULL DEFAULT '[]'"},
+		{"contents", "segments", "TEXT NOT NULL DEFAULT '[]'"},
+		{"contents", "published", "TEXT NOT NULL DEFAULT ''"},
+		{"contents", "duration", "REAL NOT NULL DEFAULT 0"},
+		{"quizzes", "owner_id", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(ctx, db, column.table, column.name, column.definition); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("migrating schema: %v", err)
+		}
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// addColumnIfMissing adds a column to table unless it already exists
+func addColumnIfMissing(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	var exists bool
+	err := db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, table, column).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Close closes the underlying database
+func (ss *SQLiteStore) Close() error {
+	return ss.db.Close()
+}
+
+// SaveQuiz saves a quiz with the title, content text, anchors, segments and media metadata of source, updating existing content if
+// present, and returns the quiz's ID, allocating the next one in the same transaction if the quiz has none
+func (ss *SQLiteStore) SaveQuiz(ctx context.Context, source models.Content, quiz models.Quiz) (string, error) {
+	contentID := utils.GenerateContentID(source.OwnerID, source.URL)
+
+	questions, err := json.Marshal(quiz.Questions)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %v", err)
+	}
+	anchors := source.Anchors
+	if anchors == nil {
+		anchors = []models.Anchor{}
+	}
+	anchorsJSON, err := json.Marshal(anchors)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %v", err)
+	}
+	segments := source.Segments
+	if segments == nil {
+		segments = []models.Segment{}
+	}
+	segmentsJSON, err := json.Marshal(segments)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO contents (content_id, url, title, content_text, timestamp, owner_id, anchors, segments, published, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (content_id) DO UPDATE
+		SET title = excluded.title, content_text = excluded.content_text, anchors = excluded.anchors, segments = excluded.segments,
+			published = excluded.published, duration = excluded.duration`,
+		contentID, source.URL, source.Title, source.ContentText, formatTime(time.Now()), source.OwnerID, string(anchorsJSON), string(segmentsJSON),
+		source.Published, source.Duration)
+	if err != nil {
+		return "", fmt.Errorf("failed saving content: %v", err)
+	}
+
+	if quiz.QuizID == "" {
+		// Count from the content's existing quizzes the first time, and never reuse an ID
+		var seq int
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO quiz_sequences (content_id, last_seq)
+			VALUES (?, (SELECT COALESCE(MAX(CAST(quiz_id AS INTEGER)), 0) FROM quizzes WHERE content_id = ?) + 1)
+			ON CONFLICT (content_id) DO UPDATE SET last_seq = MAX(last_seq + 1, excluded.last_seq)
+			RETURNING last_seq`,
+			contentID, contentID).Scan(&seq)
+		if err != nil {
+			return "", fmt.Errorf("failed allocating quiz ID: %v", err)
+		}
+		quiz.QuizID = formatQuizID(seq)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO quizzes (content_id, quiz_id, questions, timestamp, seq, owner_id)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(seq), -1) + 1 FROM quizzes WHERE content_id = ?), ?)
+		ON CONFLICT (content_id, quiz_id) DO UPDATE
+		SET questions = excluded.questions, timestamp = excluded.timestamp, owner_id = excluded.owner_id`,
+		contentID, quiz.QuizID, string(questions), formatTime(quiz.Timestamp), contentID, quiz.OwnerID)
+	if err != nil {
+		return "", fmt.Errorf("failed saving quiz: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("commit: %v", err)
+	}
+	return quiz.QuizID, nil
+}
+
+// GetQuiz retrieves a quiz by contentID and quizID
+func (ss *SQLiteStore) GetQuiz(ctx context.Context, contentID, quizID string) (*models.Quiz, error) {
+	row := ss.db.QueryRowContext(ctx,
+		`SELECT quiz_id, questions, timestamp, owner_id FROM quizzes WHERE content_id = ? AND quiz_id = ?`,
+		contentID, quizID)
+	quiz, err := scanQuiz(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no quiz found for quizID %s: %w", quizID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving quiz: %v", err)
+	}
+	return &quiz, nil
+}
+
+// GetContent retrieves the entire content document by contentID
+func (ss *SQLiteStore) GetContent(ctx context.Context, contentID string) (*models.Content, error) {
+	content, err := scanContent(ss.db.QueryRowContext(ctx,
+		`SELECT `+contentColumns+` FROM contents WHERE content_id = ?`, contentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed retrieving content %s: %w", contentID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving content: %v", err)
+	}
+
+	content.Quizzes, err = ss.GetExistingQuizzes(ctx, contentID)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// GetExistingQuizzes fetches the quizzes already generated for contentID
+func (ss *SQLiteStore) GetExistingQuizzes(ctx context.Context, contentID string) ([]models.Quiz, error) {
+	var exists bool
+	err := ss.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM contents WHERE content_id = ?)`, contentID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed checking content: %v", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+
+	rows, err := ss.db.QueryContext(ctx,
+		`SELECT quiz_id, questions, timestamp, owner_id FROM quizzes WHERE content_id = ? ORDER BY seq`, contentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving quizzes: %v", err)
+	}
+	defer rows.Close()
+
+	quizzes := []models.Quiz{}
+	for rows.Next() {
+		quiz, err := scanQuiz(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading quiz: %v", err)
+		}
+		quizzes = append(quizzes, quiz)
+	}
+	return quizzes, rows.Err()
+}
+
+// ResolveContentID returns the current ID of the content alias was migrated from
+func (ss *SQLiteStore) ResolveContentID(ctx context.Context, alias string) (string, error) {
+	var contentID string
+	err := ss.db.QueryRowContext(ctx, `SELECT content_id FROM content_aliases WHERE alias = ?`, alias).Scan(&contentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("content alias %s: %w", alias, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed retrieving content alias: %v", err)
+	}
+	return contentID, nil
+}
+
+// SetSharedWith replaces the users, other than the owner, allowed to access contentID
+func (ss *SQLiteStore) SetSharedWith(ctx context.Context, contentID string, userIDs []string) error {
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+	sharedWith, err := json.Marshal(userIDs)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	result, err := ss.db.ExecContext(ctx, `UPDATE contents SET shared_with = ? WHERE content_id = ?`, string(sharedWith), contentID)
+	if err != nil {
+		return fmt.Errorf("failed updating sharing: %v", err)
+	}
+	return requireAffected(result, contentID)
+}
+
+// ListContents returns a page of summaries of the content query.UserID owns or that is shared with them. Rows
+// are read in the order of the page from its cursor, until one more than the page holds has matched.
+func (ss *SQLiteStore) ListContents(ctx context.Context, query ContentQuery) (ContentPage, error) {
+	after, err := decodeContentCursor(query.Cursor)
+	if err != nil {
+		return ContentPage{}, err
+	}
+
+	column, direction, comparison := "timestamp", "ASC", ">"
+	if query.SortBy == ContentSortTitle {
+		column = "title"
+	}
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	where := `(owner_id = ? OR EXISTS (SELECT 1 FROM json_each(shared_with) WHERE value = ?))`
+	args := []any{query.UserID, query.UserID}
+	if after != nil {
+		value := formatTime(after.Timestamp)
+		if query.SortBy == ContentSortTitle {
+			value = after.Title
+		}
+		where += ` AND (` + column + ` ` + comparison + ` ? OR (` + column + ` = ? AND content_id ` + comparison + ` ?))`
+		args = append(args, value, value, after.ContentID)
+	}
+	// Without a search every row matches, so the rows can be limited; LIMIT -1 reads them all
+	limit := -1
+	if query.Search == "" {
+		limit = query.Limit + 1
+	}
+	args = append(args, limit)
+
+	rows, err := ss.db.QueryContext(ctx, `
+		SELECT content_id, url, title, timestamp, owner_id, published, duration FROM contents
+		WHERE `+where+`
+		ORDER BY `+column+` `+direction+`, content_id `+direction+`
+		LIMIT ?`,
+		args...)
+	if err != nil {
+		return ContentPage{}, fmt.Errorf("failed listing contents: %v", err)
+	}
+	defer rows.Close()
+
+	contents := []models.Content{}
+	for len(contents) <= query.Limit && rows.Next() {
+		var content models.Content
+		var timestamp string
+		if err := rows.Scan(&content.ContentID, &content.URL, &content.Title, &timestamp, &content.OwnerID, &content.Published, &content.Duration); err != nil {
+			return ContentPage{}, fmt.Errorf("failed reading content: %v", err)
+		}
+		content.Timestamp = parseTime(timestamp)
+		if query.matches(content) {
+			contents = append(contents, content)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return ContentPage{}, fmt.Errorf("failed listing contents: %v", err)
+	}
+	return pageContents(contents, query, nil), nil
+}
+
+// SetTitle replaces the title of contentID
+func (ss *SQLiteStore) SetTitle(ctx context.Context, contentID, title string) error {
+	result, err := ss.db.ExecContext(ctx, `UPDATE contents SET title = ? WHERE content_id = ?`, title, contentID)
+	if err != nil {
+		return fmt.Errorf("failed updating title: %v", err)
+	}
+	return requireAffected(result, contentID)
+}
+
+// DeleteQuiz deletes quizID of contentID with every user's attempts and review cards at it, in a transaction
+func (ss *SQLiteStore) DeleteQuiz(ctx context.Context, contentID, quizID string) (DeletionReport, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM quizzes WHERE content_id = ? AND quiz_id = ?`, contentID, quizID)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting quiz: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return DeletionReport{}, err
+	} else if affected == 0 {
+		return DeletionReport{}, fmt.Errorf("no quiz found for quizID %s: %w", quizID, ErrNotFound)
+	}
+
+	report, err := deleteActivity(ctx, tx, contentID, quizID)
+	if err != nil {
+		return DeletionReport{}, err
+	}
+	report.Quizzes = 1
+	if err := tx.Commit(); err != nil {
+		return DeletionReport{}, fmt.Errorf("failed committing deletion: %v", err)
+	}
+	return report, nil
+}
+
+// DeleteContent deletes contentID and all of its quizzes, with every user's attempts and review cards at it,
+// its quiz sequence, the jobs that saved quizzes to it and the extraction cached for its URL, in a transaction.
+// Quizzes are deleted explicitly rather than left to the foreign key cascade.
+func (ss *SQLiteStore) DeleteContent(ctx context.Context, contentID string) (DeletionReport, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var url string
+	err = tx.QueryRowContext(ctx, `SELECT url FROM contents WHERE content_id = ?`, contentID).Scan(&url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeletionReport{}, fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed retrieving content: %v", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM quizzes WHERE content_id = ?`, contentID)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting quizzes: %v", err)
+	}
+	quizzes, err := result.RowsAffected()
+	if err != nil {
+		return DeletionReport{}, err
+	}
+	result, err = tx.ExecContext(ctx, `DELETE FROM contents WHERE content_id = ?`, contentID)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting content: %v", err)
+	}
+	if err := requireAffected(result, contentID); err != nil {
+		return DeletionReport{}, err
+	}
+
+	report, err := deleteActivity(ctx, tx, contentID, "")
+	if err != nil {
+		return DeletionReport{}, err
+	}
+	report.Quizzes = int(quizzes)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM quiz_sequences WHERE content_id = ?`, contentID); err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting quiz sequence: %v", err)
+	}
+	result, err = tx.ExecContext(ctx, `DELETE FROM jobs WHERE json_extract(data, '$.result.content_id') = ?`, contentID)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting jobs: %v", err)
+	}
+	jobs, err := result.RowsAffected()
+	if err != nil {
+		return DeletionReport{}, err
+	}
+	result, err = tx.ExecContext(ctx, `DELETE FROM extractions WHERE source = ?`, url)
+	if err != nil {
+		return DeletionReport{}, fmt.Errorf("failed deleting extraction: %v", err)
+	}
+	extractions, err := result.RowsAffected()
+	if err != nil {
+		return DeletionReport{}, err
+	}
+	report.Jobs, report.Extractions = int(jobs), int(extractions)
+	if err := tx.Commit(); err != nil {
+		return DeletionReport{}, fmt.Errorf("failed committing deletion: %v", err)
+	}
+	return report, nil
+}
+
+// deleteActivity deletes the attempts and review cards at contentID within tx, only those at quizID if it
+// is not empty
+func deleteActivity(ctx context.Context, tx *sql.Tx, contentID, quizID string) (DeletionReport, error) {
+	var report DeletionReport
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM attempts WHERE content_id = ? AND (? = '' OR json_extract(data, '$.quiz_id') = ?)`,
+		contentID, quizID, quizID)
+	if err != nil {
+		return report, fmt.Errorf("failed deleting attempts: %v", err)
+	}
+	attempts, err := result.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+	result, err = tx.ExecContext(ctx, `
+		DELETE FROM review_cards WHERE content_id = ? AND (? = '' OR quiz_id = ?)`,
+		contentID, quizID, quizID)
+	if err != nil {
+		return report, fmt.Errorf("failed deleting review cards: %v", err)
+	}
+	cards, err := result.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+	report.Attempts, report.ReviewCards = int(attempts), int(cards)
+	return report, nil
+}
+
+// MigrateIDs moves content saved under legacy IDs to its current ID and gives legacy questions ULIDs,
+// rewriting the attempts and review cards referring to them, one content per transaction
+func (ss *SQLiteStore) MigrateIDs(ctx context.Context) (IDMigrationReport, error) {
+	type contentKey struct{ contentID, url, ownerID string }
+	rows, err := ss.db.QueryContext(ctx, `SELECT content_id, url, owner_id FROM contents`)
+	if err != nil {
+		return IDMigrationReport{}, fmt.Errorf("failed listing contents: %v", err)
+	}
+	var contents []contentKey
+	for rows.Next() {
+		var key contentKey
+		if err := rows.Scan(&key.contentID, &key.url, &key.ownerID); err != nil {
+			rows.Close()
+			return IDMigrationReport{}, fmt.Errorf("failed reading content: %v", err)
+		}
+		contents = append(contents, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return IDMigrationReport{}, fmt.Errorf("failed listing contents: %v", err)
+	}
+
+	var report IDMigrationReport
+	for _, content := range contents {
+		migrated, err := ss.migrateContentIDs(ctx, content.contentID, utils.GenerateContentID(content.ownerID, content.url))
+		if err != nil {
+			return report, fmt.Errorf("migrating content %s: %w", content.contentID, err)
+		}
+		report.Contents += migrated.Contents
+		report.Questions += migrated.Questions
+		report.Attempts += migrated.Attempts
+		report.ReviewCards += migrated.ReviewCards
+		report.Skipped += migrated.Skipped
+	}
+	return report, nil
+}
+
+// migrateContentIDs migrates contentID to newID, and its questions to ULIDs, inside a transaction
+func (ss *SQLiteStore) migrateContentIDs(ctx context.Context, contentID, newID string) (IDMigrationReport, error) {
+	var report IDMigrationReport
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if newID != contentID {
+		var taken bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM contents WHERE content_id = ?)`, newID).Scan(&taken); err != nil {
+			return report, fmt.Errorf("failed checking content: %v", err)
+		}
+		if taken {
+			report.Skipped++
+			newID = contentID
+		}
+	}
+
+	quizRows, err := tx.QueryContext(ctx, `SELECT quiz_id, questions, timestamp, owner_id FROM quizzes WHERE content_id = ?`, contentID)
+	if err != nil {
+		return report, fmt.Errorf("failed retrieving quizzes: %v", err)
+	}
+	var quizzes []models.Quiz
+	for quizRows.Next() {
+		quiz, err := scanQuiz(quizRows)
+		if err != nil {
+			quizRows.Close()
+			return report, fmt.Errorf("failed reading quiz: %v", err)
+		}
+		quizzes = append(quizzes, quiz)
+	}
+	quizRows.Close()
+	ids, questions := migrateQuestionIDs(quizzes)
+	if newID == contentID && questions == 0 {
+		return IDMigrationReport{Skipped: report.Skipped}, nil
+	}
+	report.Questions = questions
+	for _, quiz := range quizzes {
+		data, err := json.Marshal(quiz.Questions)
+		if err != nil {
+			return report, fmt.Errorf("json.Marshal: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE quizzes SET questions = ? WHERE content_id = ? AND quiz_id = ?`,
+			string(data), contentID, quiz.QuizID); err != nil {
+			return report, fmt.Errorf("failed updating quiz: %v", err)
+		}
+	}
+
+	var attempts []models.Attempt
+	attemptRows, err := tx.QueryContext(ctx, `SELECT data FROM attempts WHERE content_id = ?`, contentID)
+	if err != nil {
+		return report, fmt.Errorf("failed listing attempts: %v", err)
+	}
+	for attemptRows.Next() {
+		var data string
+		var attempt models.Attempt
+		if err := attemptRows.Scan(&data); err != nil {
+			attemptRows.Close()
+			return report, fmt.Errorf("failed reading attempt: %v", err)
+		}
+		if err := json.Unmarshal([]byte(data), &attempt); err != nil {
+			attemptRows.Close()
+			return report, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	attemptRows.Close()
+	for _, attempt := range attempts {
+		if !migrateAttempt(&attempt, newID, ids) {
+			continue
+		}
+		data, err := json.Marshal(attempt)
+		if err != nil {
+			return report, fmt.Errorf("json.Marshal: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE attempts SET content_id = ?, data = ? WHERE attempt_id = ?`,
+			newID, string(data), attempt.AttemptID); err != nil {
+			return report, fmt.Errorf("failed updating attempt: %v", err)
+		}
+		report.Attempts++
+	}
+
+	var cards []models.ReviewCard
+	cardRows, err := tx.QueryContext(ctx, `SELECT data FROM review_cards WHERE content_id = ?`, contentID)
+	if err != nil {
+		return report, fmt.Errorf("failed listing review cards: %v", err)
+	}
+	for cardRows.Next() {
+		var data string
+		var card models.ReviewCard
+		if err := cardRows.Scan(&data); err != nil {
+			cardRows.Close()
+			return report, fmt.Errorf("failed reading review card: %v", err)
+		}
+		if err := json.Unmarshal([]byte(data), &card); err != nil {
+			cardRows.Close()
+			return report, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		cards = append(cards, card)
+	}
+	cardRows.Close()
+	for _, card := range cards {
+		old := card
+		if !migrateReviewCard(&card, newID, ids) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM review_cards WHERE user_id = ? AND content_id = ? AND quiz_id = ? AND question_id = ?`,
+			old.UserID, old.ContentID, old.QuizID, old.QuestionID); err != nil {
+			return report, fmt.Errorf("failed deleting review card: %v", err)
+		}
+		if err := saveReviewCard(ctx, tx, card); err != nil {
+			return report, err
+		}
+		report.ReviewCards++
+	}
+
+	if newID != contentID {
+		// Copy the content to its new ID, move its quizzes over and only then delete it, as quizzes reference it
+		for _, statement := range []string{
+			`INSERT INTO contents (content_id, url, title, content_text, timestamp, owner_id, shared_with, anchors, segments, published, duration)
+			 SELECT ?2, url, title, content_text, timestamp, owner_id, shared_with, anchors, segments, published, duration
+			 FROM contents WHERE content_id = ?1`,
+			`UPDATE quizzes SET content_id = ?2 WHERE content_id = ?1`,
+			`DELETE FROM contents WHERE content_id = ?1`,
+			`UPDATE quiz_sequences SET content_id = ?2 WHERE content_id = ?1`,
+			`INSERT INTO content_aliases (alias, content_id) VALUES (?1, ?2)
+			 ON CONFLICT (alias) DO UPDATE SET content_id = excluded.content_id`,
+		} {
+			if _, err := tx.ExecContext(ctx, statement, contentID, newID); err != nil {
+				return report, fmt.Errorf("failed moving content: %v", err)
+			}
+		}
+		report.Contents++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("failed committing migration: %v", err)
+	}
+	return report, nil
+}
+
+// requireAffected returns ErrNotFound if result changed no rows
+func requireAffected(result sql.Result, contentID string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("content %s: %w", contentID, ErrNotFound)
+	}
+	return nil
+}
+
+// contentColumns are the columns of contents read by scanContent
+const contentColumns = "content_id, url, title, content_text, timestamp, owner_id, shared_with, anchors, segments, published, duration"
+
+// scanContent reads a row of contentColumns into a Content, without its quizzes
+func scanContent(row interface{ Scan(...any) error }) (*models.Content, error) {
+	var content models.Content
+	var timestamp, sharedWith, anchors, segments string
+	err := row.Scan(&content.ContentID, &content.URL, &content.Title, &content.ContentText, &timestamp, &content.OwnerID, &sharedWith, &anchors, &segments,
+		&content.Published, &content.Duration)
+	if err != nil {
+		return nil, err
+	}
+	content.Timestamp = parseTime(timestamp)
+	if err := json.Unmarshal([]byte(sharedWith), &content.SharedWith); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	if err := json.Unmarshal([]byte(anchors), &content.Anchors); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	if len(content.Anchors) == 0 {
+		content.Anchors = nil
+	}
+	if err := json.Unmarshal([]byte(segments), &content.Segments); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	if len(content.Segments) == 0 {
+		content.Segments = nil
+	}
+	return &content, nil
+}
+
+// scanQuiz reads a quiz_id, questions, timestamp, owner_id row into a Quiz
+func scanQuiz(row interface{ Scan(...any) error }) (models.Quiz, error) {
+	var quiz models.Quiz
+	var questions, timestamp string
+	if err := row.Scan(&quiz.QuizID, &questions, &timestamp, &quiz.OwnerID); err != nil {
+		return models.Quiz{}, err
+	}
+	if err := json.Unmarshal([]byte(questions), &quiz.Questions); err != nil {
+		return models.Quiz{}, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	quiz.Timestamp = parseTime(timestamp)
+	return quiz, nil
+}
+
+// sortableTimeFormat is RFC 3339 with fixed width fractional seconds, so stored times sort as text
+const sortableTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// formatTime encodes t for storage in a TEXT column
+func formatTime(t time.Time) string {
+	return t.UTC().Format(sortableTimeFormat)
+}
+
+// parseTime decodes a TEXT column written by formatTime, returning the zero time if it is malformed
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, s)
+	return t
+}
+
+// SaveJob creates or replaces a job
+func (ss *SQLiteStore) SaveJob(ctx context.Context, job models.Job) error {
+	return saveJob(ctx, ss.db, job)
+}
+
+// saveJob upserts job using db, which may be a transaction
+func saveJob(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, job models.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO jobs (job_id, status, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (job_id) DO UPDATE SET status = excluded.status, data = excluded.data`,
+		job.JobID, job.Status, formatTime(job.CreatedAt), string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving job: %v", err)
+	}
+	return nil
+}
+
+// GetJob retrieves a job by jobID
+func (ss *SQLiteStore) GetJob(ctx context.Context, jobID string) (*models.Job, error) {
+	return getJob(ss.db.QueryRowContext(ctx, `SELECT data FROM jobs WHERE job_id = ?`, jobID), jobID)
+}
+
+// getJob decodes the job read by row
+func getJob(row *sql.Row, jobID string) (*models.Job, error) {
+	var data string
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("job %s: %w", jobID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving job: %v", err)
+	}
+
+	var job models.Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return &job, nil
+}
+
+// UpdateJob applies update to jobID inside a transaction
+func (ss *SQLiteStore) UpdateJob(ctx context.Context, jobID string, update func(*models.Job) error) (*models.Job, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	job, err := getJob(tx.QueryRowContext(ctx, `SELECT data FROM jobs WHERE job_id = ?`, jobID), jobID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(job); err != nil {
+		return nil, err
+	}
+	if err := saveJob(ctx, tx, *job); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed committing job: %v", err)
+	}
+	return job, nil
+}
+
+// ListUnfinishedJobs returns queued and running jobs, oldest first
+func (ss *SQLiteStore) ListUnfinishedJobs(ctx context.Context) ([]models.Job, error) {
+	rows, err := ss.db.QueryContext(ctx,
+		`SELECT data FROM jobs WHERE status IN (?, ?) ORDER BY created_at`,
+		models.JobStatusQueued, models.JobStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing jobs: %v", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed reading job: %v", err)
+		}
+		var job models.Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// SaveAttempt creates or replaces an attempt
+func (ss *SQLiteStore) SaveAttempt(ctx context.Context, attempt models.Attempt) error {
+	return saveAttempt(ctx, ss.db, attempt)
+}
+
+// saveAttempt upserts attempt using db, which may be a transaction
+func saveAttempt(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, attempt models.Attempt) error {
+	data, err := json.Marshal(attempt)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO attempts (attempt_id, user_id, content_id, started_at, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (attempt_id) DO UPDATE SET data = excluded.data`,
+		attempt.AttemptID, attempt.UserID, attempt.ContentID, formatTime(attempt.StartedAt), string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving attempt: %v", err)
+	}
+	return nil
+}
+
+// GetAttempt retrieves an attempt by attemptID
+func (ss *SQLiteStore) GetAttempt(ctx context.Context, attemptID string) (*models.Attempt, error) {
+	return getAttempt(ss.db.QueryRowContext(ctx, `SELECT data FROM attempts WHERE attempt_id = ?`, attemptID), attemptID)
+}
+
+// getAttempt decodes the attempt selected by row
+func getAttempt(row *sql.Row, attemptID string) (*models.Attempt, error) {
+	var data string
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("attempt %s: %w", attemptID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving attempt: %v", err)
+	}
+
+	var attempt models.Attempt
+	if err := json.Unmarshal([]byte(data), &attempt); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return &attempt, nil
+}
+
+// UpdateAttempt applies update to attemptID inside a transaction
+func (ss *SQLiteStore) UpdateAttempt(ctx context.Context, attemptID string, update func(*models.Attempt) error) (*models.Attempt, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	attempt, err := getAttempt(tx.QueryRowContext(ctx, `SELECT data FROM attempts WHERE attempt_id = ?`, attemptID), attemptID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(attempt); err != nil {
+		return nil, err
+	}
+	if err := saveAttempt(ctx, tx, *attempt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed committing attempt: %v", err)
+	}
+	return attempt, nil
+}
+
+// ListAttempts returns userID's attempts, newest first, only those at contentID if it is not empty
+func (ss *SQLiteStore) ListAttempts(ctx context.Context, userID, contentID string) ([]models.Attempt, error) {
+	rows, err := ss.db.QueryContext(ctx, `
+		SELECT data FROM attempts WHERE user_id = ? AND (? = '' OR content_id = ?)
+		ORDER BY started_at DESC`,
+		userID, contentID, contentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing attempts: %v", err)
+	}
+	defer rows.Close()
+
+	attempts := []models.Attempt{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed reading attempt: %v", err)
+		}
+		var attempt models.Attempt
+		if err := json.Unmarshal([]byte(data), &attempt); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// SaveUpload creates or replaces an upload
+func (ss *SQLiteStore) SaveUpload(ctx context.Context, upload models.Upload) error {
+	return saveUpload(ctx, ss.db, upload)
+}
+
+// saveUpload upserts upload using db, which may be a transaction
+func saveUpload(ctx context.Context, db interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}, upload models.Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO uploads (upload_id, owner_id, created_at, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (upload_id) DO UPDATE SET data = excluded.data`,
+		upload.UploadID, upload.OwnerID, formatTime(upload.CreatedAt), string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving upload: %v", err)
+	}
+	return nil
+}
+
+// GetUpload retrieves an upload by uploadID
+func (ss *SQLiteStore) GetUpload(ctx context.Context, uploadID string) (*models.Upload, error) {
+	return getUpload(ss.db.QueryRowContext(ctx, `SELECT data FROM uploads WHERE upload_id = ?`, uploadID), uploadID)
+}
+
+// getUpload decodes the upload selected by row
+func getUpload(row *sql.Row, uploadID string) (*models.Upload, error) {
+	var data string
+	err := row.Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("upload %s: %w", uploadID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving upload: %v", err)
+	}
+
+	var upload models.Upload
+	if err := json.Unmarshal([]byte(data), &upload); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return &upload, nil
+}
+
+// UpdateUpload applies update to uploadID inside a transaction
+func (ss *SQLiteStore) UpdateUpload(ctx context.Context, uploadID string, update func(*models.Upload) error) (*models.Upload, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	upload, err := getUpload(tx.QueryRowContext(ctx, `SELECT data FROM uploads WHERE upload_id = ?`, uploadID), uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(upload); err != nil {
+		return nil, err
+	}
+	if err := saveUpload(ctx, tx, *upload); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed committing upload: %v", err)
+	}
+	return upload, nil
+}
+
+// ListPendingUploads returns the uploads still pending that were created before createdBefore, oldest first
+func (ss *SQLiteStore) ListPendingUploads(ctx context.Context, createdBefore time.Time) ([]models.Upload, error) {
+	rows, err := ss.db.QueryContext(ctx, `
+		SELECT data FROM uploads WHERE created_at < ? AND json_extract(data, '$.status') = ?
+		ORDER BY created_at`,
+		formatTime(createdBefore), models.UploadStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing uploads: %v", err)
+	}
+	defer rows.Close()
+
+	uploads := []models.Upload{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed reading upload: %v", err)
+		}
+		var upload models.Upload
+		if err := json.Unmarshal([]byte(data), &upload); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+// DeleteUpload deletes uploadID
+func (ss *SQLiteStore) DeleteUpload(ctx context.Context, uploadID string) error {
+	if _, err := ss.db.ExecContext(ctx, `DELETE FROM uploads WHERE upload_id = ?`, uploadID); err != nil {
+		return fmt.Errorf("failed deleting upload: %v", err)
+	}
+	return nil
+}
+
+// UpdateReviewCard applies update to userID's card for the question inside a transaction
+func (ss *SQLiteStore) UpdateReviewCard(ctx context.Context, userID, contentID, quizID, questionID string, update func(*models.ReviewCard) error) (*models.ReviewCard, error) {
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	card := models.ReviewCard{UserID: userID, ContentID: contentID, QuizID: quizID, QuestionID: questionID}
+	var data string
+	err = tx.QueryRowContext(ctx, `
+		SELECT data FROM review_cards WHERE user_id = ? AND content_id = ? AND quiz_id = ? AND question_id = ?`,
+		userID, contentID, quizID, questionID).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed retrieving review card: %v", err)
+	default:
+		if err := json.Unmarshal([]byte(data), &card); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+	}
+
+	if err := update(&card); err != nil {
+		return nil, err
+	}
+	if err := saveReviewCard(ctx, tx, card); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed committing review card: %v", err)
+	}
+	return &card, nil
+}
+
+// saveReviewCard upserts card using tx
+func saveReviewCard(ctx context.Context, tx *sql.Tx, card models.ReviewCard) error {
+	data, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO review_cards (user_id, content_id, quiz_id, question_id, due_at, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, content_id, quiz_id, question_id) DO UPDATE SET due_at = excluded.due_at, data = excluded.data`,
+		card.UserID, card.ContentID, card.QuizID, card.QuestionID, formatTime(card.DueAt), string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving review card: %v", err)
+	}
+	return nil
+}
+
+// ListDueReviewCards returns userID's cards due at or before now, earliest due first
+func (ss *SQLiteStore) ListDueReviewCards(ctx context.Context, userID string, now time.Time) ([]models.ReviewCard, error) {
+	rows, err := ss.db.QueryContext(ctx, `
+		SELECT data FROM review_cards WHERE user_id = ? AND due_at <= ?
+		ORDER BY due_at, content_id, quiz_id, question_id`,
+		userID, formatTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing review cards: %v", err)
+	}
+	defer rows.Close()
+
+	cards := []models.ReviewCard{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed reading review card: %v", err)
+		}
+		var card models.ReviewCard
+		if err := json.Unmarshal([]byte(data), &card); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+// SaveAuditRecord creates an audit record
+func (ss *SQLiteStore) SaveAuditRecord(ctx context.Context, record models.AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	_, err = ss.db.ExecContext(ctx,
+		`INSERT INTO audit_records (audit_id, user_id, created_at, data) VALUES (?, ?, ?, ?)`,
+		record.AuditID, record.UserID, formatTime(record.CreatedAt), string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving audit record: %v", err)
+	}
+	return nil
+}
+
+// ListAuditRecords returns the records of the deletions userID made, newest first
+func (ss *SQLiteStore) ListAuditRecords(ctx context.Context, userID string) ([]models.AuditRecord, error) {
+	rows, err := ss.db.QueryContext(ctx,
+		`SELECT data FROM audit_records WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing audit records: %v", err)
+	}
+	defer rows.Close()
+
+	records := []models.AuditRecord{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed reading audit record: %v", err)
+		}
+		var record models.AuditRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			return nil, fmt.Errorf("json.Unmarshal: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// GetExtraction retrieves the cached extraction of source
+func (ss *SQLiteStore) GetExtraction(ctx context.Context, source string) (*models.Extraction, error) {
+	var data string
+	err := ss.db.QueryRowContext(ctx, `SELECT data FROM extractions WHERE source = ?`, source).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("extraction of %s: %w", source, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving extraction: %v", err)
+	}
+
+	var extraction models.Extraction
+	if err := json.Unmarshal([]byte(data), &extraction); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+	return &extraction, nil
+}
+
+// SaveExtraction creates or replaces the cached extraction of extraction.Source
+func (ss *SQLiteStore) SaveExtraction(ctx context.Context, extraction models.Extraction) error {
+	data, err := json.Marshal(extraction)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	_, err = ss.db.ExecContext(ctx, `
+		INSERT INTO extractions (source, data) VALUES (?, ?)
+		ON CONFLICT (source) DO UPDATE SET data = excluded.data`,
+		extraction.Source, string(data))
+	if err != nil {
+		return fmt.Errorf("failed saving extraction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	t.Parallel()
+	store, err := NewSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "quizbo.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	testQuizStore(t, store)
+	testQuizIDAllocation(t, store)
+	testContentManagement(t, store)
+	testJobStore(t, store)
+	testAttemptStore(t, store)
+	testReviewStore(t, store)
+	testUploadStore(t, store)
+	testExtractionCache(t, store)
+}
+
+func TestSQLiteStore_ForeignKeysOnEveryConnection(t *testing.T) {
+	t.Parallel()
+	store, err := NewSQLiteStore(context.Background(), filepath.Join(t.TempDir(), "quizbo.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	// Without idle connections each query runs on a connection opened for it
+	store.db.SetMaxIdleConns(0)
+	for i := 0; i < 2; i++ {
+		var enabled int
+		if err := store.db.QueryRow("PRAGMA foreign_keys").Scan(&enabled); err != nil {
+			t.Fatal(err)
+		}
+		if enabled != 1 {
+			t.Fatalf("expected foreign keys on a new connection, got %d", enabled)
+		}
+	}
+}
+
+func TestSQLiteStore_QuizOrderAfterDeletion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store, err := NewSQLiteStore(ctx, filepath.Join(t.TempDir(), "quizbo.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	source := models.Content{URL: "example.com", Title: "Example", ContentText: "Text"}
+	contentID := utils.GenerateID(source.URL)
+	save := func() {
+		t.Helper()
+		if _, err := store.SaveQuiz(ctx, source, models.Quiz{Timestamp: time.Now()}); err != nil {
+			t.Fatalf("SaveQuiz: expected no error, got %v", err)
+		}
+	}
+	save()
+	save()
+	save()
+	if _, err := store.DeleteQuiz(ctx, contentID, "0001"); err != nil {
+		t.Fatalf("DeleteQuiz: expected no error, got %v", err)
+	}
+	save()
+
+	// A quiz saved after a deletion is ordered after every remaining quiz, never tied with one
+	rows, err := store.db.QueryContext(ctx, `SELECT quiz_id, seq FROM quizzes WHERE content_id = ? ORDER BY quiz_id`, contentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	lastSeq := -1
+	for rows.Next() {
+		var quizID string
+		var seq int
+		if err := rows.Scan(&quizID, &seq); err != nil {
+			t.Fatal(err)
+		}
+		if seq <= lastSeq {
+			t.Errorf("expected quiz %s to follow the quiz before it, got seq %d after %d", quizID, seq, lastSeq)
+		}
+		lastSeq = seq
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSQLiteStore_PersistsAcrossReopen(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "quizbo.db")
+
+	store, err := NewSQLiteStore(ctx, path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	quiz := models.Quiz{
+		QuizID:    "0001",
+		Questions: []models.Question{{QuestionID: "0001", Question: "Q", Answer: "A", Reference: "R"}},
+		Timestamp: time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if _, err := store.SaveQuiz(ctx, models.Content{URL: "example.com", Title: "Example", ContentText: "Text"}, quiz); err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewSQLiteStore(ctx, path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error on reopen, got %v", err)
+	}
+	defer reopened.Close()
+
+	retrieved, err := reopened.GetQuiz(ctx, utils.GenerateID("example.com"), "0001")
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	if !retrieved.Timestamp.Equal(quiz.Timestamp) {
+		t.Errorf("GetQuiz: expected timestamp %v, got %v", quiz.Timestamp, retrieved.Timestamp)
+	}
+	if !reflect.DeepEqual(retrieved.Questions[0], quiz.Questions[0]) {
+		t.Errorf("GetQuiz: expected question %v, got %v", quiz.Questions[0], retrieved.Questions[0])
+	}
+}
+
+func TestSQLiteStore_MigrateIDs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store, err := NewSQLiteStore(ctx, filepath.Join(t.TempDir(), "quizbo.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error, got %v", err)
+	}
+	defer store.Close()
+
+	testIDMigration(t, store, func(content models.Content) {
+		_, err := store.db.ExecContext(ctx,
+			`INSERT INTO contents (content_id, url, title, content_text, timestamp, owner_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			content.ContentID, content.URL, content.Title, content.ContentText, formatTime(content.Timestamp), content.OwnerID)
+		if err != nil {
+			t.Fatalf("saving legacy content: %v", err)
+		}
+		for i, quiz := range content.Quizzes {
+			questions, _ := json.Marshal(quiz.Questions)
+			_, err := store.db.ExecContext(ctx,
+				`INSERT INTO quizzes (content_id, quiz_id, questions, timestamp, seq, owner_id) VALUES (?, ?, ?, ?, ?, ?)`,
+				content.ContentID, quiz.QuizID, string(questions), formatTime(quiz.Timestamp), i, quiz.OwnerID)
+			if err != nil {
+				t.Fatalf("saving legacy quiz: %v", err)
+			}
+		}
+	})
+}
+
+func TestSQLiteStore_MigratesDatabaseWithoutOwners(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "quizbo.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.ExecContext(ctx, `
+CREATE TABLE contents (content_id TEXT PRIMARY KEY, url TEXT NOT NULL, title TEXT NOT NULL, content_text TEXT NOT NULL, timestamp TEXT NOT NULL);
+CREATE TABLE quizzes (content_id TEXT NOT NULL REFERENCES contents(content_id) ON DELETE CASCADE, quiz_id TEXT NOT NULL, questions TEXT NOT NULL, timestamp TEXT NOT NULL, seq INTEGER NOT NULL, PRIMARY KEY (content_id, quiz_id));
+INSERT INTO contents VALUES ('legacy', 'example.com', 'Example', 'Text', '2024-07-01T12:00:00Z');
+INSERT INTO quizzes VALUES ('legacy', '0001', '[]', '2024-07-01T12:00:00Z', 1);`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("creating old schema: %v", err)
+	}
+
+	store, err := NewSQLiteStore(ctx, path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: expected no error migrating old schema, got %v", err)
+	}
+	defer store.Close()
+
+	content, err := store.GetContent(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("GetContent: expected no error, got %v", err)
+	}
+	if content.OwnerID != "" || len(content.SharedWith) != 0 || len(content.Quizzes) != 1 {
+		t.Errorf("GetContent: unexpected migrated content %+v", content)
+	}
+	if err := store.SetSharedWith(ctx, "legacy", []string{"bob"}); err != nil {
+		t.Errorf("SetSharedWith: expected no error on migrated content, got %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"read-robin/config"
+	"read-robin/models"
+)
+
+// ErrNotFound is returned by a QuizStore when the requested content or quiz does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrInvalidCursor is returned by ListContents for a cursor that it did not return
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Orders ListContents sorts by
+const (
+	ContentSortCreated = "created"
+	ContentSortTitle   = "title"
+)
+
+// ContentQuery selects a page of the content a user owns or that is shared with them
+type ContentQuery struct {
+	UserID     string
+	Search     string // Keeps only content whose title or URL contains it, ignoring case
+	SortBy     string // ContentSortCreated or ContentSortTitle, with ties broken by content ID
+	Descending bool
+	Limit      int    // Most content in the page, which must be positive
+	Cursor     string // NextCursor of the previous page, or empty for the first page
+}
+
+// ContentPage is a page of content summaries, which leave out the text, anchors, segments, sharing and
+// quizzes of the content
+type ContentPage struct {
+	Contents   []models.Content
+	NextCursor string // Cursor of the next page, empty on the last page
+}
+
+// QuizStore is the persistence layer for content and the quizzes generated from it
+type QuizStore interface {
+	// SaveQuiz atomically saves a quiz with the title, content text, anchors, segments and media metadata of source to the content
+	// source.OwnerID submitted from source.URL, updating existing content if present, and returns the quiz's ID. A quiz without a QuizID is given
+	// the next sequential ID, so concurrent saves never share one; a quiz with a QuizID replaces any quiz
+	// with that ID. Allocated IDs are not reused, even after their quiz is deleted.
+	SaveQuiz(ctx context.Context, source models.Content, quiz models.Quiz) (string, error)
+	// GetQuiz retrieves a quiz by contentID and quizID
+	GetQuiz(ctx context.Context, contentID, quizID string) (*models.Quiz, error)
+	// GetContent retrieves the entire content document by contentID
+	GetContent(ctx context.Context, contentID string) (*models.Content, error)
+	// GetExistingQuizzes fetches the quizzes already generated for contentID
+	GetExistingQuizzes(ctx context.Context, contentID string) ([]models.Quiz, error)
+	// ResolveContentID returns the current ID of the content alias was migrated from, or ErrNotFound
+	ResolveContentID(ctx context.Context, alias string) (string, error)
+	// ListContents returns a page of summaries of the content query.UserID owns or that is shared with
+	// them, or ErrInvalidCursor if query.Cursor was not returned by an earlier page
+	ListContents(ctx context.Context, query ContentQuery) (ContentPage, error)
+	// SetSharedWith replaces the users, other than the owner, allowed to access contentID
+	SetSharedWith(ctx context.Context, contentID string, userIDs []string) error
+	// SetTitle replaces the title of contentID
+	SetTitle(ctx context.Context, contentID, title string) error
+	// DeleteQuiz permanently deletes quizID of contentID with every user's attempts and review cards at it
+	DeleteQuiz(ctx context.Context, contentID, quizID string) (DeletionReport, error)
+	// DeleteContent permanently deletes contentID and all of its quizzes with every user's attempts and
+	// review cards at it, its quiz ID sequence, the jobs that saved quizzes to it and the extraction cached
+	// in the store for its URL
+	DeleteContent(ctx context.Context, contentID string) (DeletionReport, error)
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// JobStore persists asynchronous quiz generation jobs so they survive restarts
+type JobStore interface {
+	// SaveJob creates or replaces a job
+	SaveJob(ctx context.Context, job models.Job) error
+	// GetJob retrieves a job by jobID
+	GetJob(ctx context.Context, jobID string) (*models.Job, error)
+	// UpdateJob atomically applies update to jobID and saves the result. If update returns an error the job
+	// is left unchanged and the error is returned.
+	UpdateJob(ctx context.Context, jobID string, update func(*models.Job) error) (*models.Job, error)
+	// ListUnfinishedJobs returns queued and running jobs, oldest first
+	ListUnfinishedJobs(ctx context.Context) ([]models.Job, error)
+}
+
+// AttemptStore persists users' attempts at quizzes and their scores
+type AttemptStore interface {
+	// SaveAttempt creates or replaces an attempt
+	SaveAttempt(ctx context.Context, attempt models.Attempt) error
+	// GetAttempt retrieves an attempt by attemptID
+	GetAttempt(ctx context.Context, attemptID string) (*models.Attempt, error)
+	// UpdateAttempt atomically applies update to attemptID and saves the result. If update returns
+	// an error the attempt is left unchanged and the error is returned.
+	UpdateAttempt(ctx context.Context, attemptID string, update func(*models.Attempt) error) (*models.Attempt, error)
+	// ListAttempts returns userID's attempts, newest first, only those at contentID if it is not empty
+	ListAttempts(ctx context.Context, userID, contentID string) ([]models.Attempt, error)
+}
+
+// ReviewStore persists users' spaced-repetition review cards, one per user and question
+type ReviewStore interface {
+	// UpdateReviewCard atomically applies update to userID's card for the question, starting from a new card
+	// if the user has not reviewed it before, and saves the result. If update returns an error the card is
+	// left unchanged and the error is returned.
+	UpdateReviewCard(ctx context.Context, userID, contentID, quizID, questionID string, update func(*models.ReviewCard) error) (*models.ReviewCard, error)
+	// ListDueReviewCards returns userID's cards due at or before now, earliest due first
+	ListDueReviewCards(ctx context.Context, userID string, now time.Time) ([]models.ReviewCard, error)
+}
+
+// AuditStore persists the audit trail of permanent deletions
+type AuditStore interface {
+	// SaveAuditRecord creates an audit record
+	SaveAuditRecord(ctx context.Context, record models.AuditRecord) error
+	// ListAuditRecords returns the records of the deletions userID made, newest first
+	ListAuditRecords(ctx context.Context, userID string) ([]models.AuditRecord, error)
+}
+
+// UploadStore persists the state of files uploaded to blob storage
+type UploadStore interface {
+	// SaveUpload creates or replaces an upload
+	SaveUpload(ctx context.Context, upload models.Upload) error
+	// GetUpload retrieves an upload by uploadID
+	GetUpload(ctx context.Context, uploadID string) (*models.Upload, error)
+	// UpdateUpload atomically applies update to uploadID and saves the result. If update returns an error
+	// the upload is left unchanged and the error is returned.
+	UpdateUpload(ctx context.Context, uploadID string, update func(*models.Upload) error) (*models.Upload, error)
+	// ListPendingUploads returns the uploads still pending that were created before createdBefore, oldest first
+	ListPendingUploads(ctx context.Context, createdBefore time.Time) ([]models.Upload, error)
+	// DeleteUpload deletes uploadID; deleting a missing upload is not an error
+	DeleteUpload(ctx context.Context, uploadID string) error
+}
+
+// DeletionReport counts the documents removed by DeleteContent and DeleteQuiz
+type DeletionReport struct {
+	Quizzes     int
+	Attempts    int
+	ReviewCards int
+	Jobs        int // Deleted with content only
+	Extractions int // Deleted with content only
+}
+
+// Store is the full persistence layer used by the backend
+type Store interface {
+	QuizStore
+	JobStore
+	AttemptStore
+	ReviewStore
+	AuditStore
+	UploadStore
+	ExtractionCache
+	IDMigrator
+}
+
+// QuizMigrator is implemented by stores whose older content documents embed their quizzes
+type QuizMigrator interface {
+	// MigrateQuizzes moves the quizzes embedded in content into the store's own quiz documents and returns
+	// the number of quizzes moved
+	MigrateQuizzes(ctx context.Context) (int, error)
+}
+
+// NewStore creates the Store selected by cfg.StoreBackend
+func NewStore(ctx context.Context, cfg config.Config) (Store, error) {
+	switch cfg.StoreBackend {
+	case config.StoreFirestore:
+		return NewFirestoreClient(ctx)
+	case config.StoreMemory:
+		return NewMemoryStore(), nil
+	case config.StoreSQLite:
+		return NewSQLiteStore(ctx, cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unsupported store backend: %q", cfg.StoreBackend)
+	}
+}
+
+// lastQuizSeq returns the highest sequence number among the IDs of quizzes, or 0 if there are none
+func lastQuizSeq(quizzes []models.Quiz) int {
+	last := 0
+	for _, quiz := range quizzes {
+		if seq, err := strconv.Atoi(quiz.QuizID); err == nil && seq > last {
+			last = seq
+		}
+	}
+	return last
+}
+
+// formatQuizID writes the quiz ID of sequence number seq
+func formatQuizID(seq int) string {
+	return fmt.Sprintf("%04d", seq)
+}
+
+// contentCursor is the position of the last content of a page, in any order ListContents sorts by
+type contentCursor struct {
+	Timestamp time.Time `json:"t"`
+	Title     string    `json:"n"`
+	ContentID string    `json:"id"`
+}
+
+// cursorOf returns the position of content
+func cursorOf(content models.Content) contentCursor {
+	return contentCursor{Timestamp: content.Timestamp, Title: content.Title, ContentID: content.ContentID}
+}
+
+// encodeContentCursor writes the cursor of the page following content
+func encodeContentCursor(content models.Content) string {
+	data, _ := json.Marshal(cursorOf(content))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeContentCursor reads a cursor written by encodeContentCursor, returning nil for the first page
+func decodeContentCursor(cursor string) (*contentCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var after contentCursor
+	if err := json.Unmarshal(data, &after); err != nil || after.ContentID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &after, nil
+}
+
+// compare orders a and b by query, breaking ties by content ID
+func (query ContentQuery) compare(a, b contentCursor) int {
+	order := a.Timestamp.Compare(b.Timestamp)
+	if query.SortBy == ContentSortTitle {
+		order = strings.Compare(a.Title, b.Title)
+	}
+	if order == 0 {
+		order = strings.Compare(a.ContentID, b.ContentID)
+	}
+	if query.Descending {
+		order = -order
+	}
+	return order
+}
+
+// matches reports whether the title or URL of content contains the search of query, ignoring case
+func (query ContentQuery) matches(content models.Content) bool {
+	search := strings.ToLower(query.Search)
+	return strings.Contains(strings.ToLower(content.Title), search) || strings.Contains(strings.ToLower(content.URL), search)
+}
+
+// summarizeContent keeps only the fields of content that ListContents returns
+func summarizeContent(content models.Content) models.Content {
+	return models.Content{
+		Timestamp: content.Timestamp,
+		ContentID: content.ContentID,
+		URL:       content.URL,
+		Title:     content.Title,
+		OwnerID:   content.OwnerID,
+		Published: content.Published,
+		Duration:  content.Duration,
+	}
+}
+
+// pageContents orders contents by query and returns the page of them that follows after, which is nil for
+// the first page
+func pageContents(contents []models.Content, query ContentQuery, after *contentCursor) ContentPage {
+	sort.Slice(contents, func(i, j int) bool { return query.compare(cursorOf(contents[i]), cursorOf(contents[j])) < 0 })
+	if after != nil {
+		contents = contents[sort.Search(len(contents), func(i int) bool { return query.compare(cursorOf(contents[i]), *after) > 0 }):]
+	}
+	page := ContentPage{Contents: contents}
+	if len(contents) > query.Limit {
+		page.Contents = contents[:query.Limit]
+		page.NextCursor = encodeContentCursor(contents[query.Limit-1])
+	}
+	return page
+}
+
+// sortAuditRecords orders records newest first
+func sortAuditRecords(records []models.AuditRecord) {
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.After(records[j].CreatedAt) })
+}
+
+// sortAttempts orders attempts newest first
+func sortAttempts(attempts []models.Attempt) {
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].StartedAt.After(attempts[j].StartedAt) })
+}
+
+// sortReviewCards orders cards earliest due first, and cards due at the same time by question
+func sortReviewCards(cards []models.ReviewCard) {
+	sort.Slice(cards, func(i, j int) bool {
+		a, b := cards[i], cards[j]
+		if !a.DueAt.Equal(b.DueAt) {
+			return a.DueAt.Before(b.DueAt)
+		}
+		return a.ContentID+"/"+a.QuizID+"/"+a.QuestionID < b.ContentID+"/"+b.QuizID+"/"+b.QuestionID
+	})
+}
@@ -0,0 +1,849 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"read-robin/models"
+	"read-robin/utils"
+)
+
+// testQuizStore exercises the QuizStore contract against any implementation
+func testQuizStore(t *testing.T, store QuizStore) {
+	ctx := context.Background()
+
+	ownerID := "alice"
+	contentURL := "https://example.com"
+	contentID := utils.GenerateContentID(ownerID, contentURL)
+
+	if _, err := store.GetContent(ctx, contentID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetContent: expected ErrNotFound for missing content, got %v", err)
+	}
+	if _, err := store.GetExistingQuizzes(ctx, contentID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetExistingQuizzes: expected ErrNotFound for missing content, got %v", err)
+	}
+
+	quiz := models.Quiz{
+		Questions: []models.Question{
+			{
+				QuestionID: "0042",
+				Question:   "What is the purpose of the 'Example Domain'?",
+				Answer:     "It is for use in illustrative examples in documents.",
+				Reference:  "This domain is for use in illustrative examples in documents.",
+				Citation:   "0:04",
+				TimeRange:  &models.TimeRange{Start: 4, End: 9.5},
+			},
+			{
+				QuestionID:     "0043",
+				Type:           models.QuestionTypeMultipleChoice,
+				Question:       "What is the 'Example Domain' for?",
+				Answer:         "Examples",
+				Reference:      "This domain is for use in illustrative examples in documents.",
+				MultipleChoice: &models.MultipleChoice{Choices: []string{"Shopping", "Examples"}, CorrectIndex: 1},
+			},
+		},
+		Timestamp: time.Now(),
+		OwnerID:   ownerID,
+	}
+	anchors := []models.Anchor{{Offset: 0, Label: "p. 1"}, {Offset: 8, Label: "p. 2"}}
+	segments := []models.Segment{{Start: 0, End: 4, Speaker: "Ada", Text: "Example", Offset: 0}, {Start: 4, End: 9.5, Text: "text", Offset: 8}}
+	source := models.Content{OwnerID: ownerID, URL: contentURL, Title: "Example Domain", ContentText: "Example text", Anchors: anchors, Segments: segments}
+	source.Published, source.Duration = "2024-05-14", 9.5
+	quizID, err := store.SaveQuiz(ctx, source, quiz)
+	if err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+	if quizID != "0001" {
+		t.Errorf("SaveQuiz: expected quiz ID 0001 for new content, got %v", quizID)
+	}
+
+	content, err := store.GetContent(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetContent: expected no error, got %v", err)
+	}
+	if content.ContentID != contentID || content.URL != contentURL {
+		t.Errorf("GetContent: expected %v at %v, got %v at %v", contentID, contentURL, content.ContentID, content.URL)
+	}
+	if content.Title != "Example Domain" || content.ContentText != "Example text" {
+		t.Errorf("GetContent: unexpected title/text %q/%q", content.Title, content.ContentText)
+	}
+	if content.OwnerID != ownerID {
+		t.Errorf("GetContent: expected owner %q, got %q", ownerID, content.OwnerID)
+	}
+	if !reflect.DeepEqual(content.Anchors, anchors) {
+		t.Errorf("GetContent: expected anchors %v, got %v", anchors, content.Anchors)
+	}
+	if !reflect.DeepEqual(content.Segments, segments) {
+		t.Errorf("GetContent: expected segments %v, got %v", segments, content.Segments)
+	}
+	if content.Published != "2024-05-14" || content.Duration != 9.5 {
+		t.Errorf("GetContent: expected published 2024-05-14 and duration 9.5, got %q and %v", content.Published, content.Duration)
+	}
+	if len(content.Quizzes) != 1 {
+		t.Fatalf("GetContent: expected 1 quiz, got %d", len(content.Quizzes))
+	}
+	if content.Quizzes[0].OwnerID != ownerID {
+		t.Errorf("GetContent: expected quiz owner %q, got %q", ownerID, content.Quizzes[0].OwnerID)
+	}
+
+	retrieved, err := store.GetQuiz(ctx, contentID, "0001")
+	if err != nil {
+		t.Fatalf("GetQuiz: expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(retrieved.Questions, quiz.Questions) {
+		t.Errorf("GetQuiz: expected questions %v, got %v", quiz.Questions, retrieved.Questions)
+	}
+	if _, err := store.GetQuiz(ctx, contentID, "0099"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetQuiz: expected ErrNotFound for missing quiz, got %v", err)
+	}
+
+	// A second save updates title and text and appends the quiz
+	quizID, err = store.SaveQuiz(ctx, models.Content{OwnerID: ownerID, URL: contentURL, Title: "Example Domain (updated)", ContentText: "Updated text"}, quiz)
+	if err != nil || quizID != "0002" {
+		t.Fatalf("SaveQuiz: expected quiz ID 0002, got %v (err %v)", quizID, err)
+	}
+
+	quizzes, err := store.GetExistingQuizzes(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetExistingQuizzes: expected no error, got %v", err)
+	}
+	if len(quizzes) != 2 || quizzes[0].QuizID != "0001" || quizzes[1].QuizID != "0002" {
+		t.Errorf("GetExistingQuizzes: expected quizzes 0001 and 0002 in order, got %v", quizzes)
+	}
+
+	content, err = store.GetContent(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetContent: expected no error, got %v", err)
+	}
+	if content.Title != "Example Domain (updated)" || content.ContentText != "Updated text" {
+		t.Errorf("GetContent: expected updated title/text, got %q/%q", content.Title, content.ContentText)
+	}
+	if content.Anchors != nil || content.Segments != nil || content.Published != "" || content.Duration != 0 {
+		t.Errorf("GetContent: expected the anchors, segments and media metadata to be replaced with the text, got %v, %v, %q, %v",
+			content.Anchors, content.Segments, content.Published, content.Duration)
+	}
+
+	// The same URL submitted by another user is separate content
+	if _, err := store.SaveQuiz(ctx, models.Content{OwnerID: "bob", URL: contentURL, Title: "Bob's Example", ContentText: "Bob's text"}, quiz); err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+	quizzes, err = store.GetExistingQuizzes(ctx, contentID)
+	if err != nil || len(quizzes) != 2 {
+		t.Errorf("GetExistingQuizzes: expected another user's save to leave 2 quizzes, got %d (err %v)", len(quizzes), err)
+	}
+
+	if err := store.SetSharedWith(ctx, contentID, []string{"bob", "carol"}); err != nil {
+		t.Fatalf("SetSharedWith: expected no error, got %v", err)
+	}
+	content, err = store.GetContent(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetContent: expected no error, got %v", err)
+	}
+	if len(content.SharedWith) != 2 || content.SharedWith[0] != "bob" || content.SharedWith[1] != "carol" {
+		t.Errorf("GetContent: expected content shared with bob and carol, got %v", content.SharedWith)
+	}
+	if err := store.SetSharedWith(ctx, "missing", []string{"bob"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetSharedWith: expected ErrNotFound for missing content, got %v", err)
+	}
+
+	if report, err := store.DeleteContent(ctx, contentID); err != nil || report.Quizzes != 2 {
+		t.Fatalf("DeleteContent: expected 2 quizzes deleted, got %+v (err %v)", report, err)
+	}
+	if _, err := store.GetContent(ctx, contentID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetContent: expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := store.GetQuiz(ctx, contentID, "0001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetQuiz: expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := store.DeleteContent(ctx, contentID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteContent: expected ErrNotFound for missing content, got %v", err)
+	}
+	if _, err := store.GetContent(ctx, utils.GenerateContentID("bob", contentURL)); err != nil {
+		t.Errorf("GetContent: expected another user's content to survive delete, got %v", err)
+	}
+}
+
+// testQuizIDAllocation exercises the allocation of quiz IDs and content aliases against any QuizStore
+func testQuizIDAllocation(t *testing.T, store QuizStore) {
+	ctx := context.Background()
+	contentID := utils.GenerateContentID("alice", "https://example.com/allocation")
+
+	// Allocation counts on from quizzes saved under IDs it did not allocate
+	quiz := models.Quiz{QuizID: "0005", Questions: []models.Question{{QuestionID: utils.GenerateQuestionID(), Question: "Why?"}}}
+	if _, err := store.SaveQuiz(ctx, models.Content{OwnerID: "alice", URL: "https://example.com/allocation", Title: "Allocation", ContentText: "Text"}, quiz); err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+
+	// Concurrent saves never share an ID or lose a quiz
+	const saves = 20
+	ids := make(chan string, saves)
+	var wg sync.WaitGroup
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := store.SaveQuiz(ctx, models.Content{OwnerID: "alice", URL: "https://example.com/allocation", Title: "Allocation", ContentText: "Text"}, models.Quiz{})
+			if err != nil {
+				t.Errorf("SaveQuiz: expected no error, got %v", err)
+			}
+			ids <- id
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("SaveQuiz: allocated %s twice", id)
+		}
+		seen[id] = true
+	}
+	if !seen["0006"] || !seen[fmt.Sprintf("%04d", 5+saves)] {
+		t.Errorf("SaveQuiz: expected IDs 0006 to %04d, got %v", 5+saves, seen)
+	}
+	quizzes, err := store.GetExistingQuizzes(ctx, contentID)
+	if err != nil || len(quizzes) != 1+saves {
+		t.Fatalf("GetExistingQuizzes: expected %d quizzes, got %d (err %v)", 1+saves, len(quizzes), err)
+	}
+
+	// Saving a quiz with an existing ID replaces it
+	quiz.Questions[0].Question = "Why not?"
+	if id, err := store.SaveQuiz(ctx, models.Content{OwnerID: "alice", URL: "https://example.com/allocation", Title: "Allocation", ContentText: "Text"}, quiz); err != nil || id != "0005" {
+		t.Fatalf("SaveQuiz: expected to replace 0005, got %v (err %v)", id, err)
+	}
+	quizzes, err = store.GetExistingQuizzes(ctx, contentID)
+	if err != nil || len(quizzes) != 1+saves {
+		t.Errorf("GetExistingQuizzes: expected the replaced quiz to leave %d quizzes, got %d (err %v)", 1+saves, len(quizzes), err)
+	}
+	if replaced, err := store.GetQuiz(ctx, contentID, "0005"); err != nil || replaced.Questions[0].Question != "Why not?" {
+		t.Errorf("GetQuiz: expected the replaced quiz, got %+v (err %v)", replaced, err)
+	}
+
+	if _, err := store.ResolveContentID(ctx, utils.LegacyContentID("alice", "https://example.com/allocation")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ResolveContentID: expected ErrNotFound without an alias, got %v", err)
+	}
+}
+
+// testIDMigration exercises MigrateIDs against any Store, with saveLegacy writing content under its
+// legacy ID as the store did before content IDs were SHA-256 digests
+func testIDMigration(t *testing.T, store Store, saveLegacy func(content models.Content)) {
+	ctx := context.Background()
+	url := "https://example.com/legacy"
+	legacyID := utils.LegacyContentID("alice", url)
+	contentID := utils.GenerateContentID("alice", url)
+
+	// Legacy question IDs could collide within a quiz
+	saveLegacy(models.Content{
+		ContentID: legacyID, URL: url, OwnerID: "alice", Title: "Legacy", ContentText: "Text", Timestamp: time.Now(),
+		Quizzes: []models.Quiz{{QuizID: "0001", OwnerID: "alice", Timestamp: time.Now(), Questions: []models.Question{
+			{QuestionID: "0042", Question: "First?"},
+			{QuestionID: "0042", Question: "Second?"},
+		}}},
+	})
+	current := models.Quiz{QuizID: "0001", Questions: []models.Question{{QuestionID: utils.GenerateQuestionID(), Question: "Current?"}}}
+	if _, err := store.SaveQuiz(ctx, models.Content{OwnerID: "alice", URL: "https://example.com/current", Title: "Current", ContentText: "Text"}, current); err != nil {
+		t.Fatalf("SaveQuiz: expected no error, got %v", err)
+	}
+	attempt := models.Attempt{AttemptID: "legacy-attempt", UserID: "alice", ContentID: legacyID, QuizID: "0001",
+		Responses: []models.AttemptResponse{{QuestionID: "0042", Status: "PASS"}}, StartedAt: time.Now()}
+	if err := store.SaveAttempt(ctx, attempt); err != nil {
+		t.Fatalf("SaveAttempt: expected no error, got %v", err)
+	}
+	_, err := store.UpdateReviewCard(ctx, "alice", legacyID, "0001", "0042", func(card *models.ReviewCard) error {
+		card.DueAt = time.Now().Add(-time.Hour)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateReviewCard: expected no error, got %v", err)
+	}
+
+	report, err := store.MigrateIDs(ctx)
+	if err != nil {
+		t.Fatalf("MigrateIDs: expected no error, got %v", err)
+	}
+	if report != (IDMigrationReport{Contents: 1, Questions: 2, Attempts: 1, ReviewCards: 1}) {
+		t.Errorf("MigrateIDs: unexpected report %+v", report)
+	}
+
+	content, err := store.GetContent(ctx, contentID)
+	if err != nil {
+		t.Fatalf("GetContent: expected the content at its new ID, got %v", err)
+	}
+	questions := content.Quizzes[0].Questions
+	if content.ContentID != contentID || content.Title != "Legacy" || len(questions) != 2 {
+		t.Fatalf("GetContent: unexpected migrated content %+v", content)
+	}
+	for _, question := range questions {
+		if !utils.IsULID(question.QuestionID) || question.LegacyID != "0042" {
+			t.Errorf("MigrateIDs: expected a ULID with the legacy ID kept, got %+v", question)
+		}
+	}
+	if questions[0].QuestionID == questions[1].QuestionID {
+		t.Errorf("MigrateIDs: expected distinct question IDs, got %s twice", questions[0].QuestionID)
+	}
+	if _, err := store.GetContent(ctx, legacyID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetContent: expected ErrNotFound at the legacy ID, got %v", err)
+	}
+	if resolved, err := store.ResolveContentID(ctx, legacyID); err != nil || resolved != contentID {
+		t.Errorf("ResolveContentID: expected %s, got %q (err %v)", contentID, resolved, err)
+	}
+
+	migratedAttempt, err := store.GetAttempt(ctx, "legacy-attempt")
+	if err != nil {
+		t.Fatalf("GetAttempt: expected no error, got %v", err)
+	}
+	if migratedAttempt.ContentID != contentID || migratedAttempt.Responses[0].QuestionID != questions[0].QuestionID {
+		t.Errorf("MigrateIDs: expected the attempt to point at the first question, got %+v", migratedAttempt)
+	}
+	cards, err := store.ListDueReviewCards(ctx, "alice", time.Now())
+	if err != nil || len(cards) != 1 || cards[0].ContentID != contentID || cards[0].QuestionID != questions[0].QuestionID {
+		t.Errorf("ListDueReviewCards: expected the migrated card, got %+v (err %v)", cards, err)
+	}
+	if nextID, err := store.SaveQuiz(ctx, models.Content{OwnerID: "alice", URL: url, Title: "Legacy", ContentText: "Text"}, models.Quiz{}); err != nil || nextID != "0002" {
+		t.Errorf("SaveQuiz: expected 0002 after the migrated quiz, got %v (err %v)", nextID, err)
+	}
+
+	// Migrated and current documents are left alone
+	report, err = store.MigrateIDs(ctx)
+	if err != nil || report != (IDMigrationReport{}) {
+		t.Errorf("MigrateIDs: expected nothing left to migrate, got %+v (err %v)", report, err)
+	}
+}
+
+// testContentManagement exercises listing, renaming and deleting content against any Store
+func testContentManagement(t *testing.T, store Store) {
+	ctx := context.Background()
+	first := utils.GenerateContentID("dave", "https://example.com/first")
+	second := utils.GenerateContentID("dave", "https://example.com/second")
+	shared := utils.GenerateContentID("erin", "https://example.com/shared")
+
+	for _, save := range []struct{ ownerID, url, title string }{
+		{"dave", "https://example.com/first", "First"},
+		{"dave", "https://example.com/first", "First"},
+		{"dave", "https://example.com/second", "Second"},
+		{"erin", "https://example.com/shared", "Shared"},
+		{"erin", "https://example.com/private", "Private"},
+	} {
+		quiz := models.Quiz{Questions: []models.Question{{QuestionID: utils.GenerateQuestionID(), Question: "Why?"}}, OwnerID: save.ownerID}
+		if _, err := store.SaveQuiz(ctx, models.Content{OwnerID: save.ownerID, URL: save.url, Title: save.title, ContentText: "Text"}, quiz); err != nil {
+			t.Fatalf("SaveQuiz: expected no error, got %v", err)
+		}
+	}
+	if err := store.SetSharedWith(ctx, shared, []string{"dave"}); err != nil {
+		t.Fatalf("SetSharedWith: expected no error, got %v", err)
+	}
+
+	page, err := store.ListContents(ctx, ContentQuery{UserID: "dave", SortBy: ContentSortCreated, Descending: true, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListContents: expected no error, got %v", err)
+	}
+	contents := page.Contents
+	listed := make(map[string]bool)
+	for _, content := range contents {
+		listed[content.ContentID] = true
+		if content.Quizzes != nil || content.ContentText != "" || content.SharedWith != nil {
+			t.Errorf("ListContents: expected a summary without text, sharing or quizzes, got %+v", content)
+		}
+	}
+	if len(contents) != 3 || !listed[first] || !listed[second] || !listed[shared] || page.NextCursor != "" {
+		t.Errorf("ListContents: expected dave's content and the content shared with him, got %+v", page)
+	}
+	for i := 1; i < len(contents); i++ {
+		if contents[i].Timestamp.After(contents[i-1].Timestamp) {
+			t.Errorf("ListContents: expected newest first, got %v before %v", contents[i-1].Timestamp, contents[i].Timestamp)
+		}
+	}
+
+	// Pages by title follow on from each other
+	var titles []string
+	query := ContentQuery{UserID: "dave", SortBy: ContentSortTitle, Limit: 2}
+	for pages := 0; pages == 0 || query.Cursor != ""; pages++ {
+		if pages == 3 {
+			t.Fatalf("ListContents: expected the pages to end, got %v so far", titles)
+		}
+		page, err := store.ListContents(ctx, query)
+		if err != nil {
+			t.Fatalf("ListContents: expected no error, got %v", err)
+		}
+		for _, content := range page.Contents {
+			titles = append(titles, content.Title)
+		}
+		query.Cursor = page.NextCursor
+	}
+	if want := []string{"First", "Second", "Shared"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("ListContents: expected pages of %v, got %v", want, titles)
+	}
+	page, err = store.ListContents(ctx, ContentQuery{UserID: "dave", Search: "SHARED", SortBy: ContentSortTitle, Descending: true, Limit: 1})
+	if err != nil || len(page.Contents) != 1 || page.Contents[0].ContentID != shared || page.NextCursor != "" {
+		t.Errorf("ListContents: expected only the shared content to match, got %+v (err %v)", page, err)
+	}
+	if _, err := store.ListContents(ctx, ContentQuery{UserID: "dave", Limit: 1, Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("ListContents: expected ErrInvalidCursor, got %v", err)
+	}
+
+	if err := store.SetTitle(ctx, first, "Renamed"); err != nil {
+		t.Fatalf("SetTitle: expected no error, got %v", err)
+	}
+	if content, err := store.GetContent(ctx, first); err != nil || content.Title != "Renamed" || content.ContentText != "Text" {
+		t.Errorf("GetContent: expected the renamed content, got %+v (err %v)", content, err)
+	}
+	if err := store.SetTitle(ctx, "missing", "Renamed"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetTitle: expected ErrNotFound for missing content, got %v", err)
+	}
+
+	// Attempts and review cards at the first content, on both of its quizzes and by two users
+	for i, at := range []struct{ userID, quizID string }{{"dave", "0001"}, {"dave", "0002"}, {"erin", "0002"}} {
+		attempt := models.Attempt{AttemptID: fmt.Sprintf("managed-%d", i), UserID: at.userID, ContentID: first, QuizID: at.quizID, StartedAt: time.Now()}
+		if err := store.SaveAttempt(ctx, attempt); err != nil {
+			t.Fatalf("SaveAttempt: expected no error, got %v", err)
+		}
+		_, err := store.UpdateReviewCard(ctx, at.userID, first, at.quizID, "question", func(card *models.ReviewCard) error {
+			card.DueAt = time.Now().Add(-time.Hour)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateReviewCard: expected no error, got %v", err)
+		}
+	}
+	if err := store.SaveAttempt(ctx, models.Attempt{AttemptID: "managed-other", UserID: "dave", ContentID: second, QuizID: "0001", StartedAt: time.Now()}); err != nil {
+		t.Fatalf("SaveAttempt: expected no error, got %v", err)
+	}
+
+	report, err := store.DeleteQuiz(ctx, first, "0002")
+	if err != nil {
+		t.Fatalf("DeleteQuiz: expected no error, got %v", err)
+	}
+	if report != (DeletionReport{Quizzes: 1, Attempts: 2, ReviewCards: 2}) {
+		t.Errorf("DeleteQuiz: unexpected report %+v", report)
+	}
+	if quizzes, err := store.GetExistingQuizzes(ctx, first); err != nil || len(quizzes) != 1 || quizzes[0].QuizID != "0001" {
+		t.Errorf("GetExistingQuizzes: expected only quiz 0001 left, got %v (err %v)", quizzes, err)
+	}
+	if _, err := store.GetAttempt(ctx, "managed-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttempt: expected ErrNotFound for an attempt at the deleted quiz, got %v", err)
+	}
+	if _, err := store.DeleteQuiz(ctx, first, "0002"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteQuiz: expected ErrNotFound for a deleted quiz, got %v", err)
+	}
+	if _, err := store.DeleteQuiz(ctx, "missing", "0001"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteQuiz: expected ErrNotFound for missing content, got %v", err)
+	}
+
+	// The jobs that generated quizzes of the first content and its cached extraction, next to those of the second
+	for _, job := range []models.Job{
+		{JobID: "managed-job", Status: models.JobStatusSucceeded, Request: models.QuizRequest{URL: "https://example.com/first", ContentText: "Text"},
+			Result: &models.QuizResult{ContentID: first, QuizID: "0001"}, CreatedAt: time.Now()},
+		{JobID: "managed-job-other", Status: models.JobStatusSucceeded, Result: &models.QuizResult{ContentID: second, QuizID: "0001"}, CreatedAt: time.Now()},
+	} {
+		if err := store.SaveJob(ctx, job); err != nil {
+			t.Fatalf("SaveJob: expected no error, got %v", err)
+		}
+	}
+	for _, source := range []string{"https://example.com/first", "https://example.com/second"} {
+		if err := store.SaveExtraction(ctx, models.Extraction{Source: source, ContentText: "Text"}); err != nil {
+			t.Fatalf("SaveExtraction: expected no error, got %v", err)
+		}
+	}
+
+	report, err = store.DeleteContent(ctx, first)
+	if err != nil {
+		t.Fatalf("DeleteContent: expected no error, got %v", err)
+	}
+	if report != (DeletionReport{Quizzes: 1, Attempts: 1, ReviewCards: 1, Jobs: 1, Extractions: 1}) {
+		t.Errorf("DeleteContent: unexpected report %+v", report)
+	}
+	if _, err := store.GetJob(ctx, "managed-job"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetJob: expected ErrNotFound for a job of deleted content, got %v", err)
+	}
+	if _, err := store.GetExtraction(ctx, "https://example.com/first"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExtraction: expected ErrNotFound for the extraction of deleted content, got %v", err)
+	}
+	if _, err := store.GetJob(ctx, "managed-job-other"); err != nil {
+		t.Errorf("GetJob: expected a job of other content to survive, got %v", err)
+	}
+	if _, err := store.GetExtraction(ctx, "https://example.com/second"); err != nil {
+		t.Errorf("GetExtraction: expected the extraction of other content to survive, got %v", err)
+	}
+	if _, err := store.GetAttempt(ctx, "managed-0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttempt: expected ErrNotFound for an attempt at deleted content, got %v", err)
+	}
+	if cards, err := store.ListDueReviewCards(ctx, "dave", time.Now()); err != nil || len(cards) != 0 {
+		t.Errorf("ListDueReviewCards: expected the cards at deleted content to be gone, got %+v (err %v)", cards, err)
+	}
+	if _, err := store.GetAttempt(ctx, "managed-other"); err != nil {
+		t.Errorf("GetAttempt: expected an attempt at other content to survive, got %v", err)
+	}
+	if page, err := store.ListContents(ctx, ContentQuery{UserID: "dave", Limit: 10}); err != nil || len(page.Contents) != 2 {
+		t.Errorf("ListContents: expected 2 contents after delete, got %d (err %v)", len(page.Contents), err)
+	}
+	// Without its sequence, content quizzed again after deletion starts over
+	quiz := models.Quiz{Questions: []models.Question{{QuestionID: utils.GenerateQuestionID(), Question: "Why?"}}, OwnerID: "dave"}
+	if quizID, err := store.SaveQuiz(ctx, models.Content{OwnerID: "dave", URL: "https://example.com/first", Title: "First", ContentText: "Text"}, quiz); err != nil || quizID != "0001" {
+		t.Errorf("SaveQuiz: expected deleted content to start over at 0001, got %q (err %v)", quizID, err)
+	}
+
+	// Audit records
+	older := models.AuditRecord{AuditID: "audit-1", Action: models.AuditActionDeleteQuiz, UserID: "dave", ContentID: first, QuizID: "0002",
+		Quizzes: 1, CreatedAt: time.Now().Add(-time.Minute)}
+	newer := models.AuditRecord{AuditID: "audit-2", Action: models.AuditActionDeleteContent, UserID: "dave", ContentID: first,
+		Quizzes: 1, Attempts: 1, ReviewCards: 1, CreatedAt: time.Now()}
+	for _, record := range []models.AuditRecord{older, newer, {AuditID: "audit-3", UserID: "erin", CreatedAt: time.Now()}} {
+		if err := store.SaveAuditRecord(ctx, record); err != nil {
+			t.Fatalf("SaveAuditRecord: expected no error, got %v", err)
+		}
+	}
+	records, err := store.ListAuditRecords(ctx, "dave")
+	if err != nil {
+		t.Fatalf("ListAuditRecords: expected no error, got %v", err)
+	}
+	if len(records) != 2 || records[0].AuditID != "audit-2" || records[1].AuditID != "audit-1" || records[0].Attempts != 1 {
+		t.Errorf("ListAuditRecords: expected dave's records newest first, got %+v", records)
+	}
+}
+
+// testJobStore exercises the JobStore contract against any implementation
+func testJobStore(t *testing.T, store JobStore) {
+	ctx := context.Background()
+
+	if _, err := store.GetJob(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetJob: expected ErrNotFound for missing job, got %v", err)
+	}
+
+	now := time.Now()
+	older := models.Job{JobID: "job-1", Status: models.JobStatusRunning, Stage: models.JobStageGenerating, CreatedAt: now.Add(-time.Minute)}
+	newer := models.Job{JobID: "job-2", Status: models.JobStatusQueued, Stage: models.JobStageQueued, CreatedAt: now,
+		Request: models.QuizRequest{URL: "https://example.com", ContentType: "URL"}}
+	done := models.Job{JobID: "job-3", Status: models.JobStatusSucceeded, Stage: models.JobStageDone, Progress: 100, CreatedAt: now,
+		Result: &models.QuizResult{ContentID: "content", QuizID: "0001"}}
+	for _, job := range []models.Job{newer, older, done} {
+		if err := store.SaveJob(ctx, job); err != nil {
+			t.Fatalf("SaveJob: expected no error, got %v", err)
+		}
+	}
+
+	retrieved, err := store.GetJob(ctx, "job-3")
+	if err != nil {
+		t.Fatalf("GetJob: expected no error, got %v", err)
+	}
+	if retrieved.Status != models.JobStatusSucceeded || retrieved.Result == nil || retrieved.Result.QuizID != "0001" {
+		t.Errorf("GetJob: unexpected job %+v", retrieved)
+	}
+
+	unfinished, err := store.ListUnfinishedJobs(ctx)
+	if err != nil {
+		t.Fatalf("ListUnfinishedJobs: expected no error, got %v", err)
+	}
+	if len(unfinished) != 2 || unfinished[0].JobID != "job-1" || unfinished[1].JobID != "job-2" {
+		t.Fatalf("ListUnfinishedJobs: expected job-1 and job-2 oldest first, got %+v", unfinished)
+	}
+	if unfinished[1].Request.URL != "https://example.com" {
+		t.Errorf("ListUnfinishedJobs: expected request to round-trip, got %+v", unfinished[1].Request)
+	}
+
+	// Saving again replaces the job, removing it from the unfinished list once it fails
+	older.Status = models.JobStatusFailed
+	older.Error = "Error generating quiz"
+	if err := store.SaveJob(ctx, older); err != nil {
+		t.Fatalf("SaveJob: expected no error, got %v", err)
+	}
+	unfinished, err = store.ListUnfinishedJobs(ctx)
+	if err != nil {
+		t.Fatalf("ListUnfinishedJobs: expected no error, got %v", err)
+	}
+	if len(unfinished) != 1 || unfinished[0].JobID != "job-2" {
+		t.Errorf("ListUnfinishedJobs: expected only job-2, got %+v", unfinished)
+	}
+
+	if _, err := store.UpdateJob(ctx, "missing", func(*models.Job) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateJob: expected ErrNotFound for missing job, got %v", err)
+	}
+	claimed, err := store.UpdateJob(ctx, "job-2", func(job *models.Job) error {
+		job.Status = models.JobStatusRunning
+		job.ClaimedBy = "worker"
+		job.Attempts++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateJob: expected no error, got %v", err)
+	}
+	if claimed.ClaimedBy != "worker" || claimed.Attempts != 1 || claimed.Request.URL != "https://example.com" {
+		t.Errorf("UpdateJob: unexpected job %+v", claimed)
+	}
+	rejected := errors.New("claimed")
+	if _, err := store.UpdateJob(ctx, "job-2", func(job *models.Job) error {
+		job.ClaimedBy = "other-worker"
+		return rejected
+	}); !errors.Is(err, rejected) {
+		t.Fatalf("UpdateJob: expected the update's error, got %v", err)
+	}
+	if retrieved, err := store.GetJob(ctx, "job-2"); err != nil || retrieved.ClaimedBy != "worker" {
+		t.Errorf("UpdateJob: expected a failed update to leave the job unchanged, got %+v, %v", retrieved, err)
+	}
+}
+
+// testAttemptStore exercises the AttemptStore contract against any implementation
+func testAttemptStore(t *testing.T, store AttemptStore) {
+	ctx := context.Background()
+
+	if _, err := store.GetAttempt(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAttempt: expected ErrNotFound for missing attempt, got %v", err)
+	}
+	if _, err := store.UpdateAttempt(ctx, "missing", func(*models.Attempt) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateAttempt: expected ErrNotFound for missing attempt, got %v", err)
+	}
+
+	now := time.Now()
+	attempts := []models.Attempt{
+		{AttemptID: "attempt-1", UserID: "alice", ContentID: "content-1", QuizID: "0001", Status: models.AttemptStatusInProgress, TotalQuestions: 2, StartedAt: now.Add(-2 * time.Minute)},
+		{AttemptID: "attempt-2", UserID: "alice", ContentID: "content-2", QuizID: "0001", Status: models.AttemptStatusInProgress, TotalQuestions: 2, StartedAt: now.Add(-time.Minute)},
+		{AttemptID: "attempt-3", UserID: "alice", ContentID: "content-1", QuizID: "0002", Status: models.AttemptStatusInProgress, TotalQuestions: 2, StartedAt: now},
+		{AttemptID: "attempt-4", UserID: "bob", ContentID: "content-1", QuizID: "0001", Status: models.AttemptStatusInProgress, TotalQuestions: 2, StartedAt: now},
+	}
+	for _, attempt := range attempts {
+		if err := store.SaveAttempt(ctx, attempt); err != nil {
+			t.Fatalf("SaveAttempt: expected no error, got %v", err)
+		}
+	}
+
+	updated, err := store.UpdateAttempt(ctx, "attempt-1", func(attempt *models.Attempt) error {
+		attempt.Responses = append(attempt.Responses, models.AttemptResponse{QuestionID: "0001", UserResponse: "A", Status: "PASS"})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateAttempt: expected no error, got %v", err)
+	}
+	if len(updated.Responses) != 1 {
+		t.Errorf("UpdateAttempt: expected the updated attempt, got %+v", updated)
+	}
+
+	// A failed update leaves the attempt unchanged
+	errRejected := errors.New("rejected")
+	_, err = store.UpdateAttempt(ctx, "attempt-1", func(attempt *models.Attempt) error {
+		attempt.Responses = nil
+		return errRejected
+	})
+	if !errors.Is(err, errRejected) {
+		t.Errorf("UpdateAttempt: expected the update's error, got %v", err)
+	}
+
+	retrieved, err := store.GetAttempt(ctx, "attempt-1")
+	if err != nil {
+		t.Fatalf("GetAttempt: expected no error, got %v", err)
+	}
+	if len(retrieved.Responses) != 1 || retrieved.Responses[0].Status != "PASS" || retrieved.TotalQuestions != 2 {
+		t.Errorf("GetAttempt: unexpected attempt %+v", retrieved)
+	}
+
+	all, err := store.ListAttempts(ctx, "alice", "")
+	if err != nil {
+		t.Fatalf("ListAttempts: expected no error, got %v", err)
+	}
+	if len(all) != 3 || all[0].AttemptID != "attempt-3" || all[1].AttemptID != "attempt-2" || all[2].AttemptID != "attempt-1" {
+		t.Errorf("ListAttempts: expected alice's attempts newest first, got %+v", all)
+	}
+
+	atContent, err := store.ListAttempts(ctx, "alice", "content-1")
+	if err != nil {
+		t.Fatalf("ListAttempts: expected no error, got %v", err)
+	}
+	if len(atContent) != 2 || atContent[0].AttemptID != "attempt-3" || atContent[1].AttemptID != "attempt-1" {
+		t.Errorf("ListAttempts: expected alice's attempts at content-1, got %+v", atContent)
+	}
+}
+
+// testReviewStore exercises the ReviewStore contract against any implementation
+func testReviewStore(t *testing.T, store ReviewStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	due := func(dueAt time.Time) func(*models.ReviewCard) error {
+		return func(card *models.ReviewCard) error {
+			card.Repetitions++
+			card.DueAt = dueAt
+			return nil
+		}
+	}
+	for _, card := range []struct {
+		userID, contentID, quizID, questionID string
+		dueAt                                 time.Time
+	}{
+		{"alice", "content-1", "0001", "0001", now.Add(-time.Hour)},
+		{"alice", "content-1", "0001", "0002", now.Add(time.Hour)},
+		{"alice", "content-2", "0001", "0001", now.Add(-2 * time.Hour)},
+		{"bob", "content-1", "0001", "0001", now.Add(-time.Hour)},
+	} {
+		created, err := store.UpdateReviewCard(ctx, card.userID, card.contentID, card.quizID, card.questionID, due(card.dueAt))
+		if err != nil {
+			t.Fatalf("UpdateReviewCard: expected no error, got %v", err)
+		}
+		if created.UserID != card.userID || created.QuestionID != card.questionID || created.Repetitions != 1 {
+			t.Errorf("UpdateReviewCard: expected a new card, got %+v", created)
+		}
+	}
+
+	updated, err := store.UpdateReviewCard(ctx, "alice", "content-1", "0001", "0001", due(now))
+	if err != nil {
+		t.Fatalf("UpdateReviewCard: expected no error, got %v", err)
+	}
+	if updated.Repetitions != 2 || updated.ContentID != "content-1" {
+		t.Errorf("UpdateReviewCard: expected the existing card updated, got %+v", updated)
+	}
+
+	// A failed update leaves the card unchanged
+	errRejected := errors.New("rejected")
+	_, err = store.UpdateReviewCard(ctx, "alice", "content-1", "0001", "0001", func(card *models.ReviewCard) error {
+		card.DueAt = now.Add(24 * time.Hour)
+		return errRejected
+	})
+	if !errors.Is(err, errRejected) {
+		t.Errorf("UpdateReviewCard: expected the update's error, got %v", err)
+	}
+
+	cards, err := store.ListDueReviewCards(ctx, "alice", now)
+	if err != nil {
+		t.Fatalf("ListDueReviewCards: expected no error, got %v", err)
+	}
+	if len(cards) != 2 || cards[0].ContentID != "content-2" || cards[1].ContentID != "content-1" || cards[1].Repetitions != 2 {
+		t.Errorf("ListDueReviewCards: expected alice's due cards earliest first, got %+v", cards)
+	}
+	if !cards[1].DueAt.Equal(now) {
+		t.Errorf("ListDueReviewCards: expected due at %v, got %v", now, cards[1].DueAt)
+	}
+
+	none, err := store.ListDueReviewCards(ctx, "carol", now)
+	if err != nil || len(none) != 0 {
+		t.Errorf("ListDueReviewCards: expected no cards for carol, got %+v, %v", none, err)
+	}
+}
+
+// testUploadStore exercises the UploadStore contract against any implementation
+func testUploadStore(t *testing.T, store UploadStore) {
+	ctx := context.Background()
+
+	if _, err := store.GetUpload(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetUpload: expected ErrNotFound for missing upload, got %v", err)
+	}
+	if _, err := store.UpdateUpload(ctx, "missing", func(*models.Upload) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateUpload: expected ErrNotFound for missing upload, got %v", err)
+	}
+
+	upload := models.Upload{
+		UploadID:  "upload-1",
+		OwnerID:   "alice",
+		Filename:  "talk.mp3",
+		MediaType: "audio/mpeg",
+		Size:      1000,
+		Status:    models.UploadStatusPending,
+		BlobKey:   "uploads/upload-1.mp3",
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if err := store.SaveUpload(ctx, upload); err != nil {
+		t.Fatalf("SaveUpload: expected no error, got %v", err)
+	}
+
+	updated, err := store.UpdateUpload(ctx, "upload-1", func(upload *models.Upload) error {
+		upload.Parts = append(upload.Parts, "uploads/upload-1.part-1")
+		upload.Received = 600
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUpload: expected no error, got %v", err)
+	}
+	if updated.Received != 600 || len(updated.Parts) != 1 {
+		t.Errorf("UpdateUpload: expected the updated upload, got %+v", updated)
+	}
+
+	// A failed update leaves the upload unchanged
+	errRejected := errors.New("rejected")
+	_, err = store.UpdateUpload(ctx, "upload-1", func(upload *models.Upload) error {
+		upload.Received = 0
+		return errRejected
+	})
+	if !errors.Is(err, errRejected) {
+		t.Errorf("UpdateUpload: expected the update's error, got %v", err)
+	}
+
+	retrieved, err := store.GetUpload(ctx, "upload-1")
+	if err != nil {
+		t.Fatalf("GetUpload: expected no error, got %v", err)
+	}
+	if retrieved.OwnerID != "alice" || retrieved.Received != 600 || len(retrieved.Parts) != 1 || !retrieved.CreatedAt.Equal(upload.CreatedAt) {
+		t.Errorf("GetUpload: unexpected upload %+v", retrieved)
+	}
+
+	// Only pending uploads created before the cutoff are listed
+	complete := upload
+	complete.UploadID = "upload-0"
+	complete.Status = models.UploadStatusComplete
+	complete.CreatedAt = upload.CreatedAt.Add(-time.Hour)
+	recent := upload
+	recent.UploadID = "upload-2"
+	recent.CreatedAt = upload.CreatedAt.Add(time.Hour)
+	for _, other := range []models.Upload{complete, recent} {
+		if err := store.SaveUpload(ctx, other); err != nil {
+			t.Fatalf("SaveUpload: expected no error, got %v", err)
+		}
+	}
+	stale, err := store.ListPendingUploads(ctx, upload.CreatedAt.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("ListPendingUploads: expected no error, got %v", err)
+	}
+	if len(stale) != 1 || stale[0].UploadID != "upload-1" || len(stale[0].Parts) != 1 {
+		t.Errorf("ListPendingUploads: expected only upload-1, got %+v", stale)
+	}
+	stale, err = store.ListPendingUploads(ctx, recent.CreatedAt.Add(time.Minute))
+	if err != nil || len(stale) != 2 || stale[0].UploadID != "upload-1" || stale[1].UploadID != "upload-2" {
+		t.Errorf("ListPendingUploads: expected upload-1 then upload-2, got %+v, %v", stale, err)
+	}
+
+	if err := store.DeleteUpload(ctx, "upload-1"); err != nil {
+		t.Fatalf("DeleteUpload: expected no error, got %v", err)
+	}
+	if _, err := store.GetUpload(ctx, "upload-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUpload: expected ErrNotFound after DeleteUpload, got %v", err)
+	}
+	if err := store.DeleteUpload(ctx, "upload-1"); err != nil {
+		t.Errorf("DeleteUpload: expected no error for a missing upload, got %v", err)
+	}
+}
+
+// testExtractionCache exercises the ExtractionCache contract against any implementation
+func testExtractionCache(t *testing.T, cache ExtractionCache) {
+	ctx := context.Background()
+
+	if _, err := cache.GetExtraction(ctx, "https://example.com/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetExtraction: expected ErrNotFound for missing source, got %v", err)
+	}
+
+	extraction := models.Extraction{
+		Source:      "gs://bucket/path/to/file.pdf",
+		Version:     "generation:1",
+		Title:       "File",
+		ContentText: "First version",
+		ExtractedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if err := cache.SaveExtraction(ctx, extraction); err != nil {
+		t.Fatalf("SaveExtraction: expected no error, got %v", err)
+	}
+	extraction.Version, extraction.ContentText, extraction.ETag = "generation:2", "Second version", `"abc"`
+	if err := cache.SaveExtraction(ctx, extraction); err != nil {
+		t.Fatalf("SaveExtraction: expected no error replacing the extraction, got %v", err)
+	}
+
+	retrieved, err := cache.GetExtraction(ctx, extraction.Source)
+	if err != nil {
+		t.Fatalf("GetExtraction: expected no error, got %v", err)
+	}
+	if !retrieved.ExtractedAt.Equal(extraction.ExtractedAt) {
+		t.Errorf("GetExtraction: expected extracted at %v, got %v", extraction.ExtractedAt, retrieved.ExtractedAt)
+	}
+	retrieved.ExtractedAt = extraction.ExtractedAt
+	if !reflect.DeepEqual(*retrieved, extraction) {
+		t.Errorf("GetExtraction: expected %+v, got %+v", extraction, *retrieved)
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"read-robin/models"
+)
+
+// ErrInvalidCaptions is returned by ParseCaptions for text that is not WebVTT or SRT captions
+var ErrInvalidCaptions = errors.New("not WebVTT or SRT captions")
+
+var (
+	// captionVoice matches a WebVTT voice span such as "<v Ada>" or "<v.loud Ada Lovelace>"
+	captionVoice = regexp.MustCompile(`<v(?:\.[^\s>]*)?\s+([^>]+)>`)
+	captionTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseCaptions parses WebVTT or SRT captions into transcript segments, one per cue, ordered by start time.
+// Cue identifiers and settings, comments and styles are skipped, markup is removed, and WebVTT voice spans
+// name the speaker. The segments' offsets are left for TranscriptContent to set.
+func ParseCaptions(data string) ([]models.Segment, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(strings.ReplaceAll(data, "\r\n", "\n"), "\r", "\n")
+	webVTT := strings.HasPrefix(data, "WEBVTT")
+
+	var segments []models.Segment
+	for i, block := range captionBlocks(data) {
+		if webVTT && (i == 0 || isCaptionMetadata(block[0])) {
+			continue
+		}
+		timing := -1
+		for j, line := range block[:min(2, len(block))] {
+			if strings.Contains(line, "-->") {
+				timing = j
+				break
+			}
+		}
+		if timing < 0 {
+			return nil, fmt.Errorf("%w: cue without timing %q", ErrInvalidCaptions, block[0])
+		}
+		segment, err := parseCue(block[timing], block[timing+1:])
+		if err != nil {
+			return nil, err
+		}
+		if segment.Text != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("%w: no cues", ErrInvalidCaptions)
+	}
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+	return segments, nil
+}
+
+// captionBlocks splits captions into blocks of non-blank lines separated by blank lines
+func captionBlocks(data string) [][]string {
+	var blocks [][]string
+	var block []string
+	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+		block = append(block, strings.TrimSpace(line))
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// isCaptionMetadata reports whether a WebVTT block starting with line is a comment, style or region rather than a cue
+func isCaptionMetadata(line string) bool {
+	keyword, _, _ := strings.Cut(line, " ")
+	return keyword == "NOTE" || keyword == "STYLE" || keyword == "REGION"
+}
+
+// parseCue parses a cue's timing line, such as "00:01.000 --> 00:04.000 align:start", and its text lines
+func parseCue(timing string, lines []string) (models.Segment, error) {
+	startText, endText, _ := strings.Cut(timing, "-->")
+	endFields := strings.Fields(endText)
+	if len(endFields) == 0 {
+		return models.Segment{}, fmt.Errorf("%w: invalid cue timing %q", ErrInvalidCaptions, timing)
+	}
+	start, err := ParseTimestamp(startText)
+	if err != nil {
+		return models.Segment{}, fmt.Errorf("%w: %v", ErrInvalidCaptions, err)
+	}
+	end, err := ParseTimestamp(endFields[0])
+	if err != nil {
+		return models.Segment{}, fmt.Errorf("%w: %v", ErrInvalidCaptions, err)
+	}
+	if end < start {
+		return models.Segment{}, fmt.Errorf("%w: cue ends before it starts %q", ErrInvalidCaptions, timing)
+	}
+
+	text := strings.Join(lines, " ")
+	speaker := ""
+	if match := captionVoice.FindStringSubmatch(text); match != nil {
+		speaker = html.UnescapeString(strings.TrimSpace(match[1]))
+	}
+	text = html.UnescapeString(captionTag.ReplaceAllString(text, ""))
+	return models.Segment{Start: start, End: end, Speaker: speaker, Text: strings.Join(strings.Fields(text), " ")}, nil
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestParseCaptions_WebVTT(t *testing.T) {
+	t.Parallel()
+	captions := "\ufeffWEBVTT - Lobster talk\r\n\r\n" +
+		"NOTE recorded in Shediac\r\n\r\n" +
+		"STYLE\r\n::cue { color: yellow }\r\n\r\n" +
+		"intro\r\n00:00.000 --> 00:04.500 align:start position:10%\r\n<v Ada>Lobsters grow by <b>molting</b>.\r\n\r\n" +
+		"00:04.500 --> 00:09.000\r\n<v.loud Ben Ng>They shed their shell &amp; grow\r\na new one.</v>\r\n\r\n" +
+		"01:00:00.000 --> 01:00:02.000\r\n<c.music>♪</c>\r\n"
+
+	segments, err := ParseCaptions(captions)
+	if err != nil {
+		t.Fatalf("ParseCaptions: expected no error, got %v", err)
+	}
+	expected := []models.Segment{
+		{Start: 0, End: 4.5, Speaker: "Ada", Text: "Lobsters grow by molting."},
+		{Start: 4.5, End: 9, Speaker: "Ben Ng", Text: "They shed their shell & grow a new one."},
+		{Start: 3600, End: 3602, Text: "♪"},
+	}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("ParseCaptions: expected %+v, got %+v", expected, segments)
+	}
+}
+
+func TestParseCaptions_SRT(t *testing.T) {
+	t.Parallel()
+	captions := "2\n00:00:05,000 --> 00:00:07,250\nA giant lobster statue\nstands in Shediac.\n\n" +
+		"1\n00:00:01,000 --> 00:00:04,000\n<i>Welcome back.</i>\n\n" +
+		"3\n00:00:08,000 --> 00:00:09,000\n\n"
+
+	segments, err := ParseCaptions(captions)
+	if err != nil {
+		t.Fatalf("ParseCaptions: expected no error, got %v", err)
+	}
+	expected := []models.Segment{
+		{Start: 1, End: 4, Text: "Welcome back."},
+		{Start: 5, End: 7.25, Text: "A giant lobster statue stands in Shediac."},
+	}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("ParseCaptions: expected %+v, got %+v", expected, segments)
+	}
+}
+
+func TestParseCaptions_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, captions := range []string{
+		"",
+		"WEBVTT\n\n",
+		"Just a transcript without any timings.",
+		"1\n00:00:05,000 --> 00:00:01,000\nEnds before it starts.",
+		"1\n00:00:61,000 --> 00:01:05,000\nToo many seconds.",
+		"WEBVTT\n\n00:01.000 -->\nNo end.",
+	} {
+		if _, err := ParseCaptions(captions); !errors.Is(err, ErrInvalidCaptions) {
+			t.Errorf("ParseCaptions(%q): expected ErrInvalidCaptions, got %v", captions, err)
+		}
+	}
+}
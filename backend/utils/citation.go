@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"read-robin/models"
+)
+
+// citationProbeWords is the number of words from each end of a reference searched for when the whole
+// reference is not found, since models trim and reword quotes
+const citationProbeWords = 8
+
+// Cite returns the label of the anchor of contentText that reference was quoted from, or "" if the
+// reference cannot be found in the text or the content has no anchors
+func Cite(contentText string, anchors []models.Anchor, reference string) string {
+	if len(anchors) == 0 {
+		return ""
+	}
+	offset := LocateReference(contentText, reference)
+	if offset < 0 {
+		return ""
+	}
+	label := ""
+	for _, anchor := range anchors {
+		if anchor.Offset > offset {
+			break
+		}
+		label = anchor.Label
+	}
+	return label
+}
+
+// LocateReference returns the byte offset in contentText where reference starts, or -1 if it is not
+// found. The reference is matched ignoring case, punctuation and spacing, and when it does not match
+// whole its first or last words are looked for instead.
+func LocateReference(contentText, reference string) int {
+	reference = strings.TrimSpace(reference)
+	if reference == "" {
+		return -1
+	}
+	if offset := strings.Index(contentText, reference); offset >= 0 {
+		return offset
+	}
+
+	normalized, offsets := normalizeWithOffsets(contentText)
+	words := strings.Fields(NormalizeText(reference))
+	if len(words) == 0 {
+		return -1
+	}
+	probes := []string{strings.Join(words, " ")}
+	if len(words) > citationProbeWords {
+		probes = append(probes,
+			strings.Join(words[:citationProbeWords], " "),
+			strings.Join(words[len(words)-citationProbeWords:], " "))
+	}
+	for _, probe := range probes {
+		if i := indexWords(normalized, probe); i >= 0 {
+			return offsets[i]
+		}
+	}
+	return -1
+}
+
+// indexWords returns the index of the first match of probe in text that starts and ends on word boundaries
+func indexWords(text, probe string) int {
+	for start := 0; ; {
+		i := strings.Index(text[start:], probe)
+		if i < 0 {
+			return -1
+		}
+		i += start
+		end := i + len(probe)
+		if (i == 0 || text[i-1] == ' ') && (end == len(text) || text[end] == ' ') {
+			return i
+		}
+		start = i + 1
+	}
+}
+
+// normalizeWithOffsets normalizes text as NormalizeText does, also returning the offset in text of each
+// byte of the normalized text
+func normalizeWithOffsets(text string) (string, []int) {
+	var normalized strings.Builder
+	var offsets []int
+	space := false
+	for i, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			space = normalized.Len() > 0
+			continue
+		}
+		if space {
+			normalized.WriteByte(' ')
+			offsets = append(offsets, i)
+			space = false
+		}
+		lower := unicode.ToLower(r)
+		normalized.WriteRune(lower)
+		for range utf8.RuneLen(lower) {
+			offsets = append(offsets, i)
+		}
+	}
+	return normalized.String(), offsets
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestCite(t *testing.T) {
+	t.Parallel()
+	text := "Lobsters grow by molting their hard exoskeleton.\n\nShediac hosts a giant lobster statue. It weighs ninety tonnes.\n\nSome lobsters live for over a century."
+	anchors := []models.Anchor{{Offset: 0, Label: "p. 1"}, {Offset: 50, Label: "p. 2"}, {Offset: 113, Label: "p. 3"}}
+
+	testCases := []struct {
+		reference string
+		expected  string
+	}{
+		{"Lobsters grow by molting", "p. 1"},
+		{"It weighs ninety tonnes.", "p. 2"},
+		// Quotes with different case, punctuation and spacing
+		{"shediac hosts a GIANT lobster statue", "p. 2"},
+		{"some lobsters live  for over a century", "p. 3"},
+		// Long quotes reworded at one end are found by their other end
+		{"Shediac hosts a giant lobster statue. It weighs ninety tonnes, as much as a truck.", "p. 2"},
+		{"Locals say Shediac hosts a giant lobster statue. It weighs ninety tonnes.", "p. 2"},
+		// Words must match whole
+		{"lobster statue it weighs ninety tonne", ""},
+		{"Lobsters are crustaceans.", ""},
+		{"", ""},
+	}
+	for _, tc := range testCases {
+		if label := Cite(text, anchors, tc.reference); label != tc.expected {
+			t.Errorf("Cite(%q): expected %q, got %q", tc.reference, tc.expected, label)
+		}
+	}
+
+	if label := Cite(text, nil, "Lobsters grow by molting"); label != "" {
+		t.Errorf("Cite: expected no citation for content without anchors, got %q", label)
+	}
+}
+
+func TestLocateReference(t *testing.T) {
+	t.Parallel()
+	text := "Crème brûlée, then lobster.\nLobster rolls—with butter."
+	if offset := LocateReference(text, "lobster rolls with butter"); offset != 31 {
+		t.Errorf("LocateReference: expected the byte offset of the matching line, got %d", offset)
+	}
+	if offset := LocateReference(text, "CRÈME BRÛLÉE then"); offset != 0 {
+		t.Errorf("LocateReference: expected accented text to match ignoring case, got %d", offset)
+	}
+}
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+
+	"read-robin/models"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Media types of the documents read by ExtractDocument
+const (
+	MediaTypeEPUB     = "application/epub+zip"
+	MediaTypeDOCX     = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MediaTypePPTX     = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	MediaTypeMarkdown = "text/markdown"
+)
+
+// ErrInvalidDocument is returned by ExtractDocument for files that are not a document it can read
+var ErrInvalidDocument = errors.New("not a readable document")
+
+// maxDocumentPartSize bounds the uncompressed size of each file read from a document's archive
+const maxDocumentPartSize = 64 << 20
+
+// maxDocumentSize bounds the uncompressed size of all the files read from a document's archive together,
+// however many parts it has or however often they are read
+const maxDocumentSize = 128 << 20
+
+// documentArchive is the zip archive of a document, whose files are read within maxDocumentSize
+type documentArchive struct {
+	*zip.Reader
+	remaining int64 // Uncompressed bytes left to read
+}
+
+func init() {
+	// The system's MIME tables do not reliably know these extensions
+	for ext, mediaType := range map[string]string{
+		".epub":     MediaTypeEPUB,
+		".docx":     MediaTypeDOCX,
+		".pptx":     MediaTypePPTX,
+		".md":       MediaTypeMarkdown,
+		".markdown": MediaTypeMarkdown,
+	} {
+		if err := mime.AddExtensionType(ext, mediaType); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// IsDocumentType reports whether files of mediaType are read by ExtractDocument
+func IsDocumentType(mediaType string) bool {
+	switch mediaType {
+	case MediaTypeEPUB, MediaTypeDOCX, MediaTypePPTX, MediaTypeMarkdown:
+		return true
+	}
+	return false
+}
+
+// documentOr returns claimed if it is a document type that sniffs as sniffed, which for documents is a zip
+// archive or plain text, and sniffed otherwise
+func documentOr(sniffed, claimed string) string {
+	if IsDocumentType(claimed) && (sniffed == "application/zip" || sniffed == "text/plain") {
+		return claimed
+	}
+	return sniffed
+}
+
+// Section is a part of a document cited as a whole: a chapter, a heading and the text under it, or a slide
+type Section struct {
+	Label string // How questions cite the section, e.g. "Slide 4"; empty for text before the first heading
+	Text  string // Paragraphs separated by blank lines
+}
+
+// Document is the text of an EPUB, DOCX, Markdown or PPTX file, extracted section by section without a model
+type Document struct {
+	Title    string // From the document's metadata, or else its first title or heading
+	Sections []Section
+}
+
+// ExtractDocument extracts the text of a document of mediaType, one of the types IsDocumentType accepts.
+// EPUBs are split into the chapters of their reading order, DOCX and Markdown files at their headings of the
+// top three levels, and slide decks into their visible slides, each with its speaker notes.
+func ExtractDocument(data []byte, mediaType string) (*Document, error) {
+	if mediaType == MediaTypeMarkdown {
+		return extractMarkdown(string(data)), nil
+	}
+	if !IsDocumentType(mediaType) {
+		return nil, fmt.Errorf("%w: unsupported media type %q", ErrInvalidDocument, mediaType)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	archive := &documentArchive{Reader: reader, remaining: maxDocumentSize}
+	switch mediaType {
+	case MediaTypeEPUB:
+		return extractEPUB(archive)
+	case MediaTypeDOCX:
+		return extractDOCX(archive)
+	default:
+		return extractPPTX(archive)
+	}
+}
+
+// Content joins the text of the sections, separated by blank lines, and returns it with an anchor citing
+// each labelled section at the offset where its text starts. Sections without text are left out.
+func (d *Document) Content() (string, []models.Anchor) {
+	var text strings.Builder
+	var anchors []models.Anchor
+	for _, section := range d.Sections {
+		sectionText := strings.TrimSpace(section.Text)
+		if sectionText == "" {
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		if section.Label != "" {
+			anchors = append(anchors, models.Anchor{Offset: text.Len(), Label: section.Label})
+		}
+		text.WriteString(sectionText)
+	}
+	return text.String(), anchors
+}
+
+// SlideLabel returns how questions cite a slide
+func SlideLabel(number int) string {
+	return "Slide " + strconv.Itoa(number)
+}
+
+// ChapterLabel returns how questions cite a chapter without a heading
+func ChapterLabel(number int) string {
+	return "Chapter " + strconv.Itoa(number)
+}
+
+// sectionWriter splits the paragraphs of a document into sections at its headings
+type sectionWriter struct {
+	sections   []Section
+	label      string
+	paragraphs []string
+}
+
+// heading starts a section labelled by the text of its heading, which is also the section's first paragraph
+func (w *sectionWriter) heading(text string) {
+	text = cleanParagraph(text)
+	if text == "" {
+		return
+	}
+	w.flush()
+	w.label = text
+	w.paragraphs = append(w.paragraphs, text)
+}
+
+// paragraph adds a paragraph to the current section
+func (w *sectionWriter) paragraph(text string) {
+	if text = cleanParagraph(text); text != "" {
+		w.paragraphs = append(w.paragraphs, text)
+	}
+}
+
+// flush ends the current section
+func (w *sectionWriter) flush() {
+	if len(w.paragraphs) > 0 {
+		w.sections = append(w.sections, Section{Label: w.label, Text: strings.Join(w.paragraphs, "\n\n")})
+	}
+	w.label, w.paragraphs = "", nil
+}
+
+// finish ends the last section and returns the sections written
+func (w *sectionWriter) finish() []Section {
+	w.flush()
+	return w.sections
+}
+
+// cleanParagraph collapses the whitespace of each line of a paragraph, dropping blank lines
+func cleanParagraph(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = collapseSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readZipFile reads the file name from archive, failing with ErrInvalidDocument if it is missing, too large,
+// or more than is left of the archive's budget
+func readZipFile(archive *documentArchive, name string) ([]byte, error) {
+	f, err := archive.Open(strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+	defer f.Close()
+	limit := min(maxDocumentPartSize, archive.remaining)
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading %s: %v", ErrInvalidDocument, name, err)
+	}
+	if int64(len(data)) > limit {
+		if limit == maxDocumentPartSize {
+			return nil, fmt.Errorf("%w: %s is too large", ErrInvalidDocument, name)
+		}
+		return nil, fmt.Errorf("%w: uncompressed size exceeds %d bytes", ErrInvalidDocument, maxDocumentSize)
+	}
+	archive.remaining -= int64(len(data))
+	return data, nil
+}
+
+// decodeZipXML decodes the XML file name from archive into v
+func decodeZipXML(archive *documentArchive, name string, v any) error {
+	data, err := readZipFile(archive, name)
+	if err != nil {
+		return err
+	}
+	if err := newXMLDecoder(data).Decode(v); err != nil {
+		return fmt.Errorf("%w: decoding %s: %v", ErrInvalidDocument, name, err)
+	}
+	return nil
+}
+
+// newXMLDecoder creates a decoder for the XML files of documents, reading any character set they declare
+func newXMLDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder
+}
+
+// xmlAttr returns the value of the attribute of start with the local name key, in any namespace
+func xmlAttr(start xml.StartElement, key string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == key {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// packageRelationships are the relationships of a part of an Office document to its other parts
+type packageRelationships struct {
+	Relationships []struct {
+		ID         string `xml:"Id,attr"`
+		Type       string `xml:"Type,attr"`
+		Target     string `xml:"Target,attr"`
+		TargetMode string `xml:"TargetMode,attr"`
+	} `xml:"Relationship"`
+}
+
+// readRelationships reads the relationships of the part name, returning the paths in the archive of their
+// targets by relationship ID and by the last segment of the relationship type, e.g. "notesSlide". A part
+// without relationships has none.
+func readRelationships(archive *documentArchive, name string) (map[string]string, map[string]string, error) {
+	relsName := path.Join(path.Dir(name), "_rels", path.Base(name)+".rels")
+	byID, byType := map[string]string{}, map[string]string{}
+	f, err := archive.Open(relsName)
+	if err != nil {
+		return byID, byType, nil
+	}
+	f.Close()
+	var rels packageRelationships
+	if err := decodeZipXML(archive, relsName, &rels); err != nil {
+		return nil, nil, err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.TargetMode == "External" {
+			continue
+		}
+		target := path.Join(path.Dir(name), rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			target = path.Clean(rel.Target)
+		}
+		byID[rel.ID] = strings.TrimPrefix(target, "/")
+		if relType := path.Base(rel.Type); byType[relType] == "" {
+			byType[relType] = byID[rel.ID]
+		}
+	}
+	return byID, byType, nil
+}
+
+// officeTitle returns the title set in the core properties of an Office document, or "" if it has none
+func officeTitle(archive *documentArchive) string {
+	var core struct {
+		Title string `xml:"http://purl.org/dc/elements/1.1/ title"`
+	}
+	if err := decodeZipXML(archive, "docProps/core.xml", &core); err != nil {
+		return ""
+	}
+	return collapseSpace(core.Title)
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+// zipDocumentFixture zips the parts of a document kept unzipped in testdata/document, so they can be read
+// in review. An EPUB's mimetype is stored first and uncompressed, as readers expect.
+func zipDocumentFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	dir := filepath.Join("testdata", "document", name)
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if data, err := os.ReadFile(filepath.Join(dir, "mimetype")); err == nil {
+		w, _ := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+		w.Write(data)
+	}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || entry.Name() == "mimetype" {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		t.Fatalf("zipping fixture %s: %v", name, err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractDocument_DOCX(t *testing.T) {
+	t.Parallel()
+	doc, err := ExtractDocument(zipDocumentFixture(t, "lobsters.docx"), MediaTypeDOCX)
+	if err != nil {
+		t.Fatalf("ExtractDocument: expected no error, got %v", err)
+	}
+	if doc.Title != "A Field Guide to Lobsters" {
+		t.Errorf("ExtractDocument: expected the title from the title style, got %q", doc.Title)
+	}
+	expected := []Section{
+		{Label: "", Text: "A Field Guide to Lobsters\n\nNotes from the Shediac lobster festival."},
+		// A localized heading style, with a heading too deep to start a section
+		{Label: "Molting", Text: "Molting\n\nLobsters grow by molting their hard exoskeleton.\nYoung lobsters molt every year.\n\nSoft shells\n\nAfter molting the shell hardens in weeks."},
+		// A heading by outline level, table cells and a text box
+		{Label: "Claws", Text: "Claws\n\nCrusher claw\n\nCracks shells\n\nA lobster can regrow a lost claw.\n\nLobsters are right or left handed."},
+	}
+	if !reflect.DeepEqual(doc.Sections, expected) {
+		t.Errorf("ExtractDocument: expected sections %q, got %q", expected, doc.Sections)
+	}
+}
+
+func TestExtractDocument_PPTX(t *testing.T) {
+	t.Parallel()
+	doc, err := ExtractDocument(zipDocumentFixture(t, "lobsters.pptx"), MediaTypePPTX)
+	if err != nil {
+		t.Fatalf("ExtractDocument: expected no error, got %v", err)
+	}
+	if doc.Title != "Lobster Biology Lecture" {
+		t.Errorf("ExtractDocument: expected the title from the core properties, got %q", doc.Title)
+	}
+	// Slides in the deck's order, without the hidden second slide, footers and slide numbers
+	expected := []Section{
+		{Label: "Slide 1", Text: "Lobster Biology\nShediac, 2024\n\nSpeaker notes:\nWelcome everyone to the festival."},
+		{Label: "Slide 3", Text: "Molting\nLobsters shed their shells.\nYoung lobsters molt every year.\nMolts per year"},
+	}
+	if !reflect.DeepEqual(doc.Sections, expected) {
+		t.Errorf("ExtractDocument: expected sections %q, got %q", expected, doc.Sections)
+	}
+}
+
+func TestExtractDocument_EPUB(t *testing.T) {
+	t.Parallel()
+	doc, err := ExtractDocument(zipDocumentFixture(t, "lobsters.epub"), MediaTypeEPUB)
+	if err != nil {
+		t.Fatalf("ExtractDocument: expected no error, got %v", err)
+	}
+	if doc.Title != "A Field Guide to Lobsters" {
+		t.Errorf("ExtractDocument: expected the title from the package, got %q", doc.Title)
+	}
+	// Without the cover, the navigation document, the notes outside the reading order and the chapters
+	// listed again
+	expected := []Section{
+		{Label: "Molting", Text: "Molting\n\nLobsters grow by molting their hard exoskeleton.\n\nYoung lobsters molt every year."},
+		{Label: "Chapter 2", Text: "Shediac hosts a giant lobster statue.\n\nIt weighs ninety tonnes."},
+	}
+	if !reflect.DeepEqual(doc.Sections, expected) {
+		t.Errorf("ExtractDocument: expected sections %q, got %q", expected, doc.Sections)
+	}
+}
+
+func TestExtractDocument_Invalid(t *testing.T) {
+	t.Parallel()
+	var empty bytes.Buffer
+	zip.NewWriter(&empty).Close()
+	for name, tc := range map[string]struct {
+		data      []byte
+		mediaType string
+	}{
+		"not a zip":        {[]byte("Lobsters have ten legs."), MediaTypeDOCX},
+		"missing parts":    {empty.Bytes(), MediaTypeEPUB},
+		"unsupported type": {zipDocumentFixture(t, "lobsters.docx"), "application/zip"},
+	} {
+		if _, err := ExtractDocument(tc.data, tc.mediaType); !errors.Is(err, ErrInvalidDocument) {
+			t.Errorf("ExtractDocument(%s): expected ErrInvalidDocument, got %v", name, err)
+		}
+	}
+}
+
+func TestReadZipFile_Budget(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range []string{"a.xml", "b.xml"} {
+		w, _ := writer.Create(name)
+		w.Write([]byte(strings.Repeat("x", 6)))
+	}
+	writer.Close()
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The budget is shared by all the parts read, including parts read again
+	archive := &documentArchive{Reader: reader, remaining: 15}
+	for _, name := range []string{"a.xml", "b.xml"} {
+		if _, err := readZipFile(archive, name); err != nil {
+			t.Fatalf("readZipFile(%s): expected no error within the budget, got %v", name, err)
+		}
+	}
+	if _, err := readZipFile(archive, "a.xml"); !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("readZipFile: expected ErrInvalidDocument past the budget, got %v", err)
+	}
+}
+
+func TestDocument_Content(t *testing.T) {
+	t.Parallel()
+	doc := Document{Sections: []Section{
+		{Text: "Notes from the festival."},
+		{Label: "Slide 1", Text: "Molting"},
+		{Label: "Slide 2", Text: "  "},
+		{Label: "Slide 3", Text: "Claws\n"},
+	}}
+	text, anchors := doc.Content()
+	if text != "Notes from the festival.\n\nMolting\n\nClaws" {
+		t.Errorf("Content: unexpected text %q", text)
+	}
+	expected := []models.Anchor{{Offset: 26, Label: "Slide 1"}, {Offset: 35, Label: "Slide 3"}}
+	if !reflect.DeepEqual(anchors, expected) {
+		t.Errorf("Content: expected anchors %v, got %v", expected, anchors)
+	}
+	if label := Cite(text, anchors, "Claws"); label != "Slide 3" {
+		t.Errorf("Cite: expected Slide 3, got %q", label)
+	}
+	if !strings.HasPrefix(text[anchors[0].Offset:], "Molting") {
+		t.Errorf("Content: expected Slide 1 to start at offset %d, got %q", anchors[0].Offset, text[anchors[0].Offset:])
+	}
+}
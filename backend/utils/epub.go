@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// epubContainer is the container file of an EPUB, which points to its package document
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// epubPackage is the part of an EPUB's package document read by extractEPUB
+type epubPackage struct {
+	Titles   []string `xml:"metadata>title"`
+	Manifest []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// extractEPUB reads the chapters of an EPUB in its reading order. Each chapter is cited by its first heading,
+// or else by its number among the chapters with text; the navigation document, items outside the linear
+// reading order, such as footnotes, and files already read are skipped.
+func extractEPUB(archive *documentArchive) (*Document, error) {
+	var container epubContainer
+	if err := decodeZipXML(archive, "META-INF/container.xml", &container); err != nil {
+		return nil, err
+	}
+	packagePath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			packagePath = rootfile.FullPath
+			break
+		}
+	}
+	if packagePath == "" {
+		return nil, fmt.Errorf("%w: EPUB has no package document", ErrInvalidDocument)
+	}
+	var pkg epubPackage
+	if err := decodeZipXML(archive, packagePath, &pkg); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	if len(pkg.Titles) > 0 {
+		doc.Title = collapseSpace(pkg.Titles[0])
+	}
+	read := map[string]bool{}
+	for _, itemRef := range pkg.Spine {
+		if itemRef.Linear == "no" {
+			continue
+		}
+		for _, item := range pkg.Manifest {
+			if item.ID != itemRef.IDRef || strings.Contains(item.Properties, "nav") ||
+				item.MediaType != "application/xhtml+xml" && item.MediaType != "text/html" {
+				continue
+			}
+			href, err := url.PathUnescape(strings.SplitN(item.Href, "#", 2)[0])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid href %q", ErrInvalidDocument, item.Href)
+			}
+			// A file listed more than once, or by several items, is read where it first appears
+			name := path.Join(path.Dir(packagePath), href)
+			if read[name] {
+				break
+			}
+			read[name] = true
+			data, err := readZipFile(archive, name)
+			if err != nil {
+				return nil, err
+			}
+			if section, ok := epubChapter(data, len(doc.Sections)+1); ok {
+				doc.Sections = append(doc.Sections, section)
+			}
+			break
+		}
+	}
+	if doc.Title == "" && len(doc.Sections) > 0 {
+		doc.Title = doc.Sections[0].Label
+	}
+	return doc, nil
+}
+
+// epubChapter reads the text of a chapter of an EPUB, returning false for chapters without text such as covers
+func epubChapter(data []byte, number int) (Section, bool) {
+	doc, err := nethtml.Parse(bytes.NewReader(data))
+	if err != nil {
+		return Section{}, false
+	}
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return Section{}, false
+	}
+	var scripts []*nethtml.Node
+	walk(body, func(n *nethtml.Node) bool {
+		switch n.DataAtom {
+		case atom.Script, atom.Style, atom.Noscript, atom.Template:
+			scripts = append(scripts, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range scripts {
+		n.Parent.RemoveChild(n)
+	}
+
+	var renderer articleRenderer
+	renderer.render(body)
+	renderer.finish()
+	text := renderer.text()
+	if text == "" {
+		return Section{}, false
+	}
+	label := ChapterLabel(number)
+	if headings := renderer.headings(); len(headings) > 0 {
+		label = headings[0]
+	}
+	return Section{Label: label, Text: text}, true
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"read-robin/models"
+)
+
+// ErrInvalidResponse is returned by GradeResponse when a response cannot be read as an answer to the question
+var ErrInvalidResponse = errors.New("invalid response")
+
+// Review statuses shared by local grading and the LLM reviewer
+const (
+	ReviewPass = "PASS"
+	ReviewFail = "FAIL"
+)
+
+// IsObjective reports whether question can be graded locally by GradeResponse
+func IsObjective(question models.Question) bool {
+	switch question.Type {
+	case models.QuestionTypeMultipleChoice, models.QuestionTypeTrueFalse, models.QuestionTypeFillInBlank:
+		return true
+	}
+	return false
+}
+
+// GradeResponse deterministically grades the responses to an objective question, returning PASS or FAIL and an
+// explanation. Multiple-choice questions take the zero-based index of the choice in choice, or else a single
+// response with the choice's text. True/false questions take a single response of true or false, and
+// fill-in-the-blank questions one response per blank.
+func GradeResponse(question models.Question, responses []string, choice *int) (string, string, error) {
+	var correct bool
+	switch {
+	case question.Type == models.QuestionTypeMultipleChoice && question.MultipleChoice != nil:
+		index, err := choiceIndex(question.MultipleChoice.Choices, responses, choice)
+		if err != nil {
+			return "", "", err
+		}
+		correct = index == question.MultipleChoice.CorrectIndex
+	case question.Type == models.QuestionTypeTrueFalse && question.TrueFalse != nil:
+		answer, err := parseTrueFalseResponse(responses)
+		if err != nil {
+			return "", "", err
+		}
+		correct = answer == question.TrueFalse.Answer
+	case question.Type == models.QuestionTypeFillInBlank && question.FillInBlank != nil:
+		if len(responses) != len(question.FillInBlank.Blanks) {
+			return "", "", fmt.Errorf("%w: expected %d blanks, got %d", ErrInvalidResponse, len(question.FillInBlank.Blanks), len(responses))
+		}
+		correct = true
+		for i, blank := range question.FillInBlank.Blanks {
+			if normalizeAnswer(responses[i]) != normalizeAnswer(blank) {
+				correct = false
+			}
+		}
+	default:
+		return "", "", fmt.Errorf("question type %q cannot be graded locally", question.Type)
+	}
+
+	if correct {
+		return ReviewPass, fmt.Sprintf("Correct! %s", question.Reference), nil
+	}
+	return ReviewFail, fmt.Sprintf("Not quite. The correct answer is %s. %s", question.Answer, question.Reference), nil
+}
+
+// choiceIndex resolves a multiple-choice response given as the zero-based index in choice, or else as the text
+// of a choice. Responses are never read as indexes, since choices such as years are numbers themselves.
+func choiceIndex(choices []string, responses []string, choice *int) (int, error) {
+	if choice != nil {
+		if *choice < 0 || *choice >= len(choices) {
+			return 0, fmt.Errorf("%w: choice %d out of range", ErrInvalidResponse, *choice)
+		}
+		return *choice, nil
+	}
+	if len(responses) != 1 {
+		return 0, fmt.Errorf("%w: expected a single choice", ErrInvalidResponse)
+	}
+	for i, text := range choices {
+		if normalizeAnswer(text) == normalizeAnswer(responses[0]) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q is not one of the choices", ErrInvalidResponse, strings.TrimSpace(responses[0]))
+}
+
+// parseTrueFalseResponse reads a true/false response, accepting yes and no as well
+func parseTrueFalseResponse(responses []string) (bool, error) {
+	if len(responses) != 1 {
+		return false, fmt.Errorf("%w: expected true or false", ErrInvalidResponse)
+	}
+	switch normalizeAnswer(responses[0]) {
+	case "true", "t", "yes", "y":
+		return true, nil
+	case "false", "f", "no", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: expected true or false, got %q", ErrInvalidResponse, responses[0])
+}
+
+// normalizeAnswer lowercases s, collapses whitespace and trims surrounding punctuation so that
+// trivially different spellings of an answer compare equal
+func normalizeAnswer(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	return strings.Trim(s, ".,!?;:'\"")
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestGradeResponse(t *testing.T) {
+	t.Parallel()
+	multipleChoice := models.Question{
+		Type:           models.QuestionTypeMultipleChoice,
+		Answer:         "Examples",
+		MultipleChoice: &models.MultipleChoice{Choices: []string{"Shopping", "Examples", "Email"}, CorrectIndex: 1},
+	}
+	trueFalse := models.Question{Type: models.QuestionTypeTrueFalse, Answer: "false", TrueFalse: &models.TrueFalse{Answer: false}}
+	fillInBlank := models.Question{
+		Type:        models.QuestionTypeFillInBlank,
+		Answer:      "red, blue",
+		FillInBlank: &models.FillInBlank{Text: "Roses are ___, violets are ___.", Blanks: []string{"red", "blue"}},
+	}
+
+	years := models.Question{
+		Type:           models.QuestionTypeMultipleChoice,
+		Answer:         "1990",
+		MultipleChoice: &models.MultipleChoice{Choices: []string{"1", "1989", "1990"}, CorrectIndex: 2},
+	}
+	index := func(i int) *int { return &i }
+
+	testCases := []struct {
+		name           string
+		question       models.Question
+		responses      []string
+		choice         *int
+		expectedStatus string
+		expectedErr    error
+	}{
+		{"Choice by index", multipleChoice, []string{""}, index(1), ReviewPass, nil},
+		{"Choice by text", multipleChoice, []string{" examples. "}, nil, ReviewPass, nil},
+		{"Wrong choice", multipleChoice, nil, index(0), ReviewFail, nil},
+		{"Choice out of range", multipleChoice, nil, index(3), "", ErrInvalidResponse},
+		{"Unknown choice", multipleChoice, []string{"Banking"}, nil, "", ErrInvalidResponse},
+		{"Number is not an index", multipleChoice, []string{"1"}, nil, "", ErrInvalidResponse},
+		{"Numeric choice by text", years, []string{"1990"}, nil, ReviewPass, nil},
+		{"Numeric choice that is also an index", years, []string{"1"}, nil, ReviewFail, nil},
+		{"Numeric choice by index", years, nil, index(2), ReviewPass, nil},
+		{"False", trueFalse, []string{"False"}, nil, ReviewPass, nil},
+		{"No", trueFalse, []string{"no"}, nil, ReviewPass, nil},
+		{"True", trueFalse, []string{"true"}, nil, ReviewFail, nil},
+		{"Not a boolean", trueFalse, []string{"maybe"}, nil, "", ErrInvalidResponse},
+		{"All blanks", fillInBlank, []string{"Red", " blue "}, nil, ReviewPass, nil},
+		{"One blank wrong", fillInBlank, []string{"red", "green"}, nil, ReviewFail, nil},
+		{"Blank count mismatch", fillInBlank, []string{"red"}, nil, "", ErrInvalidResponse},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, explanation, err := GradeResponse(tc.question, tc.responses, tc.choice)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("GradeResponse: expected error %v, got %v", tc.expectedErr, err)
+			}
+			if status != tc.expectedStatus {
+				t.Errorf("GradeResponse: expected status %q, got %q", tc.expectedStatus, status)
+			}
+			if err == nil && explanation == "" {
+				t.Errorf("GradeResponse: expected an explanation")
+			}
+		})
+	}
+}
+
+func TestGradeResponse_FreeTextIsNotObjective(t *testing.T) {
+	t.Parallel()
+	question := models.Question{Type: models.QuestionTypeFreeText, Answer: "A"}
+	if IsObjective(question) || IsObjective(models.Question{}) {
+		t.Errorf("IsObjective: expected free text questions to need a review")
+	}
+	if _, _, err := GradeResponse(question, []string{"A"}, nil); err == nil {
+		t.Errorf("GradeResponse: expected an error for a free text question")
+	}
+}
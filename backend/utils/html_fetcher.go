@@ -1,22 +1,274 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
-// FetchHTML fetches the HTML content from the given URL.
-func FetchHTML(url string) (string, error) {
-	resp, err := http.Get(url)
+var (
+	// ErrTooLarge is returned when a response body exceeds FetchPolicy.MaxBodySize
+	ErrTooLarge = errors.New("response body too large")
+	// ErrTooManyRedirects is returned when a fetch is redirected more than FetchPolicy.MaxRedirects times
+	ErrTooManyRedirects = errors.New("too many redirects")
+	// ErrDisallowedByRobots is returned when robots.txt disallows fetching a URL
+	ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+)
+
+// Page is a fetched web page along with the validators for revalidating it later
+type Page struct {
+	Body         string // Empty for audio and video, which are extracted from their URL rather than fetched
+	ContentType  string // The media type, from the Content-Type header or sniffed from the body
+	ETag         string
+	LastModified string
+	NotModified  bool // The server confirmed the page is unchanged since the validators sent; Body is empty
+}
+
+// FetchPolicy limits what a Fetcher fetches on behalf of users. Zero values use the DefaultFetchPolicy values.
+type FetchPolicy struct {
+	Timeout       time.Duration
+	MaxBodySize   int64
+	MaxRedirects  int
+	UserAgent     string
+	RespectRobots bool
+	// AllowPrivate permits loopback, private and link-local addresses, for local development only
+	AllowPrivate bool
+}
+
+// DefaultFetchPolicy is the policy used for fields left unset
+var DefaultFetchPolicy = FetchPolicy{
+	Timeout:      30 * time.Second,
+	MaxBodySize:  10 << 20,
+	MaxRedirects: 5,
+	UserAgent:    "Quizbo/1.0",
+}
+
+// Resolver looks up the IP addresses of a host; *net.Resolver satisfies it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Fetcher fetches user-supplied URLs safely: every address is checked after DNS resolution, so URLs
+// cannot reach internal services, and timeouts, redirects and body sizes are bounded
+type Fetcher struct {
+	policy   FetchPolicy
+	resolver Resolver
+	client   *http.Client
+	robots   *robotsCache
+
+	// dialContext connects to an address already checked by the Fetcher; tests replace it
+	dialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewFetcher creates a Fetcher enforcing policy, resolving hosts with resolver, or net.DefaultResolver if nil
+func NewFetcher(policy FetchPolicy, resolver Resolver) *Fetcher {
+	if policy.Timeout <= 0 {
+		policy.Timeout = DefaultFetchPolicy.Timeout
+	}
+	if policy.MaxBodySize <= 0 {
+		policy.MaxBodySize = DefaultFetchPolicy.MaxBodySize
+	}
+	if policy.MaxRedirects <= 0 {
+		policy.MaxRedirects = DefaultFetchPolicy.MaxRedirects
+	}
+	if policy.UserAgent == "" {
+		policy.UserAgent = DefaultFetchPolicy.UserAgent
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	f := &Fetcher{policy: policy, resolver: resolver, robots: newRobotsCache()}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	f.dialContext = dialer.DialContext
+	f.client = &http.Client{
+		Timeout: policy.Timeout,
+		Transport: &http.Transport{
+			// Never use a proxy from the environment, which would bypass the address checks
+			Proxy:                 nil,
+			DialContext:           f.guardedDial,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: policy.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > policy.MaxRedirects {
+				return fmt.Errorf("fetching %s: %w", via[0].URL, ErrTooManyRedirects)
+			}
+			return checkScheme(req.URL)
+		},
+	}
+	return f
+}
+
+// Client returns the guarded HTTP client used by the Fetcher, for other requests to user-supplied URLs
+func (f *Fetcher) Client() *http.Client {
+	return f.client
+}
+
+// FetchHTML fetches the HTML content from a URL
+func (f *Fetcher) FetchHTML(ctx context.Context, url string) (string, error) {
+	page, err := f.FetchPage(ctx, url, "", "")
 	if err != nil {
 		return "", err
 	}
+	return page.Body, nil
+}
+
+// FetchPage fetches rawURL, sending etag and lastModified, if set, as a conditional request. The body of
+// textual responses, XML and PDFs is read up to the policy's size limit; for other media types only the type is returned.
+func (f *Fetcher) FetchPage(ctx context.Context, rawURL, etag, lastModified string) (*Page, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkScheme(u); err != nil {
+		return nil, err
+	}
+	if f.policy.RespectRobots {
+		allowed, err := f.robots.allowed(ctx, f, u)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("fetching %s: %w", rawURL, ErrDisallowedByRobots)
+		}
+	}
+
+	req, err := f.newRequest(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	page := &Page{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if resp.StatusCode == http.StatusNotModified && (etag != "" || lastModified != "") {
+		page.NotModified = true
+		return page, nil
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("fetching %s: status %d", rawURL, resp.StatusCode)
+	}
+	if resp.ContentLength > f.policy.MaxBodySize && readsBody(mediaType(resp.Header.Get("Content-Type"))) {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, ErrTooLarge)
+	}
+
+	// Sniff the first bytes, since servers often send media as application/octet-stream
+	head := make([]byte, 512)
+	n, err := io.ReadFull(resp.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+	page.ContentType = detectContentType(resp.Header.Get("Content-Type"), head, u.Path)
+	if !readsBody(page.ContentType) {
+		return page, nil
+	}
+
+	rest, err := io.ReadAll(io.LimitReader(resp.Body, f.policy.MaxBodySize-int64(n)+1))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if int64(n+len(rest)) > f.policy.MaxBodySize {
+		return nil, fmt.Errorf("fetching %s: %w", rawURL, ErrTooLarge)
+	}
+	page.Body = string(head) + string(rest)
+	return page, nil
+}
+
+// newRequest creates a GET request for rawURL identifying the fetcher by its user agent
+func (f *Fetcher) newRequest(ctx context.Context, rawURL string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.policy.UserAgent)
+	return req, nil
+}
+
+// checkScheme rejects URLs that are not http or https
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
 	}
+	return nil
+}
+
+// mediaType returns the media type of a Content-Type header without its parameters
+func mediaType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return ""
+}
+
+// detectContentType returns the media type of a response from its Content-Type header, falling back to
+// sniffing its first bytes and then to the extension of its path when the header is missing or generic.
+// Documents served or sniffed as the zip archives or plain text they are made of are told apart by their extension.
+func detectContentType(header string, head []byte, path string) string {
+	byExt := ""
+	if ext := strings.ToLower(pathExt(path)); ext != "" {
+		byExt = mediaType(mime.TypeByExtension(ext))
+	}
+	if declared := mediaType(header); declared != "" && declared != "application/octet-stream" && declared != "binary/octet-stream" {
+		return documentOr(declared, byExt)
+	}
+	if len(head) > 0 {
+		if sniffed := mediaType(http.DetectContentType(head)); sniffed != "application/octet-stream" {
+			// Plain text sniffed from a generic response is more likely a file type the sniffer does not know
+			if sniffed != "text/plain" || mediaType(header) == "" {
+				return documentOr(sniffed, byExt)
+			}
+		}
+	}
+	if byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// pathExt returns the extension of the last segment of a URL path
+func pathExt(path string) string {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[i:]
+	}
+	return ""
+}
+
+// isTextual reports whether a media type is a web page or text
+func isTextual(mediaType string) bool {
+	return mediaType == "" || strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml"
+}
+
+// readsBody reports whether the Fetcher reads the body of a media type: text, XML such as podcast feeds, and
+// PDFs and documents, which are extracted locally
+func readsBody(mediaType string) bool {
+	return isTextual(mediaType) || isXML(mediaType) || mediaType == "application/pdf" || IsDocumentType(mediaType)
+}
 
-	return string(body), nil
+// isXML reports whether a media type is an XML document, such as an RSS or Atom feed
+func isXML(mediaType string) bool {
+	return mediaType == "application/xml" || strings.HasSuffix(mediaType, "+xml")
 }
@@ -1,11 +1,53 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
 	"testing"
 )
 
+// newLocalFetcher creates a Fetcher that may fetch from httptest servers on the loopback address
+func newLocalFetcher() *Fetcher {
+	return NewFetcher(FetchPolicy{AllowPrivate: true}, nil)
+}
+
+// fakeResolver resolves the hosts in its map, and fails for others
+type fakeResolver map[string][]string
+
+func (fr fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := fr[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+// publicIP is the address fakeResolver gives public test hosts
+const publicIP = "93.184.216.34"
+
+// newPublicFetcher creates a Fetcher enforcing policy that resolves hosts with resolver and connects every
+// allowed address to ts, so httptest servers can stand in for public sites. It returns the number of dials.
+func newPublicFetcher(policy FetchPolicy, resolver fakeResolver, ts *httptest.Server) (*Fetcher, *atomic.Int32) {
+	fetcher := NewFetcher(policy, resolver)
+	var dials atomic.Int32
+	fetcher.dialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials.Add(1)
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	return fetcher, &dials
+}
+
 func TestFetchHTML(t *testing.T) {
 	t.Parallel()
 	// Create a test server that returns some HTML
@@ -15,7 +57,7 @@ func TestFetchHTML(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	html, err := FetchHTML(ts.URL)
+	html, err := newLocalFetcher().FetchHTML(context.Background(), ts.URL)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -25,3 +67,246 @@ func TestFetchHTML(t *testing.T) {
 		t.Errorf("expected %s, got %s", expectedHTML, html)
 	}
 }
+
+func TestFetchPage_Conditional(t *testing.T) {
+	t.Parallel()
+	const etag = `"v1"`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte("<html><body>Version 1</body></html>"))
+	}))
+	defer ts.Close()
+
+	fetcher := newLocalFetcher()
+	page, err := fetcher.FetchPage(context.Background(), ts.URL, "", "")
+	if err != nil {
+		t.Fatalf("FetchPage: expected no error, got %v", err)
+	}
+	if page.NotModified || page.ETag != etag || page.Body == "" {
+		t.Errorf("FetchPage: unexpected first page %+v", page)
+	}
+
+	page, err = fetcher.FetchPage(context.Background(), ts.URL, etag, "")
+	if err != nil {
+		t.Fatalf("FetchPage: expected no error, got %v", err)
+	}
+	if !page.NotModified || page.Body != "" {
+		t.Errorf("FetchPage: expected not modified, got %+v", page)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bool{
+		"93.184.216.34":        true,
+		"2606:2800:220:1::248": true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.100.100.200":      false,
+		"0.0.0.0":              false,
+		"255.255.255.255":      false,
+		"::1":                  false,
+		"::ffff:127.0.0.1":     false,
+		"fd00:ec2::254":        false,
+		"fe80::1":              false,
+		"64:ff9b::a9fe:a9fe":   false,
+	}
+	for address, expected := range testCases {
+		if got := IsPublicAddress(netip.MustParseAddr(address)); got != expected {
+			t.Errorf("IsPublicAddress(%s): expected %v, got %v", address, expected, got)
+		}
+	}
+}
+
+func TestFetcher_BlocksInternalAddresses(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>Secret</body></html>"))
+	}))
+	defer ts.Close()
+
+	resolver := fakeResolver{
+		"metadata.test": {"169.254.169.254"},
+		"intranet.test": {"10.0.0.5"},
+		"rebind.test":   {"127.0.0.1"},
+		"mixed.test":    {publicIP, "192.168.1.1"},
+	}
+	fetcher, dials := newPublicFetcher(FetchPolicy{}, resolver, ts)
+
+	for _, url := range []string{
+		"http://metadata.test/computeMetadata/v1/",
+		"http://intranet.test/admin",
+		"http://rebind.test/",
+		"http://mixed.test/",
+		"http://127.0.0.1/",
+		"http://[::1]/",
+		"http://[::ffff:169.254.169.254]/",
+	} {
+		if _, err := fetcher.FetchPage(context.Background(), url, "", ""); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("FetchPage(%s): expected ErrBlockedAddress, got %v", url, err)
+		}
+	}
+	if dials.Load() != 0 {
+		t.Errorf("FetchPage: expected no connections to blocked addresses, got %d", dials.Load())
+	}
+
+	if _, err := fetcher.FetchPage(context.Background(), "file:///etc/passwd", "", ""); err == nil {
+		t.Errorf("FetchPage: expected file URLs to be rejected")
+	}
+}
+
+func TestFetcher_Redirects(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/to-metadata":
+			http.Redirect(w, r, "http://metadata.test/computeMetadata/v1/", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/article", http.StatusMovedPermanently)
+		default:
+			w.Write([]byte("<html><body>Article</body></html>"))
+		}
+	}))
+	defer ts.Close()
+
+	resolver := fakeResolver{"public.test": {publicIP}, "metadata.test": {"169.254.169.254"}}
+	fetcher, _ := newPublicFetcher(FetchPolicy{MaxRedirects: 3}, resolver, ts)
+	ctx := context.Background()
+
+	if page, err := fetcher.FetchPage(ctx, "http://public.test/moved", "", ""); err != nil || !strings.Contains(page.Body, "Article") {
+		t.Errorf("FetchPage: expected to follow the redirect, got %+v, %v", page, err)
+	}
+	if _, err := fetcher.FetchPage(ctx, "http://public.test/to-metadata", "", ""); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("FetchPage: expected a redirect to an internal address to be blocked, got %v", err)
+	}
+	if _, err := fetcher.FetchPage(ctx, "http://public.test/loop", "", ""); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("FetchPage: expected ErrTooManyRedirects, got %v", err)
+	}
+}
+
+func TestFetcher_LimitsBodySize(t *testing.T) {
+	t.Parallel()
+	body := "<html><body>" + strings.Repeat("Lobsters have ten legs. ", 100) + "</body></html>"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/chunked" {
+			// Flushing before writing the body omits the Content-Length header
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	fetcher, _ := newPublicFetcher(FetchPolicy{MaxBodySize: 1024}, fakeResolver{"public.test": {publicIP}}, ts)
+	for _, path := range []string{"/sized", "/chunked"} {
+		if _, err := fetcher.FetchPage(context.Background(), "http://public.test"+path, "", ""); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("FetchPage(%s): expected ErrTooLarge, got %v", path, err)
+		}
+	}
+
+	fetcher, _ = newPublicFetcher(FetchPolicy{MaxBodySize: int64(len(body))}, fakeResolver{"public.test": {publicIP}}, ts)
+	if page, err := fetcher.FetchPage(context.Background(), "http://public.test/chunked", "", ""); err != nil || page.Body != body {
+		t.Errorf("FetchPage: expected a body at the limit to be read, got %v", err)
+	}
+}
+
+func TestFetcher_DetectsContentType(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		path        string
+		header      string
+		body        string
+		contentType string
+		hasBody     bool
+	}{
+		{"/page", "text/html; charset=utf-8", "<html><body>Lobsters</body></html>", "text/html", true},
+		{"/download", "application/octet-stream", "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj", "application/pdf", true},
+		{"/episode", "", "ID3\x04\x00\x00\x00\x00\x00\x00audio frames", "audio/mpeg", false},
+		{"/clip", "binary/octet-stream", "\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom", "video/mp4", false},
+		{"/talk.mp3", "application/octet-stream", "not a recognizable header", "audio/mpeg", false},
+		{"/notes", "", "Lobsters have ten legs.", "text/plain", true},
+		{"/feed", "application/rss+xml; charset=utf-8", "<rss><channel></channel></rss>", "application/rss+xml", true},
+		{"/README.md", "text/plain; charset=utf-8", "# Lobsters\n\nThey have ten legs.", "text/markdown", true},
+		{"/slides.pptx", "application/octet-stream", "PK\x03\x04\x14\x00\x06\x00", MediaTypePPTX, true},
+		{"/archive", "application/zip", "PK\x03\x04\x14\x00\x06\x00", "application/zip", false},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, tc := range testCases {
+			if tc.path == r.URL.Path {
+				w.Header()["Content-Type"] = []string{tc.header}
+				fmt.Fprint(w, tc.body)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	fetcher, _ := newPublicFetcher(FetchPolicy{}, fakeResolver{"public.test": {publicIP}}, ts)
+	for _, tc := range testCases {
+		page, err := fetcher.FetchPage(context.Background(), "http://public.test"+tc.path, "", "")
+		if err != nil {
+			t.Fatalf("FetchPage(%s): expected no error, got %v", tc.path, err)
+		}
+		if page.ContentType != tc.contentType {
+			t.Errorf("FetchPage(%s): expected content type %s, got %s", tc.path, tc.contentType, page.ContentType)
+		}
+		if (page.Body != "") != tc.hasBody {
+			t.Errorf("FetchPage(%s): expected body %v, got %q", tc.path, tc.hasBody, page.Body)
+		}
+	}
+}
+
+func TestFetcher_Robots(t *testing.T) {
+	t.Parallel()
+	var userAgent atomic.Value
+	var robotsFetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent.Store(r.UserAgent())
+		if r.URL.Path == "/robots.txt" {
+			robotsFetches.Add(1)
+			fmt.Fprint(w, "User-agent: *\nDisallow: /\n\nUser-agent: Quizbo\nDisallow: /members/\nAllow: /members/free-*\nDisallow: /*.zip$\n")
+			return
+		}
+		w.Write([]byte("<html><body>Article</body></html>"))
+	}))
+	defer ts.Close()
+
+	resolver := fakeResolver{"public.test": {publicIP}}
+	fetcher, _ := newPublicFetcher(FetchPolicy{RespectRobots: true}, resolver, ts)
+	testCases := map[string]bool{
+		"/articles/lobsters":                true,
+		"/members/lobsters":                 false,
+		"/members/free-lobsters":            true,
+		"/downloads/lobsters.zip":           false,
+		"/downloads/lobsters.zip?version=2": true,
+	}
+	for path, allowed := range testCases {
+		_, err := fetcher.FetchPage(context.Background(), "http://public.test"+path, "", "")
+		if disallowed := errors.Is(err, ErrDisallowedByRobots); disallowed == allowed {
+			t.Errorf("FetchPage(%s): expected allowed %v, got %v", path, allowed, err)
+		}
+	}
+	if robotsFetches.Load() != 1 {
+		t.Errorf("FetchPage: expected robots.txt to be cached, fetched %d times", robotsFetches.Load())
+	}
+	if userAgent.Load() != DefaultFetchPolicy.UserAgent {
+		t.Errorf("FetchPage: expected user agent %q, got %q", DefaultFetchPolicy.UserAgent, userAgent.Load())
+	}
+
+	// Robots are ignored unless the policy asks for them
+	fetcher, _ = newPublicFetcher(FetchPolicy{}, resolver, ts)
+	if _, err := fetcher.FetchPage(context.Background(), "http://public.test/members/lobsters", "", ""); err != nil {
+		t.Errorf("FetchPage: expected robots.txt to be ignored, got %v", err)
+	}
+}
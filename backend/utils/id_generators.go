@@ -1,25 +1,81 @@
 package utils
 
 import (
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
+	"time"
 )
 
-// GenerateID creates a unique ID based on the URL
+// GenerateID creates a unique ID based on the URL: the first 128 bits of its SHA-256 digest, in hex
 func GenerateID(url string) string {
-	return fmt.Sprintf("%x", Hash(url))
+	return ContentHash(url)[:32]
 }
 
-// generateQuestionID generates a 4-digit random question ID
-func GenerateQuestionID() string {
-	return fmt.Sprintf("%04d", rand.Intn(10000))
+// GenerateContentID creates the ID of the content a user submitted from url, so that
+// different users submitting the same URL get separate content
+func GenerateContentID(ownerID, url string) string {
+	if ownerID == "" {
+		return GenerateID(url)
+	}
+	return GenerateID(ownerID + "\x00" + url)
+}
+
+// LegacyContentID returns the ID content submitted by ownerID from url had before content IDs were
+// SHA-256 digests, which the ID migration records as an alias of the current ID
+func LegacyContentID(ownerID, url string) string {
+	if ownerID != "" {
+		url = ownerID + "\x00" + url
+	}
+	return fmt.Sprintf("%x", legacyHash(url))
 }
 
-// hash is a simple hash function for generating URL IDs
-func Hash(s string) int {
+// legacyHash is the rolling hash legacy content IDs were made from
+func legacyHash(s string) int {
 	h := 0
 	for _, c := range s {
 		h = int(c) + ((h << 5) - h)
 	}
 	return h
 }
+
+// GenerateQuestionID generates a ULID question ID, unique within and across quizzes
+func GenerateQuestionID() string {
+	return NewULID(time.Now())
+}
+
+// GenerateJobID generates a random 128-bit hex job ID
+func GenerateJobID() string {
+	return randomHexID()
+}
+
+// GenerateAttemptID generates a random 128-bit hex quiz attempt ID
+func GenerateAttemptID() string {
+	return randomHexID()
+}
+
+// GenerateUploadID generates a random 128-bit hex upload ID
+func GenerateUploadID() string {
+	return randomHexID()
+}
+
+// GenerateAuditID generates a ULID audit record ID, sortable by the time of the change
+func GenerateAuditID() string {
+	return NewULID(time.Now())
+}
+
+// randomHexID generates a random 128-bit hex ID
+func randomHexID() string {
+	b := make([]byte, 16)
+	if _, err := cryptorand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// ContentHash returns the hex SHA-256 digest of content, identifying a version of a source
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownATXHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	markdownSetextRule    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	markdownFence         = regexp.MustCompile("^ {0,3}(```|~~~)")
+	markdownThematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	markdownTableRule     = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)+\|?[ \t]*$`)
+	markdownQuote         = regexp.MustCompile(`^(?: {0,3}>[ \t]?)+`)
+	markdownBullet        = regexp.MustCompile(`^([ \t]*)[*+][ \t]+`)
+	markdownLinkReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*\S`)
+	markdownFrontTitle    = regexp.MustCompile(`^title:[ \t]*(.+)$`)
+
+	// markdownInline pairs the inline syntax removed from text with what replaces it, in order
+	markdownInline = []struct {
+		pattern     *regexp.Regexp
+		replacement string
+	}{
+		{regexp.MustCompile("`+([^`\n]+?)`+"), "$1"},
+		{regexp.MustCompile(`!\[([^\]]*)\](?:\([^)]*\)|\[[^\]]*\])`), "$1"},
+		{regexp.MustCompile(`\[([^\]]+)\](?:\([^)]*\)|\[[^\]]*\])`), "$1"},
+		{regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`), "$1"},
+		{regexp.MustCompile(`<!--.*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s[^>]*)?/?>`), ""},
+		{regexp.MustCompile(`\*\*([^*\n]+)\*\*|__([^_\n]+)__`), "$1$2"},
+		{regexp.MustCompile(`\*([^*\s][^*\n]*?)\*`), "$1"},
+		{regexp.MustCompile(`(^|\W)_([^_\n]+)_(\W|$)`), "$1$2$3"},
+		{regexp.MustCompile(`~~([^~\n]+)~~`), "$1"},
+	}
+	// markdownEscape matches punctuation escaped with a backslash, which is kept as text
+	markdownEscape = regexp.MustCompile(`\\[!-/:-@\[-` + "`" + `{-~]`)
+)
+
+// escapedBase offsets escaped punctuation into the private use area while inline syntax is removed
+const escapedBase = 0xE000
+
+// extractMarkdown reads the text of a Markdown document without its syntax, splitting it at its headings.
+// Links and images are replaced by their text, and code blocks are kept as text.
+func extractMarkdown(text string) *Document {
+	text = strings.ToValidUTF8(strings.ReplaceAll(text, "\r\n", "\n"), "\uFFFD")
+	lines, title := markdownFrontMatter(strings.Split(strings.TrimPrefix(text, "\ufeff"), "\n"))
+
+	var writer sectionWriter
+	var paragraph []string
+	flush := func() {
+		writer.paragraph(strings.Join(paragraph, "\n"))
+		paragraph = nil
+	}
+	heading := func(level int, text string) {
+		flush()
+		if level == 1 && title == "" {
+			title = collapseSpace(text)
+		}
+		if level <= maxSectionLevel {
+			writer.heading(text)
+		} else {
+			writer.paragraph(text)
+		}
+	}
+
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+				flush()
+			} else {
+				paragraph = append(paragraph, line)
+			}
+			continue
+		}
+		if match := markdownFence.FindStringSubmatch(line); match != nil {
+			flush()
+			fence = match[1]
+			continue
+		}
+
+		line = markdownQuote.ReplaceAllString(line, "")
+		atx := markdownATXHeading.FindStringSubmatch(line)
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case atx != nil:
+			heading(len(atx[1]), stripMarkdown(atx[2]))
+		case i+1 < len(lines) && markdownSetextRule.MatchString(lines[i+1]) && !markdownBullet.MatchString(line):
+			// The whole paragraph above an underline is the heading
+			level := 1
+			if strings.Contains(lines[i+1], "-") {
+				level = 2
+			}
+			text := strings.Join(append(paragraph, stripMarkdown(line)), " ")
+			paragraph = nil
+			heading(level, text)
+			i++
+		case markdownThematicBreak.MatchString(line):
+			flush()
+		case markdownTableRule.MatchString(line), markdownLinkReference.MatchString(line):
+			// The rows of a table are kept as lines of text
+		default:
+			paragraph = append(paragraph, stripMarkdown(markdownBullet.ReplaceAllString(line, "$1- ")))
+		}
+	}
+	flush()
+	return &Document{Title: title, Sections: writer.finish()}
+}
+
+// markdownFrontMatter returns the lines of a Markdown document after its YAML front matter, if it has any,
+// and the title the front matter sets
+func markdownFrontMatter(lines []string) ([]string, string) {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return lines, ""
+	}
+	for i := 1; i < len(lines); i++ {
+		if line := strings.TrimSpace(lines[i]); line == "---" || line == "..." {
+			title := ""
+			for _, field := range lines[1:i] {
+				if match := markdownFrontTitle.FindStringSubmatch(strings.TrimSpace(field)); match != nil {
+					title = strings.Trim(strings.TrimSpace(match[1]), `"'`)
+				}
+			}
+			return lines[i+1:], title
+		}
+	}
+	return lines, ""
+}
+
+// stripMarkdown removes the inline syntax of a line of Markdown, keeping its text
+func stripMarkdown(line string) string {
+	line = markdownEscape.ReplaceAllStringFunc(line, func(escaped string) string {
+		return string(rune(escapedBase + int(escaped[1])))
+	})
+	for _, inline := range markdownInline {
+		line = inline.pattern.ReplaceAllString(line, inline.replacement)
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= escapedBase && r < escapedBase+0x80 {
+			return r - escapedBase
+		}
+		return r
+	}, line)
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractDocument_Markdown(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile(filepath.Join("testdata", "document", "lobsters.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ExtractDocument(data, MediaTypeMarkdown)
+	if err != nil {
+		t.Fatalf("ExtractDocument: expected no error, got %v", err)
+	}
+	if doc.Title != "Lobster Notes" {
+		t.Errorf("ExtractDocument: expected the title from the front matter, got %q", doc.Title)
+	}
+	expected := []Section{
+		{Label: "", Text: "Notes from the Shediac festival."},
+		{Label: "Molting", Text: "Molting\n\nLobsters grow by molting their hard exoskeleton.\nYoung lobsters molt every year.\n\nA lobster shell\n\nSoft shells\n\n- Shells harden in weeks\n- Lobsters hide in the meantime"},
+		// A setext heading, a quote, a code block and a table
+		{Label: "Claws", Text: "Claws\n\nLobsters are right or left handed.\n\ncrusher := \"claw\"\n\n| Claw | Use |\n| Crusher | Cracks shells |"},
+	}
+	if !reflect.DeepEqual(doc.Sections, expected) {
+		t.Errorf("ExtractDocument: expected sections %q, got %q", expected, doc.Sections)
+	}
+}
+
+func TestExtractMarkdown_TitleFromHeading(t *testing.T) {
+	t.Parallel()
+	doc := extractMarkdown("\ufeffLobster Facts\r\n=============\r\n\r\nThe blue_lobster is rare, \\*one\\* in two million.\r\n")
+	if doc.Title != "Lobster Facts" {
+		t.Errorf("extractMarkdown: expected the title from the first heading, got %q", doc.Title)
+	}
+	expected := []Section{{Label: "Lobster Facts", Text: "Lobster Facts\n\nThe blue_lobster is rare, *one* in two million."}}
+	if !reflect.DeepEqual(doc.Sections, expected) {
+		t.Errorf("extractMarkdown: expected sections %q, got %q", expected, doc.Sections)
+	}
+}
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Office documents are read in both their transitional and strict namespaces, which differ in their prefix
+const (
+	wordNamespace         = "wordprocessingml"
+	drawingNamespace      = "drawingml"
+	presentationNamespace = "presentationml"
+	relationshipNamespace = "relationships"
+)
+
+// maxSectionLevel is the deepest heading level that starts a section of a DOCX or Markdown document
+const maxSectionLevel = 3
+
+// docxHeadingStyle matches the names and IDs of the built-in heading styles, e.g. "heading 2" or "Heading2"
+var docxHeadingStyle = regexp.MustCompile(`(?i)^heading ?([1-9])$`)
+
+// inNamespace reports whether name is an element or attribute of the Office namespace kind
+func inNamespace(name xml.Name, kind string) bool {
+	return strings.Contains(name.Space, kind)
+}
+
+// docxParagraph is a paragraph of a DOCX document being read
+type docxParagraph struct {
+	text  strings.Builder
+	level int // The heading level, 0 for a title, or -1 for body text
+}
+
+// extractDOCX reads the paragraphs of a Word document's body, splitting it at its headings
+func extractDOCX(archive *documentArchive) (*Document, error) {
+	body, err := readZipFile(archive, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	levels := docxStyleLevels(archive)
+
+	var writer sectionWriter
+	var stack []*docxParagraph
+	title, firstHeading := "", ""
+	inText, inProperties := false, false
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding word/document.xml: %v", ErrInvalidDocument, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if !inNamespace(t.Name, wordNamespace) {
+				continue
+			}
+			if t.Name.Local == "p" {
+				// Paragraphs nest inside text boxes, which are read as paragraphs of their own
+				stack = append(stack, &docxParagraph{level: -1})
+				continue
+			}
+			if len(stack) == 0 {
+				continue
+			}
+			paragraph := stack[len(stack)-1]
+			switch t.Name.Local {
+			case "pPr":
+				inProperties = true
+			case "pStyle":
+				if level, ok := levels[xmlAttr(t, "val")]; ok {
+					paragraph.level = level
+				} else {
+					paragraph.level = docxStyleLevel(xmlAttr(t, "val"))
+				}
+			case "outlineLvl":
+				if level, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && level < 9 && paragraph.level < 0 {
+					paragraph.level = level + 1
+				}
+			case "t":
+				inText = true
+			case "tab":
+				// Tabs in the paragraph properties are tab stops, not text
+				if !inProperties {
+					paragraph.text.WriteString("\t")
+				}
+			case "br", "cr":
+				paragraph.text.WriteString("\n")
+			}
+		case xml.EndElement:
+			if !inNamespace(t.Name, wordNamespace) || len(stack) == 0 {
+				continue
+			}
+			switch t.Name.Local {
+			case "pPr":
+				inProperties = false
+			case "t":
+				inText = false
+			case "p":
+				paragraph := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				text := paragraph.text.String()
+				switch {
+				case paragraph.level == 0:
+					title = firstNonEmpty(title, collapseSpace(text))
+					writer.paragraph(text)
+				case paragraph.level >= 1 && paragraph.level <= maxSectionLevel:
+					firstHeading = firstNonEmpty(firstHeading, collapseSpace(text))
+					writer.heading(text)
+				default:
+					writer.paragraph(text)
+				}
+			}
+		case xml.CharData:
+			if inText && len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	return &Document{
+		Title:    firstNonEmpty(officeTitle(archive), title, firstHeading),
+		Sections: writer.finish(),
+	}, nil
+}
+
+// docxStyleLevels reads the heading level of the paragraph styles of a Word document by their ID, which may be
+// localized, from the built-in style each is named after. A document without styles has none.
+func docxStyleLevels(archive *documentArchive) map[string]int {
+	var styles struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Value string `xml:"val,attr"`
+			} `xml:"name"`
+		} `xml:"style"`
+	}
+	levels := map[string]int{}
+	if err := decodeZipXML(archive, "word/styles.xml", &styles); err != nil {
+		return levels
+	}
+	for _, style := range styles.Styles {
+		if level := docxStyleLevel(style.Name.Value); level >= 0 {
+			levels[style.ID] = level
+		}
+	}
+	return levels
+}
+
+// docxStyleLevel returns the heading level of a built-in style name or ID, 0 for the title style, or -1 for
+// other styles
+func docxStyleLevel(style string) int {
+	if strings.EqualFold(style, "title") {
+		return 0
+	}
+	if match := docxHeadingStyle.FindStringSubmatch(style); match != nil {
+		level, _ := strconv.Atoi(match[1])
+		return level
+	}
+	return -1
+}
+
+// extractPPTX reads the slides of a presentation in the order they are shown, skipping hidden slides.
+// Slides are numbered by their position in the deck, hidden ones included, so the numbers match the deck.
+func extractPPTX(archive *documentArchive) (*Document, error) {
+	slideIDs, err := presentationSlides(archive)
+	if err != nil {
+		return nil, err
+	}
+	parts, _, err := readRelationships(archive, "ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Title: officeTitle(archive)}
+	for i, slideID := range slideIDs {
+		name, ok := parts[slideID]
+		if !ok {
+			return nil, fmt.Errorf("%w: slide %d has no part", ErrInvalidDocument, i+1)
+		}
+		slide, err := readSlide(archive, name)
+		if err != nil {
+			return nil, err
+		}
+		if slide.hidden {
+			continue
+		}
+		_, related, err := readRelationships(archive, name)
+		if err != nil {
+			return nil, err
+		}
+		lines := append(append([]string{}, slide.title...), slide.body...)
+		if notesName, ok := related["notesSlide"]; ok {
+			notes, err := readSlide(archive, notesName)
+			if err != nil {
+				return nil, err
+			}
+			if len(notes.notes) > 0 {
+				lines = append(append(lines, "", "Speaker notes:"), notes.notes...)
+			}
+		}
+		if doc.Title == "" && len(slide.title) > 0 {
+			doc.Title = strings.Join(slide.title, " ")
+		}
+		doc.Sections = append(doc.Sections, Section{Label: SlideLabel(i + 1), Text: strings.Join(lines, "\n")})
+	}
+	return doc, nil
+}
+
+// presentationSlides returns the relationship IDs of the slides of a presentation, in order
+func presentationSlides(archive *documentArchive) ([]string, error) {
+	data, err := readZipFile(archive, "ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	decoder := newXMLDecoder(data)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding ppt/presentation.xml: %v", ErrInvalidDocument, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "sldId" || !inNamespace(start.Name, presentationNamespace) {
+			continue
+		}
+		// The slide has a numeric id of its own besides the ID of its relationship
+		for _, a := range start.Attr {
+			if a.Name.Local == "id" && inNamespace(a.Name, relationshipNamespace) {
+				ids = append(ids, a.Value)
+			}
+		}
+	}
+}
+
+// pptxSlide is the text of a slide or notes page, one paragraph per line
+type pptxSlide struct {
+	title  []string // The paragraphs of the title placeholder
+	body   []string // The paragraphs of the other shapes and tables, except footers, dates and slide numbers
+	notes  []string // For notes pages, the paragraphs of the notes placeholder
+	hidden bool
+}
+
+// readSlide reads the text of the slide or notes page name
+func readSlide(archive *documentArchive, name string) (*pptxSlide, error) {
+	data, err := readZipFile(archive, name)
+	if err != nil {
+		return nil, err
+	}
+	var slide pptxSlide
+	var paragraph strings.Builder
+	placeholder, inText := "", false
+	decoder := newXMLDecoder(data)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return &slide, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: decoding %s: %v", ErrInvalidDocument, name, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case inNamespace(t.Name, presentationNamespace) && t.Name.Local == "sld":
+				slide.hidden = xmlAttr(t, "show") == "0"
+			case inNamespace(t.Name, presentationNamespace) && t.Name.Local == "sp":
+				placeholder = ""
+			case inNamespace(t.Name, presentationNamespace) && t.Name.Local == "ph":
+				// A placeholder without a type holds body text
+				placeholder = firstNonEmpty(xmlAttr(t, "type"), "body")
+			case inNamespace(t.Name, drawingNamespace) && t.Name.Local == "p":
+				paragraph.Reset()
+			case inNamespace(t.Name, drawingNamespace) && t.Name.Local == "t":
+				inText = true
+			case inNamespace(t.Name, drawingNamespace) && t.Name.Local == "br":
+				paragraph.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch {
+			case inNamespace(t.Name, presentationNamespace) && t.Name.Local == "sp":
+				placeholder = ""
+			case inNamespace(t.Name, drawingNamespace) && t.Name.Local == "t":
+				inText = false
+			case inNamespace(t.Name, drawingNamespace) && t.Name.Local == "p":
+				text := collapseSpace(paragraph.String())
+				if text == "" {
+					continue
+				}
+				switch placeholder {
+				case "title", "ctrTitle":
+					slide.title = append(slide.title, text)
+				case "dt", "ftr", "sldNum", "hdr":
+					// Dates, footers and slide numbers repeat on every slide
+				default:
+					slide.body = append(slide.body, text)
+				}
+				if placeholder == "body" {
+					slide.notes = append(slide.notes, text)
+				}
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+}
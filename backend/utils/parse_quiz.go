@@ -3,10 +3,13 @@ package utils
 import (
 	"fmt"
 	"read-robin/models"
+	"strconv"
+	"strings"
 )
 
-// ParseQuizResponse parses the response from the Gemini model into a Quiz struct
-func ParseQuizResponse(response map[string]interface{}, quizID string) (models.Quiz, error) {
+// ParseQuizResponse parses the response from the Gemini model into a Quiz struct, keeping the questions
+// accepted by options
+func ParseQuizResponse(response map[string]interface{}, quizID string, options models.QuizOptions) (models.Quiz, error) {
 	quizInterface, ok := response["quiz"].([]interface{})
 	if !ok {
 		return models.Quiz{}, fmt.Errorf("quiz field missing or not an array")
@@ -14,36 +17,173 @@ func ParseQuizResponse(response map[string]interface{}, quizID string) (models.Q
 
 	var questions []models.Question
 	for _, qa := range quizInterface {
-		qaMap, ok := qa.(map[string]interface{})
-		if !ok {
-			return models.Quiz{}, fmt.Errorf("error parsing question and answer pair")
+		question, err := ParseQuestion(qa)
+		if err != nil {
+			return models.Quiz{}, err
 		}
-
-		questionText, ok := qaMap["question"].(string)
-		if !ok {
-			return models.Quiz{}, fmt.Errorf("question field missing or not a string")
+		if AcceptQuestion(&question, options, len(questions)) {
+			questions = append(questions, question)
 		}
+	}
+	if len(quizInterface) > 0 && len(questions) == 0 {
+		return models.Quiz{}, ErrNoMatchingQuestions
+	}
 
-		answer, ok := qaMap["answer"].(string)
-		if !ok {
-			return models.Quiz{}, fmt.Errorf("answer field missing or not a string")
+	return models.Quiz{
+		QuizID:    quizID,
+		Questions: questions,
+	}, nil
+}
+
+// BlankMarker marks each blank in the text of a fill-in-the-blank question
+const BlankMarker = "___"
+
+// ParseQuestion parses a single question from the model's quiz array, validating the payload of its type
+// and assigning it a question ID. Questions without a type are free text.
+func ParseQuestion(qa interface{}) (models.Question, error) {
+	qaMap, ok := qa.(map[string]interface{})
+	if !ok {
+		return models.Question{}, fmt.Errorf("error parsing question and answer pair")
+	}
+
+	questionType := models.QuestionTypeFreeText
+	if rawType, present := qaMap["type"]; present {
+		if questionType, ok = rawType.(string); !ok {
+			return models.Question{}, fmt.Errorf("type field not a string")
 		}
+	}
+
+	questionText, ok := qaMap["question"].(string)
+	if !ok {
+		return models.Question{}, fmt.Errorf("question field missing or not a string")
+	}
+
+	reference, ok := qaMap["reference"].(string)
+	if !ok {
+		return models.Question{}, fmt.Errorf("reference field missing or not a string")
+	}
+
+	question := models.Question{
+		QuestionID: GenerateQuestionID(),
+		Type:       questionType,
+		Question:   questionText,
+		Reference:  reference,
+	}
 
-		reference, ok := qaMap["reference"].(string)
-		if !ok {
-			return models.Quiz{}, fmt.Errorf("reference field missing or not a string")
+	// Objective types derive the answer text from their payload when the model leaves it out
+	answer, hasAnswer := qaMap["answer"].(string)
+	var err error
+	switch questionType {
+	case models.QuestionTypeFreeText:
+		if !hasAnswer {
+			return models.Question{}, fmt.Errorf("answer field missing or not a string")
+		}
+	case models.QuestionTypeMultipleChoice:
+		question.MultipleChoice, err = parseMultipleChoice(qaMap["multiple_choice"])
+		if err == nil && !hasAnswer {
+			answer = question.MultipleChoice.Choices[question.MultipleChoice.CorrectIndex]
 		}
+	case models.QuestionTypeTrueFalse:
+		question.TrueFalse, err = parseTrueFalse(qaMap["true_false"])
+		if err == nil && !hasAnswer {
+			answer = strconv.FormatBool(question.TrueFalse.Answer)
+		}
+	case models.QuestionTypeFillInBlank:
+		question.FillInBlank, err = parseFillInBlank(qaMap["fill_in_blank"])
+		if err == nil && !hasAnswer {
+			answer = strings.Join(question.FillInBlank.Blanks, ", ")
+		}
+	default:
+		return models.Question{}, fmt.Errorf("unsupported question type %q", questionType)
+	}
+	if err != nil {
+		return models.Question{}, fmt.Errorf("%s question: %w", questionType, err)
+	}
+	question.Answer = answer
 
-		questions = append(questions, models.Question{
-			QuestionID: GenerateQuestionID(),
-			Question:   questionText,
-			Answer:     answer,
-			Reference:  reference,
-		})
+	// Questions of chunked content record their chunk; it is 0 when the content was not split
+	switch chunk := qaMap["chunk"].(type) {
+	case int:
+		question.Chunk = chunk
+	case float64:
+		question.Chunk = int(chunk)
 	}
+	return question, nil
+}
 
-	return models.Quiz{
-		QuizID:    quizID,
-		Questions: questions,
-	}, nil
+// parseMultipleChoice validates a multiple_choice payload: at least two non-empty choices and a correct index among them
+func parseMultipleChoice(raw interface{}) (*models.MultipleChoice, error) {
+	payload, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("multiple_choice field missing or not an object")
+	}
+	choices, err := parseStrings(payload["choices"], "choices")
+	if err != nil {
+		return nil, err
+	}
+	if len(choices) < 2 {
+		return nil, fmt.Errorf("expected at least 2 choices, got %d", len(choices))
+	}
+	index, ok := payload["correct_index"].(float64)
+	if !ok || index != float64(int(index)) {
+		return nil, fmt.Errorf("correct_index field missing or not an integer")
+	}
+	if index < 0 || int(index) >= len(choices) {
+		return nil, fmt.Errorf("correct_index %d out of range for %d choices", int(index), len(choices))
+	}
+	return &models.MultipleChoice{Choices: choices, CorrectIndex: int(index)}, nil
+}
+
+// parseTrueFalse validates a true_false payload
+func parseTrueFalse(raw interface{}) (*models.TrueFalse, error) {
+	payload, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("true_false field missing or not an object")
+	}
+	answer, ok := payload["answer"].(bool)
+	if !ok {
+		return nil, fmt.Errorf("answer field missing or not a boolean")
+	}
+	return &models.TrueFalse{Answer: answer}, nil
+}
+
+// parseFillInBlank validates a fill_in_blank payload: one non-empty word or phrase for each blank in the text
+func parseFillInBlank(raw interface{}) (*models.FillInBlank, error) {
+	payload, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("fill_in_blank field missing or not an object")
+	}
+	text, ok := payload["text"].(string)
+	if !ok {
+		return nil, fmt.Errorf("text field missing or not a string")
+	}
+	blanks, err := parseStrings(payload["blanks"], "blanks")
+	if err != nil {
+		return nil, err
+	}
+	count := strings.Count(text, BlankMarker)
+	if count == 0 {
+		return nil, fmt.Errorf("text has no %s blanks", BlankMarker)
+	}
+	if count != len(blanks) {
+		return nil, fmt.Errorf("text has %d blanks but %d answers", count, len(blanks))
+	}
+	return &models.FillInBlank{Text: text, Blanks: blanks}, nil
+}
+
+// parseStrings converts a JSON array of non-empty strings
+func parseStrings(raw interface{}, field string) ([]string, error) {
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s field missing or not an array", field)
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		value, ok := item.(string)
+		if !ok || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("%s[%d] is not a non-empty string", field, i)
+		}
+		values[i] = value
+	}
+	return values, nil
 }
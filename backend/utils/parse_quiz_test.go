@@ -49,7 +49,7 @@ func TestParseQuizResponse(t *testing.T) {
 		},
 	}
 
-	quiz, err := ParseQuizResponse(sampleResponseMap, "0001")
+	quiz, err := ParseQuizResponse(sampleResponseMap, "0001", models.QuizOptions{})
 	if err != nil {
 		t.Fatalf("ParseQuizResponse: expected no error, got %v", err)
 	}
@@ -71,3 +71,90 @@ func TestParseQuizResponse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseQuestion_Types(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name           string
+		qa             string
+		expectedAnswer string
+		check          func(models.Question) bool
+	}{
+		{
+			name:           "Untyped defaults to free text",
+			qa:             `{"question": "Q", "answer": "A", "reference": "R"}`,
+			expectedAnswer: "A",
+			check:          func(q models.Question) bool { return q.Type == models.QuestionTypeFreeText },
+		},
+		{
+			name:           "Multiple choice derives answer",
+			qa:             `{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a", "b", "c"], "correct_index": 2}}`,
+			expectedAnswer: "c",
+			check: func(q models.Question) bool {
+				return q.MultipleChoice != nil && len(q.MultipleChoice.Choices) == 3 && q.MultipleChoice.CorrectIndex == 2
+			},
+		},
+		{
+			name:           "True/false",
+			qa:             `{"type": "true_false", "question": "The sky is green.", "reference": "R", "true_false": {"answer": false}}`,
+			expectedAnswer: "false",
+			check:          func(q models.Question) bool { return q.TrueFalse != nil && !q.TrueFalse.Answer },
+		},
+		{
+			name:           "Fill in the blank",
+			qa:             `{"type": "fill_in_blank", "question": "Fill in the blanks.", "answer": "red, blue", "reference": "R", "fill_in_blank": {"text": "Roses are ___, violets are ___.", "blanks": ["red", "blue"]}}`,
+			expectedAnswer: "red, blue",
+			check:          func(q models.Question) bool { return q.FillInBlank != nil && len(q.FillInBlank.Blanks) == 2 },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var qa interface{}
+			if err := json.Unmarshal([]byte(tc.qa), &qa); err != nil {
+				t.Fatal(err)
+			}
+			question, err := ParseQuestion(qa)
+			if err != nil {
+				t.Fatalf("ParseQuestion: expected no error, got %v", err)
+			}
+			if question.Answer != tc.expectedAnswer {
+				t.Errorf("ParseQuestion: expected answer %q, got %q", tc.expectedAnswer, question.Answer)
+			}
+			if !tc.check(question) {
+				t.Errorf("ParseQuestion: unexpected question %+v", question)
+			}
+		})
+	}
+}
+
+func TestParseQuestion_InvalidPayloads(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name string
+		qa   string
+	}{
+		{"Unknown type", `{"type": "essay", "question": "Q", "answer": "A", "reference": "R"}`},
+		{"Free text without answer", `{"type": "free_text", "question": "Q", "reference": "R"}`},
+		{"Missing payload", `{"type": "multiple_choice", "question": "Q", "reference": "R"}`},
+		{"Single choice", `{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a"], "correct_index": 0}}`},
+		{"Index out of range", `{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a", "b"], "correct_index": 2}}`},
+		{"Fractional index", `{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a", "b"], "correct_index": 0.5}}`},
+		{"Empty choice", `{"type": "multiple_choice", "question": "Q", "reference": "R", "multiple_choice": {"choices": ["a", " "], "correct_index": 0}}`},
+		{"String boolean", `{"type": "true_false", "question": "Q", "reference": "R", "true_false": {"answer": "true"}}`},
+		{"No blanks in text", `{"type": "fill_in_blank", "question": "Q", "reference": "R", "fill_in_blank": {"text": "No blanks.", "blanks": ["x"]}}`},
+		{"Blank count mismatch", `{"type": "fill_in_blank", "question": "Q", "reference": "R", "fill_in_blank": {"text": "One ___.", "blanks": ["x", "y"]}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var qa interface{}
+			if err := json.Unmarshal([]byte(tc.qa), &qa); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseQuestion(qa); err == nil {
+				t.Errorf("ParseQuestion: expected an error")
+			}
+		})
+	}
+}
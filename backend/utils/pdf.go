@@ -0,0 +1,371 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"read-robin/models"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ErrInvalidPDF is returned by ExtractPDF for data that is not a PDF it can read
+var ErrInvalidPDF = errors.New("not a readable PDF")
+
+const (
+	// minPageLetters is the number of letters and digits below which a page that draws images counts as scanned
+	minPageLetters = 16
+	// maxUnreadableShare is the share of undecodable characters above which a page's text layer is ignored
+	maxUnreadableShare = 0.3
+	// wordGap is the horizontal gap between two strings, in thousandths of an em, read as a space between words
+	wordGap = 150
+	// paragraphGap is the line spacing, in multiples of the font size, read as the start of a paragraph
+	paragraphGap = 1.8
+	// maxFormDepth bounds the nesting of form XObjects followed while reading a page
+	maxFormDepth = 8
+)
+
+// PDFPage is the text of one page of a PDF document
+type PDFPage struct {
+	Number int    // 1-based page number
+	Text   string // Lines separated by newlines and paragraphs by blank lines
+	// Scanned is set for pages without a usable text layer, such as scanned images, whose text must be
+	// recognized by a model
+	Scanned bool
+}
+
+// PDFDocument is the text of a PDF document, extracted page by page without a model
+type PDFDocument struct {
+	Title string // From the document information, if set
+	Pages []PDFPage
+}
+
+// ExtractPDF extracts the text of every page of a PDF. Pages that draw images but have almost no text,
+// or whose text cannot be decoded, are marked as scanned and left without text.
+func ExtractPDF(data []byte) (doc *PDFDocument, err error) {
+	// The parser reports malformed input by panicking
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("%w: %v", ErrInvalidPDF, r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(pdfHeaderCompatible(data)), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPDF, err)
+	}
+
+	doc = &PDFDocument{Title: strings.TrimSpace(reader.Trailer().Key("Info").Key("Title").Text())}
+	for number := 1; number <= reader.NumPage(); number++ {
+		doc.Pages = append(doc.Pages, extractPDFPage(reader.Page(number), number))
+	}
+	if len(doc.Pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", ErrInvalidPDF)
+	}
+	return doc, nil
+}
+
+// pdfHeaderCompatible returns data with a PDF 2.0 header presented as 1.7, the newest version the parser
+// accepts; the object syntax it reads is unchanged
+func pdfHeaderCompatible(data []byte) []byte {
+	if !bytes.HasPrefix(data, []byte("%PDF-2.")) {
+		return data
+	}
+	compatible := bytes.Clone(data)
+	copy(compatible, "%PDF-1.7")
+	return compatible
+}
+
+// ScannedPages returns the numbers of the pages marked as scanned
+func (d *PDFDocument) ScannedPages() []int {
+	var numbers []int
+	for _, page := range d.Pages {
+		if page.Scanned {
+			numbers = append(numbers, page.Number)
+		}
+	}
+	return numbers
+}
+
+// Content joins the text of the pages, separated by blank lines, and returns it with an anchor citing
+// each page, e.g. "p. 12", at the offset where its text starts. Pages without text are left out.
+func (d *PDFDocument) Content() (string, []models.Anchor) {
+	var text strings.Builder
+	var anchors []models.Anchor
+	for _, page := range d.Pages {
+		pageText := strings.TrimSpace(page.Text)
+		if pageText == "" {
+			continue
+		}
+		if text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+		anchors = append(anchors, models.Anchor{Offset: text.Len(), Label: PageLabel(page.Number)})
+		text.WriteString(pageText)
+	}
+	return text.String(), anchors
+}
+
+// PageLabel returns how questions cite a page
+func PageLabel(number int) string {
+	return "p. " + strconv.Itoa(number)
+}
+
+// extractPDFPage reads the text of a page, marking it as scanned when its text layer is missing or
+// unreadable. A page that cannot be parsed is left to the model as well.
+func extractPDFPage(page pdf.Page, number int) (result PDFPage) {
+	result.Number = number
+	defer func() {
+		if r := recover(); r != nil {
+			result = PDFPage{Number: number, Scanned: true}
+		}
+	}()
+
+	w := &pdfTextWriter{fonts: make(map[string]*pdfFont)}
+	w.walk(page.V.Key("Contents"), page.Resources(), 0)
+	text := w.String()
+
+	letters, unreadable, total := 0, 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			letters++
+		case r == unicode.ReplacementChar || unicode.Is(unicode.Co, r) || unicode.IsControl(r) && r != '\n':
+			unreadable++
+		}
+		if !unicode.IsSpace(r) {
+			total++
+		}
+	}
+	if total > 0 && float64(unreadable)/float64(total) > maxUnreadableShare {
+		return PDFPage{Number: number, Scanned: true}
+	}
+	if letters < minPageLetters && w.images {
+		return PDFPage{Number: number, Scanned: true}
+	}
+	result.Text = text
+	return result
+}
+
+// pdfTextWriter rebuilds the lines and paragraphs of a page from its text operators. PDF positions text
+// rather than spacing it, so spaces and line breaks are inferred from where each string is drawn.
+type pdfTextWriter struct {
+	fonts  map[string]*pdfFont
+	images bool // The page draws images, inline or as XObjects
+
+	text     strings.Builder
+	font     *pdfFont
+	fontSize float64
+	leading  float64
+	line     [6]float64 // The text line matrix
+	x        float64    // The horizontal text position
+	lastX    float64    // Where the text written last ended
+	lastY    float64    // The line of the text written last
+	started  bool
+}
+
+// pdfFont is a font of a page with its decoding
+type pdfFont struct {
+	font     pdf.Font
+	encoding pdf.TextEncoding
+	widths   bool // The font lists the widths of its single-byte codes
+}
+
+// String returns the text written, with runs of spaces collapsed and words hyphenated across lines joined
+func (w *pdfTextWriter) String() string {
+	lines := strings.Split(w.text.String(), "\n")
+	var out strings.Builder
+	blank := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.Join(strings.Fields(lines[i]), " ")
+		if line == "" {
+			blank = out.Len() > 0
+			continue
+		}
+		if out.Len() > 0 {
+			if blank {
+				out.WriteString("\n\n")
+			} else {
+				out.WriteString("\n")
+			}
+		}
+		blank = false
+		// Join a word hyphenated at the end of the line with its end on the next
+		for strings.HasSuffix(line, "-") && i+1 < len(lines) {
+			next := strings.Fields(lines[i+1])
+			if len(next) == 0 || !unicode.IsLower([]rune(next[0])[0]) {
+				break
+			}
+			line = strings.TrimSuffix(line, "-") + strings.Join(next, " ")
+			i++
+		}
+		out.WriteString(line)
+	}
+	return out.String()
+}
+
+// walk interprets a content stream, or an array of them, drawn with resources
+func (w *pdfTextWriter) walk(contents, resources pdf.Value, depth int) {
+	if contents.Kind() == pdf.Array {
+		for i := 0; i < contents.Len(); i++ {
+			w.walk(contents.Index(i), resources, depth)
+		}
+		return
+	}
+	if contents.Kind() != pdf.Stream {
+		return
+	}
+
+	pdf.Interpret(contents, func(stk *pdf.Stack, op string) {
+		args := make([]pdf.Value, stk.Len())
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = stk.Pop()
+		}
+		number := func(i int) float64 {
+			if i < len(args) {
+				return args[i].Float64()
+			}
+			return 0
+		}
+
+		switch op {
+		case "BT":
+			w.line = [6]float64{1, 0, 0, 1, 0, 0}
+			w.x = 0
+		case "Tf":
+			if len(args) == 2 {
+				w.font = w.loadFont(resources, args[0].Name())
+				w.fontSize = math.Abs(args[1].Float64())
+			}
+		case "TL":
+			w.leading = number(0)
+		case "TD":
+			w.leading = -number(1)
+			w.move(number(0), number(1))
+		case "Td":
+			w.move(number(0), number(1))
+		case "Tm":
+			if len(args) == 6 {
+				for i := range w.line {
+					w.line[i] = args[i].Float64()
+				}
+				w.x = w.line[4]
+			}
+		case "T*":
+			w.move(0, -w.leading)
+		case "'", "\"":
+			w.move(0, -w.leading)
+			if len(args) > 0 {
+				w.show(args[len(args)-1].RawString())
+			}
+		case "Tj":
+			if len(args) == 1 {
+				w.show(args[0].RawString())
+			}
+		case "TJ":
+			if len(args) == 1 {
+				for i := 0; i < args[0].Len(); i++ {
+					item := args[0].Index(i)
+					if item.Kind() == pdf.String {
+						w.show(item.RawString())
+					} else {
+						// Adjustments are in thousandths of an em, positive values moving left
+						w.x -= item.Float64() / 1000 * w.fontSize * w.line[0]
+					}
+				}
+			}
+		case "BI":
+			w.images = true
+		case "Do":
+			if len(args) == 1 {
+				w.drawXObject(resources.Key("XObject").Key(args[0].Name()), resources, depth)
+			}
+		}
+	})
+}
+
+// drawXObject notes images and reads the text of form XObjects, which have their own resources
+func (w *pdfTextWriter) drawXObject(xobject, resources pdf.Value, depth int) {
+	switch xobject.Key("Subtype").Name() {
+	case "Image":
+		w.images = true
+	case "Form":
+		if depth >= maxFormDepth {
+			return
+		}
+		if own := xobject.Key("Resources"); own.Kind() == pdf.Dict {
+			resources = own
+		}
+		w.walk(xobject, resources, depth+1)
+	}
+}
+
+// loadFont returns the named font, reading it once per page
+func (w *pdfTextWriter) loadFont(resources pdf.Value, name string) *pdfFont {
+	if font, ok := w.fonts[name]; ok {
+		return font
+	}
+	font := &pdfFont{font: pdf.Font{V: resources.Key("Font").Key(name)}}
+	font.encoding = font.font.Encoder()
+	font.widths = font.font.V.Key("Widths").Len() > 0 && font.font.V.Key("Subtype").Name() != "Type0"
+	w.fonts[name] = font
+	return font
+}
+
+// advance returns the width of raw drawn in font, in thousandths of an em. Fonts without widths, such as
+// composite fonts, are assumed to be half an em wide per character.
+func (f *pdfFont) advance(raw, decoded string) float64 {
+	if !f.widths {
+		return 500 * float64(len([]rune(decoded)))
+	}
+	width := 0.0
+	for i := 0; i < len(raw); i++ {
+		width += f.font.Width(int(raw[i]))
+	}
+	return width
+}
+
+// move moves the text position to the start of the next line offset by tx and ty
+func (w *pdfTextWriter) move(tx, ty float64) {
+	w.line[4] += tx*w.line[0] + ty*w.line[2]
+	w.line[5] += tx*w.line[1] + ty*w.line[3]
+	w.x = w.line[4]
+}
+
+// show writes the text of a string operand, starting a new line, or a paragraph after a wide gap, if it is
+// drawn on another line, and separating it with a space if it is drawn apart from the text before it
+func (w *pdfTextWriter) show(raw string) {
+	if w.font == nil {
+		return
+	}
+	size := w.fontSize * math.Abs(w.line[0])
+	if lineSize := w.fontSize * math.Abs(w.line[3]); lineSize > size {
+		size = lineSize
+	}
+	if size == 0 {
+		size = 1
+	}
+
+	y := w.line[5]
+	switch {
+	case !w.started:
+		w.started = true
+	case math.Abs(y-w.lastY) > size/2:
+		w.text.WriteByte('\n')
+		if math.Abs(y-w.lastY) > size*paragraphGap {
+			w.text.WriteByte('\n')
+		}
+	case (w.x-w.lastX)*1000/size > wordGap:
+		w.text.WriteByte(' ')
+	}
+
+	decoded := w.font.encoding.Decode(raw)
+	w.text.WriteString(decoded)
+	w.x += w.font.advance(raw, decoded) / 1000 * w.fontSize * w.line[0]
+	w.lastX, w.lastY = w.x, y
+}
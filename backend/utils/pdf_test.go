@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+// readPDFFixture reads a PDF from testdata/pdf
+func readPDFFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "pdf", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExtractPDF(t *testing.T) {
+	t.Parallel()
+	doc, err := ExtractPDF(readPDFFixture(t, "pages.pdf"))
+	if err != nil {
+		t.Fatalf("ExtractPDF: expected no error, got %v", err)
+	}
+	if doc.Title != "A Field Guide to Lobsters" {
+		t.Errorf("ExtractPDF: expected the title from the document information, got %q", doc.Title)
+	}
+
+	expected := []PDFPage{
+		// Two content streams, a kerned TJ array and a word hyphenated across lines
+		{Number: 1, Text: "Lobster Biology\n\nLobsters grow by molting\ntheir hard exoskeleton, which they shed\nevery year when young."},
+		// A composite font decoded through its ToUnicode map
+		{Number: 2, Text: "Shediac hosts a giant lobster statue.\nIt weighs ninety tonnes."},
+		{Number: 3, Text: "Some lobsters live for over a century.\n\nBlue lobsters are one in two million."},
+	}
+	if !reflect.DeepEqual(doc.Pages, expected) {
+		t.Errorf("ExtractPDF: expected pages %+v, got %+v", expected, doc.Pages)
+	}
+	if scanned := doc.ScannedPages(); len(scanned) != 0 {
+		t.Errorf("ScannedPages: expected none, got %v", scanned)
+	}
+
+	text, anchors := doc.Content()
+	expectedAnchors := []models.Anchor{{Offset: 0, Label: "p. 1"}, {Offset: 106, Label: "p. 2"}, {Offset: 170, Label: "p. 3"}}
+	if !reflect.DeepEqual(anchors, expectedAnchors) {
+		t.Errorf("Content: expected anchors %v, got %v", expectedAnchors, anchors)
+	}
+	for i, anchor := range anchors {
+		if !strings.HasPrefix(text[anchor.Offset:], doc.Pages[i].Text) {
+			t.Errorf("Content: expected %s to start at offset %d, got %q", anchor.Label, anchor.Offset, text[anchor.Offset:])
+		}
+	}
+}
+
+func TestExtractPDF_ScannedPages(t *testing.T) {
+	t.Parallel()
+	doc, err := ExtractPDF(readPDFFixture(t, "scanned.pdf"))
+	if err != nil {
+		t.Fatalf("ExtractPDF: expected no error, got %v", err)
+	}
+	if scanned := doc.ScannedPages(); !reflect.DeepEqual(scanned, []int{2}) {
+		t.Fatalf("ScannedPages: expected the image-only page 2, got %v", scanned)
+	}
+
+	// Scanned pages are left out of the content until they are transcribed
+	text, anchors := doc.Content()
+	if text != "Lobsters have ten legs and two claws.\n\nFemale lobsters carry their eggs for a year." {
+		t.Errorf("Content: expected only the text pages, got %q", text)
+	}
+	if len(anchors) != 2 || anchors[1].Label != "p. 3" {
+		t.Errorf("Content: expected anchors for pages 1 and 3, got %v", anchors)
+	}
+
+	doc.Pages[1].Text = "Lobsters were once fed to prisoners."
+	text, anchors = doc.Content()
+	if Cite(text, anchors, "fed to prisoners") != "p. 2" {
+		t.Errorf("Content: expected a transcribed page to be cited, got %q and %v", text, anchors)
+	}
+}
+
+func TestExtractPDF_Invalid(t *testing.T) {
+	t.Parallel()
+	pages := readPDFFixture(t, "pages.pdf")
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"html":      []byte("<html><body>Not a PDF</body></html>"),
+		"truncated": pages[:len(pages)/2],
+	} {
+		if _, err := ExtractPDF(data); !errors.Is(err, ErrInvalidPDF) {
+			t.Errorf("ExtractPDF(%s): expected ErrInvalidPDF, got %v", name, err)
+		}
+	}
+}
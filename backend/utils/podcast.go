@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// ErrInvalidFeed is returned by ParsePodcast for documents that are not RSS or Atom feeds
+var ErrInvalidFeed = errors.New("not an RSS or Atom feed")
+
+// Podcast is a podcast feed and its episodes that have media
+type Podcast struct {
+	Title    string
+	Author   string
+	Episodes []Episode // Newest first
+}
+
+// Episode is an episode of a podcast, with the audio or video file it is published as
+type Episode struct {
+	ID        string // The episode's GUID, or its media URL if it has none
+	Title     string
+	Published string  // RFC 3339, or empty if the feed gives no readable date
+	Duration  float64 // Seconds, or 0 if the feed does not say
+	MediaURL  string
+	MediaType string // The media type the feed declares for MediaURL, if any
+}
+
+// FindEpisode returns the episode with id, or the newest episode if id is empty
+func (p *Podcast) FindEpisode(id string) (*Episode, bool) {
+	for i := range p.Episodes {
+		if id == "" || p.Episodes[i].ID == id {
+			return &p.Episodes[i], true
+		}
+	}
+	return nil, false
+}
+
+// podcastFeed holds the elements of both RSS and Atom feeds; XMLName tells which one was read. Fields in the
+// iTunes namespace come first, so that elements such as itunes:title are not read as their RSS namesakes.
+type podcastFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		ITunesTitle string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+		Author      string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		Title       string `xml:"title"`
+		Items       []struct {
+			ITunesTitle string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+			Duration    string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+			Title       string `xml:"title"`
+			GUID        string `xml:"guid"`
+			PubDate     string `xml:"pubDate"`
+			Enclosure   struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+	Title   string `xml:"title"`
+	Author  string `xml:"author>name"`
+	Entries []struct {
+		ID        string `xml:"id"`
+		Title     string `xml:"title"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+		Links     []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// ParsePodcast parses an RSS or Atom podcast feed. Episodes are read from RSS items with an enclosure and
+// Atom entries with an enclosure link; entries without media cannot be quizzed and are skipped.
+func ParsePodcast(data []byte) (*Podcast, error) {
+	var feed podcastFeed
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	// Feeds in the wild use HTML entities such as &nbsp; in titles
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFeed, err)
+	}
+
+	type datedEpisode struct {
+		Episode
+		published time.Time
+	}
+	var podcast Podcast
+	var episodes []datedEpisode
+	switch feed.XMLName.Local {
+	case "rss":
+		podcast.Title, podcast.Author = firstNonEmpty(feed.Channel.Title, feed.Channel.ITunesTitle), firstNonEmpty(feed.Channel.Author)
+		for _, item := range feed.Channel.Items {
+			if item.Enclosure.URL == "" {
+				continue
+			}
+			episode := datedEpisode{Episode: Episode{
+				ID:        firstNonEmpty(item.GUID, item.Enclosure.URL),
+				Title:     firstNonEmpty(item.Title, item.ITunesTitle),
+				MediaURL:  strings.TrimSpace(item.Enclosure.URL),
+				MediaType: strings.ToLower(item.Enclosure.Type),
+			}}
+			episode.Duration, _ = ParseTimestamp(item.Duration)
+			episode.published = parseFeedDate(item.PubDate)
+			episodes = append(episodes, episode)
+		}
+	case "feed":
+		podcast.Title, podcast.Author = firstNonEmpty(feed.Title), firstNonEmpty(feed.Author)
+		for _, entry := range feed.Entries {
+			for _, link := range entry.Links {
+				if link.Rel != "enclosure" || link.Href == "" {
+					continue
+				}
+				episode := datedEpisode{Episode: Episode{
+					ID:        firstNonEmpty(entry.ID, link.Href),
+					Title:     firstNonEmpty(entry.Title),
+					MediaURL:  strings.TrimSpace(link.Href),
+					MediaType: strings.ToLower(link.Type),
+				}}
+				episode.published = parseFeedDate(firstNonEmpty(entry.Published, entry.Updated))
+				episodes = append(episodes, episode)
+				break
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: root element %q", ErrInvalidFeed, feed.XMLName.Local)
+	}
+
+	// Feeds usually list the newest episode first, but not all do; undated episodes keep their order at the end
+	sort.SliceStable(episodes, func(i, j int) bool {
+		return episodes[j].published.IsZero() && !episodes[i].published.IsZero() ||
+			episodes[i].published.After(episodes[j].published)
+	})
+	for _, episode := range episodes {
+		if !episode.published.IsZero() {
+			episode.Published = episode.published.UTC().Format(time.RFC3339)
+		}
+		podcast.Episodes = append(podcast.Episodes, episode.Episode)
+	}
+	return &podcast, nil
+}
+
+// feedDateLayouts are the date formats found in RSS and Atom feeds, which do not always follow their specs
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02",
+}
+
+// parseFeedDate parses a feed's publication date, returning the zero time if it cannot be read
+func parseFeedDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readPodcastFixture reads a feed from testdata/podcast
+func readPodcastFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "podcast", name))
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	return data
+}
+
+func TestParsePodcast_RSS(t *testing.T) {
+	t.Parallel()
+	podcast, err := ParsePodcast(readPodcastFixture(t, "rss.xml"))
+	if err != nil {
+		t.Fatalf("ParsePodcast: expected no error, got %v", err)
+	}
+	if podcast.Title != "Shediac Science" || podcast.Author != "Ada Lovelace" {
+		t.Errorf("ParsePodcast: unexpected title and author %q, %q", podcast.Title, podcast.Author)
+	}
+	expected := []Episode{
+		{ID: "episode-2", Title: "Why Lobsters Molt", Published: "2024-07-08T09:00:00Z", Duration: 3723,
+			MediaURL: "https://podcasts.example.com/episode-2.mp4", MediaType: "video/mp4"},
+		{ID: "episode-1", Title: "Lobster Festival Recap", Published: "2024-07-01T12:00:00Z", Duration: 2730,
+			MediaURL: "https://podcasts.example.com/episode-1.mp3", MediaType: "audio/mpeg"},
+		{ID: "https://podcasts.example.com/extra.mp3", Title: "Undated Extra", Duration: 600,
+			MediaURL: "https://podcasts.example.com/extra.mp3", MediaType: "audio/mpeg"},
+	}
+	if !reflect.DeepEqual(podcast.Episodes, expected) {
+		t.Errorf("ParsePodcast: expected episodes %+v, got %+v", expected, podcast.Episodes)
+	}
+
+	if episode, ok := podcast.FindEpisode(""); !ok || episode.ID != "episode-2" {
+		t.Errorf("FindEpisode: expected the newest episode, got %+v", episode)
+	}
+	if episode, ok := podcast.FindEpisode("episode-1"); !ok || episode.Title != "Lobster Festival Recap" {
+		t.Errorf("FindEpisode: expected episode-1, got %+v", episode)
+	}
+	if _, ok := podcast.FindEpisode("episode-9"); ok {
+		t.Errorf("FindEpisode: expected no episode for an unknown ID")
+	}
+}
+
+func TestParsePodcast_Atom(t *testing.T) {
+	t.Parallel()
+	podcast, err := ParsePodcast(readPodcastFixture(t, "atom.xml"))
+	if err != nil {
+		t.Fatalf("ParsePodcast: expected no error, got %v", err)
+	}
+	expected := &Podcast{Title: "Crustacean Weekly", Author: "Ben Ng", Episodes: []Episode{
+		{ID: "urn:uuid:episode-a", Title: "Shell Shock", Published: "2024-03-01T12:00:00Z",
+			MediaURL: "https://crustaceans.example.com/shell-shock.m4a", MediaType: "audio/mp4"},
+	}}
+	if !reflect.DeepEqual(podcast, expected) {
+		t.Errorf("ParsePodcast: expected %+v, got %+v", expected, podcast)
+	}
+}
+
+func TestParsePodcast_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, data := range []string{"", "<html><body>Not a feed</body></html>", "Lobsters have ten legs."} {
+		if _, err := ParsePodcast([]byte(data)); !errors.Is(err, ErrInvalidFeed) {
+			t.Errorf("ParsePodcast(%q): expected ErrInvalidFeed, got %v", data, err)
+		}
+	}
+}
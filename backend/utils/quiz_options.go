@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"read-robin/models"
+)
+
+// Limits on the quiz options accepted from users
+const (
+	MaxQuizQuestions  = 50
+	maxQuizTopics     = 10
+	maxQuizTopicBytes = 200
+)
+
+// ErrNoMatchingQuestions is returned when every generated question is rejected by the quiz options
+var ErrNoMatchingQuestions = errors.New("no generated questions matched the quiz options")
+
+// questionTypes lists the question types users may ask for
+var questionTypes = map[string]bool{
+	models.QuestionTypeFreeText:       true,
+	models.QuestionTypeMultipleChoice: true,
+	models.QuestionTypeTrueFalse:      true,
+	models.QuestionTypeFillInBlank:    true,
+}
+
+// ValidateQuizOptions checks that options are within the limits accepted from users
+func ValidateQuizOptions(options models.QuizOptions) error {
+	if options.NumQuestions < 0 || options.NumQuestions > MaxQuizQuestions {
+		return fmt.Errorf("num_questions must be from 1 to %d, or 0 for the default", MaxQuizQuestions)
+	}
+	for _, questionType := range options.QuestionTypes {
+		if !questionTypes[questionType] {
+			return fmt.Errorf("unsupported question type %q", questionType)
+		}
+	}
+	for field, topics := range map[string][]string{"focus_topics": options.FocusTopics, "avoid_topics": options.AvoidTopics} {
+		if len(topics) > maxQuizTopics {
+			return fmt.Errorf("%s has more than %d topics", field, maxQuizTopics)
+		}
+		for _, topic := range topics {
+			if strings.TrimSpace(topic) == "" || len(topic) > maxQuizTopicBytes {
+				return fmt.Errorf("%s must be non-empty and at most %d bytes", field, maxQuizTopicBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptQuestion applies options to a parsed question, reporting whether it belongs in a quiz already
+// holding count questions. Questions beyond the requested number, of types not allowed or mentioning an
+// avoided topic are rejected, and the reference is removed when options exclude references.
+func AcceptQuestion(question *models.Question, options models.QuizOptions, count int) bool {
+	if options.NumQuestions > 0 && count >= options.NumQuestions {
+		return false
+	}
+	if len(options.QuestionTypes) > 0 {
+		questionType := question.Type
+		if questionType == "" {
+			questionType = models.QuestionTypeFreeText
+		}
+		allowed := false
+		for _, t := range options.QuestionTypes {
+			allowed = allowed || t == questionType
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, topic := range options.AvoidTopics {
+		if mentionsTopic(question, topic) {
+			return false
+		}
+	}
+	if !options.ReferencesIncluded() {
+		question.Reference = ""
+	}
+	return true
+}
+
+// mentionsTopic reports whether the text shown to the learner or the answer of question mentions topic
+// as a whole word or phrase, ignoring case
+func mentionsTopic(question *models.Question, topic string) bool {
+	pattern, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(strings.TrimSpace(topic)) + `\b`)
+	if err != nil {
+		return false
+	}
+	texts := []string{question.Question, question.Answer}
+	if question.MultipleChoice != nil {
+		texts = append(texts, question.MultipleChoice.Choices...)
+	}
+	if question.FillInBlank != nil {
+		texts = append(texts, question.FillInBlank.Text)
+	}
+	for _, text := range texts {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
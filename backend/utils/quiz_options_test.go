@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestValidateQuizOptions(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		options models.QuizOptions
+		valid   bool
+	}{
+		{"defaults", models.QuizOptions{}, true},
+		{"all options", models.QuizOptions{NumQuestions: 15, QuestionTypes: []string{"true_false", "multiple_choice"}, FocusTopics: []string{"Chapter 3"}, AvoidTopics: []string{"dates"}}, true},
+		{"negative count", models.QuizOptions{NumQuestions: -1}, false},
+		{"too many questions", models.QuizOptions{NumQuestions: MaxQuizQuestions + 1}, false},
+		{"unknown type", models.QuizOptions{QuestionTypes: []string{"essay"}}, false},
+		{"empty topic", models.QuizOptions{FocusTopics: []string{" "}}, false},
+		{"long topic", models.QuizOptions{AvoidTopics: []string{strings.Repeat("a", maxQuizTopicBytes+1)}}, false},
+		{"too many topics", models.QuizOptions{FocusTopics: strings.Split("a b c d e f g h i j k", " ")}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateQuizOptions(tc.options)
+			if tc.valid && err != nil {
+				t.Errorf("ValidateQuizOptions: expected no error, got %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Error("ValidateQuizOptions: expected an error, got nil")
+			}
+		})
+	}
+}
+
+const optionsResponse = `
+{
+	"quiz": [
+		{"type": "free_text", "question": "Why do lobsters molt?", "answer": "To grow.", "reference": "Lobsters molt to grow."},
+		{"type": "true_false", "question": "Lobsters were caught in 1850.", "answer": "true", "reference": "The first lobsters were caught in 1850.", "true_false": {"answer": true}},
+		{"type": "multiple_choice", "question": "How many legs do lobsters have?", "answer": "Ten", "reference": "Lobsters have ten legs.", "multiple_choice": {"choices": ["Eight", "Ten"], "correct_index": 1}},
+		{"type": "true_false", "question": "Lobsters live in the ocean.", "answer": "true", "reference": "Lobsters live on the ocean floor.", "true_false": {"answer": true}}
+	]
+}
+`
+
+func TestParseQuizResponse_Options(t *testing.T) {
+	t.Parallel()
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(optionsResponse), &response); err != nil {
+		t.Fatalf("Failed to unmarshal sample response: %v", err)
+	}
+	noReferences := false
+
+	testCases := []struct {
+		name      string
+		options   models.QuizOptions
+		questions []string
+	}{
+		{"defaults", models.QuizOptions{}, []string{"Why do lobsters molt?", "Lobsters were caught in 1850.", "How many legs do lobsters have?", "Lobsters live in the ocean."}},
+		{"count", models.QuizOptions{NumQuestions: 2}, []string{"Why do lobsters molt?", "Lobsters were caught in 1850."}},
+		{"types", models.QuizOptions{QuestionTypes: []string{"true_false"}}, []string{"Lobsters were caught in 1850.", "Lobsters live in the ocean."}},
+		{"types and count", models.QuizOptions{NumQuestions: 1, QuestionTypes: []string{"multiple_choice", "true_false"}}, []string{"Lobsters were caught in 1850."}},
+		{"avoided topic in question", models.QuizOptions{AvoidTopics: []string{"OCEAN"}}, []string{"Why do lobsters molt?", "Lobsters were caught in 1850.", "How many legs do lobsters have?"}},
+		{"avoided topic in answer", models.QuizOptions{AvoidTopics: []string{"ten", "1850"}}, []string{"Why do lobsters molt?", "Lobsters live in the ocean."}},
+		{"avoided topic as part of a word", models.QuizOptions{AvoidTopics: []string{"leg"}}, []string{"Why do lobsters molt?", "Lobsters were caught in 1850.", "How many legs do lobsters have?", "Lobsters live in the ocean."}},
+		{"no references", models.QuizOptions{NumQuestions: 1, IncludeReferences: &noReferences}, []string{"Why do lobsters molt?"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			quiz, err := ParseQuizResponse(response, "0001", tc.options)
+			if err != nil {
+				t.Fatalf("ParseQuizResponse: expected no error, got %v", err)
+			}
+			var questions []string
+			for _, question := range quiz.Questions {
+				questions = append(questions, question.Question)
+				if tc.options.ReferencesIncluded() != (question.Reference != "") {
+					t.Errorf("ParseQuizResponse: unexpected reference %q", question.Reference)
+				}
+			}
+			if strings.Join(questions, "|") != strings.Join(tc.questions, "|") {
+				t.Errorf("ParseQuizResponse: expected questions %q, got %q", tc.questions, questions)
+			}
+		})
+	}
+
+	_, err := ParseQuizResponse(response, "0001", models.QuizOptions{QuestionTypes: []string{"fill_in_blank"}})
+	if !errors.Is(err, ErrNoMatchingQuestions) {
+		t.Errorf("ParseQuizResponse: expected ErrNoMatchingQuestions, got %v", err)
+	}
+}
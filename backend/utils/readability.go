@@ -0,0 +1,591 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoArticle is returned by ExtractArticle when a page has no readable text, such as pages rendered by JavaScript
+var ErrNoArticle = errors.New("no readable article found")
+
+// Article is the main content of a web page and its metadata, extracted without a model
+type Article struct {
+	Title        string
+	Byline       string
+	Published    string // As published by the page, usually RFC 3339
+	CanonicalURL string
+	Headings     []string
+	Text         string // Headings and paragraphs separated by blank lines, list items prefixed with "- "
+}
+
+const (
+	// minParagraphLength is the length below which a paragraph does not count towards its container's score
+	minParagraphLength = 25
+	// maxLinkDensity is the share of link text above which a block inside the article is treated as navigation
+	maxLinkDensity = 0.5
+	// maxMetadataLength is the length above which an element marked as a byline is kept as article text
+	maxMetadataLength = 100
+)
+
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|modal|nav|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tags|toolbar|tweet|twitter|\bads?\b|advert`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow|story|entry|post|text`)
+	positiveHint       = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	metadataHint       = regexp.MustCompile(`(?i)byline|author|dateline|editsection|entry-meta|entry-footer|post-meta|posted-on`)
+	negativeHint       = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget|byline|author`)
+)
+
+// ignoredElements never contain article text
+var ignoredElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Iframe: true,
+	atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Embed: true, atom.Form: true,
+	atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Nav: true, atom.Aside: true, atom.Footer: true, atom.Header: true, atom.Dialog: true,
+}
+
+// blockElements start a new line of article text
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+	atom.Table: true, atom.Tr: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Br: true, atom.Hr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// ExtractArticle extracts the main article text and metadata from htmlText, in the manner of Readability.
+// pageURL resolves a relative canonical URL.
+func ExtractArticle(htmlText, pageURL string) (*Article, error) {
+	doc, err := nethtml.Parse(strings.NewReader(htmlText))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML: %w", err)
+	}
+
+	article := &Article{}
+	readMetadata(doc, pageURL, article)
+
+	pruneUnlikely(doc)
+	root := topCandidate(doc)
+	if root == nil {
+		return nil, ErrNoArticle
+	}
+
+	var r articleRenderer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+	r.finish()
+	if len(r.blocks) > 0 && r.blocks[0].heading {
+		// A leading heading is usually the article title
+		if article.Title == "" {
+			article.Title = r.blocks[0].text
+		}
+		if strings.HasPrefix(article.Title, r.blocks[0].text) {
+			r.blocks = r.blocks[1:]
+		}
+	}
+	article.Text = r.text()
+	article.Headings = r.headings()
+	if article.Text == "" {
+		return nil, ErrNoArticle
+	}
+	return article, nil
+}
+
+// CleanHTML renders the article as minimal HTML, for models that expect an HTML page
+func (a *Article) CleanHTML() string {
+	var b strings.Builder
+	b.WriteString("<html><head><title>")
+	b.WriteString(html.EscapeString(a.Title))
+	b.WriteString("</title>")
+	if a.CanonicalURL != "" {
+		fmt.Fprintf(&b, `<link rel="canonical" href="%s">`, html.EscapeString(a.CanonicalURL))
+	}
+	b.WriteString("</head><body>")
+
+	headings := make(map[string]bool, len(a.Headings))
+	for _, heading := range a.Headings {
+		headings[heading] = true
+	}
+	for _, block := range strings.Split(a.Text, "\n\n") {
+		tag := "p"
+		if headings[block] {
+			tag = "h2"
+		}
+		fmt.Fprintf(&b, "<%s>%s</%s>", tag, html.EscapeString(block), tag)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+// readMetadata fills the title, byline, publish date and canonical URL of article from the document head,
+// Open Graph tags and JSON-LD
+func readMetadata(doc *nethtml.Node, pageURL string, article *Article) {
+	meta := make(map[string]string)
+	var documentTitle, canonical string
+	var jsonLD []string
+
+	walk(doc, func(n *nethtml.Node) bool {
+		switch n.DataAtom {
+		case atom.Title:
+			if documentTitle == "" {
+				documentTitle = textContent(n)
+			}
+		case atom.Meta:
+			key := strings.ToLower(attr(n, "property"))
+			if key == "" {
+				key = strings.ToLower(attr(n, "name"))
+			}
+			if key == "" {
+				key = strings.ToLower(attr(n, "itemprop"))
+			}
+			if content := strings.TrimSpace(attr(n, "content")); key != "" && content != "" {
+				if _, ok := meta[key]; !ok {
+					meta[key] = content
+				}
+			}
+		case atom.Link:
+			if canonical == "" && strings.EqualFold(attr(n, "rel"), "canonical") {
+				canonical = attr(n, "href")
+			}
+		case atom.Script:
+			if strings.EqualFold(attr(n, "type"), "application/ld+json") {
+				jsonLD = append(jsonLD, textContent(n))
+			}
+		case atom.Time:
+			if _, ok := meta["time"]; !ok && attr(n, "datetime") != "" {
+				meta["time"] = attr(n, "datetime")
+			}
+		}
+		return true
+	})
+
+	var ld linkedData
+	for _, data := range jsonLD {
+		if ld.parse(data) {
+			break
+		}
+	}
+
+	article.Title = firstNonEmpty(meta["og:title"], ld.headline, meta["twitter:title"], collapseSpace(documentTitle))
+	article.Byline = firstNonEmpty(ld.author, meta["author"], meta["article:author"], meta["parsely-author"], meta["dc.creator"])
+	article.Published = firstNonEmpty(ld.published, meta["article:published_time"], meta["datepublished"],
+		meta["parsely-pub-date"], meta["dc.date"], meta["date"], meta["time"])
+	article.CanonicalURL = resolveURL(pageURL, firstNonEmpty(canonical, meta["og:url"], ld.url))
+}
+
+// linkedData holds the fields of a schema.org Article read from JSON-LD
+type linkedData struct {
+	headline, author, published, url string
+}
+
+// parse reads the first Article-like object in data, reporting whether one was found
+func (ld *linkedData) parse(data string) bool {
+	var value any
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return false
+	}
+	object := findArticleObject(value)
+	if object == nil {
+		return false
+	}
+	ld.headline, _ = object["headline"].(string)
+	ld.published, _ = object["datePublished"].(string)
+	ld.url, _ = object["url"].(string)
+	ld.author = personNames(object["author"])
+	return true
+}
+
+// findArticleObject returns the first JSON-LD object whose @type names an article, searching arrays and @graph
+func findArticleObject(value any) map[string]any {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if object := findArticleObject(item); object != nil {
+				return object
+			}
+		}
+	case map[string]any:
+		if isArticleType(v["@type"]) {
+			return v
+		}
+		if graph, ok := v["@graph"]; ok {
+			return findArticleObject(graph)
+		}
+	}
+	return nil
+}
+
+// isArticleType reports whether a JSON-LD @type is one of the schema.org article types
+func isArticleType(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.HasSuffix(v, "Article") || v == "BlogPosting" || v == "Report"
+	case []any:
+		for _, item := range v {
+			if isArticleType(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// personNames joins the names of a JSON-LD author, which may be a string, an object or a list of either
+func personNames(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		name, _ := v["name"].(string)
+		return strings.TrimSpace(name)
+	case []any:
+		var names []string
+		for _, item := range v {
+			if name := personNames(item); name != "" {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	return ""
+}
+
+// resolveURL resolves ref against base, returning ref unchanged if either does not parse
+func resolveURL(base, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// pruneUnlikely removes elements that never hold article text and containers whose class or id marks
+// them as navigation, comments or advertising
+func pruneUnlikely(doc *nethtml.Node) {
+	var remove []*nethtml.Node
+	walk(doc, func(n *nethtml.Node) bool {
+		if n.Type == nethtml.CommentNode {
+			remove = append(remove, n)
+			return false
+		}
+		if n.Type != nethtml.ElementNode {
+			return true
+		}
+		if ignoredElements[n.DataAtom] || isHidden(n) {
+			remove = append(remove, n)
+			return false
+		}
+		if n.DataAtom == atom.Body || n.DataAtom == atom.Html || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+			return true
+		}
+		hints := attr(n, "class") + " " + attr(n, "id") + " " + attr(n, "role")
+		if unlikelyCandidates.MatchString(hints) && !maybeCandidate.MatchString(hints) {
+			remove = append(remove, n)
+			return false
+		}
+		// Bylines and post metadata are read separately, so drop them from the text
+		if (metadataHint.MatchString(hints) || metadataHint.MatchString(attr(n, "rel"))) && len(collapseSpace(textContent(n))) < maxMetadataLength {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+// isHidden reports whether n is hidden from readers
+func isHidden(n *nethtml.Node) bool {
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// topCandidate returns the element most likely to hold the article: each paragraph adds to the score of
+// its parent and, halved, its grandparent, weighted by class names and penalised by link density.
+// It falls back to the body when no paragraph is long enough to score.
+func topCandidate(doc *nethtml.Node) *nethtml.Node {
+	scores := make(map[*nethtml.Node]float64)
+	var candidates []*nethtml.Node
+	addScore := func(n *nethtml.Node, score float64) {
+		if n == nil || n.Type != nethtml.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = initialScore(n)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	walk(doc, func(n *nethtml.Node) bool {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td && n.DataAtom != atom.Blockquote {
+			return true
+		}
+		text := collapseSpace(textContent(n))
+		if len(text) < minParagraphLength {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		addScore(n.Parent, score)
+		if n.Parent != nil {
+			addScore(n.Parent.Parent, score/2)
+		}
+		return false
+	})
+
+	var top *nethtml.Node
+	topScore := math.Inf(-1)
+	for _, candidate := range candidates {
+		score := scores[candidate] * (1 - linkDensity(candidate))
+		if score > topScore {
+			top, topScore = candidate, score
+		}
+	}
+	if top == nil {
+		return findElement(doc, atom.Body)
+	}
+
+	// A lone paragraph container inside a larger article is usually one section of it, so climb while
+	// the parent holds substantially more scored text
+	for top.Parent != nil && top.Parent.DataAtom != atom.Body && top.Parent.DataAtom != atom.Html {
+		if parentScore, ok := scores[top.Parent]; !ok || parentScore*(1-linkDensity(top.Parent)) < topScore {
+			break
+		}
+		top, topScore = top.Parent, scores[top.Parent]*(1-linkDensity(top.Parent))
+	}
+	return top
+}
+
+// initialScore weights an element by its tag and by its class and id
+func initialScore(n *nethtml.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	for _, hint := range []string{attr(n, "class"), attr(n, "id")} {
+		if hint == "" {
+			continue
+		}
+		if negativeHint.MatchString(hint) {
+			score -= 25
+		}
+		if positiveHint.MatchString(hint) {
+			score += 25
+		}
+	}
+	return score
+}
+
+// linkDensity returns the share of n's text that is inside links
+func linkDensity(n *nethtml.Node) float64 {
+	textLength := len(collapseSpace(textContent(n)))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0
+	walk(n, func(c *nethtml.Node) bool {
+		if c.DataAtom == atom.A {
+			linkLength += len(collapseSpace(textContent(c)))
+			return false
+		}
+		return true
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+// articleRenderer renders an article element as plain text, collecting its headings
+type articleRenderer struct {
+	blocks []articleBlock
+	line   strings.Builder
+	prefix string // Written before the next text of the current block, such as a list marker
+}
+
+// articleBlock is a paragraph, list item or heading of rendered text
+type articleBlock struct {
+	text    string
+	heading bool
+}
+
+// render appends the text of n, skipping nested blocks that are mostly links
+func (r *articleRenderer) render(n *nethtml.Node) {
+	switch n.Type {
+	case nethtml.TextNode:
+		r.line.WriteString(n.Data)
+		return
+	case nethtml.ElementNode, nethtml.DocumentNode:
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		if heading := collapseSpace(textContent(n)); heading != "" {
+			r.blocks = append(r.blocks, articleBlock{text: heading, heading: true})
+		}
+		return
+	case atom.Ul, atom.Ol, atom.Table, atom.Div, atom.Section, atom.Dl:
+		if linkDensity(n) > maxLinkDensity {
+			return
+		}
+	case atom.Td, atom.Th:
+		r.line.WriteString(" ")
+	case atom.Img:
+		return
+	}
+
+	block := blockElements[n.DataAtom]
+	if block {
+		r.flush()
+	}
+	if n.DataAtom == atom.Li {
+		r.prefix = "- "
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.render(c)
+	}
+	if block {
+		r.flush()
+	}
+}
+
+// flush ends the current block of text
+func (r *articleRenderer) flush() {
+	text := collapseSpace(r.line.String())
+	r.line.Reset()
+	if text != "" {
+		r.blocks = append(r.blocks, articleBlock{text: r.prefix + text})
+		r.prefix = ""
+	}
+}
+
+// finish ends the rendering, dropping headings left without text after them
+func (r *articleRenderer) finish() {
+	r.flush()
+	for len(r.blocks) > 0 && r.blocks[len(r.blocks)-1].heading {
+		r.blocks = r.blocks[:len(r.blocks)-1]
+	}
+}
+
+// text returns the rendered blocks separated by blank lines
+func (r *articleRenderer) text() string {
+	texts := make([]string, len(r.blocks))
+	for i, block := range r.blocks {
+		texts[i] = block.text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// headings returns the text of the rendered headings
+func (r *articleRenderer) headings() []string {
+	var headings []string
+	for _, block := range r.blocks {
+		if block.heading {
+			headings = append(headings, block.text)
+		}
+	}
+	return headings
+}
+
+// walk calls visit on n and its descendants in document order, skipping the descendants of nodes
+// for which visit returns false
+func walk(n *nethtml.Node, visit func(*nethtml.Node) bool) {
+	if !visit(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, visit)
+	}
+}
+
+// findElement returns the first element of type a under n
+func findElement(n *nethtml.Node, a atom.Atom) *nethtml.Node {
+	var found *nethtml.Node
+	walk(n, func(c *nethtml.Node) bool {
+		if found != nil {
+			return false
+		}
+		if c.DataAtom == a {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// textContent returns the concatenated text of n and its descendants
+func textContent(n *nethtml.Node) string {
+	var b strings.Builder
+	walk(n, func(c *nethtml.Node) bool {
+		if c.Type == nethtml.TextNode {
+			b.WriteString(c.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+// attr returns the value of n's attribute key, or "" if it has none
+func attr(n *nethtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has the attribute key
+func hasAttr(n *nethtml.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// collapseSpace trims s and collapses its runs of whitespace into single spaces
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// firstNonEmpty returns the first of values that is not blank
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
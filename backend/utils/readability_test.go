@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractArticle(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		fixture  string
+		pageURL  string
+		expected Article
+		contains []string
+		excludes []string
+	}{
+		{
+			fixture: "wikipedia.html",
+			pageURL: "https://en.wikipedia.org/wiki/World%27s_Largest_Lobster",
+			expected: Article{
+				Title:        "World's Largest Lobster - Wikipedia",
+				Byline:       "Contributors to Wikimedia projects",
+				Published:    "2006-06-18T02:11:43Z",
+				CanonicalURL: "https://en.wikipedia.org/wiki/World%27s_Largest_Lobster",
+				Headings:     []string{"History"},
+			},
+			contains: []string{"is a statue in Shediac, New Brunswick", "weighs 90 tonnes", "\n\nHistory\n\n", "Shediac Rotary Club"},
+			excludes: []string{"Jump to content", "Random article", "[edit]", "Privacy policy", "Categories", "Roadside attractions", "RLCONF", "References"},
+		},
+		{
+			fixture: "news.html",
+			pageURL: "https://news.example.com/business/lobster-prices-fall?utm_source=feed",
+			expected: Article{
+				Title:        "Lobster prices fall as catch rebounds",
+				Byline:       "Jane Doucet, Marc LeBlanc",
+				Published:    "2024-05-14T09:30:00-03:00",
+				CanonicalURL: "https://news.example.com/business/lobster-prices-fall",
+				Headings:     []string{"Warmer water"},
+			},
+			contains: []string{"Shore prices for lobster dropped sharply", "about $7 a pound", "Gulf Fisheries Centre", "said one captain"},
+			excludes: []string{"cookies", "Advertisement", "Snow crab", "Share on Twitter", "Most read", "comment from a reader", "newsletter", "All rights reserved"},
+		},
+		{
+			fixture: "blog.html",
+			pageURL: "https://coastalkitchen.example.com/2023/08/how-to-cook-a-lobster/?replytocom=7",
+			expected: Article{
+				Title:        "How to Cook a Lobster – The Coastal Kitchen",
+				Byline:       "Sam Richard",
+				Published:    "2023-08-02T14:05:11+00:00",
+				CanonicalURL: "https://coastalkitchen.example.com/2023/08/how-to-cook-a-lobster/",
+				Headings:     []string{"What you need", "Cooking times"},
+			},
+			contains: []string{"Cooking a live lobster at home", "- Sea salt, about two tablespoons", "Boil a one pound lobster"},
+			excludes: []string{"Skip to content", "Recipes", "August 2, 2023", "Posted in", "thoughts on", "Recent Posts", "WordPress"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			htmlText, err := os.ReadFile(filepath.Join("testdata", "readability", tc.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			article, err := ExtractArticle(string(htmlText), tc.pageURL)
+			if err != nil {
+				t.Fatalf("ExtractArticle: expected no error, got %v", err)
+			}
+			text := article.Text
+			article.Text = ""
+			if !reflect.DeepEqual(*article, tc.expected) {
+				t.Errorf("ExtractArticle: expected metadata %+v, got %+v", tc.expected, *article)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(text, s) {
+					t.Errorf("ExtractArticle: expected text to contain %q, got:\n%s", s, text)
+				}
+			}
+			for _, s := range tc.excludes {
+				if strings.Contains(text, s) {
+					t.Errorf("ExtractArticle: expected text not to contain %q, got:\n%s", s, text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArticle_NoArticle(t *testing.T) {
+	t.Parallel()
+	htmlText := `<html><head><title>App</title><script src="/bundle.js"></script></head><body><div id="root"></div><noscript>Enable JavaScript to run this app.</noscript></body></html>`
+	if _, err := ExtractArticle(htmlText, "https://app.example.com"); !errors.Is(err, ErrNoArticle) {
+		t.Errorf("ExtractArticle: expected ErrNoArticle, got %v", err)
+	}
+}
+
+func TestArticle_CleanHTML(t *testing.T) {
+	t.Parallel()
+	article := &Article{
+		Title:    "Lobsters & Crabs",
+		Headings: []string{"Habitat"},
+		Text:     "Lobsters have ten legs.\n\nHabitat\n\nThey live on the <ocean> floor.",
+	}
+
+	roundTrip, err := ExtractArticle(article.CleanHTML(), "")
+	if err != nil {
+		t.Fatalf("ExtractArticle: expected no error, got %v", err)
+	}
+	if roundTrip.Title != article.Title || roundTrip.Text != article.Text || !reflect.DeepEqual(roundTrip.Headings, article.Headings) {
+		t.Errorf("CleanHTML: expected %+v to survive extraction, got %+v", *article, *roundTrip)
+	}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"read-robin/models"
+)
+
+// Ease factors of the SM-2 scheduler
+const (
+	InitialEase = 2.5
+	MinimumEase = 1.3
+)
+
+// ErrInvalidRating is returned by ReviewQuality for a rating other than hard, good or easy
+var ErrInvalidRating = errors.New("rating must be hard, good or easy")
+
+// ratingQuality maps the ratings a learner may give a correct answer to SM-2 qualities
+var ratingQuality = map[string]int{
+	"hard": 3,
+	"good": 4,
+	"easy": 5,
+}
+
+// ValidateRating checks that rating is empty or one of the accepted ratings
+func ValidateRating(rating string) error {
+	if rating != "" && ratingQuality[rating] == 0 {
+		return ErrInvalidRating
+	}
+	return nil
+}
+
+// ReviewQuality returns the SM-2 quality, from 0 to 5, of a reviewed answer. Failed answers are 1 whatever
+// the rating, and passed answers are rated good unless the learner said they were hard or easy.
+func ReviewQuality(status, rating string) (int, error) {
+	if err := ValidateRating(rating); err != nil {
+		return 0, err
+	}
+	if strings.TrimSpace(status) != ReviewPass {
+		return 1, nil
+	}
+	if rating == "" {
+		return ratingQuality["good"], nil
+	}
+	return ratingQuality[rating], nil
+}
+
+// ScheduleReview records a review of quality, from 0 to 5, at now and schedules the card's next review
+// with SM-2: a failed answer (quality below 3) is due again the next day, and each success in a row waits
+// 1, 6 and then the previous interval times the ease days. The ease falls with hard and failed answers.
+func ScheduleReview(card *models.ReviewCard, quality int, now time.Time) {
+	quality = max(0, min(5, quality))
+	if card.Ease == 0 {
+		card.Ease = InitialEase
+	}
+
+	if quality < 3 {
+		card.Repetitions = 0
+		card.Lapses++
+		card.IntervalDays = 1
+	} else {
+		switch card.Repetitions {
+		case 0:
+			card.IntervalDays = 1
+		case 1:
+			card.IntervalDays = 6
+		default:
+			card.IntervalDays = max(card.IntervalDays+1, int(math.Round(float64(card.IntervalDays)*card.Ease)))
+		}
+		card.Repetitions++
+	}
+
+	miss := float64(5 - quality)
+	card.Ease = max(MinimumEase, card.Ease+0.1-miss*(0.08+miss*0.02))
+	card.LastStatus = ReviewFail
+	if quality >= 3 {
+		card.LastStatus = ReviewPass
+	}
+	card.LastReviewedAt = now
+	card.DueAt = now.AddDate(0, 0, card.IntervalDays)
+}
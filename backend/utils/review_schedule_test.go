@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"read-robin/models"
+)
+
+func TestReviewQuality(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		status, rating string
+		quality        int
+	}{
+		{ReviewPass, "", 4},
+		{ReviewPass, "hard", 3},
+		{ReviewPass, "easy", 5},
+		{" PASS ", "good", 4},
+		{ReviewFail, "", 1},
+		{ReviewFail, "easy", 1},
+	}
+	for _, tc := range testCases {
+		quality, err := ReviewQuality(tc.status, tc.rating)
+		if err != nil || quality != tc.quality {
+			t.Errorf("ReviewQuality(%q, %q): expected %d, got %d, %v", tc.status, tc.rating, tc.quality, quality, err)
+		}
+	}
+	if _, err := ReviewQuality(ReviewPass, "trivial"); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("ReviewQuality: expected ErrInvalidRating, got %v", err)
+	}
+}
+
+func TestScheduleReview(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	card := models.ReviewCard{QuestionID: "0001"}
+
+	// Successive good answers wait 1, 6 and then about 2.5 times as long as the previous interval
+	for _, expected := range []int{1, 6, 15, 38} {
+		ScheduleReview(&card, 4, now)
+		if card.IntervalDays != expected || card.Ease != InitialEase {
+			t.Fatalf("ScheduleReview: expected %d days at ease %v, got %+v", expected, InitialEase, card)
+		}
+		if !card.DueAt.Equal(now.AddDate(0, 0, expected)) || card.LastStatus != ReviewPass {
+			t.Fatalf("ScheduleReview: unexpected schedule %+v", card)
+		}
+		now = card.DueAt
+	}
+
+	// A failed answer starts the question over and makes it harder
+	ScheduleReview(&card, 1, now)
+	if card.IntervalDays != 1 || card.Repetitions != 0 || card.Lapses != 1 || card.LastStatus != ReviewFail {
+		t.Errorf("ScheduleReview: expected the card to start over, got %+v", card)
+	}
+	if card.Ease >= InitialEase {
+		t.Errorf("ScheduleReview: expected the ease to fall, got %v", card.Ease)
+	}
+
+	// Easy answers raise the ease, which never falls below the minimum
+	ease := card.Ease
+	ScheduleReview(&card, 5, now)
+	if card.Ease <= ease {
+		t.Errorf("ScheduleReview: expected the ease to rise, got %v", card.Ease)
+	}
+	for i := 0; i < 10; i++ {
+		ScheduleReview(&card, 0, now)
+	}
+	if card.Ease != MinimumEase {
+		t.Errorf("ScheduleReview: expected the minimum ease, got %v", card.Ease)
+	}
+}
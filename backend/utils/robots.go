@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsTTL is how long a host's robots.txt rules are cached
+	robotsTTL = time.Hour
+	// maxRobotsSize is the size of robots.txt read, as recommended by RFC 9309
+	maxRobotsSize = 500 << 10
+)
+
+// robotsRules are the Allow and Disallow rules of the robots.txt group that applies to the fetcher
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+// allows reports whether path may be fetched: the longest matching rule wins, and Allow wins ties
+func (rr robotsRules) allows(path string) bool {
+	allowMatch, disallowMatch := -1, -1
+	for _, rule := range rr.allow {
+		if matchesRobotsRule(rule, path) && len(rule) > allowMatch {
+			allowMatch = len(rule)
+		}
+	}
+	for _, rule := range rr.disallow {
+		if matchesRobotsRule(rule, path) && len(rule) > disallowMatch {
+			disallowMatch = len(rule)
+		}
+	}
+	return disallowMatch < 0 || allowMatch >= disallowMatch
+}
+
+// matchesRobotsRule reports whether path matches rule, which may use * wildcards and a trailing $ anchor
+func matchesRobotsRule(rule, path string) bool {
+	anchored := strings.HasSuffix(rule, "$")
+	rule = strings.TrimSuffix(rule, "$")
+	parts := strings.Split(rule, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for _, part := range parts[1:] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	if anchored {
+		last := parts[len(parts)-1]
+		return rest == "" || (len(parts) > 1 && strings.HasSuffix(path, last))
+	}
+	return true
+}
+
+// parseRobots returns the rules of the group for userAgent in a robots.txt body, or of the * group if
+// there is no specific one
+func parseRobots(body io.Reader, userAgent string) robotsRules {
+	product := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+	var specific, general robotsRules
+	var hasSpecific bool
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			for _, agent := range agents {
+				var rules *robotsRules
+				switch {
+				case agent == product:
+					rules, hasSpecific = &specific, true
+				case agent == "*":
+					rules = &general
+				default:
+					continue
+				}
+				if key == "allow" {
+					rules.allow = append(rules.allow, value)
+				} else {
+					rules.disallow = append(rules.disallow, value)
+				}
+			}
+		}
+	}
+	if hasSpecific {
+		return specific
+	}
+	return general
+}
+
+// robotsCache caches the robots.txt rules of each host
+type robotsCache struct {
+	mu    sync.Mutex
+	hosts map[string]robotsEntry
+}
+
+type robotsEntry struct {
+	rules   robotsRules
+	expires time.Time
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{hosts: make(map[string]robotsEntry)}
+}
+
+// allowed reports whether the robots.txt of u's host allows f to fetch u. A missing robots.txt allows
+// everything and one the server fails to serve disallows everything, following RFC 9309.
+func (rc *robotsCache) allowed(ctx context.Context, f *Fetcher, u *url.URL) (bool, error) {
+	origin := u.Scheme + "://" + u.Host
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	rc.mu.Lock()
+	entry, ok := rc.hosts[origin]
+	rc.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.rules.allows(path), nil
+	}
+
+	rules, err := f.fetchRobots(ctx, origin)
+	if err != nil {
+		return false, err
+	}
+	rc.mu.Lock()
+	rc.hosts[origin] = robotsEntry{rules: rules, expires: time.Now().Add(robotsTTL)}
+	rc.mu.Unlock()
+	return rules.allows(path), nil
+}
+
+// fetchRobots fetches and parses the robots.txt of origin
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) (robotsRules, error) {
+	req, err := f.newRequest(ctx, origin+"/robots.txt")
+	if err != nil {
+		return robotsRules{}, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return robotsRules{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return robotsRules{disallow: []string{"/"}}, nil
+	case resp.StatusCode >= http.StatusBadRequest:
+		return robotsRules{}, nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize), f.policy.UserAgent), nil
+}
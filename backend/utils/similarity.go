@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"read-robin/models"
+)
+
+// DuplicateThreshold is the similarity at or above which two questions count as the same question
+const DuplicateThreshold = 0.7
+
+// NormalizeText lowercases text and reduces everything but letters and numbers to single spaces
+func NormalizeText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// QuestionText returns the text that identifies what a question asks: the cloze text of fill-in-the-blank
+// questions, whose question is a generic instruction, and the question itself otherwise
+func QuestionText(question models.Question) string {
+	if question.FillInBlank != nil && question.FillInBlank.Text != "" {
+		return question.FillInBlank.Text
+	}
+	return question.Question
+}
+
+// stopWords are left out when comparing questions, so phrasing shared by many questions does not make
+// them look alike
+var stopWords = toSet("a about an and are as at be by can could did do does for from had has have how in is it its may might of on or should that the their these this those to was were what when where which who whom why will with would according text content passage say says said")
+
+// toSet returns the space-separated words as a set
+func toSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// fingerprint holds the normalized forms of a text compared by Similarity
+type fingerprint struct {
+	normalized string
+	words      map[string]bool
+	trigrams   map[string]bool
+}
+
+// newFingerprint normalizes text, keeping its content words with plurals made singular
+func newFingerprint(text string) fingerprint {
+	fp := fingerprint{normalized: NormalizeText(text), words: make(map[string]bool), trigrams: make(map[string]bool)}
+	var content []string
+	for _, word := range strings.Fields(fp.normalized) {
+		if stopWords[word] {
+			continue
+		}
+		// Plurals and the singular are the same word for our purposes
+		if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = word[:len(word)-1]
+		}
+		fp.words[word] = true
+		content = append(content, word)
+	}
+	runes := []rune(strings.Join(content, " "))
+	for i := 0; i+3 <= len(runes); i++ {
+		fp.trigrams[string(runes[i:i+3])] = true
+	}
+	return fp
+}
+
+// similarity averages the overlap of the content words (Jaccard index) and of their character trigrams
+// (Dice coefficient) of two fingerprints, so reordered and slightly reworded questions score high while
+// questions sharing only their phrasing do not
+func (fp fingerprint) similarity(other fingerprint) float64 {
+	if fp.normalized == "" || other.normalized == "" {
+		return 0
+	}
+	if fp.normalized == other.normalized {
+		return 1
+	}
+	if len(fp.words) == 0 || len(other.words) == 0 {
+		return 0
+	}
+	sharedWords := overlap(fp.words, other.words)
+	words := float64(sharedWords) / float64(len(fp.words)+len(other.words)-sharedWords)
+	var trigrams float64
+	if total := len(fp.trigrams) + len(other.trigrams); total > 0 {
+		trigrams = 2 * float64(overlap(fp.trigrams, other.trigrams)) / float64(total)
+	}
+	return (words + trigrams) / 2
+}
+
+// overlap counts the members of a that are also in b
+func overlap(a, b map[string]bool) int {
+	shared := 0
+	for member := range a {
+		if b[member] {
+			shared++
+		}
+	}
+	return shared
+}
+
+// Similarity scores how alike two questions are, from 0 for nothing in common to 1 for the same text
+// once normalized
+func Similarity(a, b string) float64 {
+	return newFingerprint(a).similarity(newFingerprint(b))
+}
+
+// DuplicateFilter recognizes questions that repeat, possibly reworded, a question it has already seen
+type DuplicateFilter struct {
+	seen []fingerprint
+}
+
+// NewDuplicateFilter creates a DuplicateFilter that has already seen texts
+func NewDuplicateFilter(texts ...string) *DuplicateFilter {
+	df := &DuplicateFilter{}
+	for _, text := range texts {
+		df.Add(text)
+	}
+	return df
+}
+
+// Add records text unless it duplicates a question already seen, reporting whether it was new
+func (df *DuplicateFilter) Add(text string) bool {
+	fp := newFingerprint(text)
+	for _, seen := range df.seen {
+		if fp.similarity(seen) >= DuplicateThreshold {
+			return false
+		}
+	}
+	df.seen = append(df.seen, fp)
+	return true
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestSimilarity(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		a, b      string
+		duplicate bool
+	}{
+		{"How many legs do lobsters have?", "how many legs does a lobster have", true},
+		{"What is the capital of Germany?", "Name the capital of Germany.", true},
+		{"Lobsters live in the ocean.", "Lobsters live on the ocean floor.", true},
+		{"What is the capital of France?", "What is the capital of Spain?", false},
+		{"How many legs do lobsters have?", "Where do lobsters live?", false},
+		{"What does the text say about lobsters?", "What does the text say about crabs?", false},
+		{"What is it?", "", false},
+	}
+
+	for _, tc := range testCases {
+		similarity := Similarity(tc.a, tc.b)
+		if (similarity >= DuplicateThreshold) != tc.duplicate {
+			t.Errorf("Similarity(%q, %q) = %.2f, expected duplicate %v", tc.a, tc.b, similarity, tc.duplicate)
+		}
+	}
+	if similarity := Similarity("Why do lobsters molt?", "WHY do lobsters molt"); similarity != 1 {
+		t.Errorf("Similarity: expected 1 for texts equal once normalized, got %.2f", similarity)
+	}
+}
+
+func TestDuplicateFilter(t *testing.T) {
+	t.Parallel()
+	filter := NewDuplicateFilter("How many legs do lobsters have?")
+	if filter.Add("How many legs does a lobster have?") {
+		t.Error("DuplicateFilter: expected a reworded seed question to be a duplicate")
+	}
+	if !filter.Add("Where do lobsters live?") {
+		t.Error("DuplicateFilter: expected a new question to be added")
+	}
+	if filter.Add("Where do the lobsters live?") {
+		t.Error("DuplicateFilter: expected a reworded added question to be a duplicate")
+	}
+}
+
+func TestQuestionText(t *testing.T) {
+	t.Parallel()
+	question := models.Question{Question: "Fill in the blanks.", FillInBlank: &models.FillInBlank{Text: "Lobsters have ___ legs.", Blanks: []string{"ten"}}}
+	if text := QuestionText(question); text != "Lobsters have ___ legs." {
+		t.Errorf("QuestionText: expected the cloze text, got %q", text)
+	}
+	question = models.Question{Question: "Why do lobsters molt?"}
+	if text := QuestionText(question); text != "Why do lobsters molt?" {
+		t.Errorf("QuestionText: expected the question, got %q", text)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"read-robin/models"
+)
+
+// timestampPattern matches timestamps of up to three colon-separated fields, the last with an optional fraction
+var timestampPattern = regexp.MustCompile(`^(?:(?:(\d+):)?(\d+):)?(\d+(?:[.,]\d+)?)$`)
+
+// ParseTimestamp parses a media timestamp such as "1:02:03.500", "02:03,5" or "123.5" into seconds.
+// Hours and minutes are optional, and the fraction may follow a point or a comma as in SRT.
+func ParseTimestamp(s string) (float64, error) {
+	match := timestampPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(strings.Replace(match[3], ",", ".", 1), 64)
+	if match[2] != "" && seconds >= 60 || match[1] != "" && minutes >= 60 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return float64(hours*3600+minutes*60) + seconds, nil
+}
+
+// FormatTimestamp formats seconds as "m:ss", or "h:mm:ss" from an hour on, as questions cite media
+func FormatTimestamp(seconds float64) string {
+	total := int(max(seconds, 0))
+	hours, minutes, secs := total/3600, total/60%60, total%60
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, secs)
+	}
+	return fmt.Sprintf("%d:%02d", minutes, secs)
+}
+
+// TranscriptContent writes segments as the content text of a transcript, one line per segment with a
+// paragraph for each speaker's turn, naming the speaker at the start of the turn. It returns the text and
+// the non-empty segments with their offsets in it.
+func TranscriptContent(segments []models.Segment) (string, []models.Segment) {
+	var text strings.Builder
+	placed := make([]models.Segment, 0, len(segments))
+	for _, segment := range segments {
+		segment.Text = strings.Join(strings.Fields(segment.Text), " ")
+		segment.Speaker = strings.TrimSpace(segment.Speaker)
+		if segment.Text == "" {
+			continue
+		}
+		newTurn := len(placed) == 0 || segment.Speaker != placed[len(placed)-1].Speaker
+		switch {
+		case text.Len() > 0 && newTurn:
+			text.WriteString("\n\n")
+		case text.Len() > 0:
+			text.WriteString("\n")
+		}
+		segment.Offset = text.Len()
+		if newTurn && segment.Speaker != "" {
+			text.WriteString(segment.Speaker + ": ")
+		}
+		text.WriteString(segment.Text)
+		placed = append(placed, segment)
+	}
+	if len(placed) == 0 {
+		placed = nil
+	}
+	return text.String(), placed
+}
+
+// LocateTimeRange returns the span of the segments of contentText that reference was quoted from, or nil
+// if the reference cannot be found in the text or the content has no segments
+func LocateTimeRange(contentText string, segments []models.Segment, reference string) *models.TimeRange {
+	if len(segments) == 0 {
+		return nil
+	}
+	offset := LocateReference(contentText, reference)
+	if offset < 0 {
+		return nil
+	}
+	end := offset + len(strings.TrimSpace(reference))
+	first, last := 0, 0
+	for i, segment := range segments {
+		if segment.Offset <= offset {
+			first = i
+		}
+		if segment.Offset < end {
+			last = i
+		}
+	}
+	last = max(first, last)
+	return &models.TimeRange{Start: segments[first].Start, End: segments[last].End}
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		timestamp string
+		expected  float64
+	}{
+		{"01:02:03.500", 3723.5},
+		{"1:02:03,5", 3723.5},
+		{"02:03.250", 123.25},
+		{"2:03", 123},
+		{"123.5", 123.5},
+		{" 0:07 ", 7},
+	}
+	for _, tc := range testCases {
+		seconds, err := ParseTimestamp(tc.timestamp)
+		if err != nil || seconds != tc.expected {
+			t.Errorf("ParseTimestamp(%q): expected %v, got %v, %v", tc.timestamp, tc.expected, seconds, err)
+		}
+	}
+	for _, timestamp := range []string{"", "1:2:3:4", "0:60", "1:60:00", "-1", "1e3", "NaN", "1:xx"} {
+		if _, err := ParseTimestamp(timestamp); err == nil {
+			t.Errorf("ParseTimestamp(%q): expected an error", timestamp)
+		}
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	t.Parallel()
+	for seconds, expected := range map[float64]string{0: "0:00", 7.9: "0:07", 245: "4:05", 3723.5: "1:02:03", -3: "0:00"} {
+		if got := FormatTimestamp(seconds); got != expected {
+			t.Errorf("FormatTimestamp(%v): expected %q, got %q", seconds, expected, got)
+		}
+	}
+}
+
+func TestTranscriptContent(t *testing.T) {
+	t.Parallel()
+	text, segments := TranscriptContent([]models.Segment{
+		{Start: 0, End: 4, Speaker: "Ada", Text: "Lobsters grow by molting."},
+		{Start: 4, End: 8, Speaker: "Ada", Text: " They shed their   shell. "},
+		{Start: 8, End: 9, Speaker: "Ben", Text: "  "},
+		{Start: 9, End: 12, Speaker: "Ben", Text: "Shediac hosts a giant lobster statue."},
+		{Start: 12, End: 15, Text: "It weighs ninety tonnes."},
+	})
+
+	expectedText := "Ada: Lobsters grow by molting.\nThey shed their shell.\n\nBen: Shediac hosts a giant lobster statue.\n\nIt weighs ninety tonnes."
+	if text != expectedText {
+		t.Errorf("TranscriptContent: expected text %q, got %q", expectedText, text)
+	}
+	expected := []models.Segment{
+		{Start: 0, End: 4, Speaker: "Ada", Text: "Lobsters grow by molting.", Offset: 0},
+		{Start: 4, End: 8, Speaker: "Ada", Text: "They shed their shell.", Offset: 31},
+		{Start: 9, End: 12, Speaker: "Ben", Text: "Shediac hosts a giant lobster statue.", Offset: 55},
+		{Start: 12, End: 15, Text: "It weighs ninety tonnes.", Offset: 99},
+	}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("TranscriptContent: expected segments %+v, got %+v", expected, segments)
+	}
+
+	if text, segments := TranscriptContent(nil); text != "" || segments != nil {
+		t.Errorf("TranscriptContent: expected no text or segments for an empty transcript, got %q, %v", text, segments)
+	}
+}
+
+func TestLocateTimeRange(t *testing.T) {
+	t.Parallel()
+	text, segments := TranscriptContent([]models.Segment{
+		{Start: 0, End: 4, Text: "Lobsters grow by molting."},
+		{Start: 4, End: 8, Text: "They shed their shell."},
+		{Start: 9, End: 12, Text: "Shediac hosts a giant lobster statue."},
+	})
+
+	testCases := []struct {
+		reference string
+		expected  *models.TimeRange
+	}{
+		{"They shed their shell.", &models.TimeRange{Start: 4, End: 8}},
+		{"grow by molting. They shed", &models.TimeRange{Start: 0, End: 8}},
+		{"shediac hosts a GIANT lobster statue", &models.TimeRange{Start: 9, End: 12}},
+		{"Lobsters are crustaceans.", nil},
+		{"", nil},
+	}
+	for _, tc := range testCases {
+		if got := LocateTimeRange(text, segments, tc.reference); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("LocateTimeRange(%q): expected %+v, got %+v", tc.reference, tc.expected, got)
+		}
+	}
+
+	if got := LocateTimeRange(text, nil, "They shed their shell."); got != nil {
+		t.Errorf("LocateTimeRange: expected no time range for content without segments, got %+v", got)
+	}
+}
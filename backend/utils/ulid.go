@@ -0,0 +1,80 @@
+package utils
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet ULIDs are written in
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLength is the length of a ULID: 128 bits in 5-bit characters
+const ulidLength = 26
+
+// ulidState holds the last ULID's time and randomness, so IDs generated in the same millisecond
+// still sort in the order they were generated
+var ulidState struct {
+	sync.Mutex
+	ms      uint64
+	entropy [10]byte
+}
+
+// NewULID generates a ULID for now: a 48-bit millisecond timestamp followed by 80 random bits. IDs
+// generated within one millisecond increment the previous randomness, so they are unique and sortable.
+func NewULID(now time.Time) string {
+	ms := uint64(now.UnixMilli())
+
+	ulidState.Lock()
+	if ms > ulidState.ms || !incrementEntropy(&ulidState.entropy) {
+		if _, err := cryptorand.Read(ulidState.entropy[:]); err != nil {
+			panic(fmt.Sprintf("crypto/rand: %v", err))
+		}
+	}
+	ulidState.ms = max(ms, ulidState.ms)
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], ulidState.ms<<16)
+	copy(id[6:], ulidState.entropy[:])
+	ulidState.Unlock()
+
+	return encodeULID(id)
+}
+
+// incrementEntropy adds one to entropy, reporting false if it overflowed
+func incrementEntropy(entropy *[10]byte) bool {
+	for i := len(entropy) - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bits of id as 26 Crockford base32 characters, most significant first
+func encodeULID(id [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	var encoded [ulidLength]byte
+	for i := ulidLength - 1; i >= 0; i-- {
+		encoded[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(encoded[:])
+}
+
+// IsULID reports whether id is a ULID as written by NewULID
+func IsULID(id string) bool {
+	if len(id) != ulidLength || id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !strings.ContainsRune(crockfordAlphabet, rune(id[i])) {
+			return false
+		}
+	}
+	return true
+}
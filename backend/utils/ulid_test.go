@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	t.Parallel()
+	now := time.UnixMilli(1719835200000)
+
+	ids := make([]string, 1000)
+	seen := make(map[string]bool)
+	for i := range ids {
+		ids[i] = NewULID(now)
+		if !IsULID(ids[i]) {
+			t.Fatalf("NewULID: %q is not a ULID", ids[i])
+		}
+		if seen[ids[i]] {
+			t.Fatalf("NewULID: generated %s twice", ids[i])
+		}
+		seen[ids[i]] = true
+	}
+	// IDs generated within one millisecond still sort in the order they were generated
+	if !sort.StringsAreSorted(ids) {
+		t.Error("NewULID: expected IDs to sort in generation order")
+	}
+	// The first 10 characters are the timestamp
+	if later := NewULID(now.Add(time.Millisecond)); later[:10] <= ids[0][:10] {
+		t.Errorf("NewULID: expected a later timestamp prefix, got %s after %s", later, ids[0])
+	}
+	if encoded := encodeULID([16]byte{0x01}); encoded != "01000000000000000000000000" {
+		t.Errorf("encodeULID: unexpected encoding %s", encoded)
+	}
+	largest := [16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if encoded := encodeULID(largest); encoded != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Errorf("encodeULID: unexpected encoding %s", encoded)
+	}
+}
+
+func TestIsULID(t *testing.T) {
+	t.Parallel()
+	for id, valid := range map[string]bool{
+		"01J1WZ8Y5K8ZC7Q3N2A4B6D8EF": true,
+		"0042":                       false,
+		"01J1WZ8Y5K8ZC7Q3N2A4B6D8EU": false, // U is not in the alphabet
+		"81J1WZ8Y5K8ZC7Q3N2A4B6D8EF": false, // Overflows 128 bits
+	} {
+		if IsULID(id) != valid {
+			t.Errorf("IsULID(%q): expected %v", id, valid)
+		}
+	}
+}
+
+func TestGenerateContentID(t *testing.T) {
+	t.Parallel()
+	id := GenerateContentID("alice", "https://example.com")
+	if len(id) != 32 || id != GenerateID("alice\x00https://example.com") {
+		t.Errorf("GenerateContentID: unexpected ID %q", id)
+	}
+	if id == GenerateContentID("bob", "https://example.com") || GenerateContentID("", "https://example.com") != GenerateID("https://example.com") {
+		t.Error("GenerateContentID: expected separate IDs per owner")
+	}
+	if legacy := LegacyContentID("", "example.com"); legacy != fmt.Sprintf("%x", legacyHash("example.com")) || legacy == GenerateID("example.com") {
+		t.Errorf("LegacyContentID: unexpected ID %q", legacy)
+	}
+}
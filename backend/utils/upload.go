@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// UploadSniffLen is the number of leading bytes of an upload its media type is detected from
+const UploadSniffLen = 512
+
+// DetectUploadType returns the media type of an uploaded file from its first bytes. The type the client
+// declared, or else the one of the file's extension, is used for audio and video the content sniffer does
+// not recognize, for audio in containers it sniffs as video, such as MP4, and for documents it sniffs as zip
+// archives or plain text. Without any bytes, the declared type is returned as is.
+func DetectUploadType(declared string, head []byte, filename string) string {
+	claimed := mediaType(declared)
+	if claimed == "" || claimed == "application/octet-stream" {
+		claimed = mediaType(mime.TypeByExtension(strings.ToLower(pathExt(filename))))
+	}
+	if len(head) == 0 {
+		return claimed
+	}
+	isMedia := strings.HasPrefix(claimed, "audio/") || strings.HasPrefix(claimed, "video/")
+
+	sniffed := mediaType(http.DetectContentType(head))
+	switch {
+	case strings.HasPrefix(sniffed, "video/") && strings.HasPrefix(claimed, "audio/"):
+		return claimed
+	case sniffed == "application/ogg":
+		if isMedia {
+			return claimed
+		}
+		return "audio/ogg"
+	case sniffed == "application/octet-stream" && isMedia:
+		return claimed
+	}
+	return documentOr(sniffed, claimed)
+}
+
+// UploadExt returns the file extension, with its dot, stored uploads of uploadType are given so that their
+// type can be told from their name. The extension of filename is kept if it matches.
+func UploadExt(uploadType, filename string) string {
+	ext := strings.ToLower(pathExt(filename))
+	if ext != "" && mediaType(mime.TypeByExtension(ext)) == uploadType {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(uploadType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
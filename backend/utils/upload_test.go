@@ -0,0 +1,52 @@
+package utils
+
+import "testing"
+
+func TestDetectUploadType(t *testing.T) {
+	t.Parallel()
+	mp4 := []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+	testCases := []struct {
+		name     string
+		declared string
+		head     []byte
+		filename string
+		expected string
+	}{
+		{"pdf", "", []byte("%PDF-1.7\n"), "paper.pdf", "application/pdf"},
+		{"declared type ignored", "audio/mpeg", []byte("%PDF-1.7\n"), "paper.mp3", "application/pdf"},
+		{"mp3", "", []byte("ID3\x04\x00\x00"), "talk", "audio/mpeg"},
+		{"mp4 video", "video/mp4", mp4, "talk.mp4", "video/mp4"},
+		{"mp4 audio", "audio/mp4", mp4, "talk.m4a", "audio/mp4"},
+		{"ogg", "", []byte("OggS\x00\x02"), "talk.ogg", "audio/ogg"},
+		{"ogg video", "video/ogg", []byte("OggS\x00\x02"), "talk.ogv", "video/ogg"},
+		{"unrecognized audio", "audio/flac", []byte("fLaC\x00\x00\x00\x22"), "talk.flac", "audio/flac"},
+		{"unrecognized binary", "application/octet-stream", []byte("\x00\x01\x02\x03"), "data.bin", "application/octet-stream"},
+		{"text declared as audio", "audio/mpeg", []byte("just some text"), "notes.mp3", "text/plain"},
+		{"declared only", "audio/mpeg", nil, "talk", "audio/mpeg"},
+		{"docx", "", []byte("PK\x03\x04\x14\x00\x06\x00"), "essay.docx", MediaTypeDOCX},
+		{"epub", "application/epub+zip", []byte("PK\x03\x04\x0a\x00\x00\x00mimetype"), "book", MediaTypeEPUB},
+		{"markdown", "", []byte("# Lobsters\n"), "notes.md", MediaTypeMarkdown},
+		{"zip", "", []byte("PK\x03\x04\x14\x00\x06\x00"), "archive.zip", "application/zip"},
+	}
+	for _, tc := range testCases {
+		if got := DetectUploadType(tc.declared, tc.head, tc.filename); got != tc.expected {
+			t.Errorf("DetectUploadType(%s): expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestUploadExt(t *testing.T) {
+	t.Parallel()
+	if got := UploadExt("application/pdf", "Paper.PDF"); got != ".pdf" {
+		t.Errorf("UploadExt: expected the file's own extension .pdf, got %q", got)
+	}
+	if got := UploadExt("application/pdf", "paper.mp3"); got != ".pdf" {
+		t.Errorf("UploadExt: expected .pdf for a misnamed PDF, got %q", got)
+	}
+	if got := UploadExt(MediaTypeDOCX, "essay"); got != ".docx" {
+		t.Errorf("UploadExt: expected .docx for a document without an extension, got %q", got)
+	}
+	if got := UploadExt("application/x-unknown-type", "data"); got != "" {
+		t.Errorf("UploadExt: expected no extension for an unknown type, got %q", got)
+	}
+}
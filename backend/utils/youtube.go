@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"read-robin/models"
+)
+
+// ErrVideoUnavailable is returned by a YouTubeFetcher for videos that are private, removed or blocked
+var ErrVideoUnavailable = errors.New("YouTube video is unavailable")
+
+// youTubeBaseURL is where YouTube watch pages and caption tracks are fetched from
+const youTubeBaseURL = "https://www.youtube.com"
+
+var (
+	youTubeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	// playerResponseStart finds the player response a watch page embeds in a script
+	playerResponseStart = regexp.MustCompile(`ytInitialPlayerResponse\s*=\s*\{`)
+)
+
+// YouTubeVideo is the metadata and captions of a YouTube video
+type YouTubeVideo struct {
+	ID        string
+	Title     string
+	Channel   string
+	Published string  // The publish date as the watch page gives it, e.g. "2024-05-14"
+	Duration  float64 // Seconds
+	// Captions are the segments of the video's captions, preferring captions written by people over
+	// automatic ones; empty if the video has none
+	Captions []models.Segment
+}
+
+// YouTubeFetcher fetches the metadata and captions of YouTube videos
+type YouTubeFetcher interface {
+	// FetchVideo fetches the video videoID, returning ErrVideoUnavailable if it cannot be watched
+	FetchVideo(ctx context.Context, videoID string) (*YouTubeVideo, error)
+}
+
+// YouTubeVideoID returns the ID of the video a YouTube watch, short, embed, live or youtu.be URL links to
+func YouTubeVideoID(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || checkScheme(u) != nil {
+		return "", false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	id := ""
+	switch host {
+	case "youtu.be":
+		id = strings.Trim(u.Path, "/")
+	case "youtube.com", "m.youtube.com", "music.youtube.com", "youtube-nocookie.com":
+		if u.Path == "/watch" {
+			id = u.Query().Get("v")
+			break
+		}
+		for _, prefix := range []string{"/shorts/", "/embed/", "/live/", "/v/"} {
+			if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+				id = strings.Trim(rest, "/")
+			}
+		}
+	}
+	if !youTubeIDPattern.MatchString(id) {
+		return "", false
+	}
+	return id, true
+}
+
+// YouTubeWatchURL returns the canonical watch URL of the video videoID
+func YouTubeWatchURL(videoID string) string {
+	return youTubeBaseURL + "/watch?v=" + videoID
+}
+
+// YouTubeClient is a YouTubeFetcher that reads the player response embedded in a video's watch page and
+// downloads the caption track it lists
+type YouTubeClient struct {
+	fetcher *Fetcher
+
+	// baseURL is where watch pages and caption tracks are fetched from; tests replace it
+	baseURL string
+}
+
+// NewYouTubeClient creates a YouTubeClient that fetches with fetcher
+func NewYouTubeClient(fetcher *Fetcher) *YouTubeClient {
+	return &YouTubeClient{fetcher: fetcher, baseURL: youTubeBaseURL}
+}
+
+// youTubePlayerResponse is the part of a watch page's player response read by YouTubeClient
+type youTubePlayerResponse struct {
+	PlayabilityStatus struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	} `json:"playabilityStatus"`
+	VideoDetails struct {
+		VideoID       string `json:"videoId"`
+		Title         string `json:"title"`
+		Author        string `json:"author"`
+		LengthSeconds string `json:"lengthSeconds"`
+	} `json:"videoDetails"`
+	Microformat struct {
+		PlayerMicroformatRenderer struct {
+			PublishDate string `json:"publishDate"`
+			UploadDate  string `json:"uploadDate"`
+		} `json:"playerMicroformatRenderer"`
+	} `json:"microformat"`
+	Captions struct {
+		PlayerCaptionsTracklistRenderer struct {
+			CaptionTracks []struct {
+				BaseURL      string `json:"baseUrl"`
+				LanguageCode string `json:"languageCode"`
+				Kind         string `json:"kind"` // "asr" for automatic captions
+			} `json:"captionTracks"`
+		} `json:"playerCaptionsTracklistRenderer"`
+	} `json:"captions"`
+}
+
+// FetchVideo fetches the watch page of videoID and then its captions
+func (yc *YouTubeClient) FetchVideo(ctx context.Context, videoID string) (*YouTubeVideo, error) {
+	if !youTubeIDPattern.MatchString(videoID) {
+		return nil, fmt.Errorf("invalid YouTube video ID %q", videoID)
+	}
+	page, err := yc.fetcher.FetchHTML(ctx, yc.baseURL+"/watch?v="+videoID)
+	if err != nil {
+		return nil, err
+	}
+	player, err := parsePlayerResponse(page)
+	if err != nil {
+		return nil, err
+	}
+	if status := player.PlayabilityStatus.Status; status != "OK" {
+		return nil, fmt.Errorf("%w: %s %s", ErrVideoUnavailable, status, player.PlayabilityStatus.Reason)
+	}
+
+	details := player.VideoDetails
+	video := &YouTubeVideo{ID: videoID, Title: details.Title, Channel: details.Author}
+	video.Duration, _ = strconv.ParseFloat(details.LengthSeconds, 64)
+	video.Published = player.Microformat.PlayerMicroformatRenderer.PublishDate
+	if video.Published == "" {
+		video.Published = player.Microformat.PlayerMicroformatRenderer.UploadDate
+	}
+
+	tracks := player.Captions.PlayerCaptionsTracklistRenderer.CaptionTracks
+	best := -1
+	for i, track := range tracks {
+		if best < 0 || tracks[best].Kind == "asr" && track.Kind != "asr" {
+			best = i
+		}
+	}
+	if best < 0 {
+		return video, nil
+	}
+	// Caption tracks are always fetched from YouTube, whatever host the player response names
+	trackURL, err := url.Parse(tracks[best].BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid caption track URL: %v", err)
+	}
+	captions, err := yc.fetcher.FetchHTML(ctx, yc.baseURL+trackURL.RequestURI())
+	if err != nil {
+		return nil, err
+	}
+	video.Captions, err = ParseTimedText(captions)
+	if err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// parsePlayerResponse decodes the player response embedded in a watch page
+func parsePlayerResponse(page string) (*youTubePlayerResponse, error) {
+	loc := playerResponseStart.FindStringIndex(page)
+	if loc == nil {
+		return nil, fmt.Errorf("%w: no player response in watch page", ErrVideoUnavailable)
+	}
+	// The decoder reads the object and stops, ignoring the rest of the script
+	var player youTubePlayerResponse
+	if err := json.NewDecoder(strings.NewReader(page[loc[1]-1:])).Decode(&player); err != nil {
+		return nil, fmt.Errorf("decoding player response: %v", err)
+	}
+	return &player, nil
+}
+
+// ParseTimedText parses YouTube's timed text captions into segments. Both the classic format, with a
+// "text" element per caption timed in seconds, and format 3, with a "p" element per caption timed in
+// milliseconds, are read.
+func ParseTimedText(data string) ([]models.Segment, error) {
+	var timedText struct {
+		Texts []struct {
+			Start    float64 `xml:"start,attr"`
+			Duration float64 `xml:"dur,attr"`
+			Text     string  `xml:",innerxml"`
+		} `xml:"text"`
+		Paragraphs []struct {
+			Start    float64 `xml:"t,attr"`
+			Duration float64 `xml:"d,attr"`
+			Text     string  `xml:",innerxml"`
+		} `xml:"body>p"`
+	}
+	if err := xml.Unmarshal([]byte(data), &timedText); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCaptions, err)
+	}
+
+	var segments []models.Segment
+	add := func(start, duration float64, text string) {
+		// Captions are escaped once by XML and often again by YouTube
+		text = html.UnescapeString(captionTag.ReplaceAllString(html.UnescapeString(text), ""))
+		text = strings.Join(strings.Fields(text), " ")
+		if text != "" {
+			segments = append(segments, models.Segment{Start: start, End: start + duration, Text: text})
+		}
+	}
+	for _, text := range timedText.Texts {
+		add(text.Start, text.Duration, text.Text)
+	}
+	for _, p := range timedText.Paragraphs {
+		add(p.Start/1000, p.Duration/1000, p.Text)
+	}
+	return segments, nil
+}
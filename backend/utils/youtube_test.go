@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"read-robin/models"
+)
+
+func TestYouTubeVideoID(t *testing.T) {
+	t.Parallel()
+	for _, rawURL := range []string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://youtube.com/watch?feature=share&v=dQw4w9WgXcQ",
+		"http://m.youtube.com/watch?v=dQw4w9WgXcQ&t=42s",
+		"https://music.youtube.com/watch?v=dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ?si=abc",
+		"https://www.youtube.com/shorts/dQw4w9WgXcQ",
+		"https://www.youtube.com/embed/dQw4w9WgXcQ",
+		"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ",
+		"https://www.youtube.com/live/dQw4w9WgXcQ/",
+	} {
+		if id, ok := YouTubeVideoID(rawURL); !ok || id != "dQw4w9WgXcQ" {
+			t.Errorf("YouTubeVideoID(%q): expected dQw4w9WgXcQ, got %q, %v", rawURL, id, ok)
+		}
+	}
+	for _, rawURL := range []string{
+		"https://www.youtube.com/watch?v=short",
+		"https://www.youtube.com/channel/UC1234567890",
+		"https://www.youtube.com/playlist?list=PL123",
+		"https://youtube.example.com/watch?v=dQw4w9WgXcQ",
+		"ftp://youtu.be/dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ/extra",
+	} {
+		if id, ok := YouTubeVideoID(rawURL); ok {
+			t.Errorf("YouTubeVideoID(%q): expected no video ID, got %q", rawURL, id)
+		}
+	}
+}
+
+// newYouTubeFixtureClient creates a YouTubeClient that fetches from an httptest server serving testdata/youtube,
+// with watch serving the watch page
+func newYouTubeFixtureClient(t *testing.T, watch string) *YouTubeClient {
+	serve := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, filepath.Join("testdata", "youtube", name))
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch", serve(watch))
+	mux.HandleFunc("/api/timedtext", func(w http.ResponseWriter, r *http.Request) {
+		// Automatic captions must not be fetched when captions written by people are listed
+		if r.URL.Query().Get("kind") == "asr" {
+			http.Error(w, "automatic captions", http.StatusTeapot)
+			return
+		}
+		serve("timedtext.xml")(w, r)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	client := NewYouTubeClient(newLocalFetcher())
+	client.baseURL = ts.URL
+	return client
+}
+
+func TestYouTubeClient_FetchVideo(t *testing.T) {
+	t.Parallel()
+	video, err := newYouTubeFixtureClient(t, "watch.html").FetchVideo(context.Background(), "dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatalf("FetchVideo: expected no error, got %v", err)
+	}
+	if video.Title != "Why Lobsters Molt" || video.Channel != "Shediac Science" || video.Published != "2024-05-14" || video.Duration != 212 {
+		t.Errorf("FetchVideo: unexpected metadata %+v", video)
+	}
+	expected := []models.Segment{
+		{Start: 0, End: 4.5, Text: "Lobsters grow by molting."},
+		{Start: 4.5, End: 9, Text: "They shed their shell & grow a new one."},
+		{Start: 10, End: 12, Text: "It's a risky time."},
+	}
+	if !reflect.DeepEqual(video.Captions, expected) {
+		t.Errorf("FetchVideo: expected captions %+v, got %+v", expected, video.Captions)
+	}
+}
+
+func TestYouTubeClient_FetchVideoUnavailable(t *testing.T) {
+	t.Parallel()
+	client := newYouTubeFixtureClient(t, "unavailable.html")
+	if _, err := client.FetchVideo(context.Background(), "dQw4w9WgXcQ"); !errors.Is(err, ErrVideoUnavailable) {
+		t.Errorf("FetchVideo: expected ErrVideoUnavailable for a private video, got %v", err)
+	}
+	if _, err := client.FetchVideo(context.Background(), "../watch"); err == nil {
+		t.Errorf("FetchVideo: expected an error for an invalid video ID")
+	}
+}
+
+func TestParseTimedText(t *testing.T) {
+	t.Parallel()
+	segments, err := ParseTimedText(`<?xml version="1.0" encoding="utf-8" ?><transcript>` +
+		`<text start="0.5" dur="3.25">Lobsters &amp;amp; crabs</text><text start="3.75" dur="2">molt.</text></transcript>`)
+	if err != nil {
+		t.Fatalf("ParseTimedText: expected no error, got %v", err)
+	}
+	expected := []models.Segment{{Start: 0.5, End: 3.75, Text: "Lobsters & crabs"}, {Start: 3.75, End: 5.75, Text: "molt."}}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("ParseTimedText: expected %+v, got %+v", expected, segments)
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "youtube", "watch.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseTimedText(string(data)); !errors.Is(err, ErrInvalidCaptions) {
+		t.Errorf("ParseTimedText: expected ErrInvalidCaptions for HTML, got %v", err)
+	}
+}
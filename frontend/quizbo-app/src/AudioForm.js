@@ -1,6 +1,7 @@
 import React, { useState } from "react";
 import "./AudioForm.css";
 import { db, storage } from "./firebase";
+import { waitForQuizJob } from "./quizJobs";
 import { doc, setDoc } from "firebase/firestore";
 import { ref, uploadBytes, getDownloadURL } from "firebase/storage";
 
@@ -71,7 +72,7 @@ function AudioForm({ user, activePersona, setPage, setContentID, setQuizID }) {
         throw new Error(`Error submitting audio: ${res.statusText}`);
       }
 
-      const data = await res.json();
+      const data = await waitForQuizJob(await res.json(), idToken);
       setContentID(data.content_id);
       setQuizID(data.quiz_id);
 
@@ -1,7 +1,21 @@
 import React, { useState, useEffect } from "react";
 import "./ContentManagementPage.css";
-import { db } from "./firebase";
-import { collection, getDocs, doc, deleteDoc } from "firebase/firestore";
+
+const API_BASE_URL = "https://read-robin-dev-6yudia4zva-nn.a.run.app";
+
+// Calls the content management API as the signed-in user, returning the
+// parsed JSON body, or null for responses without one.
+async function contentRequest(user, path, options = {}) {
+  const idToken = await user.getIdToken();
+  const res = await fetch(`${API_BASE_URL}${path}`, {
+    ...options,
+    headers: { ...options.headers, Authorization: `Bearer ${idToken}` },
+  });
+  if (!res.ok) {
+    throw new Error(res.statusText);
+  }
+  return res.status === 204 ? null : res.json();
+}
 
 function ContentManagementPage({
   user,
@@ -23,44 +37,28 @@ function ContentManagementPage({
     const fetchContents = async () => {
       setLoading(true);
       try {
-        if (!user || !activePersona || !activePersona.id) {
-          throw new Error("User or active persona is not defined");
+        if (!user) {
+          throw new Error("User is not defined");
         }
 
-        const contentsRef = collection(
-          db,
-          "users",
-          user.uid,
-          "personas",
-          activePersona.id,
-          "quizzes"
-        );
-        const contentsSnapshot = await getDocs(contentsRef);
-        const contentsList = await Promise.all(
-          contentsSnapshot.docs.map(async (doc) => {
-            const attemptsRef = collection(doc.ref, "attempts");
-            const attemptsSnapshot = await getDocs(attemptsRef);
-            const attempts = attemptsSnapshot.docs.map((attemptDoc) => ({
-              id: attemptDoc.id,
-              ...attemptDoc.data(),
-            }));
-            const mostRecentAttempt =
-              attemptsSnapshot.docs.length > 0
-                ? attemptsSnapshot.docs.sort(
-                    (a, b) =>
-                      b.data().createdAt.seconds - a.data().createdAt.seconds
-                  )[0]
-                : null;
-            return {
-              id: doc.id,
-              ...doc.data(),
-              attempts: attempts.length,
-              mostRecentScore: mostRecentAttempt
-                ? mostRecentAttempt.data().score
-                : null,
-            };
-          })
-        );
+        const contentsList = [];
+        for (let cursor = ""; ; ) {
+          const page = await contentRequest(
+            user,
+            `/content?sort=created&limit=100&cursor=${encodeURIComponent(cursor)}`
+          );
+          contentsList.push(
+            ...page.items.map((item) => ({
+              id: item.content_id,
+              ...item,
+              mostRecentScore: item.last_score ?? null,
+            }))
+          );
+          if (!page.next_cursor) {
+            break;
+          }
+          cursor = page.next_cursor;
+        }
         setContents(contentsList);
       } catch (error) {
         console.error("Error fetching contents:", error);
@@ -70,12 +68,28 @@ function ContentManagementPage({
     };
 
     fetchContents();
-  }, [user, activePersona]);
+  }, [user]);
+
+  // The list leaves out content text, which is fetched when it is needed
+  const fetchContentText = async (contentID) => {
+    const content = await contentRequest(user, `/content/${contentID}`);
+    return content.content_text;
+  };
 
-  const handleGenerateQuiz = async (contentID, title, url, contentText) => {
+  const handleGenerateQuiz = async (contentID, title, url) => {
     setError(null);
     setLoading(true);
 
+    let contentText;
+    try {
+      contentText = await fetchContentText(contentID);
+    } catch (error) {
+      console.error("Error:", error);
+      setError(`Error fetching content: ${error.message}`);
+      setLoading(false);
+      return;
+    }
+
     const payload = {
       content_id: contentID,
       content_text: contentText,
@@ -124,10 +138,16 @@ function ContentManagementPage({
     }
   };
 
-  const handleSeeContent = (contentText, contentTitle) => {
-    setPopupContent(contentText);
-    setPopupTitle(contentTitle);
-    setShowPopup(true);
+  const handleSeeContent = async (contentID, contentTitle) => {
+    setError(null);
+    try {
+      setPopupContent(await fetchContentText(contentID));
+      setPopupTitle(contentTitle);
+      setShowPopup(true);
+    } catch (error) {
+      console.error("Error fetching content:", error);
+      setError("Error fetching content: " + error.message);
+    }
   };
 
   const closePopup = () => {
@@ -145,16 +165,9 @@ function ContentManagementPage({
     setLoading(true);
     setShowConfirmation(false);
     try {
-      const contentDocRef = doc(
-        db,
-        "users",
-        user.uid,
-        "personas",
-        activePersona.id,
-        "quizzes",
-        contentToDelete
-      );
-      await deleteDoc(contentDocRef);
+      await contentRequest(user, `/content/${contentToDelete}`, {
+        method: "DELETE",
+      });
       setContents(contents.filter((content) => content.id !== contentToDelete));
     } catch (error) {
       console.error("Error deleting content:", error);
@@ -170,19 +183,19 @@ function ContentManagementPage({
     setContentToDelete(null);
   };
 
-  // Group contents by content_type
-  const groupContentsByContentType = (contents) => {
+  // Group contents into those the user owns and those shared with them
+  const groupContentsByOwner = (contents) => {
     return contents.reduce((acc, content) => {
-      const { content_type } = content;
-      if (!acc[content_type]) {
-        acc[content_type] = [];
+      const group = content.shared ? "Shared with you" : "Your uploads";
+      if (!acc[group]) {
+        acc[group] = [];
       }
-      acc[content_type].push(content);
+      acc[group].push(content);
       return acc;
     }, {});
   };
 
-  const groupedContents = groupContentsByContentType(contents);
+  const groupedContents = groupContentsByOwner(contents);
 
   return (
     <div className="cmp-content-management-page">
@@ -196,39 +209,34 @@ function ContentManagementPage({
               <h3 className="cmp-content-type-title">{contentType}</h3>
               {groupedContents[contentType].map((content) => (
                 <div key={content.id} className="cmp-content-item">
-                  <button
-                    className="cmp-delete-content"
-                    onClick={() => handleDeleteClick(content.id)}
-                  >
-                    &times;
-                  </button>
+                  {!content.shared && (
+                    <button
+                      className="cmp-delete-content"
+                      onClick={() => handleDeleteClick(content.id)}
+                    >
+                      &times;
+                    </button>
+                  )}
                   <h3 style={{ color: "white" }}>{content.title}</h3>
                   <p>Attempts: {content.attempts}</p>
                   <p>
                     Most Recent Score:{" "}
-                    {content.mostRecentScore !== "N/A"
+                    {content.mostRecentScore !== null
                       ? `${content.mostRecentScore}%`
-                      : "0%"}
+                      : "N/A"}
                   </p>
 
                   <button
                     className="cmp-generate-new-quiz"
                     onClick={() =>
-                      handleGenerateQuiz(
-                        content.id,
-                        content.title,
-                        content.url,
-                        content.content_text
-                      )
+                      handleGenerateQuiz(content.id, content.title, content.url)
                     }
                   >
                     New Attempt
                   </button>
                   <button
                     className="cmp-see-content"
-                    onClick={() =>
-                      handleSeeContent(content.content_text, content.title)
-                    }
+                    onClick={() => handleSeeContent(content.id, content.title)}
                   >
                     See Content
                   </button>
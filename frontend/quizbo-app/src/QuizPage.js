@@ -3,6 +3,25 @@ import "./QuizPage.css";
 import { db } from "./firebase";
 import { doc, setDoc, getDoc, Timestamp } from "firebase/firestore";
 
+const API_BASE_URL = "https://read-robin-dev-6yudia4zva-nn.a.run.app";
+
+// startAttempt starts a server-side attempt at the quiz, which records the reviewed responses and the score
+const startAttempt = async (idToken, contentID, quizID) => {
+  const res = await fetch(`${API_BASE_URL}/attempts`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      Authorization: `Bearer ${idToken}`,
+    },
+    body: JSON.stringify({ content_id: contentID, quiz_id: quizID }),
+  });
+  if (!res.ok) {
+    throw new Error(`Error starting attempt: ${res.statusText}`);
+  }
+  const attempt = await res.json();
+  return attempt.attempt_id;
+};
+
 function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
   const [questions, setQuestions] = useState([]);
   const [responses, setResponses] = useState({});
@@ -14,6 +33,7 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
     const timestamp = new Date().toISOString();
     return `${quizID}@${timestamp}`;
   });
+  const [serverAttemptID, setServerAttemptID] = useState(null);
   const [quizTitle, setQuizTitle] = useState("");
   const [showPopup, setShowPopup] = useState(false);
   const [popupContent, setPopupContent] = useState("");
@@ -40,12 +60,17 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
           setQuizTitle(quizDoc.data().title || ""); // Fetch title
         }
 
+        const idToken = await user.getIdToken();
         const res = await fetch(
-          `https://read-robin-dev-6yudia4zva-nn.a.run.app/quiz/${contentID}/${quizID}`
+          `https://read-robin-dev-6yudia4zva-nn.a.run.app/quiz/${contentID}/${quizID}`,
+          {
+            headers: { Authorization: `Bearer ${idToken}` },
+          }
         );
         const data = await res.json();
         if (data.questions) {
           setQuestions(data.questions);
+          setServerAttemptID(await startAttempt(idToken, contentID, quizID));
         } else {
           setError("Error fetching questions");
         }
@@ -63,6 +88,74 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
     setResponses(newResponses);
   };
 
+  // Fill-in-the-blank responses are an array with one entry per blank
+  const handleBlankChange = (e, index, blankIndex, blankCount) => {
+    const blanks = [...(responses[index] || Array(blankCount).fill(""))];
+    blanks[blankIndex] = e.target.value;
+    setResponses({ ...responses, [index]: blanks });
+  };
+
+  const renderResponseInput = (item, index) => {
+    switch (item.type) {
+      case "multiple_choice":
+        return item.multiple_choice.choices.map((choice, choiceIndex) => (
+          <label key={choiceIndex} className="choice">
+            <input
+              type="radio"
+              name={`question-${index}`}
+              value={String(choiceIndex)}
+              checked={responses[index] === String(choiceIndex)}
+              onChange={(e) => handleResponseChange(e, index)}
+            />
+            {choice}
+          </label>
+        ));
+      case "true_false":
+        return ["true", "false"].map((value) => (
+          <label key={value} className="choice">
+            <input
+              type="radio"
+              name={`question-${index}`}
+              value={value}
+              checked={responses[index] === value}
+              onChange={(e) => handleResponseChange(e, index)}
+            />
+            {value === "true" ? "True" : "False"}
+          </label>
+        ));
+      case "fill_in_blank": {
+        const parts = item.fill_in_blank.text.split("___");
+        const blankCount = item.fill_in_blank.blanks.length;
+        return (
+          <p className="cloze">
+            {parts.map((part, partIndex) => (
+              <span key={partIndex}>
+                {part}
+                {partIndex < blankCount && (
+                  <input
+                    type="text"
+                    value={(responses[index] || [])[partIndex] || ""}
+                    onChange={(e) =>
+                      handleBlankChange(e, index, partIndex, blankCount)
+                    }
+                  />
+                )}
+              </span>
+            ))}
+          </p>
+        );
+      }
+      default:
+        return (
+          <input
+            type="text"
+            value={responses[index] || ""}
+            onChange={(e) => handleResponseChange(e, index)}
+          />
+        );
+    }
+  };
+
   const calculateScore = (responses) => {
     const totalQuestions = responses.length;
     const correctAnswers = responses.filter(
@@ -97,11 +190,20 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
       return;
     }
 
+    // Multiple-choice responses are the index of the chosen answer
+    const isChoice = questionData.type === "multiple_choice";
     const payload = {
       content_id: contentID,
       quiz_id: quizID,
       question_id: questionID,
-      user_response: userResponse,
+      user_response: Array.isArray(userResponse)
+        ? userResponse.join(", ")
+        : isChoice
+        ? questionData.multiple_choice.choices[Number(userResponse)]
+        : userResponse,
+      choice_index: isChoice ? Number(userResponse) : undefined,
+      blanks: Array.isArray(userResponse) ? userResponse : undefined,
+      attempt_id: serverAttemptID,
       persona: {
         id: activePersona.id,
         name: activePersona.name,
@@ -113,12 +215,14 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
 
     try {
       setSubmitting({ ...submitting, [index]: true });
+      const idToken = await user.getIdToken();
       const res = await fetch(
         `https://read-robin-dev-6yudia4zva-nn.a.run.app/submit-response`,
         {
           method: "POST",
           headers: {
             "Content-Type": "application/json",
+            Authorization: `Bearer ${idToken}`,
           },
           body: JSON.stringify(payload),
         }
@@ -140,6 +244,20 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
       setStatus(newStatus);
       setExplanations(newExplanations);
 
+      // Score the attempt on the server once every question has been answered
+      if (Object.keys(newStatus).length === questions.length) {
+        const finishRes = await fetch(
+          `${API_BASE_URL}/attempts/${serverAttemptID}/finish`,
+          {
+            method: "POST",
+            headers: { Authorization: `Bearer ${idToken}` },
+          }
+        );
+        if (!finishRes.ok) {
+          console.error("Error finishing attempt:", finishRes.statusText);
+        }
+      }
+
       const attemptRef = doc(
         db,
         "users",
@@ -165,7 +283,9 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
           question: questionData.question,
           answer: questionData.answer,
           reference: questionData.reference,
-          userResponse: userResponse,
+          userResponse: Array.isArray(userResponse)
+            ? userResponse.join(", ")
+            : userResponse,
           status: data.status.trim() === "PASS" ? "Correct" : "Incorrect",
         },
       ];
@@ -193,9 +313,15 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
     }
   };
 
-  const handleRetakeQuiz = () => {
+  const handleRetakeQuiz = async () => {
     const timestamp = new Date().toISOString();
     setAttemptID(`${quizID}@${timestamp}`);
+    try {
+      const idToken = await user.getIdToken();
+      setServerAttemptID(await startAttempt(idToken, contentID, quizID));
+    } catch (error) {
+      console.error("Error starting attempt:", error);
+    }
     setResponses({});
     setStatus({});
     setExplanations({});
@@ -228,11 +354,7 @@ function QuizPage({ user, activePersona, setPage, contentID, quizID }) {
                 <h3>Question {index + 1}</h3>
                 <p>{item.question}</p>
                 <div className="response-container">
-                  <input
-                    type="text"
-                    value={responses[index] || ""}
-                    onChange={(e) => handleResponseChange(e, index)}
-                  />
+                  {renderResponseInput(item, index)}
                   <button
                     onClick={() =>
                       handleSubmitResponse(index, item.question_id)
@@ -1,6 +1,7 @@
 import React, { useState } from "react";
 import "./TextForm.css";
 import { db } from "./firebase";
+import { waitForQuizJob } from "./quizJobs";
 import { doc, setDoc } from "firebase/firestore";
 
 function TextForm({ user, activePersona, setPage, setContentID, setQuizID }) {
@@ -50,7 +51,7 @@ function TextForm({ user, activePersona, setPage, setContentID, setQuizID }) {
         throw new Error(`Error submitting text: ${res.statusText}`);
       }
 
-      const data = await res.json();
+      const data = await waitForQuizJob(await res.json(), idToken);
       setContentID(data.content_id);
       setQuizID(data.quiz_id);
 
@@ -1,6 +1,7 @@
 import React, { useState } from "react";
 import "./URLForm.css";
 import { db } from "./firebase";
+import { waitForQuizJob } from "./quizJobs";
 import { doc, setDoc } from "firebase/firestore";
 
 function UrlForm({ user, activePersona, setPage, setContentID, setQuizID }) {
@@ -63,7 +64,7 @@ function UrlForm({ user, activePersona, setPage, setContentID, setQuizID }) {
         throw new Error(`Error submitting URL: ${res.statusText}`);
       }
 
-      const data = await res.json();
+      const data = await waitForQuizJob(await res.json(), idToken);
       setContentID(data.content_id);
       setQuizID(data.quiz_id);
 
@@ -0,0 +1,36 @@
+const API_BASE_URL = "https://read-robin-dev-6yudia4zva-nn.a.run.app";
+const POLL_INTERVAL_MS = 2000;
+
+// Polls the job returned by /submit until it finishes and resolves with its
+// result ({ content_id, quiz_id, url, title, content_text, is_first_quiz }).
+// Job results leave out the content text, which is fetched from the content.
+export async function waitForQuizJob(submitResponse, idToken) {
+  const jobID = submitResponse.job_id;
+
+  for (;;) {
+    const res = await fetch(`${API_BASE_URL}/jobs/${jobID}`, {
+      headers: { Authorization: `Bearer ${idToken}` },
+    });
+    if (!res.ok) {
+      throw new Error(`Error checking quiz status: ${res.statusText}`);
+    }
+
+    const job = await res.json();
+    if (job.status === "succeeded") {
+      const contentRes = await fetch(
+        `${API_BASE_URL}/content/${job.result.content_id}`,
+        { headers: { Authorization: `Bearer ${idToken}` } }
+      );
+      if (!contentRes.ok) {
+        throw new Error(`Error fetching quiz content: ${contentRes.statusText}`);
+      }
+      const content = await contentRes.json();
+      return { ...job.result, content_text: content.content_text };
+    }
+    if (job.status === "failed") {
+      throw new Error(job.error || "Quiz generation failed");
+    }
+
+    await new Promise((resolve) => setTimeout(resolve, POLL_INTERVAL_MS));
+  }
+}